@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type abuseIPDBEnricher struct {
+	client  *http.Client
+	key     string
+	baseURL string
+	maxAge  int
+}
+
+type abuseIPDBResponse struct {
+	Data struct {
+		IPAddress            string `json:"ipAddress"`
+		AbuseConfidenceScore int    `json:"abuseConfidenceScore"`
+		ISP                  string `json:"isp"`
+		UsageType            string `json:"usageType"`
+		Domain               string `json:"domain"`
+		CountryCode          string `json:"countryCode"`
+		TotalReports         int    `json:"totalReports"`
+		LastReportedAt       string `json:"lastReportedAt"`
+		IsWhitelisted        bool   `json:"isWhitelisted"`
+	} `json:"data"`
+}
+
+func (a *abuseIPDBEnricher) name() string { return "abuseipdb" }
+
+func (a *abuseIPDBEnricher) supports(ioc string) bool {
+	return iocType(ioc) == iocIP && isPublicIP(ioc)
+}
+
+func (a *abuseIPDBEnricher) lookup(ctx context.Context, ioc string) (map[string]any, error) {
+	query := url.Values{}
+	query.Set("ipAddress", ioc)
+	query.Set("maxAgeInDays", strconv.Itoa(a.maxAge))
+
+	var resp abuseIPDBResponse
+	headers := map[string]string{"Key": a.key}
+	if err := doJSON(ctx, a.client, http.MethodGet, a.baseURL+"/check?"+query.Encode(), headers, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"abuseConfidenceScore": resp.Data.AbuseConfidenceScore,
+		"isp":                  resp.Data.ISP,
+		"usageType":            resp.Data.UsageType,
+		"domain":               resp.Data.Domain,
+		"countryCode":          resp.Data.CountryCode,
+		"totalReports":         resp.Data.TotalReports,
+		"lastReportedAt":       resp.Data.LastReportedAt,
+		"isWhitelisted":        resp.Data.IsWhitelisted,
+	}, nil
+}
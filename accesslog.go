@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	accessView     = "view"
+	accessExport   = "export"
+	accessDownload = "download"
+)
+
+type AccessEntry struct {
+	At         time.Time `json:"at"`
+	User       string    `json:"user"`
+	UserType   string    `json:"userType,omitempty"`
+	Action     string    `json:"action"`
+	Resource   string    `json:"resource"`
+	RemoteAddr string    `json:"remoteAddr"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+}
+
+// AccessLog records who viewed or exported each incident. It is kept
+// separately from the incident so reading it never shows up as an update.
+type AccessLog struct {
+	mu         sync.RWMutex
+	entries    map[string][]AccessEntry
+	maxEntries int
+	audit      *AuditLog
+}
+
+func newAccessLog(audit *AuditLog) *AccessLog {
+	return &AccessLog{
+		entries:    make(map[string][]AccessEntry),
+		maxEntries: envInt("ACCESS_LOG_MAX_ENTRIES", 1000),
+		audit:      audit,
+	}
+}
+
+func (a *AccessLog) record(r *http.Request, id, action string) {
+	entry := AccessEntry{
+		At:         time.Now().UTC(),
+		User:       "anonymous",
+		Action:     action,
+		Resource:   r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}
+	if principal, ok := principalFrom(r.Context()); ok {
+		entry.User = principal.ID
+		entry.UserType = principal.Kind
+	}
+	a.audit.record(AuditEvent{
+		At:         entry.At,
+		Actor:      entry.User,
+		ActorType:  entry.UserType,
+		Action:     "incident." + action,
+		Tenant:     tenantFrom(r.Context()),
+		IncidentID: id,
+		Resource:   entry.Resource,
+		RemoteAddr: entry.RemoteAddr,
+		UserAgent:  entry.UserAgent,
+	})
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries := append(a.entries[id], entry)
+	if a.maxEntries > 0 && len(entries) > a.maxEntries {
+		entries = entries[len(entries)-a.maxEntries:]
+	}
+	a.entries[id] = entries
+}
+
+// forget drops an incident's entries once the incident itself is purged.
+func (a *AccessLog) forget(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.entries, id)
+}
+
+// list returns entries newest first.
+func (a *AccessLog) list(id string) []AccessEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	entries := a.entries[id]
+	items := make([]AccessEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		items = append(items, entries[i])
+	}
+	return items
+}
+
+func handleIncidentAccessLog(w http.ResponseWriter, r *http.Request, id string, parts []string, store *IncidentStore, access *AccessLog) {
+	if len(parts) == 3 && parts[2] != "review" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !requireRole(w, r, roleAdmin) {
+		return
+	}
+	if _, ok := store.get(id); !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if len(parts) == 3 {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		handleAccessLogReview(w, r, id, store, access)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": access.list(id)})
+}
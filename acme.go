@@ -0,0 +1,621 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ACME challenge types. http-01 needs the plain HTTP listener on port 80;
+// tls-alpn-01 is answered on the HTTPS port itself.
+const (
+	acmeHTTP01    = "http-01"
+	acmeTLSALPN01 = "tls-alpn-01"
+
+	acmeALPNProto     = "acme-tls/1"
+	acmeChallengePath = "/.well-known/acme-challenge/"
+
+	letsEncryptDirectory = "https://acme-v02.api.letsencrypt.org/directory"
+)
+
+// idPeACMEIdentifier is the certificate extension that carries the
+// tls-alpn-01 key authorization (RFC 8737).
+var idPeACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// ACMEManager obtains and renews one certificate for all of ACME_DOMAINS
+// from an ACME CA such as Let's Encrypt, keeping the account key and the
+// certificate in ACME_CACHE_DIR so restarts don't request new ones.
+type ACMEManager struct {
+	domains     []string
+	email       string
+	directory   string
+	cacheDir    string
+	renewBefore time.Duration
+	challenge   string
+	client      *http.Client
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	// tokens are the pending http-01 key authorizations by token, and
+	// alpnCerts the tls-alpn-01 validation certificates by domain.
+	tokens    map[string]string
+	alpnCerts map[string]*tls.Certificate
+
+	// Account state, used only by the renewal goroutine.
+	key   *ecdsa.PrivateKey
+	kid   string
+	nonce string
+	dir   acmeDirectory
+}
+
+type acmeDirectory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type acmeOrder struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+}
+
+type acmeAuthorization struct {
+	Status     string `json:"status"`
+	Identifier struct {
+		Value string `json:"value"`
+	} `json:"identifier"`
+	Challenges []acmeChallenge `json:"challenges"`
+}
+
+type acmeChallenge struct {
+	Type   string       `json:"type"`
+	URL    string       `json:"url"`
+	Token  string       `json:"token"`
+	Status string       `json:"status"`
+	Error  *acmeProblem `json:"error,omitempty"`
+}
+
+type acmeProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (p *acmeProblem) Error() string {
+	return p.Type + ": " + p.Detail
+}
+
+// newACMEManager reads ACME_DOMAINS, returning nil when it is unset. The
+// http-01 challenge is used when httpListener is on, since the CA reaches
+// it on port 80, and tls-alpn-01 otherwise.
+func newACMEManager(httpListener bool) *ACMEManager {
+	domains := sanitizeSlice(strings.Split(envString("ACME_DOMAINS", ""), ","))
+	if len(domains) == 0 {
+		return nil
+	}
+	for i, domain := range domains {
+		domains[i] = strings.ToLower(domain)
+	}
+	challenge := acmeTLSALPN01
+	if httpListener {
+		challenge = acmeHTTP01
+	}
+	return &ACMEManager{
+		domains:     domains,
+		email:       envString("ACME_EMAIL", ""),
+		directory:   envString("ACME_DIRECTORY_URL", letsEncryptDirectory),
+		cacheDir:    envString("ACME_CACHE_DIR", "acme-cache"),
+		renewBefore: envDuration("ACME_RENEW_BEFORE", 30*24*time.Hour),
+		challenge:   challenge,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		tokens:      map[string]string{},
+		alpnCerts:   map[string]*tls.Certificate{},
+	}
+}
+
+// tlsConfig serves the managed certificate, and the validation
+// certificates while a tls-alpn-01 challenge is open.
+func (m *ACMEManager) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1", acmeALPNProto},
+		GetCertificate: m.getCertificate,
+	}
+}
+
+func (m *ACMEManager) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acmeALPNProto {
+		if cert, ok := m.alpnCerts[strings.ToLower(hello.ServerName)]; ok {
+			return cert, nil
+		}
+		return nil, fmt.Errorf("acme: no tls-alpn-01 challenge open for %q", hello.ServerName)
+	}
+	if m.cert == nil {
+		return nil, errors.New("acme: certificate not issued yet")
+	}
+	return m.cert, nil
+}
+
+// httpHandler answers http-01 challenges and passes everything else to
+// next.
+func (m *ACMEManager) httpHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.URL.Path, acmeChallengePath)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m.mu.RLock()
+		keyAuth, ok := m.tokens[token]
+		m.mu.RUnlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, keyAuth)
+	})
+}
+
+// start loads the cached certificate and keeps it renewed in the
+// background until ctx is done. Renewal is checked hourly, which also
+// retries a failed request.
+func (m *ACMEManager) start(ctx context.Context) {
+	if err := m.loadCached(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("acme: ignoring cached certificate: %v", err)
+	}
+	go func() {
+		m.renewIfDue(ctx)
+		runEvery(ctx, time.Hour, func(time.Time) { m.renewIfDue(ctx) })
+	}()
+}
+
+func (m *ACMEManager) certPath() string {
+	return filepath.Join(m.cacheDir, "certificate.pem")
+}
+
+func (m *ACMEManager) loadCached() error {
+	pemBytes, err := os.ReadFile(m.certPath())
+	if err != nil {
+		return err
+	}
+	cert, err := parseACMEBundle(pemBytes)
+	if err != nil {
+		return err
+	}
+	if !slices.EqualFunc(cert.Leaf.DNSNames, m.domains, strings.EqualFold) {
+		return fmt.Errorf("cached certificate is for %s, not %s", strings.Join(cert.Leaf.DNSNames, ","), strings.Join(m.domains, ","))
+	}
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	return nil
+}
+
+// parseACMEBundle reads a cached key and certificate chain, one PEM file
+// holding both.
+func parseACMEBundle(bundle []byte) (tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(bundle, bundle)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	return cert, err
+}
+
+// renewIfDue requests a certificate when there is none or the current one
+// expires within renewBefore. Failures are retried on the next check.
+func (m *ACMEManager) renewIfDue(ctx context.Context) {
+	m.mu.RLock()
+	cert := m.cert
+	m.mu.RUnlock()
+	if cert != nil && time.Until(cert.Leaf.NotAfter) > m.renewBefore {
+		return
+	}
+	log.Printf("acme: requesting a certificate for %s using %s", strings.Join(m.domains, ", "), m.challenge)
+	if err := m.obtain(ctx); err != nil {
+		log.Printf("acme: %v", err)
+		return
+	}
+	log.Printf("acme: certificate issued for %s", strings.Join(m.domains, ", "))
+}
+
+func (m *ACMEManager) obtain(ctx context.Context) error {
+	if err := m.account(ctx); err != nil {
+		return fmt.Errorf("account: %w", err)
+	}
+	identifiers := []map[string]string{}
+	for _, domain := range m.domains {
+		identifiers = append(identifiers, map[string]string{"type": "dns", "value": domain})
+	}
+	var order acmeOrder
+	resp, err := m.post(ctx, m.dir.NewOrder, map[string]any{"identifiers": identifiers}, &order)
+	if err != nil {
+		return fmt.Errorf("new order: %w", err)
+	}
+	orderURL := resp.Header.Get("Location")
+
+	for _, authzURL := range order.Authorizations {
+		if err := m.authorize(ctx, authzURL); err != nil {
+			return err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.domains[0]},
+		DNSNames: m.domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+	if _, err := m.post(ctx, order.Finalize, map[string]string{"csr": base64.RawURLEncoding.EncodeToString(csr)}, &order); err != nil {
+		return fmt.Errorf("finalize: %w", err)
+	}
+	for order.Status != "valid" {
+		if order.Status == "invalid" {
+			return errors.New("order was refused")
+		}
+		if err := sleepContext(ctx, 2*time.Second); err != nil {
+			return err
+		}
+		if _, err := m.post(ctx, orderURL, nil, &order); err != nil {
+			return fmt.Errorf("polling order: %w", err)
+		}
+	}
+
+	resp, err = m.post(ctx, order.Certificate, nil, nil)
+	if err != nil {
+		return fmt.Errorf("downloading certificate: %w", err)
+	}
+	chain, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	bundle := append(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), chain...)
+	cert, err := parseACMEBundle(bundle)
+	if err != nil {
+		return fmt.Errorf("issued certificate: %w", err)
+	}
+	if err := os.WriteFile(m.certPath(), bundle, 0o600); err != nil {
+		log.Printf("acme: caching certificate: %v", err)
+	}
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	return nil
+}
+
+// authorize proves control of one domain and waits for the CA to agree.
+func (m *ACMEManager) authorize(ctx context.Context, authzURL string) error {
+	var authz acmeAuthorization
+	if _, err := m.post(ctx, authzURL, nil, &authz); err != nil {
+		return fmt.Errorf("authorization: %w", err)
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+	domain := authz.Identifier.Value
+	var challenge *acmeChallenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == m.challenge {
+			challenge = &authz.Challenges[i]
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("%s: the CA doesn't offer %s", domain, m.challenge)
+	}
+
+	keyAuth := challenge.Token + "." + m.thumbprint()
+	if err := m.openChallenge(domain, challenge.Token, keyAuth); err != nil {
+		return err
+	}
+	defer m.closeChallenge(domain, challenge.Token)
+
+	resp, err := m.post(ctx, challenge.URL, map[string]any{}, nil)
+	if err != nil {
+		return fmt.Errorf("%s: answering challenge: %w", domain, err)
+	}
+	resp.Body.Close()
+	for {
+		if err := sleepContext(ctx, 2*time.Second); err != nil {
+			return err
+		}
+		if _, err := m.post(ctx, authzURL, nil, &authz); err != nil {
+			return fmt.Errorf("%s: polling authorization: %w", domain, err)
+		}
+		switch authz.Status {
+		case "valid":
+			return nil
+		case "pending", "processing":
+			continue
+		}
+		for _, c := range authz.Challenges {
+			if c.Type == m.challenge && c.Error != nil {
+				return fmt.Errorf("%s: %s failed: %w", domain, m.challenge, c.Error)
+			}
+		}
+		return fmt.Errorf("%s: authorization %s", domain, authz.Status)
+	}
+}
+
+func (m *ACMEManager) openChallenge(domain, token, keyAuth string) error {
+	if m.challenge == acmeHTTP01 {
+		m.mu.Lock()
+		m.tokens[token] = keyAuth
+		m.mu.Unlock()
+		return nil
+	}
+	cert, err := alpnChallengeCert(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.alpnCerts[domain] = cert
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *ACMEManager) closeChallenge(domain, token string) {
+	m.mu.Lock()
+	delete(m.tokens, token)
+	delete(m.alpnCerts, domain)
+	m.mu.Unlock()
+}
+
+// alpnChallengeCert is the self-signed certificate carrying the key
+// authorization digest that tls-alpn-01 validation looks for.
+func alpnChallengeCert(domain, keyAuth string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(keyAuth))
+	value, err := asn1.Marshal(digest[:])
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: domain},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(24 * time.Hour),
+		DNSNames:        []string{domain},
+		ExtraExtensions: []pkix.Extension{{Id: idPeACMEIdentifier, Critical: true, Value: value}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// account loads or creates the account key and registers it, which for
+// an existing key just returns its account URL.
+func (m *ACMEManager) account(ctx context.Context) error {
+	if m.kid != "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.cacheDir, 0o700); err != nil {
+		return err
+	}
+	key, err := loadOrCreateACMEKey(filepath.Join(m.cacheDir, "account.key"))
+	if err != nil {
+		return err
+	}
+	m.key = key
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.directory, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("directory %s: %s", m.directory, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&m.dir); err != nil {
+		return fmt.Errorf("directory %s: %w", m.directory, err)
+	}
+
+	account := map[string]any{"termsOfServiceAgreed": true}
+	if m.email != "" {
+		account["contact"] = []string{"mailto:" + m.email}
+	}
+	resp, err = m.post(ctx, m.dir.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	m.kid = resp.Header.Get("Location")
+	if m.kid == "" {
+		return errors.New("no account URL in new account response")
+	}
+	return nil
+}
+
+func loadOrCreateACMEKey(path string) (*ecdsa.PrivateKey, error) {
+	if pemBytes, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(pemBytes)
+		if block == nil {
+			return nil, fmt.Errorf("%s: not PEM", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// jwk is the account key as a JSON Web Key, with its members in the order
+// RFC 7638 thumbprints require.
+func (m *ACMEManager) jwk() map[string]string {
+	size := (m.key.Curve.Params().BitSize + 7) / 8
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   base64.RawURLEncoding.EncodeToString(m.key.X.FillBytes(make([]byte, size))),
+		"y":   base64.RawURLEncoding.EncodeToString(m.key.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+func (m *ACMEManager) thumbprint() string {
+	// encoding/json sorts map keys, which is the canonical order.
+	encoded, _ := json.Marshal(m.jwk())
+	sum := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (m *ACMEManager) fetchNonce(ctx context.Context) (string, error) {
+	if m.nonce != "" {
+		nonce := m.nonce
+		m.nonce = ""
+		return nonce, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, m.dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("no Replay-Nonce from " + m.dir.NewNonce)
+	}
+	return nonce, nil
+}
+
+// post sends a JWS-signed request. A nil payload is a POST-as-GET. The
+// response is decoded into out when it is non-nil; otherwise the caller
+// reads and closes its body. A stale nonce is retried once, as RFC 8555
+// expects.
+func (m *ACMEManager) post(ctx context.Context, url string, payload, out any) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := m.postOnce(ctx, url, payload)
+		if err != nil {
+			return nil, err
+		}
+		if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+			m.nonce = nonce
+		}
+		if resp.StatusCode >= 400 {
+			problem := &acmeProblem{}
+			json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(problem)
+			resp.Body.Close()
+			if problem.Type == "urn:ietf:params:acme:error:badNonce" && attempt == 0 {
+				continue
+			}
+			if problem.Type == "" {
+				return nil, fmt.Errorf("%s: %s", url, resp.Status)
+			}
+			return nil, problem
+		}
+		if out == nil {
+			return resp, nil
+		}
+		defer resp.Body.Close()
+		return resp, json.NewDecoder(resp.Body).Decode(out)
+	}
+}
+
+func (m *ACMEManager) postOnce(ctx context.Context, url string, payload any) (*http.Response, error) {
+	nonce, err := m.fetchNonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+	protected := map[string]any{"alg": "ES256", "nonce": nonce, "url": url}
+	if m.kid != "" {
+		protected["kid"] = m.kid
+	} else {
+		protected["jwk"] = m.jwk()
+	}
+	header, _ := json.Marshal(protected)
+	body := ""
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = base64.RawURLEncoding.EncodeToString(encoded)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + body
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, m.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	// JWS wants the raw r and s, not the ASN.1 signature.
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	jws, _ := json.Marshal(map[string]string{
+		"protected": base64.RawURLEncoding.EncodeToString(header),
+		"payload":   body,
+		"signature": base64.RawURLEncoding.EncodeToString(signature),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jws))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+	return m.client.Do(req)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,595 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertMapping describes how to turn one tool's alert JSON into an incident.
+// Field references are dotted paths into the alert.
+type AlertMapping struct {
+	Source        string            `json:"source"`
+	TitleTemplate string            `json:"titleTemplate"`
+	SeverityField string            `json:"severityField"`
+	SeverityMap   map[string]string `json:"severityMap,omitempty"`
+	IOCFields     []string          `json:"iocFields"`
+	TagFields     []string          `json:"tagFields,omitempty"`
+	HostFields    []string          `json:"hostFields,omitempty"`
+	UserFields    []string          `json:"userFields,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	DedupeFields  []string          `json:"dedupeFields,omitempty"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+}
+
+const defaultAlertSource = "default"
+
+// defaultAlertMapping covers the field names most EDR and SIEM tools use, so
+// simple integrations work without configuring a mapping first.
+func defaultAlertMapping() AlertMapping {
+	return AlertMapping{
+		Source:        defaultAlertSource,
+		SeverityField: "severity",
+		IOCFields:     []string{"iocs", "indicators", "src_ip", "dest_ip", "source.ip", "destination.ip", "domain", "url", "hash", "sha256", "md5"},
+		TagFields:     []string{"tags"},
+		HostFields:    []string{"host", "hostname", "host.name", "device.hostname", "computer_name"},
+		UserFields:    []string{"user", "username", "user.name", "user_name"},
+	}
+}
+
+var alertTitleFields = []string{"title", "name", "rule.name", "alert.signature", "message", "description"}
+
+var alertTemplateField = regexp.MustCompile(`\{([^{}]+)\}`)
+
+var errAlertMappingNotFound = errors.New("alert mapping not found")
+
+type AlertMappingStore struct {
+	mu       sync.RWMutex
+	mappings map[string]AlertMapping
+}
+
+// builtinAlertMappings can be edited but not removed; deleting one restores
+// its defaults.
+var builtinAlertMappings = map[string]func() AlertMapping{
+	defaultAlertSource: defaultAlertMapping,
+	syslogAlertSource:  syslogAlertMapping,
+	cefAlertSource:     cefAlertMapping,
+	leefAlertSource:    leefAlertMapping,
+	splunkAlertSource:  splunkAlertMapping,
+	elasticAlertSource: elasticAlertMapping,
+}
+
+func newAlertMappingStore() *AlertMappingStore {
+	store := &AlertMappingStore{mappings: map[string]AlertMapping{}}
+	for source, builtin := range builtinAlertMappings {
+		store.mappings[source] = builtin()
+	}
+	return store
+}
+
+func (s *AlertMappingStore) list() []AlertMapping {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]AlertMapping, 0, len(s.mappings))
+	for _, mapping := range s.mappings {
+		items = append(items, mapping)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Source < items[j].Source })
+	return items
+}
+
+func (s *AlertMappingStore) get(source string) (AlertMapping, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	mapping, ok := s.mappings[source]
+	return mapping, ok
+}
+
+func (s *AlertMappingStore) put(mapping AlertMapping) AlertMapping {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mapping.UpdatedAt = time.Now().UTC()
+	mapping.IOCFields = sanitizeSlice(mapping.IOCFields)
+	mapping.TagFields = sanitizeSlice(mapping.TagFields)
+	mapping.HostFields = sanitizeSlice(mapping.HostFields)
+	mapping.UserFields = sanitizeSlice(mapping.UserFields)
+	mapping.Tags = sanitizeSlice(mapping.Tags)
+	mapping.DedupeFields = sanitizeSlice(mapping.DedupeFields)
+	s.mappings[mapping.Source] = mapping
+	return mapping
+}
+
+func (s *AlertMappingStore) delete(source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.mappings[source]; !ok {
+		return errAlertMappingNotFound
+	}
+	if builtin, ok := builtinAlertMappings[source]; ok {
+		s.mappings[source] = builtin()
+		return nil
+	}
+	delete(s.mappings, source)
+	return nil
+}
+
+// alertValues returns the string values at a dotted path, splitting
+// comma-separated strings so "1.2.3.4, 5.6.7.8" yields two values.
+func alertValues(alert map[string]any, path string) []string {
+	values, _ := eventField(alert, path)
+	out := []string{}
+	for _, value := range values {
+		out = append(out, strings.Split(value, ",")...)
+	}
+	return sanitizeSlice(out)
+}
+
+func (m AlertMapping) title(alert map[string]any) string {
+	if m.TitleTemplate != "" {
+		title := alertTemplateField.ReplaceAllStringFunc(m.TitleTemplate, func(field string) string {
+			values, _ := eventField(alert, strings.TrimSpace(field[1:len(field)-1]))
+			return strings.Join(values, ", ")
+		})
+		if strings.TrimSpace(title) != "" {
+			return strings.TrimSpace(title)
+		}
+	}
+	for _, field := range alertTitleFields {
+		if values, _ := eventField(alert, field); len(values) > 0 && strings.TrimSpace(values[0]) != "" {
+			return strings.TrimSpace(values[0])
+		}
+	}
+	return "Alert from " + m.Source
+}
+
+// severity maps the alert's severity through SeverityMap, then recognises
+// severity names and 0-100 scores, defaulting to Medium.
+func (m AlertMapping) severity(alert map[string]any) string {
+	values, _ := eventField(alert, m.SeverityField)
+	if len(values) == 0 {
+		return "Medium"
+	}
+	raw := strings.TrimSpace(values[0])
+	for from, to := range m.SeverityMap {
+		if strings.EqualFold(from, raw) {
+			return normalizeSeverity(to)
+		}
+	}
+	if score, err := strconv.ParseFloat(raw, 64); err == nil {
+		switch {
+		case score >= 90:
+			return "Critical"
+		case score >= 70:
+			return "High"
+		case score >= 40:
+			return "Medium"
+		}
+		return "Low"
+	}
+	return normalizeSeverity(raw)
+}
+
+// normalizeSeverity maps a source's severity onto the configured levels:
+// a configured name as is, then common aliases, and otherwise the default
+// severity.
+func normalizeSeverity(value string) string {
+	taxonomies := currentTaxonomies()
+	if level, ok := taxonomies.severity(value); ok {
+		return level.Name
+	}
+	alias := ""
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "critical", "crit", "p1", "fatal":
+		alias = "Critical"
+	case "high", "p2", "error", "severe":
+		alias = "High"
+	case "low", "p4", "info", "informational", "p5":
+		alias = "Low"
+	}
+	if level, ok := taxonomies.severity(alias); ok {
+		return level.Name
+	}
+	return taxonomies.DefaultSeverity
+}
+
+func (m AlertMapping) incidentInput(alert map[string]any) IncidentInput {
+	input := IncidentInput{
+		Title:    m.title(alert),
+		Severity: m.severity(alert),
+		Status:   "New",
+		Source:   m.Source,
+		Tags:     append([]string{"alert", m.Source}, m.Tags...),
+	}
+	for _, field := range m.TagFields {
+		input.Tags = append(input.Tags, alertValues(alert, field)...)
+	}
+	for _, field := range m.IOCFields {
+		input.IOCs = append(input.IOCs, alertValues(alert, field)...)
+	}
+	input.Tags = dedupeStrings(sanitizeSlice(input.Tags))
+	input.IOCs = dedupeStrings(sanitizeSlice(input.IOCs))
+	return input
+}
+
+// dedupeKey identifies repeats of the same alert: the configured fields, or
+// the mapped title plus IOCs.
+func (m AlertMapping) dedupeKey(alert map[string]any, input IncidentInput) string {
+	parts := []string{m.Source}
+	if len(m.DedupeFields) > 0 {
+		for _, field := range m.DedupeFields {
+			values, _ := eventField(alert, field)
+			parts = append(parts, strings.Join(values, ","))
+		}
+		return strings.Join(parts, "|")
+	}
+	iocs := make([]string, 0, len(input.IOCs))
+	for _, ioc := range input.IOCs {
+		iocs = append(iocs, normalizeIOC(ioc))
+	}
+	sort.Strings(iocs)
+	return strings.Join(append(append(parts, strings.ToLower(input.Title)), iocs...), "|")
+}
+
+func dedupeStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		key := strings.ToLower(value)
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+type alertGroup struct {
+	incidentID string
+	lastSeen   time.Time
+}
+
+// AlertIngester maps alerts to incidents. Repeats of the same alert within
+// the dedupe window fold into the incident it already opened, and alerts
+// sharing an IOC, host, or user within the correlation window join the
+// incident that saw them last.
+type AlertIngester struct {
+	store             *IncidentStore
+	mappings          *AlertMappingStore
+	window            time.Duration
+	correlationWindow time.Duration
+	correlateOn       map[string]bool
+
+	mu           sync.Mutex
+	groups       map[string]alertGroup
+	correlations map[string]alertGroup
+	counter      int
+}
+
+func newAlertIngester(store *IncidentStore, mappings *AlertMappingStore) *AlertIngester {
+	correlateOn := map[string]bool{}
+	for _, kind := range sanitizeSlice(strings.Split(envString("ALERT_CORRELATION_KEYS", "ioc,host,user"), ",")) {
+		correlateOn[strings.ToLower(kind)] = true
+	}
+	return &AlertIngester{
+		store:             store,
+		mappings:          mappings,
+		window:            envDuration("ALERT_DEDUPE_WINDOW", time.Hour),
+		correlationWindow: envDuration("ALERT_CORRELATION_WINDOW", 30*time.Minute),
+		correlateOn:       correlateOn,
+		groups:            make(map[string]alertGroup),
+		correlations:      make(map[string]alertGroup),
+	}
+}
+
+type AlertResult struct {
+	IncidentID   string   `json:"incidentId"`
+	AlertID      string   `json:"alertId"`
+	Deduplicated bool     `json:"deduplicated"`
+	Correlated   bool     `json:"correlated"`
+	CorrelatedOn []string `json:"correlatedOn,omitempty"`
+	AlertCount   int      `json:"alertCount"`
+}
+
+func (a *AlertIngester) ingest(ctx context.Context, mapping AlertMapping, alert map[string]any) (AlertResult, bool, error) {
+	input := mapping.incidentInput(alert)
+	key := mapping.dedupeKey(alert, input)
+	now := time.Now().UTC()
+	record := mapping.incidentAlert(alert, input, key, now)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tenant := tenantFrom(ctx)
+	keys := a.correlationKeys(record)
+	if group, ok := a.groups[tenantScoped(tenant, key)]; ok && a.window > 0 && now.Sub(group.lastSeen) <= a.window {
+		incident, stored, err := a.store.recordAlert(group.incidentID, record)
+		if err == nil {
+			a.remember(tenant, incident.ID, key, keys, now)
+			return AlertResult{IncidentID: incident.ID, AlertID: stored.ID, Deduplicated: true, AlertCount: incident.AlertCount}, false, nil
+		}
+		if !errors.Is(err, errAlertIncidentClosed) && !errors.Is(err, errIncidentNotFound) {
+			return AlertResult{}, false, err
+		}
+	}
+
+	a.counter++
+	record.ID = "ALERT-" + padInt(a.counter)
+	var incident Incident
+	var stored IncidentAlert
+	err := errIncidentNotFound
+	incidentID, on := a.correlate(tenant, keys, now)
+	if incidentID != "" {
+		correlated := record
+		correlated.CorrelatedOn = on
+		incident, stored, err = a.store.recordAlert(incidentID, correlated)
+	}
+	created := errors.Is(err, errAlertIncidentClosed) || errors.Is(err, errIncidentNotFound)
+	if created {
+		input.Actor, input.ActorID = actor(ctx)
+		input.Trace = traceFrom(ctx)
+		input.Tenant = tenant
+		incident, stored, err = a.store.recordAlert(a.store.create(input).ID, record)
+	}
+	if err != nil {
+		return AlertResult{}, false, err
+	}
+
+	evidence, _ := json.MarshalIndent(alert, "", "  ")
+	if len(evidence) > 4000 {
+		evidence = append(evidence[:4000], []byte("\n...")...)
+	}
+	body := "Alert " + stored.ID + " received from " + mapping.Source + ":\n" + string(evidence)
+	if !created {
+		body = "Alert " + stored.ID + " from " + mapping.Source + " correlated on " + strings.Join(on, ", ") + ":\n" + string(evidence)
+	}
+	note := NoteInput{
+		Body:       body,
+		Author:     "Alert ingestion",
+		AuthorType: authorTypeAutomation,
+	}
+	attributeNote(ctx, &note)
+	if _, err := a.store.addNote(incident.ID, note); err != nil {
+		return AlertResult{}, false, err
+	}
+	a.remember(tenant, incident.ID, key, keys, now)
+	a.prune(now)
+
+	return AlertResult{IncidentID: incident.ID, AlertID: stored.ID, Correlated: !created, CorrelatedOn: stored.CorrelatedOn, AlertCount: incident.AlertCount}, created, nil
+}
+
+// prune drops groups whose window has passed. Callers must hold a.mu.
+func (a *AlertIngester) prune(now time.Time) {
+	for key, group := range a.groups {
+		if now.Sub(group.lastSeen) > a.window {
+			delete(a.groups, key)
+		}
+	}
+	for key, group := range a.correlations {
+		if now.Sub(group.lastSeen) > a.correlationWindow {
+			delete(a.correlations, key)
+		}
+	}
+}
+
+var errAlertIncidentClosed = errors.New("incident is closed")
+
+// recordAlert adds an alert to an open incident: repeats of an alert it
+// already holds bump that entry's count, new alerts are appended. IOCs the
+// incident doesn't have yet are added, and a more severe alert raises the
+// incident's severity.
+func (s *IncidentStore) recordAlert(id string, alert IncidentAlert) (Incident, IncidentAlert, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return Incident{}, IncidentAlert{}, errIncidentNotFound
+	}
+	// Alerts grouped onto a merged incident go to the one it was merged into.
+	for incident.MergedInto != "" && s.incidents[incident.MergedInto] != nil {
+		incident = s.incidents[incident.MergedInto]
+		id = incident.ID
+	}
+	if isClosedStatus(incident.Status) {
+		return Incident{}, IncidentAlert{}, errAlertIncidentClosed
+	}
+	previous := *incident
+	at := alert.LastSeen
+
+	merged := dedupeStrings(append(append([]string{}, incident.IOCs...), alert.IOCs...))
+	if len(merged) != len(incident.IOCs) {
+		incident.IOCs = merged
+		s.indexIOCs(id, merged)
+	}
+
+	alerts := append([]IncidentAlert{}, incident.Alerts...)
+	index := -1
+	for i := range alerts {
+		if alerts[i].key == alert.key {
+			index = i
+			break
+		}
+	}
+	if index >= 0 {
+		alerts[index].Count++
+		alerts[index].LastSeen = at
+	} else {
+		alerts = append(alerts, alert)
+		index = len(alerts) - 1
+	}
+	incident.Alerts = alerts
+
+	if severityRank(alert.Severity) > severityRank(incident.Severity) {
+		incident.Severity = normalizeSeverity(alert.Severity)
+		recordChanges(incident, &previous, at, "", "")
+	}
+	incident.AlertCount++
+	incident.LastAlertAt = &at
+	incident.UpdatedAt = at
+	s.runAnnotators(incident)
+	s.emit(eventIncidentUpdated, *incident, &previous)
+
+	return *incident, alerts[index], nil
+}
+
+func alertsHandler(ingester *AlertIngester, mappings *AlertMappingStore, enrichment *EnrichmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		source := fallback(strings.TrimSpace(r.URL.Query().Get("source")), strings.TrimSpace(r.Header.Get("X-Alert-Source")))
+
+		// CEF and LEEF arrive as text, one record per line.
+		trimmed := bytes.TrimSpace(body)
+		if len(trimmed) > 0 && trimmed[0] != '{' && trimmed[0] != '[' {
+			var alerts []map[string]any
+			for _, line := range strings.Split(string(trimmed), "\n") {
+				if strings.TrimSpace(line) == "" {
+					continue
+				}
+				alert, format, err := parseEventLine(line)
+				if err != nil {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+					return
+				}
+				source = fallback(source, format)
+				alerts = append(alerts, alert)
+			}
+			mapping, ok := mappings.get(source)
+			if !ok {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no alert mapping for source " + source})
+				return
+			}
+			ingestAlerts(w, r, ingester, enrichment, mapping, alerts, len(alerts) == 1)
+			return
+		}
+
+		source = fallback(source, defaultAlertSource)
+		mapping, ok := mappings.get(source)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no alert mapping for source " + source})
+			return
+		}
+		var payload any
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid payload"})
+			return
+		}
+		var alerts []map[string]any
+		switch payload := payload.(type) {
+		case map[string]any:
+			alerts = []map[string]any{payload}
+		case []any:
+			for _, item := range payload {
+				alert, ok := item.(map[string]any)
+				if !ok {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": "alerts must be JSON objects"})
+					return
+				}
+				alerts = append(alerts, alert)
+			}
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "alerts must be JSON objects"})
+			return
+		}
+
+		_, single := payload.(map[string]any)
+		ingestAlerts(w, r, ingester, enrichment, mapping, alerts, single)
+	}
+}
+
+// ingestAlerts runs alerts through the ingester and writes the results, as a
+// single object when the request carried one alert.
+func ingestAlerts(w http.ResponseWriter, r *http.Request, ingester *AlertIngester, enrichment *EnrichmentService, mapping AlertMapping, alerts []map[string]any, single bool) {
+	results := make([]AlertResult, 0, len(alerts))
+	created := false
+	for _, alert := range alerts {
+		result, isNew, err := ingester.ingest(r.Context(), mapping, alert)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if isNew {
+			created = true
+			enrichment.enqueue(result.IncidentID)
+		}
+		results = append(results, result)
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	if single && len(results) == 1 {
+		writeJSON(w, status, results[0])
+		return
+	}
+	writeJSON(w, status, map[string]any{"items": results})
+}
+
+func alertMappingsHandler(mappings *AlertMappingStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": mappings.list()})
+	}
+}
+
+func alertMappingHandler(mappings *AlertMappingStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		source := strings.TrimPrefix(r.URL.Path, "/api/alerts/mappings/")
+		if source == "" || strings.Contains(source, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !isReadRequest(r) && (!requireRole(w, r, roleAdmin) || !requireSharedConfig(w, r)) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			mapping, ok := mappings.get(source)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, mapping)
+		case http.MethodPut:
+			var mapping AlertMapping
+			if err := readJSON(r, &mapping); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			mapping.Source = source
+			writeJSON(w, http.StatusOK, mappings.put(mapping))
+		case http.MethodDelete:
+			if err := mappings.delete(source); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Patterns for entities embedded in free text. Emails and URLs go first so
+// their hosts aren't replaced on their own.
+var (
+	textEmailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	textURLPattern    = regexp.MustCompile(`[A-Za-z][A-Za-z0-9+.-]*://[^\s"'<>]+`)
+	textIPv4Pattern   = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`)
+	textDomainPattern = regexp.MustCompile(`\b([A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?\.)+[A-Za-z]{2,}\b`)
+	textHashPattern   = regexp.MustCompile(`\b[0-9a-fA-F]{32,128}\b`)
+)
+
+// entityTagPrefixes mark tags whose value names a host or a user.
+var entityTagPrefixes = map[string]string{"host:": "host", "user:": "user"}
+
+// anonymizer pseudonymizes the identifying parts of incidents for datasets
+// shared outside the SOC. Mappings are consistent within one anonymizer, so
+// the same IP or user gets the same stand-in everywhere in an export, but
+// a fresh key per export means stand-ins can't be linked across exports or
+// reversed.
+type anonymizer struct {
+	key  []byte
+	seen map[string]map[string]string
+	// patterns match mapped names as whole words in free text.
+	patterns map[string]*regexp.Regexp
+}
+
+func newAnonymizer() *anonymizer {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &anonymizer{key: key, seen: map[string]map[string]string{}, patterns: map[string]*regexp.Regexp{}}
+}
+
+// pseudonym returns value's stand-in of the given kind, numbering new
+// values in the order they are first seen.
+func (a *anonymizer) pseudonym(kind, value string, render func(n int) string) string {
+	seen := a.seen[kind]
+	if seen == nil {
+		seen = map[string]string{}
+		a.seen[kind] = seen
+	}
+	key := strings.ToLower(value)
+	if stand, ok := seen[key]; ok {
+		return stand
+	}
+	stand := render(len(seen) + 1)
+	seen[key] = stand
+	return stand
+}
+
+func (a *anonymizer) user(name string) string {
+	if name == "" || strings.EqualFold(name, "Unassigned") {
+		return name
+	}
+	return a.pseudonym("user", name, func(n int) string { return fmt.Sprintf("user-%04d", n) })
+}
+
+func (a *anonymizer) host(name string) string {
+	return a.pseudonym("host", name, func(n int) string { return fmt.Sprintf("host-%04d", n) })
+}
+
+func (a *anonymizer) domain(name string) string {
+	return a.pseudonym("domain", name, func(n int) string { return fmt.Sprintf("domain-%04d.example", n) })
+}
+
+// ip maps IPv4 addresses into 10.0.0.0/8 and IPv6 into 2001:db8::/32,
+// keeping any prefix length.
+func (a *anonymizer) ip(value string) string {
+	address, bits, hasBits := strings.Cut(value, "/")
+	parsed, err := netip.ParseAddr(address)
+	if err != nil {
+		return a.indicator(value)
+	}
+	stand := a.pseudonym("ip", parsed.String(), func(n int) string {
+		if parsed.Is4() {
+			return fmt.Sprintf("10.%d.%d.%d", (n>>16)&0xFF, (n>>8)&0xFF, n&0xFF)
+		}
+		return fmt.Sprintf("2001:db8::%x", n)
+	})
+	if hasBits {
+		stand += "/" + bits
+	}
+	return stand
+}
+
+// hash replaces a hash with a keyed one of the same length, so it still
+// looks like an MD5, SHA-1, or SHA-256.
+func (a *anonymizer) hash(value string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(strings.ToLower(value)))
+	sum := hex.EncodeToString(mac.Sum(nil))
+	for len(sum) < len(value) {
+		sum += sum
+	}
+	return sum[:len(value)]
+}
+
+func (a *anonymizer) email(value string) string {
+	local, domain, _ := strings.Cut(value, "@")
+	return a.user(local) + "@" + a.domain(domain)
+}
+
+// url keeps the scheme, swaps the host, and drops the path and query, which
+// often carry tokens or names.
+func (a *anonymizer) url(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Hostname() == "" {
+		return a.indicator(value)
+	}
+	host := parsed.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		host = a.ip(host)
+	} else {
+		host = a.domain(host)
+	}
+	return parsed.Scheme + "://" + host + "/"
+}
+
+func (a *anonymizer) indicator(value string) string {
+	return a.pseudonym("indicator", value, func(n int) string { return fmt.Sprintf("indicator-%04d", n) })
+}
+
+// ioc pseudonymizes an indicator by type. Free-form ones (usernames, file
+// paths) can't be told apart, so they are replaced outright.
+func (a *anonymizer) ioc(value string) string {
+	switch kind, _ := validateIOC(value); kind {
+	case iocIP:
+		return a.ip(value)
+	case iocDomain:
+		return a.domain(value)
+	case iocHash:
+		return a.hash(value)
+	case "url":
+		return a.url(value)
+	}
+	if strings.Contains(value, "@") && textEmailPattern.MatchString(value) {
+		return a.email(value)
+	}
+	return a.indicator(value)
+}
+
+func (a *anonymizer) tag(tag string) string {
+	for prefix, kind := range entityTagPrefixes {
+		if value, ok := strings.CutPrefix(tag, prefix); ok {
+			if kind == "host" {
+				return prefix + a.host(value)
+			}
+			return prefix + a.user(value)
+		}
+	}
+	return tag
+}
+
+// text scrubs free text: emails, URLs, IPs, hashes, and domains, then any
+// user, host, or indicator this anonymizer has already mapped.
+func (a *anonymizer) text(value string) string {
+	value = textEmailPattern.ReplaceAllStringFunc(value, a.email)
+	value = textURLPattern.ReplaceAllStringFunc(value, a.url)
+	value = textIPv4Pattern.ReplaceAllStringFunc(value, func(match string) string {
+		if _, err := netip.ParseAddr(match); err != nil {
+			return match
+		}
+		return a.ip(match)
+	})
+	value = textHashPattern.ReplaceAllStringFunc(value, a.hash)
+	value = textDomainPattern.ReplaceAllStringFunc(value, func(match string) string {
+		// Stand-ins from the passes above are left alone.
+		if strings.HasSuffix(match, ".example") {
+			return match
+		}
+		return a.domain(match)
+	})
+	for _, kind := range []string{"user", "host", "indicator"} {
+		for original, stand := range a.seen[kind] {
+			if len(original) < 3 {
+				continue
+			}
+			pattern, ok := a.patterns[original]
+			if !ok {
+				pattern = regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(original) + `\b`)
+				a.patterns[original] = pattern
+			}
+			value = pattern.ReplaceAllLiteralString(value, stand)
+		}
+	}
+	return value
+}
+
+// incident pseudonymizes everything that identifies people, hosts, or
+// infrastructure. Structured fields go first so names they introduce are
+// scrubbed from the free text too.
+func (a *anonymizer) incident(incident Incident) Incident {
+	incident.Owner = a.user(incident.Owner)
+	tags := make([]string, len(incident.Tags))
+	for i, tag := range incident.Tags {
+		tags[i] = a.tag(tag)
+	}
+	incident.Tags = tags
+	iocs := make([]string, len(incident.IOCs))
+	for i, ioc := range incident.IOCs {
+		iocs[i] = a.ioc(ioc)
+	}
+	incident.IOCs = iocs
+	incident.Title = a.text(incident.Title)
+	return incident
+}
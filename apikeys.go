@@ -0,0 +1,393 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiKeyPrefix = "sk_"
+
+// API key scopes. Resource scopes name the first path segment after /api/
+// ("incidents", "alerts", ...) or * for all of them: read allows GET and
+// HEAD, and write allows every method. admin also grants the admin role.
+const (
+	apiScopeRead  = "read"
+	apiScopeWrite = "write"
+	apiScopeAdmin = "admin"
+)
+
+var apiScopePattern = regexp.MustCompile(`^(\*|[a-z][a-z0-9-]*):(read|write)$`)
+
+// APIKey lets a script or integration call the API as a user. Its secret
+// is only returned once, at issuance; only its hash is kept.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	UserID     string     `json:"userId"`
+	Scopes     []string   `json:"scopes"`
+	Tenant     string     `json:"tenant,omitempty"`
+	KeyPrefix  string     `json:"keyPrefix"`
+	CreatedBy  string     `json:"createdBy,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	RevokedBy  string     `json:"revokedBy,omitempty"`
+	keyHash    string
+}
+
+type APIKeyInput struct {
+	Name string `json:"name"`
+	// UserID is who the key acts as; it defaults to the issuing admin.
+	UserID string   `json:"userId"`
+	Scopes []string `json:"scopes"`
+	// Tenant binds the key to one tenant, e.g. for a customer's own SIEM.
+	Tenant    string     `json:"tenant"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type APIKeyWithSecret struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+var errAPIKeyNotFound = errors.New("api key not found")
+
+type APIKeyStore struct {
+	mu      sync.Mutex
+	keys    map[string]*APIKey
+	byHash  map[string]string
+	order   []string
+	counter int
+}
+
+// apiKeyFileEntry is one line of API_KEYS_FILE: a key issued offline by
+// the create-apikey command, by hash, so the file holds no secrets.
+type apiKeyFileEntry struct {
+	Name      string     `json:"name"`
+	UserID    string     `json:"userId"`
+	Scopes    []string   `json:"scopes"`
+	Tenant    string     `json:"tenant,omitempty"`
+	KeyPrefix string     `json:"keyPrefix"`
+	KeyHash   string     `json:"keyHash"`
+	CreatedBy string     `json:"createdBy,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// newAPIKeyStore starts with the keys in API_KEYS_FILE, if it is set, and
+// exits naming the line when one can't be used.
+func newAPIKeyStore() *APIKeyStore {
+	store := &APIKeyStore{keys: make(map[string]*APIKey), byHash: make(map[string]string), order: []string{}}
+	path := envString("API_KEYS_FILE", "")
+	if path == "" {
+		return store
+	}
+	source, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store
+	}
+	if err != nil {
+		log.Fatalf("apikeys: %v", err)
+	}
+	for i, line := range strings.Split(string(source), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var entry apiKeyFileEntry
+		err := json.Unmarshal([]byte(line), &entry)
+		if err == nil {
+			entry.Scopes, err = normalizeScopes(entry.Scopes)
+		}
+		if err == nil && (entry.Name == "" || entry.UserID == "" || len(entry.KeyHash) != sha256.Size*2) {
+			err = errors.New("name, userId, and keyHash are required")
+		}
+		if err != nil {
+			log.Fatalf("apikeys: %s line %d: %v", path, i+1, err)
+		}
+		store.add(&APIKey{
+			Name:      entry.Name,
+			UserID:    entry.UserID,
+			Scopes:    entry.Scopes,
+			Tenant:    entry.Tenant,
+			KeyPrefix: entry.KeyPrefix,
+			CreatedBy: entry.CreatedBy,
+			CreatedAt: entry.CreatedAt,
+			ExpiresAt: entry.ExpiresAt,
+			keyHash:   entry.KeyHash,
+		})
+	}
+	return store
+}
+
+func (k *APIKey) active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// allows reports whether the key's scopes cover a request.
+func (k *APIKey) allows(method, path string) bool {
+	if slices.Contains(k.Scopes, apiScopeAdmin) {
+		return true
+	}
+	resource, _, _ := strings.Cut(strings.TrimPrefix(path, "/api/"), "/")
+	if path == graphQLPath || strings.HasPrefix(path, graphQLPath+"/") {
+		// GraphQL only reads incidents, so it takes their read scope.
+		resource, method = "incidents", http.MethodGet
+	}
+	for _, scope := range k.Scopes {
+		target, access, _ := strings.Cut(scope, ":")
+		if target != "*" && target != resource {
+			continue
+		}
+		if access == apiScopeWrite || method == http.MethodGet || method == http.MethodHead {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	cleaned := dedupeStrings(sanitizeSlice(scopes))
+	if len(cleaned) == 0 {
+		return nil, errors.New("scopes must name at least one scope")
+	}
+	for i, scope := range cleaned {
+		scope = strings.ToLower(scope)
+		if scope != apiScopeAdmin && !apiScopePattern.MatchString(scope) {
+			return nil, errors.New("scope " + scope + " must be admin or <resource>:read|write, e.g. incidents:read or *:write")
+		}
+		cleaned[i] = scope
+	}
+	return cleaned, nil
+}
+
+// empty reports whether no key has been issued, revoked ones included.
+func (s *APIKeyStore) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.keys) == 0
+}
+
+func (s *APIKeyStore) list() []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]APIKey, 0, len(s.order))
+	for _, id := range s.order {
+		items = append(items, *s.keys[id])
+	}
+	return items
+}
+
+func (s *APIKeyStore) get(id string) (APIKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, false
+	}
+	return *key, true
+}
+
+// newAPIKey validates input and generates the key's secret, which is
+// returned alongside the key since only its hash is kept.
+func newAPIKey(input APIKeyInput, by string, now time.Time) (*APIKey, string, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, "", errors.New("name is required")
+	}
+	scopes, err := normalizeScopes(input.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(now) {
+		return nil, "", errors.New("expiresAt must be in the future")
+	}
+	tenant := strings.ToLower(strings.TrimSpace(input.Tenant))
+	if tenant != "" && !tenantPattern.MatchString(tenant) {
+		return nil, "", errors.New("tenant must be lowercase letters, digits, or dashes")
+	}
+	secret, err := generateServiceKey()
+	if err != nil {
+		return nil, "", err
+	}
+	secret = apiKeyPrefix + strings.TrimPrefix(secret, serviceKeyPrefix)
+	return &APIKey{
+		Name:      name,
+		UserID:    fallback(strings.TrimSpace(input.UserID), by),
+		Scopes:    scopes,
+		Tenant:    tenant,
+		KeyPrefix: secret[:len(apiKeyPrefix)+6],
+		CreatedBy: by,
+		CreatedAt: now,
+		ExpiresAt: input.ExpiresAt,
+		keyHash:   hashKey(secret),
+	}, secret, nil
+}
+
+func (s *APIKeyStore) issue(input APIKeyInput, by string, now time.Time) (APIKeyWithSecret, error) {
+	key, secret, err := newAPIKey(input, by, now)
+	if err != nil {
+		return APIKeyWithSecret{}, err
+	}
+	s.add(key)
+	return APIKeyWithSecret{APIKey: *key, Key: secret}, nil
+}
+
+// add numbers a key and starts accepting it.
+func (s *APIKeyStore) add(key *APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counter++
+	key.ID = "KEY-" + padInt(s.counter)
+	s.keys[key.ID] = key
+	s.byHash[key.keyHash] = key.ID
+	s.order = append(s.order, key.ID)
+}
+
+// revoke stops a key working immediately. Revoked keys stay listed so
+// the audit trail can still name them.
+func (s *APIKeyStore) revoke(id, by string, now time.Time) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, errAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt, key.RevokedBy = &now, by
+		delete(s.byHash, key.keyHash)
+	}
+	return *key, nil
+}
+
+// authenticate returns the key a secret belongs to if it is still active.
+func (s *APIKeyStore) authenticate(secret string, now time.Time) (APIKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.byHash[hashKey(secret)]
+	if !ok {
+		return APIKey{}, false
+	}
+	key := s.keys[id]
+	if !key.active(now) {
+		return APIKey{}, false
+	}
+	key.LastUsedAt = &now
+	return *key, true
+}
+
+// principal is who a key's requests run as. The key's scopes, not the
+// user's, decide what it may do.
+func (k APIKey) principal(users *UserStore) Principal {
+	principal := Principal{ID: k.UserID, Name: k.UserID, Kind: principalUser, KeyID: k.ID, Tenant: k.Tenant}
+	if user, ok := users.get(k.UserID); ok {
+		principal.Name = user.Name
+	}
+	if slices.Contains(k.Scopes, apiScopeAdmin) {
+		principal.Roles = []string{roleAdmin}
+	}
+	return principal
+}
+
+// apiKeysHandler serves GET and POST /api/admin/apikeys, admin only. Keys
+// are listed and issued in the caller's tenant only, so a tenant's admin
+// can't mint a key for another tenant or an unbound one.
+func apiKeysHandler(keys *APIKeyStore, users *UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			items := []APIKey{}
+			for _, key := range keys.list() {
+				if inTenant(r, key.Tenant) {
+					items = append(items, key)
+				}
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+		case http.MethodPost:
+			var input APIKeyInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			tenant := tenantFrom(r.Context())
+			if requested := strings.ToLower(strings.TrimSpace(input.Tenant)); requested != "" && requested != tenant {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "keys can only be issued in the tenant the request acts for"})
+				return
+			}
+			input.Tenant = tenant
+			_, by := actor(r.Context())
+			if caller, _ := principalFrom(r.Context()); input.UserID != "" && input.UserID != by && !caller.hasRole(roleImpersonate) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "issuing a key for another user requires the " + roleImpersonate + " role"})
+				return
+			}
+			if input.UserID != "" {
+				if user, ok := users.get(input.UserID); !ok || !user.Active {
+					writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": input.UserID + ": " + errUserNotFound.Error()})
+					return
+				}
+			}
+			issued, err := keys.issue(input, by, time.Now().UTC())
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, issued)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// apiKeyHandler serves GET and DELETE (revoke) /api/admin/apikeys/{id},
+// admin only.
+func apiKeyHandler(keys *APIKeyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/admin/apikeys/")
+		if id == "" || strings.Contains(id, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			key, ok := keys.get(id)
+			if !ok || !inTenant(r, key.Tenant) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, key)
+		case http.MethodDelete:
+			if key, ok := keys.get(id); !ok || !inTenant(r, key.Tenant) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, by := actor(r.Context())
+			key, err := keys.revoke(id, by, time.Now().UTC())
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, key)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errAttachmentTooLarge = errors.New("attachment is too large")
+
+// Attachment is a file uploaded to an incident, optionally tied to one of
+// its notes. ContentType is detected from the content, not taken from the
+// client.
+type Attachment struct {
+	ID           string    `json:"id"`
+	IncidentID   string    `json:"incidentId"`
+	NoteID       string    `json:"noteId,omitempty"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"contentType"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	UploadedBy   string    `json:"uploadedBy"`
+	UploadedByID string    `json:"uploadedById,omitempty"`
+	UploadedAt   time.Time `json:"uploadedAt"`
+	// Scan is the malware scan verdict, when a scanner is configured.
+	// Infected files are quarantined: kept apart in storage and only
+	// downloadable by admins who ask for them explicitly.
+	Scan        *AttachmentScan `json:"scan,omitempty"`
+	Quarantined bool            `json:"quarantined"`
+
+	key string
+}
+
+// AttachmentStorage holds attachment contents, keyed by
+// "<incident>/<attachment>".
+type AttachmentStorage interface {
+	name() string
+	put(ctx context.Context, key string, body io.Reader, size int64, contentType, sha256Hex string) error
+	get(ctx context.Context, key string) (io.ReadCloser, error)
+	delete(ctx context.Context, key string) error
+}
+
+// localAttachmentStorage keeps attachments as files under dir.
+type localAttachmentStorage struct {
+	dir string
+}
+
+func (l *localAttachmentStorage) name() string { return "local" }
+
+func (l *localAttachmentStorage) path(key string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(key))
+}
+
+// put writes to a temporary file and renames it into place, so a failed
+// upload never leaves a partial file behind.
+func (l *localAttachmentStorage) put(_ context.Context, key string, body io.Reader, _ int64, _, _ string) error {
+	path := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (l *localAttachmentStorage) get(_ context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(l.path(key))
+}
+
+func (l *localAttachmentStorage) delete(_ context.Context, key string) error {
+	err := os.Remove(l.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *s3Client) name() string { return "s3" }
+
+// newAttachmentStorage picks the backend from ATTACHMENT_STORAGE: "local"
+// (the default) or "s3".
+func newAttachmentStorage() AttachmentStorage {
+	s3 := strings.EqualFold(envString("ATTACHMENT_STORAGE", "local"), "s3")
+	if s3 && envString("ATTACHMENT_S3_BUCKET", "") == "" {
+		log.Printf("attachments: ATTACHMENT_STORAGE=s3 needs ATTACHMENT_S3_BUCKET, storing locally")
+		s3 = false
+	}
+	if s3 {
+		region := envString("ATTACHMENT_S3_REGION", envString("AWS_REGION", "us-east-1"))
+		return &s3Client{
+			client:       &http.Client{Timeout: envDuration("ATTACHMENT_S3_TIMEOUT", 5*time.Minute), Transport: tracingTransport{base: http.DefaultTransport}},
+			endpoint:     envString("ATTACHMENT_S3_ENDPOINT", "https://s3."+region+".amazonaws.com"),
+			bucket:       envString("ATTACHMENT_S3_BUCKET", ""),
+			region:       region,
+			accessKey:    envString("ATTACHMENT_S3_ACCESS_KEY_ID", envString("AWS_ACCESS_KEY_ID", "")),
+			secretKey:    envString("ATTACHMENT_S3_SECRET_ACCESS_KEY", envString("AWS_SECRET_ACCESS_KEY", "")),
+			sessionToken: envString("AWS_SESSION_TOKEN", ""),
+		}
+	}
+	return &localAttachmentStorage{dir: envString("ATTACHMENT_DIR", "attachments")}
+}
+
+// AttachmentStore keeps attachment metadata; contents live in storage.
+type AttachmentStore struct {
+	mu          sync.RWMutex
+	attachments map[string]*Attachment
+	byIncident  map[string][]string
+	counter     int
+	storage     AttachmentStorage
+	scanner     *clamdScanner
+	maxBytes    int64
+}
+
+func newAttachmentStore() *AttachmentStore {
+	return &AttachmentStore{
+		attachments: make(map[string]*Attachment),
+		byIncident:  make(map[string][]string),
+		storage:     newAttachmentStorage(),
+		scanner:     newClamdScanner(),
+		maxBytes:    int64(envInt("ATTACHMENT_MAX_BYTES", 25<<20)),
+	}
+}
+
+func (s *AttachmentStore) size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.attachments)
+}
+
+// uploadLimit is the largest upload body accepted: an attachment at
+// maxBytes, with room for the form's other fields and boundaries.
+func (a *AttachmentStore) uploadLimit() int64 {
+	return a.maxBytes + 1<<20
+}
+
+// watch deletes the attachments of purged incidents.
+func (a *AttachmentStore) watch(store *IncidentStore) {
+	store.subscribe(func(event IncidentEvent) {
+		if event.Type != eventIncidentPurged {
+			return
+		}
+		go a.forget(event.Incident.ID)
+	})
+}
+
+func (a *AttachmentStore) forget(incidentID string) {
+	a.mu.Lock()
+	ids := a.byIncident[incidentID]
+	delete(a.byIncident, incidentID)
+	removed := make([]*Attachment, 0, len(ids))
+	for _, id := range ids {
+		removed = append(removed, a.attachments[id])
+		delete(a.attachments, id)
+	}
+	a.mu.Unlock()
+
+	for _, attachment := range removed {
+		if err := a.storage.delete(context.Background(), attachment.key); err != nil {
+			log.Printf("attachments: deleting %s of purged %s: %v", attachment.ID, incidentID, err)
+		}
+	}
+}
+
+// list returns an incident's attachments, only those of noteID when set.
+func (a *AttachmentStore) list(incidentID, noteID string) []Attachment {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	items := []Attachment{}
+	for _, id := range a.byIncident[incidentID] {
+		attachment := a.attachments[id]
+		if noteID == "" || attachment.NoteID == noteID {
+			items = append(items, *attachment)
+		}
+	}
+	return items
+}
+
+func (a *AttachmentStore) get(incidentID, id string) (Attachment, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	attachment, ok := a.attachments[id]
+	if !ok || attachment.IncidentID != incidentID {
+		return Attachment{}, false
+	}
+	return *attachment, true
+}
+
+// spool copies an upload to a temporary file, hashing it on the way and
+// refusing anything over the size limit. The caller removes the file.
+func (a *AttachmentStore) spool(body io.Reader) (*os.File, int64, string, error) {
+	file, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		return nil, 0, "", err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(body, a.maxBytes+1))
+	if err == nil && size > a.maxBytes {
+		err = errAttachmentTooLarge
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, 0, "", err
+	}
+	return file, size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// detectContentType sniffs the first bytes, falling back to the file
+// extension only when sniffing finds nothing more specific than binary.
+func detectContentType(file *os.File, filename string) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	detected := http.DetectContentType(head[:n])
+	if detected == "application/octet-stream" {
+		if byExtension := mime.TypeByExtension(filepath.Ext(filename)); byExtension != "" {
+			return byExtension, nil
+		}
+	}
+	return detected, nil
+}
+
+func (a *AttachmentStore) add(ctx context.Context, attachment Attachment, file *os.File) (Attachment, error) {
+	a.mu.Lock()
+	a.counter++
+	attachment.ID = "ATT-" + padInt(a.counter)
+	a.mu.Unlock()
+
+	attachment.key = attachment.IncidentID + "/" + attachment.ID
+	if attachment.Quarantined {
+		attachment.key = "quarantine/" + attachment.key
+	}
+	if err := a.storage.put(ctx, attachment.key, file, attachment.Size, attachment.ContentType, attachment.SHA256); err != nil {
+		return Attachment{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.attachments[attachment.ID] = &attachment
+	a.byIncident[attachment.IncidentID] = append(a.byIncident[attachment.IncidentID], attachment.ID)
+	return attachment, nil
+}
+
+func (a *AttachmentStore) remove(ctx context.Context, incidentID, id string) error {
+	a.mu.Lock()
+	attachment, ok := a.attachments[id]
+	if !ok || attachment.IncidentID != incidentID {
+		a.mu.Unlock()
+		return errors.New("attachment not found")
+	}
+	delete(a.attachments, id)
+	ids := a.byIncident[incidentID]
+	for i, existing := range ids {
+		if existing == id {
+			a.byIncident[incidentID] = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	a.mu.Unlock()
+	return a.storage.delete(ctx, attachment.key)
+}
+
+// handleIncidentAttachments serves /api/incidents/{id}/attachments and
+// /api/incidents/{id}/attachments/{attachmentId}.
+func handleIncidentAttachments(w http.ResponseWriter, r *http.Request, id string, parts []string, store *IncidentStore, attachments *AttachmentStore, access *AccessLog) {
+	incident, ok := store.get(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if len(parts) == 3 {
+		switch r.Method {
+		case http.MethodGet:
+			downloadAttachment(w, r, id, parts[2], attachments, access)
+		case http.MethodDelete:
+			if err := attachments.remove(r.Context(), id, parts[2]); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]any{"items": attachments.list(id, r.URL.Query().Get("noteId"))})
+	case http.MethodPost:
+		uploadAttachment(w, r, *incident, attachments)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// uploadAttachment reads a multipart form with the file in "file" and an
+// optional "noteId".
+func uploadAttachment(w http.ResponseWriter, r *http.Request, incident Incident, attachments *AttachmentStore) {
+	r.Body = http.MaxBytesReader(w, r.Body, attachments.uploadLimit())
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected a multipart/form-data upload"})
+		return
+	}
+
+	var file *os.File
+	var size int64
+	var hash, filename, noteID string
+	defer func() {
+		if file != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid multipart body"})
+			return
+		}
+		switch part.FormName() {
+		case "file":
+			if file != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "upload one file at a time"})
+				return
+			}
+			filename = strings.TrimSpace(filepath.Base(strings.ReplaceAll(part.FileName(), "\\", "/")))
+			file, size, hash, err = attachments.spool(part)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.Is(err, errAttachmentTooLarge) || errors.As(err, &maxBytesErr) {
+					writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "attachments are limited to " + strconv.FormatInt(attachments.maxBytes, 10) + " bytes"})
+					return
+				}
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "reading upload: " + err.Error()})
+				return
+			}
+		case "noteId":
+			value, _ := io.ReadAll(io.LimitReader(part, 256))
+			noteID = strings.TrimSpace(string(value))
+		}
+		part.Close()
+	}
+	if file == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file is required"})
+		return
+	}
+	if filename == "" || filename == "." || filename == "/" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file needs a filename"})
+		return
+	}
+	if noteID != "" && !hasNote(incident, noteID) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "note " + noteID + " not found on " + incident.ID})
+		return
+	}
+	contentType, err := detectContentType(file, filename)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "reading upload: " + err.Error()})
+		return
+	}
+	scan, ok := attachments.scanUpload(w, r, incident.ID, filename, file)
+	if !ok {
+		return
+	}
+
+	name, actorID := actor(r.Context())
+	attachment, err := attachments.add(r.Context(), Attachment{
+		IncidentID:   incident.ID,
+		NoteID:       noteID,
+		Filename:     filename,
+		ContentType:  contentType,
+		Size:         size,
+		SHA256:       hash,
+		UploadedBy:   fallback(name, "anonymous"),
+		UploadedByID: actorID,
+		UploadedAt:   time.Now().UTC(),
+		Scan:         scan,
+		Quarantined:  scan != nil && scan.Status == scanInfected,
+	}, file)
+	if err != nil {
+		log.Printf("attachments: storing upload for %s in %s: %v", incident.ID, attachments.storage.name(), err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "storing attachment failed"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, attachment)
+}
+
+// scanUpload runs the configured scanner over an upload and rewinds it.
+// When the scanner fails the upload is refused unless CLAMD_FAIL_OPEN is
+// set; ok is false when the response has been written.
+func (a *AttachmentStore) scanUpload(w http.ResponseWriter, r *http.Request, incidentID, filename string, file *os.File) (*AttachmentScan, bool) {
+	if a.scanner == nil {
+		return nil, true
+	}
+	scan, err := a.scanner.scan(r.Context(), file)
+	if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "reading upload: " + seekErr.Error()})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("attachments: scanning %s for %s: %v", filename, incidentID, err)
+		if !a.scanner.failOpen {
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": "malware scan failed; upload refused"})
+			return nil, false
+		}
+		scan = AttachmentScan{Status: scanFailed, Error: err.Error(), Scanner: "clamav", ScannedAt: time.Now().UTC()}
+	}
+	if scan.Status == scanInfected {
+		log.Printf("attachments: %s for %s is infected (%s), quarantining", filename, incidentID, scan.Signature)
+	}
+	return &scan, true
+}
+
+func hasNote(incident Incident, noteID string) bool {
+	for _, note := range incident.Notes {
+		if note.ID == noteID {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadAttachment always serves the file as a download, never inline,
+// so an uploaded HTML or SVG file can't run in the app's origin.
+// Quarantined files need an admin and ?quarantined=true.
+func downloadAttachment(w http.ResponseWriter, r *http.Request, id, attachmentID string, attachments *AttachmentStore, access *AccessLog) {
+	attachment, ok := attachments.get(id, attachmentID)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if attachment.Quarantined {
+		if r.URL.Query().Get("quarantined") != "true" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "attachment is quarantined as " + attachment.Scan.Signature + "; admins can download it with ?quarantined=true"})
+			return
+		}
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		// Never let a browser guess at a malware sample's type.
+		attachment.ContentType = "application/octet-stream"
+	}
+	body, err := attachments.storage.get(r.Context(), attachment.key)
+	if err != nil {
+		log.Printf("attachments: reading %s from %s: %v", attachment.ID, attachments.storage.name(), err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "reading attachment failed"})
+		return
+	}
+	defer body.Close()
+
+	access.record(r, id, accessDownload)
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+attachment.SHA256+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, body)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditOutcomeSuccess = "success"
+	auditOutcomeFailure = "failure"
+)
+
+// AuditEvent is one entry in the application's audit trail: who did what to
+// which resource. Detail never carries restricted case content.
+type AuditEvent struct {
+	At        time.Time `json:"at"`
+	Actor     string    `json:"actor"`
+	ActorType string    `json:"actorType,omitempty"`
+	Action    string    `json:"action"`
+	// Tenant is the tenant the event happened in, or "" for server-wide
+	// ones such as logins.
+	Tenant     string `json:"tenant,omitempty"`
+	IncidentID string `json:"incidentId,omitempty"`
+	Resource   string `json:"resource,omitempty"`
+	Outcome    string `json:"outcome"`
+	Detail     string `json:"detail,omitempty"`
+	// Changes are the before and after values of an incident change.
+	Changes    []AuditChange `json:"changes,omitempty"`
+	RemoteAddr string        `json:"remoteAddr,omitempty"`
+	UserAgent  string        `json:"userAgent,omitempty"`
+}
+
+// AuditLog fans audit events out to sinks such as the syslog forwarder and
+// the audit store. Its sources are the access log (views and exports),
+// store changes, and mutating API calls.
+type AuditLog struct {
+	mu    sync.RWMutex
+	sinks []func(AuditEvent)
+}
+
+func newAuditLog() *AuditLog {
+	return &AuditLog{}
+}
+
+func (a *AuditLog) addSink(fn func(AuditEvent)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sinks = append(a.sinks, fn)
+}
+
+// record delivers an event to every sink. Sinks run synchronously and must
+// hand slow work off.
+func (a *AuditLog) record(event AuditEvent) {
+	if a == nil {
+		return
+	}
+	if event.At.IsZero() {
+		event.At = time.Now().UTC()
+	}
+	event.Actor = fallback(event.Actor, "system")
+	event.Outcome = fallback(event.Outcome, auditOutcomeSuccess)
+
+	a.mu.RLock()
+	sinks := a.sinks
+	a.mu.RUnlock()
+	for _, fn := range sinks {
+		fn(event)
+	}
+}
+
+// watch records store changes. Updates that only re-derive annotations
+// (feed hits, scores, SLA state) aren't anyone's action and are skipped.
+func (a *AuditLog) watch(store *IncidentStore) {
+	store.subscribe(func(event IncidentEvent) {
+		// Purges are recorded by the handler, which knows both approvers.
+		if event.Type == eventIncidentPurged {
+			return
+		}
+		audit := incidentAuditEvent(event)
+		if event.Type == eventIncidentUpdated && len(audit.Changes) == 0 {
+			return
+		}
+		a.record(audit)
+	})
+}
+
+// incidentAuditEvent describes a store change. The actor is the author of
+// the note or of the field changes made with it; anything else, such as
+// annotations, is the server's own.
+func incidentAuditEvent(event IncidentEvent) AuditEvent {
+	incident := event.Incident
+	audit := AuditEvent{At: event.At, Action: event.Type, Tenant: incident.Tenant, IncidentID: incident.ID, Resource: "/api/incidents/" + incident.ID}
+
+	switch event.Type {
+	case eventNoteAdded:
+		if len(incident.Notes) > 0 {
+			note := incident.Notes[0]
+			audit.Actor, audit.ActorType = fallback(note.AuthorID, note.Author), note.AuthorType
+			audit.Detail = "note " + note.ID
+		}
+	default:
+		at := incident.UpdatedAt
+		if event.Type == eventIncidentCreated {
+			at = incident.CreatedAt
+		}
+		for i := len(incident.history) - 1; i >= 0; i-- {
+			if change := incident.history[i]; change.At.Equal(at) {
+				audit.Actor = fallback(change.ByID, change.By)
+				break
+			}
+		}
+		if event.Previous != nil {
+			audit.Detail = describeChanges(*event.Previous, incident)
+			audit.Changes = incidentChanges(*event.Previous, incident)
+		}
+	}
+	return audit
+}
+
+// describeChanges lists tracked field changes, e.g. "severity Medium -> High".
+func describeChanges(previous, current Incident) string {
+	changes := []string{}
+	for _, field := range trackedFields {
+		before, after := trackedValue(&previous, field), trackedValue(&current, field)
+		if before != after {
+			changes = append(changes, field+" "+fallback(before, "none")+" -> "+fallback(after, "none"))
+		}
+	}
+	if previous.Restricted != current.Restricted {
+		if current.Restricted {
+			changes = append(changes, "restricted")
+		} else {
+			changes = append(changes, "unrestricted")
+		}
+	}
+	return strings.Join(changes, ", ")
+}
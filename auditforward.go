@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	auditFormatCEF  = "cef"
+	auditFormatJSON = "json"
+
+	// syslogFacilityLogAudit is the RFC 5424 "log audit" facility.
+	syslogFacilityLogAudit = 13
+)
+
+// AuditForwarder sends audit events to a syslog collector as RFC 5424
+// messages carrying CEF (or JSON), so the SIEM sees this platform's
+// activity like any other security tool's. Delivery is best effort: events
+// are queued and dropped, with a log line, if the collector can't keep up.
+type AuditForwarder struct {
+	network  string
+	addr     string
+	format   string
+	hostname string
+	tls      *tls.Config
+	queue    chan AuditEvent
+	pending  pendingWork
+	conn     net.Conn
+}
+
+// newAuditForwarder returns nil unless AUDIT_SYSLOG_ADDR is set, as
+// udp://host:514, tcp://host:601, or tls://host:6514 (UDP when the scheme is
+// left out).
+func newAuditForwarder() *AuditForwarder {
+	target := envString("AUDIT_SYSLOG_ADDR", "")
+	if target == "" {
+		return nil
+	}
+	network, addr, ok := strings.Cut(target, "://")
+	if !ok {
+		network, addr = "udp", target
+	}
+	forwarder := &AuditForwarder{
+		network: strings.ToLower(network),
+		addr:    addr,
+		format:  strings.ToLower(envString("AUDIT_SYSLOG_FORMAT", auditFormatCEF)),
+		queue:   make(chan AuditEvent, envInt("AUDIT_SYSLOG_QUEUE_SIZE", 1024)),
+	}
+	switch forwarder.network {
+	case "udp", "tcp":
+	case "tls":
+		host, _, _ := net.SplitHostPort(addr)
+		forwarder.network = "tcp"
+		forwarder.tls = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	default:
+		log.Printf("audit forwarding disabled: unsupported scheme %q in AUDIT_SYSLOG_ADDR", network)
+		return nil
+	}
+	if forwarder.format != auditFormatCEF && forwarder.format != auditFormatJSON {
+		log.Printf("audit forwarding: unknown AUDIT_SYSLOG_FORMAT %q, using cef", forwarder.format)
+		forwarder.format = auditFormatCEF
+	}
+	forwarder.hostname, _ = os.Hostname()
+	forwarder.hostname = fallback(forwarder.hostname, "-")
+	return forwarder
+}
+
+func (f *AuditForwarder) start(audit *AuditLog) {
+	audit.addSink(f.enqueue)
+	go func() {
+		for event := range f.queue {
+			message := f.message(event)
+			if err := f.send(message); err != nil {
+				// One reconnect per event covers a collector restart without
+				// stalling the queue behind a dead destination.
+				f.reset()
+				if err := f.send(message); err != nil {
+					log.Printf("audit forward to %s: %v", f.addr, err)
+					f.reset()
+				}
+			}
+			f.pending.done()
+		}
+	}()
+}
+
+func (f *AuditForwarder) enqueue(event AuditEvent) {
+	f.pending.add()
+	select {
+	case f.queue <- event:
+	default:
+		f.pending.done()
+		log.Printf("audit forward queue full, dropping %s by %s", event.Action, event.Actor)
+	}
+}
+
+func (f *AuditForwarder) send(message string) error {
+	if f.conn == nil {
+		dialer := &net.Dialer{Timeout: 5 * time.Second}
+		var conn net.Conn
+		var err error
+		if f.tls != nil {
+			conn, err = tls.DialWithDialer(dialer, f.network, f.addr, f.tls)
+		} else {
+			conn, err = dialer.Dial(f.network, f.addr)
+		}
+		if err != nil {
+			return err
+		}
+		f.conn = conn
+	}
+	if f.network == "tcp" {
+		// Newline framing (RFC 6587 non-transparent framing).
+		message += "\n"
+	}
+	_ = f.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := f.conn.Write([]byte(message))
+	return err
+}
+
+func (f *AuditForwarder) reset() {
+	if f.conn != nil {
+		_ = f.conn.Close()
+		f.conn = nil
+	}
+}
+
+// message formats an RFC 5424 message with the event as CEF or JSON.
+func (f *AuditForwarder) message(event AuditEvent) string {
+	severity := 6 // informational
+	if event.Outcome == auditOutcomeFailure {
+		severity = 4 // warning
+	}
+	body := ""
+	if f.format == auditFormatJSON {
+		encoded, _ := json.Marshal(event)
+		body = string(encoded)
+	} else {
+		body = auditCEF(event)
+	}
+	return fmt.Sprintf("<%d>1 %s %s soc-backend %d %s - %s",
+		syslogFacilityLogAudit*8+severity, event.At.UTC().Format(time.RFC3339Nano), f.hostname, os.Getpid(), syslogMsgID(event.Action), body)
+}
+
+// syslogMsgID makes an action usable as an RFC 5424 MSGID (printable ASCII,
+// at most 32 characters).
+func syslogMsgID(action string) string {
+	id := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, action)
+	if len(id) > 32 {
+		id = id[:32]
+	}
+	return fallback(id, "-")
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// auditCEF renders an event as a CEF record, the inverse of parseCEF.
+func auditCEF(event AuditEvent) string {
+	severity := "3"
+	if event.Outcome == auditOutcomeFailure {
+		severity = "7"
+	}
+	header := []string{"CEF:0", "Sevdevs", "SOC Backend", version, event.Action, event.Action, severity}
+	for i := 1; i < len(header); i++ {
+		header[i] = cefHeaderEscaper.Replace(header[i])
+	}
+
+	extensions := []string{"rt=" + strconv.FormatInt(event.At.UnixMilli(), 10)}
+	add := func(key, value string) {
+		if value != "" {
+			extensions = append(extensions, key+"="+cefExtensionEscaper.Replace(value))
+		}
+	}
+	add("suser", event.Actor)
+	add("act", event.Action)
+	add("outcome", event.Outcome)
+	add("request", event.Resource)
+	add("requestClientApplication", event.UserAgent)
+	if host, _, err := net.SplitHostPort(event.RemoteAddr); err == nil {
+		add("src", host)
+	}
+	if event.IncidentID != "" {
+		add("cs1Label", "incidentId")
+		add("cs1", event.IncidentID)
+	}
+	if event.ActorType != "" {
+		add("cs2Label", "actorType")
+		add("cs2", event.ActorType)
+	}
+	add("msg", event.Detail)
+	return strings.Join(header, "|") + "|" + strings.Join(extensions, " ")
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditGenesisHash is the previous hash of the first record.
+var auditGenesisHash = strings.Repeat("0", 64)
+
+// AuditChange is one field's value before and after a change.
+type AuditChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// AuditRecord is an audit event as kept by the audit store. Hash covers the
+// sequence number, the event, and the previous record's hash, so editing,
+// dropping, or reordering any record breaks every hash after it.
+type AuditRecord struct {
+	Seq int64 `json:"seq"`
+	AuditEvent
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+// AuditStore is an append-only, hash-chained copy of the audit trail,
+// queryable through /api/audit. Records are never changed or removed.
+type AuditStore struct {
+	mu      sync.RWMutex
+	records []AuditRecord
+}
+
+func newAuditStore(audit *AuditLog) *AuditStore {
+	store := &AuditStore{}
+	audit.addSink(store.append)
+	return store
+}
+
+func (s *AuditStore) size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records)
+}
+
+func auditHash(seq int64, prevHash string, event AuditEvent) string {
+	body, _ := json.Marshal(event)
+	sum := sha256.New()
+	sum.Write([]byte(strconv.FormatInt(seq, 10) + "\n" + prevHash + "\n"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func (s *AuditStore) append(event AuditEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prevHash := auditGenesisHash
+	if len(s.records) > 0 {
+		prevHash = s.records[len(s.records)-1].Hash
+	}
+	seq := int64(len(s.records) + 1)
+	s.records = append(s.records, AuditRecord{Seq: seq, AuditEvent: event, PrevHash: prevHash, Hash: auditHash(seq, prevHash, event)})
+}
+
+// AuditVerification is the result of recomputing the chain. BrokenAt is the
+// first record whose hash doesn't hold.
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Records  int    `json:"records"`
+	BrokenAt int64  `json:"brokenAt,omitempty"`
+	Problem  string `json:"problem,omitempty"`
+	LastHash string `json:"lastHash"`
+}
+
+func (s *AuditStore) verify() AuditVerification {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := AuditVerification{Valid: true, Records: len(s.records), LastHash: auditGenesisHash}
+	for i, record := range s.records {
+		switch {
+		case record.Seq != int64(i+1):
+			result.Problem = "sequence gap"
+		case record.PrevHash != result.LastHash:
+			result.Problem = "previous hash mismatch"
+		case auditHash(record.Seq, record.PrevHash, record.AuditEvent) != record.Hash:
+			result.Problem = "hash mismatch"
+		}
+		if result.Problem != "" {
+			result.Valid, result.BrokenAt = false, record.Seq
+			return result
+		}
+		result.LastHash = record.Hash
+	}
+	return result
+}
+
+// AuditFilter selects records; empty fields match everything except Tenant,
+// which always has to match. Server-wide records, which have no tenant, are
+// only included with AllTenants.
+type AuditFilter struct {
+	Tenant     string
+	AllTenants bool
+	Actor      string
+	IncidentID string
+	Action     string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
+
+// query returns matching records, newest first.
+func (s *AuditStore) query(filter AuditFilter) []AuditRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []AuditRecord{}
+	for i := len(s.records) - 1; i >= 0; i-- {
+		record := s.records[i]
+		switch {
+		case record.Tenant != filter.Tenant && !(record.Tenant == "" && filter.AllTenants):
+			continue
+		case filter.Actor != "" && !strings.EqualFold(record.Actor, filter.Actor):
+			continue
+		case filter.IncidentID != "" && !strings.EqualFold(record.IncidentID, filter.IncidentID):
+			continue
+		case filter.Action != "" && !strings.HasPrefix(record.Action, filter.Action):
+			continue
+		case !filter.Since.IsZero() && record.At.Before(filter.Since):
+			continue
+		case !filter.Until.IsZero() && record.At.After(filter.Until):
+			continue
+		}
+		items = append(items, record)
+		if filter.Limit > 0 && len(items) == filter.Limit {
+			break
+		}
+	}
+	return items
+}
+
+// incidentChanges lists what changed between two versions of an incident.
+func incidentChanges(previous, current Incident) []AuditChange {
+	changes := []AuditChange{}
+	add := func(field, before, after string) {
+		if before != after {
+			changes = append(changes, AuditChange{Field: field, Before: before, After: after})
+		}
+	}
+	for _, field := range trackedFields {
+		add(field, trackedValue(&previous, field), trackedValue(&current, field))
+	}
+	add("restricted", strconv.FormatBool(previous.Restricted), strconv.FormatBool(current.Restricted))
+	add("major", strconv.FormatBool(previous.Major), strconv.FormatBool(current.Major))
+	add("disposition", previous.Disposition, current.Disposition)
+	return changes
+}
+
+// withAudit records every mutating API call: who made it, from where, and
+// how it ended. The changes themselves are recorded from the store.
+func withAudit(next http.Handler, audit *AuditLog) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isReadRequest(r) || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		status := fallbackInt(recorder.status, http.StatusOK)
+		event := AuditEvent{
+			Actor:      "anonymous",
+			Action:     "api." + strings.ToLower(r.Method),
+			Tenant:     tenantFrom(r.Context()),
+			Resource:   r.URL.Path,
+			Outcome:    auditOutcomeSuccess,
+			Detail:     r.Method + " " + r.URL.Path + " " + strconv.Itoa(status),
+			RemoteAddr: r.RemoteAddr,
+			UserAgent:  r.UserAgent(),
+		}
+		if status >= 400 {
+			event.Outcome = auditOutcomeFailure
+		}
+		if principal, ok := principalFrom(r.Context()); ok {
+			event.Actor, event.ActorType = principal.ID, principal.Kind
+		}
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/api/incidents/"); ok {
+			if id, _, _ := strings.Cut(rest, "/"); strings.Contains(id, "-") {
+				event.IncidentID = id
+			}
+		}
+		audit.record(event)
+	})
+}
+
+func fallbackInt(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+// auditHandler serves GET /api/audit, admin only, filtered by actor,
+// incidentId, action (a prefix, e.g. "incident."), since and until
+// (RFC 3339), and limit (default 100). Only the caller's tenant's records
+// are returned, and server-wide ones such as logins on single-tenant
+// servers or to cross-tenant callers.
+func auditHandler(store *AuditStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		params := r.URL.Query()
+		tenant := tenantFrom(r.Context())
+		caller, _ := principalFrom(r.Context())
+		filter := AuditFilter{Tenant: tenant, AllTenants: tenant == "" || caller.hasRole(roleCrossTenant), Actor: params.Get("actor"), IncidentID: params.Get("incidentId"), Action: params.Get("action"), Limit: 100}
+		for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+			if value := params.Get(name); value != "" {
+				parsed, err := time.Parse(time.RFC3339Nano, value)
+				if err != nil {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": name + " must be an RFC 3339 timestamp"})
+					return
+				}
+				*target = parsed
+			}
+		}
+		if value := params.Get("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be a non-negative integer"})
+				return
+			}
+			filter.Limit = limit
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": store.query(filter)})
+	}
+}
+
+// auditVerifyHandler serves GET /api/audit/verify, admin only. The chain
+// spans every tenant, so on multi-tenant servers it takes the cross-tenant
+// role too.
+func auditVerifyHandler(store *AuditStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		if tenantFrom(r.Context()) != "" && !requireRole(w, r, roleCrossTenant) {
+			return
+		}
+		writeJSON(w, http.StatusOK, store.verify())
+	}
+}
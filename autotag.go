@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fields an auto-tag rule can match. Empty Fields means all of them.
+const (
+	autoTagFieldTitle  = "title"
+	autoTagFieldSource = "source"
+	autoTagFieldIOCs   = "iocs"
+)
+
+var autoTagFields = []string{autoTagFieldTitle, autoTagFieldSource, autoTagFieldIOCs}
+
+// AutoTagRule adds Tags to new incidents whose title, source, or IOCs match
+// Pattern, a case-insensitive regular expression. Hits counts the incidents
+// tagged since the pattern last changed.
+type AutoTagRule struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Pattern   string     `json:"pattern"`
+	Fields    []string   `json:"fields"`
+	Tags      []string   `json:"tags"`
+	Enabled   bool       `json:"enabled"`
+	Hits      int        `json:"hits"`
+	LastHitAt *time.Time `json:"lastHitAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+
+	pattern *regexp.Regexp
+}
+
+type AutoTagRuleInput struct {
+	Name    string   `json:"name"`
+	Pattern string   `json:"pattern"`
+	Fields  []string `json:"fields"`
+	Tags    []string `json:"tags"`
+	// Enabled defaults to true on create.
+	Enabled *bool `json:"enabled"`
+}
+
+var errAutoTagRuleNotFound = errors.New("auto-tag rule not found")
+
+type AutoTagStore struct {
+	mu      sync.Mutex
+	rules   map[string]*AutoTagRule
+	order   []string
+	counter int
+}
+
+func newAutoTagStore() *AutoTagStore {
+	return &AutoTagStore{rules: make(map[string]*AutoTagRule), order: []string{}}
+}
+
+func compileAutoTagPattern(pattern string) (*regexp.Regexp, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return nil, errors.New("pattern is required")
+	}
+	compiled, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, errors.New("pattern is not a valid regular expression")
+	}
+	return compiled, nil
+}
+
+func normalizeAutoTagFields(fields []string) ([]string, error) {
+	normalized := []string{}
+	for _, field := range sanitizeSlice(fields) {
+		field = strings.ToLower(field)
+		if field == "ioc" {
+			field = autoTagFieldIOCs
+		}
+		valid := false
+		for _, known := range autoTagFields {
+			valid = valid || field == known
+		}
+		if !valid {
+			return nil, errors.New("fields must be title, source, or iocs")
+		}
+		normalized = append(normalized, field)
+	}
+	return dedupeStrings(normalized), nil
+}
+
+func (a *AutoTagStore) list() []AutoTagRule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	items := make([]AutoTagRule, 0, len(a.order))
+	for _, id := range a.order {
+		items = append(items, *a.rules[id])
+	}
+	return items
+}
+
+func (a *AutoTagStore) get(id string) (AutoTagRule, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rule, ok := a.rules[id]
+	if !ok {
+		return AutoTagRule{}, false
+	}
+	return *rule, true
+}
+
+func (a *AutoTagStore) create(input AutoTagRuleInput) (AutoTagRule, error) {
+	pattern, err := compileAutoTagPattern(input.Pattern)
+	if err != nil {
+		return AutoTagRule{}, err
+	}
+	fields, err := normalizeAutoTagFields(input.Fields)
+	if err != nil {
+		return AutoTagRule{}, err
+	}
+	tags := dedupeStrings(sanitizeSlice(input.Tags))
+	if len(tags) == 0 {
+		return AutoTagRule{}, errors.New("at least one tag is required")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.counter++
+	now := time.Now().UTC()
+	rule := &AutoTagRule{
+		ID:        "AT-" + padInt(a.counter),
+		Name:      fallback(strings.TrimSpace(input.Name), input.Pattern),
+		Pattern:   input.Pattern,
+		Fields:    fields,
+		Tags:      tags,
+		Enabled:   input.Enabled == nil || *input.Enabled,
+		CreatedAt: now,
+		UpdatedAt: now,
+		pattern:   pattern,
+	}
+	a.rules[rule.ID] = rule
+	a.order = append(a.order, rule.ID)
+	return *rule, nil
+}
+
+// update changes the fields set in input. Changing the pattern resets the
+// hit statistics, since they described the old one.
+func (a *AutoTagStore) update(id string, input AutoTagRuleInput) (AutoTagRule, error) {
+	var pattern *regexp.Regexp
+	if input.Pattern != "" {
+		compiled, err := compileAutoTagPattern(input.Pattern)
+		if err != nil {
+			return AutoTagRule{}, err
+		}
+		pattern = compiled
+	}
+	fields, err := normalizeAutoTagFields(input.Fields)
+	if err != nil {
+		return AutoTagRule{}, err
+	}
+	tags := dedupeStrings(sanitizeSlice(input.Tags))
+	if input.Tags != nil && len(tags) == 0 {
+		return AutoTagRule{}, errors.New("at least one tag is required")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rule, ok := a.rules[id]
+	if !ok {
+		return AutoTagRule{}, errAutoTagRuleNotFound
+	}
+	if strings.TrimSpace(input.Name) != "" {
+		rule.Name = strings.TrimSpace(input.Name)
+	}
+	if pattern != nil && input.Pattern != rule.Pattern {
+		rule.Pattern, rule.pattern = input.Pattern, pattern
+		rule.Hits, rule.LastHitAt = 0, nil
+	}
+	if input.Fields != nil {
+		rule.Fields = fields
+	}
+	if input.Tags != nil {
+		rule.Tags = tags
+	}
+	if input.Enabled != nil {
+		rule.Enabled = *input.Enabled
+	}
+	rule.UpdatedAt = time.Now().UTC()
+	return *rule, nil
+}
+
+func (a *AutoTagStore) delete(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.rules[id]; !ok {
+		return errAutoTagRuleNotFound
+	}
+	delete(a.rules, id)
+	for i, existing := range a.order {
+		if existing == id {
+			a.order = append(a.order[:i], a.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (rule *AutoTagRule) matches(incident *Incident) bool {
+	fields := rule.Fields
+	if len(fields) == 0 {
+		fields = autoTagFields
+	}
+	for _, field := range fields {
+		switch field {
+		case autoTagFieldTitle:
+			if rule.pattern.MatchString(incident.Title) {
+				return true
+			}
+		case autoTagFieldSource:
+			if incident.Source != "" && rule.pattern.MatchString(incident.Source) {
+				return true
+			}
+		case autoTagFieldIOCs:
+			for _, ioc := range incident.IOCs {
+				if rule.pattern.MatchString(ioc) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// tagIncident is registered as a store creation hook, so it runs once per
+// new incident, however it was created. Tags added here can be removed like
+// any other; rules don't re-apply them on later updates.
+func (a *AutoTagStore) tagIncident(incident *Incident) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, id := range a.order {
+		rule := a.rules[id]
+		if !rule.Enabled || !rule.matches(incident) {
+			continue
+		}
+		incident.Tags = dedupeStrings(append(incident.Tags, rule.Tags...))
+		rule.Hits++
+		now := time.Now().UTC()
+		rule.LastHitAt = &now
+	}
+}
+
+func autoTagRulesHandler(autoTags *AutoTagStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReadRequest(r) && (!requireRole(w, r, roleAdmin) || !requireSharedConfig(w, r)) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"items": autoTags.list()})
+		case http.MethodPost:
+			var input AutoTagRuleInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			rule, err := autoTags.create(input)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, rule)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func autoTagRuleHandler(autoTags *AutoTagStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/auto-tag-rules/")
+		if id == "" || strings.Contains(id, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !isReadRequest(r) && (!requireRole(w, r, roleAdmin) || !requireSharedConfig(w, r)) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			rule, ok := autoTags.get(id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, rule)
+		case http.MethodPut:
+			var input AutoTagRuleInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			rule, err := autoTags.update(id, input)
+			if errors.Is(err, errAutoTagRuleNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, rule)
+		case http.MethodDelete:
+			if err := autoTags.delete(id); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
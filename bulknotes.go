@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const authorTypeAutomation = "automation"
+
+type IncidentFilter struct {
+	IDs      []string `json:"ids"`
+	Severity string   `json:"severity"`
+	Status   string   `json:"status"`
+	Q        string   `json:"q"`
+	Query    string   `json:"query"`
+}
+
+type BulkNoteInput struct {
+	Body       string         `json:"body"`
+	Automation string         `json:"automation"`
+	Filter     IncidentFilter `json:"filter"`
+	DryRun     bool           `json:"dryRun"`
+}
+
+type BulkNoteResult struct {
+	Matched int      `json:"matched"`
+	Updated []string `json:"updated"`
+	Failed  []string `json:"failed,omitempty"`
+	DryRun  bool     `json:"dryRun,omitempty"`
+}
+
+func (f IncidentFilter) empty() bool {
+	return len(f.IDs) == 0 && strings.TrimSpace(f.Severity) == "" && strings.TrimSpace(f.Status) == "" &&
+		strings.TrimSpace(f.Q) == "" && strings.TrimSpace(f.Query) == ""
+}
+
+// apply narrows items to the filter. IDs, list filters, and the structured
+// query all have to match.
+func (f IncidentFilter) apply(items []Incident) ([]Incident, error) {
+	items = filterIncidents(items, f.Severity, f.Status, f.Q)
+	if strings.TrimSpace(f.Query) != "" {
+		parsed, err := parseQuery(f.Query)
+		if err != nil {
+			return nil, err
+		}
+		items = filterByQuery(items, parsed)
+	}
+	if len(f.IDs) > 0 {
+		wanted := make(map[string]bool, len(f.IDs))
+		for _, id := range f.IDs {
+			wanted[strings.TrimSpace(id)] = true
+		}
+		filtered := make([]Incident, 0, len(f.IDs))
+		for _, incident := range items {
+			if wanted[incident.ID] {
+				filtered = append(filtered, incident)
+			}
+		}
+		items = filtered
+	}
+	return items, nil
+}
+
+func bulkNoteHandler(store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var input BulkNoteInput
+		if err := readJSON(r, &input); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		if strings.TrimSpace(input.Body) == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "note body required"})
+			return
+		}
+		// Callers authenticated as a service identity are attributed to it;
+		// anonymous callers must at least name the automation.
+		author := NoteInput{Author: strings.TrimSpace(input.Automation), AuthorType: authorTypeAutomation}
+		attributeNote(r.Context(), &author)
+		if author.Author == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "automation name required"})
+			return
+		}
+		if input.Filter.empty() {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "filter required; bulk notes never target every incident"})
+			return
+		}
+
+		matched, err := input.Filter.apply(visibleTo(r, store.list()))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid query: " + err.Error()})
+			return
+		}
+
+		result := BulkNoteResult{Matched: len(matched), Updated: []string{}, DryRun: input.DryRun}
+		for _, incident := range matched {
+			if input.DryRun {
+				result.Updated = append(result.Updated, incident.ID)
+				continue
+			}
+			note := author
+			note.Body = input.Body
+			_, err := store.addNote(incident.ID, note)
+			if err != nil {
+				result.Failed = append(result.Failed, incident.ID)
+				continue
+			}
+			result.Updated = append(result.Updated, incident.ID)
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Campaign groups incidents that are part of one attack or actor's
+// activity. Children carry the campaign's ID in CampaignID.
+type Campaign struct {
+	ID          string    `json:"id"`
+	Tenant      string    `json:"tenant,omitempty"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Actor       string    `json:"actor,omitempty"`
+	CreatedBy   string    `json:"createdBy,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type CampaignInput struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	Actor       *string `json:"actor"`
+}
+
+// CampaignRollup aggregates a campaign's children: the highest severity
+// among them, how many are in each status, and every IOC with the children
+// it appears on.
+type CampaignRollup struct {
+	Incidents  []LinkedIncident    `json:"incidents"`
+	Count      int                 `json:"count"`
+	Open       int                 `json:"open"`
+	Severity   string              `json:"severity,omitempty"`
+	ByStatus   map[string]int      `json:"byStatus"`
+	IOCs       map[string][]string `json:"iocs"`
+	Tags       []string            `json:"tags"`
+	FirstSeen  *time.Time          `json:"firstSeen,omitempty"`
+	LastActive *time.Time          `json:"lastActive,omitempty"`
+}
+
+// CampaignTimelineEvent is a child's timeline entry in the campaign feed.
+type CampaignTimelineEvent struct {
+	IncidentID string `json:"incidentId"`
+	TimelineEvent
+}
+
+type CampaignView struct {
+	Campaign
+	Rollup   CampaignRollup          `json:"rollup"`
+	Timeline []CampaignTimelineEvent `json:"timeline,omitempty"`
+}
+
+var errCampaignNotFound = errors.New("campaign not found")
+
+type CampaignStore struct {
+	mu        sync.RWMutex
+	campaigns map[string]*Campaign
+	order     []string
+	counter   int
+}
+
+func newCampaignStore() *CampaignStore {
+	return &CampaignStore{campaigns: make(map[string]*Campaign), order: []string{}}
+}
+
+func (s *CampaignStore) size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.campaigns)
+}
+
+func (c *CampaignStore) list() []Campaign {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	items := make([]Campaign, 0, len(c.order))
+	for _, id := range c.order {
+		items = append(items, *c.campaigns[id])
+	}
+	return items
+}
+
+func (c *CampaignStore) get(id string) (Campaign, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	campaign, ok := c.campaigns[id]
+	if !ok {
+		return Campaign{}, false
+	}
+	return *campaign, true
+}
+
+func (input CampaignInput) apply(campaign *Campaign) {
+	if name := strings.TrimSpace(input.Name); name != "" {
+		campaign.Name = name
+	}
+	if input.Description != nil {
+		campaign.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.Actor != nil {
+		campaign.Actor = strings.TrimSpace(*input.Actor)
+	}
+}
+
+func (c *CampaignStore) create(input CampaignInput, tenant, by string) Campaign {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counter++
+	now := time.Now().UTC()
+	campaign := &Campaign{ID: "CMP-" + padInt(c.counter), Tenant: tenant, CreatedBy: by, CreatedAt: now, UpdatedAt: now}
+	input.apply(campaign)
+	c.campaigns[campaign.ID] = campaign
+	c.order = append(c.order, campaign.ID)
+	return *campaign
+}
+
+func (c *CampaignStore) update(id string, input CampaignInput) (Campaign, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	campaign, ok := c.campaigns[id]
+	if !ok {
+		return Campaign{}, errCampaignNotFound
+	}
+	input.apply(campaign)
+	campaign.UpdatedAt = time.Now().UTC()
+	return *campaign, nil
+}
+
+func (c *CampaignStore) delete(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.campaigns[id]; !ok {
+		return errCampaignNotFound
+	}
+	delete(c.campaigns, id)
+	for i, candidate := range c.order {
+		if candidate == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// setCampaign points an incident at a campaign, or detaches it when
+// campaignID is empty.
+func (s *IncidentStore) setCampaign(id, campaignID string) (Incident, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return Incident{}, errIncidentNotFound
+	}
+	if incident.CampaignID == campaignID {
+		return *incident, nil
+	}
+	previous := *incident
+	incident.CampaignID = campaignID
+	incident.UpdatedAt = time.Now().UTC()
+	s.emit(eventIncidentUpdated, *incident, &previous)
+	return *incident, nil
+}
+
+// campaignChildren returns the campaign's incidents the caller can see.
+func campaignChildren(r *http.Request, store *IncidentStore, campaignID string) []Incident {
+	children := []Incident{}
+	for _, incident := range visibleTo(r, store.list()) {
+		if incident.CampaignID == campaignID {
+			children = append(children, incident)
+		}
+	}
+	return children
+}
+
+func rollupCampaign(children []Incident) CampaignRollup {
+	rollup := CampaignRollup{Incidents: []LinkedIncident{}, Count: len(children), ByStatus: map[string]int{}, IOCs: map[string][]string{}, Tags: []string{}}
+	for _, incident := range children {
+		rollup.Incidents = append(rollup.Incidents, LinkedIncident{ID: incident.ID, Title: incident.Title, Severity: incident.Severity, Status: incident.Status})
+		rollup.ByStatus[incident.Status]++
+		if !isClosedStatus(incident.Status) {
+			rollup.Open++
+		}
+		if rollup.Severity == "" || severityRank(incident.Severity) > severityRank(rollup.Severity) {
+			rollup.Severity = incident.Severity
+		}
+		for _, ioc := range incident.IOCs {
+			key := normalizeIOC(ioc)
+			rollup.IOCs[key] = append(rollup.IOCs[key], incident.ID)
+		}
+		rollup.Tags = append(rollup.Tags, incident.Tags...)
+		created, updated := incident.CreatedAt, incident.UpdatedAt
+		if rollup.FirstSeen == nil || created.Before(*rollup.FirstSeen) {
+			rollup.FirstSeen = &created
+		}
+		if rollup.LastActive == nil || updated.After(*rollup.LastActive) {
+			rollup.LastActive = &updated
+		}
+	}
+	rollup.Tags = dedupeStrings(rollup.Tags)
+	return rollup
+}
+
+// campaignTimeline merges the children's timelines, oldest first.
+func campaignTimeline(children []Incident) []CampaignTimelineEvent {
+	events := []CampaignTimelineEvent{}
+	for _, incident := range children {
+		for _, event := range incidentTimeline(incident) {
+			events = append(events, CampaignTimelineEvent{IncidentID: incident.ID, TimelineEvent: event})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	return events
+}
+
+// campaignsHandler serves GET and POST /api/campaigns. The list carries
+// each campaign's roll-up without its timeline.
+func campaignsHandler(campaigns *CampaignStore, store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			items := []CampaignView{}
+			for _, campaign := range campaigns.list() {
+				if !inTenant(r, campaign.Tenant) {
+					continue
+				}
+				items = append(items, CampaignView{Campaign: campaign, Rollup: rollupCampaign(campaignChildren(r, store, campaign.ID))})
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+		case http.MethodPost:
+			var input CampaignInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			if strings.TrimSpace(input.Name) == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required"})
+				return
+			}
+			name, _ := actor(r.Context())
+			writeJSON(w, http.StatusCreated, campaigns.create(input, tenantFrom(r.Context()), name))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// campaignHandler serves GET, PUT, and DELETE /api/campaigns/{id}, and
+// POST /api/campaigns/{id}/incidents and DELETE
+// /api/campaigns/{id}/incidents/{incidentId} to add and remove children.
+func campaignHandler(campaigns *CampaignStore, store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/campaigns/"), "/")
+		id := parts[0]
+		campaign, ok := campaigns.get(id)
+		if !ok || !inTenant(r, campaign.Tenant) || len(parts) > 3 || (len(parts) > 1 && parts[1] != "incidents") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if len(parts) == 3 {
+			if r.Method != http.MethodDelete {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			incident, ok := store.get(parts[2])
+			if !ok || !canView(r, *incident) || incident.CampaignID != id {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if _, err := store.setCampaign(incident.ID, ""); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if len(parts) == 2 {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			var input struct {
+				IncidentIDs []string `json:"incidentIds"`
+			}
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			if len(input.IncidentIDs) == 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "incidentIds is required"})
+				return
+			}
+			for _, incidentID := range sanitizeSlice(input.IncidentIDs) {
+				if incident, ok := store.get(incidentID); !ok || !canView(r, *incident) {
+					writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": incidentID + ": " + errIncidentNotFound.Error()})
+					return
+				}
+			}
+			for _, incidentID := range sanitizeSlice(input.IncidentIDs) {
+				if _, err := store.setCampaign(incidentID, id); err != nil {
+					writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": incidentID + ": " + err.Error()})
+					return
+				}
+			}
+			children := campaignChildren(r, store, id)
+			writeJSON(w, http.StatusOK, CampaignView{Campaign: campaign, Rollup: rollupCampaign(children)})
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			children := campaignChildren(r, store, id)
+			writeJSON(w, http.StatusOK, CampaignView{Campaign: campaign, Rollup: rollupCampaign(children), Timeline: campaignTimeline(children)})
+		case http.MethodPut:
+			var input CampaignInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			updated, err := campaigns.update(id, input)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, CampaignView{Campaign: updated, Rollup: rollupCampaign(campaignChildren(r, store, id))})
+		case http.MethodDelete:
+			if err := campaigns.delete(id); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			// Children are detached, whether or not this caller can see them.
+			for _, incident := range store.list() {
+				if incident.CampaignID != id {
+					continue
+				}
+				if _, err := store.setCampaign(incident.ID, ""); err != nil {
+					log.Printf("detaching %s from deleted campaign %s: %v", incident.ID, id, err)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
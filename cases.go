@@ -0,0 +1,676 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Case lifecycle. Cases move freely between the open statuses; closing
+// needs a final report, and a closed case can be reopened to Active.
+const (
+	caseStatusOpen   = "Open"
+	caseStatusActive = "Active"
+	caseStatusReview = "Review"
+	caseStatusClosed = "Closed"
+)
+
+var caseStatuses = []string{caseStatusOpen, caseStatusActive, caseStatusReview, caseStatusClosed}
+
+// Case member roles. Leads manage membership; every member can work the
+// case.
+const (
+	caseRoleLead         = "lead"
+	caseRoleInvestigator = "investigator"
+	caseRoleReviewer     = "reviewer"
+)
+
+var caseRoles = []string{caseRoleLead, caseRoleInvestigator, caseRoleReviewer}
+
+// Case is an investigation spanning several incidents, with its own
+// lifecycle, team, and deliverables. Incidents carry the case's ID in
+// CaseID.
+type Case struct {
+	ID          string       `json:"id"`
+	Tenant      string       `json:"tenant,omitempty"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Status      string       `json:"status"`
+	Members     []CaseMember `json:"members"`
+	Report      *CaseReport  `json:"report,omitempty"`
+	CreatedBy   string       `json:"createdBy,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+	ClosedAt    *time.Time   `json:"closedAt,omitempty"`
+}
+
+type CaseMember struct {
+	UserID  string    `json:"userId"`
+	Role    string    `json:"role"`
+	AddedBy string    `json:"addedBy,omitempty"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// CaseReport is the case's write-up in markdown. Final marks it ready,
+// which closing the case requires.
+type CaseReport struct {
+	Body      string    `json:"body"`
+	BodyHTML  string    `json:"bodyHtml,omitempty"`
+	Final     bool      `json:"final"`
+	UpdatedBy string    `json:"updatedBy,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type CaseInput struct {
+	Title       string  `json:"title"`
+	Description *string `json:"description"`
+	Status      *string `json:"status"`
+}
+
+type CaseMemberInput struct {
+	Role string `json:"role"`
+}
+
+type CaseReportInput struct {
+	Body  string `json:"body"`
+	Final bool   `json:"final"`
+}
+
+// CaseView is a case with the incidents the caller can see.
+type CaseView struct {
+	Case
+	Incidents []LinkedIncident `json:"incidents"`
+}
+
+var (
+	errCaseNotFound       = errors.New("case not found")
+	errCaseMemberNotFound = errors.New("member not found")
+	errCaseClosed         = errors.New("reopen the case first")
+)
+
+type CaseStore struct {
+	mu      sync.RWMutex
+	cases   map[string]*Case
+	order   []string
+	counter int
+}
+
+func newCaseStore() *CaseStore {
+	return &CaseStore{cases: make(map[string]*Case), order: []string{}}
+}
+
+func (s *CaseStore) size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.cases)
+}
+
+// view copies a case so callers can't reach the stored slices.
+func (c *Case) view() Case {
+	copied := *c
+	copied.Members = append([]CaseMember{}, c.Members...)
+	if c.Report != nil {
+		report := *c.Report
+		copied.Report = &report
+	}
+	return copied
+}
+
+func (c Case) member(userID string) (CaseMember, bool) {
+	for _, member := range c.Members {
+		if strings.EqualFold(member.UserID, userID) {
+			return member, true
+		}
+	}
+	return CaseMember{}, false
+}
+
+func (c *CaseStore) list() []Case {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	items := make([]Case, 0, len(c.order))
+	for _, id := range c.order {
+		items = append(items, c.cases[id].view())
+	}
+	return items
+}
+
+func (c *CaseStore) get(id string) (Case, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	investigation, ok := c.cases[id]
+	if !ok {
+		return Case{}, false
+	}
+	return investigation.view(), true
+}
+
+func canonicalCaseStatus(status string) (string, error) {
+	for _, candidate := range caseStatuses {
+		if strings.EqualFold(candidate, strings.TrimSpace(status)) {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("status must be one of " + strings.Join(caseStatuses, ", "))
+}
+
+// apply copies the fields input sets onto investigation, enforcing the
+// lifecycle.
+func (input CaseInput) apply(investigation *Case, now time.Time) error {
+	if title := strings.TrimSpace(input.Title); title != "" {
+		investigation.Title = title
+	}
+	if input.Description != nil {
+		investigation.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.Status == nil {
+		return nil
+	}
+	status, err := canonicalCaseStatus(*input.Status)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status == investigation.Status:
+		return nil
+	case investigation.Status == caseStatusClosed && status != caseStatusActive:
+		return errors.New("closed cases can only be reopened to " + caseStatusActive)
+	case status == caseStatusClosed && (investigation.Report == nil || !investigation.Report.Final):
+		return errors.New("cases need a final report before closing")
+	}
+	investigation.Status = status
+	investigation.ClosedAt = nil
+	if status == caseStatusClosed {
+		investigation.ClosedAt = &now
+	}
+	return nil
+}
+
+// create opens a case with its creator as lead.
+func (c *CaseStore) create(input CaseInput, tenant, by, byID string) (Case, error) {
+	now := time.Now().UTC()
+	investigation := &Case{Tenant: tenant, Status: caseStatusOpen, Members: []CaseMember{}, CreatedBy: by, CreatedAt: now, UpdatedAt: now}
+	if byID != "" {
+		investigation.Members = append(investigation.Members, CaseMember{UserID: byID, Role: caseRoleLead, AddedBy: byID, AddedAt: now})
+	}
+	if input.Status != nil && !strings.EqualFold(strings.TrimSpace(*input.Status), caseStatusOpen) {
+		return Case{}, errors.New("cases start " + caseStatusOpen)
+	}
+	if err := input.apply(investigation, now); err != nil {
+		return Case{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counter++
+	investigation.ID = "CASE-" + padInt(c.counter)
+	c.cases[investigation.ID] = investigation
+	c.order = append(c.order, investigation.ID)
+	return investigation.view(), nil
+}
+
+// edit applies fn to a copy of the case and stores the copy if fn
+// succeeds.
+func (c *CaseStore) edit(id string, fn func(*Case, time.Time) error) (Case, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	investigation, ok := c.cases[id]
+	if !ok {
+		return Case{}, errCaseNotFound
+	}
+	now := time.Now().UTC()
+	updated := investigation.view()
+	if err := fn(&updated, now); err != nil {
+		return Case{}, err
+	}
+	updated.UpdatedAt = now
+	*investigation = updated
+	return investigation.view(), nil
+}
+
+func (c *CaseStore) update(id string, input CaseInput) (Case, error) {
+	return c.edit(id, func(investigation *Case, now time.Time) error {
+		return input.apply(investigation, now)
+	})
+}
+
+// setMember adds a member or changes their role. A case always keeps at
+// least one lead.
+func (c *CaseStore) setMember(id, userID, role, by string) (Case, error) {
+	return c.edit(id, func(investigation *Case, now time.Time) error {
+		for i, member := range investigation.Members {
+			if strings.EqualFold(member.UserID, userID) {
+				if member.Role == caseRoleLead && role != caseRoleLead && investigation.leads() == 1 {
+					return errors.New("a case needs at least one lead")
+				}
+				investigation.Members[i].Role = role
+				return nil
+			}
+		}
+		investigation.Members = append(investigation.Members, CaseMember{UserID: userID, Role: role, AddedBy: by, AddedAt: now})
+		return nil
+	})
+}
+
+func (c *CaseStore) removeMember(id, userID string) (Case, error) {
+	return c.edit(id, func(investigation *Case, now time.Time) error {
+		for i, member := range investigation.Members {
+			if !strings.EqualFold(member.UserID, userID) {
+				continue
+			}
+			if member.Role == caseRoleLead && investigation.leads() == 1 {
+				return errors.New("a case needs at least one lead")
+			}
+			investigation.Members = append(investigation.Members[:i], investigation.Members[i+1:]...)
+			return nil
+		}
+		return errCaseMemberNotFound
+	})
+}
+
+func (c *Case) leads() int {
+	count := 0
+	for _, member := range c.Members {
+		if member.Role == caseRoleLead {
+			count++
+		}
+	}
+	return count
+}
+
+func (c *CaseStore) setReport(id string, input CaseReportInput, by string) (Case, error) {
+	return c.edit(id, func(investigation *Case, now time.Time) error {
+		if investigation.Status == caseStatusClosed {
+			return errCaseClosed
+		}
+		investigation.Report = &CaseReport{Body: strings.TrimSpace(input.Body), Final: input.Final, UpdatedBy: by, UpdatedAt: now}
+		return nil
+	})
+}
+
+func (c *CaseStore) delete(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.cases[id]; !ok {
+		return errCaseNotFound
+	}
+	delete(c.cases, id)
+	for i, candidate := range c.order {
+		if candidate == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// setCase points an incident at a case, or detaches it when caseID is
+// empty.
+func (s *IncidentStore) setCase(id, caseID string) (Incident, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return Incident{}, errIncidentNotFound
+	}
+	if incident.CaseID == caseID {
+		return *incident, nil
+	}
+	previous := *incident
+	incident.CaseID = caseID
+	incident.UpdatedAt = time.Now().UTC()
+	s.emit(eventIncidentUpdated, *incident, &previous)
+	return *incident, nil
+}
+
+// caseIncidents returns the case's incidents the caller can see.
+func caseIncidents(r *http.Request, store *IncidentStore, caseID string) []Incident {
+	incidents := []Incident{}
+	for _, incident := range visibleTo(r, store.list()) {
+		if incident.CaseID == caseID {
+			incidents = append(incidents, incident)
+		}
+	}
+	return incidents
+}
+
+func caseView(r *http.Request, store *IncidentStore, investigation Case) CaseView {
+	view := CaseView{Case: investigation, Incidents: []LinkedIncident{}}
+	for _, incident := range caseIncidents(r, store, investigation.ID) {
+		view.Incidents = append(view.Incidents, LinkedIncident{ID: incident.ID, Title: incident.Title, Severity: incident.Severity, Status: incident.Status})
+	}
+	if view.Report != nil && wantsRenderedNotes(r.URL.Query()) {
+		view.Report.BodyHTML = renderMarkdown(view.Report.Body)
+	}
+	return view
+}
+
+// requireCaseRole lets admins and the case's members through, or only its
+// leads when leadOnly is set.
+func requireCaseRole(w http.ResponseWriter, r *http.Request, investigation Case, leadOnly bool) bool {
+	principal, ok := principalFrom(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+		return false
+	}
+	if principal.hasRole(roleAdmin) {
+		return true
+	}
+	member, ok := investigation.member(principal.ID)
+	switch {
+	case !ok:
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "case members only"})
+		return false
+	case leadOnly && member.Role != caseRoleLead:
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "case leads only"})
+		return false
+	}
+	return true
+}
+
+// casesHandler serves GET and POST /api/cases. ?status= filters the list.
+func casesHandler(cases *CaseStore, store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			status := r.URL.Query().Get("status")
+			items := []CaseView{}
+			for _, investigation := range cases.list() {
+				if inTenant(r, investigation.Tenant) && (status == "" || strings.EqualFold(status, investigation.Status)) {
+					items = append(items, caseView(r, store, investigation))
+				}
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+		case http.MethodPost:
+			var input CaseInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			if strings.TrimSpace(input.Title) == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "title is required"})
+				return
+			}
+			name, actorID := actor(r.Context())
+			investigation, err := cases.create(input, tenantFrom(r.Context()), name, actorID)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, caseView(r, store, investigation))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// caseHandler serves GET, PUT, and DELETE /api/cases/{id} and the case's
+// subresources: incidents, members, report, and evidence.
+func caseHandler(cases *CaseStore, store *IncidentStore, users *UserStore, evidence *EvidenceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/cases/"), "/")
+		id := parts[0]
+		investigation, ok := cases.get(id)
+		if !ok || !inTenant(r, investigation.Tenant) || len(parts) > 3 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if len(parts) > 1 {
+			switch parts[1] {
+			case "incidents":
+				handleCaseIncidents(w, r, investigation, parts, store)
+			case "members":
+				handleCaseMembers(w, r, investigation, parts, cases, store, users)
+			case "report":
+				handleCaseReport(w, r, investigation, parts, cases, store)
+			case "evidence":
+				handleCaseEvidence(w, r, investigation, parts, store, evidence)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, caseView(r, store, investigation))
+		case http.MethodPut:
+			if !requireCaseRole(w, r, investigation, false) {
+				return
+			}
+			var input CaseInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			updated, err := cases.update(id, input)
+			if errors.Is(err, errCaseNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, caseView(r, store, updated))
+		case http.MethodDelete:
+			if !requireCaseRole(w, r, investigation, true) {
+				return
+			}
+			if err := cases.delete(id); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			// Incidents are detached, whether or not this caller can see them.
+			for _, incident := range store.list() {
+				if incident.CaseID != id {
+					continue
+				}
+				if _, err := store.setCase(incident.ID, ""); err != nil {
+					log.Printf("detaching %s from deleted case %s: %v", incident.ID, id, err)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// handleCaseIncidents serves POST /api/cases/{id}/incidents with
+// {"incidentIds": [...]} and DELETE /api/cases/{id}/incidents/{incidentId}.
+// An incident belongs to one case at a time.
+func handleCaseIncidents(w http.ResponseWriter, r *http.Request, investigation Case, parts []string, store *IncidentStore) {
+	if len(parts) == 3 {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireCaseRole(w, r, investigation, false) {
+			return
+		}
+		incident, ok := store.get(parts[2])
+		if !ok || !canView(r, *incident) || incident.CaseID != investigation.ID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if _, err := store.setCase(incident.ID, ""); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireCaseRole(w, r, investigation, false) {
+		return
+	}
+	var input struct {
+		IncidentIDs []string `json:"incidentIds"`
+	}
+	if err := readJSON(r, &input); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if len(input.IncidentIDs) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "incidentIds is required"})
+		return
+	}
+	for _, incidentID := range sanitizeSlice(input.IncidentIDs) {
+		incident, ok := store.get(incidentID)
+		switch {
+		case !ok || !canView(r, *incident):
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": incidentID + ": " + errIncidentNotFound.Error()})
+			return
+		case incident.CaseID != "" && incident.CaseID != investigation.ID:
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": incidentID + " is already part of " + incident.CaseID})
+			return
+		}
+	}
+	for _, incidentID := range sanitizeSlice(input.IncidentIDs) {
+		if _, err := store.setCase(incidentID, investigation.ID); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": incidentID + ": " + err.Error()})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, caseView(r, store, investigation))
+}
+
+// handleCaseMembers serves GET /api/cases/{id}/members, and PUT and DELETE
+// /api/cases/{id}/members/{userId} for case leads and admins. Members must
+// be active users in the directory.
+func handleCaseMembers(w http.ResponseWriter, r *http.Request, investigation Case, parts []string, cases *CaseStore, store *IncidentStore, users *UserStore) {
+	if len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": investigation.Members})
+		return
+	}
+	if parts[2] == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	userID := parts[2]
+
+	var (
+		updated Case
+		err     error
+	)
+	switch r.Method {
+	case http.MethodPut:
+		if !requireCaseRole(w, r, investigation, true) {
+			return
+		}
+		var input CaseMemberInput
+		if err := readJSON(r, &input); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		role := strings.ToLower(strings.TrimSpace(input.Role))
+		if !slices.Contains(caseRoles, role) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "role must be one of " + strings.Join(caseRoles, ", ")})
+			return
+		}
+		user, ok := users.get(userID)
+		if !ok || !user.Active {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": userID + ": " + errUserNotFound.Error()})
+			return
+		}
+		_, actorID := actor(r.Context())
+		updated, err = cases.setMember(investigation.ID, user.ID, role, actorID)
+	case http.MethodDelete:
+		if !requireCaseRole(w, r, investigation, true) {
+			return
+		}
+		updated, err = cases.removeMember(investigation.ID, userID)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if errors.Is(err, errCaseNotFound) || errors.Is(err, errCaseMemberNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, caseView(r, store, updated))
+}
+
+// handleCaseReport serves GET and PUT /api/cases/{id}/report. PUT replaces
+// the report; ?render=html adds bodyHtml.
+func handleCaseReport(w http.ResponseWriter, r *http.Request, investigation Case, parts []string, cases *CaseStore, store *IncidentStore) {
+	if len(parts) != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		view := caseView(r, store, investigation)
+		if view.Report == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, view.Report)
+	case http.MethodPut:
+		if !requireCaseRole(w, r, investigation, false) {
+			return
+		}
+		var input CaseReportInput
+		if err := readJSON(r, &input); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		if input.Final && strings.TrimSpace(input.Body) == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "a final report needs a body"})
+			return
+		}
+		name, _ := actor(r.Context())
+		updated, err := cases.setReport(investigation.ID, input, name)
+		if errors.Is(err, errCaseNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, caseView(r, store, updated).Report)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCaseEvidence serves GET /api/cases/{id}/evidence: every artifact
+// registered on the case's incidents the caller can see.
+func handleCaseEvidence(w http.ResponseWriter, r *http.Request, investigation Case, parts []string, store *IncidentStore, evidence *EvidenceStore) {
+	if len(parts) != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	items := []Evidence{}
+	for _, incident := range caseIncidents(r, store, investigation.ID) {
+		items = append(items, evidence.list(incident.ID)...)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
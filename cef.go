@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	cefAlertSource  = "cef"
+	leefAlertSource = "leef"
+)
+
+// cefSeverityMap covers CEF's 0-10 scale and its named levels.
+func cefSeverityMap() map[string]string {
+	severities := map[string]string{
+		"unknown":   "Medium",
+		"very-high": "Critical",
+	}
+	for level := 0; level <= 10; level++ {
+		name := "Low"
+		switch {
+		case level >= 9:
+			name = "Critical"
+		case level >= 7:
+			name = "High"
+		case level >= 4:
+			name = "Medium"
+		}
+		severities[strconv.Itoa(level)] = name
+	}
+	return severities
+}
+
+func cefAlertMapping() AlertMapping {
+	return AlertMapping{
+		Source:        cefAlertSource,
+		TitleTemplate: "{deviceProduct}: {name}",
+		SeverityField: "severity",
+		SeverityMap:   cefSeverityMap(),
+		IOCFields: []string{
+			"extensions.src", "extensions.dst", "extensions.sourceTranslatedAddress",
+			"extensions.destinationTranslatedAddress", "extensions.request",
+			"extensions.fileHash", "extensions.oldFileHash", "extensions.destinationDnsDomain",
+		},
+		TagFields:    []string{"deviceVendor", "deviceProduct"},
+		HostFields:   []string{"extensions.shost", "extensions.dhost"},
+		UserFields:   []string{"extensions.suser", "extensions.duser"},
+		DedupeFields: []string{"deviceVendor", "deviceProduct", "signatureId", "extensions.src", "extensions.dst"},
+	}
+}
+
+func leefAlertMapping() AlertMapping {
+	return AlertMapping{
+		Source:        leefAlertSource,
+		TitleTemplate: "{deviceProduct}: {eventId}",
+		SeverityField: "extensions.sev",
+		SeverityMap:   cefSeverityMap(),
+		IOCFields: []string{
+			"extensions.src", "extensions.dst", "extensions.srcPostNAT", "extensions.dstPostNAT",
+			"extensions.url", "extensions.domain",
+		},
+		TagFields:    []string{"deviceVendor", "deviceProduct"},
+		HostFields:   []string{"extensions.identHostName", "extensions.srcHostName", "extensions.dstHostName"},
+		UserFields:   []string{"extensions.usrName", "extensions.accountName"},
+		DedupeFields: []string{"deviceVendor", "deviceProduct", "eventId", "extensions.src", "extensions.dst"},
+	}
+}
+
+// splitEventHeader splits n pipe-delimited header fields, honouring \| and
+// \\ escapes, and returns the rest of the line.
+func splitEventHeader(text string, n int) ([]string, string, error) {
+	fields := make([]string, 0, n)
+	var field strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c == '\\' && i+1 < len(text) && (text[i+1] == '|' || text[i+1] == '\\') {
+			field.WriteByte(text[i+1])
+			i++
+			continue
+		}
+		if c == '|' {
+			fields = append(fields, field.String())
+			field.Reset()
+			if len(fields) == n {
+				return fields, text[i+1:], nil
+			}
+			continue
+		}
+		field.WriteByte(c)
+	}
+	return nil, "", errors.New("truncated header")
+}
+
+var cefExtensionKey = regexp.MustCompile(`(?:^|\s)([A-Za-z0-9_.\[\]-]+)=`)
+
+// parseCEFExtensions reads space-separated key=value pairs where values may
+// themselves contain spaces; a value runs until the next unescaped key=.
+func parseCEFExtensions(text string) map[string]any {
+	extensions := map[string]any{}
+	keys := cefExtensionKey.FindAllStringSubmatchIndex(text, -1)
+	for i, match := range keys {
+		key := text[match[2]:match[3]]
+		end := len(text)
+		if i+1 < len(keys) {
+			end = keys[i+1][0]
+		}
+		value := strings.TrimSpace(text[match[1]:end])
+		value = strings.NewReplacer(`\=`, "=", `\\`, `\`, `\n`, "\n", `\r`, "\r").Replace(value)
+		extensions[key] = value
+	}
+	return extensions
+}
+
+// parseCEF parses "CEF:0|vendor|product|version|signature|name|severity|ext".
+func parseCEF(line string) (map[string]any, error) {
+	header, rest, err := splitEventHeader(strings.TrimPrefix(line, "CEF:"), 7)
+	if err != nil {
+		return nil, errors.New("CEF: " + err.Error())
+	}
+	return map[string]any{
+		"format":        cefAlertSource,
+		"cefVersion":    header[0],
+		"deviceVendor":  header[1],
+		"deviceProduct": header[2],
+		"deviceVersion": header[3],
+		"signatureId":   header[4],
+		"name":          header[5],
+		"severity":      strings.ToLower(strings.TrimSpace(header[6])),
+		"extensions":    parseCEFExtensions(rest),
+	}, nil
+}
+
+// parseLEEF parses LEEF 1.0 (tab-delimited attributes) and LEEF 2.0, whose
+// sixth header field names the delimiter as a character or hex code.
+func parseLEEF(line string) (map[string]any, error) {
+	text := strings.TrimPrefix(line, "LEEF:")
+	header, rest, err := splitEventHeader(text, 5)
+	if err != nil {
+		return nil, errors.New("LEEF: " + err.Error())
+	}
+	delimiter := "\t"
+	if strings.HasPrefix(header[0], "2") {
+		if index := strings.IndexByte(rest, '|'); index >= 0 {
+			spec := rest[:index]
+			rest = rest[index+1:]
+			switch {
+			case len(spec) == 1:
+				delimiter = spec
+			case strings.HasPrefix(strings.ToLower(spec), "x") || strings.HasPrefix(strings.ToLower(spec), "0x"):
+				code, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(spec), "0"), "x"), 16, 8)
+				if err == nil {
+					delimiter = string(rune(code))
+				}
+			}
+		}
+	}
+
+	extensions := map[string]any{}
+	for _, pair := range strings.Split(rest, delimiter) {
+		if key, value, ok := strings.Cut(pair, "="); ok && strings.TrimSpace(key) != "" {
+			extensions[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return map[string]any{
+		"format":        leefAlertSource,
+		"leefVersion":   header[0],
+		"deviceVendor":  header[1],
+		"deviceProduct": header[2],
+		"deviceVersion": header[3],
+		"eventId":       header[4],
+		"extensions":    extensions,
+	}, nil
+}
+
+// parseEventLine recognises a CEF or LEEF record anywhere in a line, so
+// records still wrapped in a syslog header are accepted. It returns the
+// matching built-in source.
+func parseEventLine(line string) (map[string]any, string, error) {
+	if index := strings.Index(line, "CEF:"); index >= 0 {
+		alert, err := parseCEF(line[index:])
+		return alert, cefAlertSource, err
+	}
+	if index := strings.Index(line, "LEEF:"); index >= 0 {
+		alert, err := parseLEEF(line[index:])
+		return alert, leefAlertSource, err
+	}
+	return nil, "", errors.New("not a CEF or LEEF record")
+}
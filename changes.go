@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Change is one entry in the change feed.
+type Change struct {
+	Cursor     string    `json:"cursor"`
+	Type       string    `json:"type"`
+	IncidentID string    `json:"incidentId"`
+	Incident   Incident  `json:"incident"`
+	At         time.Time `json:"at"`
+
+	seq int64
+}
+
+var errCursorExpired = errors.New("cursor is older than the change buffer or from an earlier server run")
+
+// ChangeFeed keeps the most recent store events in order so clients can
+// catch up from a cursor. Cursors are "<epoch>.<sequence>"; the epoch is the
+// server start time, so cursors don't survive a restart unnoticed.
+type ChangeFeed struct {
+	mu      sync.Mutex
+	epoch   string
+	seq     int64
+	entries []Change
+	limit   int
+	// changed is closed and replaced whenever an entry is added, waking
+	// every waiting reader.
+	changed chan struct{}
+	// closing is closed when the server shuts down, ending streams and
+	// long polls so clients reconnect elsewhere.
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func newChangeFeed(store *IncidentStore) *ChangeFeed {
+	feed := &ChangeFeed{
+		epoch:   strconv.FormatInt(startedAt.Unix(), 36),
+		limit:   envInt("CHANGE_FEED_SIZE", 1000),
+		changed: make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	store.subscribe(feed.record)
+	return feed
+}
+
+func (f *ChangeFeed) cursor(seq int64) string {
+	return f.epoch + "." + strconv.FormatInt(seq, 10)
+}
+
+func (f *ChangeFeed) record(event IncidentEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	f.entries = append(f.entries, Change{
+		Cursor:     f.cursor(f.seq),
+		Type:       event.Type,
+		IncidentID: event.Incident.ID,
+		Incident:   event.Incident,
+		At:         event.At,
+		seq:        f.seq,
+	})
+	if len(f.entries) > f.limit {
+		f.entries = append([]Change{}, f.entries[len(f.entries)-f.limit:]...)
+	}
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *ChangeFeed) close() {
+	f.closeOnce.Do(func() { close(f.closing) })
+}
+
+// parseCursor returns the sequence a cursor points at. An empty cursor means
+// "from now".
+func (f *ChangeFeed) parseCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.seq, nil
+	}
+
+	epoch, value, ok := strings.Cut(cursor, ".")
+	seq, err := strconv.ParseInt(value, 10, 64)
+	if !ok || err != nil || epoch != f.epoch {
+		return 0, errCursorExpired
+	}
+	return seq, nil
+}
+
+// since returns the changes after seq, the channel that is closed on the
+// next change, and the cursor for the latest change.
+func (f *ChangeFeed) since(seq int64) ([]Change, <-chan struct{}, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if seq > f.seq {
+		return nil, nil, "", errCursorExpired
+	}
+	if seq < f.seq && (len(f.entries) == 0 || f.entries[0].seq > seq+1) {
+		return nil, nil, "", errCursorExpired
+	}
+	changes := []Change{}
+	for _, entry := range f.entries {
+		if entry.seq > seq {
+			changes = append(changes, entry)
+		}
+	}
+	return changes, f.changed, f.cursor(f.seq), nil
+}
+
+// wait blocks until there are changes after seq, the timeout passes, the
+// request is cancelled, or the server shuts down.
+func (f *ChangeFeed) wait(r *http.Request, seq int64, timeout time.Duration) ([]Change, string, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		changes, changed, cursor, err := f.since(seq)
+		if err != nil || len(changes) > 0 || timeout <= 0 {
+			return changes, cursor, err
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return changes, cursor, nil
+		case <-r.Context().Done():
+			return changes, cursor, nil
+		case <-f.closing:
+			return changes, cursor, nil
+		}
+	}
+}
+
+// changesHandler serves GET /api/incidents/changes?since=<cursor>&wait=25s,
+// a long-polling feed for clients behind proxies that break streaming. The
+// response holds the changes the caller may see and the cursor to pass next.
+func changesHandler(feed *ChangeFeed) http.HandlerFunc {
+	maxWait := envDuration("CHANGE_FEED_MAX_WAIT", time.Minute)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		timeout := 25 * time.Second
+		if value := r.URL.Query().Get("wait"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				seconds, convErr := strconv.Atoi(value)
+				if convErr != nil {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": "wait must be a duration or seconds"})
+					return
+				}
+				parsed = time.Duration(seconds) * time.Second
+			}
+			timeout = parsed
+		}
+		if timeout > maxWait {
+			timeout = maxWait
+		}
+		// The wait would otherwise count against the write timeout.
+		clearWriteDeadline(w)
+
+		seq, err := feed.parseCursor(r.URL.Query().Get("since"))
+		var changes []Change
+		var cursor string
+		if err == nil {
+			changes, cursor, err = feed.wait(r, seq, timeout)
+		}
+		if err != nil {
+			// The client has to resync from a full list and continue from
+			// the current cursor.
+			writeJSON(w, http.StatusGone, map[string]string{"error": err.Error(), "cursor": feed.current()})
+			return
+		}
+
+		visible := make([]Change, 0, len(changes))
+		for _, change := range changes {
+			if canView(r, change.Incident) {
+				visible = append(visible, change)
+			}
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, map[string]any{"items": visible, "cursor": cursor})
+	}
+}
+
+func (f *ChangeFeed) current() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cursor(f.seq)
+}
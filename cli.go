@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// command is one subcommand of the server binary.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "Run the server; the default when no command is given", serveCommand},
+	{"seed", "Run the server with the demo scenario loaded", seedCommand},
+	{"export", "Download an incident export from a running server", exportCommand},
+	{"create-apikey", "Issue an API key into API_KEYS_FILE, e.g. for the first admin", createAPIKeyCommand},
+}
+
+// runCommand runs the command args name, or serve when they start with a
+// flag or are empty, and returns the exit code.
+func runCommand(args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printCommands(os.Stdout)
+		return 0
+	}
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(args)
+		switch {
+		case err == nil, errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printCommands(os.Stderr)
+	return 2
+}
+
+// errUsage is a command line the flag package has already complained
+// about.
+var errUsage = errors.New("usage")
+
+func printCommands(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [command] [flags]\n\nCommands:\n", binaryName())
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun %s <command> -h for a command's flags.\n", binaryName())
+}
+
+func binaryName() string {
+	if len(os.Args) == 0 {
+		return "web-app"
+	}
+	name := os.Args[0]
+	return name[strings.LastIndexAny(name, `/\`)+1:]
+}
+
+// commandFlags is a command's flag set, with the -config flag every
+// command takes since they all read settings.
+func commandFlags(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [flags]\n\nFlags:\n", binaryName(), name)
+		flags.PrintDefaults()
+	}
+	config := flags.String("config", "", "config `file` to read settings from, overriding CONFIG_FILE")
+	return flags, config
+}
+
+// parseCommandFlags parses args, turning the flags that stand for settings
+// into environment variables so they win over both the environment and the
+// config file.
+func parseCommandFlags(flags *flag.FlagSet, args []string, settings map[string]*string) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "unexpected arguments: %s\n", strings.Join(flags.Args(), " "))
+		flags.Usage()
+		return errUsage
+	}
+	for key, value := range settings {
+		if *value != "" {
+			os.Setenv(key, *value)
+		}
+	}
+	return nil
+}
+
+func serveCommand(args []string) error {
+	flags, config := commandFlags("serve")
+	port := flags.String("port", "", "`port` to listen on, overriding PORT")
+	demo := flags.Bool("demo", false, "seed sample incidents and alerts, as DEMO_MODE=true does")
+	if err := parseCommandFlags(flags, args, map[string]*string{"CONFIG_FILE": config, "PORT": port}); err != nil {
+		return err
+	}
+	if *demo {
+		os.Setenv("DEMO_MODE", "true")
+	}
+	runServer()
+	return nil
+}
+
+// seedCommand runs the server seeded with the demo scenario, as serve -demo
+// does. Data is kept in memory, so there is nothing to seed without a
+// server to hold it.
+func seedCommand(args []string) error {
+	flags, config := commandFlags("seed")
+	port := flags.String("port", "", "`port` to listen on, overriding PORT")
+	if err := parseCommandFlags(flags, args, map[string]*string{"CONFIG_FILE": config, "PORT": port}); err != nil {
+		return err
+	}
+	os.Setenv("DEMO_MODE", "true")
+	runServer()
+	return nil
+}
+
+// exportCommand downloads an export from GET /api/incidents/export on a
+// running server, which is where the incidents live, authenticating with an
+// API key. It writes to stdout unless -output names a file.
+func exportCommand(args []string) error {
+	flags, config := commandFlags("export")
+	server := flags.String("url", "", "`URL` of the running server (default http://localhost:PORT)")
+	key := flags.String("api-key", os.Getenv("SOC_API_KEY"), "API `key` to authenticate with (default SOC_API_KEY)")
+	tenant := flags.String("tenant", os.Getenv("SOC_TENANT"), "`tenant` to export, on multi-tenant servers")
+	columns := flags.String("columns", "", "comma-separated `columns` to export (default "+strings.Join(defaultExportColumns, ",")+")")
+	query := flags.String("query", "", "`query` the incidents must match, e.g. status:open")
+	format := flags.String("format", exportCSV, "`format`: csv or json")
+	anonymize := flags.Bool("anonymize", false, "pseudonymize users, hosts, IPs, domains, hashes, and titles")
+	output := flags.String("output", "", "`file` to write the export to (default stdout)")
+	if err := parseCommandFlags(flags, args, map[string]*string{"CONFIG_FILE": config}); err != nil {
+		return err
+	}
+	spec := ExportSpec{Columns: strings.Split(*columns, ","), Query: *query, Format: *format}
+	if err := spec.normalize(); err != nil {
+		return err
+	}
+
+	params := url.Values{"columns": {strings.Join(spec.Columns, ",")}, "format": {spec.Format}}
+	if spec.Query != "" {
+		params.Set("query", spec.Query)
+	}
+	if *anonymize {
+		params.Set("anonymize", "true")
+	}
+	base := fallback(*server, "http://localhost:"+envString("PORT", "8080"))
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(base, "/")+"/api/incidents/export?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if *key != "" {
+		req.Header.Set("Authorization", "Bearer "+*key)
+	}
+	if *tenant != "" {
+		req.Header.Set(tenantHeader, *tenant)
+	}
+	resp, err := (&http.Client{Timeout: 5 * time.Minute}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&failure)
+		return fmt.Errorf("server answered %s: %s", resp.Status, fallback(failure.Error, "no details"))
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		return err
+	}
+	if *output == "" {
+		return nil
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported to %s\n", *output)
+	return nil
+}
+
+// createAPIKeyCommand issues a key without a running server, which is how
+// the first admin gets in when nothing else authenticates them. The key is
+// appended to API_KEYS_FILE, which the server loads at startup, and its
+// secret printed once.
+func createAPIKeyCommand(args []string) error {
+	flags, config := commandFlags("create-apikey")
+	file := flags.String("file", "", "API keys `file` to append to, overriding API_KEYS_FILE")
+	name := flags.String("name", "", "what the key is for, e.g. deploy (required)")
+	user := flags.String("user", "", "user `ID` the key acts as (required)")
+	scopes := flags.String("scopes", "", "comma-separated `scopes`: admin, or <resource>:read|write such as incidents:read or *:write (required)")
+	tenant := flags.String("tenant", "", "`tenant` to bind the key to")
+	expires := flags.Duration("expires", 0, "how long until the key expires, e.g. 720h (default never)")
+	if err := parseCommandFlags(flags, args, map[string]*string{"CONFIG_FILE": config, "API_KEYS_FILE": file}); err != nil {
+		return err
+	}
+	path := envString("API_KEYS_FILE", "")
+	if path == "" {
+		return errors.New("set -file or API_KEYS_FILE to say where the server will find the key")
+	}
+	if strings.TrimSpace(*user) == "" {
+		return errors.New("-user is required")
+	}
+
+	now := time.Now().UTC()
+	input := APIKeyInput{Name: *name, UserID: *user, Scopes: strings.Split(*scopes, ","), Tenant: *tenant}
+	if *expires > 0 {
+		expiresAt := now.Add(*expires)
+		input.ExpiresAt = &expiresAt
+	}
+	key, secret, err := newAPIKey(input, "create-apikey", now)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(apiKeyFileEntry{
+		Name:      key.Name,
+		UserID:    key.UserID,
+		Scopes:    key.Scopes,
+		Tenant:    key.Tenant,
+		KeyPrefix: key.KeyPrefix,
+		KeyHash:   key.keyHash,
+		CreatedBy: key.CreatedBy,
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(append(line, '\n')); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Added %q for %s to %s; the server accepts it from its next start.\nThe key is shown only this once:\n", key.Name, key.UserID, path)
+	fmt.Println(secret)
+	return nil
+}
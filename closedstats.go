@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type PhaseDuration struct {
+	Status  string `json:"status"`
+	Seconds int64  `json:"seconds"`
+}
+
+// ClosedStats is frozen when an incident closes so historical metrics don't
+// shift when notes, tasks, or IOCs are edited afterwards.
+type ClosedStats struct {
+	ClosedAt        time.Time       `json:"closedAt"`
+	DurationSeconds int64           `json:"durationSeconds"`
+	Phases          []PhaseDuration `json:"phases"`
+	Responders      []string        `json:"responders"`
+	IOCCount        int             `json:"iocCount"`
+	NoteCount       int             `json:"noteCount"`
+	TaskCount       int             `json:"taskCount"`
+	ActionCount     int             `json:"actionCount"`
+	KillChainPhase  string          `json:"killChainPhase,omitempty"`
+}
+
+// buildClosedStats summarizes an incident that has just closed at closedAt.
+// Phase durations come from the status history, in first-entered order; a
+// status entered more than once accumulates.
+func buildClosedStats(incident *Incident, closedAt time.Time) *ClosedStats {
+	stats := &ClosedStats{
+		ClosedAt:        closedAt,
+		DurationSeconds: int64(closedAt.Sub(incident.CreatedAt) / time.Second),
+		Phases:          []PhaseDuration{},
+		IOCCount:        len(incident.IOCs),
+		NoteCount:       len(incident.Notes),
+		TaskCount:       len(incident.Tasks),
+		KillChainPhase:  incident.KillChainPhase,
+	}
+
+	var statuses []FieldChange
+	for _, change := range incident.history {
+		if change.Field == "status" {
+			statuses = append(statuses, change)
+		}
+	}
+	phaseIndex := map[string]int{}
+	for i, change := range statuses {
+		if isClosedStatus(change.Value) {
+			continue
+		}
+		end := closedAt
+		if i+1 < len(statuses) {
+			end = statuses[i+1].At
+		}
+		index, ok := phaseIndex[change.Value]
+		if !ok {
+			index = len(stats.Phases)
+			phaseIndex[change.Value] = index
+			stats.Phases = append(stats.Phases, PhaseDuration{Status: change.Value})
+		}
+		stats.Phases[index].Seconds += int64(end.Sub(change.At) / time.Second)
+	}
+
+	responders := map[string]bool{}
+	addResponder := func(name string) {
+		name = strings.TrimSpace(name)
+		if name != "" && !strings.EqualFold(name, "Unassigned") {
+			responders[name] = true
+		}
+	}
+	fieldChanges := 0
+	for _, change := range incident.history {
+		if change.Field == "owner" {
+			addResponder(change.Value)
+		}
+		if !change.At.Equal(incident.CreatedAt) {
+			fieldChanges++
+		}
+	}
+	for _, note := range incident.Notes {
+		if note.AuthorType == "" {
+			addResponder(note.Author)
+		}
+	}
+	for _, task := range incident.Tasks {
+		addResponder(task.Assignee)
+	}
+	for name := range responders {
+		stats.Responders = append(stats.Responders, name)
+	}
+	sort.Strings(stats.Responders)
+	if stats.Responders == nil {
+		stats.Responders = []string{}
+	}
+
+	stats.ActionCount = len(incident.Notes) + len(incident.Tasks) + fieldChanges
+	return stats
+}
@@ -0,0 +1,403 @@
+// Command socctl is a command line client for the incident tracker API, for
+// analysts who work from a terminal. It talks to the server at SOC_URL and
+// authenticates with the API key in SOC_API_KEY.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// command is one subcommand, named by one or two words.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(cmd command, args []string) error
+}
+
+var commands = []command{
+	{"incidents list", "", "List the incidents you can see, newest first", incidentsList},
+	{"incidents get", "<id>", "Show an incident and its notes", incidentsGet},
+	{"note add", "<id> <body|->", "Add a note to an incident; - reads the body from stdin", noteAdd},
+	{"export", "", "Export incidents as CSV or JSON", export},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the command args name and returns the exit code.
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printCommands(os.Stdout)
+		return 0
+	}
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) || strings.Join(args[:len(words)], " ") != cmd.name {
+			continue
+		}
+		err := cmd.run(cmd, args[len(words):])
+		switch {
+		case err == nil, errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		}
+		fmt.Fprintf(os.Stderr, "socctl %s: %v\n", cmd.name, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", strings.Join(args, " "))
+	printCommands(os.Stderr)
+	return 2
+}
+
+// errUsage is a command line the flag package has already complained
+// about.
+var errUsage = errors.New("usage")
+
+func printCommands(w io.Writer) {
+	fmt.Fprintf(w, "Usage: socctl <command> [flags] [args]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-28s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.summary)
+	}
+	fmt.Fprintf(w, "\nEnvironment:\n  SOC_URL      server to talk to (default http://localhost:8080)\n  SOC_API_KEY  API key to authenticate with\n  SOC_TENANT   tenant to act in, on multi-tenant servers\n")
+	fmt.Fprintf(w, "\nRun socctl <command> -h for a command's flags.\n")
+}
+
+// commandFlags is a command's flag set, with the -url flag every command
+// takes.
+func commandFlags(cmd command) (*flag.FlagSet, *client) {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: socctl %s [flags] %s\n\n%s.\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		flags.PrintDefaults()
+	}
+	c := &client{
+		key:    os.Getenv("SOC_API_KEY"),
+		tenant: os.Getenv("SOC_TENANT"),
+		http:   &http.Client{Timeout: 2 * time.Minute},
+	}
+	flags.StringVar(&c.base, "url", fallback(os.Getenv("SOC_URL"), "http://localhost:8080"), "server `URL`, overriding SOC_URL")
+	return flags, c
+}
+
+// outputFlag adds -o to commands that print a response.
+func outputFlag(flags *flag.FlagSet) *string {
+	return flags.String("o", "table", "output `format`: table or json")
+}
+
+// parseFlags parses args and checks they leave exactly want positional
+// arguments.
+func parseFlags(flags *flag.FlagSet, args []string, want int, output *string) ([]string, error) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errUsage
+	}
+	if output != nil && *output != "table" && *output != "json" {
+		fmt.Fprintf(flags.Output(), "-o must be table or json, not %q\n", *output)
+		return nil, errUsage
+	}
+	if flags.NArg() != want {
+		fmt.Fprintf(flags.Output(), "want %d arguments, got %d\n", want, flags.NArg())
+		flags.Usage()
+		return nil, errUsage
+	}
+	return flags.Args(), nil
+}
+
+func incidentsList(cmd command, args []string) error {
+	flags, c := commandFlags(cmd)
+	output := outputFlag(flags)
+	query := url.Values{}
+	params := map[string]*string{
+		"severity":       flags.String("severity", "", "only incidents of this `severity`"),
+		"status":         flags.String("status", "", "only incidents in this `status`"),
+		"q":              flags.String("search", "", "free-text `search` over titles, tags, and IOCs"),
+		"query":          flags.String("query", "", "query language `filter`, e.g. \"tag:phishing created>=now-7d\""),
+		"team":           flags.String("team", "", "only incidents owned by `team` or its members"),
+		"sort":           flags.String("sort", "", "sort by risk, sla, or age instead of newest first"),
+		"killChainPhase": flags.String("phase", "", "only this kill chain `phase`"),
+	}
+	limit := flags.Int("limit", 0, "at most `n` incidents (default the server's page size)")
+	offset := flags.Int("offset", 0, "skip the first `n` incidents")
+	all := flags.Bool("all", false, "include closed incidents")
+	if _, err := parseFlags(flags, args, 0, output); err != nil {
+		return err
+	}
+	for name, value := range params {
+		if *value != "" {
+			query.Set(name, *value)
+		}
+	}
+	if *limit > 0 {
+		query.Set("limit", strconv.Itoa(*limit))
+	}
+	if *offset > 0 {
+		query.Set("offset", strconv.Itoa(*offset))
+	}
+	if *all {
+		query.Set("includeClosed", "true")
+	}
+
+	body, err := c.call(http.MethodGet, "/api/incidents", query, nil)
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		return printJSON(body)
+	}
+	var page struct {
+		Items []incident `json:"items"`
+		Total int        `json:"total"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tSEVERITY\tSTATUS\tOWNER\tCREATED\tTITLE")
+	for _, item := range page.Items {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", item.ID, item.Severity, item.Status, item.Owner, item.CreatedAt.Local().Format("2006-01-02 15:04"), item.Title)
+	}
+	table.Flush()
+	if len(page.Items) < page.Total {
+		fmt.Fprintf(os.Stderr, "%d of %d incidents; use -limit and -offset for more\n", len(page.Items), page.Total)
+	}
+	return nil
+}
+
+func incidentsGet(cmd command, args []string) error {
+	flags, c := commandFlags(cmd)
+	output := outputFlag(flags)
+	args, err := parseFlags(flags, args, 1, output)
+	if err != nil {
+		return err
+	}
+	body, err := c.call(http.MethodGet, "/api/incidents/"+url.PathEscape(args[0]), nil, nil)
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		return printJSON(body)
+	}
+	var item incident
+	if err := json.Unmarshal(body, &item); err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, field := range [][2]string{
+		{"ID", item.ID},
+		{"Title", item.Title},
+		{"Severity", item.Severity},
+		{"Status", item.Status},
+		{"Owner", item.Owner},
+		{"Tags", strings.Join(item.Tags, ", ")},
+		{"IOCs", strings.Join(item.IOCs, ", ")},
+		{"Created", item.CreatedAt.Local().Format(time.RFC1123)},
+		{"Updated", item.UpdatedAt.Local().Format(time.RFC1123)},
+	} {
+		fmt.Fprintf(table, "%s:\t%s\n", field[0], field[1])
+	}
+	table.Flush()
+	if len(item.Notes) > 0 {
+		fmt.Println("\nNotes:")
+	}
+	for _, note := range item.Notes {
+		fmt.Printf("\n%s  %s  %s\n%s\n", note.ID, note.CreatedAt.Local().Format("2006-01-02 15:04"), note.Author, indent(note.Body))
+	}
+	return nil
+}
+
+func noteAdd(cmd command, args []string) error {
+	flags, c := commandFlags(cmd)
+	output := outputFlag(flags)
+	kind := flags.String("kind", "", "note `kind`, e.g. finding or action")
+	parent := flags.String("reply-to", "", "`note ID` this note replies to")
+	args, err := parseFlags(flags, args, 2, output)
+	if err != nil {
+		return err
+	}
+	text := args[1]
+	if text == "-" {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		text = string(input)
+	}
+	if strings.TrimSpace(text) == "" {
+		return errors.New("the note is empty")
+	}
+	body, err := c.call(http.MethodPost, "/api/incidents/"+url.PathEscape(args[0])+"/notes", nil, map[string]string{"body": text, "kind": *kind, "parentNoteId": *parent})
+	if err != nil {
+		return err
+	}
+	var item struct {
+		ID    string            `json:"id"`
+		Notes []json.RawMessage `json:"notes"`
+	}
+	if err := json.Unmarshal(body, &item); err != nil {
+		return err
+	}
+	if len(item.Notes) == 0 {
+		return errors.New("the server didn't return the note")
+	}
+	// Notes are newest first.
+	added := item.Notes[0]
+	if *output == "json" {
+		return printJSON(added)
+	}
+	var written note
+	if err := json.Unmarshal(added, &written); err != nil {
+		return err
+	}
+	fmt.Printf("Added %s to %s\n", written.ID, item.ID)
+	return nil
+}
+
+func export(cmd command, args []string) error {
+	flags, c := commandFlags(cmd)
+	format := flags.String("format", "csv", "csv or json")
+	query := flags.String("query", "", "query language `filter` for the incidents to export")
+	columns := flags.String("columns", "", "comma-separated `columns` (default the server's)")
+	anonymize := flags.Bool("anonymize", false, "replace people, hosts, and indicators with stand-ins")
+	out := flags.String("out", "", "write to `file` instead of stdout")
+	if _, err := parseFlags(flags, args, 0, nil); err != nil {
+		return err
+	}
+	params := url.Values{"format": {*format}}
+	if *query != "" {
+		params.Set("query", *query)
+	}
+	if *columns != "" {
+		params.Set("columns", *columns)
+	}
+	if *anonymize {
+		params.Set("anonymize", "true")
+	}
+	body, err := c.call(http.MethodGet, "/api/incidents/export", params, nil)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(body)
+		return err
+	}
+	return os.WriteFile(*out, body, 0o600)
+}
+
+// incident and note are the response fields the table output shows; JSON
+// output prints the server's response as it is.
+type incident struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Severity  string    `json:"severity"`
+	Status    string    `json:"status"`
+	Owner     string    `json:"owner"`
+	Tags      []string  `json:"tags"`
+	IOCs      []string  `json:"iocs"`
+	Notes     []note    `json:"notes"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type note struct {
+	ID        string    `json:"id"`
+	Body      string    `json:"body"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type client struct {
+	base   string
+	key    string
+	tenant string
+	http   *http.Client
+}
+
+// call makes a request and returns the response body, or the server's
+// error message for anything but a 2xx.
+func (c *client) call(method, path string, query url.Values, input any) ([]byte, error) {
+	target := strings.TrimRight(c.base, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var body io.Reader
+	if input != nil {
+		payload, err := json.Marshal(input)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payload)
+	}
+	request, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if input != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.key != "" {
+		request.Header.Set("Authorization", "Bearer "+c.key)
+	}
+	if c.tenant != "" {
+		request.Header.Set("X-Tenant", c.tenant)
+	}
+	request.Header.Set("User-Agent", "socctl")
+	response, err := c.http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	payload, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode/100 != 2 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(payload, &failure)
+		message := fallback(failure.Error, http.StatusText(response.StatusCode))
+		if response.StatusCode == http.StatusUnauthorized && c.key == "" {
+			message += "; set SOC_API_KEY"
+		}
+		return nil, fmt.Errorf("%d: %s", response.StatusCode, message)
+	}
+	return payload, nil
+}
+
+func printJSON(body []byte) error {
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(os.Stdout)
+	return err
+}
+
+func indent(text string) string {
+	return "  " + strings.ReplaceAll(strings.TrimRight(text, "\n"), "\n", "\n  ")
+}
+
+func fallback(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// configEntry is one setting from the config file, under the key it was
+// written as so errors can point at the line to fix.
+type configEntry struct {
+	key   string
+	value string
+	used  bool
+}
+
+// ConfigFile holds the settings read from CONFIG_FILE by the environment
+// variable each one stands for, so every setting the server reads from the
+// environment can be set in the file too. Variables that are set win over
+// the file.
+type ConfigFile struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]*configEntry
+}
+
+// fileConfig is loaded when the first setting is read, which is after the
+// command line has had its say about CONFIG_FILE.
+var fileConfig = sync.OnceValue(func() *ConfigFile {
+	return loadConfigFile(os.Getenv("CONFIG_FILE"))
+})
+
+// loadConfigFile reads a YAML or TOML config file, by its extension, and
+// exits naming the problem if it can't. Nested keys are joined with
+// underscores into variable names, so tls: {cert_file: ...} sets
+// TLS_CERT_FILE, and lists become comma-separated values.
+func loadConfigFile(path string) *ConfigFile {
+	config := &ConfigFile{path: strings.TrimSpace(path), entries: map[string]*configEntry{}}
+	if config.path == "" {
+		return config
+	}
+	source, err := os.ReadFile(config.path)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	var document any
+	switch ext := strings.ToLower(filepath.Ext(config.path)); ext {
+	case ".yaml", ".yml":
+		document, err = parseYAML(string(source))
+	case ".toml":
+		document, err = parseTOML(string(source))
+	default:
+		err = fmt.Errorf("want a .yaml, .yml, or .toml file, not %q", ext)
+	}
+	if err != nil {
+		log.Fatalf("config: %s: %v", config.path, err)
+	}
+	if document == nil {
+		return config
+	}
+	root, ok := document.(map[string]any)
+	if !ok {
+		log.Fatalf("config: %s: want a mapping of settings at the top level", config.path)
+	}
+	if err := config.flatten("", root); err != nil {
+		log.Fatalf("config: %s: %v", config.path, err)
+	}
+	return config
+}
+
+func (c *ConfigFile) flatten(prefix string, values map[string]any) error {
+	for _, name := range sortedKeys(values, func(a, b string) bool { return a < b }) {
+		key := strings.TrimSpace(name)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		var value string
+		switch v := values[name].(type) {
+		case map[string]any:
+			if err := c.flatten(key, v); err != nil {
+				return err
+			}
+			continue
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				text, ok := item.(string)
+				if !ok {
+					return fmt.Errorf("%s: list items must be plain values", key)
+				}
+				items = append(items, text)
+			}
+			value = strings.Join(items, ",")
+		case string:
+			value = v
+		case nil:
+			// Left empty, as if it were unset.
+		default:
+			return fmt.Errorf("%s: unsupported value %v", key, v)
+		}
+		env := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+		if previous, ok := c.entries[env]; ok {
+			return fmt.Errorf("%s and %s both set %s", previous.key, key, env)
+		}
+		c.entries[env] = &configEntry{key: key, value: strings.TrimSpace(value)}
+	}
+	return nil
+}
+
+// lookup returns the file's value for an environment variable and the key
+// it was set under.
+func (c *ConfigFile) lookup(env string) (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[env]
+	if !ok {
+		return "", ""
+	}
+	entry.used = true
+	return entry.value, entry.key
+}
+
+// warnUnused logs the keys nothing has read once the server is set up,
+// which are usually misspelled or belong to a feature that isn't on.
+func (c *ConfigFile) warnUnused() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var unused []string
+	for _, entry := range c.entries {
+		if !entry.used {
+			unused = append(unused, entry.key)
+		}
+	}
+	slices.Sort(unused)
+	for _, key := range unused {
+		log.Printf("config: %s: %s is not a setting this server uses; check its spelling and that its feature is enabled", c.path, key)
+	}
+}
+
+// configValue reads a setting from the environment, or else the config
+// file, in which case it also returns the file key so a bad value can be
+// reported against it.
+func configValue(key string) (string, string) {
+	fileValue, fileKey := fileConfig().lookup(key)
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value, ""
+	}
+	return fileValue, fileKey
+}
+
+// invalidConfig reports a value that doesn't parse. A bad variable falls
+// back to the default, as it always has, but a bad file entry stops
+// startup, since the file is checked in and should be fixed there.
+func invalidConfig(key, fileKey, value, want string, def any) {
+	if fileKey != "" {
+		log.Fatalf("config: %s: %s: %q is not %s", fileConfig().path, fileKey, value, want)
+	}
+	log.Printf("config: %s=%q is not %s, using %v", key, value, want, def)
+}
+
+func envString(key, def string) string {
+	value, _ := configValue(key)
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+func envInt(key string, def int) int {
+	value, fileKey := configValue(key)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		invalidConfig(key, fileKey, value, "an integer", def)
+		return def
+	}
+	return parsed
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	value, fileKey := configValue(key)
+	if value == "" {
+		return def
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		invalidConfig(key, fileKey, value, "a duration", def)
+		return def
+	}
+	return parsed
+}
+
+func envBool(key string, def bool) bool {
+	value, fileKey := configValue(key)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		invalidConfig(key, fileKey, value, "a boolean", def)
+		return def
+	}
+	return parsed
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// IncidentAlert is one constituent alert of an incident. Exact repeats of an
+// alert (same dedupe key) fold into a single entry and bump Count.
+type IncidentAlert struct {
+	ID           string    `json:"id"`
+	Source       string    `json:"source"`
+	Title        string    `json:"title"`
+	Severity     string    `json:"severity"`
+	IOCs         []string  `json:"iocs"`
+	Hosts        []string  `json:"hosts,omitempty"`
+	Users        []string  `json:"users,omitempty"`
+	CorrelatedOn []string  `json:"correlatedOn,omitempty"`
+	Count        int       `json:"count"`
+	FirstSeen    time.Time `json:"firstSeen"`
+	LastSeen     time.Time `json:"lastSeen"`
+
+	key string
+}
+
+const (
+	correlateIOC  = "ioc"
+	correlateHost = "host"
+	correlateUser = "user"
+)
+
+// severityRank is the configured rank of severity, or 0 when it isn't one
+// of the configured levels.
+func severityRank(severity string) int {
+	level, _ := currentTaxonomies().severity(normalizeSeverity(severity))
+	return level.Rank
+}
+
+// incidentAlert summarizes an alert for the incident's alerts collection.
+func (m AlertMapping) incidentAlert(alert map[string]any, input IncidentInput, key string, at time.Time) IncidentAlert {
+	record := IncidentAlert{
+		Source:    m.Source,
+		Title:     input.Title,
+		Severity:  input.Severity,
+		IOCs:      input.IOCs,
+		Count:     1,
+		FirstSeen: at,
+		LastSeen:  at,
+		key:       key,
+	}
+	for _, field := range m.HostFields {
+		record.Hosts = append(record.Hosts, alertValues(alert, field)...)
+	}
+	for _, field := range m.UserFields {
+		record.Users = append(record.Users, alertValues(alert, field)...)
+	}
+	record.Hosts = dedupeStrings(record.Hosts)
+	record.Users = dedupeStrings(record.Users)
+	return record
+}
+
+// correlationKeys lists the keys an alert can be grouped on, limited to the
+// kinds enabled in ALERT_CORRELATION_KEYS.
+func (a *AlertIngester) correlationKeys(record IncidentAlert) []string {
+	keys := []string{}
+	add := func(kind string, values []string) {
+		if !a.correlateOn[kind] {
+			return
+		}
+		for _, value := range values {
+			if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+				keys = append(keys, kind+":"+value)
+			}
+		}
+	}
+	add(correlateIOC, record.IOCs)
+	add(correlateHost, record.Hosts)
+	add(correlateUser, record.Users)
+	return keys
+}
+
+// correlate finds the open incident that most recently saw an alert sharing
+// a key, within the correlation window. Callers must hold a.mu.
+func (a *AlertIngester) correlate(tenant string, keys []string, now time.Time) (string, []string) {
+	if a.correlationWindow <= 0 {
+		return "", nil
+	}
+	var best alertGroup
+	for _, key := range keys {
+		group, ok := a.correlations[tenantScoped(tenant, key)]
+		if ok && now.Sub(group.lastSeen) <= a.correlationWindow && group.lastSeen.After(best.lastSeen) {
+			best = group
+		}
+	}
+	if best.incidentID == "" {
+		return "", nil
+	}
+	var on []string
+	for _, key := range keys {
+		if group, ok := a.correlations[tenantScoped(tenant, key)]; ok && group.incidentID == best.incidentID && now.Sub(group.lastSeen) <= a.correlationWindow {
+			on = append(on, key)
+		}
+	}
+	return best.incidentID, on
+}
+
+// remember points the alert's dedupe and correlation keys at the incident
+// it landed in. Keys are kept per tenant, so one customer's alerts never
+// fold into another's incidents. Callers must hold a.mu.
+func (a *AlertIngester) remember(tenant, incidentID, key string, keys []string, now time.Time) {
+	a.groups[tenantScoped(tenant, key)] = alertGroup{incidentID: incidentID, lastSeen: now}
+	for _, correlationKey := range keys {
+		a.correlations[tenantScoped(tenant, correlationKey)] = alertGroup{incidentID: incidentID, lastSeen: now}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for the CORS policy: the methods the API routes use, the
+// request headers clients authenticate and correlate with, and the
+// response headers worth reading from script.
+var (
+	corsDefaultMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	corsDefaultHeaders = []string{"Authorization", "Content-Type", csrfHeader, tenantHeader, requestIDHeader, idempotencyKeyHeader, "traceparent", "tracestate"}
+	corsDefaultExposed = []string{requestIDHeader, "X-Trace-Id", "Retry-After", "ETag", "Content-Disposition", idempotentReplayedHeader}
+)
+
+// CORSPolicy lets frontends on other origins call the API from the
+// browser. Requests from origins it doesn't allow are served without CORS
+// headers, so browsers keep their responses from the calling page.
+type CORSPolicy struct {
+	origins     map[string]bool
+	anyOrigin   bool
+	methods     []string
+	headers     []string
+	exposed     []string
+	credentials bool
+	maxAge      time.Duration
+}
+
+// newCORSPolicy reads CORS_ALLOWED_ORIGINS, returning nil when it is unset
+// and cross-origin requests should be left to the browser's defaults.
+func newCORSPolicy() *CORSPolicy {
+	policy := &CORSPolicy{
+		origins:     map[string]bool{},
+		methods:     corsList("CORS_ALLOWED_METHODS", slices.Clone(corsDefaultMethods)),
+		headers:     corsList("CORS_ALLOWED_HEADERS", corsDefaultHeaders),
+		exposed:     corsList("CORS_EXPOSED_HEADERS", corsDefaultExposed),
+		credentials: envBool("CORS_ALLOW_CREDENTIALS", false),
+		maxAge:      envDuration("CORS_MAX_AGE", 10*time.Minute),
+	}
+	for i, method := range policy.methods {
+		policy.methods[i] = strings.ToUpper(method)
+	}
+	for _, origin := range sanitizeSlice(strings.Split(envString("CORS_ALLOWED_ORIGINS", ""), ",")) {
+		if origin == "*" {
+			policy.anyOrigin = true
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || strings.Trim(parsed.Path, "/") != "" {
+			log.Printf("cors: ignoring origin %q: want scheme://host[:port], e.g. https://soc.example.com", origin)
+			continue
+		}
+		policy.origins[strings.ToLower(parsed.Scheme+"://"+parsed.Host)] = true
+	}
+	if !policy.anyOrigin && len(policy.origins) == 0 {
+		return nil
+	}
+	if policy.anyOrigin && policy.credentials {
+		// Any site could then act with a signed-in analyst's session.
+		log.Printf("cors: CORS_ALLOW_CREDENTIALS needs explicit origins, not *; not allowing credentials")
+		policy.credentials = false
+	}
+	return policy
+}
+
+func corsList(key string, def []string) []string {
+	if value := envString(key, ""); value != "" {
+		return sanitizeSlice(strings.Split(value, ","))
+	}
+	return def
+}
+
+func (p *CORSPolicy) allowsOrigin(origin string) bool {
+	return p.anyOrigin || p.origins[strings.ToLower(strings.TrimRight(origin, "/"))]
+}
+
+// allowsHeaders checks a preflight's Access-Control-Request-Headers,
+// returning the first header the policy doesn't allow.
+func (p *CORSPolicy) allowsHeaders(requested string) (string, bool) {
+	for _, header := range sanitizeSlice(strings.Split(requested, ",")) {
+		// Header names are case-insensitive.
+		if !slices.ContainsFunc(p.headers, func(allowed string) bool { return strings.EqualFold(allowed, header) }) {
+			return header, false
+		}
+	}
+	return "", true
+}
+
+// preflight answers the OPTIONS request a browser sends before a request
+// that isn't simple, such as a PUT, a DELETE, or one with a bearer token.
+func (p *CORSPolicy) preflight(w http.ResponseWriter, r *http.Request) {
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !slices.Contains(p.methods, strings.ToUpper(method)) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "method " + method + " is not allowed cross-origin"})
+		return
+	}
+	if header, ok := p.allowsHeaders(r.Header.Get("Access-Control-Request-Headers")); !ok {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "header " + header + " is not allowed cross-origin"})
+		return
+	}
+	h := w.Header()
+	h.Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+	if len(p.headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(p.headers, ", "))
+	}
+	if p.maxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withCORS applies the policy ahead of authentication, since browsers send
+// preflights without credentials, and ahead of rate limiting, so
+// preflights don't spend a client's requests.
+func withCORS(next http.Handler, policy *CORSPolicy) http.Handler {
+	if policy == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		// Responses differ by origin, so caches must keep them apart.
+		h.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if !policy.allowsOrigin(origin) {
+			if preflight {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "origin " + origin + " is not allowed"})
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if policy.anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if policy.credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if preflight {
+			policy.preflight(w, r)
+			return
+		}
+		if len(policy.exposed) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(policy.exposed, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// Tombstone records that an incident was deleted, so clients syncing with
+// updatedSince can drop their copy.
+type Tombstone struct {
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deletedAt"`
+
+	restricted bool
+}
+
+// IncidentDelta is the incident list filtered by updatedSince, with the
+// deletions since then. SyncedAt is the updatedSince to pass next time.
+type IncidentDelta struct {
+	IncidentPage
+	Deleted  []Tombstone `json:"deleted"`
+	SyncedAt time.Time   `json:"syncedAt"`
+}
+
+// addTombstone records a deletion and drops tombstones past retention,
+// moving the horizon deltas can be served from. Callers must hold s.mu.
+func (s *IncidentStore) addTombstone(incident *Incident, now time.Time) {
+	s.tombstones = append(s.tombstones, Tombstone{ID: incident.ID, DeletedAt: now, restricted: incident.Restricted})
+	cutoff := now.Add(-s.tombstoneRetention)
+	kept := 0
+	for kept < len(s.tombstones) && s.tombstones[kept].DeletedAt.Before(cutoff) {
+		kept++
+	}
+	if kept > 0 {
+		s.tombstones = append([]Tombstone{}, s.tombstones[kept:]...)
+		s.tombstoneHorizon = cutoff
+	}
+}
+
+// tombstonesSince returns deletions after since, or false when since is
+// older than the tombstones kept (or than this server run), in which case
+// a delta could miss deletions.
+func (s *IncidentStore) tombstonesSince(since time.Time) ([]Tombstone, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if since.Before(s.tombstoneHorizon) {
+		return nil, false
+	}
+	deleted := []Tombstone{}
+	for _, tombstone := range s.tombstones {
+		if tombstone.DeletedAt.After(since) {
+			deleted = append(deleted, tombstone)
+		}
+	}
+	return deleted, true
+}
+
+// parseUpdatedSince reads ?updatedSince=<RFC3339>. ok is false when the
+// response has been written.
+func parseUpdatedSince(w http.ResponseWriter, r *http.Request) (since time.Time, present, ok bool) {
+	value := r.URL.Query().Get("updatedSince")
+	if value == "" {
+		return time.Time{}, false, true
+	}
+	since, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "updatedSince must be an RFC 3339 timestamp"})
+		return time.Time{}, true, false
+	}
+	return since, true, true
+}
+
+// updatedAfter keeps the incidents modified after since and returns the
+// latest modification seen, which is where the next delta should start.
+// Using the data's own timestamps rather than the clock means a replica
+// that lags behind only delays changes instead of skipping them.
+func updatedAfter(items []Incident, since time.Time) ([]Incident, time.Time) {
+	watermark := since
+	changed := make([]Incident, 0, len(items))
+	for _, incident := range items {
+		if incident.UpdatedAt.After(watermark) {
+			watermark = incident.UpdatedAt
+		}
+		if incident.UpdatedAt.After(since) {
+			changed = append(changed, incident)
+		}
+	}
+	return changed, watermark
+}
+
+// incidentDelta answers a list request with updatedSince. Tombstones for
+// restricted cases are only shown to cleared callers, like the cases.
+func incidentDelta(w http.ResponseWriter, r *http.Request, store *IncidentStore, items []Incident, since time.Time, settings Settings) (IncidentDelta, bool) {
+	deleted, ok := store.tombstonesSince(since)
+	if !ok {
+		writeJSON(w, http.StatusGone, map[string]string{"error": "updatedSince is older than the deletions kept; reload the full list"})
+		return IncidentDelta{}, false
+	}
+	items, watermark := updatedAfter(items, since)
+	page, ok := applyListSettings(w, r, items, settings)
+	if !ok {
+		return IncidentDelta{}, false
+	}
+	cleared := callerCleared(r)
+	visible := make([]Tombstone, 0, len(deleted))
+	for _, tombstone := range deleted {
+		if watermark.Before(tombstone.DeletedAt) {
+			watermark = tombstone.DeletedAt
+		}
+		if !tombstone.restricted || cleared {
+			visible = append(visible, tombstone)
+		}
+	}
+	if page.Limit > 0 && page.Offset+len(page.Items) < page.Total {
+		// More pages to fetch: the next sync must not skip past them.
+		watermark = since
+	}
+	return IncidentDelta{IncidentPage: page, Deleted: visible, SyncedAt: watermark}, true
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Indicators the demo scenario is built around. They are documentation
+// addresses and made-up domains, so nothing real is looked up or blamed.
+const (
+	demoC2Address   = "203.0.113.66"
+	demoC2Domain    = "cdn-telemetry-sync.example"
+	demoDropperHash = "9f2b1c5e8d7a6f4e3b2a1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f"
+	demoPhishDomain = "payroll-portal-login.example"
+	demoSprayIP     = "198.51.100.23"
+)
+
+// demoEnricher answers lookups from canned results so the demo shows
+// enrichment without any API keys. It stands in for a real source by name.
+type demoEnricher struct {
+	source   string
+	fixtures map[string]map[string]any
+}
+
+func (d demoEnricher) name() string { return d.source }
+
+func (d demoEnricher) supports(ioc string) bool {
+	_, ok := d.fixtures[normalizeIOC(ioc)]
+	return ok
+}
+
+func (d demoEnricher) lookup(_ context.Context, ioc string) (map[string]any, error) {
+	data := map[string]any{"demo": true}
+	for key, value := range d.fixtures[normalizeIOC(ioc)] {
+		data[key] = value
+	}
+	return data, nil
+}
+
+// demoEnrichers are the fixture sources, shaped like the real enrichers'
+// results.
+func demoEnrichers() []Enricher {
+	return []Enricher{
+		demoEnricher{source: "abuseipdb", fixtures: map[string]map[string]any{
+			demoC2Address: {"abuseConfidenceScore": 92, "isp": "Example Hosting Ltd", "usageType": "Data Center/Web Hosting/Transit", "countryCode": "NL", "totalReports": 318, "isWhitelisted": false},
+			demoSprayIP:   {"abuseConfidenceScore": 64, "isp": "Example Broadband", "usageType": "Fixed Line ISP", "countryCode": "BR", "totalReports": 41, "isWhitelisted": false},
+		}},
+		demoEnricher{source: "geoip", fixtures: map[string]map[string]any{
+			demoC2Address: {"country": "NL", "countryName": "Netherlands", "city": "Amsterdam", "latitude": 52.37, "longitude": 4.89, "asn": 64501, "asOrg": "EXAMPLE-HOSTING"},
+			demoSprayIP:   {"country": "BR", "countryName": "Brazil", "city": "São Paulo", "latitude": -23.55, "longitude": -46.63, "asn": 64502, "asOrg": "EXAMPLE-BROADBAND"},
+		}},
+		demoEnricher{source: "whois", fixtures: map[string]map[string]any{
+			demoC2Domain:    {"domain": demoC2Domain, "status": []string{"active"}, "registeredAt": "2026-09-30T04:12:00Z", "nameservers": []string{"ns1.example", "ns2.example"}},
+			demoPhishDomain: {"domain": demoPhishDomain, "status": []string{"clientHold"}, "registeredAt": "2026-10-09T22:41:00Z", "nameservers": []string{"ns1.example"}},
+		}},
+	}
+}
+
+// DemoStep is one stop on the guided tour of the seeded scenario.
+type DemoStep struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+type DemoGuide struct {
+	Scenario string     `json:"scenario"`
+	Steps    []DemoStep `json:"steps"`
+}
+
+type demoDeps struct {
+	store      *IncidentStore
+	alerts     *AlertIngester
+	mappings   *AlertMappingStore
+	watchlists *WatchlistStore
+	autoTags   *AutoTagStore
+	routing    *RoutingStore
+	evidence   *EvidenceStore
+	enrichment *EnrichmentService
+}
+
+// seedDemo loads a curated scenario through the same code paths real
+// traffic uses: a major intrusion in progress with its timeline, tasks, and
+// evidence, and fresh alerts waiting for triage. It returns the guide
+// served at /api/demo.
+func seedDemo(deps demoDeps) DemoGuide {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	deps.watchlists.create(WatchlistInput{
+		Name:        "Known C2 infrastructure",
+		Description: "Demo: command-and-control hosts from last quarter's intrusion",
+		Indicators:  []string{demoC2Address, demoC2Domain},
+	})
+	deps.store.reannotate()
+	if _, err := deps.autoTags.create(AutoTagRuleInput{Name: "Okta", Pattern: "okta", Tags: []string{"identity"}}); err != nil {
+		log.Printf("demo: auto-tag rule: %v", err)
+	}
+	if _, err := deps.routing.replace(RoutingConfig{
+		Playbooks: map[string][]string{
+			"phishing": {"Pull message headers", "Search for other recipients", "Purge from mailboxes", "Block sender domain"},
+			"identity": {"Confirm with the user out of band", "Reset credentials and revoke sessions"},
+		},
+		Rules: []RoutingRule{
+			{Name: "phishing", Tags: []string{"phishing"}, Playbooks: []string{"phishing"}, Team: "Email Security"},
+			{Name: "identity", Tags: []string{"identity"}, Playbooks: []string{"identity"}, Team: "IAM"},
+		},
+	}, "demo"); err != nil {
+		log.Printf("demo: routing: %v", err)
+	}
+
+	major := deps.store.create(IncidentInput{
+		Title:          "Ransomware staging on finance file servers",
+		Severity:       "Critical",
+		Status:         "New",
+		Tags:           []string{"ransomware", "endpoint", "host:fin-fs-02"},
+		IOCs:           []string{demoC2Address, demoC2Domain, demoDropperHash},
+		KillChainPhase: "installation",
+		Source:         "demo",
+	})
+	isMajor := true
+	if _, err := deps.store.update(major.ID, IncidentUpdate{Status: "Investigating", Owner: "IR Lead", Major: &isMajor}); err != nil {
+		log.Printf("demo: major incident: %v", err)
+	}
+	for _, note := range []NoteInput{
+		{Author: "EDR", AuthorType: authorTypeAutomation, Body: "Unsigned binary svc-update.exe written to C:\\ProgramData on fin-fs-02, beaconing to " + demoC2Domain + "."},
+		{Author: "Dana (SOC Tier 2)", Body: "Confirmed beacon every 60s to " + demoC2Address + ". Same C2 as last quarter's intrusion; escalating to IR."},
+		{Author: "IR Lead", Body: "Declared major. fin-fs-02 isolated from the network; fin-fs-01 and fin-fs-03 under watch."},
+		{Author: "IR Lead", Kind: noteKindSitrep, Body: "Sitrep: one server isolated, no encryption observed yet. Next: sweep finance segment for the dropper hash, rotate service account credentials."},
+	} {
+		if _, err := deps.store.addNote(major.ID, note); err != nil {
+			log.Printf("demo: note: %v", err)
+		}
+	}
+	for _, task := range []TaskInput{
+		{Title: "Sweep finance segment for the dropper hash", Assignee: "SOC Tier 2"},
+		{Title: "Rotate svc_backup credentials", Assignee: "IAM"},
+		{Title: "Confirm backups of fin-fs-02 are intact", Assignee: "Infrastructure"},
+	} {
+		if _, err := deps.store.addTask(major.ID, task); err != nil {
+			log.Printf("demo: task: %v", err)
+		}
+	}
+	collectedAt := now.Add(-20 * time.Minute)
+	if _, err := deps.evidence.register(major.ID, EvidenceInput{
+		Filename:    "fin-fs-02-memory.raw",
+		Hash:        "5d41402abc4b2a76b9719d911017c592aaf9b7a5e3c2d1f0e9d8c7b6a5f4e3d2",
+		Size:        17179869184,
+		Description: "Memory image taken before isolation",
+		Collector:   "Dana (SOC Tier 2)",
+		CollectedAt: &collectedAt,
+	}, custodyActor{name: "demo"}, now); err != nil {
+		log.Printf("demo: evidence: %v", err)
+	}
+	if _, err := deps.enrichment.run(ctx, major.ID, false); err != nil {
+		log.Printf("demo: enrichment: %v", err)
+	}
+
+	mapping, _ := deps.mappings.get(defaultAlertSource)
+	alertIDs := []string{}
+	for _, alert := range []map[string]any{
+		{"title": "Okta: MFA push fatigue for j.moreno", "severity": "high", "user": "j.moreno", "src_ip": demoSprayIP, "tags": []any{"okta"}},
+		{"title": "Reported phishing: payroll update request", "severity": "medium", "user": "a.chen", "domain": demoPhishDomain, "tags": []any{"phishing", "email"}},
+		{"title": "Password spray against VPN portal", "severity": "medium", "src_ip": demoSprayIP, "host": "vpn-gw-01"},
+		{"title": "Outbound connection to known C2", "severity": "high", "host": "fin-ws-117", "dest_ip": demoC2Address},
+	} {
+		// The password spray shares its source with the Okta alert, so it is
+		// correlated into that incident rather than opening its own.
+		result, created, err := deps.alerts.ingest(ctx, mapping, alert)
+		if err != nil {
+			log.Printf("demo: alert: %v", err)
+			continue
+		}
+		if _, err := deps.enrichment.run(ctx, result.IncidentID, false); err != nil {
+			log.Printf("demo: enrichment: %v", err)
+		}
+		if created {
+			alertIDs = append(alertIDs, result.IncidentID)
+		}
+	}
+	log.Printf("demo mode: seeded major incident %s and %d alert incidents", major.ID, len(alertIDs))
+
+	triage := major.ID
+	if len(alertIDs) > 0 {
+		triage = alertIDs[0]
+	}
+	return DemoGuide{
+		Scenario: "Ransomware is being staged on the finance file servers while the usual alert traffic keeps arriving.",
+		Steps: []DemoStep{
+			{Title: "Look at the triage queue", Detail: "New alerts wait for an analyst, longest waiting first.", Method: http.MethodGet, Path: "/api/queue"},
+			{Title: "Open an alert incident", Detail: "Auto-tagging tagged the Okta alert identity and routing gave it to IAM with a playbook; the password spray from the same address was correlated into it. Enrichment came from fixtures.", Method: http.MethodGet, Path: "/api/incidents/" + triage},
+			{Title: "Claim it", Detail: "Claiming is atomic, so two analysts never pick up the same alert.", Method: http.MethodPost, Path: "/api/incidents/" + triage + "/claim"},
+			{Title: "Follow the major incident", Detail: "Read its timeline of notes, its sitrep, its open tasks, and its watchlist hits on the known C2.", Method: http.MethodGet, Path: "/api/incidents/" + major.ID},
+			{Title: "Check the evidence", Detail: "The memory image has a hash-chained custody trail; record a transfer to Legal.", Method: http.MethodGet, Path: "/api/incidents/" + major.ID + "/evidence"},
+			{Title: "Generate an executive summary", Detail: "Built from the incident without any LLM configured.", Method: http.MethodGet, Path: "/api/incidents/" + major.ID + "/executive-summary"},
+			{Title: "Watch the change stream", Detail: "Keep this open while updating incidents in another tab.", Method: http.MethodGet, Path: "/api/events/stream"},
+			{Title: "Review the audit trail", Detail: "As an admin, see every change the tour made.", Method: http.MethodGet, Path: "/api/audit"},
+		},
+	}
+}
+
+// demoHandler serves GET /api/demo, the guided tour, in demo mode.
+func demoHandler(guide *DemoGuide) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if guide == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "demo mode is off; start with DEMO_MODE=true"})
+			return
+		}
+		writeJSON(w, http.StatusOK, guide)
+	}
+}
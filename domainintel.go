@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rdapEnricher pulls domain registration data over RDAP, the structured
+// successor to port-43 WHOIS.
+type rdapEnricher struct {
+	client  *http.Client
+	baseURL string
+}
+
+type rdapEntity struct {
+	Roles      []string        `json:"roles"`
+	VCardArray json.RawMessage `json:"vcardArray"`
+	Entities   []rdapEntity    `json:"entities"`
+}
+
+type rdapDomain struct {
+	LDHName string   `json:"ldhName"`
+	Status  []string `json:"status"`
+	Events  []struct {
+		Action string `json:"eventAction"`
+		Date   string `json:"eventDate"`
+	} `json:"events"`
+	Nameservers []struct {
+		LDHName string `json:"ldhName"`
+	} `json:"nameservers"`
+	Entities []rdapEntity `json:"entities"`
+}
+
+func (r *rdapEnricher) name() string { return "whois" }
+
+func (r *rdapEnricher) supports(ioc string) bool {
+	return iocType(ioc) == iocDomain
+}
+
+func (r *rdapEnricher) lookup(ctx context.Context, ioc string) (map[string]any, error) {
+	var resp rdapDomain
+	endpoint := strings.TrimRight(r.baseURL, "/") + "/domain/" + url.PathEscape(strings.ToLower(ioc))
+	headers := map[string]string{"Accept": "application/rdap+json"}
+	if err := doJSON(ctx, r.client, http.MethodGet, endpoint, headers, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	data := map[string]any{
+		"domain": resp.LDHName,
+		"status": resp.Status,
+	}
+	for _, event := range resp.Events {
+		switch event.Action {
+		case "registration":
+			data["registeredAt"] = event.Date
+		case "expiration":
+			data["expiresAt"] = event.Date
+		case "last changed":
+			data["updatedAt"] = event.Date
+		}
+	}
+	nameservers := make([]string, 0, len(resp.Nameservers))
+	for _, ns := range resp.Nameservers {
+		nameservers = append(nameservers, strings.ToLower(ns.LDHName))
+	}
+	data["nameservers"] = nameservers
+
+	for _, entity := range flattenRDAPEntities(resp.Entities) {
+		name := vcardName(entity.VCardArray)
+		if name == "" {
+			continue
+		}
+		for _, role := range entity.Roles {
+			switch role {
+			case "registrar":
+				data["registrar"] = name
+			case "registrant":
+				data["registrant"] = name
+			}
+		}
+	}
+	if registered, ok := data["registeredAt"].(string); ok {
+		if at, err := time.Parse(time.RFC3339, registered); err == nil {
+			data["domainAgeDays"] = int(time.Since(at).Hours() / 24)
+		}
+	}
+	return data, nil
+}
+
+func flattenRDAPEntities(entities []rdapEntity) []rdapEntity {
+	flat := []rdapEntity{}
+	for _, entity := range entities {
+		flat = append(flat, entity)
+		flat = append(flat, flattenRDAPEntities(entity.Entities)...)
+	}
+	return flat
+}
+
+// vcardName extracts the "fn" property from a jCard array:
+// ["vcard", [["fn", {}, "text", "Example Registrar"], ...]].
+func vcardName(raw json.RawMessage) string {
+	var card []json.RawMessage
+	if json.Unmarshal(raw, &card) != nil || len(card) < 2 {
+		return ""
+	}
+	var properties [][]json.RawMessage
+	if json.Unmarshal(card[1], &properties) != nil {
+		return ""
+	}
+	for _, property := range properties {
+		if len(property) < 4 {
+			continue
+		}
+		var key, value string
+		if json.Unmarshal(property[0], &key) != nil || key != "fn" {
+			continue
+		}
+		if json.Unmarshal(property[3], &value) == nil {
+			return value
+		}
+	}
+	return ""
+}
+
+// passiveDNSEnricher queries a provider speaking the Passive DNS Common
+// Output Format (newline-delimited JSON), as served by CIRCL and DNSDB.
+type passiveDNSEnricher struct {
+	client   *http.Client
+	baseURL  string
+	user     string
+	password string
+	apiKey   string
+	limit    int
+}
+
+type pdnsRecord struct {
+	RRName    string `json:"rrname"`
+	RRType    string `json:"rrtype"`
+	RData     any    `json:"rdata"`
+	TimeFirst int64  `json:"time_first"`
+	TimeLast  int64  `json:"time_last"`
+	Count     int    `json:"count"`
+}
+
+type PassiveDNSResolution struct {
+	RRName    string    `json:"rrname"`
+	RRType    string    `json:"rrtype"`
+	RData     string    `json:"rdata"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Count     int       `json:"count"`
+}
+
+func (p *passiveDNSEnricher) name() string { return "passivedns" }
+
+func (p *passiveDNSEnricher) supports(ioc string) bool {
+	return iocType(ioc) == iocDomain
+}
+
+func (p *passiveDNSEnricher) lookup(ctx context.Context, ioc string) (map[string]any, error) {
+	endpoint := strings.TrimRight(p.baseURL, "/") + "/" + url.PathEscape(strings.ToLower(ioc))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/x-ndjson")
+	if p.user != "" {
+		req.SetBasicAuth(p.user, p.password)
+	}
+	if p.apiKey != "" {
+		req.Header.Set("X-API-Key", p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return map[string]any{"resolutions": []PassiveDNSResolution{}, "count": 0}, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("GET %s: %s: %s", endpoint, resp.Status, strings.TrimSpace(string(snippet)))
+	}
+
+	resolutions := []PassiveDNSResolution{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var record pdnsRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			continue
+		}
+		resolutions = append(resolutions, PassiveDNSResolution{
+			RRName:    strings.TrimSuffix(record.RRName, "."),
+			RRType:    record.RRType,
+			RData:     pdnsRData(record.RData),
+			FirstSeen: time.Unix(record.TimeFirst, 0).UTC(),
+			LastSeen:  time.Unix(record.TimeLast, 0).UTC(),
+			Count:     record.Count,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(resolutions, func(i, j int) bool {
+		return resolutions[i].LastSeen.After(resolutions[j].LastSeen)
+	})
+	total := len(resolutions)
+	if p.limit > 0 && len(resolutions) > p.limit {
+		resolutions = resolutions[:p.limit]
+	}
+	return map[string]any{"resolutions": resolutions, "count": total}, nil
+}
+
+func pdnsRData(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSuffix(v, ".")
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const elasticAlertSource = "elastic"
+
+// elasticAlertMapping is the built-in mapping for Elastic Security and
+// Watcher alerts. Alerts are normalized first (see elasticAlert), so the
+// mapping reads ruleName, riskScore, and entityTags regardless of which
+// Elastic version or action template sent them.
+func elasticAlertMapping() AlertMapping {
+	return AlertMapping{
+		Source:        elasticAlertSource,
+		TitleTemplate: "{ruleName}",
+		SeverityField: "riskScore",
+		IOCFields: []string{
+			"source.ip", "destination.ip", "client.ip", "server.ip", "host.ip",
+			"dns.question.name", "url.domain", "url.full", "destination.domain",
+			"file.hash.md5", "file.hash.sha1", "file.hash.sha256",
+			"process.hash.md5", "process.hash.sha1", "process.hash.sha256",
+			"threat.indicator.ip", "threat.indicator.url.full",
+		},
+		TagFields:    []string{"ruleTags", "entityTags"},
+		HostFields:   []string{"host.name", "host.hostname"},
+		UserFields:   []string{"user.name", "user.target.name"},
+		DedupeFields: []string{"ruleId", "host.name", "user.name"},
+	}
+}
+
+var (
+	elasticRuleNameFields  = []string{"kibana.alert.rule.name", "signal.rule.name", "rule.name", "watch_id"}
+	elasticRuleIDFields    = []string{"kibana.alert.rule.uuid", "kibana.alert.rule.rule_id", "signal.rule.id", "rule.id", "rule.uuid", "watch_id"}
+	elasticRiskScoreFields = []string{"kibana.alert.risk_score", "kibana.alert.rule.risk_score", "signal.rule.risk_score", "rule.risk_score", "event.risk_score"}
+	elasticSeverityFields  = []string{"kibana.alert.severity", "kibana.alert.rule.severity", "signal.rule.severity", "rule.severity", "event.severity"}
+	elasticRuleTagFields   = []string{"kibana.alert.rule.tags", "signal.rule.tags", "rule.tags"}
+)
+
+func firstEventValue(event map[string]any, fields []string) (string, bool) {
+	for _, field := range fields {
+		if values, ok := eventField(event, field); ok && len(values) > 0 && strings.TrimSpace(values[0]) != "" {
+			return values[0], true
+		}
+	}
+	return "", false
+}
+
+// elasticAlert adds the normalized fields the elastic mapping reads: the
+// rule name, id, tags, a risk score (falling back to the named severity),
+// and host:/user: tags for the entities involved.
+func elasticAlert(doc map[string]any) map[string]any {
+	alert := make(map[string]any, len(doc)+5)
+	for key, value := range doc {
+		alert[key] = value
+	}
+	if name, ok := firstEventValue(doc, elasticRuleNameFields); ok {
+		alert["ruleName"] = name
+	}
+	if id, ok := firstEventValue(doc, elasticRuleIDFields); ok {
+		alert["ruleId"] = id
+	}
+	if score, ok := firstEventValue(doc, elasticRiskScoreFields); ok {
+		alert["riskScore"] = score
+	} else if severity, ok := firstEventValue(doc, elasticSeverityFields); ok {
+		alert["riskScore"] = severity
+	}
+	ruleTags := []any{}
+	for _, field := range elasticRuleTagFields {
+		if values, ok := eventField(doc, field); ok {
+			for _, value := range values {
+				ruleTags = append(ruleTags, value)
+			}
+			break
+		}
+	}
+	alert["ruleTags"] = ruleTags
+
+	entityTags := []any{}
+	for _, entity := range []struct{ prefix, field string }{
+		{"host:", "host.name"},
+		{"host:", "host.hostname"},
+		{"user:", "user.name"},
+		{"user:", "user.target.name"},
+	} {
+		values, _ := eventField(doc, entity.field)
+		for _, value := range values {
+			entityTags = append(entityTags, entity.prefix+value)
+		}
+	}
+	alert["entityTags"] = entityTags
+	return alert
+}
+
+// elasticAlerts unwraps the payload shapes Elastic sends: a rule action body
+// of {"rule": {...}, "alerts": [...]}, a Watcher payload with search hits,
+// an array of alert documents, or a single document.
+func elasticAlerts(payload any) ([]map[string]any, bool) {
+	switch payload := payload.(type) {
+	case []any:
+		docs := []map[string]any{}
+		for _, item := range payload {
+			doc, ok := item.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			docs = append(docs, elasticAlert(doc))
+		}
+		return docs, true
+	case map[string]any:
+		if alerts, ok := payload["alerts"].([]any); ok {
+			rule, _ := payload["rule"].(map[string]any)
+			docs := []map[string]any{}
+			for _, item := range alerts {
+				doc, ok := item.(map[string]any)
+				if !ok {
+					return nil, false
+				}
+				if _, present := doc["rule"]; !present && rule != nil {
+					doc["rule"] = rule
+				}
+				docs = append(docs, elasticAlert(doc))
+			}
+			return docs, true
+		}
+		if hits := watcherHits(payload); hits != nil {
+			watch, _ := payload["watch_id"].(string)
+			docs := []map[string]any{}
+			for _, source := range hits {
+				if _, present := source["watch_id"]; !present && watch != "" {
+					source["watch_id"] = watch
+				}
+				docs = append(docs, elasticAlert(source))
+			}
+			return docs, true
+		}
+		return []map[string]any{elasticAlert(payload)}, true
+	}
+	return nil, false
+}
+
+// watcherHits returns the _source of each search hit in a Watcher payload
+// ({"watch_id": ..., "payload": {"hits": {"hits": [...]}}}), or nil.
+func watcherHits(payload map[string]any) []map[string]any {
+	body, _ := payload["payload"].(map[string]any)
+	hits, _ := body["hits"].(map[string]any)
+	list, _ := hits["hits"].([]any)
+	var sources []map[string]any
+	for _, item := range list {
+		hit, _ := item.(map[string]any)
+		if source, ok := hit["_source"].(map[string]any); ok {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// elasticAlertsHandler receives Elastic Security rule actions (via a
+// webhook connector) and Watcher webhook actions.
+func elasticAlertsHandler(ingester *AlertIngester, mappings *AlertMappingStore, enrichment *EnrichmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var payload any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		alerts, ok := elasticAlerts(payload)
+		if !ok || len(alerts) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no alerts in payload"})
+			return
+		}
+		mapping, ok := mappings.get(elasticAlertSource)
+		if !ok {
+			mapping = elasticAlertMapping()
+		}
+		_, wrapped := payload.(map[string]any)
+		ingestAlerts(w, r, ingester, enrichment, mapping, alerts, wrapped && len(alerts) == 1)
+	}
+}
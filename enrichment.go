@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Enrichment struct {
+	Source    string         `json:"source"`
+	IOC       string         `json:"ioc"`
+	Data      map[string]any `json:"data,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	FetchedAt time.Time      `json:"fetchedAt"`
+}
+
+// Enricher looks up context for a single indicator from one source.
+type Enricher interface {
+	name() string
+	supports(ioc string) bool
+	lookup(ctx context.Context, ioc string) (map[string]any, error)
+}
+
+type cachedLookup struct {
+	enrichment Enrichment
+	expires    time.Time
+}
+
+type EnrichmentService struct {
+	store     *IncidentStore
+	enrichers []Enricher
+	geo       *GeoIP
+	jobs      chan string
+	dropped   atomic.Uint64
+	ttl       time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedLookup
+}
+
+func newEnrichmentService(store *IncidentStore) *EnrichmentService {
+	service := &EnrichmentService{
+		store: store,
+		jobs:  make(chan string, envInt("ENRICHMENT_QUEUE_SIZE", 256)),
+		ttl:   envDuration("ENRICHMENT_CACHE_TTL", 6*time.Hour),
+		cache: make(map[string]cachedLookup),
+	}
+	client := newOutboundClient()
+
+	if key := envString("ABUSEIPDB_API_KEY", ""); key != "" {
+		service.enrichers = append(service.enrichers, &abuseIPDBEnricher{
+			client:  client,
+			key:     key,
+			baseURL: envString("ABUSEIPDB_API_URL", "https://api.abuseipdb.com/api/v2"),
+			maxAge:  envInt("ABUSEIPDB_MAX_AGE_DAYS", 90),
+		})
+	}
+	if envBool("WHOIS_ENABLED", false) {
+		service.enrichers = append(service.enrichers, &rdapEnricher{
+			client:  client,
+			baseURL: envString("WHOIS_RDAP_URL", "https://rdap.org"),
+		})
+	}
+	if endpoint := envString("PDNS_URL", ""); endpoint != "" {
+		service.enrichers = append(service.enrichers, &passiveDNSEnricher{
+			client:   client,
+			baseURL:  endpoint,
+			user:     envString("PDNS_USER", ""),
+			password: envString("PDNS_PASSWORD", ""),
+			apiKey:   envString("PDNS_API_KEY", ""),
+			limit:    envInt("PDNS_MAX_RESULTS", 50),
+		})
+	}
+	if geo := newGeoIPFromEnv(); geo != nil {
+		service.geo = geo
+		service.enrichers = append(service.enrichers, geo)
+	}
+	return service
+}
+
+func (e *EnrichmentService) start() {
+	go func() {
+		for id := range e.jobs {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if _, err := e.run(ctx, id, false); err != nil {
+				log.Printf("enrichment %s: %v", id, err)
+			}
+			cancel()
+		}
+	}()
+}
+
+// enqueue schedules background enrichment for an incident without blocking
+// the request that created it.
+func (e *EnrichmentService) enqueue(id string) {
+	if len(e.enrichers) == 0 {
+		return
+	}
+	select {
+	case e.jobs <- id:
+	default:
+		e.dropped.Add(1)
+		log.Printf("enrichment queue full, dropping %s", id)
+	}
+}
+
+func (e *EnrichmentService) run(ctx context.Context, id string, refresh bool) (Incident, error) {
+	incident, ok := e.store.get(id)
+	if !ok {
+		return Incident{}, errIncidentNotFound
+	}
+	ctx = adoptTrace(ctx, incident.trace)
+	ctx, span := startSpan(ctx, "enrich", spanInternal)
+	defer span.end()
+	span.set("incident.id", id)
+
+	results := []Enrichment{}
+	for _, ioc := range incident.IOCs {
+		for _, enricher := range e.enrichers {
+			if !enricher.supports(ioc) {
+				continue
+			}
+			results = append(results, e.lookup(ctx, enricher, ioc, refresh))
+		}
+	}
+	if len(results) == 0 {
+		return *incident, nil
+	}
+	return e.store.setEnrichments(id, results)
+}
+
+func (e *EnrichmentService) lookup(ctx context.Context, enricher Enricher, ioc string, refresh bool) Enrichment {
+	key := enricher.name() + "|" + ioc
+	now := time.Now().UTC()
+
+	if !refresh {
+		e.mu.Lock()
+		cached, ok := e.cache[key]
+		e.mu.Unlock()
+		if ok && now.Before(cached.expires) {
+			return cached.enrichment
+		}
+	}
+
+	ctx, span := startSpan(ctx, "enrich "+enricher.name(), spanInternal)
+	defer span.end()
+	span.set("enrichment.source", enricher.name())
+	span.set("enrichment.ioc", ioc)
+	result := Enrichment{Source: enricher.name(), IOC: ioc, FetchedAt: now}
+	data, err := enricher.lookup(ctx, ioc)
+	if err != nil {
+		span.fail(err.Error())
+		result.Error = err.Error()
+		return result
+	}
+	result.Data = data
+
+	e.mu.Lock()
+	e.cache[key] = cachedLookup{enrichment: result, expires: now.Add(e.ttl)}
+	e.mu.Unlock()
+	return result
+}
+
+// setEnrichments merges results into the incident, replacing any earlier
+// record from the same source for the same indicator.
+func (s *IncidentStore) setEnrichments(id string, results []Enrichment) (Incident, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return Incident{}, errIncidentNotFound
+	}
+	previous := *incident
+
+	merged := make([]Enrichment, 0, len(incident.Enrichments)+len(results))
+	for _, existing := range incident.Enrichments {
+		replaced := false
+		for _, result := range results {
+			if existing.Source == result.Source && existing.IOC == result.IOC {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, existing)
+		}
+	}
+	incident.Enrichments = append(merged, results...)
+	incident.UpdatedAt = time.Now().UTC()
+	s.runAnnotators(incident)
+	s.emit(eventIncidentUpdated, *incident, &previous)
+
+	return *incident, nil
+}
+
+func handleIncidentEnrichments(w http.ResponseWriter, r *http.Request, id string, store *IncidentStore, enrichment *EnrichmentService) {
+	switch r.Method {
+	case http.MethodGet:
+		incident, ok := store.get(id)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": incident.Enrichments})
+	case http.MethodPost:
+		refresh := r.URL.Query().Get("refresh") == "true"
+		incident, err := enrichment.run(r.Context(), id, refresh)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, incident)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
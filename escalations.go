@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EscalationRule escalates incidents that have been New for longer than
+// After: optionally bumping severity one level, reassigning them, and
+// notifying. Each rule fires once per stay in New.
+type EscalationRule struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Enabled      bool      `json:"enabled"`
+	After        string    `json:"after"`
+	Severities   []string  `json:"severities"`
+	BumpSeverity bool      `json:"bumpSeverity"`
+	AssignTo     string    `json:"assignTo"`
+	Notify       bool      `json:"notify"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+
+	after time.Duration
+}
+
+type EscalationRuleInput struct {
+	Name string `json:"name"`
+	// Enabled and Notify default to true.
+	Enabled      *bool    `json:"enabled"`
+	After        string   `json:"after"`
+	Severities   []string `json:"severities"`
+	BumpSeverity *bool    `json:"bumpSeverity"`
+	AssignTo     *string  `json:"assignTo"`
+	Notify       *bool    `json:"notify"`
+}
+
+var errEscalationNotFound = errors.New("escalation rule not found")
+
+type EscalationStore struct {
+	mu      sync.RWMutex
+	rules   map[string]*EscalationRule
+	order   []string
+	counter int
+	// fired records, per rule and incident, the New stay a rule escalated so
+	// it doesn't fire again until the incident returns to New.
+	fired map[string]map[string]time.Time
+}
+
+func newEscalationStore() *EscalationStore {
+	return &EscalationStore{
+		rules: make(map[string]*EscalationRule),
+		order: []string{},
+		fired: make(map[string]map[string]time.Time),
+	}
+}
+
+func (e *EscalationStore) list() []EscalationRule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	items := make([]EscalationRule, 0, len(e.order))
+	for _, id := range e.order {
+		items = append(items, *e.rules[id])
+	}
+	return items
+}
+
+func (e *EscalationStore) get(id string) (EscalationRule, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	rule, ok := e.rules[id]
+	if !ok {
+		return EscalationRule{}, false
+	}
+	return *rule, true
+}
+
+// apply validates input onto rule.
+func (input EscalationRuleInput) apply(rule *EscalationRule) error {
+	if name := strings.TrimSpace(input.Name); name != "" {
+		rule.Name = name
+	}
+	if input.Enabled != nil {
+		rule.Enabled = *input.Enabled
+	}
+	if input.After != "" {
+		after, err := time.ParseDuration(input.After)
+		if err != nil || after <= 0 {
+			return errors.New("after must be a positive duration such as 30m")
+		}
+		rule.After, rule.after = after.String(), after
+	}
+	if input.Severities != nil {
+		severities := []string{}
+		for _, severity := range sanitizeSlice(input.Severities) {
+			if !strings.EqualFold(normalizeSeverity(severity), severity) {
+				return errors.New("severities must be Low, Medium, High, or Critical")
+			}
+			severities = append(severities, normalizeSeverity(severity))
+		}
+		rule.Severities = severities
+	}
+	if input.BumpSeverity != nil {
+		rule.BumpSeverity = *input.BumpSeverity
+	}
+	if input.AssignTo != nil {
+		rule.AssignTo = strings.TrimSpace(*input.AssignTo)
+	}
+	if input.Notify != nil {
+		rule.Notify = *input.Notify
+	}
+
+	switch {
+	case rule.Name == "":
+		return errors.New("name is required")
+	case rule.after == 0:
+		return errors.New("after is required")
+	case !rule.BumpSeverity && rule.AssignTo == "" && !rule.Notify:
+		return errors.New("a rule needs at least one of bumpSeverity, assignTo, or notify")
+	}
+	return nil
+}
+
+func (e *EscalationStore) create(input EscalationRuleInput) (EscalationRule, error) {
+	now := time.Now().UTC()
+	rule := &EscalationRule{Enabled: true, Notify: true, Severities: []string{}, CreatedAt: now, UpdatedAt: now}
+	if err := input.apply(rule); err != nil {
+		return EscalationRule{}, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.counter++
+	rule.ID = "ESC-" + padInt(e.counter)
+	e.rules[rule.ID] = rule
+	e.order = append(e.order, rule.ID)
+	return *rule, nil
+}
+
+func (e *EscalationStore) update(id string, input EscalationRuleInput) (EscalationRule, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	existing, ok := e.rules[id]
+	if !ok {
+		return EscalationRule{}, errEscalationNotFound
+	}
+	rule := *existing
+	if err := input.apply(&rule); err != nil {
+		return EscalationRule{}, err
+	}
+	rule.UpdatedAt = time.Now().UTC()
+	*existing = rule
+	return rule, nil
+}
+
+func (e *EscalationStore) delete(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.rules[id]; !ok {
+		return errEscalationNotFound
+	}
+	delete(e.rules, id)
+	delete(e.fired, id)
+	for i, existing := range e.order {
+		if existing == id {
+			e.order = append(e.order[:i], e.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// claimFiring reports whether rule should fire for this stay in New and,
+// if so, records it.
+func (e *EscalationStore) claimFiring(ruleID, incidentID string, newSince time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.fired[ruleID] == nil {
+		e.fired[ruleID] = make(map[string]time.Time)
+	}
+	if e.fired[ruleID][incidentID].Equal(newSince) {
+		return false
+	}
+	e.fired[ruleID][incidentID] = newSince
+	return true
+}
+
+// statusSince is when the incident entered its current status.
+func statusSince(incident Incident) time.Time {
+	for i := len(incident.history) - 1; i >= 0; i-- {
+		if change := incident.history[i]; change.Field == "status" {
+			return change.At
+		}
+	}
+	return incident.CreatedAt
+}
+
+func nextSeverity(severity string) string {
+	return currentTaxonomies().nextSeverityUp(severity)
+}
+
+func (r EscalationRule) matches(incident Incident, waited time.Duration) bool {
+	if !r.Enabled || waited < r.after {
+		return false
+	}
+	if len(r.Severities) == 0 {
+		return true
+	}
+	for _, severity := range r.Severities {
+		if strings.EqualFold(severity, incident.Severity) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate escalates every New incident that a rule matches.
+func (e *EscalationStore) evaluate(store *IncidentStore, notifier *Notifier, now time.Time) {
+	rules := e.list()
+	for _, item := range store.list() {
+		for _, rule := range rules {
+			incident, ok := store.get(item.ID)
+			if !ok || !strings.EqualFold(incident.Status, "New") {
+				break
+			}
+			since := statusSince(*incident)
+			if !rule.matches(*incident, now.Sub(since)) || !e.claimFiring(rule.ID, incident.ID, since) {
+				continue
+			}
+			if err := e.escalate(store, notifier, rule, *incident, now.Sub(since)); err != nil {
+				log.Printf("escalation %s on %s: %v", rule.ID, incident.ID, err)
+			}
+		}
+	}
+}
+
+func (e *EscalationStore) escalate(store *IncidentStore, notifier *Notifier, rule EscalationRule, incident Incident, waited time.Duration) error {
+	update := IncidentUpdate{Actor: "Escalation: " + rule.Name, ActorID: rule.ID}
+	actions := []string{}
+	if rule.BumpSeverity {
+		if next := nextSeverity(incident.Severity); next != incident.Severity {
+			update.Severity = next
+			actions = append(actions, "severity "+incident.Severity+" -> "+next)
+		}
+	}
+	if rule.AssignTo != "" && rule.AssignTo != incident.Owner {
+		update.Owner = rule.AssignTo
+		actions = append(actions, "reassigned to "+rule.AssignTo)
+	}
+	if update.Severity != "" || update.Owner != "" {
+		updated, err := store.update(incident.ID, update)
+		if err != nil {
+			return err
+		}
+		incident = updated
+	}
+
+	summary := "no changes"
+	if len(actions) > 0 {
+		summary = strings.Join(actions, ", ")
+	}
+	body := "Escalated by rule \"" + rule.Name + "\" after " + waited.Round(time.Second).String() + " in New: " + summary
+	if _, err := store.addNote(incident.ID, NoteInput{Body: body, Author: "Escalation rules", AuthorType: authorTypeAutomation, AuthorID: rule.ID}); err != nil {
+		return err
+	}
+	if rule.Notify {
+		notifier.notify(Notification{
+			Event:    "incident.escalated",
+			Message:  incident.ID + " escalated (" + summary + "): " + incident.Title,
+			Incident: incident,
+		})
+	}
+	return nil
+}
+
+func startEscalations(ctx context.Context, escalations *EscalationStore, store *IncidentStore, notifier *Notifier, every time.Duration) {
+	if every <= 0 {
+		return
+	}
+	runEvery(ctx, every, func(now time.Time) {
+		escalations.evaluate(store, notifier, now.UTC())
+	})
+}
+
+func escalationsHandler(escalations *EscalationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReadRequest(r) && (!requireRole(w, r, roleAdmin) || !requireSharedConfig(w, r)) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"items": escalations.list()})
+		case http.MethodPost:
+			var input EscalationRuleInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			rule, err := escalations.create(input)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, rule)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func escalationHandler(escalations *EscalationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/escalations/")
+		if id == "" || strings.Contains(id, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !isReadRequest(r) && (!requireRole(w, r, roleAdmin) || !requireSharedConfig(w, r)) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			rule, ok := escalations.get(id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, rule)
+		case http.MethodPut:
+			var input EscalationRuleInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			rule, err := escalations.update(id, input)
+			if errors.Is(err, errEscalationNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, rule)
+		case http.MethodDelete:
+			if err := escalations.delete(id); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
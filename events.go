@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"time"
+)
+
+const (
+	eventIncidentCreated = "incident.created"
+	eventIncidentUpdated = "incident.updated"
+	eventNoteAdded       = "note.added"
+)
+
+type IncidentEvent struct {
+	Type     string    `json:"type"`
+	Incident Incident  `json:"incident"`
+	Previous *Incident `json:"previous,omitempty"`
+	At       time.Time `json:"at"`
+
+	// seq orders events as they were committed, since handlers for
+	// concurrent changes can run out of order.
+	seq uint64
+}
+
+// subscribe registers fn to run after every committed store change. Handlers
+// run synchronously on the mutating goroutine once the lock is released, so
+// they may read from the store but should hand slow work off to a goroutine.
+func (s *IncidentStore) subscribe(fn func(IncidentEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// emit queues an event for delivery. Callers must hold s.mu and release it
+// with s.unlock so the event is flushed.
+func (s *IncidentStore) emit(eventType string, incident Incident, previous *Incident) {
+	s.seq++
+	s.pending = append(s.pending, IncidentEvent{
+		Type:     eventType,
+		Incident: incident,
+		Previous: previous,
+		At:       time.Now().UTC(),
+		seq:      s.seq,
+	})
+}
+
+func (s *IncidentStore) unlock() {
+	pending := s.pending
+	s.pending = nil
+	subscribers := s.subscribers
+	s.mu.Unlock()
+
+	for _, event := range pending {
+		for _, fn := range subscribers {
+			fn(event)
+		}
+	}
+}
+
+// annotate registers fn to derive fields on an incident whenever it is
+// created or changed. Annotators run under the store lock, so they must not
+// call back into the store.
+func (s *IncidentStore) annotate(fn func(*Incident)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.annotators = append(s.annotators, fn)
+}
+
+// onCreate registers fn to adjust a new incident before it is stored, once,
+// unlike annotators. It runs under the store lock, like an annotator.
+func (s *IncidentStore) onCreate(fn func(*Incident)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.createHooks = append(s.createHooks, fn)
+}
+
+func (s *IncidentStore) runAnnotators(incident *Incident) {
+	for _, fn := range s.annotators {
+		fn(incident)
+	}
+}
+
+// reannotate re-runs annotators on every incident, for when the data they
+// derive from (such as watchlists) changes. Incidents whose derived fields
+// change emit an update event.
+func (s *IncidentStore) reannotate() {
+	s.mu.Lock()
+	defer s.unlock()
+
+	for _, id := range s.order {
+		incident := s.incidents[id]
+		if incident == nil {
+			continue
+		}
+		previous := *incident
+		s.runAnnotators(incident)
+		if !reflect.DeepEqual(previous, *incident) {
+			s.emit(eventIncidentUpdated, *incident, &previous)
+		}
+	}
+}
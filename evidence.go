@@ -0,0 +1,330 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Custody actions. collected and registered are written when evidence is
+// registered; the rest are recorded through the custody endpoint.
+const (
+	custodyCollected   = "collected"
+	custodyRegistered  = "registered"
+	custodyAccessed    = "accessed"
+	custodyTransferred = "transferred"
+)
+
+// evidenceHashAlgorithms names a hex digest by its length.
+var evidenceHashAlgorithms = map[int]string{32: "md5", 40: "sha1", 64: "sha256", 128: "sha512"}
+
+var (
+	errEvidenceNotFound = errors.New("evidence not found")
+	errCustodyAction    = errors.New("action must be accessed or transferred")
+)
+
+// CustodyEntry is one link in an artifact's chain of custody. Each entry's
+// hash covers the previous one, so the trail can't be edited or trimmed
+// without it showing.
+type CustodyEntry struct {
+	Seq        int       `json:"seq"`
+	At         time.Time `json:"at"`
+	Action     string    `json:"action"`
+	Actor      string    `json:"actor"`
+	ActorID    string    `json:"actorId,omitempty"`
+	From       string    `json:"from,omitempty"`
+	To         string    `json:"to,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	PrevHash   string    `json:"prevHash"`
+	Hash       string    `json:"hash"`
+}
+
+// Evidence is an artifact collected for an incident. Evidence can't be
+// edited or deleted once registered; Custodian is whoever it was last
+// transferred to.
+type Evidence struct {
+	ID            string         `json:"id"`
+	IncidentID    string         `json:"incidentId"`
+	Filename      string         `json:"filename"`
+	Hash          string         `json:"hash"`
+	HashAlgorithm string         `json:"hashAlgorithm"`
+	Size          int64          `json:"size,omitempty"`
+	Description   string         `json:"description,omitempty"`
+	Collector     string         `json:"collector"`
+	CollectedAt   time.Time      `json:"collectedAt"`
+	Custodian     string         `json:"custodian"`
+	Custody       []CustodyEntry `json:"custody"`
+	// CustodyIntact is false when the custody trail's hashes don't check out.
+	CustodyIntact bool `json:"custodyIntact"`
+}
+
+type EvidenceInput struct {
+	Filename    string `json:"filename"`
+	Hash        string `json:"hash"`
+	Size        int64  `json:"size"`
+	Description string `json:"description"`
+	Collector   string `json:"collector"`
+	// CollectedAt defaults to now.
+	CollectedAt *time.Time `json:"collectedAt"`
+}
+
+type CustodyInput struct {
+	Action string `json:"action"`
+	// To is the new custodian, required for transfers.
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+}
+
+// custodyActor is who is registering or handling evidence, and from where.
+type custodyActor struct {
+	name       string
+	id         string
+	remoteAddr string
+}
+
+func custodyActorFrom(r *http.Request) custodyActor {
+	name, id := actor(r.Context())
+	return custodyActor{name: fallback(name, "anonymous"), id: id, remoteAddr: r.RemoteAddr}
+}
+
+// EvidenceStore keeps evidence apart from incidents so registering or
+// handling an artifact never shows up as an incident update. Evidence
+// outlives a purge of its incident, custody trail included.
+type EvidenceStore struct {
+	mu         sync.Mutex
+	evidence   map[string]*Evidence
+	byIncident map[string][]string
+	counter    int
+}
+
+func newEvidenceStore() *EvidenceStore {
+	return &EvidenceStore{evidence: make(map[string]*Evidence), byIncident: make(map[string][]string)}
+}
+
+func (s *EvidenceStore) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.evidence)
+}
+
+func custodyHash(entry CustodyEntry) string {
+	entry.Hash = ""
+	body, _ := json.Marshal(entry)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// appendCustody adds an entry linked to the last one. Callers must hold
+// the store lock.
+func appendCustody(evidence *Evidence, entry CustodyEntry) {
+	entry.Seq = len(evidence.Custody) + 1
+	entry.PrevHash = auditGenesisHash
+	if len(evidence.Custody) > 0 {
+		entry.PrevHash = evidence.Custody[len(evidence.Custody)-1].Hash
+	}
+	entry.Hash = custodyHash(entry)
+	evidence.Custody = append(evidence.Custody, entry)
+}
+
+func custodyIntact(entries []CustodyEntry) bool {
+	prevHash := auditGenesisHash
+	for i, entry := range entries {
+		if entry.Seq != i+1 || entry.PrevHash != prevHash || custodyHash(entry) != entry.Hash {
+			return false
+		}
+		prevHash = entry.Hash
+	}
+	return true
+}
+
+// view copies evidence for a response. Callers must hold the store lock.
+func (evidence *Evidence) view() Evidence {
+	copied := *evidence
+	copied.Custody = append([]CustodyEntry{}, evidence.Custody...)
+	copied.CustodyIntact = custodyIntact(copied.Custody)
+	return copied
+}
+
+func (e *EvidenceStore) list(incidentID string) []Evidence {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	items := make([]Evidence, 0, len(e.byIncident[incidentID]))
+	for _, id := range e.byIncident[incidentID] {
+		items = append(items, e.evidence[id].view())
+	}
+	return items
+}
+
+func (e *EvidenceStore) get(incidentID, id string) (Evidence, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	evidence, ok := e.evidence[id]
+	if !ok || evidence.IncidentID != incidentID {
+		return Evidence{}, false
+	}
+	return evidence.view(), true
+}
+
+// register records a new artifact with the start of its custody trail: the
+// collection, then its registration here.
+func (e *EvidenceStore) register(incidentID string, input EvidenceInput, by custodyActor, now time.Time) (Evidence, error) {
+	filename := strings.TrimSpace(input.Filename)
+	if filename == "" {
+		return Evidence{}, errors.New("filename is required")
+	}
+	hash := strings.ToLower(strings.TrimSpace(input.Hash))
+	algorithm, ok := evidenceHashAlgorithms[len(hash)]
+	if !ok || !hexPattern.MatchString(hash) {
+		return Evidence{}, errors.New("hash must be a hex MD5, SHA-1, SHA-256, or SHA-512 digest")
+	}
+	collector := strings.TrimSpace(input.Collector)
+	if collector == "" {
+		return Evidence{}, errors.New("collector is required")
+	}
+	if input.Size < 0 {
+		return Evidence{}, errors.New("size must not be negative")
+	}
+	collectedAt := now
+	if input.CollectedAt != nil {
+		collectedAt = input.CollectedAt.UTC()
+	}
+	if collectedAt.After(now.Add(5 * time.Minute)) {
+		return Evidence{}, errors.New("collectedAt must not be in the future")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.counter++
+	evidence := &Evidence{
+		ID:            "EV-" + padInt(e.counter),
+		IncidentID:    incidentID,
+		Filename:      filename,
+		Hash:          hash,
+		HashAlgorithm: algorithm,
+		Size:          input.Size,
+		Description:   strings.TrimSpace(input.Description),
+		Collector:     collector,
+		CollectedAt:   collectedAt,
+		Custodian:     collector,
+		Custody:       []CustodyEntry{},
+	}
+	appendCustody(evidence, CustodyEntry{At: collectedAt, Action: custodyCollected, Actor: collector, To: collector})
+	appendCustody(evidence, CustodyEntry{At: now, Action: custodyRegistered, Actor: by.name, ActorID: by.id, RemoteAddr: by.remoteAddr})
+	e.evidence[evidence.ID] = evidence
+	e.byIncident[incidentID] = append(e.byIncident[incidentID], evidence.ID)
+	return evidence.view(), nil
+}
+
+// handle records an access or a transfer. Transfers need a recipient and a
+// reason, and make the recipient the custodian.
+func (e *EvidenceStore) handle(incidentID, id string, input CustodyInput, by custodyActor, now time.Time) (Evidence, error) {
+	action := strings.ToLower(strings.TrimSpace(input.Action))
+	to := strings.TrimSpace(input.To)
+	reason := strings.TrimSpace(input.Reason)
+	switch action {
+	case custodyAccessed:
+		to = ""
+	case custodyTransferred:
+		if to == "" || reason == "" {
+			return Evidence{}, errors.New("transfers need to and reason")
+		}
+	default:
+		return Evidence{}, errCustodyAction
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	evidence, ok := e.evidence[id]
+	if !ok || evidence.IncidentID != incidentID {
+		return Evidence{}, errEvidenceNotFound
+	}
+	entry := CustodyEntry{At: now, Action: action, Actor: by.name, ActorID: by.id, Reason: reason, RemoteAddr: by.remoteAddr}
+	if action == custodyTransferred {
+		entry.From, entry.To = evidence.Custodian, to
+		evidence.Custodian = to
+	}
+	appendCustody(evidence, entry)
+	return evidence.view(), nil
+}
+
+// handleIncidentEvidence serves /api/incidents/{id}/evidence,
+// /api/incidents/{id}/evidence/{evidenceId}, and
+// /api/incidents/{id}/evidence/{evidenceId}/custody.
+func handleIncidentEvidence(w http.ResponseWriter, r *http.Request, id string, parts []string, store *IncidentStore, evidence *EvidenceStore) {
+	if _, ok := store.get(id); !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case len(parts) == 2:
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"items": evidence.list(id)})
+		case http.MethodPost:
+			var input EvidenceInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			registered, err := evidence.register(id, input, custodyActorFrom(r), time.Now().UTC())
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, registered)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case len(parts) == 3:
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		item, ok := evidence.get(id, parts[2])
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, item)
+	case len(parts) == 4 && parts[3] == "custody":
+		switch r.Method {
+		case http.MethodGet:
+			item, ok := evidence.get(id, parts[2])
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": item.Custody, "intact": item.CustodyIntact})
+		case http.MethodPost:
+			var input CustodyInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			item, err := evidence.handle(id, parts[2], input, custodyActorFrom(r), time.Now().UTC())
+			if errors.Is(err, errEvidenceNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, item)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
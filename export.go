@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportCSV  = "csv"
+	exportJSON = "json"
+)
+
+var exportColumns = map[string]func(Incident) string{
+	"id":             func(i Incident) string { return i.ID },
+	"type":           func(i Incident) string { return i.Type },
+	"title":          func(i Incident) string { return i.Title },
+	"severity":       func(i Incident) string { return i.Severity },
+	"status":         func(i Incident) string { return i.Status },
+	"owner":          func(i Incident) string { return i.Owner },
+	"tags":           func(i Incident) string { return strings.Join(i.Tags, ";") },
+	"iocs":           func(i Incident) string { return strings.Join(i.IOCs, ";") },
+	"major":          func(i Incident) string { return strconv.FormatBool(i.Major) },
+	"killChainPhase": func(i Incident) string { return i.KillChainPhase },
+	"alertCount":     func(i Incident) string { return strconv.Itoa(i.AlertCount) },
+	"noteCount":      func(i Incident) string { return strconv.Itoa(len(i.Notes)) },
+	"taskCount":      func(i Incident) string { return strconv.Itoa(len(i.Tasks)) },
+	"createdAt":      func(i Incident) string { return i.CreatedAt.Format(time.RFC3339) },
+	"updatedAt":      func(i Incident) string { return i.UpdatedAt.Format(time.RFC3339) },
+	"closedAt": func(i Incident) string {
+		return closedStat(i, func(s *ClosedStats) string { return s.ClosedAt.Format(time.RFC3339) })
+	},
+	"durationSeconds": func(i Incident) string {
+		return closedStat(i, func(s *ClosedStats) string { return strconv.FormatInt(s.DurationSeconds, 10) })
+	},
+}
+
+var defaultExportColumns = []string{"id", "title", "severity", "status", "owner", "createdAt", "updatedAt"}
+
+func closedStat(incident Incident, value func(*ClosedStats) string) string {
+	if incident.ClosedStats == nil {
+		return ""
+	}
+	return value(incident.ClosedStats)
+}
+
+// ExportSpec is what an export produces: which columns, for which incidents
+// (a query in the query language), in which format.
+type ExportSpec struct {
+	Columns []string `json:"columns"`
+	Query   string   `json:"query"`
+	Format  string   `json:"format"`
+	// Anonymize pseudonymizes users, hosts, IPs, domains, hashes, and the
+	// title, for datasets shared outside the SOC.
+	Anonymize bool `json:"anonymize"`
+}
+
+func (spec *ExportSpec) normalize() error {
+	spec.Columns = sanitizeSlice(spec.Columns)
+	if len(spec.Columns) == 0 {
+		spec.Columns = append([]string{}, defaultExportColumns...)
+	}
+	for _, column := range spec.Columns {
+		if exportColumns[column] == nil {
+			return errors.New("unknown column " + column)
+		}
+	}
+	spec.Format = strings.ToLower(fallback(spec.Format, exportCSV))
+	if spec.Format != exportCSV && spec.Format != exportJSON {
+		return errors.New("format must be csv or json")
+	}
+	if _, err := parseQuery(spec.Query); err != nil {
+		return errors.New("invalid query: " + err.Error())
+	}
+	return nil
+}
+
+// writeExport renders the incidents the caller can see that match spec.
+// Every exported incident is recorded in its access log.
+func writeExport(w http.ResponseWriter, r *http.Request, spec ExportSpec, name string, store incidentSource, access *AccessLog, settings *SettingsStore) {
+	query, _ := parseQuery(spec.Query)
+	items := filterByQuery(visibleTo(r, store.list()), query)
+	if limit := settings.get().MaxExportRows; limit > 0 && len(items) > limit {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "export matches " + strconv.Itoa(len(items)) + " incidents, more than the limit of " + strconv.Itoa(limit) + "; narrow the query",
+		})
+		return
+	}
+	for _, incident := range items {
+		access.record(r, incident.ID, accessExport)
+	}
+	if spec.Anonymize {
+		scrub := newAnonymizer()
+		for i, incident := range items {
+			items[i] = scrub.incident(incident)
+		}
+	}
+
+	if spec.Format == exportJSON {
+		rows := make([]map[string]string, 0, len(items))
+		for _, incident := range items {
+			row := make(map[string]string, len(spec.Columns))
+			for _, column := range spec.Columns {
+				row[column] = exportColumns[column](incident)
+			}
+			rows = append(rows, row)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"columns": spec.Columns, "items": rows})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+	writer := csv.NewWriter(w)
+	writer.Write(spec.Columns)
+	for _, incident := range items {
+		row := make([]string, len(spec.Columns))
+		for i, column := range spec.Columns {
+			row[i] = exportColumns[column](incident)
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+}
+
+// incidentExportHandler serves GET /api/incidents/export?columns=id,title&
+// query=status:open&format=csv.
+func incidentExportHandler(store incidentSource, access *AccessLog, settings *SettingsStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		params := r.URL.Query()
+		spec := ExportSpec{Query: params.Get("query"), Format: params.Get("format"), Anonymize: strings.EqualFold(params.Get("anonymize"), "true")}
+		if columns := params.Get("columns"); columns != "" {
+			spec.Columns = strings.Split(columns, ",")
+		}
+		if err := spec.normalize(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeExport(w, r, spec, "incidents", store, access, settings)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExportPreset is a saved export belonging to one user, so recurring exports
+// (the weekly leadership sheet) are a single call.
+type ExportPreset struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`
+	Columns   []string  `json:"columns"`
+	Query     string    `json:"query"`
+	Format    string    `json:"format"`
+	Anonymize bool      `json:"anonymize"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ExportPresetInput struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Query   *string  `json:"query"`
+	Format  string   `json:"format"`
+	// Anonymize is left unchanged on update when omitted.
+	Anonymize *bool `json:"anonymize"`
+}
+
+var errExportPresetNotFound = errors.New("export preset not found")
+
+// ExportPresetStore keeps presets per owner. Owners only ever see their own
+// presets; callers without an identity share the anonymous owner "".
+type ExportPresetStore struct {
+	mu      sync.RWMutex
+	presets map[string]*ExportPreset
+	order   []string
+	counter int
+}
+
+func newExportPresetStore() *ExportPresetStore {
+	return &ExportPresetStore{presets: make(map[string]*ExportPreset), order: []string{}}
+}
+
+func (s *ExportPresetStore) list(owner string) []ExportPreset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []ExportPreset{}
+	for _, id := range s.order {
+		if preset := s.presets[id]; preset.Owner == owner {
+			items = append(items, *preset)
+		}
+	}
+	return items
+}
+
+func (s *ExportPresetStore) get(owner, id string) (ExportPreset, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	preset, ok := s.presets[id]
+	if !ok || preset.Owner != owner {
+		return ExportPreset{}, false
+	}
+	return *preset, true
+}
+
+func (s *ExportPresetStore) create(owner string, input ExportPresetInput) (ExportPreset, error) {
+	spec := ExportSpec{Columns: input.Columns, Format: input.Format, Anonymize: input.Anonymize != nil && *input.Anonymize}
+	if input.Query != nil {
+		spec.Query = *input.Query
+	}
+	if err := spec.normalize(); err != nil {
+		return ExportPreset{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counter++
+	now := time.Now().UTC()
+	preset := &ExportPreset{
+		ID:        "EXP-" + padInt(s.counter),
+		Name:      strings.TrimSpace(input.Name),
+		Owner:     owner,
+		Columns:   spec.Columns,
+		Query:     spec.Query,
+		Format:    spec.Format,
+		Anonymize: spec.Anonymize,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.presets[preset.ID] = preset
+	s.order = append(s.order, preset.ID)
+	return *preset, nil
+}
+
+func (s *ExportPresetStore) update(owner, id string, input ExportPresetInput) (ExportPreset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	preset, ok := s.presets[id]
+	if !ok || preset.Owner != owner {
+		return ExportPreset{}, errExportPresetNotFound
+	}
+	spec := preset.spec()
+	if input.Columns != nil {
+		spec.Columns = input.Columns
+	}
+	if input.Query != nil {
+		spec.Query = *input.Query
+	}
+	if input.Format != "" {
+		spec.Format = input.Format
+	}
+	if input.Anonymize != nil {
+		spec.Anonymize = *input.Anonymize
+	}
+	if err := spec.normalize(); err != nil {
+		return ExportPreset{}, err
+	}
+	if strings.TrimSpace(input.Name) != "" {
+		preset.Name = strings.TrimSpace(input.Name)
+	}
+	preset.Columns, preset.Query, preset.Format, preset.Anonymize = spec.Columns, spec.Query, spec.Format, spec.Anonymize
+	preset.UpdatedAt = time.Now().UTC()
+	return *preset, nil
+}
+
+func (s *ExportPresetStore) delete(owner, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if preset, ok := s.presets[id]; !ok || preset.Owner != owner {
+		return errExportPresetNotFound
+	}
+	delete(s.presets, id)
+	for i, existing := range s.order {
+		if existing == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (p ExportPreset) spec() ExportSpec {
+	return ExportSpec{Columns: append([]string{}, p.Columns...), Query: p.Query, Format: p.Format, Anonymize: p.Anonymize}
+}
+
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func presetOwner(r *http.Request) string {
+	principal, _ := principalFrom(r.Context())
+	return principal.ID
+}
+
+func exportPresetsHandler(presets *ExportPresetStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"items": presets.list(presetOwner(r))})
+		case http.MethodPost:
+			var input ExportPresetInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			if strings.TrimSpace(input.Name) == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required"})
+				return
+			}
+			preset, err := presets.create(presetOwner(r), input)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, preset)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func exportPresetHandler(presets *ExportPresetStore, store incidentSource, access *AccessLog, settings *SettingsStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/export-presets/"), "/")
+		id := parts[0]
+		owner := presetOwner(r)
+		if id == "" || len(parts) > 2 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if len(parts) == 2 {
+			if parts[1] != "export" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			preset, ok := presets.get(owner, id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			name := strings.Trim(unsafeFilename.ReplaceAllString(preset.Name, "-"), "-")
+			writeExport(w, r, preset.spec(), fallback(name, "export"), store, access, settings)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			preset, ok := presets.get(owner, id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, preset)
+		case http.MethodPut:
+			var input ExportPresetInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			preset, err := presets.update(owner, id, input)
+			if errors.Is(err, errExportPresetNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, preset)
+		case http.MethodDelete:
+			if err := presets.delete(owner, id); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	feedFormatPlaintext = "plaintext"
+	feedFormatCSV       = "csv"
+	feedFormatSTIX      = "stix"
+)
+
+// Feed is an external indicator list that is downloaded on a schedule.
+type Feed struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	URL           string     `json:"url"`
+	Format        string     `json:"format"`
+	Column        string     `json:"column,omitempty"`
+	Enabled       bool       `json:"enabled"`
+	Entries       int        `json:"entries"`
+	LastFetchedAt *time.Time `json:"lastFetchedAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+type FeedInput struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Format  string `json:"format"`
+	Column  string `json:"column"`
+	Enabled *bool  `json:"enabled"`
+}
+
+type FeedHit struct {
+	FeedID    string `json:"feedId"`
+	FeedName  string `json:"feedName"`
+	Indicator string `json:"indicator"`
+}
+
+var errFeedNotFound = errors.New("feed not found")
+
+// FeedStore is the feed table: feed definitions plus the indicators each one
+// last downloaded.
+type FeedStore struct {
+	mu      sync.RWMutex
+	feeds   map[string]*Feed
+	order   []string
+	counter int
+	entries map[string][]string
+	// index maps a normalized indicator to the feeds containing it.
+	index map[string][]string
+}
+
+func newFeedStore() *FeedStore {
+	return &FeedStore{
+		feeds:   make(map[string]*Feed),
+		order:   []string{},
+		entries: make(map[string][]string),
+		index:   make(map[string][]string),
+	}
+}
+
+// validFeedURL checks that a feed is fetched over http or https.
+func validFeedURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	return nil
+}
+
+// cgnatPrefix is the carrier-grade NAT range, private in all but name.
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports whether addr is on the internet rather than loopback,
+// link-local (cloud metadata services among them), or a private network.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !cgnatPrefix.Contains(addr)
+}
+
+// newFeedTransport refuses to connect to addresses that aren't public
+// unless allowPrivate is set, so a feed URL can't be used to reach the
+// server's own network. The check runs on the address actually dialed,
+// which covers redirects and names that resolve to internal addresses.
+func newFeedTransport(allowPrivate bool) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				host, _, _ := net.SplitHostPort(address)
+				if addr, err := netip.ParseAddr(host); err != nil || !publicAddr(addr) {
+					return fmt.Errorf("%s is not a public address; set FEED_ALLOW_PRIVATE=true to fetch feeds from it", host)
+				}
+				return nil
+			},
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	return tracingTransport{base: transport}
+}
+
+func validFeedFormat(format string) bool {
+	switch format {
+	case feedFormatPlaintext, feedFormatCSV, feedFormatSTIX:
+		return true
+	}
+	return false
+}
+
+func (f *FeedStore) list() []Feed {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	items := make([]Feed, 0, len(f.order))
+	for _, id := range f.order {
+		items = append(items, *f.feeds[id])
+	}
+	return items
+}
+
+func (f *FeedStore) get(id string) (Feed, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	feed, ok := f.feeds[id]
+	if !ok {
+		return Feed{}, false
+	}
+	return *feed, true
+}
+
+func (f *FeedStore) create(input FeedInput) (Feed, error) {
+	feed := Feed{
+		Name:    strings.TrimSpace(input.Name),
+		URL:     strings.TrimSpace(input.URL),
+		Format:  strings.ToLower(fallback(strings.TrimSpace(input.Format), feedFormatPlaintext)),
+		Column:  strings.TrimSpace(input.Column),
+		Enabled: input.Enabled == nil || *input.Enabled,
+	}
+	if feed.Name == "" || feed.URL == "" {
+		return Feed{}, errors.New("name and url are required")
+	}
+	if err := validFeedURL(feed.URL); err != nil {
+		return Feed{}, err
+	}
+	if !validFeedFormat(feed.Format) {
+		return Feed{}, errors.New("format must be plaintext, csv, or stix")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.counter++
+	feed.ID = "FEED-" + padInt(f.counter)
+	feed.CreatedAt = time.Now().UTC()
+	f.feeds[feed.ID] = &feed
+	f.order = append(f.order, feed.ID)
+
+	return feed, nil
+}
+
+func (f *FeedStore) update(id string, input FeedInput) (Feed, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	feed, ok := f.feeds[id]
+	if !ok {
+		return Feed{}, errFeedNotFound
+	}
+	if format := strings.ToLower(strings.TrimSpace(input.Format)); format != "" {
+		if !validFeedFormat(format) {
+			return Feed{}, errors.New("format must be plaintext, csv, or stix")
+		}
+		feed.Format = format
+	}
+	if strings.TrimSpace(input.Name) != "" {
+		feed.Name = strings.TrimSpace(input.Name)
+	}
+	if strings.TrimSpace(input.URL) != "" {
+		if err := validFeedURL(strings.TrimSpace(input.URL)); err != nil {
+			return Feed{}, err
+		}
+		feed.URL = strings.TrimSpace(input.URL)
+	}
+	if strings.TrimSpace(input.Column) != "" {
+		feed.Column = strings.TrimSpace(input.Column)
+	}
+	if input.Enabled != nil {
+		feed.Enabled = *input.Enabled
+	}
+	if !feed.Enabled {
+		delete(f.entries, id)
+		feed.Entries = 0
+		f.reindex()
+	}
+	return *feed, nil
+}
+
+func (f *FeedStore) delete(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.feeds[id]; !ok {
+		return errFeedNotFound
+	}
+	delete(f.feeds, id)
+	delete(f.entries, id)
+	for i, existing := range f.order {
+		if existing == id {
+			f.order = append(f.order[:i], f.order[i+1:]...)
+			break
+		}
+	}
+	f.reindex()
+	return nil
+}
+
+// record stores the outcome of a fetch. A failed fetch keeps the previous
+// entries so a flaky feed doesn't clear its matches.
+func (f *FeedStore) record(id string, entries []string, fetchErr error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	feed, ok := f.feeds[id]
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	feed.LastFetchedAt = &now
+	if fetchErr != nil {
+		feed.LastError = fetchErr.Error()
+		return
+	}
+	feed.LastError = ""
+	feed.Entries = len(entries)
+	f.entries[id] = entries
+	f.reindex()
+}
+
+// reindex rebuilds the indicator index. Callers must hold f.mu.
+func (f *FeedStore) reindex() {
+	f.index = make(map[string][]string)
+	for _, id := range f.order {
+		for _, entry := range f.entries[id] {
+			key := normalizeIOC(entry)
+			f.index[key] = append(f.index[key], id)
+		}
+	}
+}
+
+func (f *FeedStore) hits(iocs []string) []FeedHit {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	hits := []FeedHit{}
+	for _, ioc := range iocs {
+		for _, id := range f.index[normalizeIOC(ioc)] {
+			hits = append(hits, FeedHit{FeedID: id, FeedName: f.feeds[id].Name, Indicator: ioc})
+		}
+	}
+	return hits
+}
+
+// annotateIncident is registered as a store annotator so every write keeps
+// incident.FeedHits current.
+func (f *FeedStore) annotateIncident(incident *Incident) {
+	incident.FeedHits = f.hits(incident.IOCs)
+}
+
+// FeedManager downloads enabled feeds on a schedule and re-marks incidents
+// when the feed table changes.
+type FeedManager struct {
+	feeds    *FeedStore
+	store    *IncidentStore
+	client   *http.Client
+	interval time.Duration
+	maxBytes int64
+}
+
+func newFeedManager(feeds *FeedStore, store *IncidentStore) *FeedManager {
+	return &FeedManager{
+		feeds:    feeds,
+		store:    store,
+		client:   &http.Client{Timeout: envDuration("FEED_FETCH_TIMEOUT", time.Minute), Transport: newFeedTransport(envBool("FEED_ALLOW_PRIVATE", false))},
+		interval: envDuration("FEED_REFRESH_INTERVAL", time.Hour),
+		maxBytes: int64(envInt("FEED_MAX_BYTES", 50<<20)),
+	}
+}
+
+func (m *FeedManager) start(ctx context.Context) {
+	if m.interval <= 0 {
+		return
+	}
+	runEvery(ctx, m.interval, func(time.Time) {
+		m.refreshAll(ctx)
+	})
+}
+
+func (m *FeedManager) refreshAll(ctx context.Context) {
+	for _, feed := range m.feeds.list() {
+		if feed.Enabled {
+			m.fetch(ctx, feed)
+		}
+	}
+	m.store.reannotate()
+}
+
+func (m *FeedManager) refresh(ctx context.Context, id string) (Feed, error) {
+	feed, ok := m.feeds.get(id)
+	if !ok {
+		return Feed{}, errFeedNotFound
+	}
+	m.fetch(ctx, feed)
+	m.store.reannotate()
+	feed, _ = m.feeds.get(id)
+	return feed, nil
+}
+
+func (m *FeedManager) fetch(ctx context.Context, feed Feed) {
+	entries, err := m.download(ctx, feed)
+	if err != nil {
+		log.Printf("feed %s (%s): %v", feed.ID, feed.Name, err)
+	}
+	m.feeds.record(feed.ID, entries, err)
+}
+
+func (m *FeedManager) download(ctx context.Context, feed Feed) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feed.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("GET %s: %s", feed.URL, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, m.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > m.maxBytes {
+		return nil, fmt.Errorf("feed larger than %d bytes", m.maxBytes)
+	}
+
+	var entries []string
+	switch feed.Format {
+	case feedFormatCSV:
+		entries, err = parseCSVFeed(body, feed.Column)
+	case feedFormatSTIX:
+		entries, err = parseSTIXFeed(body)
+	default:
+		entries = parsePlaintextFeed(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sanitizeSlice(entries), nil
+}
+
+// parsePlaintextFeed reads one indicator per line, ignoring blank lines and
+// # or ; comments.
+func parsePlaintextFeed(body []byte) []string {
+	entries := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) > 0 {
+			entries = append(entries, fields[0])
+		}
+	}
+	return entries
+}
+
+// parseCSVFeed reads the indicator column of a CSV feed. column is either a
+// zero-based index or a header name; when it is a name the first row is
+// treated as the header.
+func parseCSVFeed(body []byte, column string) ([]string, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	index := 0
+	if column != "" {
+		if parsed, err := strconv.Atoi(column); err == nil {
+			index = parsed
+		} else {
+			if len(rows) == 0 {
+				return []string{}, nil
+			}
+			index = -1
+			for i, name := range rows[0] {
+				if strings.EqualFold(strings.TrimSpace(name), column) {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				return nil, fmt.Errorf("column %q not found in header", column)
+			}
+			rows = rows[1:]
+		}
+	}
+
+	entries := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if index < len(row) {
+			entries = append(entries, row[index])
+		}
+	}
+	return entries, nil
+}
+
+var stixComparison = regexp.MustCompile(`(?:ipv4-addr|ipv6-addr|domain-name|url|email-addr|file:hashes\.[\w'-]+)[\w.:]*\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// parseSTIXFeed extracts indicator values from a STIX 2.x bundle: equality
+// comparisons in indicator patterns and the values of observable objects.
+func parseSTIXFeed(body []byte) ([]string, error) {
+	var bundle struct {
+		Type    string           `json:"type"`
+		Objects []map[string]any `json:"objects"`
+	}
+	if err := json.Unmarshal(body, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid STIX bundle: %w", err)
+	}
+
+	entries := []string{}
+	for _, object := range bundle.Objects {
+		switch object["type"] {
+		case "indicator":
+			pattern, _ := object["pattern"].(string)
+			for _, match := range stixComparison.FindAllStringSubmatch(pattern, -1) {
+				entries = append(entries, strings.ReplaceAll(match[1], `\'`, `'`))
+			}
+		case "ipv4-addr", "ipv6-addr", "domain-name", "url", "email-addr":
+			if value, ok := object["value"].(string); ok {
+				entries = append(entries, value)
+			}
+		case "file":
+			if hashes, ok := object["hashes"].(map[string]any); ok {
+				for _, value := range hashes {
+					if hash, ok := value.(string); ok {
+						entries = append(entries, hash)
+					}
+				}
+			}
+		}
+	}
+	return entries, nil
+}
+
+func feedsHandler(feeds *FeedStore, manager *FeedManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReadRequest(r) && (!requireRole(w, r, roleAdmin) || !requireSharedConfig(w, r)) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"items": feeds.list()})
+		case http.MethodPost:
+			var input FeedInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			feed, err := feeds.create(input)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			if feed.Enabled {
+				go manager.refresh(context.WithoutCancel(r.Context()), feed.ID)
+			}
+			writeJSON(w, http.StatusCreated, feed)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func feedHandler(feeds *FeedStore, manager *FeedManager, store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/feeds/"), "/")
+		id := parts[0]
+		if id == "" || len(parts) > 2 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !isReadRequest(r) && (!requireRole(w, r, roleAdmin) || !requireSharedConfig(w, r)) {
+			return
+		}
+
+		if len(parts) == 2 {
+			if parts[1] != "refresh" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			feed, err := manager.refresh(r.Context(), id)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, feed)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			feed, ok := feeds.get(id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, feed)
+		case http.MethodPut:
+			var input FeedInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			feed, err := feeds.update(id, input)
+			if errors.Is(err, errFeedNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			store.reannotate()
+			writeJSON(w, http.StatusOK, feed)
+		case http.MethodDelete:
+			if err := feeds.delete(id); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			store.reannotate()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// FieldChange is one value a tracked incident field took on, and who set it.
+// By is empty for changes made by the server itself.
+type FieldChange struct {
+	Field string    `json:"field"`
+	Value string    `json:"value"`
+	At    time.Time `json:"at"`
+	By    string    `json:"by,omitempty"`
+	ByID  string    `json:"byId,omitempty"`
+}
+
+// trackedFields are the incident attributes whose history is kept.
+var trackedFields = []string{"severity", "status", "owner", "killChainPhase"}
+
+func trackedValue(incident *Incident, field string) string {
+	switch field {
+	case "severity":
+		return incident.Severity
+	case "status":
+		return incident.Status
+	case "owner":
+		return incident.Owner
+	case "killChainPhase":
+		return incident.KillChainPhase
+	}
+	return ""
+}
+
+func isTrackedField(field string) bool {
+	for _, candidate := range trackedFields {
+		if candidate == field {
+			return true
+		}
+	}
+	return false
+}
+
+// actor names the caller for change attribution.
+func actor(ctx context.Context) (name, id string) {
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		return "", ""
+	}
+	return principal.displayName(), principal.ID
+}
+
+// recordChanges appends history entries for tracked fields that differ from
+// previous (or all of them when previous is nil). Callers must hold s.mu.
+func recordChanges(incident *Incident, previous *Incident, at time.Time, by, byID string) {
+	for _, field := range trackedFields {
+		value := trackedValue(incident, field)
+		if previous != nil && trackedValue(previous, field) == value {
+			continue
+		}
+		incident.history = append(append([]FieldChange{}, incident.history...), FieldChange{Field: field, Value: value, At: at, By: by, ByID: byID})
+	}
+}
+
+// FieldHistoryEntry is a FieldChange with the value it replaced.
+type FieldHistoryEntry struct {
+	Value    string    `json:"value"`
+	Previous string    `json:"previous,omitempty"`
+	At       time.Time `json:"at"`
+	By       string    `json:"by,omitempty"`
+	ByID     string    `json:"byId,omitempty"`
+}
+
+func fieldHistory(incident *Incident, field string) []FieldHistoryEntry {
+	entries := []FieldHistoryEntry{}
+	previous := ""
+	for _, change := range incident.history {
+		if change.Field != field {
+			continue
+		}
+		entries = append(entries, FieldHistoryEntry{Value: change.Value, Previous: previous, At: change.At, By: change.By, ByID: change.ByID})
+		previous = change.Value
+	}
+	return entries
+}
+
+func handleIncidentFieldHistory(w http.ResponseWriter, r *http.Request, id, field string, store *IncidentStore, access *AccessLog) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isTrackedField(field) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "history is kept for severity, status, and owner"})
+		return
+	}
+	incident, ok := store.get(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	access.record(r, id, accessView)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"incidentId": id,
+		"field":      field,
+		"items":      fieldHistory(incident, field),
+	})
+}
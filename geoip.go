@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// GeoIP annotates addresses with location and network ownership from local
+// MaxMind GeoLite2 databases, so no lookup ever leaves the host.
+type GeoIP struct {
+	city *mmdbReader
+	asn  *mmdbReader
+}
+
+type GeoLocation struct {
+	Country     string  `json:"country,omitempty"`
+	CountryName string  `json:"countryName,omitempty"`
+	City        string  `json:"city,omitempty"`
+	Latitude    float64 `json:"latitude,omitempty"`
+	Longitude   float64 `json:"longitude,omitempty"`
+	ASN         uint64  `json:"asn,omitempty"`
+	ASOrg       string  `json:"asOrg,omitempty"`
+}
+
+type GeoCount struct {
+	Country     string   `json:"country"`
+	CountryName string   `json:"countryName,omitempty"`
+	IOCs        int      `json:"iocs"`
+	Incidents   int      `json:"incidents"`
+	Values      []string `json:"values"`
+}
+
+func newGeoIPFromEnv() *GeoIP {
+	cityPath := envString("GEOIP_CITY_DB", "")
+	asnPath := envString("GEOIP_ASN_DB", "")
+	if cityPath == "" && asnPath == "" {
+		return nil
+	}
+
+	geo := &GeoIP{}
+	if cityPath != "" {
+		reader, err := openMMDB(cityPath)
+		if err != nil {
+			log.Printf("geoip: %v", err)
+		} else {
+			geo.city = reader
+		}
+	}
+	if asnPath != "" {
+		reader, err := openMMDB(asnPath)
+		if err != nil {
+			log.Printf("geoip: %v", err)
+		} else {
+			geo.asn = reader
+		}
+	}
+	if geo.city == nil && geo.asn == nil {
+		return nil
+	}
+	return geo
+}
+
+func (g *GeoIP) locate(value string) (GeoLocation, bool, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(value))
+	if err != nil {
+		return GeoLocation{}, false, err
+	}
+
+	location := GeoLocation{}
+	found := false
+	if g.city != nil {
+		record, err := g.city.lookup(addr)
+		if err != nil {
+			return GeoLocation{}, false, err
+		}
+		if record != nil {
+			found = true
+			location.Country, _ = mmdbPath(record, "country", "iso_code").(string)
+			location.CountryName, _ = mmdbPath(record, "country", "names", "en").(string)
+			location.City, _ = mmdbPath(record, "city", "names", "en").(string)
+			location.Latitude, _ = mmdbPath(record, "location", "latitude").(float64)
+			location.Longitude, _ = mmdbPath(record, "location", "longitude").(float64)
+		}
+	}
+	if g.asn != nil {
+		record, err := g.asn.lookup(addr)
+		if err != nil {
+			return GeoLocation{}, false, err
+		}
+		if record != nil {
+			found = true
+			location.ASN = asUint(record["autonomous_system_number"])
+			location.ASOrg, _ = record["autonomous_system_organization"].(string)
+		}
+	}
+	return location, found, nil
+}
+
+func (g *GeoIP) name() string { return "geoip" }
+
+func (g *GeoIP) supports(ioc string) bool {
+	return iocType(ioc) == iocIP && isPublicIP(ioc)
+}
+
+func (g *GeoIP) lookup(ctx context.Context, ioc string) (map[string]any, error) {
+	location, found, err := g.locate(ioc)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("address not in GeoIP database")
+	}
+	return map[string]any{
+		"country":     location.Country,
+		"countryName": location.CountryName,
+		"city":        location.City,
+		"latitude":    location.Latitude,
+		"longitude":   location.Longitude,
+		"asn":         location.ASN,
+		"asOrg":       location.ASOrg,
+	}, nil
+}
+
+// aggregate counts distinct IP IOCs per country across incidents. Addresses
+// that are private or missing from the database are reported as "unknown".
+func (g *GeoIP) aggregate(items []Incident) []GeoCount {
+	byCountry := make(map[string]*GeoCount)
+	seen := make(map[string]bool)
+	incidentSeen := make(map[string]bool)
+
+	for _, incident := range items {
+		for _, ioc := range incident.IOCs {
+			if iocType(ioc) != iocIP {
+				continue
+			}
+			country, countryName := "unknown", ""
+			if isPublicIP(ioc) {
+				if location, found, err := g.locate(ioc); err == nil && found && location.Country != "" {
+					country, countryName = location.Country, location.CountryName
+				}
+			}
+
+			entry, ok := byCountry[country]
+			if !ok {
+				entry = &GeoCount{Country: country, CountryName: countryName, Values: []string{}}
+				byCountry[country] = entry
+			}
+			if !seen[country+"|"+ioc] {
+				seen[country+"|"+ioc] = true
+				entry.IOCs++
+				entry.Values = append(entry.Values, ioc)
+			}
+			if !incidentSeen[country+"|"+incident.ID] {
+				incidentSeen[country+"|"+incident.ID] = true
+				entry.Incidents++
+			}
+		}
+	}
+
+	counts := make([]GeoCount, 0, len(byCountry))
+	for _, entry := range byCountry {
+		counts = append(counts, *entry)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].IOCs != counts[j].IOCs {
+			return counts[i].IOCs > counts[j].IOCs
+		}
+		return counts[i].Country < counts[j].Country
+	})
+	return counts
+}
+
+func geoAggregateHandler(store *IncidentStore, geo *GeoIP) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if geo == nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "geoip database not configured"})
+			return
+		}
+		query := r.URL.Query()
+		items := filterIncidents(visibleTo(r, store.list()), query.Get("severity"), query.Get("status"), query.Get("q"))
+		writeJSON(w, http.StatusOK, map[string]any{"items": geo.aggregate(items)})
+	}
+}
@@ -1,3 +1,3 @@
 module web-app
 
-go 1.22
+go 1.24
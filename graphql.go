@@ -0,0 +1,1132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This file is the GraphQL language: a parser for query documents and an
+// executor that resolves selections against Go values by their JSON field
+// names, so the GraphQL types are the REST types and can't drift from them.
+// Queries, variables, aliases, fragments, and @include/@skip are supported;
+// mutations and subscriptions are not, since changes go through REST.
+
+// GraphQLError is an error in the shape of the GraphQL response errors list.
+type GraphQLError struct {
+	Message   string            `json:"message"`
+	Locations []GraphQLLocation `json:"locations,omitempty"`
+	Path      []any             `json:"path,omitempty"`
+}
+
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (e *GraphQLError) Error() string { return e.Message }
+
+type gqlToken struct {
+	kind byte // 'n' name, 'i' int, 'f' float, 's' string, 'p' punctuator, 0 end
+	text string
+	pos  int
+}
+
+func gqlLex(src string) ([]gqlToken, error) {
+	tokens := []gqlToken{}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, gqlToken{'p', "...", i})
+			i += 3
+		case strings.ContainsRune("!$&()=:@[]{}|", rune(c)):
+			tokens = append(tokens, gqlToken{'p', string(c), i})
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(src) && isGQLNameChar(src[i]) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{'n', src[start:i], start})
+		case c == '-' || c >= '0' && c <= '9':
+			start := i
+			kind := byte('i')
+			if c == '-' {
+				i++
+			}
+			for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+				i++
+			}
+			if i < len(src) && src[i] == '.' {
+				kind = 'f'
+				i++
+				for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+					i++
+				}
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				kind = 'f'
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+					i++
+				}
+			}
+			text := src[start:i]
+			if text == "-" || i < len(src) && isGQLNameChar(src[i]) {
+				return nil, gqlSyntaxError(src, start, "invalid number")
+			}
+			tokens = append(tokens, gqlToken{kind, text, start})
+		case strings.HasPrefix(src[i:], `"""`):
+			end := i + 3
+			for end < len(src) && !strings.HasPrefix(src[end:], `"""`) {
+				if strings.HasPrefix(src[end:], `\"""`) {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, gqlSyntaxError(src, i, "unterminated block string")
+			}
+			raw := strings.ReplaceAll(src[i+3:end], `\"""`, `"""`)
+			tokens = append(tokens, gqlToken{'s', gqlBlockString(raw), i})
+			i = end + 3
+		case c == '"':
+			value, n, err := gqlString(src[i:])
+			if err != nil {
+				return nil, gqlSyntaxError(src, i, err.Error())
+			}
+			tokens = append(tokens, gqlToken{'s', value, i})
+			i += n
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, gqlSyntaxError(src, i, fmt.Sprintf("unexpected character %q", r))
+		}
+	}
+	return append(tokens, gqlToken{pos: len(src)}), nil
+}
+
+func isGQLNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// gqlString reads a "..." string, returning its value and length.
+func gqlString(src string) (string, int, error) {
+	var value strings.Builder
+	for i := 1; i < len(src); i++ {
+		switch c := src[i]; c {
+		case '"':
+			return value.String(), i + 1, nil
+		case '\n', '\r':
+			return "", 0, errors.New("unterminated string")
+		case '\\':
+			i++
+			if i >= len(src) {
+				return "", 0, errors.New("unterminated string")
+			}
+			switch e := src[i]; e {
+			case '"', '\\', '/':
+				value.WriteByte(e)
+			case 'b':
+				value.WriteByte('\b')
+			case 'f':
+				value.WriteByte('\f')
+			case 'n':
+				value.WriteByte('\n')
+			case 'r':
+				value.WriteByte('\r')
+			case 't':
+				value.WriteByte('\t')
+			case 'u':
+				if i+4 >= len(src) {
+					return "", 0, errors.New("invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(src[i+1:i+5], 16, 32)
+				if err != nil {
+					return "", 0, errors.New("invalid unicode escape")
+				}
+				value.WriteRune(rune(code))
+				i += 4
+			default:
+				return "", 0, fmt.Errorf("invalid escape \\%c", e)
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
+
+// gqlBlockString removes a block string's common indentation and its
+// leading and trailing blank lines.
+func gqlBlockString(raw string) string {
+	lines := strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(raw), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		lines[i] = lines[i][min(indent, len(lines[i])):]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func gqlSyntaxError(src string, pos int, message string) *GraphQLError {
+	line := 1 + strings.Count(src[:pos], "\n")
+	column := pos - strings.LastIndex(src[:pos], "\n")
+	return &GraphQLError{Message: "syntax error: " + message, Locations: []GraphQLLocation{{line, column}}}
+}
+
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+type gqlOperation struct {
+	kind       string
+	name       string
+	variables  []gqlVariable
+	selections []gqlSelection
+}
+
+type gqlVariable struct {
+	name       string
+	nonNull    bool
+	def        any
+	hasDefault bool
+}
+
+type gqlFragment struct {
+	on         string
+	selections []gqlSelection
+}
+
+// gqlSelection is a field, a fragment spread (fragment set), or an inline
+// fragment (inline set, with on its optional type condition).
+type gqlSelection struct {
+	alias      string
+	name       string
+	args       map[string]any
+	fragment   string
+	inline     bool
+	on         string
+	directives map[string]map[string]any
+	selections []gqlSelection
+}
+
+func (s gqlSelection) key() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// gqlVariableRef is a $variable in a value, replaced when the operation
+// runs.
+type gqlVariableRef string
+
+type gqlParser struct {
+	src    string
+	tokens []gqlToken
+	pos    int
+}
+
+func parseGraphQL(src string) (*gqlDocument, error) {
+	src = strings.TrimPrefix(src, "\ufeff")
+	tokens, err := gqlLex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{src: src, tokens: tokens}
+	doc := &gqlDocument{fragments: map[string]*gqlFragment{}}
+	for p.peek().kind != 0 {
+		switch {
+		case p.peekPunct("{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: selections})
+		case p.peekName("query"), p.peekName("mutation"), p.peekName("subscription"):
+			operation, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, operation)
+		case p.peekName("fragment"):
+			p.pos++
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if name == "on" {
+				return nil, p.errorf("a fragment can't be named on")
+			}
+			if err := p.expectName("on"); err != nil {
+				return nil, err
+			}
+			on, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.directives(); err != nil {
+				return nil, err
+			}
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[name]; ok {
+				return nil, &GraphQLError{Message: "fragment " + name + " is defined more than once"}
+			}
+			doc.fragments[name] = &gqlFragment{on: on, selections: selections}
+		default:
+			return nil, p.errorf("expected an operation or fragment, got %q", p.peek().text)
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, &GraphQLError{Message: "the document has no operations"}
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) peek() gqlToken { return p.tokens[p.pos] }
+
+func (p *gqlParser) peekPunct(text string) bool {
+	token := p.peek()
+	return token.kind == 'p' && token.text == text
+}
+
+func (p *gqlParser) peekName(text string) bool {
+	token := p.peek()
+	return token.kind == 'n' && token.text == text
+}
+
+func (p *gqlParser) errorf(format string, args ...any) *GraphQLError {
+	return gqlSyntaxError(p.src, p.peek().pos, fmt.Sprintf(format, args...))
+}
+
+func (p *gqlParser) expect(text string) error {
+	if !p.peekPunct(text) {
+		return p.errorf("expected %s", text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *gqlParser) expectName(text string) error {
+	if !p.peekName(text) {
+		return p.errorf("expected %s", text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	token := p.peek()
+	if token.kind != 'n' {
+		return "", p.errorf("expected a name")
+	}
+	p.pos++
+	return token.text, nil
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	operation := &gqlOperation{kind: p.peek().text}
+	p.pos++
+	if p.peek().kind == 'n' {
+		operation.name = p.peek().text
+		p.pos++
+	}
+	if p.peekPunct("(") {
+		p.pos++
+		for !p.peekPunct(")") {
+			if err := p.expect("$"); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			nonNull, err := p.variableType()
+			if err != nil {
+				return nil, err
+			}
+			variable := gqlVariable{name: name, nonNull: nonNull}
+			if p.peekPunct("=") {
+				p.pos++
+				if variable.def, err = p.value(true); err != nil {
+					return nil, err
+				}
+				variable.hasDefault = true
+			}
+			if _, err := p.directives(); err != nil {
+				return nil, err
+			}
+			operation.variables = append(operation.variables, variable)
+		}
+		p.pos++
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	operation.selections = selections
+	return operation, nil
+}
+
+// variableType skips over a variable's type, reporting whether it is
+// non-null. Values are checked against the arguments they are passed to.
+func (p *gqlParser) variableType() (bool, error) {
+	if p.peekPunct("[") {
+		p.pos++
+		if _, err := p.variableType(); err != nil {
+			return false, err
+		}
+		if err := p.expect("]"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.name(); err != nil {
+		return false, err
+	}
+	if p.peekPunct("!") {
+		p.pos++
+		return true, nil
+	}
+	return false, nil
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	selections := []gqlSelection{}
+	for !p.peekPunct("}") {
+		if p.peek().kind == 0 {
+			return nil, p.errorf("expected }")
+		}
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	p.pos++
+	if len(selections) == 0 {
+		return nil, p.errorf("a selection set can't be empty")
+	}
+	return selections, nil
+}
+
+func (p *gqlParser) selection() (gqlSelection, error) {
+	var selection gqlSelection
+	var err error
+	if p.peekPunct("...") {
+		p.pos++
+		if p.peek().kind == 'n' && !p.peekName("on") {
+			selection.fragment = p.peek().text
+			p.pos++
+			selection.directives, err = p.directives()
+			return selection, err
+		}
+		selection.inline = true
+		if p.peekName("on") {
+			p.pos++
+			if selection.on, err = p.name(); err != nil {
+				return selection, err
+			}
+		}
+		if selection.directives, err = p.directives(); err != nil {
+			return selection, err
+		}
+		selection.selections, err = p.selectionSet()
+		return selection, err
+	}
+	if selection.name, err = p.name(); err != nil {
+		return selection, err
+	}
+	if p.peekPunct(":") {
+		p.pos++
+		selection.alias = selection.name
+		if selection.name, err = p.name(); err != nil {
+			return selection, err
+		}
+	}
+	if selection.args, err = p.arguments(); err != nil {
+		return selection, err
+	}
+	if selection.directives, err = p.directives(); err != nil {
+		return selection, err
+	}
+	if p.peekPunct("{") {
+		selection.selections, err = p.selectionSet()
+	}
+	return selection, err
+}
+
+func (p *gqlParser) arguments() (map[string]any, error) {
+	if !p.peekPunct("(") {
+		return nil, nil
+	}
+	p.pos++
+	args := map[string]any{}
+	for !p.peekPunct(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if _, ok := args[name]; ok {
+			return nil, p.errorf("argument %s is given more than once", name)
+		}
+		if args[name], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	p.pos++
+	return args, nil
+}
+
+func (p *gqlParser) directives() (map[string]map[string]any, error) {
+	var directives map[string]map[string]any
+	for p.peekPunct("@") {
+		p.pos++
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		if directives == nil {
+			directives = map[string]map[string]any{}
+		}
+		directives[name] = args
+	}
+	return directives, nil
+}
+
+// value reads a literal; const values, such as variable defaults, can't
+// refer to variables.
+func (p *gqlParser) value(constant bool) (any, error) {
+	token := p.peek()
+	switch {
+	case token.kind == 'p' && token.text == "$" && !constant:
+		p.pos++
+		name, err := p.name()
+		return gqlVariableRef(name), err
+	case token.kind == 'i':
+		p.pos++
+		value, err := strconv.Atoi(token.text)
+		if err != nil {
+			return nil, p.errorf("integer %s is out of range", token.text)
+		}
+		return value, nil
+	case token.kind == 'f':
+		p.pos++
+		return strconv.ParseFloat(token.text, 64)
+	case token.kind == 's':
+		p.pos++
+		return token.text, nil
+	case token.kind == 'n':
+		p.pos++
+		switch token.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		// Enum values are passed on as their names.
+		return token.text, nil
+	case token.kind == 'p' && token.text == "[":
+		p.pos++
+		items := []any{}
+		for !p.peekPunct("]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		p.pos++
+		return items, nil
+	case token.kind == 'p' && token.text == "{":
+		p.pos++
+		fields := map[string]any{}
+		for !p.peekPunct("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if fields[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		p.pos++
+		return fields, nil
+	}
+	return nil, p.errorf("expected a value")
+}
+
+// gqlArg declares an argument as its GraphQL type, e.g. String or Int!.
+type gqlArg struct {
+	name string
+	typ  string
+}
+
+// gqlRootField is a field of the Query type.
+type gqlRootField struct {
+	name        string
+	description string
+	args        []gqlArg
+	typ         reflect.Type
+	resolve     func(args map[string]any) (any, error)
+}
+
+// gqlComputed overrides a type's field, for values the REST API only fills
+// in for some responses, such as rendered note bodies.
+type gqlComputed func(typ reflect.Type, field string, parent reflect.Value) (any, bool)
+
+// gqlExecutor runs one operation.
+type gqlExecutor struct {
+	doc       *gqlDocument
+	variables map[string]any
+	computed  gqlComputed
+	maxFields int
+	fields    int
+	errors    []GraphQLError
+}
+
+// gqlObject is a result object, which keeps its fields in the order they
+// were selected.
+type gqlObject struct {
+	keys   []string
+	values []any
+}
+
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		value, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// selectOperation picks the operation to run and checks its variables,
+// filling in defaults.
+func (doc *gqlDocument) selectOperation(name string, variables map[string]any) (*gqlOperation, map[string]any, error) {
+	var operation *gqlOperation
+	for _, candidate := range doc.operations {
+		if name == "" && len(doc.operations) == 1 || candidate.name == name && name != "" {
+			operation = candidate
+		}
+	}
+	switch {
+	case operation == nil && name == "":
+		return nil, nil, &GraphQLError{Message: "operationName is required when the document has more than one operation"}
+	case operation == nil:
+		return nil, nil, &GraphQLError{Message: "no operation named " + name}
+	case operation.kind != "query":
+		return nil, nil, &GraphQLError{Message: operation.kind + "s are not supported; make changes through the REST API"}
+	}
+	values := map[string]any{}
+	for _, variable := range operation.variables {
+		value, ok := variables[variable.name]
+		switch {
+		case !ok && variable.hasDefault:
+			value = variable.def
+		case variable.nonNull && value == nil:
+			return nil, nil, &GraphQLError{Message: "variable $" + variable.name + " is required"}
+		}
+		values[variable.name] = value
+	}
+	return operation, values, nil
+}
+
+// execute resolves the operation's selections against the root fields.
+func (e *gqlExecutor) execute(operation *gqlOperation, roots []gqlRootField) any {
+	byName := map[string]gqlRootField{}
+	for _, root := range roots {
+		byName[root.name] = root
+	}
+	keys, fields, err := e.collect("Query", operation.selections, map[string]bool{})
+	if err != nil {
+		e.fail(err.Error(), nil)
+		return nil
+	}
+	data := &gqlObject{}
+	for _, key := range keys {
+		field := fields[key][0]
+		path := []any{key}
+		var value any
+		if field.name == "__typename" {
+			value = "Query"
+		} else if root, ok := byName[field.name]; !ok {
+			e.fail(fmt.Sprintf("cannot query field %q on type \"Query\"", field.name), path)
+		} else if args, err := e.arguments(field, root.args); err != nil {
+			e.fail(err.Error(), path)
+		} else if result, err := root.resolve(args); err != nil {
+			e.fail(err.Error(), path)
+		} else {
+			value = e.value(reflect.ValueOf(result), field.name, subselections(fields[key]), path)
+		}
+		data.keys = append(data.keys, key)
+		data.values = append(data.values, value)
+	}
+	return data
+}
+
+// fail records a field error. A mistake in a selection under a list fails
+// for every item alike, so each message is listed once, at its first path.
+func (e *gqlExecutor) fail(message string, path []any) {
+	if slices.ContainsFunc(e.errors, func(err GraphQLError) bool { return err.Message == message }) {
+		return
+	}
+	e.errors = append(e.errors, GraphQLError{Message: message, Path: slices.Clone(path)})
+}
+
+// collect flattens fragments into the fields selected on typeName, by
+// response key, in the order they first appear.
+func (e *gqlExecutor) collect(typeName string, selections []gqlSelection, visiting map[string]bool) ([]string, map[string][]gqlSelection, error) {
+	keys := []string{}
+	fields := map[string][]gqlSelection{}
+	var walk func([]gqlSelection) error
+	walk = func(selections []gqlSelection) error {
+		for _, selection := range selections {
+			include, err := e.included(selection)
+			if err != nil {
+				return err
+			}
+			if !include {
+				continue
+			}
+			switch {
+			case selection.fragment != "":
+				fragment, ok := e.doc.fragments[selection.fragment]
+				if !ok {
+					return errors.New("unknown fragment " + selection.fragment)
+				}
+				if visiting[selection.fragment] {
+					return errors.New("fragment " + selection.fragment + " spreads itself")
+				}
+				if fragment.on != typeName {
+					continue
+				}
+				visiting[selection.fragment] = true
+				err := walk(fragment.selections)
+				delete(visiting, selection.fragment)
+				if err != nil {
+					return err
+				}
+			case selection.inline:
+				if selection.on != "" && selection.on != typeName {
+					continue
+				}
+				if err := walk(selection.selections); err != nil {
+					return err
+				}
+			default:
+				key := selection.key()
+				if _, ok := fields[key]; !ok {
+					keys = append(keys, key)
+				} else if fields[key][0].name != selection.name {
+					return fmt.Errorf("%s selects both %s and %s", key, fields[key][0].name, selection.name)
+				}
+				fields[key] = append(fields[key], selection)
+			}
+		}
+		return nil
+	}
+	err := walk(selections)
+	return keys, fields, err
+}
+
+func subselections(fields []gqlSelection) []gqlSelection {
+	var all []gqlSelection
+	for _, field := range fields {
+		all = append(all, field.selections...)
+	}
+	return all
+}
+
+// included applies @skip(if:) and @include(if:).
+func (e *gqlExecutor) included(selection gqlSelection) (bool, error) {
+	for name, args := range selection.directives {
+		if name != "skip" && name != "include" {
+			return false, errors.New("unknown directive @" + name)
+		}
+		condition, ok := e.resolveValue(args["if"]).(bool)
+		if !ok {
+			return false, errors.New("@" + name + " needs a Boolean if argument")
+		}
+		if condition == (name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (e *gqlExecutor) resolveValue(value any) any {
+	switch v := value.(type) {
+	case gqlVariableRef:
+		return e.variables[string(v)]
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = e.resolveValue(item)
+		}
+		return items
+	case map[string]any:
+		fields := make(map[string]any, len(v))
+		for name, item := range v {
+			fields[name] = e.resolveValue(item)
+		}
+		return fields
+	}
+	return value
+}
+
+// arguments checks a field's arguments against their declarations and
+// coerces them to Go values: String and ID to string, Int to int, and
+// Boolean to bool.
+func (e *gqlExecutor) arguments(field gqlSelection, declared []gqlArg) (map[string]any, error) {
+	args := map[string]any{}
+	for name := range field.args {
+		if !slices.ContainsFunc(declared, func(arg gqlArg) bool { return arg.name == name }) {
+			return nil, fmt.Errorf("unknown argument %q on field %q", name, field.name)
+		}
+	}
+	for _, arg := range declared {
+		value := e.resolveValue(field.args[arg.name])
+		typ, required := strings.CutSuffix(arg.typ, "!")
+		if value == nil {
+			if required {
+				return nil, fmt.Errorf("argument %q of type %s is required", arg.name, arg.typ)
+			}
+			continue
+		}
+		coerced, ok := gqlCoerce(value, typ)
+		if !ok {
+			return nil, fmt.Errorf("argument %q must be %s", arg.name, typ)
+		}
+		args[arg.name] = coerced
+	}
+	return args, nil
+}
+
+func gqlCoerce(value any, typ string) (any, bool) {
+	switch typ {
+	case "String":
+		text, ok := value.(string)
+		return text, ok
+	case "ID":
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case int:
+			return strconv.Itoa(v), true
+		}
+	case "Int":
+		switch v := value.(type) {
+		case int:
+			return v, true
+		case float64:
+			// JSON variables decode as floats.
+			if v == float64(int(v)) {
+				return int(v), true
+			}
+		}
+	case "Boolean":
+		flag, ok := value.(bool)
+		return flag, ok
+	}
+	return nil, false
+}
+
+// gqlListArgs are the arguments every list field takes.
+var gqlListArgs = []gqlArg{{"limit", "Int"}, {"offset", "Int"}}
+
+// value resolves v for the field selected as path with selections.
+func (e *gqlExecutor) value(v reflect.Value, field string, selections []gqlSelection, path []any) any {
+	for v.IsValid() && v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	if _, scalar := gqlScalar(v.Type()); scalar {
+		if len(selections) > 0 {
+			e.fail(fmt.Sprintf("field %q is a scalar and can't have a selection", field), path)
+			return nil
+		}
+		if v.Kind() == reflect.Interface && v.IsNil() {
+			return nil
+		}
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = e.value(v.Index(i), field, selections, append(path, i))
+		}
+		return items
+	case reflect.Struct:
+		if len(selections) == 0 {
+			e.fail(fmt.Sprintf("field %q of type %s needs a selection of subfields", field, v.Type().Name()), path)
+			return nil
+		}
+		return e.object(v, selections, path)
+	}
+	e.fail(fmt.Sprintf("field %q can't be represented", field), path)
+	return nil
+}
+
+func (e *gqlExecutor) object(v reflect.Value, selections []gqlSelection, path []any) any {
+	typ := v.Type()
+	keys, fields, err := e.collect(typ.Name(), selections, map[string]bool{})
+	if err != nil {
+		e.fail(err.Error(), path)
+		return nil
+	}
+	index := gqlFieldIndex(typ)
+	object := &gqlObject{}
+	for _, key := range keys {
+		e.fields++
+		if e.maxFields > 0 && e.fields > e.maxFields {
+			e.fail(fmt.Sprintf("the query selects more than %d fields; narrow it or page through the results", e.maxFields), path)
+			return nil
+		}
+		field := fields[key][0]
+		fieldPath := append(slices.Clone(path), key)
+		var value any
+		if field.name == "__typename" {
+			value = typ.Name()
+		} else if position, ok := index[field.name]; !ok {
+			e.fail(fmt.Sprintf("cannot query field %q on type %q", field.name, typ.Name()), fieldPath)
+		} else {
+			fieldValue := v.FieldByIndex(position)
+			if computed, ok := e.computed(typ, field.name, v); ok {
+				fieldValue = reflect.ValueOf(computed)
+			}
+			if fieldValue, err = e.page(fieldValue, field); err != nil {
+				e.fail(err.Error(), fieldPath)
+			} else {
+				value = e.value(fieldValue, field.name, subselections(fields[key]), fieldPath)
+			}
+		}
+		object.keys = append(object.keys, key)
+		object.values = append(object.values, value)
+	}
+	return object
+}
+
+// page applies limit and offset to a list field.
+func (e *gqlExecutor) page(v reflect.Value, field gqlSelection) (reflect.Value, error) {
+	if len(field.args) == 0 {
+		return v, nil
+	}
+	if v.Kind() != reflect.Slice {
+		_, err := e.arguments(field, nil)
+		return v, err
+	}
+	args, err := e.arguments(field, gqlListArgs)
+	if err != nil {
+		return v, err
+	}
+	offset, _ := args["offset"].(int)
+	start := min(max(offset, 0), v.Len())
+	end := v.Len()
+	if limit, ok := args["limit"].(int); ok {
+		end = min(start+max(limit, 0), end)
+	}
+	return v.Slice(start, end), nil
+}
+
+// gqlScalar names the GraphQL scalar a Go type resolves as, if it is one.
+// Maps, interfaces, and unnamed structs have no fixed shape, so they are
+// returned whole as JSON.
+func gqlScalar(t reflect.Type) (string, bool) {
+	if t == timeType {
+		return "DateTime", true
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "String", true
+	case reflect.Bool:
+		return "Boolean", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "Int", true
+	case reflect.Float32, reflect.Float64:
+		return "Float", true
+	case reflect.Map, reflect.Interface:
+		return "JSON", true
+	case reflect.Slice:
+		return "JSON", t.Elem().Kind() == reflect.Uint8
+	case reflect.Struct:
+		return "JSON", t.Name() == ""
+	}
+	return "", false
+}
+
+// gqlFieldIndex maps a struct's JSON field names to their fields, the
+// way encoding/json sees them.
+func gqlFieldIndex(t reflect.Type) map[string][]int {
+	index := map[string][]int{}
+	for _, field := range gqlFields(t) {
+		index[field.name] = field.index
+	}
+	return index
+}
+
+type gqlStructField struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+func gqlFields(t reflect.Type) []gqlStructField {
+	fields := []gqlStructField{}
+	var walk func(reflect.Type, []int)
+	walk = func(t reflect.Type, parent []int) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			index := append(append([]int{}, parent...), i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				walk(field.Type, index)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			fields = append(fields, gqlStructField{name: name, index: index, typ: field.Type})
+		}
+	}
+	walk(t, nil)
+	return fields
+}
+
+// graphQLSchemaSDL describes roots and every type reachable from them in
+// the GraphQL schema language, for client generators and editors.
+func graphQLSchemaSDL(roots []gqlRootField) string {
+	var out strings.Builder
+	out.WriteString("scalar DateTime\n\n\"Any JSON value.\"\nscalar JSON\n\ntype Query {\n")
+	seen := map[reflect.Type]bool{}
+	queue := []reflect.Type{}
+	var ref func(reflect.Type) string
+	ref = func(t reflect.Type) string {
+		if t.Kind() == reflect.Pointer {
+			return strings.TrimSuffix(ref(t.Elem()), "!")
+		}
+		if name, ok := gqlScalar(t); ok {
+			if name == "JSON" && t.Kind() != reflect.Struct {
+				return name
+			}
+			return name + "!"
+		}
+		switch t.Kind() {
+		case reflect.Slice:
+			return "[" + ref(t.Elem()) + "]"
+		case reflect.Array:
+			return "[" + ref(t.Elem()) + "]!"
+		}
+		if !seen[t] {
+			seen[t] = true
+			queue = append(queue, t)
+		}
+		return t.Name() + "!"
+	}
+	for _, root := range roots {
+		if root.description != "" {
+			fmt.Fprintf(&out, "  %s\n", strconv.Quote(root.description))
+		}
+		out.WriteString("  " + root.name)
+		if len(root.args) > 0 {
+			args := make([]string, len(root.args))
+			for i, arg := range root.args {
+				args[i] = arg.name + ": " + arg.typ
+			}
+			out.WriteString("(" + strings.Join(args, ", ") + ")")
+		}
+		out.WriteString(": " + ref(root.typ) + "\n")
+	}
+	out.WriteString("}\n")
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		fmt.Fprintf(&out, "\ntype %s {\n", t.Name())
+		for _, field := range gqlFields(t) {
+			args := ""
+			if _, scalar := gqlScalar(field.typ); field.typ.Kind() == reflect.Slice && !scalar {
+				args = "(limit: Int, offset: Int)"
+			}
+			fmt.Fprintf(&out, "  %s%s: %s\n", field.name, args, ref(field.typ))
+		}
+		out.WriteString("}\n")
+	}
+	return out.String()
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const graphQLPath = "/api/graphql"
+
+// GraphQLAPI answers GraphQL queries over incidents, their notes and IOCs,
+// and the dashboard aggregations. Every type is the REST response type, so
+// a field is available in GraphQL under the name it has in REST.
+type GraphQLAPI struct {
+	store     *IncidentStore
+	reads     ReadSources
+	access    *AccessLog
+	settings  *SettingsStore
+	teams     *TeamStore
+	users     *UserStore
+	maxFields int
+	schema    func() string
+}
+
+// IOCCount is how many of the caller's incidents carry an indicator.
+type IOCCount struct {
+	Value string `json:"value"`
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+// IOCIncidents is an indicator with the incidents that carry it.
+type IOCIncidents struct {
+	Value     string     `json:"value"`
+	Type      string     `json:"type"`
+	Incidents []Incident `json:"incidents"`
+}
+
+// newGraphQLAPI reads GRAPHQL_MAX_FIELDS, the most fields one query may
+// resolve, which keeps a query aliasing the incident list many times from
+// building an enormous response.
+func newGraphQLAPI(store *IncidentStore, reads ReadSources, access *AccessLog, settings *SettingsStore, teams *TeamStore, users *UserStore) *GraphQLAPI {
+	api := &GraphQLAPI{
+		store:     store,
+		reads:     reads,
+		access:    access,
+		settings:  settings,
+		teams:     teams,
+		users:     users,
+		maxFields: envInt("GRAPHQL_MAX_FIELDS", 100000),
+	}
+	api.schema = sync.OnceValue(func() string { return graphQLSchemaSDL(api.roots(nil)) })
+	return api
+}
+
+// incidentFilterArgs are the incident list filters, named as the REST list
+// endpoint's query parameters.
+var incidentFilterArgs = []gqlArg{
+	{"q", "String"}, {"query", "String"}, {"status", "String"}, {"severity", "String"},
+	{"killChainPhase", "String"}, {"slaBreached", "Boolean"}, {"team", "String"},
+}
+
+// roots are the Query fields for a request.
+func (g *GraphQLAPI) roots(r *http.Request) []gqlRootField {
+	return []gqlRootField{
+		{
+			name:        "incidents",
+			description: "Incidents the caller can see, filtered and paged like GET /api/incidents.",
+			args:        append(slices.Clone(incidentFilterArgs), gqlArg{"sort", "String"}, gqlArg{"includeClosed", "Boolean"}, gqlArg{"limit", "Int"}, gqlArg{"offset", "Int"}),
+			typ:         reflect.TypeOf(IncidentPage{}),
+			resolve: func(args map[string]any) (any, error) {
+				list := listRequest(r, args)
+				capture := &fieldErrorWriter{}
+				items, err := g.filtered(capture, list, g.reads.List)
+				if err != nil {
+					return nil, err
+				}
+				page, ok := applyListSettings(capture, list, items, g.settings.get())
+				if !ok {
+					return nil, capture.err()
+				}
+				addAging(page.Items, visibleTo(r, g.reads.List.list()), time.Now().UTC())
+				return page, nil
+			},
+		},
+		{
+			name:        "incident",
+			description: "One incident, or null if it doesn't exist or the caller can't see it. Reading it is recorded in the access log.",
+			args:        []gqlArg{{"id", "ID!"}},
+			typ:         reflect.TypeOf(&Incident{}),
+			resolve: func(args map[string]any) (any, error) {
+				id := args["id"].(string)
+				incident, ok := g.store.get(id)
+				if !ok || !canView(r, *incident) {
+					return nil, nil
+				}
+				g.access.record(r, id, accessView)
+				return incident, nil
+			},
+		},
+		{
+			name:        "stats",
+			description: "Counts by severity, status, and kill chain phase, like GET /api/stats.",
+			args:        incidentFilterArgs,
+			typ:         reflect.TypeOf(IncidentStats{}),
+			resolve: func(args map[string]any) (any, error) {
+				items, err := g.filtered(&fieldErrorWriter{}, listRequest(r, args), g.reads.Stats)
+				if err != nil {
+					return nil, err
+				}
+				return buildIncidentStats(items), nil
+			},
+		},
+		{
+			name:        "tags",
+			description: "Tags with the number of incidents carrying each.",
+			typ:         reflect.TypeOf([]TagUsage{}),
+			resolve: func(args map[string]any) (any, error) {
+				return tagUsage(visibleTo(r, g.store.list())), nil
+			},
+		},
+		{
+			name:        "iocs",
+			description: "Indicators across the matching incidents, most common first.",
+			args:        append(slices.Clone(incidentFilterArgs), gqlArg{"type", "String"}, gqlArg{"limit", "Int"}),
+			typ:         reflect.TypeOf([]IOCCount{}),
+			resolve: func(args map[string]any) (any, error) {
+				kind, _ := args["type"].(string)
+				limit, hasLimit := args["limit"].(int)
+				delete(args, "type")
+				delete(args, "limit")
+				items, err := g.filtered(&fieldErrorWriter{}, listRequest(r, args), g.reads.List)
+				if err != nil {
+					return nil, err
+				}
+				counts := iocCounts(items, kind)
+				if hasLimit && limit >= 0 && limit < len(counts) {
+					counts = counts[:limit]
+				}
+				return counts, nil
+			},
+		},
+		{
+			name:        "ioc",
+			description: "An indicator and the incidents that carry it.",
+			args:        []gqlArg{{"value", "String!"}},
+			typ:         reflect.TypeOf(IOCIncidents{}),
+			resolve: func(args map[string]any) (any, error) {
+				value := strings.TrimSpace(args["value"].(string))
+				return IOCIncidents{Value: value, Type: iocType(value), Incidents: visibleTo(r, g.store.incidentsWithIOC(value))}, nil
+			},
+		},
+	}
+}
+
+// filtered runs the incident list filters over source.
+func (g *GraphQLAPI) filtered(capture *fieldErrorWriter, list *http.Request, source incidentSource) ([]Incident, error) {
+	items, ok := listIncidents(capture, list, source)
+	if !ok {
+		return nil, capture.err()
+	}
+	team := list.URL.Query().Get("team")
+	if items, ok = filterByTeam(items, team, g.teams, g.users); !ok {
+		return nil, errors.New("unknown team " + team)
+	}
+	return items, nil
+}
+
+// computed fills in the fields REST adds to some responses only: rendered
+// note bodies, note threads, and link summaries.
+func (g *GraphQLAPI) computed(r *http.Request) gqlComputed {
+	return func(typ reflect.Type, field string, parent reflect.Value) (any, bool) {
+		switch {
+		case typ == reflect.TypeOf(Note{}) && field == "bodyHtml":
+			return renderMarkdown(parent.Interface().(Note).Body), true
+		case typ == reflect.TypeOf(Incident{}) && field == "noteThreads":
+			return threadNotes(parent.Interface().(Incident).Notes), true
+		case typ == reflect.TypeOf(Incident{}) && field == "links":
+			return resolveLinks(r, g.store, parent.Interface().(Incident).Links), true
+		}
+		return nil, false
+	}
+}
+
+// iocCounts counts each indicator once per incident, optionally only those
+// of one type (ip, domain, hash, or other).
+func iocCounts(items []Incident, kind string) []IOCCount {
+	counts := map[string]*IOCCount{}
+	for _, incident := range items {
+		seen := map[string]bool{}
+		for _, ioc := range incident.IOCs {
+			key := normalizeIOC(ioc)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			count, ok := counts[key]
+			if !ok {
+				count = &IOCCount{Value: strings.TrimSpace(ioc), Type: iocType(ioc)}
+				counts[key] = count
+			}
+			count.Count++
+		}
+	}
+	result := []IOCCount{}
+	for _, count := range counts {
+		if kind == "" || strings.EqualFold(count.Type, kind) {
+			result = append(result, *count)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
+
+// listRequest is r with a field's arguments as its query string, so the
+// REST list helpers parse and validate them exactly as they do for REST.
+func listRequest(r *http.Request, args map[string]any) *http.Request {
+	values := url.Values{}
+	for name, value := range args {
+		values.Set(name, fmt.Sprint(value))
+	}
+	list := r.Clone(r.Context())
+	list.URL.RawQuery = values.Encode()
+	return list
+}
+
+// fieldErrorWriter keeps the error a REST helper writes so it can be
+// reported on the GraphQL field instead.
+type fieldErrorWriter struct {
+	header  http.Header
+	message string
+}
+
+func (f *fieldErrorWriter) Header() http.Header {
+	if f.header == nil {
+		f.header = http.Header{}
+	}
+	return f.header
+}
+
+func (f *fieldErrorWriter) WriteHeader(int) {}
+
+func (f *fieldErrorWriter) Write(body []byte) (int, error) {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(body, &payload)
+	f.message = payload.Error
+	return len(body), nil
+}
+
+func (f *fieldErrorWriter) err() error {
+	return errors.New(fallback(f.message, "invalid arguments"))
+}
+
+// GraphQLRequest is a query as GraphQL clients send it.
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	Extensions    map[string]any `json:"extensions"`
+}
+
+type GraphQLResponse struct {
+	Data   any            `json:"data"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// graphQLHandler serves GET /api/graphql?query=&variables=&operationName=
+// and POST /api/graphql with the same as a JSON body. Documents that don't
+// parse, or ask for a mutation, get 400; errors resolving a field leave it
+// null and are listed in errors alongside the data.
+func graphQLHandler(api *GraphQLAPI) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input GraphQLRequest
+		switch r.Method {
+		case http.MethodGet:
+			params := r.URL.Query()
+			input.Query, input.OperationName = params.Get("query"), params.Get("operationName")
+			if variables := params.Get("variables"); variables != "" {
+				if err := json.Unmarshal([]byte(variables), &input.Variables); err != nil {
+					writeGraphQLError(w, &GraphQLError{Message: "variables must be a JSON object"})
+					return
+				}
+			}
+		case http.MethodPost:
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if strings.TrimSpace(input.Query) == "" {
+			writeGraphQLError(w, &GraphQLError{Message: "query is required"})
+			return
+		}
+		doc, err := parseGraphQL(input.Query)
+		if err != nil {
+			writeGraphQLError(w, err)
+			return
+		}
+		operation, variables, err := doc.selectOperation(input.OperationName, input.Variables)
+		if err != nil {
+			writeGraphQLError(w, err)
+			return
+		}
+		executor := &gqlExecutor{doc: doc, variables: variables, computed: api.computed(r), maxFields: api.maxFields}
+		data := executor.execute(operation, api.roots(r))
+		writeJSON(w, http.StatusOK, GraphQLResponse{Data: data, Errors: executor.errors})
+	}
+}
+
+func writeGraphQLError(w http.ResponseWriter, err error) {
+	var graphQLErr *GraphQLError
+	if !errors.As(err, &graphQLErr) {
+		graphQLErr = &GraphQLError{Message: err.Error()}
+	}
+	writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []GraphQLError{*graphQLErr}})
+}
+
+// graphQLSchemaHandler serves GET /api/graphql/schema, the schema in the
+// GraphQL schema language.
+func graphQLSchemaHandler(api *GraphQLAPI) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(api.schema()))
+	}
+}
+
+// isReadRequest reports whether a request can only read: a safe method, or
+// a GraphQL query, which is posted but has no mutations to run.
+func isReadRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return r.Method == http.MethodPost && r.URL.Path == graphQLPath
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const grpcService = "soc.v1.IncidentService"
+
+// gRPC status codes.
+const (
+	grpcOK                 = 0
+	grpcUnknown            = 2
+	grpcInvalidArgument    = 3
+	grpcDeadlineExceeded   = 4
+	grpcNotFound           = 5
+	grpcPermissionDenied   = 7
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcAborted            = 10
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnavailable        = 14
+	grpcUnauthenticated    = 16
+)
+
+// GRPCServer serves the IncidentService in incidents.proto for ingestion
+// pipelines and SOAR platforms. Each call is carried out as the matching
+// REST request, with the call's metadata as its headers, so credentials,
+// scopes, tenants, validation, rate limits, and auditing all work exactly
+// as they do over REST.
+type GRPCServer struct {
+	api        http.Handler
+	feed       *ChangeFeed
+	maxMessage int
+	pollWait   time.Duration
+}
+
+func newGRPCServer(api http.Handler, feed *ChangeFeed) *GRPCServer {
+	return &GRPCServer{
+		api:        api,
+		feed:       feed,
+		maxMessage: envInt("BODY_MAX_BYTES", defaultBodyMaxBytes),
+		pollWait:   25 * time.Second,
+	}
+}
+
+// restCall is the REST request a unary method is carried out as; every one
+// of them answers with an incident.
+type restCall struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+}
+
+var grpcUnaryCalls = map[string]func(protoFields) (restCall, error){
+	"CreateIncident": func(f protoFields) (restCall, error) {
+		call := restCall{method: http.MethodPost, path: "/api/incidents", body: IncidentInput{
+			Type:           f.string(1),
+			Restricted:     f.optionalBool(2),
+			Title:          f.string(3),
+			Severity:       f.string(4),
+			Status:         f.string(5),
+			Owner:          f.string(6),
+			Tags:           f.strings(7),
+			IOCs:           f.strings(8),
+			KillChainPhase: f.string(9),
+			Source:         f.string(10),
+		}}
+		if template := f.string(11); template != "" {
+			call.query = url.Values{"template": {template}}
+		}
+		return call, nil
+	},
+	"GetIncident": func(f protoFields) (restCall, error) {
+		path, err := incidentPath(f.string(1), "")
+		return restCall{method: http.MethodGet, path: path}, err
+	},
+	"UpdateIncident": func(f protoFields) (restCall, error) {
+		path, err := incidentPath(f.string(1), "")
+		return restCall{method: http.MethodPut, path: path, body: IncidentUpdate{
+			Severity:       f.string(2),
+			Status:         f.string(3),
+			Owner:          f.string(4),
+			Major:          f.optionalBool(5),
+			KillChainPhase: f.string(6),
+			Restricted:     f.optionalBool(7),
+			Disposition:    f.string(8),
+		}}, err
+	},
+	"AddNote": func(f protoFields) (restCall, error) {
+		path, err := incidentPath(f.string(1), "/notes")
+		return restCall{method: http.MethodPost, path: path, body: NoteInput{
+			Body:         f.string(2),
+			Author:       f.string(3),
+			Kind:         f.string(4),
+			ParentNoteID: f.string(5),
+		}}, err
+	},
+}
+
+func incidentPath(id, suffix string) (string, error) {
+	if strings.TrimSpace(id) == "" {
+		return "", errors.New("id is required")
+	}
+	if strings.Contains(id, "/") {
+		return "", errors.New("id must not contain /")
+	}
+	return "/api/incidents/" + url.PathEscape(id) + suffix, nil
+}
+
+func (g *GRPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	ctx, cancel := grpcContext(r)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	service, method, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	unary, ok := grpcUnaryCalls[method]
+	if service != grpcService || (!ok && method != "WatchIncidents") {
+		grpcFinish(w, grpcUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+	message, err := readGRPCMessage(r.Body, g.maxMessage)
+	if err != nil {
+		var status *grpcStatus
+		if !errors.As(err, &status) {
+			status = &grpcStatus{grpcInvalidArgument, err.Error()}
+		}
+		grpcFinish(w, status.code, status.message)
+		return
+	}
+	fields, err := parseProto(message)
+	if err != nil {
+		grpcFinish(w, grpcInvalidArgument, "request: "+err.Error())
+		return
+	}
+	if !ok {
+		g.watch(w, r, fields.string(1))
+		return
+	}
+	call, err := unary(fields)
+	if err != nil {
+		grpcFinish(w, grpcInvalidArgument, err.Error())
+		return
+	}
+	code, body := g.rest(r, call)
+	if code == http.StatusNotFound && len(body) == 0 {
+		grpcFinish(w, grpcNotFound, errIncidentNotFound.Error())
+		return
+	}
+	if code/100 != 2 {
+		status := grpcStatusFor(code, body)
+		grpcFinish(w, status.code, status.message)
+		return
+	}
+	var incident Incident
+	if err := json.Unmarshal(body, &incident); err != nil {
+		grpcFinish(w, grpcInternal, err.Error())
+		return
+	}
+	writeGRPCMessage(w, protoIncident(incident))
+	grpcFinish(w, grpcOK, "")
+}
+
+// watch streams the change feed by long polling it, so the stream sees
+// the feed exactly as GET /api/incidents/changes would for the caller.
+func (g *GRPCServer) watch(w http.ResponseWriter, r *http.Request, cursor string) {
+	controller := http.NewResponseController(w)
+	// Streams outlive the server's write timeout.
+	controller.SetWriteDeadline(time.Time{})
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+	wait := g.pollWait.String()
+	for {
+		code, body := g.rest(r, restCall{method: http.MethodGet, path: "/api/incidents/changes", query: url.Values{"since": {cursor}, "wait": {wait}}})
+		select {
+		case <-r.Context().Done():
+			if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+				grpcFinish(w, grpcDeadlineExceeded, "deadline exceeded")
+			}
+			return
+		case <-g.feed.closing:
+			grpcFinish(w, grpcUnavailable, "server is shutting down; reconnect with the last cursor")
+			return
+		default:
+		}
+		var page struct {
+			Items  []Change `json:"items"`
+			Cursor string   `json:"cursor"`
+		}
+		switch code {
+		case http.StatusOK:
+			if err := json.Unmarshal(body, &page); err != nil {
+				grpcFinish(w, grpcInternal, err.Error())
+				return
+			}
+		case http.StatusGone:
+			json.Unmarshal(body, &page)
+			page.Items = []Change{{Cursor: page.Cursor, Type: "resync"}}
+		default:
+			status := grpcStatusFor(code, body)
+			grpcFinish(w, status.code, status.message)
+			return
+		}
+		for _, change := range page.Items {
+			if writeGRPCMessage(w, protoChange(change)) != nil {
+				return
+			}
+		}
+		if controller.Flush() != nil {
+			return
+		}
+		cursor = page.Cursor
+	}
+}
+
+// rest carries out call against the REST API as the caller of r.
+func (g *GRPCServer) rest(r *http.Request, call restCall) (int, []byte) {
+	var body io.Reader = http.NoBody
+	if call.body != nil {
+		payload, err := json.Marshal(call.body)
+		if err != nil {
+			return http.StatusInternalServerError, nil
+		}
+		body = bytes.NewReader(payload)
+	}
+	target := call.path
+	if len(call.query) > 0 {
+		target += "?" + call.query.Encode()
+	}
+	request, err := http.NewRequestWithContext(r.Context(), call.method, target, body)
+	if err != nil {
+		return http.StatusInternalServerError, nil
+	}
+	request.Host = r.Host
+	request.RemoteAddr = r.RemoteAddr
+	request.TLS = r.TLS
+	request.Header = r.Header.Clone()
+	for name := range request.Header {
+		if strings.HasPrefix(name, "Grpc-") {
+			request.Header.Del(name)
+		}
+	}
+	request.Header.Del("Te")
+	request.Header.Del("Content-Length")
+	request.Header.Set("Content-Type", "application/json")
+	recorder := &restRecorder{header: http.Header{}, code: http.StatusOK}
+	g.api.ServeHTTP(recorder, request)
+	return recorder.code, recorder.body.Bytes()
+}
+
+// restRecorder keeps the REST response a call was carried out as.
+type restRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *restRecorder) Header() http.Header { return r.header }
+
+func (r *restRecorder) WriteHeader(code int) { r.code = code }
+
+func (r *restRecorder) Write(body []byte) (int, error) { return r.body.Write(body) }
+
+type grpcStatus struct {
+	code    int
+	message string
+}
+
+func (s *grpcStatus) Error() string { return s.message }
+
+// grpcStatusFor maps a REST error response to a gRPC status, carrying its
+// error message.
+func grpcStatusFor(code int, body []byte) *grpcStatus {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(body, &payload)
+	status := &grpcStatus{grpcUnknown, fallback(payload.Error, http.StatusText(code))}
+	switch code {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		status.code = grpcInvalidArgument
+	case http.StatusUnauthorized:
+		status.code = grpcUnauthenticated
+	case http.StatusForbidden:
+		status.code = grpcPermissionDenied
+	case http.StatusNotFound:
+		status.code = grpcNotFound
+	case http.StatusConflict:
+		status.code = grpcAborted
+	case http.StatusPreconditionFailed:
+		status.code = grpcFailedPrecondition
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		status.code = grpcDeadlineExceeded
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		status.code = grpcResourceExhausted
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		status.code = grpcUnavailable
+	case http.StatusInternalServerError:
+		status.code = grpcInternal
+	}
+	return status
+}
+
+// grpcContext applies the grpc-timeout the client sent, such as 500m or
+// 30S.
+func grpcContext(r *http.Request) (context.Context, context.CancelFunc) {
+	value := r.Header.Get("Grpc-Timeout")
+	if len(value) < 2 {
+		return context.WithCancel(r.Context())
+	}
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second, 'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	unit, ok := units[value[len(value)-1]]
+	amount, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if !ok || err != nil || amount < 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), time.Duration(amount)*unit)
+}
+
+// readGRPCMessage reads the one length-prefixed message a unary or
+// server-streaming call sends.
+func readGRPCMessage(body io.Reader, max int) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, errors.New("request message is missing")
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcStatus{grpcUnimplemented, "compressed messages are not supported"}
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if uint64(length) > uint64(max) {
+		return nil, &grpcStatus{grpcResourceExhausted, fmt.Sprintf("request message is larger than %d bytes", max)}
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(body, message); err != nil {
+		return nil, errors.New("request message is truncated")
+	}
+	return message, nil
+}
+
+func writeGRPCMessage(w io.Writer, message protoMessage) error {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	_, err := w.Write(append(frame, message...))
+	return err
+}
+
+// grpcFinish ends a call with its status, sent in the trailers.
+func grpcFinish(w http.ResponseWriter, code int, message string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcEncodeMessage(message))
+	}
+}
+
+// grpcEncodeMessage percent-encodes a status message as the gRPC protocol
+// requires.
+func grpcEncodeMessage(message string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c >= ' ' && c <= '~' && c != '%' {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+func protoNote(note Note) protoMessage {
+	var m protoMessage
+	m.string(1, note.ID)
+	m.string(2, note.Body)
+	m.string(3, note.Author)
+	m.string(4, note.AuthorType)
+	m.string(5, note.AuthorID)
+	m.string(6, note.Kind)
+	m.strings(7, note.Mentions)
+	m.timestamp(8, note.CreatedAt)
+	m.string(9, note.ParentNoteID)
+	return m
+}
+
+func protoIncident(incident Incident) protoMessage {
+	var m protoMessage
+	m.string(1, incident.ID)
+	m.string(2, incident.Tenant)
+	m.string(3, incident.Type)
+	m.bool(4, incident.Restricted)
+	m.string(5, incident.Title)
+	m.string(6, incident.Severity)
+	m.string(7, incident.Status)
+	m.string(8, incident.Owner)
+	m.strings(9, incident.Tags)
+	m.strings(10, incident.IOCs)
+	for _, note := range incident.Notes {
+		m.message(11, protoNote(note))
+	}
+	m.bool(12, incident.Major)
+	m.string(13, incident.KillChainPhase)
+	m.string(14, incident.Disposition)
+	m.string(15, incident.Source)
+	m.string(16, incident.SuggestedSeverity)
+	m.int(17, int64(incident.AlertCount))
+	m.bool(18, incident.SLABreached)
+	if incident.SLADueAt != nil {
+		m.timestamp(19, *incident.SLADueAt)
+	}
+	m.string(20, incident.CampaignID)
+	m.string(21, incident.CaseID)
+	m.string(22, incident.MergedInto)
+	m.timestamp(23, incident.CreatedAt)
+	m.timestamp(24, incident.UpdatedAt)
+	return m
+}
+
+func protoChange(change Change) protoMessage {
+	var m protoMessage
+	m.string(1, change.Cursor)
+	m.string(2, change.Type)
+	m.string(3, change.IncidentID)
+	if change.IncidentID != "" {
+		m.message(4, protoIncident(change.Incident))
+	}
+	m.timestamp(5, change.At)
+	return m
+}
+
+// startGRPCServer serves the gRPC API on addr, over TLS when the main
+// server uses it and otherwise as cleartext HTTP/2, which is what gRPC
+// clients speak without TLS.
+func startGRPCServer(ctx context.Context, addr string, handler *GRPCServer, tlsConfig *tls.Config, grace time.Duration) {
+	server := newHTTPServer(addr, handler)
+	server.TLSConfig = tlsConfig
+	server.Protocols = new(http.Protocols)
+	server.Protocols.SetHTTP2(true)
+	server.Protocols.SetUnencryptedHTTP2(true)
+	go func() {
+		log.Printf("grpc listening on %s", addr)
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("grpc: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const splunkAlertSource = "splunk"
+
+// splunkAlertMapping is the built-in mapping for HEC events. The event body
+// sits at the top level and the HEC envelope under "hec", so the default
+// field names still apply.
+func splunkAlertMapping() AlertMapping {
+	return AlertMapping{
+		Source:        splunkAlertSource,
+		TitleTemplate: "{search_name}",
+		SeverityField: "severity",
+		IOCFields: []string{
+			"iocs", "src", "dest", "src_ip", "dest_ip", "domain", "url", "hash", "sha256", "md5",
+			"result.src", "result.dest", "result.src_ip", "result.dest_ip",
+			"hec.fields.src", "hec.fields.dest", "hec.fields.src_ip", "hec.fields.dest_ip",
+		},
+		TagFields:  []string{"tags", "hec.sourcetype"},
+		HostFields: []string{"host", "dest_host", "src_host", "hec.host"},
+		UserFields: []string{"user", "src_user"},
+	}
+}
+
+// hecEvent is the Splunk HTTP Event Collector envelope.
+type hecEvent struct {
+	Time       any            `json:"time"`
+	Host       string         `json:"host"`
+	Source     string         `json:"source"`
+	Sourcetype string         `json:"sourcetype"`
+	Index      string         `json:"index"`
+	Event      any            `json:"event"`
+	Fields     map[string]any `json:"fields"`
+}
+
+func (e hecEvent) alert() map[string]any {
+	alert := map[string]any{}
+	switch event := e.Event.(type) {
+	case map[string]any:
+		for key, value := range event {
+			alert[key] = value
+		}
+	case string:
+		alert["message"] = event
+	default:
+		alert["event"] = event
+	}
+	envelope := map[string]any{"host": e.Host, "source": e.Source, "sourcetype": e.Sourcetype, "index": e.Index}
+	if e.Time != nil {
+		envelope["time"] = e.Time
+	}
+	if len(e.Fields) > 0 {
+		envelope["fields"] = e.Fields
+	}
+	alert["hec"] = envelope
+	return alert
+}
+
+// HEC status codes, as documented by Splunk.
+const (
+	hecSuccess       = 0
+	hecTokenRequired = 2
+	hecInvalidAuth   = 3
+	hecInvalidToken  = 4
+	hecNoData        = 5
+	hecInvalidFormat = 6
+	hecInternalError = 8
+	hecEventRequired = 12
+	hecEventBlank    = 13
+	hecHealthy       = 17
+)
+
+func writeHEC(w http.ResponseWriter, status, code int, text string, extra map[string]any) {
+	body := map[string]any{"text": text, "code": code}
+	for key, value := range extra {
+		body[key] = value
+	}
+	writeJSON(w, status, body)
+}
+
+// hecAuthenticator accepts the tokens listed in SPLUNK_HEC_TOKENS and service
+// identity keys, so alerts from a keyed connector are attributed to it.
+type hecAuthenticator struct {
+	tokens     []string
+	identities *ServiceIdentityStore
+}
+
+func newHECAuthenticator(identities *ServiceIdentityStore) *hecAuthenticator {
+	return &hecAuthenticator{
+		tokens:     sanitizeSlice(strings.Split(envString("SPLUNK_HEC_TOKENS", ""), ",")),
+		identities: identities,
+	}
+}
+
+func (a *hecAuthenticator) authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if header == "" {
+		writeHEC(w, http.StatusUnauthorized, hecTokenRequired, "Token is required", nil)
+		return r, false
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Splunk") {
+		writeHEC(w, http.StatusUnauthorized, hecInvalidAuth, "Invalid authorization", nil)
+		return r, false
+	}
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(token, serviceKeyPrefix) {
+		if principal, ok := a.identities.authenticate(token); ok {
+			return r.WithContext(withPrincipal(r.Context(), principal)), true
+		}
+	}
+	for _, candidate := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			return r, true
+		}
+	}
+	writeHEC(w, http.StatusForbidden, hecInvalidToken, "Invalid token", nil)
+	return r, false
+}
+
+// readHECEvents decodes the HEC body: one or more envelopes, concatenated
+// or newline-separated, optionally gzip-compressed.
+func readHECEvents(r *http.Request) ([]hecEvent, int, error) {
+	var body io.Reader = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, hecInvalidFormat, err
+		}
+		defer reader.Close()
+		body = reader
+	}
+
+	decoder := json.NewDecoder(body)
+	events := []hecEvent{}
+	for {
+		var event hecEvent
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, hecInvalidFormat, err
+		}
+		if event.Event == nil {
+			return nil, hecEventRequired, errors.New("Event field is required")
+		}
+		if text, ok := event.Event.(string); ok && strings.TrimSpace(text) == "" {
+			return nil, hecEventBlank, errors.New("Event field cannot be blank")
+		}
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return nil, hecNoData, errors.New("No data")
+	}
+	return events, hecSuccess, nil
+}
+
+// hecHandler serves /services/collector/event so Splunk alert actions and
+// HEC clients can post detections without custom glue.
+func hecHandler(auth *hecAuthenticator, ingester *AlertIngester, mappings *AlertMappingStore, enrichment *EnrichmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/health") {
+			writeHEC(w, http.StatusOK, hecHealthy, "HEC is healthy", nil)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		r, ok := auth.authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		events, code, err := readHECEvents(r)
+		if err != nil {
+			writeHEC(w, bodyErrorStatus(err), code, err.Error(), nil)
+			return
+		}
+		mapping, ok := mappings.get(splunkAlertSource)
+		if !ok {
+			mapping = splunkAlertMapping()
+		}
+		for i, event := range events {
+			result, created, err := ingester.ingest(r.Context(), mapping, event.alert())
+			if err != nil {
+				writeHEC(w, http.StatusInternalServerError, hecInternalError, err.Error(), map[string]any{"invalid-event-number": i})
+				return
+			}
+			if created {
+				enrichment.enqueue(result.IncidentID)
+			}
+		}
+		writeHEC(w, http.StatusOK, hecSuccess, "Success", nil)
+	}
+}
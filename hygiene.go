@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// HygieneLink points at the API call that fixes a finding.
+type HygieneLink struct {
+	Method string `json:"method"`
+	Href   string `json:"href"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+type HygieneFinding struct {
+	IncidentID string      `json:"incidentId"`
+	Title      string      `json:"title"`
+	Value      string      `json:"value,omitempty"`
+	Detail     string      `json:"detail,omitempty"`
+	Fix        HygieneLink `json:"fix"`
+}
+
+// TagVariants groups tags that differ only in case, punctuation, or a
+// trailing plural "s".
+type TagVariants struct {
+	Key       string         `json:"key"`
+	Variants  map[string]int `json:"variants"`
+	Incidents []string       `json:"incidents"`
+	Fix       HygieneLink    `json:"fix"`
+}
+
+type HygieneReport struct {
+	GeneratedAt       time.Time        `json:"generatedAt"`
+	Checked           int              `json:"checked"`
+	MissingOwner      []HygieneFinding `json:"missingOwner"`
+	InvalidSeverity   []HygieneFinding `json:"invalidSeverity"`
+	OrphanedIOCs      []HygieneFinding `json:"orphanedIocs"`
+	TagNearDuplicates []TagVariants    `json:"tagNearDuplicates"`
+	StaleOpen         []HygieneFinding `json:"staleOpen"`
+}
+
+func updateLink(id, hint string) HygieneLink {
+	return HygieneLink{Method: http.MethodPut, Href: "/api/incidents/" + id, Hint: hint}
+}
+
+// tagKey folds a tag down to the form used to spot near-duplicates.
+func tagKey(tag string) string {
+	var key strings.Builder
+	for _, r := range strings.ToLower(tag) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			key.WriteRune(r)
+		}
+	}
+	folded := key.String()
+	if len(folded) > 3 && strings.HasSuffix(folded, "s") && !strings.HasSuffix(folded, "ss") {
+		folded = strings.TrimSuffix(folded, "s")
+	}
+	return folded
+}
+
+// orphanedIOC explains why an IOC string is unusable, or returns "" when it
+// is fine. Orphans are values no enricher, feed, or pivot can act on.
+func orphanedIOC(value string) string {
+	switch {
+	case strings.TrimSpace(value) == "":
+		return "empty indicator"
+	case value != strings.TrimSpace(value):
+		return "leading or trailing whitespace"
+	}
+	if _, problem := validateIOC(value); problem != "" {
+		return problem
+	}
+	if iocType(value) == iocOther {
+		return "not a recognised IP, domain, or hash"
+	}
+	return ""
+}
+
+// buildHygieneReport checks incidents for data quality problems. Open cases
+// untouched for longer than staleAfter are reported as stale.
+func buildHygieneReport(items []Incident, staleAfter time.Duration, now time.Time) HygieneReport {
+	report := HygieneReport{
+		GeneratedAt:       now,
+		Checked:           len(items),
+		MissingOwner:      []HygieneFinding{},
+		InvalidSeverity:   []HygieneFinding{},
+		OrphanedIOCs:      []HygieneFinding{},
+		TagNearDuplicates: []TagVariants{},
+		StaleOpen:         []HygieneFinding{},
+	}
+
+	taxonomies := currentTaxonomies()
+	tags := map[string]*TagVariants{}
+	for _, incident := range items {
+		finding := HygieneFinding{IncidentID: incident.ID, Title: incident.Title}
+		open := !isClosedStatus(incident.Status)
+
+		if open && unowned(incident) {
+			owner := finding
+			owner.Fix = updateLink(incident.ID, `{"owner": "..."}`)
+			report.MissingOwner = append(report.MissingOwner, owner)
+		}
+		if level, ok := taxonomies.severity(incident.Severity); !ok || level.Name != incident.Severity {
+			severity := finding
+			severity.Value = incident.Severity
+			severity.Detail = "expected one of " + strings.Join(taxonomies.severityNames(), ", ")
+			severity.Fix = updateLink(incident.ID, `{"severity": "`+normalizeSeverity(incident.Severity)+`"}`)
+			report.InvalidSeverity = append(report.InvalidSeverity, severity)
+		}
+		for _, ioc := range incident.IOCs {
+			if reason := orphanedIOC(ioc); reason != "" {
+				orphan := finding
+				orphan.Value = ioc
+				orphan.Detail = reason
+				orphan.Fix = HygieneLink{Method: http.MethodGet, Href: "/api/iocs/" + url.PathEscape(ioc) + "/incidents", Hint: "review incidents carrying this value"}
+				report.OrphanedIOCs = append(report.OrphanedIOCs, orphan)
+			}
+		}
+		if open && now.Sub(incident.UpdatedAt) > staleAfter {
+			stale := finding
+			stale.Value = incident.Status
+			stale.Detail = "no updates since " + incident.UpdatedAt.Format(time.RFC3339)
+			stale.Fix = updateLink(incident.ID, `{"status": "..."}`)
+			report.StaleOpen = append(report.StaleOpen, stale)
+		}
+
+		for _, tag := range incident.Tags {
+			key := tagKey(tag)
+			if key == "" {
+				continue
+			}
+			group := tags[key]
+			if group == nil {
+				group = &TagVariants{Key: key, Variants: map[string]int{}}
+				tags[key] = group
+			}
+			group.Variants[tag]++
+			if n := len(group.Incidents); n == 0 || group.Incidents[n-1] != incident.ID {
+				group.Incidents = append(group.Incidents, incident.ID)
+			}
+		}
+	}
+
+	for _, group := range tags {
+		if len(group.Variants) < 2 {
+			continue
+		}
+		variants := make([]string, 0, len(group.Variants))
+		for variant := range group.Variants {
+			variants = append(variants, variant)
+		}
+		sort.Strings(variants)
+		group.Fix = HygieneLink{Method: http.MethodGet, Href: "/api/incidents?q=" + url.QueryEscape(strings.ToLower(variants[0])), Hint: "pick one spelling"}
+		report.TagNearDuplicates = append(report.TagNearDuplicates, *group)
+	}
+	sort.Slice(report.TagNearDuplicates, func(i, j int) bool {
+		return report.TagNearDuplicates[i].Key < report.TagNearDuplicates[j].Key
+	})
+	return report
+}
+
+func hygieneHandler(store *IncidentStore) http.HandlerFunc {
+	staleAfter := envDuration("HYGIENE_STALE_AFTER", 14*24*time.Hour)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		writeJSON(w, http.StatusOK, buildHygieneReport(visibleTo(r, store.list()), staleAfter, time.Now().UTC()))
+	}
+}
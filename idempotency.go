@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	// idempotencySweepEvery is how many new keys go by between sweeps of
+	// the expired ones.
+	idempotencySweepEvery = 1024
+)
+
+// idempotentPaths are the creation endpoints that honor Idempotency-Key.
+var idempotentPaths = []string{"/api/incidents", "/api/alerts"}
+
+// IdempotencyCache remembers the responses to creation requests sent with
+// an Idempotency-Key, so a forwarder retrying after a timeout gets the
+// original result back instead of creating the incident again.
+type IdempotencyCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*idempotentResponse
+	added   int
+}
+
+type idempotentResponse struct {
+	// fingerprint is a hash of the request's query and body, which a
+	// replay has to match.
+	fingerprint [sha256.Size]byte
+	// done is false while the first request is still being handled.
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// newIdempotencyCache reads IDEMPOTENCY_TTL, how long responses are kept
+// for replay, returning nil when it is zero.
+func newIdempotencyCache() *IdempotencyCache {
+	ttl := envDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	if ttl <= 0 {
+		return nil
+	}
+	return &IdempotencyCache{ttl: ttl, entries: map[string]*idempotentResponse{}}
+}
+
+func (c *IdempotencyCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// claim returns the response recorded under key, or records that a request
+// is now in flight for it and returns nil.
+func (c *IdempotencyCache) claim(key string, fingerprint [sha256.Size]byte, now time.Time) *idempotentResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok && now.Before(entry.expires) {
+		copied := *entry
+		return &copied
+	}
+	c.added++
+	if c.added%idempotencySweepEvery == 0 {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = &idempotentResponse{fingerprint: fingerprint, expires: now.Add(c.ttl)}
+	return nil
+}
+
+// finish records the response to the request that claimed key. Server
+// errors and rate limiting aren't kept, so a retry of those is carried out
+// again.
+func (c *IdempotencyCache) finish(key string, response *responseCapture, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[key]
+	if entry == nil || entry.done {
+		return
+	}
+	if response.status == 0 || response.status >= 500 || response.status == http.StatusTooManyRequests {
+		delete(c.entries, key)
+		return
+	}
+	entry.done = true
+	entry.status = response.status
+	entry.contentType = response.Header().Get("Content-Type")
+	entry.body = response.body.Bytes()
+	entry.expires = now.Add(c.ttl)
+}
+
+// idempotencyScope keeps callers' keys apart: a key names a request only
+// among those from the same caller in the same tenant.
+func idempotencyScope(r *http.Request) string {
+	return tenantFrom(r.Context()) + "|" + rateClient(r, nil) + "|" + r.URL.Path
+}
+
+// withIdempotency replays the recorded response to a creation request
+// whose Idempotency-Key was seen within IDEMPOTENCY_TTL, marked with
+// Idempotent-Replayed: true. Reusing a key for a different request is 422,
+// and retrying while the first request is still running is 409.
+func withIdempotency(next http.Handler, cache *IdempotencyCache) http.Handler {
+	if cache == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+		if value == "" || r.Method != http.MethodPost || !slices.Contains(idempotentPaths, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(value) > 255 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": idempotencyKeyHeader + " must be at most 255 characters"})
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := sha256.Sum256(append([]byte(r.URL.RawQuery+"\n"), body...))
+
+		key := idempotencyScope(r) + "|" + value
+		recorded := cache.claim(key, fingerprint, time.Now())
+		switch {
+		case recorded == nil:
+			response := &responseCapture{ResponseWriter: w}
+			defer func() { cache.finish(key, response, time.Now()) }()
+			next.ServeHTTP(response, r)
+		case recorded.fingerprint != fingerprint:
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": idempotencyKeyHeader + " was already used for a different request"})
+		case !recorded.done:
+			w.Header().Set("Retry-After", "1")
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "a request with this " + idempotencyKeyHeader + " is still in progress"})
+		default:
+			if recorded.contentType != "" {
+				w.Header().Set("Content-Type", recorded.contentType)
+			}
+			w.Header().Set(idempotentReplayedHeader, "true")
+			w.WriteHeader(recorded.status)
+			w.Write(recorded.body)
+		}
+	})
+}
+
+// responseCapture passes a response through while keeping a copy of it.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(body []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(body)
+	return c.ResponseWriter.Write(body)
+}
+
+func (c *responseCapture) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	principalUser    = "user"
+	principalService = "service"
+
+	roleAdmin = "admin"
+	// roleCrossTenant lets a caller not bound to a tenant, such as an
+	// MSSP's own analyst, pick one with X-Tenant.
+	roleCrossTenant = "cross-tenant"
+	// roleImpersonate lets an admin issue API keys that act as another
+	// user.
+	roleImpersonate = "impersonate"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	Kind  string   `json:"kind"`
+	Label string   `json:"label,omitempty"`
+	Icon  string   `json:"icon,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+	// KeyID is the API key the caller authenticated with, if any.
+	KeyID string `json:"keyId,omitempty"`
+	// Tenant is the one tenant the caller's credentials are bound to, if
+	// any; see withTenant.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, principal Principal) context.Context {
+	if entry := requestLogFrom(ctx); entry != nil {
+		entry.principal = &principal
+	}
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func principalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// displayName is what gets written into author fields.
+func (p Principal) displayName() string {
+	return fallback(p.Label, p.Name)
+}
+
+func (p Principal) hasRole(role string) bool {
+	for _, candidate := range p.Roles {
+		if strings.EqualFold(candidate, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyAuth trusts the X-User and X-Roles headers set by an authenticating
+// proxy, on requests from the proxy's own addresses only; from anywhere
+// else the headers are just something a client typed.
+type ProxyAuth struct {
+	proxies []netip.Prefix
+}
+
+// trustedProxies reads AUTH_TRUSTED_PROXIES, the IPs or CIDRs of the
+// reverse proxies in front of the server.
+func trustedProxies() []netip.Prefix {
+	var proxies []netip.Prefix
+	for _, entry := range sanitizeSlice(strings.Split(envString("AUTH_TRUSTED_PROXIES", ""), ",")) {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				log.Printf("ignoring AUTH_TRUSTED_PROXIES entry %q: want an IP or CIDR", entry)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies
+}
+
+// newProxyAuth reads AUTH_PROXY_HEADERS, returning nil unless it and the
+// trusted proxies are set. The headers are ignored when the server
+// authenticates callers itself (ownLogins), since the proxy is then not
+// what stands between clients and the API, and withIdentity stops honoring
+// them once an API key has been issued.
+func newProxyAuth(proxies []netip.Prefix, ownLogins bool) *ProxyAuth {
+	if !envBool("AUTH_PROXY_HEADERS", false) {
+		return nil
+	}
+	if ownLogins {
+		log.Printf("ignoring AUTH_PROXY_HEADERS: API keys, JWTs, SSO, or LDAP authenticate callers instead")
+		return nil
+	}
+	if len(proxies) == 0 {
+		log.Printf("ignoring AUTH_PROXY_HEADERS: set AUTH_TRUSTED_PROXIES to the proxy addresses to accept them from")
+		return nil
+	}
+	return &ProxyAuth{proxies: proxies}
+}
+
+// trusts reports whether r came straight from one of the proxies.
+func (p *ProxyAuth) trusts(r *http.Request) bool {
+	if p == nil {
+		return false
+	}
+	return fromProxy(remoteHost(r), p.proxies)
+}
+
+// remoteHost is the address r's connection came from, without the port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// fromProxy reports whether host is one of the proxies' addresses.
+func fromProxy(host string, proxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	return slices.ContainsFunc(proxies, func(prefix netip.Prefix) bool { return prefix.Contains(addr) })
+}
+
+// clientAddr is the address of the client behind any trusted proxies: the
+// last X-Forwarded-For hop that isn't one of them, since only the hops the
+// proxies appended can be believed.
+func clientAddr(r *http.Request, proxies []netip.Prefix) string {
+	host := remoteHost(r)
+	if !fromProxy(host, proxies) {
+		return host
+	}
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		host = addr.Unmap().String()
+		if !fromProxy(host, proxies) {
+			break
+		}
+	}
+	return host
+}
+
+// withIdentity resolves the caller from the Authorization header (a service
+// key, an API key, or an identity provider's JWT), from a session cookie set
+// by the SSO login, or from the X-User and X-Roles headers set by an
+// authenticating proxy the request came from.
+// Requests without credentials pass through anonymously; a bearer token that
+// is not a valid key is rejected rather than silently downgraded, as are
+// users deactivated in the directory and session writes to the API without
+// the session's CSRF token.
+func withIdentity(next http.Handler, identities *ServiceIdentityStore, apiKeys *APIKeyStore, jwts *jwtVerifier, sessions *SessionStore, users *UserStore, proxy *ProxyAuth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			if session, ok := sessions.fromRequest(r); ok {
+				if users.inactive(session.Principal.ID) {
+					writeJSON(w, http.StatusForbidden, map[string]string{"error": "account deactivated"})
+					return
+				}
+				if strings.HasPrefix(r.URL.Path, "/api/") && !csrfValid(r, session) {
+					writeJSON(w, http.StatusForbidden, map[string]string{"error": "missing or invalid " + csrfHeader + " header; get the token from GET /api/session"})
+					return
+				}
+				r = r.WithContext(withPrincipal(r.Context(), session.Principal))
+			} else if user := strings.TrimSpace(r.Header.Get("X-User")); user != "" && proxy.trusts(r) && apiKeys.empty() {
+				if users.inactive(user) {
+					writeJSON(w, http.StatusForbidden, map[string]string{"error": "account deactivated"})
+					return
+				}
+				r = r.WithContext(withPrincipal(r.Context(), Principal{
+					ID:    user,
+					Name:  user,
+					Kind:  principalUser,
+					Roles: sanitizeSlice(strings.Split(r.Header.Get("X-Roles"), ",")),
+				}))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(token, serviceKeyPrefix) {
+			principal, ok := identities.authenticate(token)
+			if !ok {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid service key"})
+				return
+			}
+			r = r.WithContext(withPrincipal(r.Context(), principal))
+		}
+		if strings.HasPrefix(token, apiKeyPrefix) {
+			key, ok := apiKeys.authenticate(token, time.Now().UTC())
+			if !ok || users.inactive(key.UserID) {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid api key"})
+				return
+			}
+			if !key.allows(r.Method, r.URL.Path) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "api key scopes don't cover " + r.Method + " " + r.URL.Path})
+				return
+			}
+			r = r.WithContext(withPrincipal(r.Context(), key.principal(users)))
+		}
+		if jwts != nil && looksLikeJWT(token) {
+			principal, err := jwts.verify(r.Context(), token, time.Now().UTC())
+			if err != nil {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token: " + err.Error()})
+				return
+			}
+			if users.inactive(principal.ID) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "account deactivated"})
+				return
+			}
+			r = r.WithContext(withPrincipal(r.Context(), principal))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authExempt are the API paths that answer anonymous callers even when
+// authentication is required, because they check their own credentials or
+// reveal nothing.
+var authExempt = []string{"/api/version", "/api/openapi.json", "/api/docs", "/api/integrations/slack/actions"}
+
+// withAuthRequired answers 401 to anonymous API requests when enabled.
+func withAuthRequired(next http.Handler, enabled bool) http.Handler {
+	if !enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := principalFrom(r.Context()); !ok && strings.HasPrefix(r.URL.Path, "/api/") && !slices.Contains(authExempt, r.URL.Path) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireRole writes 401 or 403 and returns false unless the caller has role.
+func requireRole(w http.ResponseWriter, r *http.Request, role string) bool {
+	principal, ok := principalFrom(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+		return false
+	}
+	if !principal.hasRole(role) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": role + " role required"})
+		return false
+	}
+	return true
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[len("Bearer "):])
+	return token, token != ""
+}
+
+// attributeNote fills note authorship from the caller so notes written by
+// playbooks and connectors can't pose as analysts. Signed-in analysts keep
+// the human author type; automation notes they trigger stay automation notes.
+// The note carries the caller's trace context too.
+func attributeNote(ctx context.Context, input *NoteInput) {
+	input.Trace = traceFrom(ctx)
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		return
+	}
+	if principal.Kind != principalService {
+		if input.AuthorType == "" {
+			input.Author = principal.displayName()
+			input.AuthorID = principal.ID
+		}
+		return
+	}
+	input.Author = principal.displayName()
+	input.AuthorID = principal.ID
+	input.AuthorType = principal.Kind
+	input.AuthorIcon = principal.Icon
+}
+
+// filterNotes narrows notes by author type ("service", "automation") and
+// author ID. Notes written by analysts have an empty author type, which
+// "human" selects.
+func filterNotes(notes []Note, authorType, authorID string) []Note {
+	authorType = strings.ToLower(strings.TrimSpace(authorType))
+	authorID = strings.TrimSpace(authorID)
+	filtered := make([]Note, 0, len(notes))
+	for _, note := range notes {
+		if authorType == "human" && note.AuthorType != "" {
+			continue
+		}
+		if authorType != "" && authorType != "human" && note.AuthorType != authorType {
+			continue
+		}
+		if authorID != "" && note.AuthorID != authorID {
+			continue
+		}
+		filtered = append(filtered, note)
+	}
+	return filtered
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// whoami answers with the caller withIdentity and withTenant resolved.
+func whoami(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFrom(r.Context())
+	writeJSON(w, http.StatusOK, map[string]any{"authenticated": ok, "id": principal.ID, "kind": principal.Kind, "tenant": tenantFrom(r.Context())})
+}
+
+type whoamiResponse struct {
+	Authenticated bool   `json:"authenticated"`
+	ID            string `json:"id"`
+	Kind          string `json:"kind"`
+	Tenant        string `json:"tenant"`
+}
+
+func serveWhoami(t *testing.T, handler http.Handler, r *http.Request) (int, whoamiResponse) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	var body whoamiResponse
+	if recorder.Code == http.StatusOK {
+		if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return recorder.Code, body
+}
+
+func TestWithIdentity(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("JWT_AUDIENCE", "soc")
+	now := time.Now().UTC()
+
+	identities := newServiceIdentityStore()
+	service, err := identities.create(ServiceIdentityInput{Name: "siem-bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabledService, err := identities.create(ServiceIdentityInput{Name: "old-bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := identities.disable(disabledService.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	users := newUserStore()
+	if _, err := users.create(UserInput{ID: "mallory", Name: "Mallory"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.deactivate("mallory", now); err != nil {
+		t.Fatal(err)
+	}
+
+	apiKeys := newAPIKeyStore()
+	issue := func(input APIKeyInput) APIKeyWithSecret {
+		key, err := apiKeys.issue(input, "admin", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	readKey := issue(APIKeyInput{Name: "reader", UserID: "bob", Scopes: []string{"incidents:read"}})
+	expiresAt := now.Add(time.Hour)
+	expiredKey := issue(APIKeyInput{Name: "expired", UserID: "bob", Scopes: []string{"*:read"}, ExpiresAt: &expiresAt})
+	past := now.Add(-time.Minute)
+	apiKeys.keys[expiredKey.ID].ExpiresAt = &past
+	revokedKey := issue(APIKeyInput{Name: "revoked", UserID: "bob", Scopes: []string{"*:read"}})
+	if _, err := apiKeys.revoke(revokedKey.ID, "admin", now); err != nil {
+		t.Fatal(err)
+	}
+	deactivatedKey := issue(APIKeyInput{Name: "mallory", UserID: "mallory", Scopes: []string{"*:read"}})
+
+	sessions := newSessionStore()
+	sessionToken, session, err := sessions.create(Principal{ID: "carol", Kind: principalUser}, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredToken, _, err := sessions.create(Principal{ID: "carol", Kind: principalUser}, "", now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs256 := map[string]any{"alg": "HS256"}
+	validJWT := signJWT(t, hs256, claimsAt(now, func(c map[string]any) { delete(c, "iss") }), []byte("secret"))
+	handler := withIdentity(http.HandlerFunc(whoami), identities, apiKeys, newJWTVerifier(), sessions, users, nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		bearer     string
+		cookie     string
+		csrf       string
+		wantStatus int
+		wantID     string
+	}{
+		{name: "anonymous", wantStatus: http.StatusOK},
+		{name: "service key", bearer: service.Key, wantStatus: http.StatusOK, wantID: service.ID},
+		{name: "disabled service key", bearer: disabledService.Key, wantStatus: http.StatusUnauthorized},
+		{name: "unknown service key", bearer: serviceKeyPrefix + "nope", wantStatus: http.StatusUnauthorized},
+		{name: "api key", bearer: readKey.Key, wantStatus: http.StatusOK, wantID: "bob"},
+		{name: "api key outside its scopes", path: "/api/alerts", bearer: readKey.Key, wantStatus: http.StatusForbidden},
+		{name: "api key write with a read scope", method: http.MethodPost, bearer: readKey.Key, wantStatus: http.StatusForbidden},
+		{name: "expired api key", bearer: expiredKey.Key, wantStatus: http.StatusUnauthorized},
+		{name: "revoked api key", bearer: revokedKey.Key, wantStatus: http.StatusUnauthorized},
+		{name: "deactivated user's api key", bearer: deactivatedKey.Key, wantStatus: http.StatusUnauthorized},
+		{name: "unknown api key", bearer: apiKeyPrefix + "nope", wantStatus: http.StatusUnauthorized},
+		{name: "jwt", bearer: validJWT, wantStatus: http.StatusOK, wantID: "alice"},
+		{name: "expired jwt", bearer: signJWT(t, hs256, claimsAt(now, func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() }), []byte("secret")), wantStatus: http.StatusUnauthorized},
+		{name: "jwt with alg none", bearer: signJWT(t, map[string]any{"alg": "none"}, claimsAt(now, nil), nil), wantStatus: http.StatusUnauthorized},
+		{name: "jwt for another audience", bearer: signJWT(t, hs256, claimsAt(now, func(c map[string]any) { c["aud"] = "other-app" }), []byte("secret")), wantStatus: http.StatusUnauthorized},
+		{name: "jwt for a deactivated user", bearer: signJWT(t, hs256, claimsAt(now, func(c map[string]any) { c["sub"] = "mallory" }), []byte("secret")), wantStatus: http.StatusForbidden},
+		{name: "session read", cookie: sessionToken, wantStatus: http.StatusOK, wantID: "carol"},
+		{name: "session write with csrf token", method: http.MethodPost, cookie: sessionToken, csrf: session.CSRFToken, wantStatus: http.StatusOK, wantID: "carol"},
+		{name: "session write without csrf token", method: http.MethodPost, cookie: sessionToken, wantStatus: http.StatusForbidden},
+		{name: "session write with wrong csrf token", method: http.MethodPost, cookie: sessionToken, csrf: "guess", wantStatus: http.StatusForbidden},
+		{name: "expired session", cookie: expiredToken, wantStatus: http.StatusOK},
+		{name: "unknown session", cookie: "guess", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(fallback(tt.method, http.MethodGet), fallback(tt.path, "/api/incidents"), nil)
+			if tt.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: sessionCookie, Value: tt.cookie})
+			}
+			if tt.csrf != "" {
+				r.Header.Set(csrfHeader, tt.csrf)
+			}
+			status, body := serveWhoami(t, handler, r)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if body.ID != tt.wantID || body.Authenticated != (tt.wantID != "") {
+				t.Errorf("caller = %+v, want %q", body, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestWithIdentityProxyHeaders(t *testing.T) {
+	proxy := &ProxyAuth{proxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	withKey := newAPIKeyStore()
+	if _, err := withKey.issue(APIKeyInput{Name: "reader", Scopes: []string{"*:read"}}, "admin", time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		proxy      *ProxyAuth
+		apiKeys    *APIKeyStore
+		wantID     string
+	}{
+		{"from the proxy", "10.1.2.3:4000", proxy, newAPIKeyStore(), "dave"},
+		{"from the proxy over IPv4-mapped IPv6", "[::ffff:10.1.2.3]:4000", proxy, newAPIKeyStore(), "dave"},
+		{"from elsewhere", "192.0.2.1:4000", proxy, newAPIKeyStore(), ""},
+		{"proxy headers off", "10.1.2.3:4000", nil, newAPIKeyStore(), ""},
+		{"once api keys are issued", "10.1.2.3:4000", proxy, withKey, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := withIdentity(http.HandlerFunc(whoami), newServiceIdentityStore(), tt.apiKeys, nil, newSessionStore(), newUserStore(), tt.proxy)
+			r := httptest.NewRequest(http.MethodGet, "/api/incidents", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set("X-User", "dave")
+			r.Header.Set("X-Roles", "admin")
+			status, body := serveWhoami(t, handler, r)
+			if status != http.StatusOK || body.ID != tt.wantID {
+				t.Errorf("status %d, caller %+v, want %q", status, body, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestWithTenant(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  *Principal
+		header     string
+		path       string
+		wantStatus int
+		wantTenant string
+	}{
+		{name: "bound credentials", principal: &Principal{ID: "bob", Tenant: "acme"}, wantStatus: http.StatusOK, wantTenant: "acme"},
+		{name: "bound credentials naming their tenant", principal: &Principal{ID: "bob", Tenant: "acme"}, header: "acme", wantStatus: http.StatusOK, wantTenant: "acme"},
+		{name: "bound credentials naming another tenant", principal: &Principal{ID: "bob", Tenant: "acme"}, header: "globex", wantStatus: http.StatusForbidden},
+		{name: "cross-tenant user picking a tenant", principal: &Principal{ID: "erin", Roles: []string{roleCrossTenant}}, header: "Globex", wantStatus: http.StatusOK, wantTenant: "globex"},
+		{name: "tenant header without the cross-tenant role", principal: &Principal{ID: "bob", Roles: []string{roleAdmin}}, header: "globex", wantStatus: http.StatusForbidden},
+		{name: "anonymous tenant header", header: "globex", wantStatus: http.StatusForbidden},
+		{name: "no tenant", principal: &Principal{ID: "erin", Roles: []string{roleCrossTenant}}, wantStatus: http.StatusBadRequest},
+		{name: "malformed tenant", principal: &Principal{ID: "erin", Roles: []string{roleCrossTenant}}, header: "acme/../globex", wantStatus: http.StatusBadRequest},
+		{name: "no tenant on an exempt path", path: "/api/version", wantStatus: http.StatusOK},
+	}
+	handler := withTenant(http.HandlerFunc(whoami), true)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, fallback(tt.path, "/api/incidents"), nil)
+			if tt.principal != nil {
+				r = r.WithContext(withPrincipal(r.Context(), *tt.principal))
+			}
+			if tt.header != "" {
+				r.Header.Set(tenantHeader, tt.header)
+			}
+			status, body := serveWhoami(t, handler, r)
+			if status != tt.wantStatus || body.Tenant != tt.wantTenant {
+				t.Errorf("status %d, tenant %q, want %d, %q", status, body.Tenant, tt.wantStatus, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestClientAddr(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "192.0.2.1:4000", nil, "192.0.2.1"},
+		{"direct with a forged header", "192.0.2.1:4000", []string{"203.0.113.9"}, "192.0.2.1"},
+		{"through the proxy", "10.0.0.1:4000", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"client-supplied hops are skipped", "10.0.0.1:4000", []string{"198.51.100.7, 203.0.113.9"}, "203.0.113.9"},
+		{"chained proxies", "10.0.0.1:4000", []string{"203.0.113.9, 10.0.0.2"}, "203.0.113.9"},
+		{"split across headers", "10.0.0.1:4000", []string{"198.51.100.7", "203.0.113.9"}, "203.0.113.9"},
+		{"through the proxy without the header", "10.0.0.1:4000", nil, "10.0.0.1"},
+		{"garbage hop", "10.0.0.1:4000", []string{"203.0.113.9, nonsense"}, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/incidents", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := clientAddr(r, proxies); got != tt.want {
+				t.Errorf("clientAddr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
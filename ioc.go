@@ -0,0 +1,258 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	iocIP     = "ip"
+	iocDomain = "domain"
+	iocHash   = "hash"
+	iocOther  = "other"
+)
+
+var (
+	hexPattern    = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	domainPattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.)+[a-zA-Z]{2,}$`)
+	// ipLikePattern and hostLikePattern catch values meant as an IP or a
+	// domain, so malformed ones are reported instead of passing as "other".
+	ipv4LikePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+){3}(/[0-9]+)?$`)
+	ipv6LikePattern = regexp.MustCompile(`^[0-9a-fA-F]*:[0-9a-fA-F]*:[0-9a-fA-F:.]*(/[0-9]+)?$`)
+	hostLikePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]*(\.[a-zA-Z0-9_-]*)*\.[a-zA-Z0-9_-]*[a-zA-Z_-][a-zA-Z0-9_-]*\.?$`)
+	tldPattern      = regexp.MustCompile(`^([a-zA-Z]{2,63}|xn--[a-zA-Z0-9-]{1,59})$`)
+)
+
+// IOC validation modes, from IOC_VALIDATION.
+const (
+	iocValidationReject = "reject"
+	iocValidationFlag   = "flag"
+	iocValidationOff    = "off"
+)
+
+// IOCProblem is an indicator that looks like an IP, domain, hash, or URL but
+// isn't a valid one.
+type IOCProblem struct {
+	Value   string `json:"value"`
+	Type    string `json:"type"`
+	Problem string `json:"problem"`
+}
+
+// iocType makes a best-effort guess at what kind of indicator a raw IOC
+// string is so enrichers can pick the values they understand.
+func iocType(value string) string {
+	value = strings.TrimSpace(value)
+	if net.ParseIP(value) != nil {
+		return iocIP
+	}
+	if hexPattern.MatchString(value) {
+		switch len(value) {
+		case 32, 40, 64, 128:
+			return iocHash
+		}
+	}
+	if domainPattern.MatchString(value) {
+		return iocDomain
+	}
+	return iocOther
+}
+
+// validateIOC checks a value against the rules for the type it appears to
+// be. It returns the type and a problem, or "" when the value is valid or
+// is free-form (usernames, file paths, and so on).
+func validateIOC(value string) (string, string) {
+	value = strings.TrimSpace(value)
+	kind := iocType(value)
+	switch {
+	case value == "":
+		return iocOther, "empty indicator"
+	case kind != iocOther:
+		if kind == iocDomain {
+			return kind, domainProblem(value)
+		}
+		return kind, ""
+	case strings.Contains(value, "://"):
+		return "url", urlProblem(value)
+	case ipv4LikePattern.MatchString(value) || ipv6LikePattern.MatchString(value):
+		// CIDR ranges are fine.
+		if _, err := netip.ParsePrefix(value); err == nil {
+			return iocIP, ""
+		}
+		return iocIP, "not a valid IP address"
+	case hexPattern.MatchString(value) && looksLikeHash(value):
+		return iocHash, "hash length " + strconv.Itoa(len(value)) + " doesn't match MD5 (32), SHA-1 (40), SHA-256 (64), or SHA-512 (128)"
+	case hostLikePattern.MatchString(value):
+		return iocDomain, domainProblem(value)
+	}
+	return iocOther, ""
+}
+
+// looksLikeHash reports whether a hex string is probably a hash rather than
+// a word or number that happens to be hex.
+func looksLikeHash(value string) bool {
+	if len(value) >= 24 {
+		return true
+	}
+	hasDigit := strings.ContainsAny(value, "0123456789")
+	hasLetter := strings.ContainsAny(strings.ToLower(value), "abcdef")
+	return len(value) >= 6 && hasDigit && hasLetter
+}
+
+// domainProblem applies the RFC 1035/1123 hostname rules.
+func domainProblem(value string) string {
+	name := strings.TrimSuffix(value, ".")
+	if len(name) > 253 {
+		return "domain is longer than 253 characters"
+	}
+	labels := strings.Split(name, ".")
+	for _, label := range labels {
+		switch {
+		case label == "":
+			return "domain has an empty label"
+		case len(label) > 63:
+			return "domain label longer than 63 characters"
+		case strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-"):
+			return "domain label starts or ends with a hyphen"
+		case strings.Contains(label, "_"):
+			return "domain contains an underscore"
+		}
+	}
+	if !tldPattern.MatchString(labels[len(labels)-1]) {
+		return "domain has no valid top-level domain"
+	}
+	return ""
+}
+
+func urlProblem(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		return "not a valid URL"
+	}
+	host := parsed.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		return ""
+	}
+	if problem := domainProblem(host); problem != "" {
+		return "URL host: " + problem
+	}
+	return ""
+}
+
+// iocProblems lists the malformed values among iocs.
+func iocProblems(iocs []string) []IOCProblem {
+	problems := []IOCProblem{}
+	for _, ioc := range iocs {
+		if kind, problem := validateIOC(ioc); problem != "" {
+			problems = append(problems, IOCProblem{Value: ioc, Type: kind, Problem: problem})
+		}
+	}
+	return problems
+}
+
+// annotateIOCs flags malformed IOCs so analysts can see and fix them.
+func annotateIOCs(incident *Incident) {
+	incident.MalformedIOCs = nil
+	if problems := iocProblems(incident.IOCs); len(problems) > 0 {
+		incident.MalformedIOCs = problems
+	}
+}
+
+// iocValidationMode reads IOC_VALIDATION: reject (the default) refuses
+// malformed IOCs written through the API, flag accepts and flags them, and
+// off accepts them silently.
+func iocValidationMode() string {
+	switch mode := strings.ToLower(envString("IOC_VALIDATION", iocValidationReject)); mode {
+	case iocValidationFlag, iocValidationOff:
+		return mode
+	}
+	return iocValidationReject
+}
+
+// isPublicIP reports whether value is a globally routable address, which is
+// all external reputation services know anything about.
+func isPublicIP(value string) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+	return !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast() &&
+		!addr.IsMulticast() && !addr.IsUnspecified()
+}
+
+func normalizeIOC(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// indexIOCs records which incidents carry each indicator so pivots don't
+// have to scan the whole store. Callers must hold s.mu.
+func (s *IncidentStore) indexIOCs(id string, iocs []string) {
+	for _, ioc := range iocs {
+		key := normalizeIOC(ioc)
+		if s.iocIndex[key] == nil {
+			s.iocIndex[key] = make(map[string]bool)
+		}
+		s.iocIndex[key][id] = true
+	}
+}
+
+// unindexIOCs removes an incident from the index. Callers must hold s.mu.
+func (s *IncidentStore) unindexIOCs(id string, iocs []string) {
+	for _, ioc := range iocs {
+		key := normalizeIOC(ioc)
+		delete(s.iocIndex[key], id)
+		if len(s.iocIndex[key]) == 0 {
+			delete(s.iocIndex, key)
+		}
+	}
+}
+
+// incidentsWithIOC returns every incident containing the indicator, newest
+// first.
+func (s *IncidentStore) incidentsWithIOC(value string) []Incident {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := s.iocIndex[normalizeIOC(value)]
+	items := make([]Incident, 0, len(ids))
+	for _, id := range s.order {
+		if !ids[id] {
+			continue
+		}
+		if incident := s.incidents[id]; incident != nil {
+			items = append(items, *incident)
+		}
+	}
+	return items
+}
+
+func iocPivotHandler(store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.EscapedPath(), "/api/iocs/")
+		parts := strings.Split(path, "/")
+		if len(parts) != 2 || parts[1] != "incidents" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		value, err := url.PathUnescape(parts[0])
+		if err != nil || strings.TrimSpace(value) == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid ioc"})
+			return
+		}
+
+		items := visibleTo(r, store.incidentsWithIOC(value))
+		writeJSON(w, http.StatusOK, map[string]any{
+			"ioc":   value,
+			"type":  iocType(value),
+			"items": items,
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwtVerifier checks bearer JWTs from an identity provider: HS256 against
+// a shared secret, RS256 against the provider's JWKS. Each algorithm is only
+// accepted when its key is configured, so a token can't pick a weaker one.
+type jwtVerifier struct {
+	secret     []byte
+	jwksURL    string
+	issuer     string
+	audience   string
+	userClaim  string
+	nameClaim  string
+	rolesClaim string
+	// tenantClaim, when set, binds callers to the tenant it names.
+	tenantClaim string
+	leeway      time.Duration
+	client      *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	jwksTTL   time.Duration
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// newJWTVerifier reads JWT_SECRET and JWT_JWKS_URL, returning nil when
+// neither is set.
+func newJWTVerifier() *jwtVerifier {
+	secret, jwksURL := envString("JWT_SECRET", ""), envString("JWT_JWKS_URL", "")
+	if secret == "" && jwksURL == "" {
+		return nil
+	}
+	return &jwtVerifier{
+		secret:      []byte(secret),
+		jwksURL:     jwksURL,
+		issuer:      envString("JWT_ISSUER", ""),
+		audience:    envString("JWT_AUDIENCE", ""),
+		userClaim:   envString("JWT_USER_CLAIM", "sub"),
+		nameClaim:   envString("JWT_NAME_CLAIM", "name"),
+		rolesClaim:  envString("JWT_ROLES_CLAIM", "roles"),
+		tenantClaim: envString("JWT_TENANT_CLAIM", ""),
+		leeway:      envDuration("JWT_LEEWAY", time.Minute),
+		client:      newOutboundClient(),
+		keys:        map[string]*rsa.PublicKey{},
+		jwksTTL:     envDuration("JWT_JWKS_TTL", time.Hour),
+	}
+}
+
+// looksLikeJWT tells JWTs apart from the server's own key formats.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// verify checks a token's signature and registered claims and returns the
+// principal its claims describe.
+func (v *jwtVerifier) verify(ctx context.Context, token string, now time.Time) (Principal, error) {
+	claims, err := v.claims(ctx, token, now)
+	if err != nil {
+		return Principal{}, err
+	}
+	return v.principal(claims)
+}
+
+// claims checks a token's signature and registered claims and returns all
+// of its claims.
+func (v *jwtVerifier) claims(ctx context.Context, token string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, errors.New("malformed header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch {
+	case header.Alg == "HS256" && len(v.secret) > 0:
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("bad signature")
+		}
+	case header.Alg == "RS256" && v.jwksURL != "":
+		key, err := v.key(ctx, header.Kid, now)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, errors.New("bad signature")
+		}
+	default:
+		return nil, errors.New("unsupported alg " + header.Alg)
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, errors.New("malformed claims")
+	}
+	if err := v.checkClaims(claims, now); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// principal maps verified claims onto the caller they describe.
+func (v *jwtVerifier) principal(claims map[string]any) (Principal, error) {
+	user, _ := claimValue(claims, v.userClaim).(string)
+	if strings.TrimSpace(user) == "" {
+		return Principal{}, errors.New("missing " + v.userClaim + " claim")
+	}
+	name, _ := claimValue(claims, v.nameClaim).(string)
+	principal := Principal{
+		ID:    user,
+		Name:  fallback(strings.TrimSpace(name), user),
+		Kind:  principalUser,
+		Roles: claimStrings(claimValue(claims, v.rolesClaim)),
+	}
+	if v.tenantClaim != "" {
+		tenant, _ := claimValue(claims, v.tenantClaim).(string)
+		if principal.Tenant = strings.ToLower(strings.TrimSpace(tenant)); principal.Tenant == "" {
+			return Principal{}, errors.New("missing " + v.tenantClaim + " claim")
+		}
+	}
+	return principal, nil
+}
+
+func (v *jwtVerifier) checkClaims(claims map[string]any, now time.Time) error {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("missing exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not valid yet")
+	}
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return errors.New("unexpected issuer")
+	}
+	if v.audience != "" {
+		audiences := claimStrings(claims["aud"])
+		found := false
+		for _, audience := range audiences {
+			found = found || audience == v.audience
+		}
+		if !found {
+			return errors.New("unexpected audience")
+		}
+	}
+	return nil
+}
+
+// key returns the JWKS key for kid, refetching the set when it is stale or
+// doesn't have kid, which is how providers roll keys.
+func (v *jwtVerifier) key(ctx context.Context, kid string, now time.Time) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key, ok := v.keys[kid]; ok && now.Sub(v.fetchedAt) < v.jwksTTL {
+		return key, nil
+	}
+	// Don't let tokens with made-up kids hammer the provider.
+	if now.Sub(v.fetchedAt) < 30*time.Second {
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+		return nil, errors.New("unknown key " + kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := doJSON(ctx, v.client, http.MethodGet, v.jwksURL, nil, nil, &set); err != nil {
+		// A provider outage shouldn't lock out tokens signed with keys we
+		// already have.
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		if key, err := jwk.rsaKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	v.keys, v.fetchedAt = keys, now
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown key " + kid)
+}
+
+func (jwk jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("bad exponent")
+	}
+	exponent := 0
+	for _, b := range e {
+		exponent = exponent<<8 | int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+}
+
+func decodeJWTPart(part string, out any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// claimValue reads a claim by dotted path, such as realm_access.roles.
+func claimValue(claims map[string]any, path string) any {
+	var value any = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// claimStrings accepts a claim as a list of strings, or as one string of
+// names separated by spaces or commas.
+func claimStrings(value any) []string {
+	switch value := value.(type) {
+	case string:
+		return sanitizeSlice(strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }))
+	case []any:
+		values := []string{}
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return sanitizeSlice(values)
+	}
+	return nil
+}
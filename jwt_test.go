@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signJWT encodes claims under header and signs them with key: a []byte
+// secret for HS256, an *rsa.PrivateKey for RS256, or nil for no signature.
+func signJWT(t *testing.T, header, claims map[string]any, key any) string {
+	t.Helper()
+	encode := func(part map[string]any) string {
+		raw, err := json.Marshal(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	signed := encode(header) + "." + encode(claims)
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// jwksServer publishes key as the provider's only signing key, under kid.
+func jwksServer(t *testing.T, kid string, key *rsa.PublicKey) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"keys": []jsonWebKey{{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// claimsAt are valid claims for a token checked at now; cases edit a copy.
+func claimsAt(now time.Time, edit func(map[string]any)) map[string]any {
+	claims := map[string]any{
+		"sub":   "alice",
+		"name":  "Alice Analyst",
+		"roles": []string{"analyst"},
+		"iss":   "https://idp.example.com",
+		"aud":   "soc",
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	if edit != nil {
+		edit(claims)
+	}
+	return claims
+}
+
+func TestJWTVerifierHS256(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("JWT_ISSUER", "https://idp.example.com")
+	t.Setenv("JWT_AUDIENCE", "soc")
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	hs256 := map[string]any{"alg": "HS256", "typ": "JWT"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", signJWT(t, hs256, claimsAt(now, nil), []byte("secret")), ""},
+		{"expired", signJWT(t, hs256, claimsAt(now, func(c map[string]any) { c["exp"] = now.Add(-2 * time.Minute).Unix() }), []byte("secret")), "token expired"},
+		{"expired within leeway", signJWT(t, hs256, claimsAt(now, func(c map[string]any) { c["exp"] = now.Add(-30 * time.Second).Unix() }), []byte("secret")), ""},
+		{"not valid yet", signJWT(t, hs256, claimsAt(now, func(c map[string]any) { c["nbf"] = now.Add(time.Hour).Unix() }), []byte("secret")), "not valid yet"},
+		{"missing exp", signJWT(t, hs256, claimsAt(now, func(c map[string]any) { delete(c, "exp") }), []byte("secret")), "missing exp"},
+		{"wrong audience", signJWT(t, hs256, claimsAt(now, func(c map[string]any) { c["aud"] = "other-app" }), []byte("secret")), "unexpected audience"},
+		{"audience list", signJWT(t, hs256, claimsAt(now, func(c map[string]any) { c["aud"] = []string{"other-app", "soc"} }), []byte("secret")), ""},
+		{"wrong issuer", signJWT(t, hs256, claimsAt(now, func(c map[string]any) { c["iss"] = "https://evil.example.com" }), []byte("secret")), "unexpected issuer"},
+		{"wrong secret", signJWT(t, hs256, claimsAt(now, nil), []byte("guess")), "bad signature"},
+		{"alg none", signJWT(t, map[string]any{"alg": "none"}, claimsAt(now, nil), nil), "unsupported alg none"},
+		{"RS256 without a JWKS", signJWT(t, map[string]any{"alg": "RS256"}, claimsAt(now, nil), []byte("secret")), "unsupported alg RS256"},
+		{"missing subject", signJWT(t, hs256, claimsAt(now, func(c map[string]any) { delete(c, "sub") }), []byte("secret")), "missing sub claim"},
+		{"malformed", "not.a-token", "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := newJWTVerifier().verify(context.Background(), tt.token, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			if principal.ID != "alice" || principal.Name != "Alice Analyst" || principal.Kind != principalUser || !principal.hasRole("analyst") {
+				t.Errorf("verify() = %+v, want alice with the analyst role", principal)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := jwksServer(t, "k1", &key.PublicKey)
+	t.Setenv("JWT_JWKS_URL", server.URL)
+	t.Setenv("JWT_AUDIENCE", "soc")
+	now := time.Now().UTC()
+	rs256 := map[string]any{"alg": "RS256", "kid": "k1"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", signJWT(t, rs256, claimsAt(now, nil), key), ""},
+		{"expired", signJWT(t, rs256, claimsAt(now, func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() }), key), "token expired"},
+		{"wrong audience", signJWT(t, rs256, claimsAt(now, func(c map[string]any) { c["aud"] = "other-app" }), key), "unexpected audience"},
+		{"signed by another key", signJWT(t, rs256, claimsAt(now, nil), other), "bad signature"},
+		{"unknown kid", signJWT(t, map[string]any{"alg": "RS256", "kid": "k2"}, claimsAt(now, nil), key), "unknown key k2"},
+		// The public key is public: HS256 under it must not be accepted.
+		{"HS256 with the public key", signJWT(t, map[string]any{"alg": "HS256", "kid": "k1"}, claimsAt(now, nil), key.PublicKey.N.Bytes()), "unsupported alg HS256"},
+		{"alg none", signJWT(t, map[string]any{"alg": "none", "kid": "k1"}, claimsAt(now, nil), nil), "unsupported alg none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := newJWTVerifier().verify(context.Background(), tt.token, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			if principal.ID != "alice" {
+				t.Errorf("verify() = %+v, want alice", principal)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierTenantClaim(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("JWT_TENANT_CLAIM", "tid")
+	now := time.Now().UTC()
+	hs256 := map[string]any{"alg": "HS256"}
+
+	tests := []struct {
+		name       string
+		tenant     any
+		wantTenant string
+		wantErr    string
+	}{
+		{"bound", "Acme", "acme", ""},
+		{"missing", nil, "", "missing tid claim"},
+		{"blank", " ", "", "missing tid claim"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := claimsAt(now, func(c map[string]any) {
+				delete(c, "aud")
+				delete(c, "iss")
+				if tt.tenant != nil {
+					c["tid"] = tt.tenant
+				}
+			})
+			principal, err := newJWTVerifier().verify(context.Background(), signJWT(t, hs256, claims, []byte("secret")), now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || principal.Tenant != tt.wantTenant {
+				t.Fatalf("verify() = %+v, %v, want tenant %q", principal, err, tt.wantTenant)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// killChainPhases are the Lockheed Martin Cyber Kill Chain phases in attack
+// order, so stats can show how far attacks got.
+var killChainPhases = []string{
+	"recon",
+	"weaponization",
+	"delivery",
+	"exploitation",
+	"installation",
+	"command-and-control",
+	"actions-on-objectives",
+}
+
+// killChainNone clears the phase in an update.
+const killChainNone = "none"
+
+var killChainAliases = map[string]string{
+	"reconnaissance": "recon",
+	"c2":             "command-and-control",
+	"actions":        "actions-on-objectives",
+}
+
+// normalizeKillChainPhase returns the canonical phase name, or "" for
+// "none". Case, spaces, and underscores are ignored.
+func normalizeKillChainPhase(value string) (string, bool) {
+	phase := strings.ToLower(strings.TrimSpace(value))
+	phase = strings.NewReplacer(" ", "-", "_", "-").Replace(phase)
+	if phase == killChainNone {
+		return "", true
+	}
+	if alias, ok := killChainAliases[phase]; ok {
+		phase = alias
+	}
+	for _, candidate := range killChainPhases {
+		if candidate == phase {
+			return phase, true
+		}
+	}
+	return "", false
+}
+
+func killChainPhaseError() string {
+	return "killChainPhase must be one of " + strings.Join(killChainPhases, ", ") + " (or none)"
+}
+
+// filterByKillChainPhase keeps incidents in any of the comma-separated phases;
+// "none" matches incidents without one.
+func filterByKillChainPhase(items []Incident, phases string) ([]Incident, bool) {
+	if strings.TrimSpace(phases) == "" {
+		return items, true
+	}
+	wanted := map[string]bool{}
+	for _, value := range strings.Split(phases, ",") {
+		phase, ok := normalizeKillChainPhase(value)
+		if !ok {
+			return nil, false
+		}
+		wanted[phase] = true
+	}
+	filtered := make([]Incident, 0, len(items))
+	for _, incident := range items {
+		if wanted[incident.KillChainPhase] {
+			filtered = append(filtered, incident)
+		}
+	}
+	return filtered, true
+}
+
+type CountBucket struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// IncidentStats aggregates incidents for dashboards. KillChain lists every
+// phase in attack order, including empty ones, with "none" last.
+type IncidentStats struct {
+	Total       int           `json:"total"`
+	SLABreached int           `json:"slaBreached"`
+	BySeverity  []CountBucket `json:"bySeverity"`
+	ByStatus    []CountBucket `json:"byStatus"`
+	KillChain   []CountBucket `json:"killChain"`
+}
+
+func countBy(items []Incident, value func(Incident) string) []CountBucket {
+	counts := map[string]int{}
+	order := []string{}
+	for _, incident := range items {
+		key := value(incident)
+		if _, ok := counts[key]; !ok {
+			order = append(order, key)
+		}
+		counts[key]++
+	}
+	buckets := make([]CountBucket, 0, len(order))
+	for _, key := range order {
+		buckets = append(buckets, CountBucket{Value: key, Count: counts[key]})
+	}
+	return buckets
+}
+
+func buildIncidentStats(items []Incident) IncidentStats {
+	stats := IncidentStats{
+		Total:      len(items),
+		BySeverity: countBy(items, func(i Incident) string { return i.Severity }),
+		ByStatus:   countBy(items, func(i Incident) string { return i.Status }),
+		KillChain:  []CountBucket{},
+	}
+	phases := map[string]int{}
+	for _, incident := range items {
+		phases[incident.KillChainPhase]++
+		if incident.SLABreached {
+			stats.SLABreached++
+		}
+	}
+	for _, phase := range killChainPhases {
+		stats.KillChain = append(stats.KillChain, CountBucket{Value: phase, Count: phases[phase]})
+	}
+	stats.KillChain = append(stats.KillChain, CountBucket{Value: killChainNone, Count: phases[""]})
+	return stats
+}
+
+// statsHandler serves GET /api/stats, taking the same filters as the
+// incident list.
+func statsHandler(store incidentSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		items, ok := listIncidents(w, r, store)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, buildIncidentStats(items))
+	}
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAP protocol operations and result codes, from RFC 4511.
+const (
+	ldapBindRequest      = 0x60
+	ldapBindResponse     = 0x61
+	ldapUnbindRequest    = 0x42
+	ldapSearchRequest    = 0x63
+	ldapSearchEntry      = 0x64
+	ldapSearchDone       = 0x65
+	ldapSearchReference  = 0x73
+	ldapResultSuccess    = 0
+	ldapInvalidCreds     = 49
+	ldapScopeSubtree     = 2
+	ldapFilterEquality   = 0xa3
+	ldapSimpleAuth       = 0x80
+	ldapMaxMessageLength = 1 << 20
+)
+
+var errLDAPInvalidCredentials = errors.New("invalid username or password")
+
+type LDAPLoginInput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LDAPAuthenticator checks usernames and passwords against an LDAP or Active
+// Directory server with simple binds. With a service account it finds the
+// user's entry first and binds as its DN; without one it binds as
+// LDAP_USER_DN with the username filled in, e.g. "%s@corp.example.com".
+// Roles come from the groups in the entry's memberOf.
+type LDAPAuthenticator struct {
+	url          *url.URL
+	bindDN       string
+	bindPassword string
+	userDN       string
+	baseDN       string
+	userAttr     string
+	nameAttr     string
+	groupRoles   map[string][]string
+	timeout      time.Duration
+	tlsConfig    *tls.Config
+}
+
+// newLDAPAuthenticator reads the LDAP_* settings, returning nil when
+// LDAP_URL is unset.
+func newLDAPAuthenticator() *LDAPAuthenticator {
+	raw := envString("LDAP_URL", "")
+	if raw == "" {
+		return nil
+	}
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "ldap" && target.Scheme != "ldaps") || target.Host == "" {
+		log.Printf("ldap: LDAP_URL=%q must be ldap://host[:port] or ldaps://host[:port]; LDAP login disabled", raw)
+		return nil
+	}
+	auth := &LDAPAuthenticator{
+		url:          target,
+		bindDN:       envString("LDAP_BIND_DN", ""),
+		bindPassword: envString("LDAP_BIND_PASSWORD", ""),
+		userDN:       envString("LDAP_USER_DN", ""),
+		baseDN:       envString("LDAP_BASE_DN", ""),
+		userAttr:     envString("LDAP_USER_ATTRIBUTE", "sAMAccountName"),
+		nameAttr:     envString("LDAP_NAME_ATTRIBUTE", "displayName"),
+		groupRoles:   parseLDAPGroupRoles(envString("LDAP_GROUP_ROLES", "")),
+		timeout:      envDuration("LDAP_TIMEOUT", 10*time.Second),
+		tlsConfig:    &tls.Config{ServerName: target.Hostname(), InsecureSkipVerify: envBool("LDAP_TLS_INSECURE", false)},
+	}
+	if auth.baseDN == "" || (auth.bindDN == "" && auth.userDN == "") {
+		log.Printf("ldap: LDAP_BASE_DN and one of LDAP_BIND_DN or LDAP_USER_DN are required; LDAP login disabled")
+		return nil
+	}
+	return auth
+}
+
+// parseLDAPGroupRoles reads "SOC Admins=admin;SOC Analysts=analyst,hr".
+// Groups are matched by CN or by full DN; since DNs contain commas and
+// equals signs, the roles are whatever follows the last "=".
+func parseLDAPGroupRoles(value string) map[string][]string {
+	mapping := map[string][]string{}
+	for _, entry := range sanitizeSlice(strings.Split(value, ";")) {
+		cut := strings.LastIndex(entry, "=")
+		if cut <= 0 {
+			log.Printf("ignoring LDAP group mapping %q: want group=role[,role], e.g. SOC Admins=admin", entry)
+			continue
+		}
+		group := strings.ToLower(strings.TrimSpace(entry[:cut]))
+		mapping[group] = append(mapping[group], sanitizeSlice(strings.Split(entry[cut+1:], ","))...)
+	}
+	return mapping
+}
+
+// roles maps memberOf DNs onto roles.
+func (a *LDAPAuthenticator) roles(groups []string) []string {
+	roles := []string{}
+	for _, group := range groups {
+		roles = append(roles, a.groupRoles[strings.ToLower(group)]...)
+		if cn, _, _ := strings.Cut(group, ","); strings.HasPrefix(strings.ToLower(cn), "cn=") {
+			roles = append(roles, a.groupRoles[strings.ToLower(strings.TrimSpace(cn[3:]))]...)
+		}
+	}
+	return dedupeStrings(roles)
+}
+
+// authenticate binds as the user and returns who they are.
+func (a *LDAPAuthenticator) authenticate(username, password string) (Principal, error) {
+	username = strings.TrimSpace(username)
+	// An empty password is an unauthenticated bind, which servers accept.
+	if username == "" || password == "" {
+		return Principal{}, errLDAPInvalidCredentials
+	}
+	conn, err := a.dial()
+	if err != nil {
+		return Principal{}, err
+	}
+	defer conn.close()
+
+	if a.bindDN != "" {
+		if err := conn.bind(a.bindDN, a.bindPassword); err != nil {
+			return Principal{}, fmt.Errorf("service bind: %w", err)
+		}
+	} else if err := conn.bind(strings.ReplaceAll(a.userDN, "%s", username), password); err != nil {
+		return Principal{}, err
+	}
+
+	entries, err := conn.search(a.baseDN, a.userAttr, username, []string{a.userAttr, a.nameAttr, "cn", "memberOf"})
+	if err != nil {
+		return Principal{}, err
+	}
+	if len(entries) != 1 {
+		return Principal{}, errLDAPInvalidCredentials
+	}
+	entry := entries[0]
+	if a.bindDN != "" {
+		if err := conn.bind(entry.dn, password); err != nil {
+			return Principal{}, err
+		}
+	}
+	id := fallback(entry.first(a.userAttr), username)
+	return Principal{
+		ID:    id,
+		Name:  fallback(entry.first(a.nameAttr), fallback(entry.first("cn"), id)),
+		Kind:  principalUser,
+		Roles: a.roles(entry.attributes["memberof"]),
+	}, nil
+}
+
+type ldapConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int
+}
+
+type ldapEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+func (e ldapEntry) first(attribute string) string {
+	if values := e.attributes[strings.ToLower(attribute)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (a *LDAPAuthenticator) dial() (*ldapConn, error) {
+	host := a.url.Host
+	if a.url.Port() == "" {
+		port := "389"
+		if a.url.Scheme == "ldaps" {
+			port = "636"
+		}
+		host = net.JoinHostPort(a.url.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: a.timeout}
+	var conn net.Conn
+	var err error
+	if a.url.Scheme == "ldaps" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, a.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", host, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(a.timeout))
+	return &ldapConn{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (c *ldapConn) close() {
+	c.nextID++
+	_, _ = c.conn.Write(berTLV(0x30, berInt(0x02, c.nextID), []byte{ldapUnbindRequest, 0}))
+	_ = c.conn.Close()
+}
+
+// send writes one request and returns its message ID.
+func (c *ldapConn) send(op []byte) (int, error) {
+	c.nextID++
+	_, err := c.conn.Write(berTLV(0x30, berInt(0x02, c.nextID), op))
+	return c.nextID, err
+}
+
+// receive reads the next response to message id, returning its operation.
+func (c *ldapConn) receive(id int) (byte, []byte, error) {
+	for {
+		tag, message, err := berRead(c.reader)
+		if err != nil {
+			return 0, nil, err
+		}
+		if tag != 0x30 {
+			return 0, nil, errors.New("ldap: unexpected response")
+		}
+		parts, err := berElements(message)
+		if err != nil || len(parts) < 2 {
+			return 0, nil, errors.New("ldap: malformed response")
+		}
+		if berToInt(parts[0].content) != id {
+			continue
+		}
+		return parts[1].tag, parts[1].content, nil
+	}
+}
+
+func (c *ldapConn) bind(dn, password string) error {
+	id, err := c.send(berTLV(ldapBindRequest, berInt(0x02, 3), berTLV(0x04, []byte(dn)), berTLV(ldapSimpleAuth, []byte(password))))
+	if err != nil {
+		return err
+	}
+	tag, content, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if tag != ldapBindResponse {
+		return errors.New("ldap: unexpected bind response")
+	}
+	return ldapResult(content)
+}
+
+// search finds entries below base whose attribute equals value. The filter
+// is built as BER rather than from a string, so value can't inject.
+func (c *ldapConn) search(base, attribute, value string, attributes []string) ([]ldapEntry, error) {
+	wanted := []byte{}
+	for _, name := range attributes {
+		wanted = append(wanted, berTLV(0x04, []byte(name))...)
+	}
+	id, err := c.send(berTLV(ldapSearchRequest,
+		berTLV(0x04, []byte(base)),
+		berInt(0x0a, ldapScopeSubtree),
+		berInt(0x0a, 0),
+		berInt(0x02, 2),
+		berInt(0x02, 10),
+		[]byte{0x01, 1, 0},
+		berTLV(ldapFilterEquality, berTLV(0x04, []byte(attribute)), berTLV(0x04, []byte(value))),
+		berTLV(0x30, wanted),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []ldapEntry{}
+	for {
+		tag, content, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case ldapSearchEntry:
+			entry, err := parseLDAPEntry(content)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case ldapSearchReference:
+		case ldapSearchDone:
+			return entries, ldapResult(content)
+		default:
+			return nil, errors.New("ldap: unexpected search response")
+		}
+	}
+}
+
+func parseLDAPEntry(content []byte) (ldapEntry, error) {
+	parts, err := berElements(content)
+	if err != nil || len(parts) < 2 {
+		return ldapEntry{}, errors.New("ldap: malformed entry")
+	}
+	entry := ldapEntry{dn: string(parts[0].content), attributes: map[string][]string{}}
+	attributes, err := berElements(parts[1].content)
+	if err != nil {
+		return ldapEntry{}, errors.New("ldap: malformed entry")
+	}
+	for _, attribute := range attributes {
+		fields, err := berElements(attribute.content)
+		if err != nil || len(fields) < 2 {
+			continue
+		}
+		values, _ := berElements(fields[1].content)
+		name := strings.ToLower(string(fields[0].content))
+		for _, value := range values {
+			entry.attributes[name] = append(entry.attributes[name], string(value.content))
+		}
+	}
+	return entry, nil
+}
+
+// ldapResult turns an LDAPResult into an error unless it is success.
+func ldapResult(content []byte) error {
+	parts, err := berElements(content)
+	if err != nil || len(parts) < 3 {
+		return errors.New("ldap: malformed result")
+	}
+	switch code := berToInt(parts[0].content); code {
+	case ldapResultSuccess:
+		return nil
+	case ldapInvalidCreds:
+		return errLDAPInvalidCredentials
+	default:
+		return fmt.Errorf("ldap: result %d: %s", code, parts[2].content)
+	}
+}
+
+type berElement struct {
+	tag     byte
+	content []byte
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	encoded := []byte{}
+	for ; n > 0; n >>= 8 {
+		encoded = append([]byte{byte(n)}, encoded...)
+	}
+	return append([]byte{0x80 | byte(len(encoded))}, encoded...)
+}
+
+func berTLV(tag byte, contents ...[]byte) []byte {
+	body := []byte{}
+	for _, content := range contents {
+		body = append(body, content...)
+	}
+	return append(append([]byte{tag}, berLength(len(body))...), body...)
+}
+
+func berInt(tag byte, value int) []byte {
+	encoded := []byte{byte(value)}
+	for value >>= 8; value > 0; value >>= 8 {
+		encoded = append([]byte{byte(value)}, encoded...)
+	}
+	if encoded[0]&0x80 != 0 {
+		encoded = append([]byte{0}, encoded...)
+	}
+	return berTLV(tag, encoded)
+}
+
+func berToInt(content []byte) int {
+	value := 0
+	for _, b := range content {
+		value = value<<8 | int(b)
+	}
+	return value
+}
+
+// berRead reads one element from the connection.
+func berRead(reader *bufio.Reader) (byte, []byte, error) {
+	tag, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	first, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		// Indefinite and oversized lengths don't occur in LDAP.
+		if first == 0x80 || first&0x7f > 4 {
+			return 0, nil, errors.New("ldap: bad length")
+		}
+		length = 0
+		for i := 0; i < int(first&0x7f); i++ {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > ldapMaxMessageLength {
+		return 0, nil, errors.New("ldap: response too large")
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(reader, content); err != nil {
+		return 0, nil, err
+	}
+	return tag, content, nil
+}
+
+// berElements splits content into the elements it is a sequence of.
+func berElements(content []byte) ([]berElement, error) {
+	elements := []berElement{}
+	for len(content) > 0 {
+		if len(content) < 2 {
+			return nil, errors.New("truncated element")
+		}
+		tag, length, offset := content[0], int(content[1]), 2
+		if content[1]&0x80 != 0 {
+			count := int(content[1] & 0x7f)
+			if count == 0 || count > 4 || len(content) < 2+count {
+				return nil, errors.New("bad length")
+			}
+			length = berToInt(content[2 : 2+count])
+			offset += count
+		}
+		if length > len(content)-offset {
+			return nil, errors.New("truncated element")
+		}
+		elements = append(elements, berElement{tag: tag, content: content[offset : offset+length]})
+		content = content[offset+length:]
+	}
+	return elements, nil
+}
+
+// ldapLoginHandler serves POST /auth/ldap {"username","password"}, which
+// starts a session like the SSO login does.
+func ldapLoginHandler(ldap *LDAPAuthenticator, sessions *SessionStore, users *UserStore, audit *AuditLog, limiter *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var input LDAPLoginInput
+		if err := readJSON(r, &input); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		if !limiter.limitLogin(w, input.Username) {
+			return
+		}
+		event := AuditEvent{
+			Actor:      strings.TrimSpace(input.Username),
+			ActorType:  principalUser,
+			Action:     "auth.login",
+			Resource:   r.URL.Path,
+			Detail:     "ldap",
+			RemoteAddr: r.RemoteAddr,
+			UserAgent:  r.UserAgent(),
+		}
+		principal, err := ldap.authenticate(input.Username, input.Password)
+		if err != nil {
+			event.Outcome, event.Detail = auditOutcomeFailure, "ldap: "+err.Error()
+			audit.record(event)
+			if errors.Is(err, errLDAPInvalidCredentials) {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+				return
+			}
+			log.Printf("ldap: %v", err)
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": "directory unavailable"})
+			return
+		}
+		if users.inactive(principal.ID) {
+			event.Actor, event.Outcome, event.Detail = principal.ID, auditOutcomeFailure, "account deactivated"
+			audit.record(event)
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "account deactivated"})
+			return
+		}
+
+		token, session, err := sessions.create(principal, "", time.Now().UTC())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		event.Actor = principal.ID
+		audit.record(event)
+		http.SetCookie(w, sessions.cookie(token, session.ExpiresAt))
+		writeJSON(w, http.StatusOK, sessions.view(principal, &session))
+	}
+}
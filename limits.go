@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default request body limits. Alert intake takes batches from SIEMs and
+// forwarders, so it gets more room than the rest of the API.
+const (
+	defaultBodyMaxBytes       = 1 << 20
+	defaultIngestBodyMaxBytes = 10 << 20
+)
+
+// newHTTPServer applies the HTTP_ timeouts, which keep slow clients from
+// holding connections open: a client gets HTTP_READ_HEADER_TIMEOUT to send
+// its headers and HTTP_READ_TIMEOUT for the whole request, the response
+// must be written within HTTP_WRITE_TIMEOUT, and idle keep-alive
+// connections are closed after HTTP_IDLE_TIMEOUT. Streams, long polls, and
+// profiles lift the write timeout themselves.
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: envDuration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:       envDuration("HTTP_READ_TIMEOUT", time.Minute),
+		WriteTimeout:      envDuration("HTTP_WRITE_TIMEOUT", time.Minute),
+		IdleTimeout:       envDuration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+	}
+}
+
+// withBodyLimit caps request bodies at limit bytes, ingestLimit for alert
+// intake, or uploadLimit for attachment uploads, answering 413 up front
+// when Content-Length is already over.
+func withBodyLimit(next http.Handler, limit, ingestLimit, uploadLimit int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+		max := limit
+		switch {
+		case attachmentUpload(r):
+			max = uploadLimit
+		case rateClass(r) == rateClassIngest:
+			max = ingestLimit
+		}
+		if r.ContentLength > max {
+			writeBodyTooLarge(w, max)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// attachmentUpload reports whether r is a POST to
+// /api/incidents/{id}/attachments, the one route that takes multipart
+// uploads.
+func attachmentUpload(r *http.Request) bool {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/incidents/"), "/")
+	return r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/incidents/") && len(parts) == 2 && parts[0] != "" && parts[1] == "attachments"
+}
+
+// bodyErrorStatus is the status for a body that couldn't be read: 413 when
+// it was over the limit, 408 when the client didn't send it within
+// HTTP_READ_TIMEOUT, and 400 when it just didn't decode.
+func bodyErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusRequestTimeout
+	}
+	return http.StatusBadRequest
+}
+
+// writeBodyError answers a request whose JSON body couldn't be read.
+func writeBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch bodyErrorStatus(err) {
+	case http.StatusRequestEntityTooLarge:
+		errors.As(err, &tooLarge)
+		writeBodyTooLarge(w, tooLarge.Limit)
+	case http.StatusRequestTimeout:
+		// The write timeout is usually up by the time the read timeout is,
+		// so allow a moment to say why.
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(5 * time.Second))
+		writeJSON(w, http.StatusRequestTimeout, map[string]string{"error": "request body not received in time"})
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid payload"})
+	}
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, limit int64) {
+	writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "request body is limited to " + strconv.FormatInt(limit, 10) + " bytes"})
+}
+
+// clearWriteDeadline lifts the server's write timeout for a response that
+// is meant to take longer, such as a stream or a long poll.
+func clearWriteDeadline(w http.ResponseWriter) {
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Link types. Each is stored on both incidents, the other side with its
+// inverse: an incident causedBy another is recorded there as causes.
+const (
+	linkRelatedTo    = "relatedTo"
+	linkDuplicateOf  = "duplicateOf"
+	linkDuplicatedBy = "duplicatedBy"
+	linkCausedBy     = "causedBy"
+	linkCauses       = "causes"
+)
+
+var linkInverses = map[string]string{
+	linkRelatedTo:    linkRelatedTo,
+	linkDuplicateOf:  linkDuplicatedBy,
+	linkDuplicatedBy: linkDuplicateOf,
+	linkCausedBy:     linkCauses,
+	linkCauses:       linkCausedBy,
+}
+
+// maxLinkDepth bounds how far GET /links walks from an incident.
+const maxLinkDepth = 5
+
+// IncidentLink connects an incident to another. Incident summarizes the
+// other side in responses.
+type IncidentLink struct {
+	Type       string          `json:"type"`
+	IncidentID string          `json:"incidentId"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	CreatedBy  string          `json:"createdBy,omitempty"`
+	Incident   *LinkedIncident `json:"incident,omitempty"`
+}
+
+// LinkedIncident is the part of a linked incident shown next to the link.
+type LinkedIncident struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Severity string `json:"severity"`
+	Status   string `json:"status"`
+}
+
+type LinkInput struct {
+	Type       string `json:"type"`
+	IncidentID string `json:"incidentId"`
+}
+
+var errLinkNotFound = errors.New("link not found")
+
+// normalizeLinkType matches value against the link types ignoring case.
+func normalizeLinkType(value string) (string, bool) {
+	for linkType := range linkInverses {
+		if strings.EqualFold(linkType, strings.TrimSpace(value)) {
+			return linkType, true
+		}
+	}
+	return "", false
+}
+
+func hasLink(links []IncidentLink, linkType, otherID string) bool {
+	for _, link := range links {
+		if link.Type == linkType && link.IncidentID == otherID {
+			return true
+		}
+	}
+	return false
+}
+
+// link records a link from id to otherID and its inverse on otherID.
+func (s *IncidentStore) link(id, linkType, otherID, by string, now time.Time) (Incident, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return Incident{}, errIncidentNotFound
+	}
+	other, ok := s.incidents[otherID]
+	switch {
+	case !ok:
+		return Incident{}, errors.New(otherID + ": " + errIncidentNotFound.Error())
+	case other == incident:
+		return Incident{}, errors.New("an incident can't link to itself")
+	case hasLink(incident.Links, linkType, otherID):
+		return Incident{}, errors.New(id + " is already " + linkType + " " + otherID)
+	}
+
+	for _, side := range []struct {
+		incident *Incident
+		link     IncidentLink
+	}{
+		{incident, IncidentLink{Type: linkType, IncidentID: otherID, CreatedAt: now, CreatedBy: by}},
+		{other, IncidentLink{Type: linkInverses[linkType], IncidentID: id, CreatedAt: now, CreatedBy: by}},
+	} {
+		previous := *side.incident
+		side.incident.Links = append(append([]IncidentLink{}, side.incident.Links...), side.link)
+		side.incident.UpdatedAt = now
+		s.emit(eventIncidentUpdated, *side.incident, &previous)
+	}
+	return *incident, nil
+}
+
+// unlink removes a link and its inverse. An empty linkType removes every
+// link between the two.
+func (s *IncidentStore) unlink(id, linkType, otherID string, now time.Time) (Incident, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return Incident{}, errIncidentNotFound
+	}
+	keep := func(links []IncidentLink, otherID string, inverse bool) ([]IncidentLink, bool) {
+		kept, removed := []IncidentLink{}, false
+		for _, link := range links {
+			want := linkType
+			if inverse && linkType != "" {
+				want = linkInverses[linkType]
+			}
+			if link.IncidentID == otherID && (want == "" || link.Type == want) {
+				removed = true
+				continue
+			}
+			kept = append(kept, link)
+		}
+		return kept, removed
+	}
+
+	links, removed := keep(incident.Links, otherID, false)
+	if !removed {
+		return Incident{}, errLinkNotFound
+	}
+	previous := *incident
+	incident.Links, incident.UpdatedAt = links, now
+	s.emit(eventIncidentUpdated, *incident, &previous)
+	if other, ok := s.incidents[otherID]; ok {
+		previous := *other
+		other.Links, _ = keep(other.Links, id, true)
+		other.UpdatedAt = now
+		s.emit(eventIncidentUpdated, *other, &previous)
+	}
+	return *incident, nil
+}
+
+// resolveLinks fills in each link's incident summary, leaving out links to
+// incidents that were purged or that the caller can't see.
+func resolveLinks(r *http.Request, store *IncidentStore, links []IncidentLink) []IncidentLink {
+	resolved := []IncidentLink{}
+	for _, link := range links {
+		other, ok := store.get(link.IncidentID)
+		if !ok || !canView(r, *other) {
+			continue
+		}
+		link.Incident = &LinkedIncident{ID: other.ID, Title: other.Title, Severity: other.Severity, Status: other.Status}
+		resolved = append(resolved, link)
+	}
+	return resolved
+}
+
+// LinkGraph is everything reachable from an incident through links.
+type LinkGraph struct {
+	Root  string           `json:"root"`
+	Depth int              `json:"depth"`
+	Nodes []LinkedIncident `json:"nodes"`
+	Edges []LinkEdge       `json:"edges"`
+}
+
+type LinkEdge struct {
+	From string `json:"from"`
+	Type string `json:"type"`
+	To   string `json:"to"`
+}
+
+// linkGraph walks links breadth first from root up to depth hops. Each
+// link appears once, in the direction it was created from the walk's side.
+func linkGraph(r *http.Request, store *IncidentStore, root Incident, depth int) LinkGraph {
+	graph := LinkGraph{Root: root.ID, Depth: depth, Nodes: []LinkedIncident{}, Edges: []LinkEdge{}}
+	visited := map[string]bool{root.ID: true}
+	edges := map[string]bool{}
+	graph.Nodes = append(graph.Nodes, LinkedIncident{ID: root.ID, Title: root.Title, Severity: root.Severity, Status: root.Status})
+	frontier := []Incident{root}
+	for hop := 0; hop < depth && len(frontier) > 0; hop++ {
+		next := []Incident{}
+		for _, incident := range frontier {
+			for _, link := range resolveLinks(r, store, incident.Links) {
+				if !edges[link.IncidentID+"|"+linkInverses[link.Type]+"|"+incident.ID] {
+					edges[incident.ID+"|"+link.Type+"|"+link.IncidentID] = true
+					graph.Edges = append(graph.Edges, LinkEdge{From: incident.ID, Type: link.Type, To: link.IncidentID})
+				}
+				if visited[link.IncidentID] {
+					continue
+				}
+				visited[link.IncidentID] = true
+				graph.Nodes = append(graph.Nodes, *link.Incident)
+				if other, ok := store.get(link.IncidentID); ok {
+					next = append(next, *other)
+				}
+			}
+		}
+		frontier = next
+	}
+	return graph
+}
+
+// handleIncidentLinks serves GET and POST /api/incidents/{id}/links and
+// DELETE /api/incidents/{id}/links/{otherId} (?type= to remove just one).
+func handleIncidentLinks(w http.ResponseWriter, r *http.Request, id string, parts []string, store *IncidentStore) {
+	if len(parts) == 3 {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		linkType := ""
+		if value := r.URL.Query().Get("type"); value != "" {
+			normalized, ok := normalizeLinkType(value)
+			if !ok {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": linkTypeError()})
+				return
+			}
+			linkType = normalized
+		}
+		incident, err := store.unlink(id, linkType, parts[2], time.Now().UTC())
+		if errors.Is(err, errIncidentNotFound) || errors.Is(err, errLinkNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		incident.Links = resolveLinks(r, store, incident.Links)
+		writeJSON(w, http.StatusOK, incident)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		incident, ok := store.get(id)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		depth := 1
+		if value := r.URL.Query().Get("depth"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > maxLinkDepth {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "depth must be between 1 and " + itoa(maxLinkDepth)})
+				return
+			}
+			depth = parsed
+		}
+		writeJSON(w, http.StatusOK, linkGraph(r, store, *incident, depth))
+	case http.MethodPost:
+		var input LinkInput
+		if err := readJSON(r, &input); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		linkType, ok := normalizeLinkType(input.Type)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": linkTypeError()})
+			return
+		}
+		otherID := strings.TrimSpace(input.IncidentID)
+		if other, ok := store.get(otherID); ok && !canView(r, *other) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": otherID + ": " + errIncidentNotFound.Error()})
+			return
+		}
+		name, _ := actor(r.Context())
+		incident, err := store.link(id, linkType, otherID, name, time.Now().UTC())
+		if errors.Is(err, errIncidentNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			return
+		}
+		incident.Links = resolveLinks(r, store, incident.Links)
+		writeJSON(w, http.StatusCreated, incident)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func linkTypeError() string {
+	return "type must be one of relatedTo, duplicateOf, duplicatedBy, causedBy, causes"
+}
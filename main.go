@@ -1,69 +1,216 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
+	"maps"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
 type Note struct {
-	ID        string    `json:"id"`
-	Body      string    `json:"body"`
-	Author    string    `json:"author"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID         string    `json:"id"`
+	Body       string    `json:"body"`
+	Author     string    `json:"author"`
+	AuthorType string    `json:"authorType,omitempty"`
+	AuthorID   string    `json:"authorId,omitempty"`
+	AuthorIcon string    `json:"authorIcon,omitempty"`
+	Kind       string    `json:"kind,omitempty"`
+	Mentions   []string  `json:"mentions,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// ParentNoteID is the note this one replies to.
+	ParentNoteID string `json:"parentNoteId,omitempty"`
+	// MergedFrom is the incident the note was written on before that
+	// incident was merged into this one.
+	MergedFrom string `json:"mergedFrom,omitempty"`
+	// BodyHTML is Body rendered from markdown, filled in only for responses
+	// to ?render=html.
+	BodyHTML string `json:"bodyHtml,omitempty"`
 }
 
 type Incident struct {
-	ID        string    `json:"id"`
-	Title     string    `json:"title"`
-	Severity  string    `json:"severity"`
-	Status    string    `json:"status"`
-	Owner     string    `json:"owner"`
-	Tags      []string  `json:"tags"`
-	IOCs      []string  `json:"iocs"`
-	Notes     []Note    `json:"notes"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID string `json:"id"`
+	// Tenant is the customer the incident belongs to on multi-tenant
+	// servers; only requests for that tenant see it.
+	Tenant        string           `json:"tenant,omitempty"`
+	Type          string           `json:"type"`
+	Restricted    bool             `json:"restricted"`
+	Title         string           `json:"title"`
+	Severity      string           `json:"severity"`
+	Status        string           `json:"status"`
+	Owner         string           `json:"owner"`
+	Tags          []string         `json:"tags"`
+	IOCs          []string         `json:"iocs"`
+	Notes         []Note           `json:"notes"`
+	Tasks         []Task           `json:"tasks"`
+	Enrichments   []Enrichment     `json:"enrichments"`
+	WatchlistHits []WatchlistHit   `json:"watchlistHits"`
+	FeedHits      []FeedHit        `json:"feedHits"`
+	AlertCount    int              `json:"alertCount,omitempty"`
+	LastAlertAt   *time.Time       `json:"lastAlertAt,omitempty"`
+	Alerts        []IncidentAlert  `json:"alerts"`
+	WarRoom       *WarRoom         `json:"warRoom,omitempty"`
+	Summary       *IncidentSummary `json:"summary,omitempty"`
+	Major         bool             `json:"major"`
+	// KillChainPhase is how far the attack got, one of killChainPhases, or
+	// empty when not assessed.
+	KillChainPhase string        `json:"killChainPhase"`
+	MajorSince     *time.Time    `json:"majorSince,omitempty"`
+	SitrepDueAt    *time.Time    `json:"sitrepDueAt,omitempty"`
+	AccessReview   *AccessReview `json:"accessReview,omitempty"`
+	ClosedStats    *ClosedStats  `json:"closedStats,omitempty"`
+	// Disposition is what the incident turned out to be, one of
+	// dispositions. Reopening clears it.
+	Disposition string `json:"disposition,omitempty"`
+	// RuleID is the detection rule that opened the incident, if any.
+	RuleID string `json:"ruleId,omitempty"`
+	// Routing is what the routing configuration applied at creation.
+	Routing *IncidentRouting `json:"routing,omitempty"`
+	// Source is where the incident came from: the alert source for
+	// ingested alerts, "sigma" for rule matches, or whatever the API caller
+	// set.
+	Source string `json:"source,omitempty"`
+	// Template is the incident template the incident was created from.
+	Template string `json:"template,omitempty"`
+	// MergedInto is the incident this one was merged into and closed for;
+	// MergedFrom lists the incidents merged into this one.
+	MergedInto string   `json:"mergedInto,omitempty"`
+	MergedFrom []string `json:"mergedFrom,omitempty"`
+	// CampaignID is the campaign the incident is part of.
+	CampaignID string `json:"campaignId,omitempty"`
+	// CaseID is the case investigating the incident.
+	CaseID string `json:"caseId,omitempty"`
+	// Links connect this incident to related ones, in both directions.
+	Links []IncidentLink `json:"links,omitempty"`
+	// NoteThreads is Notes arranged as reply threads, filled in only for
+	// the incident detail response.
+	NoteThreads []NoteThread `json:"noteThreads,omitempty"`
+	// SuggestedSeverity is computed from the incident's signals; Scoring
+	// explains it. Severity stays whatever the analyst set.
+	SuggestedSeverity string         `json:"suggestedSeverity"`
+	Scoring           *SeverityScore `json:"scoring,omitempty"`
+	// SLA tracks the severity's response and containment timers; SLADueAt
+	// is the next unmet deadline.
+	SLA         *SLAState  `json:"sla,omitempty"`
+	SLADueAt    *time.Time `json:"slaDueAt,omitempty"`
+	SLABreached bool       `json:"slaBreached"`
+	// MalformedIOCs flags IOCs that look like an IP, domain, hash, or URL
+	// but aren't valid ones.
+	MalformedIOCs []IOCProblem `json:"malformedIocs,omitempty"`
+	// Aging is filled in on list and queue responses.
+	Aging     *IncidentAging `json:"aging,omitempty"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+
+	history []FieldChange
+	// trace is the trace context of the change that produced this version.
+	trace traceContext
 }
 
 type IncidentInput struct {
-	Title    string   `json:"title"`
-	Severity string   `json:"severity"`
-	Status   string   `json:"status"`
-	Owner    string   `json:"owner"`
-	Tags     []string `json:"tags"`
-	IOCs     []string `json:"iocs"`
+	Type string `json:"type"`
+	// Restricted defaults to true for HR cases and false otherwise.
+	Restricted *bool    `json:"restricted"`
+	Title      string   `json:"title"`
+	Severity   string   `json:"severity"`
+	Status     string   `json:"status"`
+	Owner      string   `json:"owner"`
+	Tags       []string `json:"tags"`
+	IOCs       []string `json:"iocs"`
+	// KillChainPhase is normalized by the handler.
+	KillChainPhase string `json:"killChainPhase"`
+	Source         string `json:"source"`
+	// RuleID is set by the rule engine, never by clients.
+	RuleID string `json:"-"`
+	// Template and Tasks are filled in from an incident template.
+	Template string      `json:"-"`
+	Tasks    []TaskInput `json:"-"`
+	// Actor fields attribute the initial field values; set from the caller.
+	Actor   string `json:"-"`
+	ActorID string `json:"-"`
+	// Trace is the caller's trace context, carried onto the outbound calls
+	// the change causes.
+	Trace traceContext `json:"-"`
+	// Tenant is the caller's tenant, which the incident is created in.
+	Tenant string `json:"-"`
 }
 
 type IncidentUpdate struct {
 	Severity string `json:"severity"`
 	Status   string `json:"status"`
 	Owner    string `json:"owner"`
+	Major    *bool  `json:"major"`
+	// KillChainPhase sets the phase; "none" clears it.
+	KillChainPhase string `json:"killChainPhase"`
+	// Restricted can only be changed by callers cleared for restricted cases.
+	Restricted *bool `json:"restricted"`
+	// Disposition sets what the incident turned out to be; "none" clears it.
+	Disposition string `json:"disposition"`
+	// Actor fields attribute the change in field history; set from the
+	// caller, never by clients.
+	Actor   string       `json:"-"`
+	ActorID string       `json:"-"`
+	Trace   traceContext `json:"-"`
 }
 
 type NoteInput struct {
-	Body   string `json:"body"`
-	Author string `json:"author"`
+	Body         string `json:"body"`
+	Author       string `json:"author"`
+	Kind         string `json:"kind"`
+	ParentNoteID string `json:"parentNoteId"`
+	// Author identity fields are set by trusted callers (automations and
+	// authenticated service identities), never by clients.
+	AuthorType string       `json:"-"`
+	AuthorID   string       `json:"-"`
+	AuthorIcon string       `json:"-"`
+	Mentions   []string     `json:"-"`
+	Trace      traceContext `json:"-"`
 }
 
+var errIncidentNotFound = errors.New("incident not found")
+
 type IncidentStore struct {
 	mu        sync.RWMutex
 	incidents map[string]*Incident
 	order     []string
 	counter   int
+	hrCounter int
+	// tenantCounters number each tenant's incidents separately, keyed by
+	// tenant and case type.
+	tenantCounters map[string]int
+	iocIndex       map[string]map[string]bool
+	sitrepInterval time.Duration
+	subscribers    []func(IncidentEvent)
+	annotators     []func(*Incident)
+	createHooks    []func(*Incident)
+	pending        []IncidentEvent
+	seq            uint64
+	// tombstones are deletions kept for delta syncs, oldest first; deltas
+	// from before tombstoneHorizon can't be served.
+	tombstones         []Tombstone
+	tombstoneHorizon   time.Time
+	tombstoneRetention time.Duration
 }
 
 func newIncidentStore() *IncidentStore {
 	store := &IncidentStore{
-		incidents: make(map[string]*Incident),
-		order:     []string{},
-		counter:   1000,
+		incidents:      make(map[string]*Incident),
+		order:          []string{},
+		counter:        1000,
+		tenantCounters: make(map[string]int),
+		iocIndex:       make(map[string]map[string]bool),
+		sitrepInterval: envDuration("MAJOR_SITREP_INTERVAL", 30*time.Minute),
+		// Nothing from before this run survives it, deletions included.
+		tombstoneHorizon:   startedAt,
+		tombstoneRetention: envDuration("TOMBSTONE_RETENTION", 30*24*time.Hour),
 	}
 
 	seed := []IncidentInput{
@@ -100,6 +247,13 @@ func newIncidentStore() *IncidentStore {
 	return store
 }
 
+// size is the number of incidents across all tenants.
+func (s *IncidentStore) size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.incidents)
+}
+
 func (s *IncidentStore) list() []Incident {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -141,6 +295,28 @@ func filterIncidents(items []Incident, severity, status, query string) []Inciden
 	return filtered
 }
 
+// listIncidents applies the incident list filters (severity, status, q,
+// query, killChainPhase, and slaBreached) and sort to what the caller can
+// see, writing a 400 for invalid ones.
+func listIncidents(w http.ResponseWriter, r *http.Request, store incidentSource) ([]Incident, bool) {
+	params := r.URL.Query()
+	items := filterIncidents(visibleTo(r, store.list()), params.Get("severity"), params.Get("status"), params.Get("q"))
+	if structured := params.Get("query"); structured != "" {
+		parsed, err := parseQuery(structured)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid query: " + err.Error()})
+			return nil, false
+		}
+		items = filterByQuery(items, parsed)
+	}
+	items, ok := filterByKillChainPhase(items, params.Get("killChainPhase"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": killChainPhaseError()})
+		return nil, false
+	}
+	return slaListParams(w, r, items)
+}
+
 func matchesQuery(incident Incident, query string) bool {
 	if strings.Contains(strings.ToLower(incident.Title), query) {
 		return true
@@ -174,36 +350,104 @@ func (s *IncidentStore) get(id string) (*Incident, bool) {
 
 func (s *IncidentStore) create(input IncidentInput) Incident {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
-	s.counter++
-	id := "INC-" + padInt(s.counter)
+	caseType := fallback(strings.ToLower(strings.TrimSpace(input.Type)), caseTypeSecurity)
+	var id string
+	switch {
+	case input.Tenant != "":
+		key := input.Tenant + "/" + caseType
+		if _, ok := s.tenantCounters[key]; !ok && caseType != caseTypeHR {
+			s.tenantCounters[key] = 1000
+		}
+		s.tenantCounters[key]++
+		id = tenantIncidentID(input.Tenant, idPrefix(caseType)+padInt(s.tenantCounters[key]))
+	case caseType == caseTypeHR:
+		s.hrCounter++
+		id = idPrefix(caseType) + padInt(s.hrCounter)
+	default:
+		s.counter++
+		id = idPrefix(caseType) + padInt(s.counter)
+	}
+	restricted := caseType == caseTypeHR
+	if input.Restricted != nil {
+		restricted = *input.Restricted
+	}
 	newIncident := &Incident{
-		ID:        id,
-		Title:     input.Title,
-		Severity:  fallback(input.Severity, "Medium"),
-		Status:    fallback(input.Status, "New"),
-		Owner:     fallback(input.Owner, "Unassigned"),
-		Tags:      sanitizeSlice(input.Tags),
-		IOCs:      sanitizeSlice(input.IOCs),
-		Notes:     []Note{},
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
+		ID:             id,
+		Tenant:         input.Tenant,
+		Type:           caseType,
+		Restricted:     restricted,
+		Title:          input.Title,
+		Severity:       fallback(input.Severity, currentTaxonomies().DefaultSeverity),
+		Status:         fallback(input.Status, currentTaxonomies().DefaultStatus),
+		Owner:          fallback(input.Owner, "Unassigned"),
+		KillChainPhase: input.KillChainPhase,
+		RuleID:         input.RuleID,
+		Template:       input.Template,
+		Source:         strings.TrimSpace(input.Source),
+		trace:          input.Trace,
+		Tags:           sanitizeSlice(input.Tags),
+		IOCs:           sanitizeSlice(input.IOCs),
+		Notes:          []Note{},
+		Tasks:          []Task{},
+		Enrichments:    []Enrichment{},
+		WatchlistHits:  []WatchlistHit{},
+		FeedHits:       []FeedHit{},
+		Alerts:         []IncidentAlert{},
+		CreatedAt:      time.Now().UTC(),
+		UpdatedAt:      time.Now().UTC(),
 	}
 
+	for _, task := range input.Tasks {
+		newIncident.Tasks = append(newIncident.Tasks, Task{
+			ID:        "TASK-" + padInt(len(newIncident.Tasks)+1),
+			Title:     strings.TrimSpace(task.Title),
+			Assignee:  strings.TrimSpace(task.Assignee),
+			CreatedAt: newIncident.CreatedAt,
+		})
+	}
+	for _, fn := range s.createHooks {
+		fn(newIncident)
+	}
+	recordChanges(newIncident, nil, newIncident.CreatedAt, input.Actor, input.ActorID)
+	s.runAnnotators(newIncident)
 	s.incidents[id] = newIncident
 	s.order = append([]string{id}, s.order...)
+	s.indexIOCs(id, newIncident.IOCs)
+	s.emit(eventIncidentCreated, *newIncident, nil)
 
 	return *newIncident
 }
 
 func (s *IncidentStore) update(id string, input IncidentUpdate) (Incident, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
 	incident, ok := s.incidents[id]
 	if !ok {
-		return Incident{}, errors.New("incident not found")
+		return Incident{}, errIncidentNotFound
+	}
+	if err := s.applyUpdate(incident, input, time.Now().UTC()); err != nil {
+		return Incident{}, err
+	}
+	return *incident, nil
+}
+
+// applyUpdate applies input to incident, enforcing closure requirements.
+// Callers must hold s.mu.
+func (s *IncidentStore) applyUpdate(incident *Incident, input IncidentUpdate, now time.Time) error {
+	previous := *incident
+
+	if input.Major != nil {
+		s.setMajor(incident, *input.Major, now)
+	}
+	if input.Status != "" && isClosedStatus(input.Status) && !isClosedStatus(incident.Status) {
+		problems := append(majorClosureProblems(incident, fallback(input.Owner, incident.Owner)), caseClosureProblems(incident)...)
+		if len(problems) > 0 {
+			*incident = previous
+			return errors.New(strings.Join(problems, "; "))
+		}
 	}
 
 	if input.Severity != "" {
@@ -215,31 +459,76 @@ func (s *IncidentStore) update(id string, input IncidentUpdate) (Incident, error
 	if input.Owner != "" {
 		incident.Owner = input.Owner
 	}
-	incident.UpdatedAt = time.Now().UTC()
-
-	return *incident, nil
+	if input.KillChainPhase != "" {
+		if phase, ok := normalizeKillChainPhase(input.KillChainPhase); ok {
+			incident.KillChainPhase = phase
+		}
+	}
+	if input.Restricted != nil {
+		incident.Restricted = *input.Restricted
+	}
+	if input.Disposition != "" {
+		if disposition, ok := normalizeDisposition(input.Disposition); ok {
+			incident.Disposition = disposition
+		}
+	}
+	incident.trace = input.Trace
+	recordChanges(incident, &previous, now, input.Actor, input.ActorID)
+	switch {
+	case isClosedStatus(incident.Status) && !isClosedStatus(previous.Status):
+		incident.ClosedStats = buildClosedStats(incident, now)
+	case !isClosedStatus(incident.Status) && isClosedStatus(previous.Status):
+		incident.ClosedStats = nil
+		incident.Disposition = ""
+	}
+	incident.UpdatedAt = now
+	s.runAnnotators(incident)
+	s.emit(eventIncidentUpdated, *incident, &previous)
+	return nil
 }
 
 func (s *IncidentStore) addNote(id string, input NoteInput) (Incident, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
 	incident, ok := s.incidents[id]
 	if !ok {
-		return Incident{}, errors.New("incident not found")
+		return Incident{}, errIncidentNotFound
 	}
 	if strings.TrimSpace(input.Body) == "" {
 		return Incident{}, errors.New("note body required")
 	}
+	if !validNoteKind(input.Kind) {
+		return Incident{}, errors.New("unknown note kind")
+	}
+	if input.ParentNoteID != "" {
+		parent, ok := findNote(incident.Notes, input.ParentNoteID)
+		if !ok {
+			return Incident{}, errors.New("parent note not found")
+		}
+		input.ParentNoteID = parent.ID
+	}
 
 	note := Note{
-		ID:        "NOTE-" + padInt(len(incident.Notes)+1),
-		Body:      input.Body,
-		Author:    fallback(input.Author, "Analyst"),
-		CreatedAt: time.Now().UTC(),
+		ID:         "NOTE-" + padInt(len(incident.Notes)+1),
+		Body:       input.Body,
+		Author:     fallback(input.Author, "Analyst"),
+		AuthorType: input.AuthorType,
+		AuthorID:   input.AuthorID,
+		AuthorIcon: input.AuthorIcon,
+		Kind:       input.Kind,
+		Mentions:   input.Mentions,
+		CreatedAt:  time.Now().UTC(),
 	}
+	note.ParentNoteID = input.ParentNoteID
 	incident.Notes = append([]Note{note}, incident.Notes...)
 	incident.UpdatedAt = time.Now().UTC()
+	if note.Kind == noteKindSitrep && incident.Major {
+		due := note.CreatedAt.Add(s.sitrepInterval)
+		incident.SitrepDueAt = &due
+	}
+	incident.trace = input.Trace
+	s.emit(eventNoteAdded, *incident, nil)
 
 	return *incident, nil
 }
@@ -261,6 +550,10 @@ func itoa(value int) string {
 	return strconv.Itoa(value)
 }
 
+func isClosedStatus(status string) bool {
+	return currentTaxonomies().statusClosed(status)
+}
+
 func fallback(value, def string) string {
 	if strings.TrimSpace(value) == "" {
 		return def
@@ -280,7 +573,16 @@ func sanitizeSlice(values []string) []string {
 	return clean
 }
 
+// writeJSON sends payload with status. Error bodies get the request's ID
+// added so what an analyst reports can be found in the logs.
 func writeJSON(w http.ResponseWriter, status int, payload any) {
+	if body, ok := payload.(map[string]string); ok && body["error"] != "" && body["requestId"] == "" {
+		if id := w.Header().Get(requestIDHeader); id != "" {
+			withID := maps.Clone(body)
+			withID["requestId"] = id
+			payload = withID
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(payload)
@@ -293,33 +595,199 @@ func readJSON(r *http.Request, dst any) error {
 }
 
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	os.Exit(runCommand(os.Args[1:]))
+}
+
+// runServer wires up the stores, integrations, and routes from the
+// settings and serves until a shutdown signal.
+func runServer() {
+	logger := newLogger()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// drainers are flushed in order at shutdown, so workers that others
+	// feed, such as span export, go last.
+	var drainers []drainer
+	exporter := newSpanExporter()
+	if exporter != nil {
+		spanExporter.Store(exporter)
+		exporter.start()
 	}
+	port := envString("PORT", "8080")
 
 	store := newIncidentStore()
+	watchlists := newWatchlistStore()
+	identities := newServiceIdentityStore()
+	apiKeys := newAPIKeyStore()
+	users := newUserStore()
+	userTeams := newTeamStore()
+	audit := newAuditLog()
+	audit.watch(store)
+	auditStore := newAuditStore(audit)
+	forwarder := newAuditForwarder()
+	if forwarder != nil {
+		forwarder.start(audit)
+	}
+	access := newAccessLog(audit)
+	evidence := newEvidenceStore()
+	attachments := newAttachmentStore()
+	attachments.watch(store)
+	purges := newPurgeStore()
+	undoWindow := envDuration("UNDO_WINDOW", 15*time.Minute)
+	rules := newRuleStore()
+	rules.watch(store)
+	alertMappings := newAlertMappingStore()
+	alerts := newAlertIngester(store, alertMappings)
+	templates := newTemplateStore()
+	campaigns := newCampaignStore()
+	cases := newCaseStore()
+	autoTags := newAutoTagStore()
+	store.onCreate(autoTags.tagIncident)
+	routing := newRoutingStore()
+	store.onCreate(routing.routeIncident)
+	store.annotate(watchlists.annotateIncident)
+	feeds := newFeedStore()
+	store.annotate(feeds.annotateIncident)
+	store.annotate(annotateSeverity)
+	store.annotate(annotateSLA)
+	iocMode := iocValidationMode()
+	ownerMode := ownerValidationMode()
+	if iocMode != iocValidationOff {
+		store.annotate(annotateIOCs)
+	}
+	store.reannotate()
+	startSLAMonitor(ctx, store, envDuration("SLA_CHECK_INTERVAL", time.Minute))
+	feedManager := newFeedManager(feeds, store)
+	feedManager.start(ctx)
+	warRooms := newWarRoomService()
+	summaries := newSummaryService()
+	translator := newQueryTranslationService()
+	enrichment := newEnrichmentService(store)
+	demoMode := envBool("DEMO_MODE", false)
+	if demoMode {
+		enrichment.enrichers = append(enrichment.enrichers, demoEnrichers()...)
+	}
+	enrichment.start()
+	newSyslogListener(alerts, alertMappings, enrichment).start()
+	notifier := newNotifier()
+	teams := newTeamsTarget()
+	webhooks := newWebhookStore()
+	webhooks.start(store)
+	notifier.add(teams, false)
+	notifier.start()
+	drainers = append(drainers, drainer{"webhook deliveries", webhooks.pending.drain}, drainer{"notifications", notifier.pending.drain})
+	store.subscribe(notifier.handleEvent)
+	searchSink := newSearchSink()
+	if searchSink != nil {
+		searchSink.start(store)
+	}
+	if pagerDuty := newPagerDuty(); pagerDuty != nil {
+		pagerDuty.start(store)
+		drainers = append(drainers, drainer{"PagerDuty events", pagerDuty.pending.drain})
+	}
+	startSitrepReminders(ctx, store, notifier, envDuration("MAJOR_SITREP_CHECK_INTERVAL", time.Minute))
+	startSitrepAutoPost(ctx, store, warRooms, envDuration("SITREP_AUTOPOST_INTERVAL", 0))
+	escalations := newEscalationStore()
+	startEscalations(ctx, escalations, store, notifier, envDuration("ESCALATION_CHECK_INTERVAL", time.Minute))
+	settings := newSettingsStore()
+	var demo *DemoGuide
+	if demoMode {
+		guide := seedDemo(demoDeps{store: store, alerts: alerts, mappings: alertMappings, watchlists: watchlists, autoTags: autoTags, routing: routing, evidence: evidence, enrichment: enrichment})
+		demo = &guide
+	}
+	reads := newReadSources(store)
+	metrics := newRouteMetrics()
+	metrics.trackSize("incidents", store.size)
+	metrics.trackSize("cases", cases.size)
+	metrics.trackSize("campaigns", campaigns.size)
+	metrics.trackSize("evidence", evidence.size)
+	metrics.trackSize("attachments", attachments.size)
+	metrics.trackSize("audit_records", auditStore.size)
+	metrics.collect(incidentMetrics(store), webhookMetrics(webhooks), enrichmentMetrics(enrichment))
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/api/incidents", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			severity := r.URL.Query().Get("severity")
-			status := r.URL.Query().Get("status")
-			query := r.URL.Query().Get("q")
-			items := filterIncidents(store.list(), severity, status, query)
-			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+			since, delta, ok := parseUpdatedSince(w, r)
+			if !ok {
+				return
+			}
+			_, span := startSpan(r.Context(), "IncidentStore.list", spanInternal)
+			items, ok := listIncidents(w, r, reads.List)
+			span.set("incident.count", len(items))
+			span.end()
+			if !ok {
+				return
+			}
+			if items, ok = filterByTeam(items, r.URL.Query().Get("team"), userTeams, users); !ok {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown team " + r.URL.Query().Get("team")})
+				return
+			}
+			if delta {
+				result, ok := incidentDelta(w, r, store, items, since, settings.get())
+				if !ok {
+					return
+				}
+				addAging(result.Items, visibleTo(r, reads.List.list()), time.Now().UTC())
+				writeJSON(w, http.StatusOK, result)
+				return
+			}
+			page, ok := applyListSettings(w, r, items, settings.get())
+			if !ok {
+				return
+			}
+			addAging(page.Items, visibleTo(r, reads.List.list()), time.Now().UTC())
+			writeJSON(w, http.StatusOK, page)
 		case http.MethodPost:
 			var input IncidentInput
 			if err := readJSON(r, &input); err != nil {
-				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid payload"})
+				writeBodyError(w, err)
 				return
 			}
+			if name := r.URL.Query().Get("template"); name != "" {
+				template, ok := templates.get(name)
+				if !ok {
+					writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown template " + name})
+					return
+				}
+				template.instantiate(&input, time.Now().UTC())
+			}
 			if strings.TrimSpace(input.Title) == "" {
 				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "title is required"})
 				return
 			}
+			if input.Type != "" && !validCaseType(strings.ToLower(input.Type)) {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "type must be security or hr"})
+				return
+			}
+			if !canonicalizeTaxonomy(w, &input.Severity, &input.Status) {
+				return
+			}
+			if !canonicalizeOwner(w, users, userTeams, ownerMode, &input.Owner) {
+				return
+			}
+			if input.KillChainPhase != "" {
+				phase, ok := normalizeKillChainPhase(input.KillChainPhase)
+				if !ok {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": killChainPhaseError()})
+					return
+				}
+				input.KillChainPhase = phase
+			}
+			if iocMode == iocValidationReject {
+				if problems := iocProblems(input.IOCs); len(problems) > 0 {
+					writeJSON(w, http.StatusBadRequest, map[string]any{"error": "malformed iocs", "iocs": problems})
+					return
+				}
+			}
+			input.Actor, input.ActorID = actor(r.Context())
+			input.Trace = traceFrom(r.Context())
+			input.Tenant = tenantFrom(r.Context())
+			_, span := startSpan(r.Context(), "IncidentStore.create", spanInternal)
 			incident := store.create(input)
+			span.set("incident.id", incident.ID)
+			span.end()
+			enrichment.enqueue(incident.ID)
 			writeJSON(w, http.StatusCreated, incident)
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -334,6 +802,10 @@ func main() {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
+		if incident, ok := store.get(id); ok && !canView(r, *incident) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 
 		if len(parts) == 1 {
 			switch r.Method {
@@ -343,18 +815,58 @@ func main() {
 					w.WriteHeader(http.StatusNotFound)
 					return
 				}
+				access.record(r, id, accessView)
+				if wantsRenderedNotes(r.URL.Query()) {
+					incident.Notes = renderNotes(incident.Notes)
+				}
+				incident.NoteThreads = threadNotes(incident.Notes)
+				incident.Links = resolveLinks(r, store, incident.Links)
 				writeJSON(w, http.StatusOK, incident)
 			case http.MethodPut:
 				var input IncidentUpdate
 				if err := readJSON(r, &input); err != nil {
-					writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid payload"})
+					writeBodyError(w, err)
+					return
+				}
+				if !canonicalizeTaxonomy(w, &input.Severity, &input.Status) {
 					return
 				}
+				if !canonicalizeOwner(w, users, userTeams, ownerMode, &input.Owner) {
+					return
+				}
+				if input.KillChainPhase != "" {
+					if _, ok := normalizeKillChainPhase(input.KillChainPhase); !ok {
+						writeJSON(w, http.StatusBadRequest, map[string]string{"error": killChainPhaseError()})
+						return
+					}
+				}
+				if input.Disposition != "" {
+					if _, ok := normalizeDisposition(input.Disposition); !ok {
+						writeJSON(w, http.StatusBadRequest, map[string]string{"error": dispositionError()})
+						return
+					}
+				}
+				if input.Restricted != nil && !callerCleared(r) {
+					writeJSON(w, http.StatusForbidden, map[string]string{"error": "only cleared roles can change restriction"})
+					return
+				}
+				input.Actor, input.ActorID = actor(r.Context())
+				input.Trace = traceFrom(r.Context())
+				_, span := startSpan(r.Context(), "IncidentStore.update", spanInternal)
+				span.set("incident.id", id)
 				incident, err := store.update(id, input)
 				if err != nil {
+					span.fail(err.Error())
+				}
+				span.end()
+				if errors.Is(err, errIncidentNotFound) {
 					w.WriteHeader(http.StatusNotFound)
 					return
 				}
+				if err != nil {
+					writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+					return
+				}
 				writeJSON(w, http.StatusOK, incident)
 			default:
 				w.WriteHeader(http.StatusMethodNotAllowed)
@@ -363,15 +875,36 @@ func main() {
 		}
 
 		if len(parts) == 2 && parts[1] == "notes" {
+			if r.Method == http.MethodGet {
+				incident, ok := store.get(id)
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				access.record(r, id, accessView)
+				query := r.URL.Query()
+				notes := filterNotes(incident.Notes, query.Get("authorType"), query.Get("authorId"))
+				if wantsRenderedNotes(query) {
+					notes = renderNotes(notes)
+				}
+				if query.Get("flat") == "false" {
+					writeJSON(w, http.StatusOK, map[string]any{"items": threadNotes(notes)})
+					return
+				}
+				writeJSON(w, http.StatusOK, map[string]any{"items": notes})
+				return
+			}
 			if r.Method != http.MethodPost {
 				w.WriteHeader(http.StatusMethodNotAllowed)
 				return
 			}
 			var input NoteInput
 			if err := readJSON(r, &input); err != nil {
-				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid payload"})
+				writeBodyError(w, err)
 				return
 			}
+			attributeNote(r.Context(), &input)
+			input.Mentions = users.mentioned(input.Body)
 			incident, err := store.addNote(id, input)
 			if err != nil {
 				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
@@ -381,18 +914,233 @@ func main() {
 			return
 		}
 
+		if len(parts) == 2 && parts[1] == "warroom" {
+			handleIncidentWarRoom(w, r, id, store, warRooms)
+			return
+		}
+
+		if len(parts) == 2 && parts[1] == "summary" {
+			handleIncidentSummary(w, r, id, store, summaries)
+			return
+		}
+
+		if len(parts) == 2 && parts[1] == "sitrep" {
+			handleIncidentSitrep(w, r, id, store, warRooms, access)
+			return
+		}
+
+		if (len(parts) == 2 || len(parts) == 3) && parts[1] == "tasks" {
+			handleIncidentTasks(w, r, id, parts, store)
+			return
+		}
+
+		if len(parts) == 2 && parts[1] == "executive-summary" {
+			handleExecutiveSummary(w, r, id, store, access)
+			return
+		}
+
+		if (len(parts) == 2 || len(parts) == 3) && parts[1] == "access-log" {
+			handleIncidentAccessLog(w, r, id, parts, store, access)
+			return
+		}
+
+		if (len(parts) == 2 || len(parts) == 3) && parts[1] == "attachments" {
+			handleIncidentAttachments(w, r, id, parts, store, attachments, access)
+			return
+		}
+
+		if len(parts) >= 2 && len(parts) <= 4 && parts[1] == "evidence" {
+			handleIncidentEvidence(w, r, id, parts, store, evidence)
+			return
+		}
+
+		if len(parts) == 2 && parts[1] == "claim" {
+			handleIncidentClaim(w, r, id, store)
+			return
+		}
+
+		if len(parts) == 2 && parts[1] == "undo" {
+			handleIncidentUndo(w, r, id, store, undoWindow)
+			return
+		}
+
+		if (len(parts) == 2 || len(parts) == 3) && parts[1] == "links" {
+			handleIncidentLinks(w, r, id, parts, store)
+			return
+		}
+
+		if len(parts) == 2 && parts[1] == "merge" {
+			handleIncidentMerge(w, r, id, store, audit)
+			return
+		}
+
+		if len(parts) == 2 && parts[1] == "timeline" {
+			handleIncidentTimeline(w, r, id, store, access)
+			return
+		}
+
+		if len(parts) == 4 && parts[1] == "fields" && parts[3] == "history" {
+			handleIncidentFieldHistory(w, r, id, parts[2], store, access)
+			return
+		}
+
+		if len(parts) == 2 && parts[1] == "enrichments" {
+			handleIncidentEnrichments(w, r, id, store, enrichment)
+			return
+		}
+
 		w.WriteHeader(http.StatusNotFound)
 	})
 
-	mux.Handle("/", http.FileServer(http.Dir("./static")))
+	mux.HandleFunc("/api/demo", demoHandler(demo))
+	mux.HandleFunc("/api/routing", routingHandler(routing))
+	mux.HandleFunc("/api/routing/preview", routingPreviewHandler(routing))
+	mux.HandleFunc("/api/campaigns", campaignsHandler(campaigns, store))
+	mux.HandleFunc("/api/campaigns/", campaignHandler(campaigns, store))
+	mux.HandleFunc("/api/cases", casesHandler(cases, store))
+	mux.HandleFunc("/api/cases/", caseHandler(cases, store, users, evidence))
+	mux.HandleFunc("/api/tags", tagsHandler(store))
+	mux.HandleFunc("/api/suggest", suggestHandler(newSuggestIndex(store)))
+	mux.HandleFunc("/api/tags/", tagHandler(store, audit))
+	mux.HandleFunc("/api/templates", templatesHandler(templates))
+	mux.HandleFunc("/api/templates/", templateHandler(templates))
+	mux.HandleFunc("/api/auto-tag-rules", autoTagRulesHandler(autoTags))
+	mux.HandleFunc("/api/auto-tag-rules/", autoTagRuleHandler(autoTags))
+	mux.HandleFunc("/api/watchlists", watchlistsHandler(watchlists, store))
+	mux.HandleFunc("/api/watchlists/", watchlistHandler(watchlists, store))
+	mux.HandleFunc("/api/alerts", alertsHandler(alerts, alertMappings, enrichment))
+	mux.HandleFunc("/api/alerts/elastic", elasticAlertsHandler(alerts, alertMappings, enrichment))
+	mux.HandleFunc("/api/alerts/mappings", alertMappingsHandler(alertMappings))
+	mux.HandleFunc("/api/alerts/mappings/", alertMappingHandler(alertMappings))
+	hec := hecHandler(newHECAuthenticator(identities), alerts, alertMappings, enrichment)
+	mux.HandleFunc("/services/collector", hec)
+	mux.HandleFunc("/services/collector/", hec)
+	mux.HandleFunc("/api/rules", rulesHandler(rules))
+	mux.HandleFunc("/api/rules/", ruleHandler(rules))
+	mux.HandleFunc("/api/rules/evaluate", ruleEvaluateHandler(rules, store, enrichment))
+	mux.HandleFunc("/api/rules/noisiest", ruleNoisiestHandler(rules))
+	mux.HandleFunc("/api/feeds", feedsHandler(feeds, feedManager))
+	mux.HandleFunc("/api/feeds/", feedHandler(feeds, feedManager, store))
+	mux.HandleFunc("/api/admin/apikeys", apiKeysHandler(apiKeys, users))
+	mux.HandleFunc("/api/admin/apikeys/", apiKeyHandler(apiKeys))
+	mux.HandleFunc("/api/service-identities", serviceIdentitiesHandler(identities))
+	mux.HandleFunc("/api/service-identities/", serviceIdentityHandler(identities))
+	exportPresets := newExportPresetStore()
+	mux.HandleFunc("/api/incidents/export", incidentExportHandler(reads.Export, access, settings))
+	changes := newChangeFeed(store)
+	mux.HandleFunc("/api/incidents/changes", changesHandler(changes))
+	mux.HandleFunc("/api/ws", wsHandler(changes))
+	mux.HandleFunc("/api/events/stream", eventStreamHandler(changes))
+	mux.HandleFunc("/api/export-presets", exportPresetsHandler(exportPresets))
+	mux.HandleFunc("/api/export-presets/", exportPresetHandler(exportPresets, reads.Export, access, settings))
+	mux.HandleFunc("/api/queue", queueHandler(store))
+	mux.HandleFunc("/api/stats", statsHandler(reads.Stats))
+	mux.HandleFunc("/api/sla-policies", slaPoliciesHandler())
+	mux.HandleFunc("/api/settings", settingsHandler(settings))
+	mux.HandleFunc("/api/config/taxonomies", taxonomiesHandler())
+	mux.HandleFunc("/api/users", usersHandler(users, store))
+	mux.HandleFunc("/api/users/", userHandler(users, store, notifier))
+	mux.HandleFunc("/api/teams", teamsHandler(userTeams, users, store))
+	mux.HandleFunc("/api/teams/", teamHandler(userTeams, users, store))
+	mux.HandleFunc("/api/escalations", escalationsHandler(escalations))
+	mux.HandleFunc("/api/escalations/", escalationHandler(escalations))
+	mux.HandleFunc("/api/admin/hygiene", hygieneHandler(store))
+	mux.HandleFunc("/api/admin/search-sink", searchSinkHandler(searchSink, store))
+	mux.HandleFunc("/api/audit", auditHandler(auditStore))
+	mux.HandleFunc("/api/audit/verify", auditVerifyHandler(auditStore))
+	mux.HandleFunc("/api/admin/purges", purgesHandler(purges, store, audit))
+	mux.HandleFunc("/api/admin/purges/", purgeHandler(purges, store, access, audit))
+	mux.HandleFunc("/api/webhooks", webhooksHandler(webhooks))
+	mux.HandleFunc("/api/webhooks/", webhookHandler(webhooks))
+	mux.HandleFunc("/api/webhooks/schemas", webhookSchemasHandler())
+	mux.HandleFunc("/api/webhooks/schemas/", webhookSchemasHandler())
+	mux.HandleFunc("/api/integrations/slack/actions", slackActionsHandler(store))
+	mux.HandleFunc("/api/integrations/teams", teamsIntegrationHandler(teams))
+	mux.HandleFunc("/api/notes/bulk", bulkNoteHandler(store))
+	mux.HandleFunc("/api/query/translate", queryTranslateHandler(store, translator))
+	mux.HandleFunc("/api/iocs/", iocPivotHandler(store))
+	mux.HandleFunc("/api/iocs/geo", geoAggregateHandler(store, enrichment.geo))
+	graphQL := newGraphQLAPI(store, reads, access, settings, userTeams, users)
+	mux.HandleFunc(graphQLPath, graphQLHandler(graphQL))
+	mux.HandleFunc(graphQLPath+"/schema", graphQLSchemaHandler(graphQL))
+
+	assets := newStaticAssets("./static")
+	mux.HandleFunc("/api/version", versionHandler(assets))
+	mux.HandleFunc("/api/openapi.json", openAPIHandler())
+	mux.HandleFunc("/api/docs", apiDocsHandler())
+	mux.HandleFunc("/metrics", metricsHandler(metrics))
+	if envBool("PPROF_ENABLED", false) {
+		mux.HandleFunc("/debug/pprof/", pprofHandler())
+	}
+	if addr := envString("PPROF_ADDR", ""); addr != "" {
+		startPprofServer(addr)
+	}
+	mux.Handle("/", assets)
+
+	sessions := newSessionStore()
+	metrics.trackSize("sessions", sessions.size)
+	oidc := newOIDCProvider(sessions, audit)
+	if oidc != nil {
+		mux.HandleFunc("/auth/login", oidc.loginHandler())
+		mux.HandleFunc("/auth/callback", oidc.callbackHandler(users))
+	}
+	proxies := trustedProxies()
+	limiter := newRateLimiter(proxies)
+	ldap := newLDAPAuthenticator()
+	if ldap != nil {
+		mux.HandleFunc("/auth/ldap", ldapLoginHandler(ldap, sessions, users, audit, limiter))
+	}
+	mux.HandleFunc("/auth/logout", logoutHandler(sessions, oidc, audit))
+	mux.HandleFunc("/api/session", sessionHandler(sessions, audit))
 
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+	jwts := newJWTVerifier()
+	proxy := newProxyAuth(proxies, jwts != nil || oidc != nil || ldap != nil || !apiKeys.empty())
+	idempotency := newIdempotencyCache()
+	if idempotency != nil {
+		metrics.trackSize("idempotency_keys", idempotency.size)
 	}
+	bodyLimit := int64(envInt("BODY_MAX_BYTES", defaultBodyMaxBytes))
+	ingestBodyLimit := int64(envInt("INGEST_BODY_MAX_BYTES", defaultIngestBodyMaxBytes))
+	api := withTracing(withRequestLog(withCORS(withBodyLimit(withIdentity(withTenant(withLogin(withRateLimit(withAuthRequired(withIdempotency(withAudit(withReadOnly(withMetrics(mux, metrics), envBool("READ_ONLY", false)), audit), idempotency), envBool("AUTH_REQUIRED", false)), limiter), oidc), envBool("MULTI_TENANT", false)), identities, apiKeys, jwts, sessions, users, proxy), bodyLimit, ingestBodyLimit, attachments.uploadLimit()), newCORSPolicy()), logger, envBool("REQUEST_LOG", true)))
+	server := newHTTPServer(":"+port, api)
 
-	log.Printf("listening on http://localhost:%s", port)
-	if err := server.ListenAndServe(); err != nil {
+	// The audit forwarder drains after everything else so it gets the
+	// events recorded along the way.
+	if forwarder != nil {
+		drainers = append(drainers, drainer{"audit events", forwarder.pending.drain})
+	}
+	if exporter != nil {
+		drainers = append(drainers, drainer{"spans", exporter.drain})
+	}
+
+	redirectAddr := envString("TLS_REDIRECT_ADDR", "")
+	acme := newACMEManager(redirectAddr != "")
+	tlsConfig, err := newTLSConfig(acme)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		server.TLSConfig, scheme = tlsConfig, "https"
+		var redirect http.Handler = httpsRedirect(port)
+		if acme != nil {
+			acme.start(ctx)
+			redirect = acme.httpHandler(redirect)
+		}
+		if redirectAddr != "" {
+			startRedirectServer(ctx, redirectAddr, redirect)
+		}
+	}
+
+	logger.Info("listening", "addr", server.Addr, "url", scheme+"://localhost:"+port)
+	grace := envDuration("SHUTDOWN_GRACE_PERIOD", 30*time.Second)
+	if addr := envString("GRPC_ADDR", ""); addr != "" {
+		startGRPCServer(ctx, addr, newGRPCServer(api, changes), tlsConfig, grace)
+	}
+	// Everything read at startup has been read by now.
+	fileConfig().warnUnused()
+	if err := serve(ctx, server, changes, grace, drainers); err != nil {
 		log.Fatal(err)
 	}
+	logger.Info("stopped")
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	noteKindSitrep     = "sitrep"
+	noteKindResolution = "resolution"
+)
+
+type ExecutiveSummary struct {
+	ID            string     `json:"id"`
+	Title         string     `json:"title"`
+	Severity      string     `json:"severity"`
+	Status        string     `json:"status"`
+	Owner         string     `json:"owner"`
+	Major         bool       `json:"major"`
+	MajorSince    *time.Time `json:"majorSince,omitempty"`
+	Duration      string     `json:"duration"`
+	IOCCount      int        `json:"iocCount"`
+	NoteCount     int        `json:"noteCount"`
+	LatestSitrep  *Note      `json:"latestSitrep,omitempty"`
+	SitrepDueAt   *time.Time `json:"sitrepDueAt,omitempty"`
+	SitrepOverdue bool       `json:"sitrepOverdue"`
+	WarRoomURL    string     `json:"warRoomUrl,omitempty"`
+	Summary       string     `json:"summary"`
+}
+
+func validNoteKind(kind string) bool {
+	switch kind {
+	case "", noteKindSitrep, noteKindResolution:
+		return true
+	}
+	return false
+}
+
+// setMajor toggles major incident mode. Declaring starts the sitrep clock;
+// standing down clears it. Callers must hold s.mu.
+func (s *IncidentStore) setMajor(incident *Incident, major bool, now time.Time) {
+	if incident.Major == major {
+		return
+	}
+	incident.Major = major
+	if !major {
+		incident.MajorSince = nil
+		incident.SitrepDueAt = nil
+		return
+	}
+	since := now
+	due := now.Add(s.sitrepInterval)
+	incident.MajorSince = &since
+	incident.SitrepDueAt = &due
+}
+
+// majorClosureProblems lists what still blocks closing a major incident.
+// Regular incidents can be closed at any time.
+func majorClosureProblems(incident *Incident, owner string) []string {
+	if !incident.Major {
+		return nil
+	}
+	problems := []string{}
+	if strings.TrimSpace(owner) == "" || strings.EqualFold(owner, "Unassigned") {
+		problems = append(problems, "major incidents need an owner before closing")
+	}
+	if latestNoteOfKind(incident.Notes, noteKindResolution) == nil {
+		problems = append(problems, "major incidents need a resolution note before closing")
+	}
+	return problems
+}
+
+func latestNoteOfKind(notes []Note, kind string) *Note {
+	for i := range notes {
+		if notes[i].Kind == kind {
+			note := notes[i]
+			return &note
+		}
+	}
+	return nil
+}
+
+func buildExecutiveSummary(incident Incident, now time.Time) ExecutiveSummary {
+	summary := ExecutiveSummary{
+		ID:           incident.ID,
+		Title:        incident.Title,
+		Severity:     incident.Severity,
+		Status:       incident.Status,
+		Owner:        incident.Owner,
+		Major:        incident.Major,
+		MajorSince:   incident.MajorSince,
+		Duration:     now.Sub(incident.CreatedAt).Round(time.Minute).String(),
+		IOCCount:     len(incident.IOCs),
+		NoteCount:    len(incident.Notes),
+		LatestSitrep: latestNoteOfKind(incident.Notes, noteKindSitrep),
+		SitrepDueAt:  incident.SitrepDueAt,
+	}
+	if incident.SitrepDueAt != nil && now.After(*incident.SitrepDueAt) && !isClosedStatus(incident.Status) {
+		summary.SitrepOverdue = true
+	}
+	if incident.WarRoom != nil {
+		summary.WarRoomURL = incident.WarRoom.URL
+	}
+
+	var b strings.Builder
+	b.WriteString(incident.Severity + " incident " + incident.ID + " (" + incident.Title + ") is " + strings.ToLower(incident.Status))
+	b.WriteString(", owned by " + incident.Owner + ", open for " + summary.Duration + ".")
+	if summary.LatestSitrep != nil {
+		b.WriteString(" Latest sitrep: " + summary.LatestSitrep.Body)
+	} else if incident.Major {
+		b.WriteString(" No sitrep has been posted yet.")
+	}
+	summary.Summary = b.String()
+	return summary
+}
+
+func handleExecutiveSummary(w http.ResponseWriter, r *http.Request, id string, store *IncidentStore, access *AccessLog) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	incident, ok := store.get(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	access.record(r, id, accessExport)
+	writeJSON(w, http.StatusOK, buildExecutiveSummary(*incident, time.Now().UTC()))
+}
+
+// startSitrepReminders nags the broad audience whenever an open major
+// incident misses its sitrep deadline, once per missed deadline.
+func startSitrepReminders(ctx context.Context, store *IncidentStore, notifier *Notifier, every time.Duration) {
+	reminded := make(map[string]time.Time)
+
+	runEvery(ctx, every, func(now time.Time) {
+		for _, incident := range store.list() {
+			if !incident.Major || incident.SitrepDueAt == nil || isClosedStatus(incident.Status) {
+				delete(reminded, incident.ID)
+				continue
+			}
+			due := *incident.SitrepDueAt
+			if now.Before(due) || reminded[incident.ID].Equal(due) {
+				continue
+			}
+			reminded[incident.ID] = due
+			notifier.notify(Notification{
+				Event:    "sitrep.overdue",
+				Message:  "Sitrep overdue for major incident " + incident.ID + " (due " + due.Format(time.RFC3339) + ")",
+				Incident: incident,
+			})
+		}
+	})
+}
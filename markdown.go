@@ -0,0 +1,178 @@
+package main
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The markdown renderer covers what analysts write in notes: headings,
+// paragraphs, emphasis, inline and fenced code, lists, block quotes, rules,
+// and links. It is safe by construction rather than by sanitizing output:
+// every piece of text is escaped before any markup is added, raw HTML in
+// the source is shown as text, and links are only made for http, https, and
+// mailto URLs.
+
+var (
+	mdHeading     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdRule        = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	mdBullet      = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	mdOrdered     = regexp.MustCompile(`^\s*(\d{1,9})[.)]\s+(.*)$`)
+	mdQuote       = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	mdFence       = regexp.MustCompile("^\\s*(```|~~~)")
+	mdInlineCode  = regexp.MustCompile("`([^`]+)`")
+	mdLink        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBold        = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdItalic      = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_\s][^_]*)_\b`)
+	mdPlaceholder = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// renderMarkdown turns a note body into HTML that is safe to insert into a
+// page as is.
+func renderMarkdown(source string) string {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	var out strings.Builder
+	paragraph := []string{}
+	flush := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + renderInline(strings.Join(paragraph, "\n")) + "</p>\n")
+			paragraph = paragraph[:0]
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case mdFence.MatchString(line):
+			flush()
+			fence := mdFence.FindStringSubmatch(line)[1]
+			code := []string{}
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case mdHeading.MatchString(line):
+			flush()
+			match := mdHeading.FindStringSubmatch(line)
+			level := strconv.Itoa(len(match[1]))
+			out.WriteString("<h" + level + ">" + renderInline(match[2]) + "</h" + level + ">\n")
+		case mdRule.MatchString(line):
+			flush()
+			out.WriteString("<hr>\n")
+		case mdQuote.MatchString(line):
+			flush()
+			quoted := []string{}
+			for ; i < len(lines) && mdQuote.MatchString(lines[i]); i++ {
+				quoted = append(quoted, mdQuote.FindStringSubmatch(lines[i])[1])
+			}
+			i--
+			out.WriteString("<blockquote>\n" + renderMarkdown(strings.Join(quoted, "\n")) + "</blockquote>\n")
+		case mdBullet.MatchString(line), mdOrdered.MatchString(line):
+			flush()
+			ordered := !mdBullet.MatchString(line)
+			pattern, tag := mdBullet, "ul"
+			if ordered {
+				pattern, tag = mdOrdered, "ol"
+			}
+			open := "<" + tag + ">"
+			if ordered {
+				if start := mdOrdered.FindStringSubmatch(line)[1]; start != "1" {
+					open = `<ol start="` + strings.TrimLeft(start, "0") + `">`
+				}
+			}
+			out.WriteString(open + "\n")
+			for ; i < len(lines) && pattern.MatchString(lines[i]); i++ {
+				match := pattern.FindStringSubmatch(lines[i])
+				out.WriteString("<li>" + renderInline(match[len(match)-1]) + "</li>\n")
+			}
+			i--
+			out.WriteString("</" + tag + ">\n")
+		default:
+			paragraph = append(paragraph, strings.TrimSpace(line))
+		}
+	}
+	flush()
+	return out.String()
+}
+
+// renderInline escapes text and applies inline markup. Code spans and links
+// are swapped for placeholders first so emphasis never reaches inside them;
+// a link's text may hold code spans, which are restored inside the link.
+func renderInline(text string) string {
+	held := []string{}
+	hold := func(fragment string) string {
+		held = append(held, fragment)
+		return "\x00" + strconv.Itoa(len(held)-1) + "\x00"
+	}
+	restore := func(text string) string {
+		return mdPlaceholder.ReplaceAllStringFunc(text, func(match string) string {
+			index, _ := strconv.Atoi(mdPlaceholder.FindStringSubmatch(match)[1])
+			return held[index]
+		})
+	}
+	text = strings.ReplaceAll(text, "\x00", "")
+	text = mdInlineCode.ReplaceAllStringFunc(text, func(match string) string {
+		return hold("<code>" + html.EscapeString(mdInlineCode.FindStringSubmatch(match)[1]) + "</code>")
+	})
+	text = mdLink.ReplaceAllStringFunc(text, func(match string) string {
+		parts := mdLink.FindStringSubmatch(match)
+		href, ok := safeLinkURL(parts[2])
+		if !ok {
+			return hold(restore(html.EscapeString(match)))
+		}
+		return hold(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer">` + restore(renderEmphasis(html.EscapeString(parts[1]))) + "</a>")
+	})
+	text = renderEmphasis(html.EscapeString(text))
+	text = strings.ReplaceAll(text, "\n", "<br>\n")
+	return restore(text)
+}
+
+// renderEmphasis applies bold and italics to already escaped text.
+func renderEmphasis(escaped string) string {
+	escaped = mdBold.ReplaceAllStringFunc(escaped, func(match string) string {
+		parts := mdBold.FindStringSubmatch(match)
+		return "<strong>" + parts[1] + parts[2] + "</strong>"
+	})
+	return mdItalic.ReplaceAllStringFunc(escaped, func(match string) string {
+		parts := mdItalic.FindStringSubmatch(match)
+		return "<em>" + parts[1] + parts[2] + "</em>"
+	})
+}
+
+// safeLinkURL allows absolute http, https, and mailto links only, so no
+// javascript: or data: URL can end up in an href.
+func safeLinkURL(raw string) (string, bool) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		if parsed.Host == "" {
+			return "", false
+		}
+	case "mailto":
+	default:
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// renderNotes fills in BodyHTML for a response.
+func renderNotes(notes []Note) []Note {
+	rendered := make([]Note, len(notes))
+	for i, note := range notes {
+		note.BodyHTML = renderMarkdown(note.Body)
+		rendered[i] = note
+	}
+	return rendered
+}
+
+// wantsRenderedNotes reports whether the request asked for ?render=html.
+func wantsRenderedNotes(query url.Values) bool {
+	return strings.EqualFold(query.Get("render"), "html")
+}
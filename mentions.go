@@ -0,0 +1,42 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mentionPattern finds @username where the @ starts a word, so email
+// addresses in a note aren't taken for mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@(\w[\w.-]*)`)
+
+// mentioned returns the active users a note body mentions, by user ID, in
+// the order they first appear. Names that aren't in the directory are left
+// as plain text.
+func (u *UserStore) mentioned(body string) []string {
+	mentions := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		name := strings.TrimRight(match[1], ".-")
+		if seen[userKey(name)] {
+			continue
+		}
+		seen[userKey(name)] = true
+		if user, ok := u.get(name); ok && user.Active {
+			mentions = append(mentions, user.ID)
+		}
+	}
+	return mentions
+}
+
+// notifyMentions pings the users a new note mentions.
+func (n *Notifier) notifyMentions(incident Incident, note Note) {
+	if len(note.Mentions) == 0 {
+		return
+	}
+	n.notify(Notification{
+		Event:      "note.mention",
+		Message:    note.Author + " mentioned @" + strings.Join(note.Mentions, ", @") + " on " + incident.ID + " (" + incident.Title + "): " + note.Body,
+		Incident:   incident,
+		Recipients: note.Mentions,
+	})
+}
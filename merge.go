@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type MergeInput struct {
+	Sources []string `json:"sources"`
+}
+
+// MergeResult is the target after a merge and the sources closed into it.
+type MergeResult struct {
+	Incident Incident   `json:"incident"`
+	Merged   []Incident `json:"merged"`
+}
+
+// merge folds the sources' notes, IOCs, tags, and alerts into the target
+// and closes each source with MergedInto pointing at it. Either every
+// source is merged or none is. Restricted cases only merge into restricted
+// ones, so their notes never become visible to more people.
+func (s *IncidentStore) merge(targetID string, sourceIDs []string, by, byID string, trace traceContext) (MergeResult, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	target, ok := s.incidents[targetID]
+	if !ok {
+		return MergeResult{}, errIncidentNotFound
+	}
+	switch {
+	case target.MergedInto != "":
+		return MergeResult{}, errors.New(targetID + " was itself merged into " + target.MergedInto)
+	case isClosedStatus(target.Status):
+		return MergeResult{}, errors.New("reopen " + targetID + " before merging into it")
+	}
+
+	now := time.Now().UTC()
+	sources := []*Incident{}
+	seen := map[string]bool{}
+	for _, id := range sanitizeSlice(sourceIDs) {
+		source, ok := s.incidents[id]
+		switch {
+		case !ok:
+			return MergeResult{}, errors.New(id + ": " + errIncidentNotFound.Error())
+		case id == targetID:
+			return MergeResult{}, errors.New("can't merge " + id + " into itself")
+		case seen[id]:
+			continue
+		case source.MergedInto != "":
+			return MergeResult{}, errors.New(id + " was already merged into " + source.MergedInto)
+		case source.Type != target.Type:
+			return MergeResult{}, errors.New(id + " is a " + source.Type + " case and " + targetID + " is " + target.Type)
+		case source.Restricted && !target.Restricted:
+			return MergeResult{}, errors.New(id + " is restricted and " + targetID + " isn't")
+		}
+		if !isClosedStatus(source.Status) {
+			preview := *source
+			preview.Notes = append([]Note{mergeNote(&preview, targetID, by, byID, now)}, source.Notes...)
+			if problems := append(majorClosureProblems(&preview, preview.Owner), caseClosureProblems(&preview)...); len(problems) > 0 {
+				return MergeResult{}, errors.New(id + ": " + strings.Join(problems, "; "))
+			}
+		}
+		seen[id] = true
+		sources = append(sources, source)
+	}
+	if len(sources) == 0 {
+		return MergeResult{}, errors.New("sources must name at least one other incident")
+	}
+
+	previousTarget := *target
+	notes := append([]Note{}, target.Notes...)
+	merged := []string{}
+	for _, source := range sources {
+		renumbered := map[string]string{}
+		for i := len(source.Notes) - 1; i >= 0; i-- {
+			note := source.Notes[i]
+			renumbered[note.ID] = "NOTE-" + padInt(len(notes)+1)
+			note.ID = renumbered[note.ID]
+			note.ParentNoteID = renumbered[note.ParentNoteID]
+			note.MergedFrom = source.ID
+			notes = append(notes, note)
+		}
+		target.IOCs = dedupeStrings(append(append([]string{}, target.IOCs...), source.IOCs...))
+		target.Tags = dedupeStrings(append(append([]string{}, target.Tags...), source.Tags...))
+		target.Alerts = append(append([]IncidentAlert{}, target.Alerts...), source.Alerts...)
+		target.AlertCount += source.AlertCount
+		if source.LastAlertAt != nil && (target.LastAlertAt == nil || source.LastAlertAt.After(*target.LastAlertAt)) {
+			target.LastAlertAt = source.LastAlertAt
+		}
+		merged = append(merged, source.ID)
+	}
+	notes = append(notes, Note{
+		ID:         "NOTE-" + padInt(len(notes)+1),
+		Body:       "Merged " + strings.Join(merged, ", ") + " into this incident.",
+		Author:     fallback(by, "System"),
+		AuthorType: authorTypeAutomation,
+		AuthorID:   byID,
+		CreatedAt:  now,
+	})
+	sort.SliceStable(notes, func(i, j int) bool { return notes[i].CreatedAt.After(notes[j].CreatedAt) })
+	target.Notes = notes
+	target.MergedFrom = append(append([]string{}, target.MergedFrom...), merged...)
+	target.UpdatedAt = now
+	target.trace = trace
+	s.indexIOCs(target.ID, target.IOCs)
+	s.runAnnotators(target)
+	s.emit(eventIncidentUpdated, *target, &previousTarget)
+
+	result := MergeResult{Incident: *target, Merged: []Incident{}}
+	for _, source := range sources {
+		previous := *source
+		source.Notes = append([]Note{mergeNote(source, targetID, by, byID, now)}, source.Notes...)
+		source.MergedInto = targetID
+		if isClosedStatus(source.Status) {
+			source.UpdatedAt = now
+			s.emit(eventIncidentUpdated, *source, &previous)
+		} else if err := s.applyUpdate(source, IncidentUpdate{Status: currentTaxonomies().closedStatus(), Actor: by, ActorID: byID, Trace: trace}, now); err != nil {
+			// The checks above already passed on the same state.
+			return MergeResult{}, err
+		}
+		result.Merged = append(result.Merged, *source)
+	}
+	return result, nil
+}
+
+// mergeNote is the resolution note a merged source is closed with.
+func mergeNote(source *Incident, targetID, by, byID string, now time.Time) Note {
+	return Note{
+		ID:         "NOTE-" + padInt(len(source.Notes)+1),
+		Body:       "Merged into " + targetID + ".",
+		Author:     fallback(by, "System"),
+		AuthorType: authorTypeAutomation,
+		AuthorID:   byID,
+		Kind:       noteKindResolution,
+		CreatedAt:  now,
+	}
+}
+
+// handleIncidentMerge serves POST /api/incidents/{id}/merge with
+// {"sources": [...]}. The caller must be able to view every source.
+func handleIncidentMerge(w http.ResponseWriter, r *http.Request, id string, store *IncidentStore, audit *AuditLog) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var input MergeInput
+	if err := readJSON(r, &input); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	for _, sourceID := range input.Sources {
+		if source, ok := store.get(strings.TrimSpace(sourceID)); ok && !canView(r, *source) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": sourceID + ": " + errIncidentNotFound.Error()})
+			return
+		}
+	}
+
+	name, actorID := actor(r.Context())
+	result, err := store.merge(id, input.Sources, name, actorID, traceFrom(r.Context()))
+	if errors.Is(err, errIncidentNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+
+	event := AuditEvent{
+		Actor:      fallback(actorID, name),
+		Action:     "incident.merged",
+		Tenant:     tenantFrom(r.Context()),
+		IncidentID: id,
+		Resource:   r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}
+	ids := []string{}
+	for _, source := range result.Merged {
+		ids = append(ids, source.ID)
+	}
+	event.Detail = "merged " + strings.Join(ids, ", ") + " into " + id
+	if principal, ok := principalFrom(r.Context()); ok {
+		event.ActorType = principal.Kind
+	}
+	audit.record(event)
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLatencyBuckets are histogram upper bounds in seconds, fine-grained
+// at the low end where list and get requests should sit.
+var defaultLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// RouteMetrics tracks request counts, latency histograms, and in-flight
+// requests per mux pattern, served in the Prometheus text format. Routes are
+// labelled by pattern rather than path so incident IDs don't blow up the
+// label count.
+type RouteMetrics struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	latency  map[routeKey]*latencyHistogram
+	codes    map[routeCodeKey]uint64
+	inFlight map[string]int64
+
+	// sizes and collectors are read on each scrape, for metrics that
+	// describe the service's state rather than its requests.
+	sizes      []storeSize
+	collectors []func(w *strings.Builder)
+}
+
+type storeSize struct {
+	store string
+	size  func() int
+}
+
+type routeKey struct {
+	route  string
+	method string
+}
+
+type routeCodeKey struct {
+	routeKey
+	code int
+}
+
+type latencyHistogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newRouteMetrics() *RouteMetrics {
+	return &RouteMetrics{
+		buckets:  parseLatencyBuckets(envString("METRICS_LATENCY_BUCKETS", "")),
+		latency:  make(map[routeKey]*latencyHistogram),
+		codes:    make(map[routeCodeKey]uint64),
+		inFlight: make(map[string]int64),
+	}
+}
+
+// parseLatencyBuckets reads comma-separated bucket bounds in seconds, falling
+// back to the defaults when value is empty or invalid.
+func parseLatencyBuckets(value string) []float64 {
+	if strings.TrimSpace(value) == "" {
+		return defaultLatencyBuckets
+	}
+	buckets := []float64{}
+	for _, entry := range sanitizeSlice(strings.Split(value, ",")) {
+		bound, err := strconv.ParseFloat(entry, 64)
+		if err != nil || bound <= 0 || (len(buckets) > 0 && bound <= buckets[len(buckets)-1]) {
+			return defaultLatencyBuckets
+		}
+		buckets = append(buckets, bound)
+	}
+	return buckets
+}
+
+// statusRecorder captures the response status for metrics.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(body []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(body)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for
+// flushing and hijacking.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// withMetrics records every request against the mux pattern that serves it,
+// and names the request's span after the pattern too.
+func withMetrics(mux *http.ServeMux, metrics *RouteMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		if span := spanFrom(r.Context()); span != nil {
+			span.setName(r.Method + " " + route)
+			span.set("http.route", route)
+		}
+		metrics.begin(route)
+		recorder := &statusRecorder{ResponseWriter: w}
+		started := time.Now()
+		defer func() {
+			metrics.end(route, r.Method, recorder.status, time.Since(started))
+		}()
+		mux.ServeHTTP(recorder, r)
+	})
+}
+
+// trackSize reports the number of items held by store as soc_store_items.
+// Registration happens at startup, before the server takes requests.
+func (m *RouteMetrics) trackSize(store string, size func() int) {
+	m.sizes = append(m.sizes, storeSize{store: store, size: size})
+}
+
+// collect adds writers of further metrics, each called on every scrape.
+func (m *RouteMetrics) collect(collectors ...func(w *strings.Builder)) {
+	m.collectors = append(m.collectors, collectors...)
+}
+
+func (m *RouteMetrics) begin(route string) {
+	m.mu.Lock()
+	m.inFlight[route]++
+	m.mu.Unlock()
+}
+
+func (m *RouteMetrics) end(route, method string, status int, elapsed time.Duration) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		// Arbitrary methods would otherwise each get their own series.
+		method = "OTHER"
+	}
+	key := routeKey{route: route, method: method}
+	seconds := elapsed.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[route]--
+	m.codes[routeCodeKey{routeKey: key, code: status}]++
+	histogram, ok := m.latency[key]
+	if !ok {
+		histogram = &latencyHistogram{counts: make([]uint64, len(m.buckets))}
+		m.latency[key] = histogram
+	}
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			histogram.counts[i]++
+		}
+	}
+	histogram.count++
+	histogram.sum += seconds
+}
+
+func sortedKeys[K comparable, V any](items map[K]V, less func(a, b K) bool) []K {
+	keys := make([]K, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys
+}
+
+func (k routeKey) less(other routeKey) bool {
+	if k.route != other.route {
+		return k.route < other.route
+	}
+	return k.method < other.method
+}
+
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'g', -1, 64)
+}
+
+// write renders the metrics in the Prometheus text exposition format.
+func (m *RouteMetrics) write(w *strings.Builder) {
+	m.writeRoutes(w)
+	w.WriteString("# HELP soc_store_items Items held in memory, by store.\n")
+	w.WriteString("# TYPE soc_store_items gauge\n")
+	for _, size := range m.sizes {
+		fmt.Fprintf(w, "soc_store_items{store=%q} %d\n", size.store, size.size())
+	}
+	for _, collector := range m.collectors {
+		collector(w)
+	}
+}
+
+func (m *RouteMetrics) writeRoutes(w *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.WriteString("# HELP http_requests_total Requests served, by route, method, and status code.\n")
+	w.WriteString("# TYPE http_requests_total counter\n")
+	for _, key := range sortedKeys(m.codes, func(a, b routeCodeKey) bool {
+		if a.routeKey != b.routeKey {
+			return a.routeKey.less(b.routeKey)
+		}
+		return a.code < b.code
+	}) {
+		fmt.Fprintf(w, "http_requests_total{route=%q,method=%q,code=\"%d\"} %d\n", key.route, key.method, key.code, m.codes[key])
+	}
+
+	w.WriteString("# HELP http_request_duration_seconds Request latency, by route and method.\n")
+	w.WriteString("# TYPE http_request_duration_seconds histogram\n")
+	for _, key := range sortedKeys(m.latency, routeKey.less) {
+		histogram := m.latency[key]
+		labels := fmt.Sprintf("route=%q,method=%q", key.route, key.method)
+		for i, bound := range m.buckets {
+			fmt.Fprintf(w, "http_request_duration_seconds_bucket{%s,le=%q} %d\n", labels, formatBound(bound), histogram.counts[i])
+		}
+		fmt.Fprintf(w, "http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, histogram.count)
+		fmt.Fprintf(w, "http_request_duration_seconds_sum{%s} %s\n", labels, formatBound(histogram.sum))
+		fmt.Fprintf(w, "http_request_duration_seconds_count{%s} %d\n", labels, histogram.count)
+	}
+
+	w.WriteString("# HELP http_requests_in_flight Requests currently being served, by route.\n")
+	w.WriteString("# TYPE http_requests_in_flight gauge\n")
+	for _, route := range sortedKeys(m.inFlight, func(a, b string) bool { return a < b }) {
+		fmt.Fprintf(w, "http_requests_in_flight{route=%q} %d\n", route, m.inFlight[route])
+	}
+}
+
+func metricsHandler(metrics *RouteMetrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var body strings.Builder
+		metrics.write(&body)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(body.String()))
+	}
+}
+
+// incidentMetrics counts incidents by severity and status. Every pair in
+// the taxonomies gets a series, so dashboards see zeros rather than gaps.
+func incidentMetrics(store *IncidentStore) func(w *strings.Builder) {
+	return func(w *strings.Builder) {
+		type bucket struct{ severity, status string }
+		counts := map[bucket]int{}
+		taxonomies := currentTaxonomies()
+		for _, severity := range taxonomies.severityNames() {
+			for _, status := range taxonomies.statusNames() {
+				counts[bucket{severity, status}] = 0
+			}
+		}
+		store.mu.RLock()
+		for _, incident := range store.incidents {
+			counts[bucket{incident.Severity, incident.Status}]++
+		}
+		store.mu.RUnlock()
+
+		w.WriteString("# HELP soc_incidents Incidents, by severity and status.\n")
+		w.WriteString("# TYPE soc_incidents gauge\n")
+		for _, key := range sortedKeys(counts, func(a, b bucket) bool {
+			if a.severity != b.severity {
+				return a.severity < b.severity
+			}
+			return a.status < b.status
+		}) {
+			fmt.Fprintf(w, "soc_incidents{severity=%q,status=%q} %d\n", key.severity, key.status, counts[key])
+		}
+	}
+}
+
+func webhookMetrics(webhooks *WebhookStore) func(w *strings.Builder) {
+	return func(w *strings.Builder) {
+		statuses := map[string]int{deliveryPending: 0, deliveryDelivered: 0, deliveryRetrying: 0, deliveryFailed: 0}
+		webhooks.mu.RLock()
+		for _, delivery := range webhooks.deliveries {
+			statuses[delivery.Status]++
+		}
+		failed := webhooks.failedAttempts
+		webhooks.mu.RUnlock()
+
+		w.WriteString("# HELP soc_webhook_delivery_failures_total Webhook delivery attempts that failed, including ones retried.\n")
+		w.WriteString("# TYPE soc_webhook_delivery_failures_total counter\n")
+		fmt.Fprintf(w, "soc_webhook_delivery_failures_total %d\n", failed)
+		w.WriteString("# HELP soc_webhook_deliveries Webhook deliveries in the delivery log, by status.\n")
+		w.WriteString("# TYPE soc_webhook_deliveries gauge\n")
+		for _, status := range sortedKeys(statuses, func(a, b string) bool { return a < b }) {
+			fmt.Fprintf(w, "soc_webhook_deliveries{status=%q} %d\n", status, statuses[status])
+		}
+		w.WriteString("# HELP soc_webhook_queue_depth Webhook deliveries waiting to be sent.\n")
+		w.WriteString("# TYPE soc_webhook_queue_depth gauge\n")
+		fmt.Fprintf(w, "soc_webhook_queue_depth %d\n", len(webhooks.queue))
+	}
+}
+
+func enrichmentMetrics(enrichment *EnrichmentService) func(w *strings.Builder) {
+	return func(w *strings.Builder) {
+		w.WriteString("# HELP soc_enrichment_queue_depth Incidents waiting for background enrichment.\n")
+		w.WriteString("# TYPE soc_enrichment_queue_depth gauge\n")
+		fmt.Fprintf(w, "soc_enrichment_queue_depth %d\n", len(enrichment.jobs))
+		w.WriteString("# HELP soc_enrichment_queue_capacity Size of the enrichment queue (ENRICHMENT_QUEUE_SIZE).\n")
+		w.WriteString("# TYPE soc_enrichment_queue_capacity gauge\n")
+		fmt.Fprintf(w, "soc_enrichment_queue_capacity %d\n", cap(enrichment.jobs))
+		w.WriteString("# HELP soc_enrichment_dropped_total Enrichment jobs dropped because the queue was full.\n")
+		w.WriteString("# TYPE soc_enrichment_dropped_total counter\n")
+		fmt.Fprintf(w, "soc_enrichment_dropped_total %d\n", enrichment.dropped.Load())
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+)
+
+// mmdbReader is a minimal reader for the MaxMind DB format used by the
+// GeoLite2 databases. It loads the whole file into memory and decodes records
+// into generic maps, which is all the GeoIP enricher needs.
+type mmdbReader struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dbType     string
+	ipv4Start  uint
+}
+
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	markerAt := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if markerAt < 0 {
+		return nil, errors.New("mmdb: metadata marker not found in " + path)
+	}
+	metaStart := markerAt + len(mmdbMetadataMarker)
+	meta, _, err := (&mmdbDecoder{buf: buf[metaStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("mmdb: metadata: %w", err)
+	}
+	fields, ok := meta.(map[string]any)
+	if !ok {
+		return nil, errors.New("mmdb: metadata is not a map")
+	}
+
+	reader := &mmdbReader{
+		buf:        buf,
+		nodeCount:  uint(asUint(fields["node_count"])),
+		recordSize: uint(asUint(fields["record_size"])),
+		ipVersion:  uint(asUint(fields["ip_version"])),
+	}
+	reader.dbType, _ = fields["database_type"].(string)
+
+	switch reader.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("mmdb: unsupported record size %d", reader.recordSize)
+	}
+	treeSize := reader.nodeCount * reader.recordSize / 4
+	dataStart := treeSize + 16
+	if dataStart > uint(markerAt) {
+		return nil, errors.New("mmdb: search tree exceeds file size")
+	}
+	reader.data = buf[dataStart:markerAt]
+
+	if reader.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < reader.nodeCount; i++ {
+			node = reader.record(node, 0)
+		}
+		reader.ipv4Start = node
+	}
+	return reader, nil
+}
+
+func (m *mmdbReader) record(node uint, bit uint) uint {
+	switch m.recordSize {
+	case 24:
+		b := m.buf[node*6:]
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5])
+	case 28:
+		b := m.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		b := m.buf[node*8:]
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b[0:4]))
+		}
+		return uint(binary.BigEndian.Uint32(b[4:8]))
+	}
+}
+
+// lookup returns the decoded record for ip, or nil when the database has no
+// entry covering it.
+func (m *mmdbReader) lookup(ip netip.Addr) (map[string]any, error) {
+	ip = ip.Unmap()
+	raw := ip.AsSlice()
+	bitCount := uint(len(raw) * 8)
+
+	node := uint(0)
+	if ip.Is4() && m.ipVersion == 6 {
+		node = m.ipv4Start
+	} else if !ip.Is4() && m.ipVersion == 4 {
+		return nil, errors.New("mmdb: IPv6 lookup in an IPv4-only database")
+	}
+
+	for i := uint(0); i < bitCount && node < m.nodeCount; i++ {
+		bit := uint(raw[i/8]>>(7-i%8)) & 1
+		node = m.record(node, bit)
+	}
+	if node == m.nodeCount {
+		return nil, nil
+	}
+	if node < m.nodeCount {
+		return nil, errors.New("mmdb: invalid search tree")
+	}
+
+	offset := node - m.nodeCount - 16
+	value, _, err := (&mmdbDecoder{buf: m.data}).decode(offset)
+	if err != nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]any)
+	return record, nil
+}
+
+type mmdbDecoder struct {
+	buf []byte
+}
+
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+func (d *mmdbDecoder) byteAt(offset uint) (byte, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, errors.New("mmdb: unexpected end of data")
+	}
+	return d.buf[offset], nil
+}
+
+func (d *mmdbDecoder) bytes(offset, size uint) ([]byte, error) {
+	if offset+size > uint(len(d.buf)) {
+		return nil, errors.New("mmdb: unexpected end of data")
+	}
+	return d.buf[offset : offset+size], nil
+}
+
+// decode reads the value at offset and returns it with the offset of the
+// next value.
+func (d *mmdbDecoder) decode(offset uint) (any, uint, error) {
+	ctrl, err := d.byteAt(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+
+	kind := uint(ctrl >> 5)
+	if kind == mmdbPointer {
+		target, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(target)
+		return value, next, err
+	}
+	if kind == mmdbExtended {
+		ext, err := d.byteAt(offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + uint(ext)
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		extra := size - 28
+		raw, err := d.bytes(offset, extra)
+		if err != nil {
+			return nil, 0, err
+		}
+		n := uint(0)
+		for _, b := range raw {
+			n = n<<8 | uint(b)
+		}
+		switch size {
+		case 29:
+			size = 29 + n
+		case 30:
+			size = 285 + n
+		default:
+			size = 65821 + n
+		}
+		offset += extra
+	}
+
+	switch kind {
+	case mmdbString:
+		raw, err := d.bytes(offset, size)
+		return string(raw), offset + size, err
+	case mmdbBytes:
+		raw, err := d.bytes(offset, size)
+		return append([]byte(nil), raw...), offset + size, err
+	case mmdbDouble:
+		raw, err := d.bytes(offset, 8)
+		if err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), offset + 8, nil
+	case mmdbFloat:
+		raw, err := d.bytes(offset, 4)
+		if err != nil {
+			return nil, 0, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), offset + 4, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		raw, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		n := uint64(0)
+		for _, b := range raw {
+			n = n<<8 | uint64(b)
+		}
+		return n, offset + size, nil
+	case mmdbInt32:
+		raw, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		n := uint32(0)
+		for _, b := range raw {
+			n = n<<8 | uint32(b)
+		}
+		return int64(int32(n)), offset + size, nil
+	case mmdbUint128:
+		raw, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return new(big.Int).SetBytes(raw), offset + size, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbMap:
+		values := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("mmdb: map key is not a string")
+			}
+			value, after, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			values[keyString] = value
+			offset = after
+		}
+		return values, offset, nil
+	case mmdbArray:
+		values := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			values = append(values, value)
+			offset = next
+		}
+		return values, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("mmdb: unsupported data type %d", kind)
+	}
+}
+
+func (d *mmdbDecoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	sizeBits := uint(ctrl>>3) & 0x3
+	raw, err := d.bytes(offset, sizeBits+1)
+	if err != nil {
+		return 0, 0, err
+	}
+	prefix := uint(ctrl & 0x7)
+	next := offset + sizeBits + 1
+
+	switch sizeBits {
+	case 0:
+		return prefix<<8 | uint(raw[0]), next, nil
+	case 1:
+		return (prefix<<16 | uint(raw[0])<<8 | uint(raw[1])) + 2048, next, nil
+	case 2:
+		return (prefix<<24 | uint(raw[0])<<16 | uint(raw[1])<<8 | uint(raw[2])) + 526336, next, nil
+	default:
+		return uint(binary.BigEndian.Uint32(raw)), next, nil
+	}
+}
+
+func asUint(value any) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int64:
+		return uint64(v)
+	}
+	return 0
+}
+
+// mmdbPath walks nested maps, e.g. mmdbPath(record, "country", "iso_code").
+func mmdbPath(record map[string]any, keys ...string) any {
+	var current any = record
+	for _, key := range keys {
+		values, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = values[key]
+	}
+	return current
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QueryTranslator turns a natural-language question into a query in the
+// incident query language (see query.go).
+type QueryTranslator interface {
+	name() string
+	translate(ctx context.Context, question string, vocabulary queryVocabulary) (string, error)
+}
+
+// queryVocabulary carries the values currently in use so translators can
+// ground words like "phishing" in real tags.
+type queryVocabulary struct {
+	Tags   []string
+	Owners []string
+}
+
+type TranslateInput struct {
+	Question string `json:"question"`
+}
+
+type TranslateResult struct {
+	Question   string `json:"question"`
+	Query      string `json:"query"`
+	Parsed     Query  `json:"parsed"`
+	Provider   string `json:"provider"`
+	ExecuteURL string `json:"executeUrl"`
+}
+
+type QueryTranslationService struct {
+	primary  QueryTranslator
+	fallback QueryTranslator
+}
+
+func newQueryTranslationService() *QueryTranslationService {
+	service := &QueryTranslationService{fallback: ruleTranslator{}}
+	if endpoint := envString("NLQ_LLM_URL", ""); endpoint != "" {
+		service.primary = &llmTranslator{
+			client: newOutboundClient(),
+			url:    endpoint,
+			token:  envString("NLQ_LLM_TOKEN", ""),
+			model:  envString("NLQ_LLM_MODEL", "gpt-4o-mini"),
+		}
+	}
+	return service
+}
+
+// translate never executes anything: it returns the parsed query so the
+// analyst can confirm it first. Output from the model is only accepted if it
+// parses; otherwise the rule-based translator answers.
+func (s *QueryTranslationService) translate(ctx context.Context, question string, vocabulary queryVocabulary) (TranslateResult, error) {
+	translators := []QueryTranslator{s.fallback}
+	if s.primary != nil {
+		translators = []QueryTranslator{s.primary, s.fallback}
+	}
+
+	var lastErr error
+	for _, translator := range translators {
+		text, err := translator.translate(ctx, question, vocabulary)
+		if err != nil {
+			log.Printf("query translation via %s: %v", translator.name(), err)
+			lastErr = err
+			continue
+		}
+		parsed, err := parseQuery(text)
+		if err != nil {
+			log.Printf("query translation via %s produced %q: %v", translator.name(), text, err)
+			lastErr = err
+			continue
+		}
+		canonical := parsed.String()
+		return TranslateResult{
+			Question:   question,
+			Query:      canonical,
+			Parsed:     parsed,
+			Provider:   translator.name(),
+			ExecuteURL: "/api/incidents?query=" + url.QueryEscape(canonical),
+		}, nil
+	}
+	return TranslateResult{}, lastErr
+}
+
+// vocabulary collects the tags and owners of the incidents the caller can
+// see, since it is handed to a translator that may be an outside service.
+func (s *IncidentStore) vocabulary(r *http.Request) queryVocabulary {
+	tags := map[string]bool{}
+	owners := map[string]bool{}
+	for _, incident := range visibleTo(r, s.list()) {
+		for _, tag := range incident.Tags {
+			tags[strings.ToLower(tag)] = true
+		}
+		owners[incident.Owner] = true
+	}
+	vocabulary := queryVocabulary{}
+	for tag := range tags {
+		vocabulary.Tags = append(vocabulary.Tags, tag)
+	}
+	for owner := range owners {
+		vocabulary.Owners = append(vocabulary.Owners, owner)
+	}
+	sort.Strings(vocabulary.Tags)
+	sort.Strings(vocabulary.Owners)
+	return vocabulary
+}
+
+type ruleTranslator struct{}
+
+var (
+	lastNPattern    = regexp.MustCompile(`\b(?:last|past)\s+(\d+)\s+(day|days|hour|hours|week|weeks)\b`)
+	assigneePattern = regexp.MustCompile(`\b(?:assigned to|owned by)\s+([\w .-]+?)(?:\s+(?:from|in|with|since|during|over|created|updated|last|past)\b|[?.!]|$)`)
+	wordPattern     = regexp.MustCompile(`[a-z0-9][a-z0-9._:/-]*`)
+)
+
+func (ruleTranslator) name() string { return "rules" }
+
+func (ruleTranslator) translate(ctx context.Context, question string, vocabulary queryVocabulary) (string, error) {
+	lower := strings.ToLower(strings.TrimSpace(question))
+	if lower == "" {
+		return "", errors.New("question is empty")
+	}
+	words := map[string]bool{}
+	for _, word := range wordPattern.FindAllString(lower, -1) {
+		words[strings.TrimRight(word, ".,?!")] = true
+	}
+
+	terms := []string{}
+	severities := []string{}
+	for _, severity := range []string{"critical", "high", "medium", "low"} {
+		if words[severity] {
+			severities = append(severities, severity)
+		}
+	}
+	if len(severities) > 0 {
+		terms = append(terms, "severity:"+strings.Join(severities, ","))
+	}
+
+	switch {
+	case words["open"] || words["unresolved"] || words["active"] || words["ongoing"]:
+		terms = append(terms, "status:open")
+	case words["closed"] || words["resolved"]:
+		terms = append(terms, "status:closed")
+	default:
+		for _, status := range []string{"new", "investigating", "contained"} {
+			if words[status] {
+				terms = append(terms, "status:"+status)
+				break
+			}
+		}
+	}
+
+	if words["major"] {
+		terms = append(terms, "major:true")
+	}
+	if words["unassigned"] {
+		terms = append(terms, "owner:Unassigned")
+	} else if match := assigneePattern.FindStringSubmatch(lower); match != nil {
+		owner := strings.TrimSpace(match[1])
+		for _, known := range vocabulary.Owners {
+			if strings.EqualFold(known, owner) {
+				owner = known
+				break
+			}
+		}
+		terms = append(terms, "owner:"+quoteQueryValue(owner))
+	}
+
+	for _, tag := range vocabulary.Tags {
+		if words[tag] || words[tag+"s"] {
+			terms = append(terms, "tag:"+tag)
+		}
+	}
+	indicators := []string{}
+	for word := range words {
+		if kind := iocType(word); kind == iocIP || kind == iocHash || kind == iocDomain {
+			indicators = append(indicators, "ioc:"+word)
+		}
+	}
+	sort.Strings(indicators)
+	terms = append(terms, indicators...)
+
+	field := "created"
+	if words["updated"] || words["changed"] || words["touched"] {
+		field = "updated"
+	}
+	switch {
+	case lastNPattern.MatchString(lower):
+		match := lastNPattern.FindStringSubmatch(lower)
+		unit := "d"
+		count := match[1]
+		switch {
+		case strings.HasPrefix(match[2], "hour"):
+			unit = "h"
+		case strings.HasPrefix(match[2], "week"):
+			weeks, _ := strconv.Atoi(count)
+			count = itoa(weeks * 7)
+		}
+		terms = append(terms, field+">=now-"+count+unit)
+	case strings.Contains(lower, "today") || strings.Contains(lower, "last 24 hours"):
+		terms = append(terms, field+">=now-24h")
+	case strings.Contains(lower, "yesterday"):
+		terms = append(terms, field+">=now-2d")
+	case strings.Contains(lower, "last week") || strings.Contains(lower, "past week") || strings.Contains(lower, "this week"):
+		terms = append(terms, field+">=now-7d")
+	case strings.Contains(lower, "last month") || strings.Contains(lower, "past month") || strings.Contains(lower, "this month"):
+		terms = append(terms, field+">=now-30d")
+	}
+
+	return strings.Join(terms, " "), nil
+}
+
+// llmTranslator asks an OpenAI-compatible chat completions endpoint to write
+// the query.
+type llmTranslator struct {
+	client *http.Client
+	url    string
+	token  string
+	model  string
+}
+
+func (l *llmTranslator) name() string { return "llm" }
+
+func (l *llmTranslator) translate(ctx context.Context, question string, vocabulary queryVocabulary) (string, error) {
+	system := `Translate the analyst's question into the incident query language. Reply with the query only.
+Terms are space-separated and all must match:
+- severity:<critical|high|medium|low>[,more]
+- status:<open|closed|new|investigating|contained|resolved>
+- owner:<name> (quote names with spaces)
+- tag:<tag>, ioc:<value>, major:<true|false>
+- phase:<recon|weaponization|delivery|exploitation|installation|command-and-control|actions-on-objectives|none>
+- created or updated with >=, <=, >, < and a date (2024-05-01) or now-<N>d / now-<N>h
+- "quoted free text"
+Known tags: ` + strings.Join(vocabulary.Tags, ", ") + `
+Known owners: ` + strings.Join(vocabulary.Owners, ", ")
+
+	payload := map[string]any{
+		"model": l.model,
+		"messages": []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": question},
+		},
+	}
+	var headers map[string]string
+	if l.token != "" {
+		headers = bearer(l.token)
+	}
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := doJSON(ctx, l.client, http.MethodPost, l.url, headers, payload, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("no choices in response")
+	}
+	return strings.Trim(strings.TrimSpace(resp.Choices[0].Message.Content), "`"), nil
+}
+
+func queryTranslateHandler(store *IncidentStore, translator *QueryTranslationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var input TranslateInput
+		if err := readJSON(r, &input); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		if strings.TrimSpace(input.Question) == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "question is required"})
+			return
+		}
+		result, err := translator.translate(r.Context(), input.Question, store.vocabulary(r))
+		if err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import "strings"
+
+// NoteThread is a note with the replies to it, and theirs in turn.
+type NoteThread struct {
+	Note
+	Replies []NoteThread `json:"replies"`
+}
+
+// threadNotes arranges notes, newest first as the store keeps them, into
+// threads. Top-level notes stay newest first; replies read oldest first
+// like a conversation. A reply whose parent isn't among notes (say, it was
+// filtered out) is shown at the top level.
+func threadNotes(notes []Note) []NoteThread {
+	present := map[string]bool{}
+	for _, note := range notes {
+		present[note.ID] = true
+	}
+	children := map[string][]Note{}
+	roots := []Note{}
+	for i := len(notes) - 1; i >= 0; i-- {
+		note := notes[i]
+		if note.ParentNoteID != "" && present[note.ParentNoteID] {
+			children[note.ParentNoteID] = append(children[note.ParentNoteID], note)
+			continue
+		}
+		roots = append([]Note{note}, roots...)
+	}
+
+	var build func(note Note) NoteThread
+	build = func(note Note) NoteThread {
+		thread := NoteThread{Note: note, Replies: []NoteThread{}}
+		for _, reply := range children[note.ID] {
+			thread.Replies = append(thread.Replies, build(reply))
+		}
+		return thread
+	}
+	threads := make([]NoteThread, 0, len(roots))
+	for _, root := range roots {
+		threads = append(threads, build(root))
+	}
+	return threads
+}
+
+// findNote returns the note with id, matched case-insensitively.
+func findNote(notes []Note, id string) (Note, bool) {
+	for _, note := range notes {
+		if strings.EqualFold(note.ID, strings.TrimSpace(id)) {
+			return note, true
+		}
+	}
+	return Note{}, false
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Notification struct {
+	Event    string   `json:"event"`
+	Message  string   `json:"message"`
+	Incident Incident `json:"incident"`
+	Broad    bool     `json:"broad"`
+	// Recipients names users who should hear about this in particular, for
+	// targets that can address people.
+	Recipients []string `json:"recipients,omitempty"`
+	// Changed names the fields an incident.updated notification is about.
+	Changed []string  `json:"changed,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// NotificationTarget delivers a notification to one destination (a chat
+// channel, pager, or webhook).
+type NotificationTarget interface {
+	name() string
+	send(ctx context.Context, notification Notification) error
+}
+
+type notificationRoute struct {
+	target NotificationTarget
+	// broadOnly routes only receive notifications flagged Broad, which is how
+	// major incidents reach a wider audience than the usual SOC channels.
+	broadOnly bool
+}
+
+type Notifier struct {
+	routes  []notificationRoute
+	queue   chan Notification
+	pending pendingWork
+}
+
+func newNotifier() *Notifier {
+	notifier := &Notifier{queue: make(chan Notification, envInt("NOTIFY_QUEUE_SIZE", 256))}
+	notifier.add(logTarget{}, false)
+
+	client := newOutboundClient()
+	if endpoint := envString("NOTIFY_WEBHOOK_URL", ""); endpoint != "" {
+		notifier.add(&webhookTarget{client: client, url: endpoint}, false)
+	}
+	for _, endpoint := range sanitizeSlice(strings.Split(envString("NOTIFY_BROAD_WEBHOOK_URLS", ""), ",")) {
+		notifier.add(&webhookTarget{client: client, url: endpoint}, true)
+	}
+	if slack := newSlackTarget(); slack != nil {
+		notifier.add(slack, false)
+	}
+	if opsgenie := newOpsgenieTarget(); opsgenie != nil {
+		notifier.add(opsgenie, false)
+	}
+	return notifier
+}
+
+func (n *Notifier) add(target NotificationTarget, broadOnly bool) {
+	n.routes = append(n.routes, notificationRoute{target: target, broadOnly: broadOnly})
+}
+
+func (n *Notifier) start() {
+	go func() {
+		for notification := range n.queue {
+			n.deliver(notification)
+			n.pending.done()
+		}
+	}()
+}
+
+// notify queues a notification for asynchronous delivery. Anything about a
+// major incident is always sent broad; restricted cases are redacted to
+// their ID and state since channels reach people who aren't cleared.
+func (n *Notifier) notify(notification Notification) {
+	if notification.At.IsZero() {
+		notification.At = time.Now().UTC()
+	}
+	if incident := notification.Incident; incident.Restricted {
+		notification.Message = notification.Event + " on restricted case " + incident.ID
+		notification.Incident = redactIncident(incident)
+	}
+	if notification.Incident.Major {
+		notification.Broad = true
+	}
+	n.pending.add()
+	select {
+	case n.queue <- notification:
+	default:
+		n.pending.done()
+		log.Printf("notification queue full, dropping %s for %s", notification.Event, notification.Incident.ID)
+	}
+}
+
+// redactIncident cuts a restricted case down to its ID and state for
+// destinations that reach people who aren't cleared for it.
+func redactIncident(incident Incident) Incident {
+	return Incident{
+		ID:         incident.ID,
+		Type:       incident.Type,
+		Restricted: true,
+		Severity:   incident.Severity,
+		Status:     incident.Status,
+		Major:      incident.Major,
+		CreatedAt:  incident.CreatedAt,
+		UpdatedAt:  incident.UpdatedAt,
+		trace:      incident.trace,
+	}
+}
+
+func (n *Notifier) deliver(notification Notification) {
+	for _, route := range n.routes {
+		if route.broadOnly && !notification.Broad {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(contextWithTrace(context.Background(), notification.Incident.trace), 15*time.Second)
+		if err := route.target.send(ctx, notification); err != nil {
+			log.Printf("notify %s via %s: %v", notification.Event, route.target.name(), err)
+		}
+		cancel()
+	}
+}
+
+// handleEvent turns store changes into notifications worth interrupting
+// someone for.
+func (n *Notifier) handleEvent(event IncidentEvent) {
+	incident := event.Incident
+	if event.Type == eventIncidentCreated || event.Type == eventIncidentUpdated {
+		if hits := newWatchlistHits(incident, event.Previous); len(hits) > 0 {
+			names := make([]string, 0, len(hits))
+			for _, hit := range hits {
+				names = append(names, hit.Indicator+" ("+hit.WatchlistName+")")
+			}
+			n.notify(Notification{
+				Event:    "watchlist.hit",
+				Message:  incident.ID + " matches watchlist indicators: " + strings.Join(names, ", "),
+				Incident: incident,
+			})
+		}
+	}
+
+	switch event.Type {
+	case eventIncidentCreated:
+		n.notify(Notification{
+			Event:    event.Type,
+			Message:  "New " + incident.Severity + " incident " + incident.ID + ": " + incident.Title,
+			Incident: incident,
+		})
+	case eventIncidentUpdated:
+		previous := event.Previous
+		if previous == nil {
+			return
+		}
+		if incident.SLABreached && !previous.SLABreached {
+			n.notify(Notification{
+				Event:    "sla.breached",
+				Message:  incident.Severity + " incident " + incident.ID + " breached its SLA: " + incident.Title,
+				Incident: incident,
+			})
+		}
+		if incident.Major && !previous.Major {
+			n.notify(Notification{
+				Event:    "incident.major",
+				Message:  "Major incident declared: " + incident.ID + " " + incident.Title,
+				Incident: incident,
+			})
+			return
+		}
+		changes, changed := []string{}, []string{}
+		if incident.Severity != previous.Severity {
+			changes = append(changes, "severity "+previous.Severity+" -> "+incident.Severity)
+			changed = append(changed, "severity")
+		}
+		if incident.Status != previous.Status {
+			changes = append(changes, "status "+previous.Status+" -> "+incident.Status)
+			changed = append(changed, "status")
+		}
+		if incident.Owner != previous.Owner {
+			changes = append(changes, "owner "+previous.Owner+" -> "+incident.Owner)
+			changed = append(changed, "owner")
+		}
+		if len(changes) == 0 {
+			return
+		}
+		n.notify(Notification{
+			Event:    event.Type,
+			Message:  incident.ID + " updated: " + strings.Join(changes, ", "),
+			Incident: incident,
+			Changed:  changed,
+		})
+	case eventNoteAdded:
+		if len(incident.Notes) == 0 {
+			return
+		}
+		note := incident.Notes[0]
+		n.notifyMentions(incident, note)
+		if !incident.Major {
+			return
+		}
+		n.notify(Notification{
+			Event:    event.Type,
+			Message:  incident.ID + " note from " + note.Author + ": " + note.Body,
+			Incident: incident,
+		})
+	}
+}
+
+type logTarget struct{}
+
+func (logTarget) name() string { return "log" }
+
+func (logTarget) send(ctx context.Context, notification Notification) error {
+	scope := ""
+	if notification.Broad {
+		scope = " (broad)"
+	}
+	log.Printf("notify%s [%s] %s", scope, notification.Event, notification.Message)
+	return nil
+}
+
+type webhookTarget struct {
+	client *http.Client
+	url    string
+}
+
+func (w *webhookTarget) name() string { return "webhook" }
+
+func (w *webhookTarget) send(ctx context.Context, notification Notification) error {
+	return doJSON(ctx, w.client, http.MethodPost, w.url, nil, notification, nil)
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcStateCookie = "soc_oidc_state"
+	oidcLoginTTL    = 10 * time.Minute
+)
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// oidcLogin is a login started at /auth/login, waiting for its callback.
+type oidcLogin struct {
+	nonce    string
+	verifier string
+	next     string
+	expires  time.Time
+}
+
+// OIDCProvider signs dashboard users in with an OpenID Connect provider
+// such as Azure AD or Okta, using the authorization code flow with PKCE,
+// and hands them a session cookie.
+type OIDCProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	logoutURL    string
+	scopes       string
+	client       *http.Client
+	sessions     *SessionStore
+	audit        *AuditLog
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	verifier  *jwtVerifier
+	pending   map[string]oidcLogin
+}
+
+// newOIDCProvider reads the OIDC_* settings, returning nil when
+// OIDC_ISSUER is unset.
+func newOIDCProvider(sessions *SessionStore, audit *AuditLog) *OIDCProvider {
+	issuer := strings.TrimSuffix(envString("OIDC_ISSUER", ""), "/")
+	if issuer == "" {
+		return nil
+	}
+	provider := &OIDCProvider{
+		issuer:       issuer,
+		clientID:     envString("OIDC_CLIENT_ID", ""),
+		clientSecret: envString("OIDC_CLIENT_SECRET", ""),
+		redirectURL:  envString("OIDC_REDIRECT_URL", ""),
+		logoutURL:    envString("OIDC_POST_LOGOUT_REDIRECT_URL", ""),
+		scopes:       envString("OIDC_SCOPES", "openid profile email"),
+		client:       newOutboundClient(),
+		sessions:     sessions,
+		audit:        audit,
+		pending:      map[string]oidcLogin{},
+	}
+	if provider.clientID == "" || provider.redirectURL == "" {
+		log.Printf("oidc: OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required; SSO disabled")
+		return nil
+	}
+	return provider
+}
+
+// discover fetches the provider's configuration on first use, and again
+// after a failure.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, *jwtVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, p.verifier, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := doJSON(ctx, p.client, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil, nil, &discovery); err != nil {
+		return nil, nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.issuer {
+		return nil, nil, fmt.Errorf("provider reports issuer %q", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, nil, errors.New("provider configuration is missing endpoints")
+	}
+	p.discovery = &discovery
+	p.verifier = &jwtVerifier{
+		jwksURL:    discovery.JWKSURI,
+		issuer:     discovery.Issuer,
+		audience:   p.clientID,
+		userClaim:  envString("OIDC_USER_CLAIM", "preferred_username"),
+		nameClaim:  envString("OIDC_NAME_CLAIM", "name"),
+		rolesClaim: envString("OIDC_ROLES_CLAIM", "roles"),
+		leeway:     envDuration("JWT_LEEWAY", time.Minute),
+		client:     p.client,
+		keys:       map[string]*rsa.PublicKey{},
+		jwksTTL:    envDuration("JWT_JWKS_TTL", time.Hour),
+	}
+	return p.discovery, p.verifier, nil
+}
+
+// localPath keeps post-login redirects on this site.
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func withQuery(endpoint string, values url.Values) string {
+	separator := "?"
+	if strings.Contains(endpoint, "?") {
+		separator = "&"
+	}
+	return endpoint + separator + values.Encode()
+}
+
+// exchange trades an authorization code for the provider's tokens.
+func (p *OIDCProvider) exchange(ctx context.Context, endpoint, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("token endpoint: %s: %s", resp.Status, bytes.TrimSpace(snippet))
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token endpoint returned no id_token")
+	}
+	return tokens.IDToken, nil
+}
+
+func (p *OIDCProvider) stateCookie(state string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/",
+		HttpOnly: true,
+		Secure:   p.sessions.secure,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(oidcLoginTTL / time.Second),
+	}
+	if state == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+func (p *OIDCProvider) record(r *http.Request, action, actor, outcome, detail string) {
+	p.audit.record(AuditEvent{
+		Actor:      actor,
+		ActorType:  principalUser,
+		Action:     action,
+		Resource:   r.URL.Path,
+		Outcome:    outcome,
+		Detail:     detail,
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	})
+}
+
+// loginHandler serves GET /auth/login?next=, sending the browser to the
+// provider. The state cookie ties the callback to this browser, so another
+// site can't log it in as someone else.
+func (p *OIDCProvider) loginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		discovery, _, err := p.discover(r.Context())
+		if err != nil {
+			log.Printf("oidc: discovery: %v", err)
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": "identity provider unavailable"})
+			return
+		}
+		state, err1 := randomToken(24)
+		nonce, err2 := randomToken(24)
+		verifier, err3 := randomToken(32)
+		if err := errors.Join(err1, err2, err3); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		now := time.Now().UTC()
+		p.mu.Lock()
+		for key, login := range p.pending {
+			if now.After(login.expires) {
+				delete(p.pending, key)
+			}
+		}
+		p.pending[state] = oidcLogin{nonce: nonce, verifier: verifier, next: localPath(r.URL.Query().Get("next")), expires: now.Add(oidcLoginTTL)}
+		p.mu.Unlock()
+
+		challenge := sha256.Sum256([]byte(verifier))
+		http.SetCookie(w, p.stateCookie(state))
+		http.Redirect(w, r, withQuery(discovery.AuthorizationEndpoint, url.Values{
+			"response_type":         {"code"},
+			"client_id":             {p.clientID},
+			"redirect_uri":          {p.redirectURL},
+			"scope":                 {p.scopes},
+			"state":                 {state},
+			"nonce":                 {nonce},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+			"code_challenge_method": {"S256"},
+		}), http.StatusFound)
+	}
+}
+
+// callbackHandler serves GET /auth/callback, where the provider returns
+// the browser with an authorization code.
+func (p *OIDCProvider) callbackHandler(users *UserStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		if failure := query.Get("error"); failure != "" {
+			p.record(r, "auth.login", "", auditOutcomeFailure, "provider: "+strings.TrimSpace(failure+" "+query.Get("error_description")))
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login failed: " + failure})
+			return
+		}
+		state := query.Get("state")
+		cookie, err := r.Cookie(oidcStateCookie)
+		if state == "" || err != nil || cookie.Value != state {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "login state mismatch, start again at /auth/login"})
+			return
+		}
+		http.SetCookie(w, p.stateCookie(""))
+
+		p.mu.Lock()
+		login, ok := p.pending[state]
+		delete(p.pending, state)
+		p.mu.Unlock()
+		now := time.Now().UTC()
+		if !ok || now.After(login.expires) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "login expired, start again at /auth/login"})
+			return
+		}
+
+		discovery, verifier, err := p.discover(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": "identity provider unavailable"})
+			return
+		}
+		idToken, err := p.exchange(r.Context(), discovery.TokenEndpoint, query.Get("code"), login.verifier)
+		if err != nil {
+			log.Printf("oidc: code exchange: %v", err)
+			p.record(r, "auth.login", "", auditOutcomeFailure, "code exchange failed")
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": "code exchange failed"})
+			return
+		}
+		claims, err := verifier.claims(r.Context(), idToken, now)
+		if err == nil && claims["nonce"] != login.nonce {
+			err = errors.New("nonce mismatch")
+		}
+		var principal Principal
+		if err == nil {
+			principal, err = verifier.principal(claims)
+		}
+		if err != nil {
+			p.record(r, "auth.login", "", auditOutcomeFailure, "invalid id_token: "+err.Error())
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid id_token: " + err.Error()})
+			return
+		}
+		if users.inactive(principal.ID) {
+			p.record(r, "auth.login", principal.ID, auditOutcomeFailure, "account deactivated")
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "account deactivated"})
+			return
+		}
+
+		token, session, err := p.sessions.create(principal, idToken, now)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.record(r, "auth.login", principal.ID, auditOutcomeSuccess, "oidc")
+		http.SetCookie(w, p.sessions.cookie(token, session.ExpiresAt))
+		http.Redirect(w, r, login.next, http.StatusFound)
+	}
+}
+
+// afterLogout is where a browser goes after logging out of an SSO session:
+// the provider's end-session endpoint, when it has one, so the provider's
+// session ends too.
+func (p *OIDCProvider) afterLogout(ctx context.Context, session Session) string {
+	target := fallback(p.logoutURL, "/")
+	if session.IDToken == "" {
+		return target
+	}
+	discovery, _, err := p.discover(ctx)
+	if err != nil || discovery.EndSessionEndpoint == "" {
+		return target
+	}
+	values := url.Values{"client_id": {p.clientID}, "id_token_hint": {session.IDToken}}
+	if p.logoutURL != "" {
+		values.Set("post_logout_redirect_uri", p.logoutURL)
+	}
+	return withQuery(discovery.EndSessionEndpoint, values)
+}
+
+// withLogin sends browsers without a session to /auth/login when SSO is
+// configured, so the dashboard isn't served to anyone who asks. The API
+// answers for itself (see withAuthRequired), as do /auth/, /metrics, and the
+// HEC collector under /services/, which authenticates with its own tokens.
+func withLogin(next http.Handler, oidc *OIDCProvider) http.Handler {
+	if oidc == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if _, ok := principalFrom(r.Context()); ok || strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/auth/") || strings.HasPrefix(path, "/services/") || path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+			return
+		}
+		http.Redirect(w, r, "/auth/login?"+url.Values{"next": {r.URL.RequestURI()}}.Encode(), http.StatusFound)
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOIDCCallback(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := jwksServer(t, "k1", &key.PublicKey)
+	// idToken is what the provider's token endpoint hands out next.
+	var idToken string
+	provider := httptest.NewServer(nil)
+	t.Cleanup(provider.Close)
+	provider.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			writeJSON(w, http.StatusOK, oidcDiscovery{
+				Issuer:                provider.URL,
+				AuthorizationEndpoint: provider.URL + "/authorize",
+				TokenEndpoint:         provider.URL + "/token",
+				JWKSURI:               jwks.URL,
+			})
+		case "/token":
+			writeJSON(w, http.StatusOK, map[string]string{"id_token": idToken})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	t.Setenv("OIDC_ISSUER", provider.URL)
+	t.Setenv("OIDC_CLIENT_ID", "soc")
+	t.Setenv("OIDC_REDIRECT_URL", "https://soc.example.com/auth/callback")
+
+	users := newUserStore()
+	if _, err := users.create(UserInput{ID: "mallory", Name: "Mallory"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.deactivate("mallory", time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	sessions := newSessionStore()
+	oidc := newOIDCProvider(sessions, newAuditLog())
+	if oidc == nil {
+		t.Fatal("newOIDCProvider() = nil")
+	}
+
+	rs256 := map[string]any{"alg": "RS256", "kid": "k1"}
+	tests := []struct {
+		name       string
+		header     map[string]any
+		edit       func(claims map[string]any)
+		key        any
+		wrongState bool
+		wantStatus int
+		wantError  string
+	}{
+		{name: "valid", header: rs256, key: key, wantStatus: http.StatusFound},
+		{name: "expired", header: rs256, key: key, edit: func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantStatus: http.StatusUnauthorized, wantError: "token expired"},
+		{name: "wrong alg", header: map[string]any{"alg": "HS256", "kid": "k1"}, key: []byte("soc"), wantStatus: http.StatusUnauthorized, wantError: "unsupported alg HS256"},
+		{name: "alg none", header: map[string]any{"alg": "none"}, wantStatus: http.StatusUnauthorized, wantError: "unsupported alg none"},
+		{name: "wrong audience", header: rs256, key: key, edit: func(c map[string]any) { c["aud"] = "other-app" }, wantStatus: http.StatusUnauthorized, wantError: "unexpected audience"},
+		{name: "wrong issuer", header: rs256, key: key, edit: func(c map[string]any) { c["iss"] = "https://evil.example.com" }, wantStatus: http.StatusUnauthorized, wantError: "unexpected issuer"},
+		{name: "replayed nonce", header: rs256, key: key, edit: func(c map[string]any) { c["nonce"] = "from-another-login" }, wantStatus: http.StatusUnauthorized, wantError: "nonce mismatch"},
+		{name: "deactivated user", header: rs256, key: key, edit: func(c map[string]any) { c["preferred_username"] = "mallory" }, wantStatus: http.StatusForbidden},
+		{name: "state from another browser", header: rs256, key: key, wrongState: true, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login := httptest.NewRecorder()
+			oidc.loginHandler().ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/auth/login?next=/detail.html", nil))
+			if login.Code != http.StatusFound {
+				t.Fatalf("login status = %d, want %d", login.Code, http.StatusFound)
+			}
+			authorize, err := url.Parse(login.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			state, nonce := authorize.Query().Get("state"), authorize.Query().Get("nonce")
+
+			claims := map[string]any{
+				"preferred_username": "alice",
+				"iss":                provider.URL,
+				"aud":                "soc",
+				"exp":                time.Now().Add(time.Hour).Unix(),
+				"nonce":              nonce,
+			}
+			if tt.edit != nil {
+				tt.edit(claims)
+			}
+			idToken = signJWT(t, tt.header, claims, tt.key)
+
+			r := httptest.NewRequest(http.MethodGet, "/auth/callback?code=abc&state="+url.QueryEscape(state), nil)
+			cookie := state
+			if tt.wrongState {
+				cookie = "someone-elses-state"
+			}
+			r.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: cookie})
+			callback := httptest.NewRecorder()
+			oidc.callbackHandler(users).ServeHTTP(callback, r)
+			if callback.Code != tt.wantStatus {
+				t.Fatalf("callback status = %d, want %d: %s", callback.Code, tt.wantStatus, callback.Body)
+			}
+			if !strings.Contains(callback.Body.String(), tt.wantError) {
+				t.Errorf("callback body = %s, want %q", callback.Body, tt.wantError)
+			}
+
+			var session *http.Cookie
+			for _, cookie := range callback.Result().Cookies() {
+				if cookie.Name == sessionCookie {
+					session = cookie
+				}
+			}
+			if tt.wantStatus != http.StatusFound {
+				if session != nil {
+					t.Errorf("refused login set a session cookie")
+				}
+				return
+			}
+			if location := callback.Header().Get("Location"); location != "/detail.html" {
+				t.Errorf("redirected to %q, want /detail.html", location)
+			}
+			if session == nil {
+				t.Fatal("no session cookie set")
+			}
+			if got, ok := sessions.lookup(session.Value, time.Now().UTC()); !ok || got.Principal.ID != "alice" {
+				t.Errorf("session = %+v, %v, want alice", got, ok)
+			}
+		})
+	}
+}
+
+func TestWithLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		signedIn   bool
+		wantStatus int
+	}{
+		{"dashboard page", http.MethodGet, "/detail.html", false, http.StatusFound},
+		{"dashboard page signed in", http.MethodGet, "/detail.html", true, http.StatusOK},
+		{"form post to a page", http.MethodPost, "/", false, http.StatusUnauthorized},
+		{"api", http.MethodPost, "/api/incidents", false, http.StatusOK},
+		{"login endpoints", http.MethodGet, "/auth/login", false, http.StatusOK},
+		{"metrics", http.MethodGet, "/metrics", false, http.StatusOK},
+		{"HEC collector", http.MethodPost, "/services/collector/event", false, http.StatusOK},
+		{"HEC health", http.MethodGet, "/services/collector/health", false, http.StatusOK},
+	}
+	handler := withLogin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }), &OIDCProvider{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.signedIn {
+				r = r.WithContext(withPrincipal(r.Context(), Principal{ID: "alice", Kind: principalUser}))
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
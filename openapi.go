@@ -0,0 +1,427 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// apiOperation is one route in the OpenAPI document. Request and response
+// bodies are zero values of the types the handler decodes and writes, so
+// their schemas come from the Go types like the webhook schemas do; a nil
+// body is one that isn't JSON, or that the handler builds on the fly.
+type apiOperation struct {
+	method   string
+	path     string
+	tag      string
+	summary  string
+	query    []string
+	request  any
+	status   int
+	response any
+}
+
+// apiList is a response of the form {"items": [...]}.
+type apiList struct{ item any }
+
+// apiOperations lists every route the server registers. Keep it next to
+// the handler changes: a route missing here is one integrators can't find.
+var apiOperations = []apiOperation{
+	{method: "GET", path: "/api/incidents", tag: "Incidents", summary: "List incidents", query: []string{"q", "query", "status", "severity", "killChainPhase", "includeClosed", "team", "sort", "limit", "offset", "updatedSince"}, response: IncidentPage{}},
+	{method: "POST", path: "/api/incidents", tag: "Incidents", summary: "Create an incident", query: []string{"template"}, request: IncidentInput{}, status: http.StatusCreated, response: Incident{}},
+	{method: "GET", path: "/api/incidents/export", tag: "Incidents", summary: "Export incidents as CSV or JSON", query: []string{"columns", "query", "format"}},
+	{method: "GET", path: "/api/incidents/{id}", tag: "Incidents", summary: "Get an incident", query: []string{"render"}, response: Incident{}},
+	{method: "PUT", path: "/api/incidents/{id}", tag: "Incidents", summary: "Update an incident", request: IncidentUpdate{}, response: Incident{}},
+	{method: "GET", path: "/api/incidents/{id}/notes", tag: "Incidents", summary: "List an incident's notes", query: []string{"authorType", "authorId", "flat", "render"}, response: apiList{Note{}}},
+	{method: "POST", path: "/api/incidents/{id}/notes", tag: "Incidents", summary: "Add a note", request: NoteInput{}, response: Incident{}},
+	{method: "GET", path: "/api/incidents/{id}/tasks", tag: "Incidents", summary: "List an incident's tasks", response: apiList{Task{}}},
+	{method: "POST", path: "/api/incidents/{id}/tasks", tag: "Incidents", summary: "Add a task", request: TaskInput{}, status: http.StatusCreated, response: Incident{}},
+	{method: "PUT", path: "/api/incidents/{id}/tasks/{taskId}", tag: "Incidents", summary: "Update a task", request: TaskUpdate{}, response: Incident{}},
+	{method: "GET", path: "/api/incidents/{id}/timeline", tag: "Incidents", summary: "Get an incident's timeline", query: []string{"order"}},
+	{method: "GET", path: "/api/incidents/{id}/fields/{name}/history", tag: "Incidents", summary: "Get a field's change history"},
+	{method: "POST", path: "/api/incidents/{id}/claim", tag: "Incidents", summary: "Claim an incident from the queue", response: Incident{}},
+	{method: "POST", path: "/api/incidents/{id}/undo", tag: "Incidents", summary: "Undo the caller's last change", response: UndoResult{}},
+	{method: "POST", path: "/api/incidents/{id}/merge", tag: "Incidents", summary: "Merge incidents into this one", request: MergeInput{}, response: MergeResult{}},
+	{method: "GET", path: "/api/incidents/{id}/links", tag: "Incidents", summary: "Get the linked incident graph", query: []string{"depth"}, response: LinkGraph{}},
+	{method: "POST", path: "/api/incidents/{id}/links", tag: "Incidents", summary: "Link another incident", request: LinkInput{}, status: http.StatusCreated, response: Incident{}},
+	{method: "DELETE", path: "/api/incidents/{id}/links/{otherId}", tag: "Incidents", summary: "Remove a link", query: []string{"type"}, response: Incident{}},
+	{method: "GET", path: "/api/incidents/{id}/enrichments", tag: "Incidents", summary: "List an incident's enrichments", response: apiList{Enrichment{}}},
+	{method: "POST", path: "/api/incidents/{id}/enrichments", tag: "Incidents", summary: "Re-run enrichment", query: []string{"refresh"}, response: Incident{}},
+	{method: "GET", path: "/api/incidents/{id}/summary", tag: "Incidents", summary: "Get the generated summary", response: IncidentSummary{}},
+	{method: "POST", path: "/api/incidents/{id}/summary", tag: "Incidents", summary: "Regenerate the summary", response: IncidentSummary{}},
+	{method: "GET", path: "/api/incidents/{id}/executive-summary", tag: "Incidents", summary: "Get the executive summary of a major incident", response: ExecutiveSummary{}},
+	{method: "POST", path: "/api/incidents/{id}/sitrep", tag: "Incidents", summary: "Generate a situation report", request: SitrepInput{}, response: Sitrep{}},
+	{method: "GET", path: "/api/incidents/{id}/warroom", tag: "Incidents", summary: "Get the incident's war room", response: WarRoom{}},
+	{method: "POST", path: "/api/incidents/{id}/warroom", tag: "Incidents", summary: "Open a war room", request: WarRoomInput{}, status: http.StatusCreated, response: Incident{}},
+	{method: "GET", path: "/api/incidents/{id}/access-log", tag: "Incidents", summary: "List who viewed an incident", response: apiList{AccessEntry{}}},
+	{method: "POST", path: "/api/incidents/{id}/access-log/review", tag: "Incidents", summary: "Record an access log review", request: AccessReviewInput{}, response: Incident{}},
+	{method: "GET", path: "/api/incidents/{id}/attachments", tag: "Attachments", summary: "List attachments", query: []string{"noteId"}, response: apiList{Attachment{}}},
+	{method: "POST", path: "/api/incidents/{id}/attachments", tag: "Attachments", summary: "Upload an attachment as multipart/form-data", status: http.StatusCreated, response: Attachment{}},
+	{method: "GET", path: "/api/incidents/{id}/attachments/{attachmentId}", tag: "Attachments", summary: "Download an attachment"},
+	{method: "DELETE", path: "/api/incidents/{id}/attachments/{attachmentId}", tag: "Attachments", summary: "Delete an attachment", status: http.StatusNoContent},
+	{method: "GET", path: "/api/incidents/{id}/evidence", tag: "Evidence", summary: "List evidence", response: apiList{Evidence{}}},
+	{method: "POST", path: "/api/incidents/{id}/evidence", tag: "Evidence", summary: "Register evidence", request: EvidenceInput{}, status: http.StatusCreated, response: Evidence{}},
+	{method: "GET", path: "/api/incidents/{id}/evidence/{evidenceId}", tag: "Evidence", summary: "Get evidence", response: Evidence{}},
+	{method: "GET", path: "/api/incidents/{id}/evidence/{evidenceId}/custody", tag: "Evidence", summary: "Get the chain of custody"},
+	{method: "POST", path: "/api/incidents/{id}/evidence/{evidenceId}/custody", tag: "Evidence", summary: "Record a custody transfer", request: CustodyInput{}, response: Evidence{}},
+	{method: "GET", path: "/api/queue", tag: "Incidents", summary: "Get the triage queue", response: apiList{Incident{}}},
+	{method: "GET", path: "/api/stats", tag: "Incidents", summary: "Get incident statistics", response: IncidentStats{}},
+	{method: "GET", path: "/api/tags", tag: "Incidents", summary: "List tags with counts", response: apiList{TagUsage{}}},
+	{method: "POST", path: "/api/tags/rename", tag: "Incidents", summary: "Rename a tag", request: TagRenameInput{}, response: TagChangeResult{}},
+	{method: "POST", path: "/api/tags/merge", tag: "Incidents", summary: "Merge tags", request: TagMergeInput{}, response: TagChangeResult{}},
+	{method: "DELETE", path: "/api/tags/{tag}", tag: "Incidents", summary: "Remove a tag from every incident", response: TagChangeResult{}},
+	{method: "GET", path: "/api/suggest", tag: "Incidents", summary: "Suggest tags or owners", query: []string{"field", "prefix", "limit"}},
+	{method: "POST", path: "/api/notes/bulk", tag: "Incidents", summary: "Add a note to several incidents", request: BulkNoteInput{}, response: BulkNoteResult{}},
+	{method: "POST", path: "/api/query/translate", tag: "Incidents", summary: "Translate a question into a query", request: TranslateInput{}, response: TranslateResult{}},
+	{method: "GET", path: "/api/iocs/{value}/incidents", tag: "Incidents", summary: "List incidents with an IOC"},
+	{method: "GET", path: "/api/iocs/geo", tag: "Incidents", summary: "Count IOCs by country", query: []string{"q"}, response: apiList{GeoCount{}}},
+
+	{method: "GET", path: "/api/incidents/changes", tag: "Change feed", summary: "Long-poll for incident changes", query: []string{"since", "wait"}},
+	{method: "GET", path: "/api/events/stream", tag: "Change feed", summary: "Stream incident changes as Server-Sent Events", query: []string{"lastEventId"}},
+	{method: "GET", path: "/api/ws", tag: "Change feed", summary: "Stream incident changes over a WebSocket"},
+
+	{method: "GET", path: "/api/graphql", tag: "GraphQL", summary: "Run a GraphQL query", query: []string{"query", "operationName", "variables"}, response: GraphQLResponse{}},
+	{method: "POST", path: "/api/graphql", tag: "GraphQL", summary: "Run a GraphQL query", request: GraphQLRequest{}, response: GraphQLResponse{}},
+	{method: "GET", path: "/api/graphql/schema", tag: "GraphQL", summary: "Get the GraphQL schema"},
+
+	{method: "GET", path: "/api/cases", tag: "Cases", summary: "List cases", query: []string{"status"}, response: apiList{CaseView{}}},
+	{method: "POST", path: "/api/cases", tag: "Cases", summary: "Create a case", request: CaseInput{}, status: http.StatusCreated, response: CaseView{}},
+	{method: "GET", path: "/api/cases/{id}", tag: "Cases", summary: "Get a case", response: CaseView{}},
+	{method: "PUT", path: "/api/cases/{id}", tag: "Cases", summary: "Update a case", request: CaseInput{}, response: CaseView{}},
+	{method: "DELETE", path: "/api/cases/{id}", tag: "Cases", summary: "Delete a case", status: http.StatusNoContent},
+	{method: "POST", path: "/api/cases/{id}/incidents", tag: "Cases", summary: "Add incidents to a case", request: struct {
+		IncidentIDs []string `json:"incidentIds"`
+	}{}, response: CaseView{}},
+	{method: "DELETE", path: "/api/cases/{id}/incidents/{incidentId}", tag: "Cases", summary: "Remove an incident from a case", status: http.StatusNoContent},
+	{method: "GET", path: "/api/cases/{id}/members", tag: "Cases", summary: "List case members", response: apiList{CaseMember{}}},
+	{method: "PUT", path: "/api/cases/{id}/members/{userId}", tag: "Cases", summary: "Add or update a case member", request: CaseMemberInput{}, response: CaseView{}},
+	{method: "DELETE", path: "/api/cases/{id}/members/{userId}", tag: "Cases", summary: "Remove a case member", response: CaseView{}},
+	{method: "GET", path: "/api/cases/{id}/report", tag: "Cases", summary: "Get the case report", query: []string{"render"}, response: CaseReport{}},
+	{method: "PUT", path: "/api/cases/{id}/report", tag: "Cases", summary: "Replace the case report", request: CaseReportInput{}, response: CaseReport{}},
+	{method: "GET", path: "/api/cases/{id}/evidence", tag: "Cases", summary: "List evidence across the case's incidents", response: apiList{Evidence{}}},
+
+	{method: "GET", path: "/api/campaigns", tag: "Campaigns", summary: "List campaigns", response: apiList{CampaignView{}}},
+	{method: "POST", path: "/api/campaigns", tag: "Campaigns", summary: "Create a campaign", request: CampaignInput{}, status: http.StatusCreated, response: Campaign{}},
+	{method: "GET", path: "/api/campaigns/{id}", tag: "Campaigns", summary: "Get a campaign with its timeline", response: CampaignView{}},
+	{method: "PUT", path: "/api/campaigns/{id}", tag: "Campaigns", summary: "Update a campaign", request: CampaignInput{}, response: CampaignView{}},
+	{method: "DELETE", path: "/api/campaigns/{id}", tag: "Campaigns", summary: "Delete a campaign", status: http.StatusNoContent},
+	{method: "POST", path: "/api/campaigns/{id}/incidents", tag: "Campaigns", summary: "Add incidents to a campaign", request: struct {
+		IncidentIDs []string `json:"incidentIds"`
+	}{}, response: CampaignView{}},
+	{method: "DELETE", path: "/api/campaigns/{id}/incidents/{incidentId}", tag: "Campaigns", summary: "Remove an incident from a campaign", status: http.StatusNoContent},
+
+	{method: "POST", path: "/api/alerts", tag: "Alerts", summary: "Ingest one alert or a batch", query: []string{"source"}, response: AlertResult{}},
+	{method: "POST", path: "/api/alerts/elastic", tag: "Alerts", summary: "Ingest Elastic Security alerts", response: apiList{AlertResult{}}},
+	{method: "GET", path: "/api/alerts/mappings", tag: "Alerts", summary: "List alert mappings", response: apiList{AlertMapping{}}},
+	{method: "GET", path: "/api/alerts/mappings/{source}", tag: "Alerts", summary: "Get a source's alert mapping", response: AlertMapping{}},
+	{method: "PUT", path: "/api/alerts/mappings/{source}", tag: "Alerts", summary: "Set a source's alert mapping", request: AlertMapping{}, response: AlertMapping{}},
+	{method: "DELETE", path: "/api/alerts/mappings/{source}", tag: "Alerts", summary: "Delete a source's alert mapping", status: http.StatusNoContent},
+	{method: "POST", path: "/services/collector/event", tag: "Alerts", summary: "Ingest Splunk HEC events"},
+	{method: "GET", path: "/services/collector/health", tag: "Alerts", summary: "Splunk HEC health check"},
+
+	{method: "GET", path: "/api/rules", tag: "Detection rules", summary: "List rules", response: apiList{Rule{}}},
+	{method: "POST", path: "/api/rules", tag: "Detection rules", summary: "Create a rule", request: RuleInput{}, status: http.StatusCreated, response: Rule{}},
+	{method: "GET", path: "/api/rules/{id}", tag: "Detection rules", summary: "Get a rule", response: Rule{}},
+	{method: "PUT", path: "/api/rules/{id}", tag: "Detection rules", summary: "Update a rule", request: RuleInput{}, response: Rule{}},
+	{method: "DELETE", path: "/api/rules/{id}", tag: "Detection rules", summary: "Delete a rule", status: http.StatusNoContent},
+	{method: "POST", path: "/api/rules/evaluate", tag: "Detection rules", summary: "Evaluate rules against an event", request: RuleEvaluationInput{}, response: RuleEvaluationResult{}},
+	{method: "GET", path: "/api/rules/noisiest", tag: "Detection rules", summary: "List the rules closed as false positives most", query: []string{"weeks", "limit"}},
+	{method: "GET", path: "/api/auto-tag-rules", tag: "Detection rules", summary: "List auto-tag rules", response: apiList{AutoTagRule{}}},
+	{method: "POST", path: "/api/auto-tag-rules", tag: "Detection rules", summary: "Create an auto-tag rule", request: AutoTagRuleInput{}, status: http.StatusCreated, response: AutoTagRule{}},
+	{method: "GET", path: "/api/auto-tag-rules/{id}", tag: "Detection rules", summary: "Get an auto-tag rule", response: AutoTagRule{}},
+	{method: "PUT", path: "/api/auto-tag-rules/{id}", tag: "Detection rules", summary: "Update an auto-tag rule", request: AutoTagRuleInput{}, response: AutoTagRule{}},
+	{method: "DELETE", path: "/api/auto-tag-rules/{id}", tag: "Detection rules", summary: "Delete an auto-tag rule", status: http.StatusNoContent},
+	{method: "GET", path: "/api/watchlists", tag: "Detection rules", summary: "List watchlists", response: apiList{Watchlist{}}},
+	{method: "POST", path: "/api/watchlists", tag: "Detection rules", summary: "Create a watchlist", request: WatchlistInput{}, status: http.StatusCreated, response: Watchlist{}},
+	{method: "GET", path: "/api/watchlists/{id}", tag: "Detection rules", summary: "Get a watchlist", response: Watchlist{}},
+	{method: "PUT", path: "/api/watchlists/{id}", tag: "Detection rules", summary: "Update a watchlist", request: WatchlistInput{}, response: Watchlist{}},
+	{method: "DELETE", path: "/api/watchlists/{id}", tag: "Detection rules", summary: "Delete a watchlist", status: http.StatusNoContent},
+	{method: "GET", path: "/api/feeds", tag: "Detection rules", summary: "List threat intel feeds", response: apiList{Feed{}}},
+	{method: "POST", path: "/api/feeds", tag: "Detection rules", summary: "Add a feed", request: FeedInput{}, status: http.StatusCreated, response: Feed{}},
+	{method: "GET", path: "/api/feeds/{id}", tag: "Detection rules", summary: "Get a feed", response: Feed{}},
+	{method: "PUT", path: "/api/feeds/{id}", tag: "Detection rules", summary: "Update a feed", request: FeedInput{}, response: Feed{}},
+	{method: "DELETE", path: "/api/feeds/{id}", tag: "Detection rules", summary: "Delete a feed", status: http.StatusNoContent},
+	{method: "POST", path: "/api/feeds/{id}/refresh", tag: "Detection rules", summary: "Fetch a feed now", response: Feed{}},
+
+	{method: "GET", path: "/api/templates", tag: "Configuration", summary: "List incident templates", response: apiList{IncidentTemplate{}}},
+	{method: "POST", path: "/api/templates", tag: "Configuration", summary: "Create an incident template", request: IncidentTemplateInput{}, status: http.StatusCreated, response: IncidentTemplate{}},
+	{method: "GET", path: "/api/templates/{id}", tag: "Configuration", summary: "Get an incident template", response: IncidentTemplate{}},
+	{method: "PUT", path: "/api/templates/{id}", tag: "Configuration", summary: "Update an incident template", request: IncidentTemplateInput{}, response: IncidentTemplate{}},
+	{method: "DELETE", path: "/api/templates/{id}", tag: "Configuration", summary: "Delete an incident template", status: http.StatusNoContent},
+	{method: "GET", path: "/api/export-presets", tag: "Configuration", summary: "List the caller's export presets", response: apiList{ExportPreset{}}},
+	{method: "POST", path: "/api/export-presets", tag: "Configuration", summary: "Save an export preset", request: ExportPresetInput{}, status: http.StatusCreated, response: ExportPreset{}},
+	{method: "GET", path: "/api/export-presets/{id}", tag: "Configuration", summary: "Get an export preset", response: ExportPreset{}},
+	{method: "PUT", path: "/api/export-presets/{id}", tag: "Configuration", summary: "Update an export preset", request: ExportPresetInput{}, response: ExportPreset{}},
+	{method: "DELETE", path: "/api/export-presets/{id}", tag: "Configuration", summary: "Delete an export preset", status: http.StatusNoContent},
+	{method: "GET", path: "/api/export-presets/{id}/export", tag: "Configuration", summary: "Run an export preset"},
+	{method: "GET", path: "/api/escalations", tag: "Configuration", summary: "List escalation rules", response: apiList{EscalationRule{}}},
+	{method: "POST", path: "/api/escalations", tag: "Configuration", summary: "Create an escalation rule", request: EscalationRuleInput{}, status: http.StatusCreated, response: EscalationRule{}},
+	{method: "GET", path: "/api/escalations/{id}", tag: "Configuration", summary: "Get an escalation rule", response: EscalationRule{}},
+	{method: "PUT", path: "/api/escalations/{id}", tag: "Configuration", summary: "Update an escalation rule", request: EscalationRuleInput{}, response: EscalationRule{}},
+	{method: "DELETE", path: "/api/escalations/{id}", tag: "Configuration", summary: "Delete an escalation rule", status: http.StatusNoContent},
+	{method: "GET", path: "/api/routing", tag: "Configuration", summary: "Get the routing configuration", response: RoutingConfig{}},
+	{method: "PUT", path: "/api/routing", tag: "Configuration", summary: "Replace the routing configuration", request: RoutingConfig{}, response: RoutingConfig{}},
+	{method: "POST", path: "/api/routing/preview", tag: "Configuration", summary: "Preview how an incident would be routed", request: RoutingPreview{}},
+	{method: "GET", path: "/api/settings", tag: "Configuration", summary: "Get settings", response: Settings{}},
+	{method: "PUT", path: "/api/settings", tag: "Configuration", summary: "Update settings", request: SettingsInput{}, response: Settings{}},
+	{method: "GET", path: "/api/config/taxonomies", tag: "Configuration", summary: "Get severities and statuses", response: Taxonomies{}},
+	{method: "PUT", path: "/api/config/taxonomies", tag: "Configuration", summary: "Replace severities and statuses", request: Taxonomies{}, response: Taxonomies{}},
+	{method: "GET", path: "/api/sla-policies", tag: "Configuration", summary: "List SLA policies"},
+
+	{method: "GET", path: "/api/users", tag: "Users and teams", summary: "List users", query: []string{"team", "active", "sort"}, response: apiList{UserView{}}},
+	{method: "POST", path: "/api/users", tag: "Users and teams", summary: "Add a user", request: UserInput{}, status: http.StatusCreated, response: User{}},
+	{method: "GET", path: "/api/users/{id}", tag: "Users and teams", summary: "Get a user", response: UserView{}},
+	{method: "PUT", path: "/api/users/{id}", tag: "Users and teams", summary: "Update a user", request: UserInput{}, response: User{}},
+	{method: "POST", path: "/api/users/{id}/deactivate", tag: "Users and teams", summary: "Deactivate a user and hand off their incidents", response: DeactivationResult{}},
+	{method: "GET", path: "/api/teams", tag: "Users and teams", summary: "List teams", response: apiList{TeamView{}}},
+	{method: "POST", path: "/api/teams", tag: "Users and teams", summary: "Create a team", request: TeamInput{}, status: http.StatusCreated, response: TeamView{}},
+	{method: "GET", path: "/api/teams/{id}", tag: "Users and teams", summary: "Get a team", response: TeamView{}},
+	{method: "PUT", path: "/api/teams/{id}", tag: "Users and teams", summary: "Update a team", request: TeamInput{}, response: TeamView{}},
+	{method: "DELETE", path: "/api/teams/{id}", tag: "Users and teams", summary: "Delete a team", status: http.StatusNoContent},
+	{method: "PUT", path: "/api/teams/{id}/members/{userId}", tag: "Users and teams", summary: "Move a user into a team", request: TeamMemberInput{}, response: TeamView{}},
+	{method: "DELETE", path: "/api/teams/{id}/members/{userId}", tag: "Users and teams", summary: "Remove a user from a team", response: TeamView{}},
+
+	{method: "GET", path: "/api/webhooks", tag: "Integrations", summary: "List webhooks", response: apiList{Webhook{}}},
+	{method: "POST", path: "/api/webhooks", tag: "Integrations", summary: "Register a webhook", request: WebhookInput{}, status: http.StatusCreated, response: WebhookWithSecret{}},
+	{method: "GET", path: "/api/webhooks/{id}", tag: "Integrations", summary: "Get a webhook", response: Webhook{}},
+	{method: "PUT", path: "/api/webhooks/{id}", tag: "Integrations", summary: "Update a webhook", request: WebhookInput{}, response: Webhook{}},
+	{method: "DELETE", path: "/api/webhooks/{id}", tag: "Integrations", summary: "Delete a webhook", status: http.StatusNoContent},
+	{method: "GET", path: "/api/webhooks/{id}/deliveries", tag: "Integrations", summary: "List recent deliveries", response: apiList{WebhookDelivery{}}},
+	{method: "GET", path: "/api/webhooks/schemas", tag: "Integrations", summary: "List webhook payload schemas", response: apiList{WebhookSchema{}}},
+	{method: "GET", path: "/api/webhooks/schemas/{event}", tag: "Integrations", summary: "Get an event's payload schema as JSON Schema"},
+	{method: "GET", path: "/api/integrations/teams", tag: "Integrations", summary: "Get the Microsoft Teams routes", response: TeamsRoutes{}},
+	{method: "PUT", path: "/api/integrations/teams", tag: "Integrations", summary: "Replace the Microsoft Teams routes", request: TeamsRoutes{}, response: TeamsRoutes{}},
+	{method: "POST", path: "/api/integrations/slack/actions", tag: "Integrations", summary: "Slack interactivity request URL"},
+
+	{method: "GET", path: "/api/admin/apikeys", tag: "Administration", summary: "List API keys", response: apiList{APIKey{}}},
+	{method: "POST", path: "/api/admin/apikeys", tag: "Administration", summary: "Issue an API key", request: APIKeyInput{}, status: http.StatusCreated, response: APIKeyWithSecret{}},
+	{method: "GET", path: "/api/admin/apikeys/{id}", tag: "Administration", summary: "Get an API key", response: APIKey{}},
+	{method: "DELETE", path: "/api/admin/apikeys/{id}", tag: "Administration", summary: "Revoke an API key", response: APIKey{}},
+	{method: "GET", path: "/api/service-identities", tag: "Administration", summary: "List service identities", response: apiList{ServiceIdentity{}}},
+	{method: "POST", path: "/api/service-identities", tag: "Administration", summary: "Create a service identity", request: ServiceIdentityInput{}, status: http.StatusCreated, response: ServiceIdentityWithKey{}},
+	{method: "GET", path: "/api/service-identities/{id}", tag: "Administration", summary: "Get a service identity", response: ServiceIdentity{}},
+	{method: "PUT", path: "/api/service-identities/{id}", tag: "Administration", summary: "Update a service identity", request: ServiceIdentityInput{}, response: ServiceIdentity{}},
+	{method: "DELETE", path: "/api/service-identities/{id}", tag: "Administration", summary: "Disable a service identity", response: ServiceIdentity{}},
+	{method: "POST", path: "/api/service-identities/{id}/rotate", tag: "Administration", summary: "Rotate a service identity's key", response: ServiceIdentityWithKey{}},
+	{method: "GET", path: "/api/admin/purges", tag: "Administration", summary: "List purge requests", response: apiList{PurgeRequest{}}},
+	{method: "POST", path: "/api/admin/purges", tag: "Administration", summary: "Request a purge", request: PurgeInput{}, status: http.StatusAccepted, response: PurgeRequest{}},
+	{method: "GET", path: "/api/admin/purges/{id}", tag: "Administration", summary: "Get a purge request", response: PurgeRequest{}},
+	{method: "DELETE", path: "/api/admin/purges/{id}", tag: "Administration", summary: "Cancel a purge request", response: PurgeRequest{}},
+	{method: "POST", path: "/api/admin/purges/{id}/confirm", tag: "Administration", summary: "Confirm a purge as the second admin", response: PurgeRequest{}},
+	{method: "GET", path: "/api/admin/hygiene", tag: "Administration", summary: "Report data hygiene problems", response: HygieneReport{}},
+	{method: "GET", path: "/api/admin/search-sink", tag: "Administration", summary: "Get search index sync status", response: SearchSinkStatus{}},
+	{method: "POST", path: "/api/admin/search-sink", tag: "Administration", summary: "Reindex every incident", status: http.StatusAccepted},
+	{method: "GET", path: "/api/audit", tag: "Administration", summary: "Query the audit log", query: []string{"actor", "incidentId", "action", "since", "until", "limit"}, response: apiList{AuditRecord{}}},
+	{method: "GET", path: "/api/audit/verify", tag: "Administration", summary: "Verify the audit log's hash chain", response: AuditVerification{}},
+
+	{method: "GET", path: "/api/session", tag: "Sessions", summary: "Get the caller and their CSRF token", response: SessionView{}},
+	{method: "DELETE", path: "/api/session", tag: "Sessions", summary: "End the caller's session", status: http.StatusNoContent},
+	{method: "GET", path: "/auth/login", tag: "Sessions", summary: "Start single sign-on", query: []string{"next"}, status: http.StatusFound},
+	{method: "GET", path: "/auth/callback", tag: "Sessions", summary: "Single sign-on callback", query: []string{"code", "state", "error"}, status: http.StatusFound},
+	{method: "POST", path: "/auth/ldap", tag: "Sessions", summary: "Log in with a directory password", request: LDAPLoginInput{}, response: SessionView{}},
+	{method: "POST", path: "/auth/logout", tag: "Sessions", summary: "Log out", status: http.StatusFound},
+
+	{method: "GET", path: "/api/version", tag: "Server", summary: "Get the running version", response: VersionInfo{}},
+	{method: "GET", path: "/api/demo", tag: "Server", summary: "Get the demo mode tour", response: DemoGuide{}},
+	{method: "GET", path: "/api/openapi.json", tag: "Server", summary: "Get this document"},
+	{method: "GET", path: "/api/docs", tag: "Server", summary: "Browse this document"},
+	{method: "GET", path: "/metrics", tag: "Server", summary: "Prometheus metrics"},
+}
+
+// openAPIDocument builds the OpenAPI 3.1 document for apiOperations.
+// OpenAPI 3.1 schemas are JSON Schema, so jsonSchemaFor describes the
+// bodies; its named types become the document's components.
+func openAPIDocument() map[string]any {
+	defs := map[string]any{}
+	paths := map[string]any{}
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, op := range apiOperations {
+		item, ok := paths[op.path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[op.path] = item
+		}
+		if !seen[op.tag] {
+			seen[op.tag] = true
+			tags = append(tags, op.tag)
+		}
+		item[strings.ToLower(op.method)] = openAPIOperation(op, defs)
+	}
+	tagObjects := []any{}
+	for _, tag := range tags {
+		tagObjects = append(tagObjects, map[string]any{"name": tag})
+	}
+	document := map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "SOC Backend API",
+			"version": version,
+		},
+		"tags":  tagObjects,
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": defs,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "An API key, a service identity's key, or a JWT from the identity provider.",
+				},
+				"session": map[string]any{
+					"type":        "apiKey",
+					"in":          "cookie",
+					"name":        sessionCookie,
+					"description": "The browser session from single sign-on; writes also need the " + csrfHeader + " header.",
+				},
+			},
+		},
+		"security": []any{
+			map[string]any{"bearer": []any{}},
+			map[string]any{"session": []any{}},
+		},
+	}
+	rebaseSchemaRefs(document)
+	return document
+}
+
+var pathParameter = regexp.MustCompile(`\{([^}]+)\}`)
+
+func openAPIOperation(op apiOperation, defs map[string]any) map[string]any {
+	operation := map[string]any{
+		"tags":        []string{op.tag},
+		"summary":     op.summary,
+		"operationId": operationID(op),
+	}
+	parameters := []any{}
+	for _, match := range pathParameter.FindAllStringSubmatch(op.path, -1) {
+		parameters = append(parameters, map[string]any{
+			"name": match[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+		})
+	}
+	for _, name := range op.query {
+		parameters = append(parameters, map[string]any{
+			"name": name, "in": "query", "schema": map[string]any{"type": "string"},
+		})
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	if op.request != nil {
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": bodySchema(op.request, defs)}},
+		}
+	}
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := map[string]any{"description": http.StatusText(status)}
+	if op.response != nil {
+		response["content"] = map[string]any{"application/json": map[string]any{"schema": bodySchema(op.response, defs)}}
+	}
+	operation["responses"] = map[string]any{
+		strconv.Itoa(status): response,
+		"default": map[string]any{
+			"description": "An error",
+			"content": map[string]any{"application/json": map[string]any{"schema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"error": map[string]any{"type": "string"}, "requestId": map[string]any{"type": "string"}},
+			}}},
+		},
+	}
+	return operation
+}
+
+func bodySchema(body any, defs map[string]any) map[string]any {
+	if list, ok := body.(apiList); ok {
+		return map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"items": map[string]any{"type": "array", "items": jsonSchemaFor(reflect.TypeOf(list.item), defs)}},
+			"required":   []string{"items"},
+		}
+	}
+	return jsonSchemaFor(reflect.TypeOf(body), defs)
+}
+
+// operationID names an operation for generated clients, e.g. GET
+// /api/incidents/{id}/notes becomes getIncidentsIdNotes.
+func operationID(op apiOperation) string {
+	name := strings.ToLower(op.method)
+	path := strings.TrimPrefix(strings.TrimPrefix(op.path, "/api"), "/")
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		name += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return name
+}
+
+// rebaseSchemaRefs points jsonSchemaFor's #/$defs references at the
+// document's components.
+func rebaseSchemaRefs(value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if ref, ok := item.(string); ok && key == "$ref" {
+				v[key] = "#/components/schemas/" + strings.TrimPrefix(ref, "#/$defs/")
+				continue
+			}
+			rebaseSchemaRefs(item)
+		}
+	case []any:
+		for _, item := range v {
+			rebaseSchemaRefs(item)
+		}
+	}
+}
+
+var openAPIJSON = sync.OnceValue(openAPIDocument)
+
+// openAPIHandler serves GET /api/openapi.json.
+func openAPIHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, openAPIJSON())
+	}
+}
+
+var apiDocsPage = template.Must(template.New("docs").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>SOC Backend API</title>
+<link rel="stylesheet" href="{{.}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.}}/swagger-ui-bundle.js"></script>
+<script>
+SwaggerUIBundle({url: "/api/openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`))
+
+// apiDocsHandler serves GET /api/docs, Swagger UI over the document. The UI
+// itself loads from SWAGGER_UI_URL, a CDN by default; point it at a copy of
+// swagger-ui-dist for networks that can't reach one.
+func apiDocsHandler() http.HandlerFunc {
+	assets := strings.TrimSuffix(envString("SWAGGER_UI_URL", "https://unpkg.com/swagger-ui-dist@5"), "/")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		apiDocsPage.Execute(w, assets)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// opsgenieTarget raises Opsgenie alerts from notifications. The alias is the
+// incident ID, so Opsgenie folds repeat notifications about an incident into
+// one alert, and that alert is closed once the incident is.
+type opsgenieTarget struct {
+	client     *http.Client
+	url        string
+	apiKey     string
+	priorities map[string]string
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Priority    string            `json:"priority"`
+	Source      string            `json:"source"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// newOpsgenieTarget returns nil unless OPSGENIE_API_KEY is set.
+func newOpsgenieTarget() *opsgenieTarget {
+	apiKey := envString("OPSGENIE_API_KEY", "")
+	if apiKey == "" {
+		return nil
+	}
+	return &opsgenieTarget{
+		client:     newOutboundClient(),
+		url:        strings.TrimRight(envString("OPSGENIE_API_URL", "https://api.opsgenie.com"), "/"),
+		apiKey:     apiKey,
+		priorities: parseOpsgeniePriorities(envString("OPSGENIE_PRIORITIES", "critical=P1,high=P2,medium=P3,low=P4")),
+	}
+}
+
+// parseOpsgeniePriorities reads severity=priority pairs such as
+// critical=P1,high=P2.
+func parseOpsgeniePriorities(value string) map[string]string {
+	priorities := map[string]string{}
+	for _, entry := range sanitizeSlice(strings.Split(value, ",")) {
+		severity, priority, ok := strings.Cut(entry, "=")
+		priority = strings.ToUpper(strings.TrimSpace(priority))
+		if !ok || len(priority) != 2 || priority[0] != 'P' || priority[1] < '1' || priority[1] > '5' {
+			log.Printf("ignoring Opsgenie priority %q: want severity=P1..P5, e.g. critical=P1", entry)
+			continue
+		}
+		priorities[strings.ToLower(strings.TrimSpace(severity))] = priority
+	}
+	return priorities
+}
+
+func (o *opsgenieTarget) name() string { return "opsgenie" }
+
+func (o *opsgenieTarget) priority(severity string) string {
+	return fallback(o.priorities[strings.ToLower(normalizeSeverity(severity))], "P3")
+}
+
+func (o *opsgenieTarget) alertURL(alias, action string) string {
+	return o.url + "/v2/alerts/" + url.PathEscape(alias) + "/" + action + "?identifierType=alias"
+}
+
+func (o *opsgenieTarget) send(ctx context.Context, notification Notification) error {
+	headers := map[string]string{"Authorization": "GenieKey " + o.apiKey}
+	incident := notification.Incident
+	if incident.ID == "" {
+		return nil
+	}
+	if isClosedStatus(incident.Status) {
+		payload := map[string]string{"source": "soc-backend", "note": notification.Message}
+		return doJSON(ctx, o.client, http.MethodPost, o.alertURL(incident.ID, "close"), headers, payload, nil)
+	}
+
+	priority := o.priority(incident.Severity)
+	// Opsgenie rejects messages over 130 characters.
+	message := []rune(incident.ID + ": " + fallback(incident.Title, "restricted case"))
+	if len(message) > 130 {
+		message = append(message[:129], '…')
+	}
+	alert := opsgenieAlert{
+		Message:     string(message),
+		Alias:       incident.ID,
+		Description: notification.Message,
+		Priority:    priority,
+		Source:      "soc-backend",
+		Tags:        incident.Tags,
+		Details: map[string]string{
+			"event":    notification.Event,
+			"severity": incident.Severity,
+			"status":   incident.Status,
+			"owner":    incident.Owner,
+		},
+	}
+	if err := doJSON(ctx, o.client, http.MethodPost, o.url+"/v2/alerts", headers, alert, nil); err != nil {
+		return err
+	}
+	// Creating an alert whose alias is already open only bumps its count, so
+	// a severity change has to update the priority separately.
+	if notification.Event != eventIncidentUpdated {
+		return nil
+	}
+	return doJSON(ctx, o.client, http.MethodPut, o.alertURL(incident.ID, "priority"), headers, map[string]string{"priority": priority}, nil)
+}
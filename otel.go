@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Span kinds, as numbered by OTLP.
+const (
+	spanInternal = 1
+	spanServer   = 2
+	spanClient   = 3
+
+	// spanBatchSize and spanBatchDelay bound how many spans go in one
+	// export and how long a span waits to be sent.
+	spanBatchSize  = 512
+	spanBatchDelay = 5 * time.Second
+)
+
+// Span is one timed operation within a trace: a request served, a call to
+// another service, or a step worth seeing on its own, such as a store
+// write. A nil *Span is a span that isn't recorded, and all its methods do
+// nothing, so callers need not check whether tracing is on.
+type Span struct {
+	traceID  string
+	spanID   string
+	parentID string
+	sampled  bool
+	kind     int
+	start    time.Time
+
+	mu     sync.Mutex
+	name   string
+	attrs  map[string]any
+	failed string
+	ended  time.Time
+}
+
+type spanKey struct{}
+
+// spanExporter is the OTLP exporter set at startup, or nil when tracing
+// is off.
+var spanExporter atomic.Pointer[SpanExporter]
+
+// SpanExporter sends finished spans to an OpenTelemetry collector over
+// OTLP/HTTP with the JSON encoding, in batches from a background goroutine.
+type SpanExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	version  string
+	ratio    float64
+	client   *http.Client
+	queue    chan *Span
+	flush    chan struct{}
+	pending  pendingWork
+	dropped  atomic.Uint64
+}
+
+// newSpanExporter reads the standard OTEL_ environment variables,
+// returning nil unless an OTLP endpoint is set.
+func newSpanExporter() *SpanExporter {
+	endpoint := envString("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if endpoint == "" {
+		base := envString("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+	}
+	if protocol := envString("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json"); protocol != "http/json" {
+		log.Printf("otel: OTEL_EXPORTER_OTLP_PROTOCOL=%s is not supported, exporting http/json", protocol)
+	}
+	headers := map[string]string{}
+	for _, pair := range sanitizeSlice(strings.Split(envString("OTEL_EXPORTER_OTLP_HEADERS", ""), ",")) {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			log.Printf("otel: ignoring header %q: want key=value", pair)
+			continue
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	ratio, err := strconv.ParseFloat(envString("OTEL_TRACES_SAMPLER_ARG", "1"), 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		log.Printf("otel: OTEL_TRACES_SAMPLER_ARG must be a ratio from 0 to 1, sampling everything")
+		ratio = 1
+	}
+	return &SpanExporter{
+		endpoint: endpoint,
+		headers:  headers,
+		service:  envString("OTEL_SERVICE_NAME", "soc-backend"),
+		version:  buildInfo().Version,
+		ratio:    ratio,
+		// Not the outbound client: exports must not trace themselves.
+		client: &http.Client{Timeout: envDuration("OTEL_EXPORTER_OTLP_TIMEOUT", 10*time.Second)},
+		queue:  make(chan *Span, envInt("OTEL_BSP_MAX_QUEUE_SIZE", 2048)),
+		flush:  make(chan struct{}, 1),
+	}
+}
+
+func randomHex(n int) string {
+	raw := make([]byte, n)
+	rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
+
+// rootFlags decides whether a trace starting here is sampled. The first
+// eight bytes of the trace ID are random, so comparing them to the ratio
+// samples that share of traces.
+func (e *SpanExporter) rootFlags(traceID string) string {
+	head, _ := strconv.ParseUint(traceID[:16], 16, 64)
+	if float64(head) < e.ratio*math.MaxUint64 || e.ratio == 1 {
+		return "01"
+	}
+	return "00"
+}
+
+// startSpan begins a span beneath the span on ctx, or a new trace if there
+// is none, and returns a context carrying it. It returns a nil span when
+// tracing is off.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	exporter := spanExporter.Load()
+	if exporter == nil {
+		return ctx, nil
+	}
+	trace := traceFrom(ctx)
+	if trace.traceID == "" {
+		trace.traceID = randomHex(16)
+		trace.flags = exporter.rootFlags(trace.traceID)
+	}
+	flags, _ := strconv.ParseUint(trace.flags, 16, 8)
+	span := &Span{
+		traceID:  trace.traceID,
+		spanID:   randomHex(8),
+		parentID: trace.spanID,
+		sampled:  flags&1 == 1,
+		kind:     kind,
+		start:    time.Now(),
+		name:     name,
+		attrs:    map[string]any{},
+	}
+	trace.spanID = span.spanID
+	return context.WithValue(contextWithTrace(ctx, trace), spanKey{}, span), span
+}
+
+// spanFrom is the span ctx's work is part of, if it is recorded.
+func spanFrom(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+func (s *Span) setName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// set records an attribute; values are strings, ints, or bools.
+func (s *Span) set(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// fail marks the span as an error with a description of what went wrong.
+func (s *Span) fail(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.failed = message
+	s.mu.Unlock()
+}
+
+// end finishes the span and queues it for export if its trace is sampled.
+// Spans that end after the queue fills are dropped rather than holding up
+// the request.
+func (s *Span) end() {
+	exporter := spanExporter.Load()
+	if s == nil || exporter == nil {
+		return
+	}
+	s.mu.Lock()
+	already := !s.ended.IsZero()
+	if !already {
+		s.ended = time.Now()
+	}
+	s.mu.Unlock()
+	if already || !s.sampled {
+		return
+	}
+	exporter.pending.add()
+	select {
+	case exporter.queue <- s:
+	default:
+		exporter.pending.done()
+		if exporter.dropped.Add(1)%1000 == 1 {
+			log.Printf("otel: span queue full, dropping spans")
+		}
+	}
+}
+
+func (e *SpanExporter) start() {
+	go func() {
+		ticker := time.NewTicker(spanBatchDelay)
+		defer ticker.Stop()
+		batch := make([]*Span, 0, spanBatchSize)
+		for {
+			select {
+			case span := <-e.queue:
+				batch = append(batch, span)
+				if len(batch) < spanBatchSize {
+					continue
+				}
+			case <-ticker.C:
+			case <-e.flush:
+				// Take whatever was queued before the flush was asked for.
+				for len(e.queue) > 0 && len(batch) < spanBatchSize {
+					batch = append(batch, <-e.queue)
+				}
+			}
+			if len(batch) == 0 {
+				continue
+			}
+			if err := e.export(batch); err != nil {
+				log.Printf("otel: exporting %d spans: %v", len(batch), err)
+			}
+			for range batch {
+				e.pending.done()
+			}
+			batch = batch[:0]
+		}
+	}()
+}
+
+// drain sends the spans queued so far rather than waiting for the next
+// batch, flushing until none are left.
+func (e *SpanExporter) drain(ctx context.Context) int64 {
+	ticker := time.NewTicker(drainPoll)
+	defer ticker.Stop()
+	for {
+		left := e.pending.n.Load()
+		if left <= 0 {
+			return 0
+		}
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+		select {
+		case <-ctx.Done():
+			return left
+		case <-ticker.C:
+		}
+	}
+}
+
+// otlpValue is an OTLP AnyValue. Ints are strings in OTLP's JSON encoding.
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+func otlpAttributes(attrs map[string]any) []otlpAttribute {
+	out := make([]otlpAttribute, 0, len(attrs))
+	for _, key := range sortedKeys(attrs, func(a, b string) bool { return a < b }) {
+		var value otlpValue
+		switch v := attrs[key].(type) {
+		case string:
+			value.StringValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		case bool:
+			value.BoolValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		out = append(out, otlpAttribute{Key: key, Value: value})
+	}
+	return out
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	span := otlpSpan{
+		TraceID:           s.traceID,
+		SpanID:            s.spanID,
+		ParentSpanID:      s.parentID,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.ended.UnixNano(), 10),
+		Attributes:        otlpAttributes(s.attrs),
+	}
+	if s.failed != "" {
+		// 2 is STATUS_CODE_ERROR.
+		span.Status = &otlpStatus{Code: 2, Message: s.failed}
+	}
+	return span
+}
+
+// export POSTs one batch as an ExportTraceServiceRequest.
+func (e *SpanExporter) export(batch []*Span) error {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		spans = append(spans, span.otlp())
+	}
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": map[string]any{"attributes": otlpAttributes(map[string]any{
+				"service.name":    e.service,
+				"service.version": e.version,
+			})},
+			"scopeSpans": []map[string]any{{
+				"scope": map[string]string{"name": "web-app"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(snippet))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pagerDutyTrigger     = "trigger"
+	pagerDutyAcknowledge = "acknowledge"
+	pagerDutyResolve     = "resolve"
+)
+
+// pagerDutySeverities maps incident severities to the Events API's.
+var pagerDutySeverities = map[string]string{
+	"Critical": "critical",
+	"High":     "error",
+	"Medium":   "warning",
+	"Low":      "info",
+}
+
+// PagerDuty pages on incidents at or above a severity through the Events API
+// v2. The dedup key is the incident ID, so every event about one incident
+// lands on the same PagerDuty incident: triggered when it crosses the
+// threshold, acknowledged once it leaves New, and resolved when it closes or
+// drops back below the threshold.
+type PagerDuty struct {
+	client     *http.Client
+	url        string
+	routingKey string
+	source     string
+	minRank    int
+	queue      chan pagerDutyEvent
+	pending    pendingWork
+
+	mu sync.Mutex
+	// sent is the last action sent per incident.
+	sent map[string]string
+}
+
+type pagerDutyEvent struct {
+	Action   string
+	Incident Incident
+}
+
+type pagerDutyPayload struct {
+	RoutingKey  string                 `json:"routing_key"`
+	EventAction string                 `json:"event_action"`
+	DedupKey    string                 `json:"dedup_key"`
+	Payload     *pagerDutyEventPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyEventPayload struct {
+	Summary       string         `json:"summary"`
+	Source        string         `json:"source"`
+	Severity      string         `json:"severity"`
+	Timestamp     time.Time      `json:"timestamp"`
+	Class         string         `json:"class,omitempty"`
+	CustomDetails map[string]any `json:"custom_details,omitempty"`
+}
+
+// newPagerDuty returns nil unless PAGERDUTY_ROUTING_KEY is set.
+func newPagerDuty() *PagerDuty {
+	routingKey := envString("PAGERDUTY_ROUTING_KEY", "")
+	if routingKey == "" {
+		return nil
+	}
+	return &PagerDuty{
+		client:     newOutboundClient(),
+		url:        envString("PAGERDUTY_EVENTS_URL", "https://events.pagerduty.com/v2/enqueue"),
+		routingKey: routingKey,
+		source:     envString("PAGERDUTY_SOURCE", "soc-backend"),
+		minRank:    severityRank(envString("PAGERDUTY_MIN_SEVERITY", "Critical")),
+		queue:      make(chan pagerDutyEvent, envInt("PAGERDUTY_QUEUE_SIZE", 256)),
+		sent:       make(map[string]string),
+	}
+}
+
+// start subscribes to store changes. Events go out from a single worker so
+// PagerDuty sees them in order.
+func (p *PagerDuty) start(store *IncidentStore) {
+	store.subscribe(p.handleEvent)
+	go func() {
+		for event := range p.queue {
+			p.deliver(event)
+			p.pending.done()
+		}
+	}()
+}
+
+// wanted is the state the PagerDuty incident should be in.
+func (p *PagerDuty) wanted(incident Incident) string {
+	switch {
+	case isClosedStatus(incident.Status), severityRank(incident.Severity) < p.minRank:
+		return pagerDutyResolve
+	case !strings.EqualFold(incident.Status, "New"):
+		return pagerDutyAcknowledge
+	}
+	return pagerDutyTrigger
+}
+
+// pagerDutyActions returns what to send to move from the last action sent
+// to the wanted one. An acknowledged page stays acknowledged if the incident
+// goes back to New, since PagerDuty has no way to un-acknowledge.
+func pagerDutyActions(sent, wanted string) []string {
+	paging := sent == pagerDutyTrigger || sent == pagerDutyAcknowledge
+	switch {
+	case sent == wanted:
+		return nil
+	case wanted == pagerDutyResolve:
+		if paging {
+			return []string{pagerDutyResolve}
+		}
+		return nil
+	case !paging && wanted == pagerDutyAcknowledge:
+		return []string{pagerDutyTrigger, pagerDutyAcknowledge}
+	case !paging:
+		return []string{pagerDutyTrigger}
+	case wanted == pagerDutyAcknowledge:
+		return []string{pagerDutyAcknowledge}
+	}
+	return nil
+}
+
+func (p *PagerDuty) handleEvent(event IncidentEvent) {
+	incident := event.Incident
+	wanted := p.wanted(incident)
+	if event.Type == eventIncidentPurged {
+		wanted = pagerDutyResolve
+	}
+
+	p.mu.Lock()
+	actions := pagerDutyActions(p.sent[incident.ID], wanted)
+	if len(actions) > 0 {
+		p.sent[incident.ID] = actions[len(actions)-1]
+	}
+	if event.Type == eventIncidentPurged {
+		delete(p.sent, incident.ID)
+	}
+	p.mu.Unlock()
+
+	for _, action := range actions {
+		p.pending.add()
+		select {
+		case p.queue <- pagerDutyEvent{Action: action, Incident: incident}:
+		default:
+			p.pending.done()
+			log.Printf("pagerduty queue full, dropping %s for %s", action, incident.ID)
+		}
+	}
+}
+
+// payload builds the Events API body. Restricted cases are redacted to
+// their ID and state since PagerDuty reaches people who aren't cleared.
+func (p *PagerDuty) payload(event pagerDutyEvent) pagerDutyPayload {
+	body := pagerDutyPayload{RoutingKey: p.routingKey, EventAction: event.Action, DedupKey: event.Incident.ID}
+	if event.Action != pagerDutyTrigger {
+		return body
+	}
+
+	incident := event.Incident
+	summary := incident.ID + ": " + incident.Title
+	details := map[string]any{
+		"incidentId": incident.ID,
+		"status":     incident.Status,
+		"owner":      incident.Owner,
+		"tags":       incident.Tags,
+	}
+	if incident.Restricted {
+		summary = "Restricted case " + incident.ID
+		details = map[string]any{"incidentId": incident.ID, "status": incident.Status, "restricted": true}
+	}
+	body.Payload = &pagerDutyEventPayload{
+		Summary:       summary,
+		Source:        p.source,
+		Severity:      fallback(pagerDutySeverities[normalizeSeverity(incident.Severity)], "critical"),
+		Timestamp:     incident.UpdatedAt,
+		Class:         incident.Type,
+		CustomDetails: details,
+	}
+	return body
+}
+
+func (p *PagerDuty) deliver(event pagerDutyEvent) {
+	ctx, cancel := context.WithTimeout(contextWithTrace(context.Background(), event.Incident.trace), 15*time.Second)
+	defer cancel()
+	if err := doJSON(ctx, p.client, http.MethodPost, p.url, nil, p.payload(event), nil); err != nil {
+		log.Printf("pagerduty %s for %s: %v", event.Action, event.Incident.ID, err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// pprofMux serves the runtime profiles under /debug/pprof/.
+func pprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// pprofHandler serves the profiles on the main port to admins, for
+// deployments where a second port can't be reached.
+func pprofHandler() http.HandlerFunc {
+	profiles := pprofMux()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		// CPU profiles and traces run for as long as ?seconds= asks.
+		clearWriteDeadline(w)
+		profiles.ServeHTTP(w, r)
+	}
+}
+
+// startPprofServer serves the profiles on their own listener, unauthenticated,
+// so addr should be one only operators can reach, such as localhost:6060.
+func startPprofServer(addr string) {
+	go func() {
+		log.Printf("pprof listening on %s", addr)
+		server := &http.Server{Addr: addr, Handler: pprofMux(), ReadHeaderTimeout: 10 * time.Second}
+		if err := server.ListenAndServe(); err != nil {
+			log.Printf("pprof: %v", err)
+		}
+	}()
+}
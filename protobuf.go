@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Protocol buffer wire types.
+const (
+	protoVarint = iota
+	protoFixed64
+	protoBytes
+	protoFixed32 = 5
+)
+
+// protoMessage is a message being encoded in the protobuf wire format.
+// Fields holding their type's zero value are left out, as proto3 does.
+type protoMessage []byte
+
+func (m *protoMessage) tag(field, wire int) {
+	*m = binary.AppendUvarint(*m, uint64(field)<<3|uint64(wire))
+}
+
+func (m *protoMessage) bytes(field int, value []byte) {
+	m.tag(field, protoBytes)
+	*m = binary.AppendUvarint(*m, uint64(len(value)))
+	*m = append(*m, value...)
+}
+
+func (m *protoMessage) string(field int, value string) {
+	if value != "" {
+		m.bytes(field, []byte(value))
+	}
+}
+
+// strings writes a repeated string field, keeping empty elements.
+func (m *protoMessage) strings(field int, values []string) {
+	for _, value := range values {
+		m.bytes(field, []byte(value))
+	}
+}
+
+func (m *protoMessage) int(field int, value int64) {
+	if value != 0 {
+		m.tag(field, protoVarint)
+		*m = binary.AppendUvarint(*m, uint64(value))
+	}
+}
+
+func (m *protoMessage) bool(field int, value bool) {
+	if value {
+		m.int(field, 1)
+	}
+}
+
+// message writes a nested message, which is present even when empty.
+func (m *protoMessage) message(field int, value protoMessage) {
+	m.bytes(field, value)
+}
+
+// timestamp writes a google.protobuf.Timestamp, or nothing for the zero
+// time.
+func (m *protoMessage) timestamp(field int, value time.Time) {
+	if value.IsZero() {
+		return
+	}
+	var ts protoMessage
+	ts.int(1, value.Unix())
+	ts.int(2, int64(value.Nanosecond()))
+	m.message(field, ts)
+}
+
+// protoFields is a decoded message: the values of each field number, in
+// the order they appeared.
+type protoFields map[int][]protoValue
+
+type protoValue struct {
+	wire   int
+	varint uint64
+	bytes  []byte
+}
+
+var errProtoTruncated = errors.New("message is truncated")
+
+// parseProto decodes a message's fields without knowing its type, skipping
+// fixed-width values since none of the request messages have any.
+func parseProto(data []byte) (protoFields, error) {
+	fields := protoFields{}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errProtoTruncated
+		}
+		data = data[n:]
+		field, wire := int(key>>3), int(key&7)
+		if field <= 0 {
+			return nil, fmt.Errorf("invalid field number %d", field)
+		}
+		value := protoValue{wire: wire}
+		switch wire {
+		case protoVarint:
+			value.varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errProtoTruncated
+			}
+			data = data[n:]
+		case protoBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return nil, errProtoTruncated
+			}
+			value.bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case protoFixed64, protoFixed32:
+			size := 8
+			if wire == protoFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return nil, errProtoTruncated
+			}
+			data = data[size:]
+			continue
+		default:
+			return nil, fmt.Errorf("field %d has unsupported wire type %d", field, wire)
+		}
+		fields[field] = append(fields[field], value)
+	}
+	return fields, nil
+}
+
+// string is a string field's value; as in any protobuf decoder, the last
+// one wins if it was sent more than once.
+func (f protoFields) string(field int) string {
+	values := f[field]
+	for i := len(values) - 1; i >= 0; i-- {
+		if values[i].wire == protoBytes {
+			return string(values[i].bytes)
+		}
+	}
+	return ""
+}
+
+func (f protoFields) strings(field int) []string {
+	var result []string
+	for _, value := range f[field] {
+		if value.wire == protoBytes {
+			result = append(result, string(value.bytes))
+		}
+	}
+	return result
+}
+
+// optionalBool is an optional bool field, nil when it wasn't sent.
+func (f protoFields) optionalBool(field int) *bool {
+	values := f[field]
+	for i := len(values) - 1; i >= 0; i-- {
+		if values[i].wire == protoVarint {
+			value := values[i].varint != 0
+			return &value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	eventIncidentPurged = "incident.purged"
+
+	purgePending   = "pending"
+	purgeExecuted  = "executed"
+	purgeCancelled = "cancelled"
+	purgeExpired   = "expired"
+)
+
+var (
+	errPurgeNotFound      = errors.New("purge request not found")
+	errPurgeNotPending    = errors.New("purge request is no longer pending")
+	errPurgeSameApprover  = errors.New("the requesting admin cannot confirm their own purge")
+	errPurgeNotHuman      = errors.New("purges must be requested and confirmed by admins signed in as themselves, not with an API key or service identity")
+	errPurgeWindowExpired = errors.New("purge request expired before it was confirmed")
+)
+
+// PurgeRequest is a pending hard delete. It runs only once a second,
+// different admin confirms it within the confirmation window, so a single
+// rogue or compromised admin account can't destroy records. It belongs to
+// the tenant it was requested in and covers only that tenant's incidents.
+type PurgeRequest struct {
+	ID            string     `json:"id"`
+	Tenant        string     `json:"tenant,omitempty"`
+	IncidentIDs   []string   `json:"incidentIds"`
+	Reason        string     `json:"reason"`
+	Status        string     `json:"status"`
+	RequestedBy   string     `json:"requestedBy"`
+	RequestedByID string     `json:"requestedById"`
+	RequestedAt   time.Time  `json:"requestedAt"`
+	ExpiresAt     time.Time  `json:"expiresAt"`
+	ConfirmedBy   string     `json:"confirmedBy,omitempty"`
+	ConfirmedByID string     `json:"confirmedById,omitempty"`
+	ConfirmedAt   *time.Time `json:"confirmedAt,omitempty"`
+	CancelledBy   string     `json:"cancelledBy,omitempty"`
+}
+
+type PurgeInput struct {
+	IncidentIDs []string `json:"incidentIds"`
+	Reason      string   `json:"reason"`
+}
+
+type PurgeStore struct {
+	mu        sync.Mutex
+	requests  map[string]*PurgeRequest
+	order     []string
+	counter   int
+	window    time.Duration
+	retention time.Duration
+}
+
+func newPurgeStore() *PurgeStore {
+	return &PurgeStore{
+		requests:  make(map[string]*PurgeRequest),
+		order:     []string{},
+		window:    envDuration("PURGE_CONFIRM_WINDOW", time.Hour),
+		retention: envDuration("RETENTION_PERIOD", 365*24*time.Hour),
+	}
+}
+
+// expire marks pending requests past their window. Callers must hold p.mu.
+func (p *PurgeStore) expire(now time.Time) {
+	for _, request := range p.requests {
+		if request.Status == purgePending && now.After(request.ExpiresAt) {
+			request.Status = purgeExpired
+		}
+	}
+}
+
+func (p *PurgeStore) list(tenant string) []PurgeRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expire(time.Now().UTC())
+
+	items := make([]PurgeRequest, 0, len(p.order))
+	for i := len(p.order) - 1; i >= 0; i-- {
+		if request := p.requests[p.order[i]]; request.Tenant == tenant {
+			items = append(items, *request)
+		}
+	}
+	return items
+}
+
+func (p *PurgeStore) get(id, tenant string) (PurgeRequest, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expire(time.Now().UTC())
+
+	request, ok := p.requests[id]
+	if !ok || request.Tenant != tenant {
+		return PurgeRequest{}, false
+	}
+	return *request, true
+}
+
+func (p *PurgeStore) create(input PurgeInput, caller Principal, tenant string, now time.Time) PurgeRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.counter++
+	request := &PurgeRequest{
+		ID:            "PRG-" + padInt(p.counter),
+		Tenant:        tenant,
+		IncidentIDs:   input.IncidentIDs,
+		Reason:        input.Reason,
+		Status:        purgePending,
+		RequestedBy:   caller.displayName(),
+		RequestedByID: caller.ID,
+		RequestedAt:   now,
+		ExpiresAt:     now.Add(p.window),
+	}
+	p.requests[request.ID] = request
+	p.order = append(p.order, request.ID)
+	return *request
+}
+
+// confirm records the second admin's approval and runs the purge. The
+// confirmer has to be a person in the request's tenant, signed in as
+// themselves: an API key or service identity could be one the requester
+// issued, making them both admins. The request stays locked while the
+// incidents are deleted so it can't be confirmed twice.
+func (p *PurgeStore) confirm(id string, caller Principal, tenant string, store *IncidentStore, now time.Time) (PurgeRequest, []Incident, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expire(now)
+
+	request, ok := p.requests[id]
+	switch {
+	case !ok || request.Tenant != tenant:
+		return PurgeRequest{}, nil, errPurgeNotFound
+	case caller.Kind != principalUser || caller.KeyID != "":
+		return *request, nil, errPurgeNotHuman
+	case request.Status == purgeExpired:
+		return *request, nil, errPurgeWindowExpired
+	case request.Status != purgePending:
+		return *request, nil, errPurgeNotPending
+	case request.RequestedByID == caller.ID:
+		return *request, nil, errPurgeSameApprover
+	}
+
+	confirmedAt := now
+	request.ConfirmedBy, request.ConfirmedByID, request.ConfirmedAt = caller.displayName(), caller.ID, &confirmedAt
+	purged, err := store.purge(request.IncidentIDs, request.Tenant, p.retention, now)
+	if err != nil {
+		// An incident reopened since the request blocks the whole purge; the
+		// request stays pending in case it is closed again in the window.
+		request.ConfirmedBy, request.ConfirmedByID, request.ConfirmedAt = "", "", nil
+		return *request, nil, err
+	}
+	request.Status = purgeExecuted
+	return *request, purged, nil
+}
+
+func (p *PurgeStore) cancel(id string, caller Principal, tenant string) (PurgeRequest, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expire(time.Now().UTC())
+
+	request, ok := p.requests[id]
+	if !ok || request.Tenant != tenant {
+		return PurgeRequest{}, errPurgeNotFound
+	}
+	if request.Status != purgePending {
+		return *request, errPurgeNotPending
+	}
+	request.Status = purgeCancelled
+	request.CancelledBy = caller.displayName()
+	return *request, nil
+}
+
+// purgeProblem explains why an incident can't be purged yet, or returns "".
+// Only closed incidents past the retention period qualify.
+func purgeProblem(incident *Incident, retention time.Duration, now time.Time) string {
+	if !isClosedStatus(incident.Status) {
+		return incident.ID + " is not closed"
+	}
+	closedAt := incident.UpdatedAt
+	if incident.ClosedStats != nil {
+		closedAt = incident.ClosedStats.ClosedAt
+	}
+	if until := closedAt.Add(retention); now.Before(until) {
+		return incident.ID + " is within retention until " + until.Format(time.RFC3339)
+	}
+	return ""
+}
+
+// purge hard-deletes tenant's incidents, all or none. Each emits an
+// incident.purged event so mirrors and feeds drop it too.
+func (s *IncidentStore) purge(ids []string, tenant string, retention time.Duration, now time.Time) ([]Incident, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	problems := []string{}
+	for _, id := range ids {
+		incident, ok := s.incidents[id]
+		if !ok || incident.Tenant != tenant {
+			problems = append(problems, id+" not found")
+			continue
+		}
+		if problem := purgeProblem(incident, retention, now); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+
+	purged := make([]Incident, 0, len(ids))
+	remove := map[string]bool{}
+	for _, id := range ids {
+		incident := s.incidents[id]
+		if remove[id] {
+			continue
+		}
+		s.unindexIOCs(id, incident.IOCs)
+		delete(s.incidents, id)
+		remove[id] = true
+		purged = append(purged, *incident)
+		s.addTombstone(incident, now)
+		s.emit(eventIncidentPurged, *incident, nil)
+	}
+	order := make([]string, 0, len(s.order))
+	for _, id := range s.order {
+		if !remove[id] {
+			order = append(order, id)
+		}
+	}
+	s.order = order
+	return purged, nil
+}
+
+func purgeActor(caller Principal) string {
+	return fallback(caller.ID, caller.displayName())
+}
+
+// purgesHandler serves GET /api/admin/purges and POST to request a purge:
+// {"incidentIds": [...], "reason": "..."}. Requests are checked against the
+// retention period up front and again when confirmed.
+func purgesHandler(purges *PurgeStore, store *IncidentStore, audit *AuditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		caller, _ := principalFrom(r.Context())
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"items": purges.list(tenantFrom(r.Context()))})
+		case http.MethodPost:
+			var input PurgeInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			input.IncidentIDs = sanitizeSlice(input.IncidentIDs)
+			input.Reason = strings.TrimSpace(input.Reason)
+			if len(input.IncidentIDs) == 0 || input.Reason == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "incidentIds and reason are required"})
+				return
+			}
+			// A key can act as another admin, who would then look like the
+			// requester, leaving its issuer free to confirm.
+			if caller.Kind != principalUser || caller.KeyID != "" {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": errPurgeNotHuman.Error()})
+				return
+			}
+			now := time.Now().UTC()
+			problems := []string{}
+			for _, id := range input.IncidentIDs {
+				incident, ok := store.get(id)
+				if !ok || !canView(r, *incident) {
+					problems = append(problems, id+" not found")
+					continue
+				}
+				if problem := purgeProblem(incident, purges.retention, now); problem != "" {
+					problems = append(problems, problem)
+				}
+			}
+			if len(problems) > 0 {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": "incidents not eligible for purge", "problems": problems})
+				return
+			}
+
+			request := purges.create(input, caller, tenantFrom(r.Context()), now)
+			log.Printf("purge %s requested by %s for %s: %s", request.ID, purgeActor(caller), strings.Join(request.IncidentIDs, ", "), request.Reason)
+			audit.record(AuditEvent{
+				Actor:      purgeActor(caller),
+				ActorType:  caller.Kind,
+				Action:     "purge.requested",
+				Tenant:     request.Tenant,
+				Resource:   "/api/admin/purges/" + request.ID,
+				Detail:     fmt.Sprintf("%s for %s: %s", request.ID, strings.Join(request.IncidentIDs, ", "), request.Reason),
+				RemoteAddr: r.RemoteAddr,
+				UserAgent:  r.UserAgent(),
+			})
+			writeJSON(w, http.StatusAccepted, request)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// purgeHandler serves GET and DELETE (cancel) on /api/admin/purges/{id}, and
+// POST /api/admin/purges/{id}/confirm for the second admin.
+func purgeHandler(purges *PurgeStore, store *IncidentStore, access *AccessLog, audit *AuditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/admin/purges/"), "/")
+		id := parts[0]
+		if id == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "confirm") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		caller, _ := principalFrom(r.Context())
+		event := AuditEvent{
+			Actor:      purgeActor(caller),
+			ActorType:  caller.Kind,
+			Tenant:     tenantFrom(r.Context()),
+			Resource:   r.URL.Path,
+			RemoteAddr: r.RemoteAddr,
+			UserAgent:  r.UserAgent(),
+		}
+
+		if len(parts) == 2 {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			request, purged, err := purges.confirm(id, caller, tenantFrom(r.Context()), store, time.Now().UTC())
+			event.Action = "purge.confirmed"
+			if err != nil {
+				event.Outcome, event.Detail = auditOutcomeFailure, id+": "+err.Error()
+				audit.record(event)
+				log.Printf("purge %s confirmation by %s refused: %v", id, purgeActor(caller), err)
+			}
+			switch {
+			case errors.Is(err, errPurgeNotFound):
+				w.WriteHeader(http.StatusNotFound)
+				return
+			case errors.Is(err, errPurgeSameApprover), errors.Is(err, errPurgeNotHuman):
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+				return
+			case errors.Is(err, errPurgeWindowExpired):
+				writeJSON(w, http.StatusGone, map[string]string{"error": err.Error()})
+				return
+			case errors.Is(err, errPurgeNotPending):
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error(), "status": request.Status})
+				return
+			case err != nil:
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+				return
+			}
+
+			event.Detail = fmt.Sprintf("%s requested by %s, confirmed by %s: %s", request.ID, request.RequestedByID, request.ConfirmedByID, request.Reason)
+			audit.record(event)
+			for _, incident := range purged {
+				access.forget(incident.ID)
+				audit.record(AuditEvent{
+					Actor:      request.ConfirmedByID,
+					ActorType:  caller.Kind,
+					Action:     eventIncidentPurged,
+					Tenant:     incident.Tenant,
+					IncidentID: incident.ID,
+					Resource:   "/api/incidents/" + incident.ID,
+					Detail:     fmt.Sprintf("under %s requested by %s: %s", request.ID, request.RequestedByID, request.Reason),
+				})
+				log.Printf("purged %s (%s, closed as %s) under %s: requested by %s, confirmed by %s", incident.ID, incident.Type, incident.Status, request.ID, request.RequestedByID, request.ConfirmedByID)
+			}
+			writeJSON(w, http.StatusOK, request)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			request, ok := purges.get(id, tenantFrom(r.Context()))
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, request)
+		case http.MethodDelete:
+			request, err := purges.cancel(id, caller, tenantFrom(r.Context()))
+			switch {
+			case errors.Is(err, errPurgeNotFound):
+				w.WriteHeader(http.StatusNotFound)
+				return
+			case err != nil:
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error(), "status": request.Status})
+				return
+			}
+			event.Action, event.Detail = "purge.cancelled", request.ID
+			audit.record(event)
+			writeJSON(w, http.StatusOK, request)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
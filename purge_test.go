@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPurgeApproval(t *testing.T) {
+	t.Setenv("RETENTION_PERIOD", "0s")
+	alice := Principal{ID: "alice", Name: "Alice", Kind: principalUser, Roles: []string{roleAdmin}}
+	bob := Principal{ID: "bob", Name: "Bob", Kind: principalUser, Roles: []string{roleAdmin}}
+	// An admin's key acting as another admin looks like that admin but
+	// isn't them signing in.
+	aliceKeyAsBob := Principal{ID: "bob", Name: "Bob", Kind: principalUser, Roles: []string{roleAdmin}, KeyID: "KEY-0001"}
+	service := Principal{ID: "SVC-0001", Name: "siem-bot", Kind: principalService, Roles: []string{roleAdmin}}
+	analyst := Principal{ID: "carol", Name: "Carol", Kind: principalUser, Roles: []string{"analyst"}}
+
+	tests := []struct {
+		name        string
+		requester   Principal
+		confirmer   Principal
+		wantRequest int
+		wantConfirm int
+		wantError   string
+	}{
+		{name: "second admin", requester: alice, confirmer: bob, wantRequest: http.StatusAccepted, wantConfirm: http.StatusOK},
+		{name: "requester confirming", requester: alice, confirmer: alice, wantRequest: http.StatusAccepted, wantConfirm: http.StatusForbidden, wantError: errPurgeSameApprover.Error()},
+		{name: "confirming with a key issued as another admin", requester: alice, confirmer: aliceKeyAsBob, wantRequest: http.StatusAccepted, wantConfirm: http.StatusForbidden, wantError: errPurgeNotHuman.Error()},
+		{name: "confirming as a service identity", requester: alice, confirmer: service, wantRequest: http.StatusAccepted, wantConfirm: http.StatusForbidden, wantError: errPurgeNotHuman.Error()},
+		{name: "confirming without the admin role", requester: alice, confirmer: analyst, wantRequest: http.StatusAccepted, wantConfirm: http.StatusForbidden, wantError: "admin role required"},
+		{name: "requesting with a key issued as another admin", requester: aliceKeyAsBob, wantRequest: http.StatusForbidden, wantError: errPurgeNotHuman.Error()},
+		{name: "requesting as a service identity", requester: service, wantRequest: http.StatusForbidden, wantError: errPurgeNotHuman.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newIncidentStore()
+			incident := store.create(IncidentInput{Title: "Departed contractor", Status: "Closed"})
+			purges := newPurgeStore()
+			audit := newAuditLog()
+			serve := func(handler http.Handler, method, path string, caller Principal, body string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(method, path, strings.NewReader(body))
+				r = r.WithContext(withPrincipal(r.Context(), caller))
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, r)
+				return recorder
+			}
+
+			requested := serve(purgesHandler(purges, store, audit), http.MethodPost, "/api/admin/purges", tt.requester, `{"incidentIds": ["`+incident.ID+`"], "reason": "contract ended"}`)
+			if requested.Code != tt.wantRequest {
+				t.Fatalf("request status = %d, want %d: %s", requested.Code, tt.wantRequest, requested.Body)
+			}
+			if tt.wantRequest != http.StatusAccepted {
+				if !strings.Contains(requested.Body.String(), tt.wantError) {
+					t.Errorf("request body = %s, want %q", requested.Body, tt.wantError)
+				}
+				if len(purges.list("")) != 0 {
+					t.Error("refused request was recorded")
+				}
+				return
+			}
+			var request PurgeRequest
+			if err := json.NewDecoder(requested.Body).Decode(&request); err != nil {
+				t.Fatal(err)
+			}
+
+			confirmed := serve(purgeHandler(purges, store, newAccessLog(audit), audit), http.MethodPost, "/api/admin/purges/"+request.ID+"/confirm", tt.confirmer, "")
+			if confirmed.Code != tt.wantConfirm {
+				t.Fatalf("confirm status = %d, want %d: %s", confirmed.Code, tt.wantConfirm, confirmed.Body)
+			}
+			if !strings.Contains(confirmed.Body.String(), tt.wantError) {
+				t.Errorf("confirm body = %s, want %q", confirmed.Body, tt.wantError)
+			}
+			_, exists := store.get(incident.ID)
+			if purged := tt.wantConfirm == http.StatusOK; exists == purged {
+				t.Errorf("incident still exists = %v, want %v", exists, !purged)
+			}
+			if got, _ := purges.get(request.ID, ""); tt.wantConfirm != http.StatusOK && got.Status != purgePending {
+				t.Errorf("refused confirmation left the request %s, want %s", got.Status, purgePending)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The incident query language is a space-separated list of terms that must
+// all match, for example:
+//
+//	severity:critical,high status:open tag:phishing created>=now-7d "oauth consent"
+//
+// Terms are field:value (comma-separated values match any), a comparison on
+// a date field (created>=2024-05-01, updated<now-2h), or bare free text.
+// Prefix a term with "-" to negate it.
+
+type QueryClause struct {
+	Field  string   `json:"field"`
+	Op     string   `json:"op"`
+	Values []string `json:"values"`
+	Negate bool     `json:"negate,omitempty"`
+}
+
+type Query struct {
+	Clauses []QueryClause `json:"clauses"`
+	Text    []string      `json:"text,omitempty"`
+}
+
+var queryFields = map[string]bool{
+	"severity": true,
+	"status":   true,
+	"owner":    true,
+	"tag":      true,
+	"ioc":      true,
+	"major":    true,
+	"type":     true,
+	"phase":    true,
+	"created":  true,
+	"updated":  true,
+}
+
+var queryDateFields = map[string]bool{"created": true, "updated": true}
+
+func parseQuery(input string) (Query, error) {
+	query := Query{Clauses: []QueryClause{}}
+	tokens, err := tokenizeQuery(input)
+	if err != nil {
+		return Query{}, err
+	}
+
+	for _, token := range tokens {
+		if token.quoted {
+			query.Text = append(query.Text, token.value)
+			continue
+		}
+		raw := token.value
+		negate := false
+		if strings.HasPrefix(raw, "-") && len(raw) > 1 {
+			negate = true
+			raw = raw[1:]
+		}
+
+		field, op, value, ok := splitQueryTerm(raw)
+		if !ok {
+			if negate {
+				return Query{}, fmt.Errorf("negated free text %q is not supported", token.value)
+			}
+			query.Text = append(query.Text, raw)
+			continue
+		}
+		field = strings.ToLower(field)
+		if !queryFields[field] {
+			return Query{}, fmt.Errorf("unknown field %q", field)
+		}
+		if op != ":" && !queryDateFields[field] {
+			return Query{}, fmt.Errorf("field %q only supports ':'", field)
+		}
+		value = strings.Trim(value, `"`)
+		if value == "" {
+			return Query{}, fmt.Errorf("missing value for %q", field)
+		}
+
+		clause := QueryClause{Field: field, Op: op, Negate: negate}
+		if queryDateFields[field] {
+			if op == ":" {
+				op = ">="
+				clause.Op = op
+			}
+			if _, err := parseQueryTime(value, time.Now()); err != nil {
+				return Query{}, fmt.Errorf("invalid date for %q: %v", field, err)
+			}
+			clause.Values = []string{value}
+		} else {
+			clause.Values = sanitizeSlice(strings.Split(value, ","))
+		}
+		if field == "major" {
+			for _, v := range clause.Values {
+				if _, err := strconv.ParseBool(v); err != nil {
+					return Query{}, fmt.Errorf("major expects true or false, got %q", v)
+				}
+			}
+		}
+		query.Clauses = append(query.Clauses, clause)
+	}
+	return query, nil
+}
+
+type queryToken struct {
+	value  string
+	quoted bool
+}
+
+// tokenizeQuery splits on whitespace, keeping quoted phrases (and quoted
+// field values such as owner:"SOC Tier 1") together.
+func tokenizeQuery(input string) ([]queryToken, error) {
+	tokens := []queryToken{}
+	var current strings.Builder
+	inQuotes := false
+	quotedWhole := false
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, queryToken{value: current.String(), quoted: quotedWhole})
+		}
+		current.Reset()
+		quotedWhole = false
+	}
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			if !inQuotes && current.Len() == 0 {
+				quotedWhole = true
+			} else if !quotedWhole {
+				current.WriteRune(r)
+			}
+			inQuotes = !inQuotes
+		case unicode.IsSpace(r) && !inQuotes:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inQuotes {
+		return nil, errors.New("unterminated quote")
+	}
+	flush()
+	return tokens, nil
+}
+
+func splitQueryTerm(term string) (string, string, string, bool) {
+	for i, r := range term {
+		if r == '"' {
+			return "", "", "", false
+		}
+		switch r {
+		case ':':
+			return term[:i], ":", term[i+1:], i > 0
+		case '>', '<':
+			op := string(r)
+			rest := term[i+1:]
+			if strings.HasPrefix(rest, "=") {
+				op += "="
+				rest = rest[1:]
+			}
+			return term[:i], op, rest, i > 0
+		}
+	}
+	return "", "", "", false
+}
+
+// parseQueryTime accepts RFC 3339 timestamps, plain dates, and relative
+// offsets such as now-7d, now-12h, or now-30m.
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+	lower := strings.ToLower(value)
+	if lower == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(lower, "now-") {
+		offset := lower[len("now-"):]
+		if strings.HasSuffix(offset, "d") {
+			days, err := strconv.Atoi(strings.TrimSuffix(offset, "d"))
+			if err != nil {
+				return time.Time{}, err
+			}
+			return now.Add(-time.Duration(days) * 24 * time.Hour), nil
+		}
+		duration, err := time.ParseDuration(offset)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-duration), nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func (q Query) String() string {
+	terms := make([]string, 0, len(q.Clauses)+len(q.Text))
+	for _, clause := range q.Clauses {
+		term := clause.Field + clause.Op + quoteQueryValue(strings.Join(clause.Values, ","))
+		if clause.Negate {
+			term = "-" + term
+		}
+		terms = append(terms, term)
+	}
+	for _, text := range q.Text {
+		terms = append(terms, quoteQueryValue(text))
+	}
+	return strings.Join(terms, " ")
+}
+
+func quoteQueryValue(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+func (q Query) matches(incident Incident, now time.Time) bool {
+	for _, clause := range q.Clauses {
+		if clause.matches(incident, now) == clause.Negate {
+			return false
+		}
+	}
+	for _, text := range q.Text {
+		if !matchesQuery(incident, strings.ToLower(text)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c QueryClause) matches(incident Incident, now time.Time) bool {
+	if queryDateFields[c.Field] {
+		at := incident.CreatedAt
+		if c.Field == "updated" {
+			at = incident.UpdatedAt
+		}
+		bound, err := parseQueryTime(c.Values[0], now)
+		if err != nil {
+			return false
+		}
+		switch c.Op {
+		case ">":
+			return at.After(bound)
+		case ">=":
+			return !at.Before(bound)
+		case "<":
+			return at.Before(bound)
+		case "<=":
+			return !at.After(bound)
+		}
+		return false
+	}
+
+	for _, value := range c.Values {
+		if c.matchesValue(incident, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c QueryClause) matchesValue(incident Incident, value string) bool {
+	switch c.Field {
+	case "severity":
+		return strings.EqualFold(incident.Severity, value)
+	case "status":
+		switch strings.ToLower(value) {
+		case "open":
+			return !isClosedStatus(incident.Status)
+		case "closed":
+			return isClosedStatus(incident.Status)
+		}
+		return strings.EqualFold(incident.Status, value)
+	case "owner":
+		return strings.EqualFold(incident.Owner, value)
+	case "tag":
+		for _, tag := range incident.Tags {
+			if strings.EqualFold(tag, value) {
+				return true
+			}
+		}
+	case "ioc":
+		for _, ioc := range incident.IOCs {
+			if normalizeIOC(ioc) == normalizeIOC(value) {
+				return true
+			}
+		}
+	case "major":
+		major, _ := strconv.ParseBool(value)
+		return incident.Major == major
+	case "type":
+		return strings.EqualFold(incident.Type, value)
+	case "phase":
+		phase, ok := normalizeKillChainPhase(value)
+		return ok && incident.KillChainPhase == phase
+	}
+	return false
+}
+
+func filterByQuery(items []Incident, query Query) []Incident {
+	if len(query.Clauses) == 0 && len(query.Text) == 0 {
+		return items
+	}
+	now := time.Now().UTC()
+	filtered := make([]Incident, 0, len(items))
+	for _, incident := range items {
+		if query.matches(incident, now) {
+			filtered = append(filtered, incident)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var errAlreadyClaimed = errors.New("incident already has an owner")
+
+func unowned(incident Incident) bool {
+	return strings.TrimSpace(incident.Owner) == "" || strings.EqualFold(incident.Owner, "Unassigned")
+}
+
+// triageQueue returns unowned New incidents, most urgent first: by
+// severity, then major incidents, then the longest waiting.
+func triageQueue(items []Incident) []Incident {
+	queue := []Incident{}
+	for _, incident := range items {
+		if unowned(incident) && strings.EqualFold(incident.Status, "New") {
+			queue = append(queue, incident)
+		}
+	}
+	sort.SliceStable(queue, func(i, j int) bool {
+		a, b := queue[i], queue[j]
+		if rankA, rankB := severityRank(a.Severity), severityRank(b.Severity); rankA != rankB {
+			return rankA > rankB
+		}
+		if a.Major != b.Major {
+			return a.Major
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	return queue
+}
+
+// claim makes the caller the owner of an unowned incident. Checking and
+// assigning under one lock means two analysts can't both win.
+func (s *IncidentStore) claim(id string, caller Principal) (Incident, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return Incident{}, errIncidentNotFound
+	}
+	name := caller.displayName()
+	if strings.EqualFold(incident.Owner, name) {
+		return *incident, nil
+	}
+	if !unowned(*incident) {
+		return *incident, errAlreadyClaimed
+	}
+	update := IncidentUpdate{Owner: name, Actor: name, ActorID: caller.ID}
+	if err := s.applyUpdate(incident, update, time.Now().UTC()); err != nil {
+		return Incident{}, err
+	}
+	return *incident, nil
+}
+
+// IncidentAging is how long an incident has been waiting, computed when it
+// is read so clients don't depend on their own clocks.
+type IncidentAging struct {
+	// AgeSeconds runs from creation until now, or until closure.
+	AgeSeconds      int64     `json:"ageSeconds"`
+	StatusSince     time.Time `json:"statusSince"`
+	InStatusSeconds int64     `json:"inStatusSeconds"`
+	// QueuePosition is the incident's 1-based place in the triage queue,
+	// or 0 when it isn't in the queue.
+	QueuePosition int `json:"queuePosition,omitempty"`
+}
+
+// agingFor computes aging at now; positions maps incident IDs to their
+// triage queue position.
+func agingFor(incident Incident, positions map[string]int, now time.Time) *IncidentAging {
+	until := now
+	if incident.ClosedStats != nil && isClosedStatus(incident.Status) {
+		until = incident.ClosedStats.ClosedAt
+	}
+	since := statusSince(incident)
+	return &IncidentAging{
+		AgeSeconds:      int64(until.Sub(incident.CreatedAt) / time.Second),
+		StatusSince:     since,
+		InStatusSeconds: int64(now.Sub(since) / time.Second),
+		QueuePosition:   positions[incident.ID],
+	}
+}
+
+// queuePositions numbers the triage queue built from items.
+func queuePositions(items []Incident) map[string]int {
+	positions := map[string]int{}
+	for i, incident := range triageQueue(items) {
+		positions[incident.ID] = i + 1
+	}
+	return positions
+}
+
+// addAging fills Aging on items, taking queue positions from the caller's
+// whole view rather than just the page being returned.
+func addAging(items []Incident, visible []Incident, now time.Time) {
+	positions := queuePositions(visible)
+	for i := range items {
+		items[i].Aging = agingFor(items[i], positions, now)
+	}
+}
+
+// sortByAge puts the longest waiting first.
+func sortByAge(items []Incident) {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].CreatedAt.Before(items[j].CreatedAt) })
+}
+
+func queueHandler(store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		queue := triageQueue(visibleTo(r, store.list()))
+		now := time.Now().UTC()
+		for i := range queue {
+			queue[i].Aging = agingFor(queue[i], nil, now)
+			queue[i].Aging.QueuePosition = i + 1
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": queue})
+	}
+}
+
+func handleIncidentClaim(w http.ResponseWriter, r *http.Request, id string, store *IncidentStore) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	caller, ok := principalFrom(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+		return
+	}
+	incident, err := store.claim(id, caller)
+	switch {
+	case errors.Is(err, errIncidentNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, errAlreadyClaimed):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error(), "owner": incident.Owner})
+	case err != nil:
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, incident)
+	}
+}
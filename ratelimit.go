@@ -0,0 +1,202 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Route classes rate limits are set for. Ingestion is alert intake, which
+// a misbehaving SIEM or forwarder can flood; writes and reads are the rest
+// of the API by method. Logins are the sign-in endpoints below /auth/,
+// limited by default since they are where passwords get guessed.
+const (
+	rateClassRead   = "read"
+	rateClassWrite  = "write"
+	rateClassIngest = "ingest"
+	rateClassLogin  = "login"
+
+	defaultLoginRateLimit = "login=10/m"
+
+	// rateSweepEvery is how many new clients go by between sweeps of the
+	// buckets of clients that have gone quiet.
+	rateSweepEvery = 1024
+)
+
+// ingestPaths are the alert intake endpoints, besides the HEC collector
+// below /services/collector.
+var ingestPaths = []string{"/api/alerts", "/api/alerts/elastic", "/services/collector"}
+
+type rateLimit struct {
+	perSecond float64
+	burst     float64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps a token bucket per client and route class. Clients are
+// their API or service key when they use one, the signed-in user, and
+// their source IP otherwise.
+type RateLimiter struct {
+	limits  map[string]rateLimit
+	proxies []netip.Prefix
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	added   int
+}
+
+// newRateLimiter reads RATE_LIMITS. Logins get defaultLoginRateLimit
+// unless it sets its own. Requests from proxies are counted against the
+// client they forwarded for.
+func newRateLimiter(proxies []netip.Prefix) *RateLimiter {
+	limits := parseRateLimits(envString("RATE_LIMITS", ""))
+	if _, ok := limits[rateClassLogin]; !ok {
+		limits[rateClassLogin] = parseRateLimits(defaultLoginRateLimit)[rateClassLogin]
+	}
+	return &RateLimiter{limits: limits, proxies: proxies, buckets: map[string]*tokenBucket{}}
+}
+
+// parseRateLimits reads "read=50/s:100,write=10/s,ingest=6000/m", where
+// each class gets a rate per second, minute, or hour and an optional burst
+// that defaults to the rate's count.
+func parseRateLimits(value string) map[string]rateLimit {
+	limits := map[string]rateLimit{}
+	for _, entry := range sanitizeSlice(strings.Split(value, ",")) {
+		class, spec, _ := strings.Cut(entry, "=")
+		class = strings.ToLower(strings.TrimSpace(class))
+		rate, burst, hasBurst := strings.Cut(strings.TrimSpace(spec), ":")
+		count, per, _ := strings.Cut(rate, "/")
+		n, err := strconv.ParseFloat(count, 64)
+		window := map[string]float64{"s": 1, "m": 60, "h": 3600}[per]
+		limit := rateLimit{perSecond: n / window, burst: n}
+		if hasBurst {
+			limit.burst, err = strconv.ParseFloat(burst, 64)
+		}
+		if !slices.Contains([]string{rateClassRead, rateClassWrite, rateClassIngest, rateClassLogin}, class) || err != nil || n <= 0 || window == 0 || limit.burst < 1 {
+			log.Printf("ignoring rate limit %q: want read|write|ingest|login=N/s|m|h[:burst], e.g. ingest=100/s:200", entry)
+			continue
+		}
+		limits[class] = limit
+	}
+	return limits
+}
+
+func rateClass(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/auth/") && r.URL.Path != "/auth/logout" {
+		return rateClassLogin
+	}
+	if r.Method == http.MethodPost && (slices.Contains(ingestPaths, r.URL.Path) || strings.HasPrefix(r.URL.Path, "/services/collector/")) {
+		return rateClassIngest
+	}
+	if isReadRequest(r) {
+		return rateClassRead
+	}
+	return rateClassWrite
+}
+
+// rateClient names the caller of r, taking anonymous callers' addresses
+// from X-Forwarded-For when r came through one of proxies.
+func rateClient(r *http.Request, proxies []netip.Prefix) string {
+	if principal, ok := principalFrom(r.Context()); ok {
+		switch {
+		case principal.KeyID != "":
+			return "key:" + principal.KeyID
+		case principal.Kind == principalService:
+			return "service:" + principal.ID
+		case principal.ID != "":
+			return "user:" + principal.ID
+		}
+	}
+	return "ip:" + clientAddr(r, proxies)
+}
+
+// take spends a token from the client's bucket for class. When the bucket
+// is empty it returns how long until the next token.
+func (l *RateLimiter) take(client, class string, now time.Time) (bool, time.Duration) {
+	limit, ok := l.limits[class]
+	if !ok {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := class + " " + client
+	bucket, ok := l.buckets[key]
+	if !ok {
+		l.sweep(now)
+		bucket = &tokenBucket{tokens: limit.burst, last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(limit.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limit.perSecond)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / limit.perSecond * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have refilled, which are no different from a
+// new one, every rateSweepEvery new clients.
+func (l *RateLimiter) sweep(now time.Time) {
+	l.added++
+	if l.added%rateSweepEvery != 0 {
+		return
+	}
+	for key, bucket := range l.buckets {
+		class, _, _ := strings.Cut(key, " ")
+		limit := l.limits[class]
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*limit.perSecond >= limit.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limitLogin spends a token from the login bucket of the username being
+// signed in as, answering 429 when it is empty, so guessing one account's
+// password from many addresses is held to the login limit as well.
+func (l *RateLimiter) limitLogin(w http.ResponseWriter, username string) bool {
+	if l == nil {
+		return true
+	}
+	if ok, wait := l.take("user:"+strings.ToLower(strings.TrimSpace(username)), rateClassLogin, time.Now()); !ok {
+		writeRateLimited(w, rateClassLogin, wait)
+		return false
+	}
+	return true
+}
+
+func writeRateLimited(w http.ResponseWriter, class string, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "rate limit exceeded for " + class + " requests"})
+}
+
+// withRateLimit answers 429 with Retry-After to clients over their limit
+// for the route class. Only the API, alert intake, and logins are limited.
+func withRateLimit(next http.Handler, limiter *RateLimiter) http.Handler {
+	if limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") && !strings.HasPrefix(r.URL.Path, "/services/") && !strings.HasPrefix(r.URL.Path, "/auth/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		class := rateClass(r)
+		if ok, wait := limiter.take(rateClient(r, limiter.proxies), class, time.Now()); !ok {
+			writeRateLimited(w, class, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Read paths that can be served from the read replica, for READ_REPLICA.
+const (
+	replicaList   = "list"
+	replicaStats  = "stats"
+	replicaExport = "export"
+)
+
+var replicaReads = []string{replicaList, replicaStats, replicaExport}
+
+// incidentSource is anything incidents can be listed from: the store or a
+// replica of it.
+type incidentSource interface {
+	list() []Incident
+}
+
+// ReadReplica is a copy of the store kept current from its change events,
+// so heavy reads (dashboards polling the list, stats, exports) take the
+// replica's lock instead of contending with ingestion for the store's.
+// Events are applied in commit order; one that arrives after a newer event
+// for the same incident is dropped.
+type ReadReplica struct {
+	mu        sync.RWMutex
+	incidents map[string]Incident
+	seqs      map[string]uint64
+	order     []string
+}
+
+func newReadReplica(store *IncidentStore) *ReadReplica {
+	replica := &ReadReplica{incidents: map[string]Incident{}, seqs: map[string]uint64{}, order: []string{}}
+	// Holding the lock across subscribing and loading the snapshot makes
+	// events committed in between wait until the snapshot is in place.
+	replica.mu.Lock()
+	defer replica.mu.Unlock()
+	store.subscribe(replica.apply)
+
+	items, seq := store.snapshot()
+	// Walk oldest first so each insert lands in front, as in the store.
+	for i := len(items) - 1; i >= 0; i-- {
+		replica.put(items[i], seq)
+	}
+	return replica
+}
+
+// snapshot returns every incident and the sequence of the last event
+// committed, read under one lock.
+func (s *IncidentStore) snapshot() ([]Incident, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make([]Incident, 0, len(s.order))
+	for _, id := range s.order {
+		if incident := s.incidents[id]; incident != nil {
+			items = append(items, *incident)
+		}
+	}
+	return items, s.seq
+}
+
+// put stores incident unless a newer version is already there. Callers must
+// hold r.mu.
+func (r *ReadReplica) put(incident Incident, seq uint64) {
+	current, ok := r.seqs[incident.ID]
+	if ok && current >= seq {
+		return
+	}
+	if _, exists := r.incidents[incident.ID]; !exists {
+		r.order = append([]string{incident.ID}, r.order...)
+	}
+	r.incidents[incident.ID] = incident
+	r.seqs[incident.ID] = seq
+}
+
+func (r *ReadReplica) apply(event IncidentEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event.Type != eventIncidentPurged {
+		r.put(event.Incident, event.seq)
+		return
+	}
+	id := event.Incident.ID
+	delete(r.incidents, id)
+	// Keep the sequence so a late update can't resurrect the incident.
+	r.seqs[id] = event.seq
+	for i, existing := range r.order {
+		if existing == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (r *ReadReplica) list() []Incident {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	items := make([]Incident, 0, len(r.order))
+	for _, id := range r.order {
+		items = append(items, r.incidents[id])
+	}
+	return items
+}
+
+// ReadSources says where each read path lists incidents from.
+type ReadSources struct {
+	List   incidentSource
+	Stats  incidentSource
+	Export incidentSource
+}
+
+// newReadSources reads READ_REPLICA, a comma-separated list of the read
+// paths to serve from a replica (list, stats, export, or all). Everything
+// else reads the store.
+func newReadSources(store *IncidentStore) ReadSources {
+	sources := ReadSources{List: store, Stats: store, Export: store}
+	paths := sanitizeSlice(strings.Split(strings.ToLower(envString("READ_REPLICA", "")), ","))
+	if len(paths) == 0 {
+		return sources
+	}
+	replica := newReadReplica(store)
+	for _, path := range paths {
+		switch path {
+		case "all":
+			return ReadSources{List: replica, Stats: replica, Export: replica}
+		case replicaList:
+			sources.List = replica
+		case replicaStats:
+			sources.Stats = replica
+		case replicaExport:
+			sources.Export = replica
+		default:
+			log.Printf("config: READ_REPLICA: ignoring %q, want %s or all", path, strings.Join(replicaReads, ", "))
+		}
+	}
+	return sources
+}
+
+// withReadOnly refuses API writes with 503 when READ_ONLY is set, for
+// standby instances and maintenance windows. Reads keep working.
+func withReadOnly(next http.Handler, readOnly bool) http.Handler {
+	if !readOnly {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isReadRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", "300")
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "server is in read-only mode"})
+	})
+}
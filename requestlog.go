@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// requestLogEntry collects what inner middleware learns about a request,
+// such as who made it, for the log line written once it finishes.
+type requestLogEntry struct {
+	principal *Principal
+	tenant    string
+}
+
+type requestLogKey struct{}
+
+func requestLogFrom(ctx context.Context) *requestLogEntry {
+	entry, _ := ctx.Value(requestLogKey{}).(*requestLogEntry)
+	return entry
+}
+
+// newLogger is the process logger: JSON lines on stdout at LOG_LEVEL. It
+// also becomes the default, so the standard library's log output is
+// structured too.
+func newLogger() *slog.Logger {
+	value := envString("LOG_LEVEL", "info")
+	var level slog.Level
+	err := level.UnmarshalText([]byte(value))
+	if err != nil {
+		level = slog.LevelInfo
+	}
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(logger)
+	if err != nil {
+		logger.Warn("config: LOG_LEVEL is not debug, info, warn, or error, using info", "value", value)
+	}
+	return logger
+}
+
+// withRequestLog writes a line per request with its method, path, status,
+// latency, and caller. Server errors log at error and other failures at
+// warn, so LOG_LEVEL=warn keeps just the requests worth looking at.
+func withRequestLog(next http.Handler, logger *slog.Logger, enabled bool) http.Handler {
+	if !enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := &requestLogEntry{}
+		recorder := &statusRecorder{ResponseWriter: w}
+		started := time.Now()
+		defer func() {
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			switch {
+			case status >= 500:
+				level = slog.LevelError
+			case status >= 400:
+				level = slog.LevelWarn
+			}
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Float64("latency_ms", float64(time.Since(started).Microseconds())/1000),
+				slog.String("remote_addr", r.RemoteAddr),
+			}
+			if entry.principal != nil {
+				attrs = append(attrs, slog.String("user", entry.principal.ID), slog.String("user_kind", entry.principal.Kind))
+				if entry.principal.KeyID != "" {
+					attrs = append(attrs, slog.String("key_id", entry.principal.KeyID))
+				}
+			}
+			if entry.tenant != "" {
+				attrs = append(attrs, slog.String("tenant", entry.tenant))
+			}
+			trace := traceFrom(r.Context())
+			attrs = append(attrs, slog.String("request_id", trace.requestID))
+			if trace.traceID != "" {
+				attrs = append(attrs, slog.String("trace_id", trace.traceID))
+			}
+			if agent := r.UserAgent(); agent != "" {
+				attrs = append(attrs, slog.String("user_agent", strings.TrimSpace(agent)))
+			}
+			logger.LogAttrs(r.Context(), level, "request", attrs...)
+		}()
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, entry)))
+	})
+}
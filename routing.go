@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RoutingRule sets defaults for new incidents of a severity that carry all
+// of Tags. Either condition may be left out; a rule with neither matches
+// every incident.
+type RoutingRule struct {
+	Name      string   `json:"name"`
+	Severity  string   `json:"severity,omitempty"`
+	Tags      []string `json:"tags"`
+	Playbooks []string `json:"playbooks"`
+	Team      string   `json:"team,omitempty"`
+	Channels  []string `json:"channels"`
+}
+
+// RoutingConfig is everything that decides where new incidents go.
+// Playbooks maps a playbook name to its steps, which become tasks.
+type RoutingConfig struct {
+	Playbooks map[string][]string `json:"playbooks"`
+	Rules     []RoutingRule       `json:"rules"`
+	UpdatedAt *time.Time          `json:"updatedAt,omitempty"`
+	UpdatedBy string              `json:"updatedBy,omitempty"`
+}
+
+// IncidentRouting records what routing applied to an incident when it was
+// created: every playbook and channel of the matching rules, and the team
+// of the first one that names a team.
+type IncidentRouting struct {
+	Rules     []string `json:"rules"`
+	Playbooks []string `json:"playbooks"`
+	Team      string   `json:"team,omitempty"`
+	Channels  []string `json:"channels"`
+}
+
+type RoutingStore struct {
+	mu     sync.RWMutex
+	config RoutingConfig
+}
+
+func newRoutingStore() *RoutingStore {
+	return &RoutingStore{config: RoutingConfig{Playbooks: map[string][]string{}, Rules: []RoutingRule{}}}
+}
+
+func (r *RoutingStore) get() RoutingConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+// validateRoutingConfig cleans up config in place, rejecting unknown
+// severities, rules that change nothing, and references to missing
+// playbooks.
+func validateRoutingConfig(config *RoutingConfig) error {
+	playbooks := map[string][]string{}
+	for name, steps := range config.Playbooks {
+		name = strings.TrimSpace(name)
+		steps = sanitizeSlice(steps)
+		if name == "" || len(steps) == 0 {
+			return errors.New("playbooks need a name and at least one step")
+		}
+		playbooks[name] = steps
+	}
+	rules := make([]RoutingRule, 0, len(config.Rules))
+	for i, rule := range config.Rules {
+		rule.Name = fallback(strings.TrimSpace(rule.Name), "rule "+itoa(i+1))
+		if rule.Severity = strings.TrimSpace(rule.Severity); rule.Severity != "" {
+			if !strings.EqualFold(normalizeSeverity(rule.Severity), rule.Severity) {
+				return errors.New(rule.Name + ": severity must be low, medium, high, or critical")
+			}
+			rule.Severity = normalizeSeverity(rule.Severity)
+		}
+		rule.Tags = dedupeStrings(sanitizeSlice(rule.Tags))
+		rule.Playbooks = dedupeStrings(sanitizeSlice(rule.Playbooks))
+		rule.Team = strings.TrimSpace(rule.Team)
+		rule.Channels = dedupeStrings(sanitizeSlice(rule.Channels))
+		if len(rule.Playbooks) == 0 && rule.Team == "" && len(rule.Channels) == 0 {
+			return errors.New(rule.Name + ": set at least one of playbooks, team, or channels")
+		}
+		for _, playbook := range rule.Playbooks {
+			if _, ok := playbooks[playbook]; !ok {
+				return errors.New(rule.Name + ": unknown playbook " + playbook)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	config.Playbooks, config.Rules = playbooks, rules
+	return nil
+}
+
+// replace swaps in a whole new configuration after validating it.
+func (r *RoutingStore) replace(config RoutingConfig, by string) (RoutingConfig, error) {
+	if err := validateRoutingConfig(&config); err != nil {
+		return RoutingConfig{}, err
+	}
+	now := time.Now().UTC()
+	config.UpdatedAt, config.UpdatedBy = &now, by
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config = config
+	return config, nil
+}
+
+func (rule RoutingRule) matches(severity string, tags []string) bool {
+	if rule.Severity != "" && !strings.EqualFold(rule.Severity, severity) {
+		return false
+	}
+	for _, want := range rule.Tags {
+		found := false
+		for _, tag := range tags {
+			found = found || strings.EqualFold(tag, want)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluate works out the routing for an incident with severity and tags.
+// It returns nil when no rule matches.
+func (r *RoutingStore) evaluate(severity string, tags []string) (*IncidentRouting, map[string][]string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var routing *IncidentRouting
+	steps := map[string][]string{}
+	for _, rule := range r.config.Rules {
+		if !rule.matches(severity, tags) {
+			continue
+		}
+		if routing == nil {
+			routing = &IncidentRouting{Rules: []string{}, Playbooks: []string{}, Channels: []string{}}
+		}
+		routing.Rules = append(routing.Rules, rule.Name)
+		routing.Playbooks = dedupeStrings(append(routing.Playbooks, rule.Playbooks...))
+		routing.Channels = dedupeStrings(append(routing.Channels, rule.Channels...))
+		if routing.Team == "" {
+			routing.Team = rule.Team
+		}
+	}
+	if routing != nil {
+		for _, playbook := range routing.Playbooks {
+			steps[playbook] = r.config.Playbooks[playbook]
+		}
+	}
+	return routing, steps
+}
+
+// routeIncident is registered as a store creation hook so API-created and
+// ingested incidents are routed the same way. It runs after auto-tagging,
+// so rules can match tags added there. Playbook steps become tasks, and
+// the team takes the incident unless it was created with an owner.
+func (r *RoutingStore) routeIncident(incident *Incident) {
+	routing, steps := r.evaluate(incident.Severity, incident.Tags)
+	if routing == nil {
+		return
+	}
+	incident.Routing = routing
+	for _, playbook := range routing.Playbooks {
+		for _, step := range steps[playbook] {
+			incident.Tasks = append(incident.Tasks, Task{
+				ID:        "TASK-" + padInt(len(incident.Tasks)+1),
+				Title:     playbook + ": " + step,
+				CreatedAt: incident.CreatedAt,
+			})
+		}
+	}
+	if routing.Team != "" && incident.Owner == "Unassigned" {
+		incident.Owner = routing.Team
+	}
+}
+
+// RoutingPreview is what routing would do for an incident with the given
+// severity and tags.
+type RoutingPreview struct {
+	Severity string   `json:"severity"`
+	Tags     []string `json:"tags"`
+}
+
+// routingHandler serves GET and PUT /api/routing, admin only. PUT replaces
+// the whole configuration.
+func routingHandler(routing *RoutingStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		if !isReadRequest(r) && !requireSharedConfig(w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, routing.get())
+		case http.MethodPut:
+			var input RoutingConfig
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			name, _ := actor(r.Context())
+			config, err := routing.replace(input, name)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, config)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// routingPreviewHandler serves POST /api/routing/preview, which evaluates
+// the configuration without creating anything.
+func routingPreviewHandler(routing *RoutingStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		var input RoutingPreview
+		if err := readJSON(r, &input); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		decision, steps := routing.evaluate(normalizeSeverity(fallback(input.Severity, "Medium")), input.Tags)
+		if decision == nil {
+			decision = &IncidentRouting{Rules: []string{}, Playbooks: []string{}, Channels: []string{}}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"routing": decision, "steps": steps})
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dispositions record what a closed incident turned out to be.
+const (
+	dispositionTruePositive  = "True Positive"
+	dispositionFalsePositive = "False Positive"
+	dispositionBenign        = "Benign"
+)
+
+var dispositions = []string{dispositionTruePositive, dispositionFalsePositive, dispositionBenign}
+
+// ruleTrendWeeks is how many weeks of false positives a rule's feedback
+// covers unless the report asks for another window.
+const ruleTrendWeeks = 4
+
+// normalizeDisposition matches value against dispositions ignoring case,
+// spaces, dashes, and underscores. "none" clears the disposition.
+func normalizeDisposition(value string) (string, bool) {
+	key := func(s string) string {
+		return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(s)))
+	}
+	wanted := key(value)
+	if wanted == "none" {
+		return "", true
+	}
+	for _, candidate := range dispositions {
+		if key(candidate) == wanted {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func dispositionError() string {
+	return "disposition must be one of " + strings.Join(dispositions, ", ") + " (or none)"
+}
+
+// RuleFeedback is how a rule's incidents were closed, so noisy detections
+// can be tuned.
+type RuleFeedback struct {
+	Closed              int        `json:"closed"`
+	FalsePositives      int        `json:"falsePositives"`
+	FalsePositiveRate   float64    `json:"falsePositiveRate"`
+	LastFalsePositiveAt *time.Time `json:"lastFalsePositiveAt,omitempty"`
+	// WeeklyFalsePositives counts false positives closed in each of the
+	// last weeks, oldest first.
+	WeeklyFalsePositives []int `json:"weeklyFalsePositives"`
+	// Trend compares the last week with the one before: rising, falling,
+	// or steady.
+	Trend string `json:"trend"`
+}
+
+// ruleOutcome is where one of a rule's incidents stands. seq is the store
+// event it came from, so a late event can't undo a newer one.
+type ruleOutcome struct {
+	closed        bool
+	falsePositive bool
+	closedAt      time.Time
+	seq           uint64
+}
+
+// watch feeds closures of incidents opened by a rule back to the rule.
+// Reopening an incident takes its closure back out.
+func (s *RuleStore) watch(store *IncidentStore) {
+	store.subscribe(s.recordOutcome)
+}
+
+func (s *RuleStore) recordOutcome(event IncidentEvent) {
+	incident := event.Incident
+	// A purged incident still counts against its rule.
+	if incident.RuleID == "" || event.Type == eventIncidentPurged {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[incident.RuleID]; !ok {
+		return
+	}
+	outcomes := s.outcomes[incident.RuleID]
+	if outcomes == nil {
+		outcomes = map[string]ruleOutcome{}
+		s.outcomes[incident.RuleID] = outcomes
+	}
+	if current, ok := outcomes[incident.ID]; ok && current.seq >= event.seq {
+		return
+	}
+	outcome := ruleOutcome{seq: event.seq}
+	if isClosedStatus(incident.Status) {
+		outcome.closed = true
+		outcome.falsePositive = incident.Disposition == dispositionFalsePositive
+		outcome.closedAt = incident.UpdatedAt
+		if incident.ClosedStats != nil {
+			outcome.closedAt = incident.ClosedStats.ClosedAt
+		}
+	}
+	outcomes[incident.ID] = outcome
+}
+
+// feedback summarizes a rule's outcomes over the last weeks. Callers must
+// hold s.mu.
+func (s *RuleStore) feedback(id string, weeks int, now time.Time) RuleFeedback {
+	feedback := RuleFeedback{WeeklyFalsePositives: make([]int, weeks), Trend: "steady"}
+	for _, outcome := range s.outcomes[id] {
+		if !outcome.closed {
+			continue
+		}
+		feedback.Closed++
+		if !outcome.falsePositive {
+			continue
+		}
+		feedback.FalsePositives++
+		if feedback.LastFalsePositiveAt == nil || outcome.closedAt.After(*feedback.LastFalsePositiveAt) {
+			closedAt := outcome.closedAt
+			feedback.LastFalsePositiveAt = &closedAt
+		}
+		if week := int(now.Sub(outcome.closedAt) / (7 * 24 * time.Hour)); week >= 0 && week < weeks {
+			feedback.WeeklyFalsePositives[weeks-1-week]++
+		}
+	}
+	if feedback.Closed > 0 {
+		feedback.FalsePositiveRate = math.Round(float64(feedback.FalsePositives)/float64(feedback.Closed)*100) / 100
+	}
+	if weeks >= 2 {
+		last, before := feedback.WeeklyFalsePositives[weeks-1], feedback.WeeklyFalsePositives[weeks-2]
+		switch {
+		case last > before:
+			feedback.Trend = "rising"
+		case last < before:
+			feedback.Trend = "falling"
+		}
+	}
+	return feedback
+}
+
+// RuleNoise is one row of the noisiest rules report. RecentFalsePositives
+// covers the report's window.
+type RuleNoise struct {
+	RuleID               string       `json:"ruleId"`
+	Title                string       `json:"title"`
+	Enabled              bool         `json:"enabled"`
+	Matches              int          `json:"matches"`
+	RecentFalsePositives int          `json:"recentFalsePositives"`
+	Feedback             RuleFeedback `json:"feedback"`
+}
+
+// noisiest ranks rules with false positives by how many they had in the
+// last weeks, then overall, then by false positive rate.
+func (s *RuleStore) noisiest(weeks, limit int, now time.Time) []RuleNoise {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []RuleNoise{}
+	for _, id := range s.order {
+		rule := s.rules[id]
+		feedback := s.feedback(id, weeks, now)
+		if feedback.FalsePositives == 0 {
+			continue
+		}
+		recent := 0
+		for _, count := range feedback.WeeklyFalsePositives {
+			recent += count
+		}
+		items = append(items, RuleNoise{
+			RuleID:               id,
+			Title:                rule.SigmaRule.Title,
+			Enabled:              rule.Enabled,
+			Matches:              rule.Matches,
+			RecentFalsePositives: recent,
+			Feedback:             feedback,
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.RecentFalsePositives != b.RecentFalsePositives {
+			return a.RecentFalsePositives > b.RecentFalsePositives
+		}
+		if a.Feedback.FalsePositives != b.Feedback.FalsePositives {
+			return a.Feedback.FalsePositives > b.Feedback.FalsePositives
+		}
+		return a.Feedback.FalsePositiveRate > b.Feedback.FalsePositiveRate
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+// ruleNoisiestHandler serves GET /api/rules/noisiest?weeks=4&limit=10.
+func ruleNoisiestHandler(rules *RuleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		params := r.URL.Query()
+		weeks, limit := ruleTrendWeeks, 10
+		for name, target := range map[string]*int{"weeks": &weeks, "limit": &limit} {
+			value := params.Get(name)
+			if value == "" {
+				continue
+			}
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || (name == "weeks" && parsed > 52) {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": name + " must be a positive integer (weeks at most 52)"})
+				return
+			}
+			*target = parsed
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"weeks": weeks, "items": rules.noisiest(weeks, limit, time.Now().UTC())})
+	}
+}
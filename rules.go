@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule is a stored Sigma rule. Source keeps the YAML exactly as submitted so
+// detection engineers can round-trip it.
+type Rule struct {
+	ID            string     `json:"id"`
+	SigmaRule     SigmaRule  `json:"rule"`
+	Enabled       bool       `json:"enabled"`
+	Source        string     `json:"source"`
+	Matches       int        `json:"matches"`
+	LastMatchedAt *time.Time `json:"lastMatchedAt,omitempty"`
+	// Feedback is filled in from the closures of the rule's incidents.
+	Feedback  RuleFeedback `json:"feedback"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+
+	compiled *SigmaRule
+}
+
+type RuleInput struct {
+	Source  string `json:"source"`
+	Enabled *bool  `json:"enabled"`
+}
+
+var errRuleNotFound = errors.New("rule not found")
+
+type RuleStore struct {
+	mu      sync.RWMutex
+	rules   map[string]*Rule
+	order   []string
+	counter int
+	// outcomes maps a rule ID to the outcome of each incident it opened.
+	outcomes map[string]map[string]ruleOutcome
+}
+
+func newRuleStore() *RuleStore {
+	return &RuleStore{rules: make(map[string]*Rule), order: []string{}, outcomes: map[string]map[string]ruleOutcome{}}
+}
+
+func (s *RuleStore) list() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]Rule, 0, len(s.order))
+	for _, id := range s.order {
+		items = append(items, s.withFeedback(s.rules[id]))
+	}
+	return items
+}
+
+// withFeedback copies rule with its current feedback. Callers must hold
+// s.mu.
+func (s *RuleStore) withFeedback(rule *Rule) Rule {
+	copied := *rule
+	copied.Feedback = s.feedback(rule.ID, ruleTrendWeeks, time.Now().UTC())
+	return copied
+}
+
+func (s *RuleStore) get(id string) (Rule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rule, ok := s.rules[id]
+	if !ok {
+		return Rule{}, false
+	}
+	return s.withFeedback(rule), true
+}
+
+func (s *RuleStore) create(input RuleInput) (Rule, error) {
+	compiled, err := compileSigmaRule(input.Source)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counter++
+	now := time.Now().UTC()
+	rule := &Rule{
+		ID:        "RULE-" + padInt(s.counter),
+		SigmaRule: *compiled,
+		Enabled:   input.Enabled == nil || *input.Enabled,
+		Source:    input.Source,
+		CreatedAt: now,
+		UpdatedAt: now,
+		compiled:  compiled,
+	}
+	s.rules[rule.ID] = rule
+	s.order = append(s.order, rule.ID)
+
+	return s.withFeedback(rule), nil
+}
+
+func (s *RuleStore) update(id string, input RuleInput) (Rule, error) {
+	var compiled *SigmaRule
+	if strings.TrimSpace(input.Source) != "" {
+		var err error
+		if compiled, err = compileSigmaRule(input.Source); err != nil {
+			return Rule{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule, ok := s.rules[id]
+	if !ok {
+		return Rule{}, errRuleNotFound
+	}
+	if compiled != nil {
+		rule.SigmaRule = *compiled
+		rule.Source = input.Source
+		rule.compiled = compiled
+	}
+	if input.Enabled != nil {
+		rule.Enabled = *input.Enabled
+	}
+	rule.UpdatedAt = time.Now().UTC()
+	return s.withFeedback(rule), nil
+}
+
+func (s *RuleStore) delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[id]; !ok {
+		return errRuleNotFound
+	}
+	delete(s.rules, id)
+	delete(s.outcomes, id)
+	for i, existing := range s.order {
+		if existing == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *RuleStore) recordMatches(id string, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rule, ok := s.rules[id]; ok {
+		now := time.Now().UTC()
+		rule.Matches += count
+		rule.LastMatchedAt = &now
+	}
+}
+
+// logsourceMatches reports whether a rule applies to events from the given
+// log source. Keys missing on either side don't constrain the match.
+func logsourceMatches(rule map[string]string, events map[string]string) bool {
+	for key, want := range events {
+		if have, ok := rule[key]; ok && have != "" && !strings.EqualFold(have, want) {
+			return false
+		}
+	}
+	return true
+}
+
+var sigmaLevelSeverity = map[string]string{
+	"informational": "Low",
+	"low":           "Low",
+	"medium":        "Medium",
+	"high":          "High",
+	"critical":      "Critical",
+}
+
+// sigmaIOCFields are event fields whose values are worth tracking as IOCs on
+// incidents opened from rule matches.
+var sigmaIOCFields = []string{
+	"SourceIp", "DestinationIp", "src_ip", "dest_ip", "dst_ip", "ClientIP", "IpAddress",
+	"DestinationHostname", "QueryName", "domain", "url",
+	"md5", "sha1", "sha256", "Hashes",
+}
+
+func sigmaEventIOCs(event map[string]any) []string {
+	iocs := []string{}
+	for _, field := range sigmaIOCFields {
+		values, _ := eventField(event, field)
+		for _, value := range values {
+			if field == "Hashes" {
+				// Sysmon style: "MD5=...,SHA256=..."
+				for _, part := range strings.Split(value, ",") {
+					if _, hash, ok := strings.Cut(part, "="); ok {
+						iocs = append(iocs, hash)
+					}
+				}
+				continue
+			}
+			iocs = append(iocs, value)
+		}
+	}
+	return iocs
+}
+
+type RuleEvaluationInput struct {
+	Events    []map[string]any  `json:"events"`
+	Logsource map[string]string `json:"logsource"`
+	DryRun    bool              `json:"dryRun"`
+}
+
+type RuleMatch struct {
+	RuleID     string `json:"ruleId"`
+	Title      string `json:"title"`
+	Level      string `json:"level,omitempty"`
+	Events     []int  `json:"events"`
+	IncidentID string `json:"incidentId,omitempty"`
+}
+
+type RuleEvaluationResult struct {
+	Evaluated int         `json:"evaluated"`
+	Matches   []RuleMatch `json:"matches"`
+	DryRun    bool        `json:"dryRun,omitempty"`
+}
+
+func (s *RuleStore) evaluate(input RuleEvaluationInput) []RuleMatch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matches := []RuleMatch{}
+	for _, id := range s.order {
+		rule := s.rules[id]
+		if !rule.Enabled || !logsourceMatches(rule.SigmaRule.Logsource, input.Logsource) {
+			continue
+		}
+		match := RuleMatch{RuleID: rule.ID, Title: rule.SigmaRule.Title, Level: rule.SigmaRule.Level, Events: []int{}}
+		for index, event := range input.Events {
+			if rule.compiled.matches(event) {
+				match.Events = append(match.Events, index)
+			}
+		}
+		if len(match.Events) > 0 {
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// openRuleIncident opens one incident per matched rule, carrying IOCs from
+// every matching event and the first event as evidence.
+func openRuleIncident(r *http.Request, store *IncidentStore, rule Rule, events []map[string]any, match RuleMatch) (Incident, error) {
+	input := IncidentInput{
+		Title:    "Sigma: " + rule.SigmaRule.Title,
+		Severity: fallback(sigmaLevelSeverity[rule.SigmaRule.Level], "Medium"),
+		Status:   "New",
+		Tags:     append([]string{"sigma"}, rule.SigmaRule.Tags...),
+		RuleID:   rule.ID,
+		Source:   "sigma",
+	}
+	for _, index := range match.Events {
+		input.IOCs = append(input.IOCs, sigmaEventIOCs(events[index])...)
+	}
+	input.Actor, input.ActorID = actor(r.Context())
+	input.Trace = traceFrom(r.Context())
+	input.Tenant = tenantFrom(r.Context())
+	incident := store.create(input)
+
+	evidence, _ := json.MarshalIndent(events[match.Events[0]], "", "  ")
+	if len(evidence) > 4000 {
+		evidence = append(evidence[:4000], []byte("\n...")...)
+	}
+	note := NoteInput{
+		Body:       "Rule " + rule.ID + " (" + fallback(rule.SigmaRule.ID, "no Sigma id") + ") matched " + strconv.Itoa(len(match.Events)) + " event(s). First match:\n" + string(evidence),
+		Author:     "Sigma engine",
+		AuthorType: authorTypeAutomation,
+	}
+	attributeNote(r.Context(), &note)
+	return store.addNote(incident.ID, note)
+}
+
+// readRuleInput accepts either raw YAML (Content-Type containing "yaml") or
+// a JSON RuleInput.
+func readRuleInput(r *http.Request) (RuleInput, error) {
+	if strings.Contains(r.Header.Get("Content-Type"), "yaml") {
+		source, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			return RuleInput{}, err
+		}
+		return RuleInput{Source: string(source)}, nil
+	}
+	var input RuleInput
+	err := readJSON(r, &input)
+	return input, err
+}
+
+func rulesHandler(rules *RuleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReadRequest(r) && (!requireRole(w, r, roleAdmin) || !requireSharedConfig(w, r)) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"items": rules.list()})
+		case http.MethodPost:
+			input, err := readRuleInput(r)
+			if err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			rule, err := rules.create(input)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid rule: " + err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, rule)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func ruleHandler(rules *RuleStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/rules/")
+		if id == "" || strings.Contains(id, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !isReadRequest(r) && (!requireRole(w, r, roleAdmin) || !requireSharedConfig(w, r)) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			rule, ok := rules.get(id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, rule)
+		case http.MethodPut:
+			input, err := readRuleInput(r)
+			if err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			rule, err := rules.update(id, input)
+			if errors.Is(err, errRuleNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid rule: " + err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, rule)
+		case http.MethodDelete:
+			if err := rules.delete(id); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func ruleEvaluateHandler(rules *RuleStore, store *IncidentStore, enrichment *EnrichmentService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var input RuleEvaluationInput
+		if err := readJSON(r, &input); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		if len(input.Events) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "events required"})
+			return
+		}
+
+		result := RuleEvaluationResult{Evaluated: len(input.Events), Matches: rules.evaluate(input), DryRun: input.DryRun}
+		if !input.DryRun {
+			for i, match := range result.Matches {
+				rule, ok := rules.get(match.RuleID)
+				if !ok {
+					continue
+				}
+				rules.recordMatches(rule.ID, len(match.Events))
+				incident, err := openRuleIncident(r, store, rule, input.Events, match)
+				if err != nil {
+					continue
+				}
+				result.Matches[i].IncidentID = incident.ID
+				enrichment.enqueue(incident.ID)
+			}
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
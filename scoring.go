@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SeverityScore explains a suggested severity: the points each signal
+// contributed, so analysts can judge whether to accept it.
+type SeverityScore struct {
+	Score   int           `json:"score"`
+	Factors []ScoreFactor `json:"factors"`
+}
+
+type ScoreFactor struct {
+	Signal string `json:"signal"`
+	Detail string `json:"detail"`
+	Points int    `json:"points"`
+}
+
+const (
+	signalBaseline   = "baseline"
+	signalWatchlist  = "watchlist"
+	signalFeed       = "threatFeed"
+	signalReputation = "reputation"
+	signalAssets     = "affectedAssets"
+	signalTactics    = "attackTactics"
+)
+
+// attackTactics weighs ATT&CK tactics by how far along an attack they
+// indicate it is.
+var attackTactics = map[string]int{
+	"reconnaissance":       0,
+	"resource_development": 0,
+	"initial_access":       5,
+	"discovery":            5,
+	"collection":           5,
+	"execution":            10,
+	"persistence":          10,
+	"privilege_escalation": 10,
+	"defense_evasion":      10,
+	"credential_access":    20,
+	"lateral_movement":     20,
+	"command_and_control":  20,
+	"exfiltration":         25,
+	"impact":               25,
+}
+
+var attackTacticIDs = map[string]string{
+	"ta0043": "reconnaissance",
+	"ta0042": "resource_development",
+	"ta0001": "initial_access",
+	"ta0002": "execution",
+	"ta0003": "persistence",
+	"ta0004": "privilege_escalation",
+	"ta0005": "defense_evasion",
+	"ta0006": "credential_access",
+	"ta0007": "discovery",
+	"ta0008": "lateral_movement",
+	"ta0009": "collection",
+	"ta0011": "command_and_control",
+	"ta0010": "exfiltration",
+	"ta0040": "impact",
+}
+
+var tacticSeparators = regexp.MustCompile(`[\s-]+`)
+
+// tagTactic recognises Sigma-style "attack.credential_access" tags, tactic
+// names, and tactic IDs such as "TA0006".
+func tagTactic(tag string) (string, bool) {
+	name := strings.ToLower(strings.TrimSpace(tag))
+	name = strings.TrimPrefix(name, "attack.")
+	name = strings.TrimPrefix(name, "mitre ")
+	name = tacticSeparators.ReplaceAllString(name, "_")
+	if tactic, ok := attackTacticIDs[name]; ok {
+		return tactic, true
+	}
+	if _, ok := attackTactics[name]; ok {
+		return name, true
+	}
+	return "", false
+}
+
+// scoredSeverity maps a score to a severity.
+func scoredSeverity(score int) string {
+	switch {
+	case score >= 70:
+		return "Critical"
+	case score >= 45:
+		return "High"
+	case score >= 20:
+		return "Medium"
+	}
+	return "Low"
+}
+
+func capPoints(points, limit int) int {
+	if points > limit {
+		return limit
+	}
+	return points
+}
+
+// scoreIncident computes the score from the incident's signals: watchlist
+// and threat feed hits, IOC reputation from enrichment, how many hosts are
+// involved, and the ATT&CK tactics in its tags.
+func scoreIncident(incident *Incident) SeverityScore {
+	score := SeverityScore{Factors: []ScoreFactor{{Signal: signalBaseline, Detail: "every incident", Points: 10}}}
+	add := func(signal, detail string, points int) {
+		if points > 0 {
+			score.Factors = append(score.Factors, ScoreFactor{Signal: signal, Detail: detail, Points: points})
+		}
+	}
+
+	watchlists := map[string]bool{}
+	for _, hit := range incident.WatchlistHits {
+		watchlists[hit.WatchlistName] = true
+	}
+	add(signalWatchlist, fmt.Sprintf("%d watchlist(s) matched", len(watchlists)), capPoints(20*len(watchlists), 40))
+
+	flagged := map[string]bool{}
+	for _, hit := range incident.FeedHits {
+		flagged[normalizeIOC(hit.Indicator)] = true
+	}
+	add(signalFeed, fmt.Sprintf("%d indicator(s) on threat feeds", len(flagged)), capPoints(20*len(flagged), 40))
+
+	worst, worstIOC := 0, ""
+	for _, enrichment := range incident.Enrichments {
+		value, ok := enrichment.Data["abuseConfidenceScore"]
+		if !ok {
+			continue
+		}
+		confidence, _ := strconv.Atoi(fmt.Sprint(value))
+		if confidence > worst {
+			worst, worstIOC = confidence, enrichment.IOC
+		}
+	}
+	switch {
+	case worst >= 75:
+		add(signalReputation, fmt.Sprintf("%s has abuse confidence %d", worstIOC, worst), 30)
+	case worst >= 25:
+		add(signalReputation, fmt.Sprintf("%s has abuse confidence %d", worstIOC, worst), 15)
+	}
+
+	hosts := map[string]bool{}
+	for _, alert := range incident.Alerts {
+		for _, host := range alert.Hosts {
+			hosts[strings.ToLower(host)] = true
+		}
+	}
+	for _, tag := range incident.Tags {
+		if host, ok := strings.CutPrefix(strings.ToLower(tag), "host:"); ok {
+			hosts[host] = true
+		}
+	}
+	switch count := len(hosts); {
+	case count >= 10:
+		add(signalAssets, fmt.Sprintf("%d hosts affected", count), 30)
+	case count >= 5:
+		add(signalAssets, fmt.Sprintf("%d hosts affected", count), 20)
+	case count >= 2:
+		add(signalAssets, fmt.Sprintf("%d hosts affected", count), 10)
+	}
+
+	tactics := map[string]bool{}
+	for _, tag := range incident.Tags {
+		if tactic, ok := tagTactic(tag); ok {
+			tactics[tactic] = true
+		}
+	}
+	if len(tactics) > 0 {
+		names := make([]string, 0, len(tactics))
+		highest := 0
+		for tactic := range tactics {
+			names = append(names, tactic)
+			if attackTactics[tactic] > highest {
+				highest = attackTactics[tactic]
+			}
+		}
+		sort.Strings(names)
+		// The most advanced tactic counts in full; each further tactic adds a
+		// little for breadth.
+		add(signalTactics, strings.Join(names, ", "), capPoints(highest+5*(len(tactics)-1), 35))
+	}
+
+	for _, factor := range score.Factors {
+		score.Score += factor.Points
+	}
+	score.Score = capPoints(score.Score, 100)
+	return score
+}
+
+// annotateSeverity sets the suggested severity and its breakdown. It must
+// run after the annotators whose hits it scores.
+func annotateSeverity(incident *Incident) {
+	score := scoreIncident(incident)
+	incident.SuggestedSeverity = scoredSeverity(score.Score)
+	incident.Scoring = &score
+}
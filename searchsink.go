@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SearchSink mirrors incidents and their notes into Elasticsearch or
+// OpenSearch indices with the _bulk API. Changes are coalesced per incident,
+// so a burst of updates is sent once, and failed batches are retried with
+// backoff until they go through.
+type SearchSink struct {
+	client            *http.Client
+	url               string
+	incidentIndex     string
+	noteIndex         string
+	apiKey            string
+	user              string
+	password          string
+	includeRestricted bool
+	batchSize         int
+
+	mu      sync.Mutex
+	pending map[string]Incident
+	order   []string
+	// purged incidents are deleted from the indices instead of indexed.
+	purged map[string]bool
+	wake   chan struct{}
+	status SearchSinkStatus
+}
+
+type SearchSinkStatus struct {
+	URL           string     `json:"url"`
+	IncidentIndex string     `json:"incidentIndex"`
+	NoteIndex     string     `json:"noteIndex"`
+	Pending       int        `json:"pending"`
+	Indexed       int        `json:"indexed"`
+	LastSyncAt    *time.Time `json:"lastSyncAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// searchIncidentDocument is the indexed incident. Notes go to their own index
+// so they can be searched and aggregated on their own.
+type searchIncidentDocument struct {
+	Incident
+	Notes     []Note    `json:"notes,omitempty"`
+	NoteCount int       `json:"noteCount"`
+	Timestamp time.Time `json:"@timestamp"`
+}
+
+type searchNoteDocument struct {
+	Note
+	IncidentID    string    `json:"incidentId"`
+	IncidentTitle string    `json:"incidentTitle"`
+	Timestamp     time.Time `json:"@timestamp"`
+}
+
+// newSearchSink returns nil unless SEARCH_SINK_URL is set.
+func newSearchSink() *SearchSink {
+	endpoint := strings.TrimRight(envString("SEARCH_SINK_URL", ""), "/")
+	if endpoint == "" {
+		return nil
+	}
+	return &SearchSink{
+		client:            newOutboundClient(),
+		url:               endpoint,
+		incidentIndex:     envString("SEARCH_SINK_INCIDENT_INDEX", "soc-incidents"),
+		noteIndex:         envString("SEARCH_SINK_NOTE_INDEX", "soc-notes"),
+		apiKey:            envString("SEARCH_SINK_API_KEY", ""),
+		user:              envString("SEARCH_SINK_USER", ""),
+		password:          envString("SEARCH_SINK_PASSWORD", ""),
+		includeRestricted: envBool("SEARCH_SINK_INCLUDE_RESTRICTED", false),
+		batchSize:         envInt("SEARCH_SINK_BATCH_SIZE", 100),
+		pending:           map[string]Incident{},
+		purged:            map[string]bool{},
+		wake:              make(chan struct{}, 1),
+	}
+}
+
+// start subscribes to store changes and queues every existing incident, so
+// the index is complete from the first run.
+func (s *SearchSink) start(store *IncidentStore) {
+	store.subscribe(func(event IncidentEvent) {
+		if event.Type == eventIncidentPurged {
+			s.mu.Lock()
+			s.purged[event.Incident.ID] = true
+			s.mu.Unlock()
+		}
+		s.enqueue(event.Incident)
+	})
+	s.reindex(store)
+	go s.run()
+}
+
+func (s *SearchSink) reindex(store *IncidentStore) int {
+	items := store.list()
+	for _, incident := range items {
+		s.enqueue(incident)
+	}
+	return len(items)
+}
+
+func (s *SearchSink) enqueue(incident Incident) {
+	s.mu.Lock()
+	if _, ok := s.pending[incident.ID]; !ok {
+		s.order = append(s.order, incident.ID)
+	}
+	s.pending[incident.ID] = incident
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take removes up to batchSize queued incidents, oldest first.
+func (s *SearchSink) take() []Incident {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := min(len(s.order), s.batchSize)
+	batch := make([]Incident, 0, count)
+	for _, id := range s.order[:count] {
+		batch = append(batch, s.pending[id])
+		delete(s.pending, id)
+	}
+	s.order = s.order[count:]
+	return batch
+}
+
+// requeue puts a failed batch back unless a newer version was queued since.
+func (s *SearchSink) requeue(batch []Incident) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(batch) - 1; i >= 0; i-- {
+		incident := batch[i]
+		if _, ok := s.pending[incident.ID]; ok {
+			continue
+		}
+		s.pending[incident.ID] = incident
+		s.order = append([]string{incident.ID}, s.order...)
+	}
+}
+
+func (s *SearchSink) run() {
+	backoff := time.Second
+	for range s.wake {
+		for {
+			batch := s.take()
+			if len(batch) == 0 {
+				break
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := s.send(ctx, batch)
+			cancel()
+			now := time.Now().UTC()
+			s.mu.Lock()
+			if err != nil {
+				s.status.LastError, s.status.LastErrorAt = err.Error(), &now
+			} else {
+				s.status.Indexed += len(batch)
+				s.status.LastSyncAt = &now
+			}
+			s.mu.Unlock()
+			if err == nil {
+				backoff = time.Second
+				continue
+			}
+			log.Printf("search sink: %v (retrying %d incidents in %s)", err, len(batch), backoff)
+			s.requeue(batch)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, time.Minute)
+		}
+	}
+}
+
+func (s *SearchSink) bulkBody(batch []Incident) ([]byte, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	line := func(action string, index, id string, document any) error {
+		if err := encoder.Encode(map[string]any{action: map[string]string{"_index": index, "_id": id}}); err != nil {
+			return err
+		}
+		if document == nil {
+			return nil
+		}
+		return encoder.Encode(document)
+	}
+
+	s.mu.Lock()
+	purged := map[string]bool{}
+	for _, incident := range batch {
+		purged[incident.ID] = s.purged[incident.ID]
+	}
+	s.mu.Unlock()
+
+	for _, incident := range batch {
+		// Purged and restricted cases are removed rather than indexed,
+		// including cases that became restricted after they were mirrored.
+		if purged[incident.ID] || incident.Restricted && !s.includeRestricted {
+			if err := line("delete", s.incidentIndex, incident.ID, nil); err != nil {
+				return nil, err
+			}
+			for _, note := range incident.Notes {
+				if err := line("delete", s.noteIndex, incident.ID+":"+note.ID, nil); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		document := searchIncidentDocument{Incident: incident, NoteCount: len(incident.Notes), Timestamp: incident.UpdatedAt}
+		if err := line("index", s.incidentIndex, incident.ID, document); err != nil {
+			return nil, err
+		}
+		for _, note := range incident.Notes {
+			noteDocument := searchNoteDocument{Note: note, IncidentID: incident.ID, IncidentTitle: incident.Title, Timestamp: note.CreatedAt}
+			if err := line("index", s.noteIndex, incident.ID+":"+note.ID, noteDocument); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return body.Bytes(), nil
+}
+
+type bulkResponse struct {
+	Errors bool                                `json:"errors"`
+	Items  []map[string]bulkResponseItemResult `json:"items"`
+}
+
+type bulkResponseItemResult struct {
+	ID     string          `json:"_id"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func (s *SearchSink) send(ctx context.Context, batch []Incident) error {
+	body, err := s.bulkBody(batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+"/_bulk", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case s.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.apiKey)
+	case s.user != "":
+		req.SetBasicAuth(s.user, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("POST %s/_bulk: %s: %s", s.url, resp.Status, bytes.TrimSpace(snippet))
+	}
+
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("POST %s/_bulk: %w", s.url, err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	for _, item := range result.Items {
+		for action, outcome := range item {
+			// Deleting a document that was never indexed is fine.
+			if outcome.Status < 300 || (action == "delete" && outcome.Status == http.StatusNotFound) {
+				continue
+			}
+			return fmt.Errorf("bulk %s %s: status %d: %s", action, outcome.ID, outcome.Status, outcome.Error)
+		}
+	}
+	return nil
+}
+
+func (s *SearchSink) currentStatus() SearchSinkStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.URL, status.IncidentIndex, status.NoteIndex = s.url, s.incidentIndex, s.noteIndex
+	status.Pending = len(s.order)
+	return status
+}
+
+// searchSinkHandler serves GET /api/admin/search-sink (sync status) and
+// POST (queue every incident for reindexing), admin only.
+func searchSinkHandler(sink *SearchSink, store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		if sink == nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "search sink not configured"})
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, sink.currentStatus())
+		case http.MethodPost:
+			queued := sink.reindex(store)
+			writeJSON(w, http.StatusAccepted, map[string]int{"queued": queued})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
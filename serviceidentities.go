@@ -0,0 +1,298 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const serviceKeyPrefix = "svc_"
+
+// ServiceIdentity is a non-human caller such as a playbook or connector. Its
+// key is only ever returned once, at creation or rotation.
+type ServiceIdentity struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Label      string     `json:"label"`
+	Icon       string     `json:"icon,omitempty"`
+	KeyPrefix  string     `json:"keyPrefix"`
+	Disabled   bool       `json:"disabled"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	keyHash    string
+}
+
+type ServiceIdentityInput struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Icon  string `json:"icon"`
+}
+
+type ServiceIdentityWithKey struct {
+	ServiceIdentity
+	Key string `json:"key"`
+}
+
+var (
+	errServiceIdentityNotFound = errors.New("service identity not found")
+	serviceNamePattern         = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+)
+
+type ServiceIdentityStore struct {
+	mu         sync.RWMutex
+	identities map[string]*ServiceIdentity
+	byHash     map[string]string
+	order      []string
+	counter    int
+}
+
+func newServiceIdentityStore() *ServiceIdentityStore {
+	return &ServiceIdentityStore{
+		identities: make(map[string]*ServiceIdentity),
+		byHash:     make(map[string]string),
+		order:      []string{},
+	}
+}
+
+func generateServiceKey() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return serviceKeyPrefix + hex.EncodeToString(raw), nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *ServiceIdentityStore) list() []ServiceIdentity {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]ServiceIdentity, 0, len(s.order))
+	for _, id := range s.order {
+		items = append(items, *s.identities[id])
+	}
+	return items
+}
+
+func (s *ServiceIdentityStore) get(id string) (ServiceIdentity, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	identity, ok := s.identities[id]
+	if !ok {
+		return ServiceIdentity{}, false
+	}
+	return *identity, true
+}
+
+func (s *ServiceIdentityStore) create(input ServiceIdentityInput) (ServiceIdentityWithKey, error) {
+	name := strings.ToLower(strings.TrimSpace(input.Name))
+	if !serviceNamePattern.MatchString(name) {
+		return ServiceIdentityWithKey{}, errors.New("name must be 2-63 lowercase letters, digits, or dashes")
+	}
+	key, err := generateServiceKey()
+	if err != nil {
+		return ServiceIdentityWithKey{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.identities {
+		if existing.Name == name {
+			return ServiceIdentityWithKey{}, errors.New("service identity name already in use")
+		}
+	}
+	s.counter++
+	identity := &ServiceIdentity{
+		ID:        "SVC-" + padInt(s.counter),
+		Name:      name,
+		Label:     fallback(strings.TrimSpace(input.Label), name),
+		Icon:      strings.TrimSpace(input.Icon),
+		KeyPrefix: key[:len(serviceKeyPrefix)+6],
+		CreatedAt: time.Now().UTC(),
+		keyHash:   hashKey(key),
+	}
+	s.identities[identity.ID] = identity
+	s.byHash[identity.keyHash] = identity.ID
+	s.order = append(s.order, identity.ID)
+
+	return ServiceIdentityWithKey{ServiceIdentity: *identity, Key: key}, nil
+}
+
+func (s *ServiceIdentityStore) update(id string, input ServiceIdentityInput) (ServiceIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identity, ok := s.identities[id]
+	if !ok {
+		return ServiceIdentity{}, errServiceIdentityNotFound
+	}
+	if strings.TrimSpace(input.Label) != "" {
+		identity.Label = strings.TrimSpace(input.Label)
+	}
+	if strings.TrimSpace(input.Icon) != "" {
+		identity.Icon = strings.TrimSpace(input.Icon)
+	}
+	return *identity, nil
+}
+
+// rotate issues a new key and invalidates the old one immediately.
+func (s *ServiceIdentityStore) rotate(id string) (ServiceIdentityWithKey, error) {
+	key, err := generateServiceKey()
+	if err != nil {
+		return ServiceIdentityWithKey{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identity, ok := s.identities[id]
+	if !ok {
+		return ServiceIdentityWithKey{}, errServiceIdentityNotFound
+	}
+	delete(s.byHash, identity.keyHash)
+	identity.keyHash = hashKey(key)
+	identity.KeyPrefix = key[:len(serviceKeyPrefix)+6]
+	s.byHash[identity.keyHash] = identity.ID
+
+	return ServiceIdentityWithKey{ServiceIdentity: *identity, Key: key}, nil
+}
+
+func (s *ServiceIdentityStore) disable(id string) (ServiceIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identity, ok := s.identities[id]
+	if !ok {
+		return ServiceIdentity{}, errServiceIdentityNotFound
+	}
+	identity.Disabled = true
+	return *identity, nil
+}
+
+func (s *ServiceIdentityStore) authenticate(key string) (Principal, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.byHash[hashKey(key)]
+	if !ok {
+		return Principal{}, false
+	}
+	identity := s.identities[id]
+	if identity.Disabled {
+		return Principal{}, false
+	}
+	now := time.Now().UTC()
+	identity.LastUsedAt = &now
+
+	return Principal{
+		ID:    identity.ID,
+		Name:  identity.Name,
+		Kind:  principalService,
+		Label: identity.Label,
+		Icon:  identity.Icon,
+	}, true
+}
+
+// serviceIdentitiesHandler serves GET and POST /api/service-identities,
+// admin only.
+func serviceIdentitiesHandler(identities *ServiceIdentityStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"items": identities.list()})
+		case http.MethodPost:
+			var input ServiceIdentityInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			created, err := identities.create(input)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, created)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// serviceIdentityHandler serves /api/service-identities/{id} and its
+// rotate action, admin only.
+func serviceIdentityHandler(identities *ServiceIdentityStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/service-identities/"), "/")
+		id := parts[0]
+		if id == "" || len(parts) > 2 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+
+		if len(parts) == 2 {
+			if parts[1] != "rotate" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			rotated, err := identities.rotate(id)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, rotated)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			identity, ok := identities.get(id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, identity)
+		case http.MethodPut:
+			var input ServiceIdentityInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			identity, err := identities.update(id, input)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, identity)
+		case http.MethodDelete:
+			identity, err := identities.disable(id)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, identity)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookie = "soc_session"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+// Session is a signed-in browser. Only the hash of its cookie is kept, so
+// the store can't be used to hijack one. A session ends at ExpiresAt, or
+// earlier once it has gone unused for the idle timeout.
+type Session struct {
+	Principal Principal `json:"principal"`
+	// IDToken is the identity provider's token, sent back as a hint when
+	// the user logs out.
+	IDToken string `json:"-"`
+	// CSRFToken must accompany the session's mutating requests in the
+	// X-CSRF-Token header; see csrfValid.
+	CSRFToken     string    `json:"-"`
+	CreatedAt     time.Time `json:"createdAt"`
+	LastSeenAt    time.Time `json:"lastSeenAt"`
+	IdleExpiresAt time.Time `json:"idleExpiresAt"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+}
+
+// SessionView answers GET /api/session: who the caller is and, for
+// browsers, their session and the CSRF token to send with writes.
+type SessionView struct {
+	Principal Principal `json:"principal"`
+	Session   *Session  `json:"session,omitempty"`
+	CSRFToken string    `json:"csrfToken,omitempty"`
+}
+
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	ttl      time.Duration
+	idle     time.Duration
+	secure   bool
+}
+
+func newSessionStore() *SessionStore {
+	return &SessionStore{
+		sessions: make(map[string]*Session),
+		ttl:      envDuration("SESSION_TTL", 8*time.Hour),
+		idle:     envDuration("SESSION_IDLE_TIMEOUT", 30*time.Minute),
+		secure:   envBool("SESSION_COOKIE_SECURE", true),
+	}
+}
+
+// size counts sessions, including expired ones not yet swept.
+func (s *SessionStore) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// randomToken returns n random bytes, base64url encoded.
+func randomToken(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func (s *SessionStore) expired(session *Session, now time.Time) bool {
+	return !now.Before(session.ExpiresAt) || !now.Before(session.IdleExpiresAt)
+}
+
+// touch records a use of the session, pushing back its idle expiry.
+func (s *SessionStore) touch(session *Session, now time.Time) {
+	session.LastSeenAt = now
+	session.IdleExpiresAt = now.Add(s.idle)
+	if session.IdleExpiresAt.After(session.ExpiresAt) {
+		session.IdleExpiresAt = session.ExpiresAt
+	}
+}
+
+// create starts a session and returns its cookie value.
+func (s *SessionStore) create(principal Principal, idToken string, now time.Time) (string, Session, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", Session{}, err
+	}
+	csrf, err := randomToken(32)
+	if err != nil {
+		return "", Session{}, err
+	}
+	session := &Session{Principal: principal, IDToken: idToken, CSRFToken: csrf, CreatedAt: now, ExpiresAt: now.Add(s.ttl)}
+	s.touch(session, now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, existing := range s.sessions {
+		if s.expired(existing, now) {
+			delete(s.sessions, hash)
+		}
+	}
+	s.sessions[hashKey(token)] = session
+	return token, *session, nil
+}
+
+func (s *SessionStore) lookup(token string, now time.Time) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := hashKey(token)
+	session, ok := s.sessions[hash]
+	if !ok {
+		return Session{}, false
+	}
+	if s.expired(session, now) {
+		delete(s.sessions, hash)
+		return Session{}, false
+	}
+	s.touch(session, now)
+	return *session, true
+}
+
+func (s *SessionStore) revoke(token string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := hashKey(token)
+	session, ok := s.sessions[hash]
+	if !ok {
+		return Session{}, false
+	}
+	delete(s.sessions, hash)
+	return *session, true
+}
+
+// fromRequest returns the session the request's cookie names, if it is
+// still live.
+func (s *SessionStore) fromRequest(r *http.Request) (Session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return Session{}, false
+	}
+	return s.lookup(cookie.Value, time.Now().UTC())
+}
+
+// csrfValid checks a cookie-authenticated request. Browsers send cookies
+// with requests other sites trigger, so writes must also carry the
+// session's CSRF token, which those sites can't read.
+func csrfValid(r *http.Request, session Session) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	token := r.Header.Get(csrfHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) == 1
+}
+
+func (s *SessionStore) view(principal Principal, session *Session) SessionView {
+	view := SessionView{Principal: principal, Session: session}
+	if session != nil {
+		view.CSRFToken = session.CSRFToken
+	}
+	return view
+}
+
+func (s *SessionStore) recordLogout(r *http.Request, audit *AuditLog, session Session) {
+	audit.record(AuditEvent{
+		Actor:      session.Principal.ID,
+		ActorType:  principalUser,
+		Action:     "auth.logout",
+		Resource:   r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	})
+}
+
+// sessionHandler serves GET /api/session, which tells any authenticated
+// caller who they are, and DELETE /api/session, which logs a browser out.
+func sessionHandler(sessions *SessionStore, audit *AuditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := principalFrom(r.Context())
+		if !ok {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			var current *Session
+			if session, ok := sessions.fromRequest(r); ok {
+				current = &session
+			}
+			writeJSON(w, http.StatusOK, sessions.view(principal, current))
+		case http.MethodDelete:
+			cookie, err := r.Cookie(sessionCookie)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "not a session; tokens and keys can't be logged out"})
+				return
+			}
+			if session, ok := sessions.revoke(cookie.Value); ok {
+				sessions.recordLogout(r, audit, session)
+			}
+			http.SetCookie(w, sessions.cookie("", time.Time{}))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// logoutHandler serves GET and POST /auth/logout, ending the caller's
+// session whichever login started it.
+func logoutHandler(sessions *SessionStore, oidc *OIDCProvider, audit *AuditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		target := "/"
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			if session, ok := sessions.revoke(cookie.Value); ok {
+				sessions.recordLogout(r, audit, session)
+				if oidc != nil {
+					target = oidc.afterLogout(r.Context(), session)
+				}
+			}
+		}
+		http.SetCookie(w, sessions.cookie("", time.Time{}))
+		http.Redirect(w, r, target, http.StatusFound)
+	}
+}
+
+// cookie is the session cookie for token; an empty token clears it.
+func (s *SessionStore) cookie(token string, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  expires,
+	}
+	if token == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
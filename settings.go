@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listSorts are the orders the incident list can be sorted in.
+var listSorts = []string{"risk", "sla", "age"}
+
+// Settings are server-side defaults every client gets for lists and
+// exports, so a dashboard that forgets to pass a filter or a limit still
+// gets a sane, bounded answer.
+type Settings struct {
+	// HideClosed leaves resolved and closed incidents out of the list
+	// unless the caller filters on status, passes a structured query or
+	// updatedSince, or asks for includeClosed.
+	HideClosed bool `json:"hideClosed"`
+	// DefaultSort applies when the caller passes no sort; empty keeps
+	// newest first.
+	DefaultSort string `json:"defaultSort"`
+	// DefaultPageSize is the list limit when the caller passes none; 0
+	// returns everything up to MaxPageSize.
+	DefaultPageSize int `json:"defaultPageSize"`
+	// MaxPageSize caps any list limit; 0 means no cap.
+	MaxPageSize int `json:"maxPageSize"`
+	// MaxExportRows refuses exports matching more incidents; 0 means no cap.
+	MaxExportRows int        `json:"maxExportRows"`
+	UpdatedAt     *time.Time `json:"updatedAt,omitempty"`
+	UpdatedBy     string     `json:"updatedBy,omitempty"`
+}
+
+type SettingsInput struct {
+	HideClosed      *bool   `json:"hideClosed"`
+	DefaultSort     *string `json:"defaultSort"`
+	DefaultPageSize *int    `json:"defaultPageSize"`
+	MaxPageSize     *int    `json:"maxPageSize"`
+	MaxExportRows   *int    `json:"maxExportRows"`
+}
+
+type SettingsStore struct {
+	mu       sync.RWMutex
+	settings Settings
+}
+
+func newSettingsStore() *SettingsStore {
+	store := &SettingsStore{settings: Settings{
+		HideClosed:      envBool("LIST_HIDE_CLOSED", false),
+		DefaultSort:     envString("LIST_DEFAULT_SORT", ""),
+		DefaultPageSize: envInt("LIST_DEFAULT_PAGE_SIZE", 0),
+		MaxPageSize:     envInt("LIST_MAX_PAGE_SIZE", 1000),
+		MaxExportRows:   envInt("EXPORT_MAX_ROWS", 10000),
+	}}
+	if err := store.settings.validate(); err != nil {
+		log.Printf("config: ignoring list settings: %v", err)
+		store.settings = Settings{MaxPageSize: 1000, MaxExportRows: 10000}
+	}
+	return store
+}
+
+func (s *SettingsStore) get() Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings
+}
+
+func (s Settings) validate() error {
+	switch {
+	case s.DefaultSort != "" && !validListSort(s.DefaultSort):
+		return errors.New("defaultSort must be empty or one of " + strings.Join(listSorts, ", "))
+	case s.DefaultPageSize < 0 || s.MaxPageSize < 0 || s.MaxExportRows < 0:
+		return errors.New("page sizes and export rows can't be negative")
+	case s.MaxPageSize > 0 && s.DefaultPageSize > s.MaxPageSize:
+		return errors.New("defaultPageSize can't be larger than maxPageSize")
+	}
+	return nil
+}
+
+func (s *SettingsStore) update(input SettingsInput, by string) (Settings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := s.settings
+	if input.HideClosed != nil {
+		settings.HideClosed = *input.HideClosed
+	}
+	if input.DefaultSort != nil {
+		settings.DefaultSort = strings.ToLower(strings.TrimSpace(*input.DefaultSort))
+	}
+	if input.DefaultPageSize != nil {
+		settings.DefaultPageSize = *input.DefaultPageSize
+	}
+	if input.MaxPageSize != nil {
+		settings.MaxPageSize = *input.MaxPageSize
+	}
+	if input.MaxExportRows != nil {
+		settings.MaxExportRows = *input.MaxExportRows
+	}
+	if err := settings.validate(); err != nil {
+		return Settings{}, err
+	}
+	now := time.Now().UTC()
+	settings.UpdatedAt, settings.UpdatedBy = &now, by
+	s.settings = settings
+	return settings, nil
+}
+
+func validListSort(by string) bool {
+	for _, candidate := range listSorts {
+		if by == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// sortIncidents orders items by one of listSorts.
+func sortIncidents(items []Incident, by string) {
+	switch by {
+	case "sla":
+		sortBySLA(items)
+	case "risk":
+		sortByRisk(items)
+	case "age":
+		sortByAge(items)
+	}
+}
+
+// sortByRisk puts the highest scored incidents first, then the most severe.
+func sortByRisk(items []Incident) {
+	score := func(incident Incident) int {
+		if incident.Scoring == nil {
+			return 0
+		}
+		return incident.Scoring.Score
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if a, b := score(items[i]), score(items[j]); a != b {
+			return a > b
+		}
+		return severityRank(items[i].Severity) > severityRank(items[j].Severity)
+	})
+}
+
+// IncidentPage is one page of the incident list. Limit is 0 when the list
+// isn't paged.
+type IncidentPage struct {
+	Items  []Incident `json:"items"`
+	Total  int        `json:"total"`
+	Offset int        `json:"offset"`
+	Limit  int        `json:"limit"`
+}
+
+// applyListSettings applies the list defaults the caller didn't override
+// and pages the result with limit and offset.
+func applyListSettings(w http.ResponseWriter, r *http.Request, items []Incident, settings Settings) (IncidentPage, bool) {
+	params := r.URL.Query()
+	if settings.HideClosed && params.Get("status") == "" && params.Get("query") == "" && params.Get("updatedSince") == "" && !strings.EqualFold(params.Get("includeClosed"), "true") {
+		open := make([]Incident, 0, len(items))
+		for _, incident := range items {
+			if !isClosedStatus(incident.Status) {
+				open = append(open, incident)
+			}
+		}
+		items = open
+	}
+	if params.Get("sort") == "" && settings.DefaultSort != "" {
+		sortIncidents(items, settings.DefaultSort)
+	}
+
+	page := IncidentPage{Total: len(items), Limit: settings.DefaultPageSize}
+	for name, target := range map[string]*int{"limit": &page.Limit, "offset": &page.Offset} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": name + " must be a non-negative integer"})
+			return IncidentPage{}, false
+		}
+		*target = parsed
+	}
+	if settings.MaxPageSize > 0 && (page.Limit == 0 || page.Limit > settings.MaxPageSize) {
+		page.Limit = settings.MaxPageSize
+	}
+
+	start := min(page.Offset, len(items))
+	end := len(items)
+	if page.Limit > 0 {
+		end = min(start+page.Limit, len(items))
+	}
+	page.Items = items[start:end]
+	return page, true
+}
+
+// settingsHandler serves GET /api/settings and, for admins, PUT.
+func settingsHandler(settings *SettingsStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReadRequest(r) && !requireSharedConfig(w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, settings.get())
+		case http.MethodPut:
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			var input SettingsInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			name, _ := actor(r.Context())
+			updated, err := settings.update(input, name)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, updated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// drainPoll is how often a drain checks whether its worker has caught up.
+const drainPoll = 50 * time.Millisecond
+
+// pendingWork counts what has been handed to a background worker and not
+// yet finished, so shutdown can wait for the worker to catch up.
+type pendingWork struct {
+	n atomic.Int64
+}
+
+func (p *pendingWork) add()  { p.n.Add(1) }
+func (p *pendingWork) done() { p.n.Add(-1) }
+
+// drain waits until nothing is pending or ctx ends. It returns how much
+// was left undone.
+func (p *pendingWork) drain(ctx context.Context) int64 {
+	ticker := time.NewTicker(drainPoll)
+	defer ticker.Stop()
+	for {
+		left := p.n.Load()
+		if left <= 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return left
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainer is a background worker that can be flushed before exit.
+type drainer struct {
+	name  string
+	drain func(ctx context.Context) int64
+}
+
+// serve runs server until ctx is done, which a shutdown signal does, and
+// then stops it: it stops accepting connections, waits up to grace for
+// requests in flight, and gives the background workers what is left of
+// the grace period to send what they have queued. Streams on the change
+// feed are ended first so open dashboards don't hold the server up.
+func serve(ctx context.Context, server *http.Server, feed *ChangeFeed, grace time.Duration, drainers []drainer) error {
+	server.RegisterOnShutdown(feed.close)
+	errs := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			// The certificates are in TLSConfig already.
+			errs <- server.ListenAndServeTLS("", "")
+			return
+		}
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, waiting up to %s for requests and queued deliveries", grace)
+	deadline, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := server.Shutdown(deadline); err != nil {
+		log.Printf("shutdown: %v; closing remaining connections", err)
+		server.Close()
+	}
+	for _, drainer := range drainers {
+		if left := drainer.drain(deadline); left > 0 {
+			log.Printf("shutdown: %d %s left undelivered", left, drainer.name)
+		}
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// runEvery calls fn in the background on every tick of interval until ctx
+// is done, which stops the schedulers at shutdown.
+func runEvery(ctx context.Context, interval time.Duration, fn func(now time.Time)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				fn(now)
+			}
+		}
+	}()
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SigmaRule is a compiled Sigma detection rule. Only the detection and
+// condition parts are evaluated; aggregations (count, near) are rejected.
+type SigmaRule struct {
+	ID             string            `json:"sigmaId,omitempty"`
+	Title          string            `json:"title"`
+	Description    string            `json:"description,omitempty"`
+	Status         string            `json:"status,omitempty"`
+	Level          string            `json:"level,omitempty"`
+	Tags           []string          `json:"tags"`
+	Logsource      map[string]string `json:"logsource,omitempty"`
+	FalsePositives []string          `json:"falsepositives,omitempty"`
+
+	selections map[string]sigmaSelection
+	condition  sigmaExpr
+}
+
+// sigmaSelection matches when any group matches (every matcher in a group
+// must match) or any keyword appears in the event.
+type sigmaSelection struct {
+	groups   [][]sigmaMatcher
+	keywords []sigmaPattern
+}
+
+type sigmaMatcher struct {
+	field    string
+	patterns []sigmaPattern
+	all      bool
+	// null matches fields that are absent or empty.
+	null bool
+	// exists is set by the |exists modifier.
+	exists *bool
+}
+
+type sigmaPattern func(value string) bool
+
+func compileSigmaRule(source string) (*SigmaRule, error) {
+	document, err := parseYAML(source)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := document.(map[string]any)
+	if !ok {
+		return nil, errors.New("rule must be a YAML mapping")
+	}
+
+	rule := &SigmaRule{
+		ID:             yamlString(root["id"]),
+		Title:          strings.TrimSpace(yamlString(root["title"])),
+		Description:    strings.TrimSpace(yamlString(root["description"])),
+		Status:         yamlString(root["status"]),
+		Level:          strings.ToLower(yamlString(root["level"])),
+		Tags:           yamlStrings(root["tags"]),
+		FalsePositives: yamlStrings(root["falsepositives"]),
+		selections:     map[string]sigmaSelection{},
+	}
+	if rule.Title == "" {
+		return nil, errors.New("rule title is required")
+	}
+	if logsource, ok := root["logsource"].(map[string]any); ok {
+		rule.Logsource = map[string]string{}
+		for key, value := range logsource {
+			rule.Logsource[key] = yamlString(value)
+		}
+	}
+
+	detection, ok := root["detection"].(map[string]any)
+	if !ok {
+		return nil, errors.New("rule detection is required")
+	}
+	var conditions []string
+	switch condition := detection["condition"].(type) {
+	case string:
+		conditions = []string{condition}
+	case []any:
+		conditions = yamlStrings(condition)
+	default:
+		return nil, errors.New("detection condition is required")
+	}
+	for name, definition := range detection {
+		if name == "condition" || name == "timeframe" {
+			continue
+		}
+		selection, err := compileSigmaSelection(definition)
+		if err != nil {
+			return nil, fmt.Errorf("selection %s: %w", name, err)
+		}
+		rule.selections[name] = selection
+	}
+
+	var exprs []sigmaExpr
+	for _, condition := range conditions {
+		expr, err := parseSigmaCondition(condition, rule.selections)
+		if err != nil {
+			return nil, fmt.Errorf("condition %q: %w", condition, err)
+		}
+		exprs = append(exprs, expr)
+	}
+	rule.condition = func(eval func(string) bool) bool {
+		for _, expr := range exprs {
+			if expr(eval) {
+				return true
+			}
+		}
+		return false
+	}
+	return rule, nil
+}
+
+func yamlString(value any) string {
+	if value == nil {
+		return ""
+	}
+	if text, ok := value.(string); ok {
+		return text
+	}
+	return fmt.Sprint(value)
+}
+
+func yamlStrings(value any) []string {
+	items := []string{}
+	switch value := value.(type) {
+	case []any:
+		for _, item := range value {
+			if item != nil {
+				items = append(items, yamlString(item))
+			}
+		}
+	case string:
+		items = append(items, value)
+	}
+	return items
+}
+
+func compileSigmaSelection(definition any) (sigmaSelection, error) {
+	var selection sigmaSelection
+	switch definition := definition.(type) {
+	case map[string]any:
+		group, err := compileSigmaGroup(definition)
+		if err != nil {
+			return selection, err
+		}
+		selection.groups = append(selection.groups, group)
+	case []any:
+		for _, item := range definition {
+			if fields, ok := item.(map[string]any); ok {
+				group, err := compileSigmaGroup(fields)
+				if err != nil {
+					return selection, err
+				}
+				selection.groups = append(selection.groups, group)
+				continue
+			}
+			pattern, err := compileSigmaPattern(yamlString(item), []string{"contains"})
+			if err != nil {
+				return selection, err
+			}
+			selection.keywords = append(selection.keywords, pattern)
+		}
+	case string:
+		pattern, err := compileSigmaPattern(definition, []string{"contains"})
+		if err != nil {
+			return selection, err
+		}
+		selection.keywords = append(selection.keywords, pattern)
+	default:
+		return selection, errors.New("must be a mapping or a list")
+	}
+	return selection, nil
+}
+
+func compileSigmaGroup(fields map[string]any) ([]sigmaMatcher, error) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	group := make([]sigmaMatcher, 0, len(keys))
+	for _, key := range keys {
+		parts := strings.Split(key, "|")
+		matcher := sigmaMatcher{field: parts[0]}
+		modifiers := []string{}
+		for _, modifier := range parts[1:] {
+			switch modifier {
+			case "all":
+				matcher.all = true
+			case "exists":
+				exists := strings.EqualFold(yamlString(fields[key]), "true") || strings.EqualFold(yamlString(fields[key]), "yes")
+				matcher.exists = &exists
+			default:
+				modifiers = append(modifiers, modifier)
+			}
+		}
+		if matcher.exists != nil {
+			group = append(group, matcher)
+			continue
+		}
+
+		var values []any
+		switch value := fields[key].(type) {
+		case nil:
+			matcher.null = true
+		case []any:
+			values = value
+		default:
+			values = []any{value}
+		}
+		for _, value := range values {
+			if value == nil {
+				matcher.null = true
+				continue
+			}
+			pattern, err := compileSigmaPattern(yamlString(value), modifiers)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			matcher.patterns = append(matcher.patterns, pattern)
+		}
+		group = append(group, matcher)
+	}
+	return group, nil
+}
+
+func compileSigmaPattern(value string, modifiers []string) (sigmaPattern, error) {
+	mode := ""
+	for _, modifier := range modifiers {
+		switch modifier {
+		case "contains", "startswith", "endswith", "re", "cidr", "gt", "gte", "lt", "lte":
+			if mode != "" {
+				return nil, fmt.Errorf("modifiers %s and %s cannot be combined", mode, modifier)
+			}
+			mode = modifier
+		case "i", "m", "s":
+			// Regular expression flags; matching is already handled below.
+		default:
+			return nil, fmt.Errorf("unsupported modifier %q", modifier)
+		}
+	}
+
+	switch mode {
+	case "re":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	case "cidr":
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(candidate string) bool {
+			addr, err := netip.ParseAddr(candidate)
+			return err == nil && prefix.Contains(addr.Unmap())
+		}, nil
+	case "gt", "gte", "lt", "lte":
+		limit, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s needs a number", mode)
+		}
+		return func(candidate string) bool {
+			number, err := strconv.ParseFloat(candidate, 64)
+			if err != nil {
+				return false
+			}
+			switch mode {
+			case "gt":
+				return number > limit
+			case "gte":
+				return number >= limit
+			case "lt":
+				return number < limit
+			}
+			return number <= limit
+		}, nil
+	case "contains":
+		value = "*" + value + "*"
+	case "startswith":
+		value = value + "*"
+	case "endswith":
+		value = "*" + value
+	}
+	return sigmaWildcard(value), nil
+}
+
+// sigmaWildcard compiles a Sigma string value: case-insensitive, with * and
+// ? wildcards that can be escaped with a backslash.
+func sigmaWildcard(value string) sigmaPattern {
+	if !strings.ContainsAny(value, "*?") {
+		return func(candidate string) bool { return strings.EqualFold(candidate, value) }
+	}
+	var pattern strings.Builder
+	pattern.WriteString("(?is)^")
+	literal := strings.Builder{}
+	flush := func() {
+		pattern.WriteString(regexp.QuoteMeta(literal.String()))
+		literal.Reset()
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value) && strings.IndexByte(`*?\`, value[i+1]) >= 0:
+			literal.WriteByte(value[i+1])
+			i++
+		case c == '*':
+			flush()
+			pattern.WriteString(".*")
+		case c == '?':
+			flush()
+			pattern.WriteString(".")
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	flush()
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String()).MatchString
+}
+
+// matches reports whether event triggers the rule.
+func (rule *SigmaRule) matches(event map[string]any) bool {
+	results := map[string]bool{}
+	return rule.condition(func(name string) bool {
+		if result, ok := results[name]; ok {
+			return result
+		}
+		result := rule.selections[name].matches(event)
+		results[name] = result
+		return result
+	})
+}
+
+func (selection sigmaSelection) matches(event map[string]any) bool {
+	for _, keyword := range selection.keywords {
+		if eventContains(event, keyword) {
+			return true
+		}
+	}
+	for _, group := range selection.groups {
+		matched := true
+		for _, matcher := range group {
+			if !matcher.matches(event) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (matcher sigmaMatcher) matches(event map[string]any) bool {
+	values, present := eventField(event, matcher.field)
+	if matcher.exists != nil {
+		return present == *matcher.exists
+	}
+	if matcher.null && (!present || len(values) == 0 || (len(values) == 1 && values[0] == "")) {
+		return true
+	}
+	if len(matcher.patterns) == 0 {
+		return false
+	}
+	for _, pattern := range matcher.patterns {
+		matched := false
+		for _, value := range values {
+			if pattern(value) {
+				matched = true
+				break
+			}
+		}
+		if matcher.all && !matched {
+			return false
+		}
+		if !matcher.all && matched {
+			return true
+		}
+	}
+	return matcher.all
+}
+
+// eventField looks a field up by exact name, then case-insensitively, then as
+// a dotted path into nested objects. Arrays yield one value per element.
+func eventField(event map[string]any, field string) ([]string, bool) {
+	if value, ok := event[field]; ok {
+		return flattenEventValue(value), value != nil
+	}
+	for key, value := range event {
+		if strings.EqualFold(key, field) {
+			return flattenEventValue(value), value != nil
+		}
+	}
+	if head, rest, ok := strings.Cut(field, "."); ok {
+		for key, value := range event {
+			if nested, isMap := value.(map[string]any); isMap && strings.EqualFold(key, head) {
+				return eventField(nested, rest)
+			}
+		}
+	}
+	return nil, false
+}
+
+func flattenEventValue(value any) []string {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{value}
+	case float64:
+		return []string{strconv.FormatFloat(value, 'f', -1, 64)}
+	case bool:
+		return []string{strconv.FormatBool(value)}
+	case []any:
+		values := []string{}
+		for _, item := range value {
+			values = append(values, flattenEventValue(item)...)
+		}
+		return values
+	default:
+		encoded, _ := json.Marshal(value)
+		return []string{string(encoded)}
+	}
+}
+
+func eventContains(value any, pattern sigmaPattern) bool {
+	switch value := value.(type) {
+	case map[string]any:
+		for _, nested := range value {
+			if eventContains(nested, pattern) {
+				return true
+			}
+		}
+	case []any:
+		for _, nested := range value {
+			if eventContains(nested, pattern) {
+				return true
+			}
+		}
+	case nil:
+	default:
+		for _, text := range flattenEventValue(value) {
+			if pattern(text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sigmaExpr evaluates a condition given a lookup of selection results.
+type sigmaExpr func(eval func(name string) bool) bool
+
+func parseSigmaCondition(condition string, selections map[string]sigmaSelection) (sigmaExpr, error) {
+	if strings.Contains(condition, "|") {
+		return nil, errors.New("aggregation conditions are not supported")
+	}
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(condition))
+	parser := &sigmaConditionParser{tokens: tokens, selections: selections}
+	expr, err := parser.or()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(tokens) {
+		return nil, fmt.Errorf("unexpected %q", tokens[parser.pos])
+	}
+	return expr, nil
+}
+
+type sigmaConditionParser struct {
+	tokens     []string
+	pos        int
+	selections map[string]sigmaSelection
+}
+
+func (p *sigmaConditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return strings.ToLower(p.tokens[p.pos])
+	}
+	return ""
+}
+
+func (p *sigmaConditionParser) or() (sigmaExpr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(eval func(string) bool) bool { return l(eval) || right(eval) }
+	}
+	return left, nil
+}
+
+func (p *sigmaConditionParser) and() (sigmaExpr, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.pos++
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(eval func(string) bool) bool { return l(eval) && right(eval) }
+	}
+	return left, nil
+}
+
+func (p *sigmaConditionParser) not() (sigmaExpr, error) {
+	if p.peek() == "not" {
+		p.pos++
+		inner, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(eval func(string) bool) bool { return !inner(eval) }, nil
+	}
+	return p.primary()
+}
+
+func (p *sigmaConditionParser) primary() (sigmaExpr, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, errors.New("unexpected end of condition")
+	case "(":
+		p.pos++
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return expr, nil
+	case "1", "all", "any":
+		if p.pos+2 < len(p.tokens) && strings.EqualFold(p.tokens[p.pos+1], "of") {
+			target := p.tokens[p.pos+2]
+			p.pos += 3
+			names, err := p.resolve(target)
+			if err != nil {
+				return nil, err
+			}
+			if token == "all" {
+				return func(eval func(string) bool) bool {
+					for _, name := range names {
+						if !eval(name) {
+							return false
+						}
+					}
+					return true
+				}, nil
+			}
+			return func(eval func(string) bool) bool {
+				for _, name := range names {
+					if eval(name) {
+						return true
+					}
+				}
+				return false
+			}, nil
+		}
+	}
+
+	name := p.tokens[p.pos]
+	if _, ok := p.selections[name]; !ok {
+		return nil, fmt.Errorf("unknown selection %q", name)
+	}
+	p.pos++
+	return func(eval func(string) bool) bool { return eval(name) }, nil
+}
+
+// resolve expands "them" or a selection name pattern such as selection_*.
+func (p *sigmaConditionParser) resolve(target string) ([]string, error) {
+	names := []string{}
+	match := sigmaWildcard(target)
+	for name := range p.selections {
+		if target == "them" && !strings.HasPrefix(name, "_") || match(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no selections match %q", target)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const sitrepHighlightLimit = 5
+
+type SitrepHighlight struct {
+	At   time.Time `json:"at"`
+	Text string    `json:"text"`
+}
+
+type Sitrep struct {
+	IncidentID  string            `json:"incidentId"`
+	Title       string            `json:"title"`
+	Severity    string            `json:"severity"`
+	Status      string            `json:"status"`
+	Owner       string            `json:"owner"`
+	Major       bool              `json:"major"`
+	Highlights  []SitrepHighlight `json:"highlights"`
+	OpenTasks   []Task            `json:"openTasks"`
+	Text        string            `json:"text"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+	PostedTo    string            `json:"postedTo,omitempty"`
+	NoteID      string            `json:"noteId,omitempty"`
+}
+
+type SitrepInput struct {
+	// Post sends the report to the incident's war room.
+	Post bool `json:"post"`
+	// Record saves the report as a sitrep note, satisfying the major
+	// incident sitrep timer.
+	Record bool   `json:"record"`
+	Author string `json:"author"`
+}
+
+func buildSitrep(incident Incident, now time.Time) Sitrep {
+	report := Sitrep{
+		IncidentID:  incident.ID,
+		Title:       incident.Title,
+		Severity:    incident.Severity,
+		Status:      incident.Status,
+		Owner:       incident.Owner,
+		Major:       incident.Major,
+		Highlights:  sitrepHighlights(incident),
+		OpenTasks:   openTasks(incident.Tasks),
+		GeneratedAt: now,
+	}
+
+	var b strings.Builder
+	b.WriteString("SITREP " + incident.ID + " as of " + now.Format("2006-01-02 15:04 UTC") + "\n")
+	b.WriteString(incident.Title + "\n")
+	b.WriteString("Status: " + incident.Status + " | Severity: " + incident.Severity + " | Owner: " + incident.Owner + "\n")
+	if len(report.Highlights) > 0 {
+		b.WriteString("\nHighlights:\n")
+		for _, highlight := range report.Highlights {
+			b.WriteString("- " + highlight.At.Format("15:04") + " " + highlight.Text + "\n")
+		}
+	}
+	b.WriteString("\nOpen tasks:\n")
+	if len(report.OpenTasks) == 0 {
+		b.WriteString("- none\n")
+	}
+	for _, task := range report.OpenTasks {
+		line := "- " + task.Title
+		if task.Assignee != "" {
+			line += " (" + task.Assignee + ")"
+		}
+		b.WriteString(line + "\n")
+	}
+	report.Text = strings.TrimSpace(b.String())
+	return report
+}
+
+// sitrepHighlights picks the most recent notable moments on the incident,
+// newest first.
+func sitrepHighlights(incident Incident) []SitrepHighlight {
+	highlights := []SitrepHighlight{{At: incident.CreatedAt, Text: "Incident opened"}}
+	if incident.MajorSince != nil {
+		highlights = append(highlights, SitrepHighlight{At: *incident.MajorSince, Text: "Declared major incident"})
+	}
+	if incident.WarRoom != nil {
+		highlights = append(highlights, SitrepHighlight{At: incident.WarRoom.CreatedAt, Text: "War room opened: " + incident.WarRoom.URL})
+	}
+	for _, task := range incident.Tasks {
+		if task.CompletedAt != nil {
+			highlights = append(highlights, SitrepHighlight{At: *task.CompletedAt, Text: "Completed: " + task.Title})
+		}
+	}
+	for _, note := range incident.Notes {
+		highlights = append(highlights, SitrepHighlight{At: note.CreatedAt, Text: note.Author + ": " + note.Body})
+	}
+
+	sort.SliceStable(highlights, func(i, j int) bool {
+		return highlights[i].At.After(highlights[j].At)
+	})
+	if len(highlights) > sitrepHighlightLimit {
+		highlights = highlights[:sitrepHighlightLimit]
+	}
+	return highlights
+}
+
+func handleIncidentSitrep(w http.ResponseWriter, r *http.Request, id string, store *IncidentStore, warRooms *WarRoomService, access *AccessLog) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var input SitrepInput
+	if err := readJSON(r, &input); err != nil && !errors.Is(err, io.EOF) {
+		writeBodyError(w, err)
+		return
+	}
+	incident, ok := store.get(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	access.record(r, id, accessExport)
+	report := buildSitrep(*incident, time.Now().UTC())
+	if input.Post {
+		if incident.WarRoom == nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "incident has no war room"})
+			return
+		}
+		if err := warRooms.post(r.Context(), *incident.WarRoom, report.Text); err != nil {
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+			return
+		}
+		report.PostedTo = incident.WarRoom.URL
+	}
+	if input.Record {
+		updated, err := store.addNote(id, NoteInput{
+			Body:   report.Text,
+			Author: fallback(input.Author, "Sitrep generator"),
+			Kind:   noteKindSitrep,
+		})
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		report.NoteID = updated.Notes[0].ID
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// startSitrepAutoPost posts a generated sitrep into the war room of every
+// open major incident each interval. Auto-posts are not recorded as sitrep
+// notes, so they never satisfy the human sitrep requirement.
+func startSitrepAutoPost(ctx context.Context, store *IncidentStore, warRooms *WarRoomService, every time.Duration) {
+	if every <= 0 {
+		return
+	}
+	runEvery(ctx, every, func(now time.Time) {
+		for _, incident := range store.list() {
+			if !incident.Major || incident.WarRoom == nil || isClosedStatus(incident.Status) {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			report := buildSitrep(incident, now.UTC())
+			if err := warRooms.post(ctx, *incident.WarRoom, report.Text); err != nil {
+				log.Printf("sitrep autopost %s: %v", incident.ID, err)
+			}
+			cancel()
+		}
+	})
+}
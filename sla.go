@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SLAPolicy is how long an incident of a severity may wait for a response
+// (leaving New) and for containment (Contained, Resolved, or Closed).
+type SLAPolicy struct {
+	Severity string
+	Respond  time.Duration
+	Contain  time.Duration
+}
+
+// SLAState is an incident's position against its policy. Both timers run
+// from creation; a timer is breached when it was met late or is overdue.
+type SLAState struct {
+	Policy              string     `json:"policy"`
+	RespondBy           time.Time  `json:"respondBy"`
+	RespondedAt         *time.Time `json:"respondedAt,omitempty"`
+	ResponseBreached    bool       `json:"responseBreached"`
+	ContainBy           time.Time  `json:"containBy"`
+	ContainedAt         *time.Time `json:"containedAt,omitempty"`
+	ContainmentBreached bool       `json:"containmentBreached"`
+}
+
+var defaultSLAPolicies = "critical=15m/4h,high=1h/24h,medium=4h/72h,low=24h/168h"
+
+// slaPolicies maps lower-case severities to policies, read from
+// SLA_POLICIES as "severity=respond/contain,..." on first use.
+var slaPolicies = sync.OnceValue(func() map[string]SLAPolicy {
+	return parseSLAPolicies(envString("SLA_POLICIES", defaultSLAPolicies))
+})
+
+func parseSLAPolicies(value string) map[string]SLAPolicy {
+	policies := map[string]SLAPolicy{}
+	for _, entry := range sanitizeSlice(strings.Split(value, ",")) {
+		severity, timers, ok := strings.Cut(entry, "=")
+		respondValue, containValue, hasContain := strings.Cut(timers, "/")
+		respond, respondErr := time.ParseDuration(strings.TrimSpace(respondValue))
+		contain, containErr := time.ParseDuration(strings.TrimSpace(containValue))
+		if !ok || !hasContain || respondErr != nil || containErr != nil {
+			log.Printf("ignoring SLA policy %q: want severity=respond/contain, e.g. critical=15m/4h", entry)
+			continue
+		}
+		severity = strings.ToLower(strings.TrimSpace(severity))
+		policies[severity] = SLAPolicy{Severity: severity, Respond: respond, Contain: contain}
+	}
+	return policies
+}
+
+func containedStatus(status string) bool {
+	return strings.EqualFold(strings.TrimSpace(status), "Contained") || isClosedStatus(status)
+}
+
+// slaMilestones finds when the incident first left New and first reached
+// containment, from its status history.
+func slaMilestones(incident *Incident) (responded, contained *time.Time) {
+	for _, change := range incident.history {
+		if change.Field != "status" {
+			continue
+		}
+		at := change.At
+		if responded == nil && !strings.EqualFold(change.Value, "New") {
+			responded = &at
+		}
+		if contained == nil && containedStatus(change.Value) {
+			contained = &at
+		}
+	}
+	return responded, contained
+}
+
+func timerBreached(due time.Time, metAt *time.Time, now time.Time) bool {
+	if metAt != nil {
+		return metAt.After(due)
+	}
+	return now.After(due)
+}
+
+// annotateSLA sets the SLA state, the next unmet deadline, and whether any
+// timer is breached. Breaches of unmet timers depend on the clock, so the SLA
+// monitor re-runs annotators to catch them.
+func annotateSLA(incident *Incident) {
+	policy, ok := slaPolicies()[strings.ToLower(incident.Severity)]
+	if !ok {
+		incident.SLA, incident.SLADueAt, incident.SLABreached = nil, nil, false
+		return
+	}
+	now := time.Now().UTC()
+	responded, contained := slaMilestones(incident)
+	state := &SLAState{
+		Policy:      policy.Severity,
+		RespondBy:   incident.CreatedAt.Add(policy.Respond),
+		RespondedAt: responded,
+		ContainBy:   incident.CreatedAt.Add(policy.Contain),
+		ContainedAt: contained,
+	}
+	state.ResponseBreached = timerBreached(state.RespondBy, responded, now)
+	state.ContainmentBreached = timerBreached(state.ContainBy, contained, now)
+
+	var due *time.Time
+	switch {
+	case responded == nil:
+		due = &state.RespondBy
+	case contained == nil:
+		due = &state.ContainBy
+	}
+	incident.SLA = state
+	incident.SLADueAt = due
+	incident.SLABreached = state.ResponseBreached || state.ContainmentBreached
+}
+
+// sortBySLA puts breached incidents first, then the nearest deadline; those
+// with nothing due come last.
+func sortBySLA(items []Incident) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.SLABreached != b.SLABreached {
+			return a.SLABreached
+		}
+		switch {
+		case a.SLADueAt == nil || b.SLADueAt == nil:
+			return a.SLADueAt != nil
+		default:
+			return a.SLADueAt.Before(*b.SLADueAt)
+		}
+	})
+}
+
+// slaListParams applies the list endpoint's slaBreached filter and sort.
+func slaListParams(w http.ResponseWriter, r *http.Request, items []Incident) ([]Incident, bool) {
+	params := r.URL.Query()
+	if value := params.Get("slaBreached"); value != "" {
+		breached := strings.EqualFold(value, "true")
+		if !breached && !strings.EqualFold(value, "false") {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "slaBreached must be true or false"})
+			return nil, false
+		}
+		filtered := make([]Incident, 0, len(items))
+		for _, incident := range items {
+			if incident.SLABreached == breached {
+				filtered = append(filtered, incident)
+			}
+		}
+		items = filtered
+	}
+	if by := params.Get("sort"); by != "" {
+		if !validListSort(by) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "sort must be one of " + strings.Join(listSorts, ", ")})
+			return nil, false
+		}
+		sortIncidents(items, by)
+	}
+	return items, true
+}
+
+// startSLAMonitor re-runs annotators every interval so timers that run out
+// between changes are marked breached (which emits an update).
+func startSLAMonitor(ctx context.Context, store *IncidentStore, every time.Duration) {
+	if every <= 0 {
+		return
+	}
+	runEvery(ctx, every, func(time.Time) {
+		store.reannotate()
+	})
+}
+
+type slaPolicyView struct {
+	Severity       string `json:"severity"`
+	Respond        string `json:"respond"`
+	Contain        string `json:"contain"`
+	RespondSeconds int64  `json:"respondSeconds"`
+	ContainSeconds int64  `json:"containSeconds"`
+}
+
+func slaPoliciesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		items := []slaPolicyView{}
+		for _, policy := range slaPolicies() {
+			items = append(items, slaPolicyView{
+				Severity:       policy.Severity,
+				Respond:        policy.Respond.String(),
+				Contain:        policy.Contain.String(),
+				RespondSeconds: int64(policy.Respond / time.Second),
+				ContainSeconds: int64(policy.Contain / time.Second),
+			})
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].RespondSeconds < items[j].RespondSeconds })
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	slackActionAcknowledge = "incident_acknowledge"
+	slackActionStatus      = "incident_status"
+)
+
+// slackTarget posts new and updated incidents to a channel as Block Kit
+// messages with buttons to acknowledge the incident or change its status.
+// Clicks come back to slackActionsHandler.
+type slackTarget struct {
+	client  *http.Client
+	token   string
+	baseURL string
+	channel string
+}
+
+// newSlackTarget returns nil unless SLACK_BOT_TOKEN is set. Without
+// SLACK_NOTIFY_CHANNEL, incidents only go to the channels routing sends them
+// to.
+func newSlackTarget() *slackTarget {
+	token := envString("SLACK_BOT_TOKEN", "")
+	channel := envString("SLACK_NOTIFY_CHANNEL", "")
+	if token == "" {
+		return nil
+	}
+	return &slackTarget{
+		client:  newOutboundClient(),
+		token:   token,
+		baseURL: envString("SLACK_API_URL", "https://slack.com/api"),
+		channel: channel,
+	}
+}
+
+func (s *slackTarget) name() string { return "slack" }
+
+func (s *slackTarget) send(ctx context.Context, notification Notification) error {
+	if notification.Event != eventIncidentCreated && notification.Event != eventIncidentUpdated {
+		return nil
+	}
+	channels := sanitizeSlice([]string{s.channel})
+	if routing := notification.Incident.Routing; routing != nil {
+		channels = dedupeStrings(append(channels, routing.Channels...))
+	}
+	for _, channel := range channels {
+		var resp slackResponse
+		payload := map[string]any{
+			"channel": channel,
+			"text":    notification.Message,
+			"blocks":  slackIncidentBlocks(notification.Incident, notification.Message),
+		}
+		if err := doJSON(ctx, s.client, http.MethodPost, s.baseURL+"/chat.postMessage", bearer(s.token), payload, &resp); err != nil {
+			return err
+		}
+		if !resp.OK {
+			return errors.New("slack: " + channel + ": " + resp.Error)
+		}
+	}
+	return nil
+}
+
+func slackText(kind, text string) map[string]any {
+	return map[string]any{"type": kind, "text": text}
+}
+
+// slackIncidentBlocks renders an incident with its actions. Restricted
+// cases get no actions: whoever is in the channel isn't necessarily cleared
+// for them.
+func slackIncidentBlocks(incident Incident, message string) []map[string]any {
+	title := fallback(incident.Title, "Restricted case")
+	blocks := []map[string]any{
+		{"type": "section", "text": slackText("mrkdwn", "*"+incident.ID+"* "+title+"\n"+message)},
+		{"type": "section", "fields": []map[string]any{
+			slackText("mrkdwn", "*Severity*\n"+incident.Severity),
+			slackText("mrkdwn", "*Status*\n"+incident.Status),
+			slackText("mrkdwn", "*Owner*\n"+fallback(incident.Owner, "Unassigned")),
+		}},
+	}
+	if incident.Restricted || isClosedStatus(incident.Status) {
+		return blocks
+	}
+
+	options := []map[string]any{}
+	for _, status := range currentTaxonomies().statusNames() {
+		if status == incident.Status {
+			continue
+		}
+		options = append(options, map[string]any{"text": slackText("plain_text", status), "value": incident.ID + "|" + status})
+	}
+	elements := []map[string]any{}
+	if strings.EqualFold(incident.Status, "New") {
+		elements = append(elements, map[string]any{
+			"type":      "button",
+			"action_id": slackActionAcknowledge,
+			"text":      slackText("plain_text", "Acknowledge"),
+			"style":     "primary",
+			"value":     incident.ID,
+		})
+	}
+	elements = append(elements, map[string]any{
+		"type":        "static_select",
+		"action_id":   slackActionStatus,
+		"placeholder": slackText("plain_text", "Change status"),
+		"options":     options,
+	})
+	return append(blocks, map[string]any{"type": "actions", "block_id": "incident:" + incident.ID, "elements": elements})
+}
+
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+		Name     string `json:"name"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID       string `json:"action_id"`
+		Value          string `json:"value"`
+		SelectedOption struct {
+			Value string `json:"value"`
+		} `json:"selected_option"`
+	} `json:"actions"`
+}
+
+// verifySlackSignature checks the v0 request signature Slack computes over
+// the timestamp and raw body, rejecting requests older than five minutes so
+// captured ones can't be replayed.
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) bool {
+	timestamp, err := strconv.ParseInt(header.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > 5*time.Minute || age < -5*time.Minute {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + strconv.FormatInt(timestamp, 10) + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature")))
+}
+
+// slackAction turns a clicked action into the update it asks for.
+func slackAction(store *IncidentStore, actionID, value, selected, actor string) (string, IncidentUpdate, error) {
+	var id string
+	update := IncidentUpdate{}
+	switch actionID {
+	case slackActionAcknowledge:
+		id = value
+		update.Status = "Investigating"
+	case slackActionStatus:
+		var status string
+		var ok bool
+		id, status, ok = strings.Cut(selected, "|")
+		if !ok {
+			return "", update, errors.New("unrecognized status option")
+		}
+		update.Status = status
+	default:
+		return "", update, errors.New("unrecognized action " + actionID)
+	}
+
+	incident, ok := store.get(id)
+	if !ok {
+		return "", update, errIncidentNotFound
+	}
+	if incident.Restricted {
+		return "", update, errors.New("restricted cases can't be changed from Slack")
+	}
+	if actionID == slackActionAcknowledge && (incident.Owner == "" || strings.EqualFold(incident.Owner, "Unassigned")) {
+		update.Owner = actor
+	}
+	return id, update, nil
+}
+
+// slackActionsHandler serves POST /api/integrations/slack/actions, Slack's
+// interactivity request URL. The reply goes to the interaction's
+// response_url: the message is replaced with the updated incident, or the
+// clicker alone is told why the change was refused.
+func slackActionsHandler(store *IncidentStore) http.HandlerFunc {
+	secret := envString("SLACK_SIGNING_SECRET", "")
+	client := newOutboundClient()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if secret == "" {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "slack interactivity not configured"})
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !verifySlackSignature(secret, r.Header, body, time.Now()) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid slack signature"})
+			return
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var interaction slackInteraction
+		if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil || interaction.Type != "block_actions" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		actor := fallback(interaction.User.Username, interaction.User.Name)
+		for _, action := range interaction.Actions {
+			id, update, err := slackAction(store, action.ActionID, action.Value, action.SelectedOption.Value, actor)
+			var reply map[string]any
+			if err == nil {
+				update.Actor, update.ActorID = "Slack: "+actor, "slack:"+interaction.User.ID
+				update.Trace = traceFrom(r.Context())
+				var updated Incident
+				updated, err = store.update(id, update)
+				if err == nil {
+					message := updated.ID + " set to " + updated.Status + " by " + actor + " from Slack"
+					reply = map[string]any{"replace_original": true, "text": message, "blocks": slackIncidentBlocks(updated, message)}
+				}
+			}
+			if err != nil {
+				reply = map[string]any{"response_type": "ephemeral", "replace_original": false, "text": "Couldn't update the incident: " + err.Error()}
+			}
+			go respondToSlack(context.WithoutCancel(r.Context()), client, interaction.ResponseURL, reply)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// respondToSlack posts to an interaction's response_url, which must be
+// Slack's own so a forged payload can't make us call elsewhere.
+func respondToSlack(parent context.Context, client *http.Client, responseURL string, reply map[string]any) {
+	target, err := url.Parse(responseURL)
+	if err != nil || target.Scheme != "https" || target.Hostname() != "hooks.slack.com" {
+		log.Printf("slack: ignoring response_url %q", responseURL)
+		return
+	}
+	ctx, cancel := context.WithTimeout(parent, 10*time.Second)
+	defer cancel()
+	if err := doJSON(ctx, client, http.MethodPost, responseURL, nil, reply, nil); err != nil {
+		log.Printf("slack: responding to interaction: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// writeSSE writes one event in text/event-stream framing. data must not
+// contain newlines; JSON from encoding/json never does.
+func writeSSE(w io.Writer, id, event string, data []byte) error {
+	var frame strings.Builder
+	if id != "" {
+		frame.WriteString("id: " + id + "\n")
+	}
+	frame.WriteString("event: " + event + "\n")
+	frame.WriteString("data: " + string(data) + "\n\n")
+	_, err := io.WriteString(w, frame.String())
+	return err
+}
+
+// eventStreamHandler serves GET /api/events/stream, the change feed as
+// Server-Sent Events for clients that can't use WebSockets. Each event's id
+// is its change feed cursor, so a reconnecting EventSource resumes from
+// Last-Event-ID on its own. A cursor the feed no longer has gets a resync
+// event carrying the current cursor; the client should reload the list.
+func eventStreamHandler(feed *ChangeFeed) http.HandlerFunc {
+	keepalive := envDuration("SSE_KEEPALIVE_INTERVAL", 15*time.Second)
+	if keepalive <= 0 {
+		keepalive = 15 * time.Second
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		controller := http.NewResponseController(w)
+		// Streams outlive the server's write timeout.
+		controller.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		lastEventID := fallback(r.Header.Get("Last-Event-ID"), r.URL.Query().Get("lastEventId"))
+		seq, err := feed.parseCursor(lastEventID)
+		ticker := time.NewTicker(keepalive)
+		defer ticker.Stop()
+		for {
+			var changes []Change
+			var changed <-chan struct{}
+			if err == nil {
+				changes, changed, _, err = feed.since(seq)
+			}
+			if err != nil {
+				cursor := feed.current()
+				seq, _ = feed.parseCursor(cursor)
+				payload, _ := json.Marshal(map[string]string{"cursor": cursor, "error": err.Error()})
+				if writeSSE(w, cursor, "resync", payload) != nil {
+					return
+				}
+				err = nil
+				controller.Flush()
+				continue
+			}
+			for _, change := range changes {
+				seq = change.seq
+				if !canView(r, change.Incident) {
+					continue
+				}
+				payload, _ := json.Marshal(change)
+				if writeSSE(w, change.Cursor, change.Type, payload) != nil {
+					return
+				}
+			}
+			if controller.Flush() != nil {
+				return
+			}
+			select {
+			case <-changed:
+			case <-ticker.C:
+				// A comment line keeps proxies from closing an idle stream.
+				if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			case <-feed.closing:
+				return
+			}
+		}
+	}
+}
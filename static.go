@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type staticFile struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// StaticAssets serves the frontend with content-hash ETags. HTML is always
+// revalidated and has its script and stylesheet references rewritten to
+// "app.js?v=<hash>", which are then cached as immutable, so a deploy is
+// picked up on the next page load.
+type StaticAssets struct {
+	dir    string
+	files  http.Handler
+	mu     sync.Mutex
+	hashes map[string]staticFile
+}
+
+func newStaticAssets(dir string) *StaticAssets {
+	return &StaticAssets{dir: dir, files: http.FileServer(http.Dir(dir)), hashes: map[string]staticFile{}}
+}
+
+// hash returns the content hash of a file below dir, recomputing it when
+// the file's size or modification time changes.
+func (s *StaticAssets) hash(name string) (string, bool) {
+	full := filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+name)))
+	stat, err := os.Stat(full)
+	if err != nil || stat.IsDir() {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cached, ok := s.hashes[full]; ok && cached.modTime.Equal(stat.ModTime()) && cached.size == stat.Size() {
+		return cached.hash, true
+	}
+	content, err := os.ReadFile(full)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:6])
+	s.hashes[full] = staticFile{modTime: stat.ModTime(), size: stat.Size(), hash: hash}
+	return hash, true
+}
+
+// fingerprint hashes every asset's hash, so it changes when any file does.
+func (s *StaticAssets) fingerprint() string {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return ""
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	combined := sha256.New()
+	for _, name := range names {
+		hash, _ := s.hash(name)
+		combined.Write([]byte(name + "=" + hash + "\n"))
+	}
+	return hex.EncodeToString(combined.Sum(nil)[:6])
+}
+
+var assetReference = regexp.MustCompile(`(src|href)="([A-Za-z0-9_./-]+\.(?:js|css))"`)
+
+func (s *StaticAssets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Path
+	if strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	hash, ok := s.hash(name)
+	if !ok {
+		s.files.ServeHTTP(w, r)
+		return
+	}
+
+	if strings.HasSuffix(name, ".html") {
+		content, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+name))))
+		if err != nil {
+			s.files.ServeHTTP(w, r)
+			return
+		}
+		content = assetReference.ReplaceAllFunc(content, func(match []byte) []byte {
+			parts := assetReference.FindSubmatch(match)
+			reference := path.Join(path.Dir(name), string(parts[2]))
+			if assetHash, ok := s.hash(reference); ok {
+				return []byte(string(parts[1]) + `="` + string(parts[2]) + "?v=" + assetHash + `"`)
+			}
+			return match
+		})
+		sum := sha256.Sum256(content)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:6])+`"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+		return
+	}
+
+	w.Header().Set("ETag", `"`+hash+`"`)
+	if r.URL.Query().Get("v") == hash {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	s.files.ServeHTTP(w, r)
+}
@@ -21,6 +21,17 @@ function formatChip(value) {
   return span;
 }
 
+function flaggedIndicators(incident) {
+  const flagged = new Map();
+  (incident.feedHits || []).forEach((hit) => flagged.set(hit.indicator, hit.feedName));
+  (incident.watchlistHits || []).forEach((hit) => {
+    if (!flagged.has(hit.indicator)) {
+      flagged.set(hit.indicator, hit.watchlistName);
+    }
+  });
+  return flagged;
+}
+
 function formatSeverity(severity) {
   const span = document.createElement("span");
   span.className = `badge severity-${severity.toLowerCase()}`;
@@ -28,8 +39,39 @@ function formatSeverity(severity) {
   return span;
 }
 
-async function fetchJSON(url, options) {
-  const response = await fetch(url, options);
+// The signed-in session, fetched once per page: its CSRF token goes with
+// every write, and the tenant to work in goes with every request unless the
+// session is bound to one. Cross-tenant users pick a tenant with ?tenant=,
+// which is remembered for later pages.
+let sessionInfo;
+
+function currentSession() {
+  if (!sessionInfo) {
+    const requested = new URLSearchParams(window.location.search).get("tenant");
+    if (requested) {
+      localStorage.setItem("tenant", requested);
+    }
+    sessionInfo = fetch("/api/session")
+      .then((response) => (response.ok ? response.json() : {}))
+      .catch(() => ({}))
+      .then((view) => ({
+        csrfToken: view.csrfToken || "",
+        tenant: view.principal && view.principal.tenant ? "" : localStorage.getItem("tenant") || "",
+      }));
+  }
+  return sessionInfo;
+}
+
+async function fetchJSON(url, options = {}) {
+  const { csrfToken, tenant } = await currentSession();
+  const headers = { ...options.headers };
+  if (csrfToken && !["GET", "HEAD", "OPTIONS"].includes((options.method || "GET").toUpperCase())) {
+    headers["X-CSRF-Token"] = csrfToken;
+  }
+  if (tenant) {
+    headers["X-Tenant"] = tenant;
+  }
+  const response = await fetch(url, { ...options, headers });
   if (!response.ok) {
     throw new Error("Request failed");
   }
@@ -78,6 +120,11 @@ function renderIncidents(items) {
     const tagsCell = document.createElement("span");
     tagsCell.className = "chip-row";
     incident.tags.slice(0, 3).forEach((tag) => tagsCell.appendChild(formatChip(tag)));
+    if ((incident.feedHits || []).length > 0) {
+      const known = formatChip("Known bad");
+      known.classList.add("flagged");
+      tagsCell.prepend(known);
+    }
 
     row.append(idCell, titleCell, severityCell, statusCell, ownerCell, updatedCell, tagsCell);
     table.appendChild(row);
@@ -200,7 +247,15 @@ function renderDetail(incident) {
 
   const iocs = $("detail-iocs");
   iocs.innerHTML = "";
-  (incident.iocs || []).forEach((item) => iocs.appendChild(formatChip(item)));
+  const flagged = flaggedIndicators(incident);
+  (incident.iocs || []).forEach((item) => {
+    const chip = formatChip(item);
+    if (flagged.has(item)) {
+      chip.classList.add("flagged");
+      chip.title = `Listed in ${flagged.get(item)}`;
+    }
+    iocs.appendChild(chip);
+  });
   if (!incident.iocs || incident.iocs.length === 0) {
     iocs.appendChild(formatChip("No indicators"));
   }
@@ -295,11 +350,63 @@ async function loadDetail() {
   }
 }
 
+// Prompt for a reload once the server reports a different build than the
+// one this page was loaded from.
+async function watchVersion() {
+  let loaded;
+  try {
+    loaded = (await fetchJSON("/api/version")).build;
+  } catch (error) {
+    return;
+  }
+  setInterval(async () => {
+    try {
+      const current = await fetchJSON("/api/version");
+      if (current.build !== loaded && !document.querySelector(".update-banner")) {
+        const banner = document.createElement("div");
+        banner.className = "update-banner";
+        banner.innerHTML = `<span>A new version (${current.version}) is available.</span>`;
+        const button = document.createElement("button");
+        button.textContent = "Reload";
+        button.addEventListener("click", () => window.location.reload());
+        banner.appendChild(button);
+        document.body.appendChild(banner);
+      }
+    } catch (error) {
+      // The server is restarting; try again on the next tick.
+    }
+  }, 60000);
+}
+
+// Reload the list whenever the server pushes a change, batching bursts.
+// Reconnects with a growing delay if the connection drops.
+function watchChanges(reload, delay = 1000) {
+  if (!("WebSocket" in window)) {
+    return;
+  }
+  const scheme = window.location.protocol === "https:" ? "wss" : "ws";
+  const socket = new WebSocket(`${scheme}://${window.location.host}/api/ws`);
+  let pending;
+  socket.addEventListener("open", () => {
+    delay = 1000;
+  });
+  socket.addEventListener("message", () => {
+    clearTimeout(pending);
+    pending = setTimeout(reload, 250);
+  });
+  socket.addEventListener("close", () => {
+    setTimeout(() => watchChanges(reload, Math.min(delay * 2, 30000)), delay);
+  });
+}
+
+watchVersion();
+
 const page = document.body.dataset.page;
 if (page === "list") {
   loadList();
   bindCreateForm();
   bindFilters();
+  watchChanges(loadList);
 }
 
 if (page === "detail") {
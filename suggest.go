@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	suggestDefaultLimit = 10
+	suggestMaxLimit     = 50
+)
+
+// suggestFields are the incident fields GET /api/suggest completes.
+var suggestFields = map[string]func(Incident) []string{
+	"tags": func(incident Incident) []string { return dedupeStrings(incident.Tags) },
+	"owner": func(incident Incident) []string {
+		if owner := strings.TrimSpace(incident.Owner); owner != "" {
+			return []string{owner}
+		}
+		return nil
+	},
+}
+
+type Suggestion struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// suggestEntry counts the incidents using a value. Public leaves out
+// restricted incidents, so their tags and owners aren't offered to callers
+// who can't see them.
+type suggestEntry struct {
+	value  string
+	count  int
+	public int
+}
+
+// SuggestIndex keeps the values each suggest field takes in each tenant,
+// keyed by lower case and kept sorted, so a prefix lookup is a binary
+// search rather than a scan of every incident.
+type SuggestIndex struct {
+	mu      sync.Mutex
+	entries map[string]map[string]*suggestEntry
+	sorted  map[string][]string
+}
+
+func newSuggestIndex(store *IncidentStore) *SuggestIndex {
+	index := &SuggestIndex{entries: map[string]map[string]*suggestEntry{}, sorted: map[string][]string{}}
+	for _, incident := range store.list() {
+		index.add(incident, 1)
+	}
+	store.subscribe(index.apply)
+	return index
+}
+
+func (s *SuggestIndex) apply(event IncidentEvent) {
+	if event.Previous != nil {
+		s.add(*event.Previous, -1)
+	}
+	if event.Type == eventIncidentPurged {
+		s.add(event.Incident, -1)
+		return
+	}
+	s.add(event.Incident, 1)
+}
+
+// add counts incident's values, or uncounts them when delta is -1.
+func (s *SuggestIndex) add(incident Incident, delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for field, values := range suggestFields {
+		field = tenantScoped(incident.Tenant, field)
+		entries := s.entries[field]
+		if entries == nil {
+			entries = map[string]*suggestEntry{}
+			s.entries[field] = entries
+		}
+		for _, value := range values(incident) {
+			key := strings.ToLower(value)
+			entry, ok := entries[key]
+			if !ok {
+				if delta < 0 {
+					continue
+				}
+				entry = &suggestEntry{value: value}
+				entries[key] = entry
+				s.sorted[field] = nil
+			}
+			entry.count += delta
+			if !incident.Restricted {
+				entry.public += delta
+			}
+			if entry.count <= 0 {
+				delete(entries, key)
+				s.sorted[field] = nil
+			}
+		}
+	}
+}
+
+// suggest returns up to limit values of field in tenant starting with
+// prefix, most used first.
+func (s *SuggestIndex) suggest(tenant, field, prefix string, limit int, cleared bool) []Suggestion {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	field = tenantScoped(tenant, field)
+
+	s.mu.Lock()
+	keys := s.sorted[field]
+	if keys == nil {
+		keys = make([]string, 0, len(s.entries[field]))
+		for key := range s.entries[field] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		s.sorted[field] = keys
+	}
+	items := []Suggestion{}
+	for i := sort.SearchStrings(keys, prefix); i < len(keys) && strings.HasPrefix(keys[i], prefix); i++ {
+		entry := s.entries[field][keys[i]]
+		count := entry.public
+		if cleared {
+			count = entry.count
+		}
+		if count > 0 {
+			items = append(items, Suggestion{Value: entry.value, Count: count})
+		}
+	}
+	s.mu.Unlock()
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Count > items[j].Count })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+// suggestHandler serves GET /api/suggest?field=tags|owner&prefix=&limit=.
+func suggestHandler(index *SuggestIndex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		field := strings.ToLower(query.Get("field"))
+		if _, ok := suggestFields[field]; !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "field must be tags or owner"})
+			return
+		}
+		limit := suggestDefaultLimit
+		if value := query.Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > suggestMaxLimit {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and " + itoa(suggestMaxLimit)})
+				return
+			}
+			limit = parsed
+		}
+		prefix := query.Get("prefix")
+		writeJSON(w, http.StatusOK, map[string]any{
+			"field":  field,
+			"prefix": prefix,
+			"items":  index.suggest(tenantFrom(r.Context()), field, prefix, limit, callerCleared(r)),
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type IncidentSummary struct {
+	Text        string    `json:"text"`
+	Source      string    `json:"source"`
+	GeneratedAt time.Time `json:"generatedAt"`
+}
+
+// Summarizer produces a "summary so far" for responders joining an incident.
+type Summarizer interface {
+	name() string
+	summarize(ctx context.Context, incident Incident) (string, error)
+}
+
+type SummaryService struct {
+	primary  Summarizer
+	fallback Summarizer
+}
+
+func newSummaryService() *SummaryService {
+	service := &SummaryService{fallback: templateSummarizer{}}
+	if endpoint := envString("SUMMARY_LLM_URL", ""); endpoint != "" {
+		service.primary = &llmSummarizer{
+			client: newOutboundClient(),
+			url:    endpoint,
+			token:  envString("SUMMARY_LLM_TOKEN", ""),
+			model:  envString("SUMMARY_LLM_MODEL", "gpt-4o-mini"),
+		}
+	}
+	return service
+}
+
+// summarize prefers the external model and falls back to the template so a
+// flaky LLM endpoint never leaves responders without a summary.
+func (s *SummaryService) summarize(ctx context.Context, incident Incident) IncidentSummary {
+	if s.primary != nil {
+		text, err := s.primary.summarize(ctx, incident)
+		if err == nil && strings.TrimSpace(text) != "" {
+			return IncidentSummary{Text: strings.TrimSpace(text), Source: s.primary.name(), GeneratedAt: time.Now().UTC()}
+		}
+		if err != nil {
+			log.Printf("summary %s via %s: %v", incident.ID, s.primary.name(), err)
+		}
+	}
+	text, _ := s.fallback.summarize(ctx, incident)
+	return IncidentSummary{Text: text, Source: s.fallback.name(), GeneratedAt: time.Now().UTC()}
+}
+
+func (s *IncidentStore) setSummary(id string, summary IncidentSummary) (Incident, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return Incident{}, errIncidentNotFound
+	}
+	previous := *incident
+	incident.Summary = &summary
+	s.emit(eventIncidentUpdated, *incident, &previous)
+
+	return *incident, nil
+}
+
+type templateSummarizer struct{}
+
+func (templateSummarizer) name() string { return "template" }
+
+func (templateSummarizer) summarize(ctx context.Context, incident Incident) (string, error) {
+	var b strings.Builder
+	b.WriteString(incident.Title + " was opened " + incident.CreatedAt.Format("Jan 2 15:04 UTC") + " as " + incident.Severity + " severity")
+	b.WriteString(" and is currently " + strings.ToLower(incident.Status) + " with " + incident.Owner + ".")
+	if incident.Major {
+		b.WriteString(" It is a major incident.")
+	}
+	if len(incident.IOCs) > 0 {
+		b.WriteString(" Indicators: " + strings.Join(incident.IOCs, ", ") + ".")
+	}
+
+	notes := incident.Notes
+	if len(notes) > 3 {
+		notes = notes[:3]
+	}
+	if len(notes) > 0 {
+		b.WriteString(" Recent notes:")
+		for i := len(notes) - 1; i >= 0; i-- {
+			b.WriteString(" " + notes[i].Author + ": " + strings.TrimSpace(notes[i].Body) + ";")
+		}
+	}
+
+	open := openTasks(incident.Tasks)
+	if len(open) > 0 {
+		titles := make([]string, 0, len(open))
+		for _, task := range open {
+			titles = append(titles, task.Title)
+		}
+		b.WriteString(" Open tasks: " + strings.Join(titles, ", ") + ".")
+	}
+	return strings.TrimSuffix(b.String(), ";"), nil
+}
+
+// llmSummarizer calls an OpenAI-compatible chat completions endpoint.
+type llmSummarizer struct {
+	client *http.Client
+	url    string
+	token  string
+	model  string
+}
+
+func (l *llmSummarizer) name() string { return "llm" }
+
+func (l *llmSummarizer) summarize(ctx context.Context, incident Incident) (string, error) {
+	payload := map[string]any{
+		"model": l.model,
+		"messages": []map[string]string{
+			{"role": "system", "content": "You summarize security incidents for responders joining mid-investigation. Be factual and concise: what happened, current state, and what is still open. Do not speculate."},
+			{"role": "user", "content": summaryPrompt(incident)},
+		},
+	}
+	var headers map[string]string
+	if l.token != "" {
+		headers = bearer(l.token)
+	}
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := doJSON(ctx, l.client, http.MethodPost, l.url, headers, payload, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("no choices in response")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+func summaryPrompt(incident Incident) string {
+	var b strings.Builder
+	b.WriteString("Incident " + incident.ID + ": " + incident.Title + "\n")
+	b.WriteString("Severity: " + incident.Severity + "\nStatus: " + incident.Status + "\nOwner: " + incident.Owner + "\n")
+	b.WriteString("Major incident: " + strconv.FormatBool(incident.Major) + "\n")
+	if len(incident.IOCs) > 0 {
+		b.WriteString("IOCs: " + strings.Join(incident.IOCs, ", ") + "\n")
+	}
+	if len(incident.Tags) > 0 {
+		b.WriteString("Tags: " + strings.Join(incident.Tags, ", ") + "\n")
+	}
+
+	b.WriteString("\nTimeline (newest first):\n")
+	for _, highlight := range sitrepHighlights(incident) {
+		b.WriteString("- " + highlight.At.Format(time.RFC3339) + " " + highlight.Text + "\n")
+	}
+	b.WriteString("\nNotes (oldest first):\n")
+	for i := len(incident.Notes) - 1; i >= 0; i-- {
+		note := incident.Notes[i]
+		b.WriteString("- " + note.CreatedAt.Format(time.RFC3339) + " " + note.Author + ": " + note.Body + "\n")
+	}
+	if open := openTasks(incident.Tasks); len(open) > 0 {
+		b.WriteString("\nOpen tasks:\n")
+		for _, task := range open {
+			b.WriteString("- " + task.Title + "\n")
+		}
+	}
+	return b.String()
+}
+
+func handleIncidentSummary(w http.ResponseWriter, r *http.Request, id string, store *IncidentStore, summaries *SummaryService) {
+	incident, ok := store.get(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if incident.Summary == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "summary not generated yet"})
+			return
+		}
+		writeJSON(w, http.StatusOK, incident.Summary)
+	case http.MethodPost:
+		summary := summaries.summarize(r.Context(), *incident)
+		if _, err := store.setSummary(id, summary); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, summary)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
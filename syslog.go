@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const syslogAlertSource = "syslog"
+
+var syslogSeverityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// syslogAlertMapping is the built-in mapping for syslog intake. Its
+// severityMap is where syslog severities are mapped to incident severities,
+// so it can be tuned with PUT /api/alerts/mappings/syslog.
+func syslogAlertMapping() AlertMapping {
+	return AlertMapping{
+		Source:        syslogAlertSource,
+		TitleTemplate: "{appName} on {hostname}: {message}",
+		SeverityField: "syslogSeverity",
+		SeverityMap: map[string]string{
+			"emerg":   "Critical",
+			"alert":   "Critical",
+			"crit":    "Critical",
+			"err":     "High",
+			"warning": "Medium",
+			"notice":  "Low",
+			"info":    "Low",
+			"debug":   "Low",
+		},
+		IOCFields:    []string{"iocs"},
+		HostFields:   []string{"hostname"},
+		DedupeFields: []string{"hostname", "appName", "message"},
+	}
+}
+
+// SyslogMessage is a parsed RFC 5424 or RFC 3164 message. Fields that the
+// sender left out are empty.
+type SyslogMessage struct {
+	Format         string                       `json:"format"`
+	Facility       int                          `json:"facility"`
+	Severity       int                          `json:"severity"`
+	Timestamp      *time.Time                   `json:"timestamp,omitempty"`
+	Hostname       string                       `json:"hostname"`
+	AppName        string                       `json:"appName"`
+	ProcID         string                       `json:"procId,omitempty"`
+	MsgID          string                       `json:"msgId,omitempty"`
+	StructuredData map[string]map[string]string `json:"structuredData,omitempty"`
+	Message        string                       `json:"message"`
+}
+
+var rfc3164Header = regexp.MustCompile(`^([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}) (\S+) ([^:\[\s]+)(?:\[([^\]]*)\])?: ?`)
+
+func parseSyslog(raw string) (SyslogMessage, error) {
+	raw = strings.TrimRight(raw, "\r\n\x00")
+	if !strings.HasPrefix(raw, "<") {
+		return SyslogMessage{}, errors.New("missing PRI")
+	}
+	end := strings.IndexByte(raw, '>')
+	if end < 2 || end > 4 {
+		return SyslogMessage{}, errors.New("invalid PRI")
+	}
+	pri, err := strconv.Atoi(raw[1:end])
+	if err != nil || pri > 191 {
+		return SyslogMessage{}, errors.New("invalid PRI")
+	}
+	message := SyslogMessage{Facility: pri / 8, Severity: pri % 8}
+	rest := raw[end+1:]
+
+	if strings.HasPrefix(rest, "1 ") {
+		message.Format = "rfc5424"
+		return parseRFC5424(message, rest[2:])
+	}
+
+	message.Format = "rfc3164"
+	if match := rfc3164Header.FindStringSubmatch(rest); match != nil {
+		if at, err := time.Parse(time.Stamp, match[1]); err == nil {
+			// RFC 3164 timestamps have no year; assume the current one.
+			now := time.Now().UTC()
+			at = time.Date(now.Year(), at.Month(), at.Day(), at.Hour(), at.Minute(), at.Second(), 0, time.UTC)
+			if at.After(now.Add(24 * time.Hour)) {
+				at = at.AddDate(-1, 0, 0)
+			}
+			message.Timestamp = &at
+		}
+		message.Hostname = match[2]
+		message.AppName = match[3]
+		message.ProcID = match[4]
+		rest = rest[len(match[0]):]
+	}
+	message.Message = strings.TrimSpace(rest)
+	return message, nil
+}
+
+func parseRFC5424(message SyslogMessage, rest string) (SyslogMessage, error) {
+	fields := strings.SplitN(rest, " ", 6)
+	if len(fields) < 6 {
+		return message, errors.New("truncated RFC 5424 header")
+	}
+	nilValue := func(value string) string {
+		if value == "-" {
+			return ""
+		}
+		return value
+	}
+	if at, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+		at = at.UTC()
+		message.Timestamp = &at
+	}
+	message.Hostname = nilValue(fields[1])
+	message.AppName = nilValue(fields[2])
+	message.ProcID = nilValue(fields[3])
+	message.MsgID = nilValue(fields[4])
+
+	rest = fields[5]
+	if strings.HasPrefix(rest, "-") {
+		rest = strings.TrimPrefix(rest, "-")
+	} else {
+		data, remaining, err := parseStructuredData(rest)
+		if err != nil {
+			return message, err
+		}
+		message.StructuredData = data
+		rest = remaining
+	}
+	message.Message = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff"))
+	return message, nil
+}
+
+// parseStructuredData reads [id key="value" ...] elements, handling the
+// \" \\ and \] escapes.
+func parseStructuredData(text string) (map[string]map[string]string, string, error) {
+	data := map[string]map[string]string{}
+	i := 0
+	for i < len(text) && text[i] == '[' {
+		i++
+		start := i
+		for i < len(text) && text[i] != ' ' && text[i] != ']' {
+			i++
+		}
+		id := text[start:i]
+		params := map[string]string{}
+		for i < len(text) && text[i] == ' ' {
+			i++
+			start = i
+			for i < len(text) && text[i] != '=' {
+				i++
+			}
+			if i+1 >= len(text) || text[i+1] != '"' {
+				return nil, "", errors.New("invalid structured data parameter")
+			}
+			name := text[start:i]
+			i += 2
+			var value strings.Builder
+			for i < len(text) && text[i] != '"' {
+				if text[i] == '\\' && i+1 < len(text) && strings.IndexByte(`"\]`, text[i+1]) >= 0 {
+					i++
+				}
+				value.WriteByte(text[i])
+				i++
+			}
+			if i >= len(text) {
+				return nil, "", errors.New("unterminated structured data value")
+			}
+			i++
+			params[name] = value.String()
+		}
+		if i >= len(text) || text[i] != ']' {
+			return nil, "", errors.New("unterminated structured data element")
+		}
+		i++
+		data[id] = params
+	}
+	return data, text[i:], nil
+}
+
+// alert flattens the message into the shape alert mappings work with. IP
+// addresses mentioned in the message become IOCs.
+func (m SyslogMessage) alert(sender string) map[string]any {
+	alert := map[string]any{
+		"format":         m.Format,
+		"facility":       float64(m.Facility),
+		"severity":       float64(m.Severity),
+		"syslogSeverity": syslogSeverityNames[m.Severity],
+		"hostname":       fallback(m.Hostname, sender),
+		"appName":        fallback(m.AppName, "syslog"),
+		"procId":         m.ProcID,
+		"msgId":          m.MsgID,
+		"message":        m.Message,
+		"sender":         sender,
+	}
+	if m.Timestamp != nil {
+		alert["timestamp"] = m.Timestamp.Format(time.RFC3339Nano)
+	}
+	if len(m.StructuredData) > 0 {
+		data := map[string]any{}
+		for id, params := range m.StructuredData {
+			values := map[string]any{}
+			for key, value := range params {
+				values[key] = value
+			}
+			data[id] = values
+		}
+		alert["structuredData"] = data
+	}
+
+	iocs := []any{}
+	for _, token := range strings.FieldsFunc(m.Message, func(r rune) bool {
+		return strings.ContainsRune(" \t,;()[]<>\"'=", r)
+	}) {
+		candidate := strings.TrimRight(token, ".:")
+		if host, _, err := net.SplitHostPort(candidate); err == nil {
+			candidate = host
+		}
+		if _, err := netip.ParseAddr(candidate); err == nil {
+			iocs = append(iocs, candidate)
+		}
+	}
+	alert["iocs"] = iocs
+	return alert
+}
+
+// SyslogListener turns syslog messages into alerts. Messages less severe
+// than minSeverity are dropped before they reach the ingestion pipeline.
+type SyslogListener struct {
+	ingester    *AlertIngester
+	mappings    *AlertMappingStore
+	enrichment  *EnrichmentService
+	minSeverity int
+	maxSize     int
+}
+
+func newSyslogListener(ingester *AlertIngester, mappings *AlertMappingStore, enrichment *EnrichmentService) *SyslogListener {
+	minSeverity := 4
+	name := strings.ToLower(envString("SYSLOG_MIN_SEVERITY", "warning"))
+	for i, candidate := range syslogSeverityNames {
+		if candidate == name || strconv.Itoa(i) == name {
+			minSeverity = i
+		}
+	}
+	return &SyslogListener{
+		ingester:    ingester,
+		mappings:    mappings,
+		enrichment:  enrichment,
+		minSeverity: minSeverity,
+		maxSize:     envInt("SYSLOG_MAX_MESSAGE_BYTES", 64*1024),
+	}
+}
+
+func (l *SyslogListener) start() {
+	if addr := envString("SYSLOG_UDP_ADDR", ""); addr != "" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			log.Printf("syslog: udp listen %s: %v", addr, err)
+		} else {
+			log.Printf("syslog: listening on udp %s", addr)
+			go l.serveUDP(conn)
+		}
+	}
+	if addr := envString("SYSLOG_TCP_ADDR", ""); addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Printf("syslog: tcp listen %s: %v", addr, err)
+		} else {
+			log.Printf("syslog: listening on tcp %s", addr)
+			go l.serveTCP(listener)
+		}
+	}
+}
+
+func (l *SyslogListener) serveUDP(conn net.PacketConn) {
+	buffer := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			log.Printf("syslog: udp read: %v", err)
+			return
+		}
+		host, _, _ := net.SplitHostPort(addr.String())
+		l.handle(string(buffer[:n]), host)
+	}
+}
+
+func (l *SyslogListener) serveTCP(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("syslog: tcp accept: %v", err)
+			return
+		}
+		go l.serveConn(conn)
+	}
+}
+
+// serveConn reads RFC 6587 frames: octet-counted ("123 <34>1 ...") or
+// newline-delimited.
+func (l *SyslogListener) serveConn(conn net.Conn) {
+	defer conn.Close()
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+		var frame string
+		if first[0] >= '1' && first[0] <= '9' {
+			count, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			size, err := strconv.Atoi(strings.TrimSpace(count))
+			if err != nil || size > l.maxSize {
+				log.Printf("syslog: invalid frame length %q from %s", count, host)
+				return
+			}
+			payload := make([]byte, size)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			frame = string(payload)
+		} else {
+			line, err := reader.ReadString('\n')
+			if len(line) > l.maxSize {
+				log.Printf("syslog: message from %s exceeds %d bytes", host, l.maxSize)
+				return
+			}
+			if strings.TrimSpace(line) != "" {
+				frame = line
+			}
+			if err != nil {
+				if frame != "" {
+					l.handle(frame, host)
+				}
+				return
+			}
+		}
+		if frame != "" {
+			l.handle(frame, host)
+		}
+	}
+}
+
+func (l *SyslogListener) handle(raw, sender string) {
+	message, err := parseSyslog(raw)
+	if err != nil {
+		log.Printf("syslog: dropping message from %s: %v", sender, err)
+		return
+	}
+	if message.Severity > l.minSeverity {
+		return
+	}
+	source, alert := syslogAlertSource, message.alert(sender)
+	if event, format, err := parseEventLine(raw); err == nil {
+		// CEF and LEEF are usually carried over syslog; map them with their
+		// own mappings but keep the syslog envelope. The raw line is searched
+		// because RFC 3164 parsing takes "CEF:" for a tag.
+		source, alert = format, event
+		alert["syslog"] = message.alert(sender)
+	}
+	mapping, ok := l.mappings.get(source)
+	if !ok {
+		mapping = builtinAlertMappings[source]()
+	}
+	result, created, err := l.ingester.ingest(context.Background(), mapping, alert)
+	if err != nil {
+		log.Printf("syslog: ingest from %s: %v", sender, err)
+		return
+	}
+	if created {
+		l.enrichment.enqueue(result.IncidentID)
+	}
+}
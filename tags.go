@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TagUsage is one tag and how many incidents carry it. Tags match ignoring
+// case; Variants lists the other spellings in use, which are usually worth
+// merging.
+type TagUsage struct {
+	Tag      string   `json:"tag"`
+	Count    int      `json:"count"`
+	Variants []string `json:"variants,omitempty"`
+}
+
+type TagRenameInput struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type TagMergeInput struct {
+	Sources []string `json:"sources"`
+	Into    string   `json:"into"`
+}
+
+// TagChangeResult lists the incidents a rename, merge, or delete changed.
+type TagChangeResult struct {
+	Tag       string   `json:"tag,omitempty"`
+	Incidents []string `json:"incidents"`
+}
+
+var errTagNotFound = errors.New("tag not found")
+
+// tagUsage counts tags across incidents. The spelling reported for each
+// tag is its most common one.
+func tagUsage(incidents []Incident) []TagUsage {
+	spellings := map[string]map[string]int{}
+	counts := map[string]int{}
+	for _, incident := range incidents {
+		for _, tag := range dedupeStrings(incident.Tags) {
+			key := strings.ToLower(tag)
+			if spellings[key] == nil {
+				spellings[key] = map[string]int{}
+			}
+			spellings[key][tag]++
+			counts[key]++
+		}
+	}
+
+	items := make([]TagUsage, 0, len(counts))
+	for key, count := range counts {
+		variants := make([]string, 0, len(spellings[key]))
+		for spelling := range spellings[key] {
+			variants = append(variants, spelling)
+		}
+		sort.Slice(variants, func(i, j int) bool {
+			a, b := spellings[key][variants[i]], spellings[key][variants[j]]
+			return a > b || (a == b && variants[i] < variants[j])
+		})
+		items = append(items, TagUsage{Tag: variants[0], Count: count, Variants: variants[1:]})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Count > items[j].Count || (items[i].Count == items[j].Count && strings.ToLower(items[i].Tag) < strings.ToLower(items[j].Tag))
+	})
+	return items
+}
+
+// replaceTags swaps every tag matching one of from, ignoring case, for to
+// on every incident in tenant, or drops them when to is empty. It returns
+// the IDs of the incidents it changed.
+func (s *IncidentStore) replaceTags(tenant string, from []string, to string, trace traceContext) []string {
+	s.mu.Lock()
+	defer s.unlock()
+
+	matches := map[string]bool{}
+	for _, tag := range from {
+		matches[strings.ToLower(tag)] = true
+	}
+	now := time.Now().UTC()
+	changed := []string{}
+	for _, id := range s.order {
+		incident := s.incidents[id]
+		if incident.Tenant != tenant {
+			continue
+		}
+		tags, touched := []string{}, false
+		for _, tag := range incident.Tags {
+			if !matches[strings.ToLower(tag)] {
+				tags = append(tags, tag)
+				continue
+			}
+			touched = true
+			if to != "" {
+				tags = append(tags, to)
+			}
+		}
+		if !touched {
+			continue
+		}
+		previous := *incident
+		incident.Tags = dedupeStrings(tags)
+		incident.UpdatedAt = now
+		incident.trace = trace
+		s.runAnnotators(incident)
+		s.emit(eventIncidentUpdated, *incident, &previous)
+		changed = append(changed, id)
+	}
+	return changed
+}
+
+// tagsHandler serves GET /api/tags, with counts over the incidents the
+// caller can see.
+func tagsHandler(store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": tagUsage(visibleTo(r, store.list()))})
+	}
+}
+
+// tagHandler serves the admin-only tag operations: POST /api/tags/rename,
+// POST /api/tags/merge, and DELETE /api/tags/{tag}. They apply to every
+// incident in the caller's tenant, restricted ones included.
+func tagHandler(store *IncidentStore, audit *AuditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/api/tags/")
+		if name == "" || strings.Contains(name, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+
+		var (
+			from   []string
+			to     string
+			action string
+		)
+		switch {
+		case name == "rename" && r.Method == http.MethodPost:
+			var input TagRenameInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			from, to, action = sanitizeSlice([]string{input.From}), strings.TrimSpace(input.To), "tag.renamed"
+			if len(from) == 0 || to == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "from and to are required"})
+				return
+			}
+		case name == "merge" && r.Method == http.MethodPost:
+			var input TagMergeInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			from, to, action = sanitizeSlice(input.Sources), strings.TrimSpace(input.Into), "tag.merged"
+			if len(from) == 0 || to == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "sources and into are required"})
+				return
+			}
+		case name != "rename" && name != "merge" && r.Method == http.MethodDelete:
+			from, action = []string{name}, "tag.deleted"
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		changed := store.replaceTags(tenantFrom(r.Context()), from, to, traceFrom(r.Context()))
+		if len(changed) == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": errTagNotFound.Error()})
+			return
+		}
+
+		caller, actorID := actor(r.Context())
+		event := AuditEvent{
+			Actor:      fallback(actorID, caller),
+			Action:     action,
+			Tenant:     tenantFrom(r.Context()),
+			Resource:   r.URL.Path,
+			Detail:     strings.Join(from, ", "),
+			RemoteAddr: r.RemoteAddr,
+			UserAgent:  r.UserAgent(),
+		}
+		if to != "" {
+			event.Detail += " -> " + to
+		}
+		event.Detail += " on " + itoa(len(changed)) + " incidents"
+		if principal, ok := principalFrom(r.Context()); ok {
+			event.ActorType = principal.Kind
+		}
+		audit.record(event)
+		writeJSON(w, http.StatusOK, TagChangeResult{Tag: to, Incidents: changed})
+	}
+}
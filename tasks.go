@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Task struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Assignee    string     `json:"assignee,omitempty"`
+	Done        bool       `json:"done"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+type TaskInput struct {
+	Title    string `json:"title"`
+	Assignee string `json:"assignee"`
+}
+
+type TaskUpdate struct {
+	Title    string `json:"title"`
+	Assignee string `json:"assignee"`
+	Done     *bool  `json:"done"`
+}
+
+var errTaskNotFound = errors.New("task not found")
+
+func openTasks(tasks []Task) []Task {
+	open := make([]Task, 0, len(tasks))
+	for _, task := range tasks {
+		if !task.Done {
+			open = append(open, task)
+		}
+	}
+	return open
+}
+
+func (s *IncidentStore) addTask(id string, input TaskInput) (Incident, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return Incident{}, errIncidentNotFound
+	}
+	if strings.TrimSpace(input.Title) == "" {
+		return Incident{}, errors.New("task title required")
+	}
+	previous := *incident
+
+	task := Task{
+		ID:        "TASK-" + padInt(len(incident.Tasks)+1),
+		Title:     strings.TrimSpace(input.Title),
+		Assignee:  strings.TrimSpace(input.Assignee),
+		CreatedAt: time.Now().UTC(),
+	}
+	incident.Tasks = append(append([]Task{}, incident.Tasks...), task)
+	incident.UpdatedAt = time.Now().UTC()
+	s.emit(eventIncidentUpdated, *incident, &previous)
+
+	return *incident, nil
+}
+
+func (s *IncidentStore) updateTask(id, taskID string, input TaskUpdate) (Incident, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return Incident{}, errIncidentNotFound
+	}
+	index := -1
+	for i, task := range incident.Tasks {
+		if task.ID == taskID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return Incident{}, errTaskNotFound
+	}
+	previous := *incident
+
+	tasks := append([]Task{}, incident.Tasks...)
+	task := &tasks[index]
+	if strings.TrimSpace(input.Title) != "" {
+		task.Title = strings.TrimSpace(input.Title)
+	}
+	if input.Assignee != "" {
+		task.Assignee = strings.TrimSpace(input.Assignee)
+	}
+	if input.Done != nil && *input.Done != task.Done {
+		task.Done = *input.Done
+		task.CompletedAt = nil
+		if task.Done {
+			now := time.Now().UTC()
+			task.CompletedAt = &now
+		}
+	}
+	incident.Tasks = tasks
+	incident.UpdatedAt = time.Now().UTC()
+	s.emit(eventIncidentUpdated, *incident, &previous)
+
+	return *incident, nil
+}
+
+func handleIncidentTasks(w http.ResponseWriter, r *http.Request, id string, parts []string, store *IncidentStore) {
+	if len(parts) == 3 {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var input TaskUpdate
+		if err := readJSON(r, &input); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		incident, err := store.updateTask(id, parts[2], input)
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, incident)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		incident, ok := store.get(id)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": incident.Tasks})
+	case http.MethodPost:
+		var input TaskInput
+		if err := readJSON(r, &input); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		incident, err := store.addTask(id, input)
+		if errors.Is(err, errIncidentNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusCreated, incident)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
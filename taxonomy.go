@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SeverityLevel is one allowed severity. Higher ranks are more severe.
+type SeverityLevel struct {
+	Name  string `json:"name"`
+	Rank  int    `json:"rank"`
+	Color string `json:"color,omitempty"`
+}
+
+// StatusDefinition is one allowed status. Closed statuses end the
+// incident's lifecycle: they stop SLA timers, leave the open queue, and
+// trigger closure checks.
+type StatusDefinition struct {
+	Name   string `json:"name"`
+	Closed bool   `json:"closed"`
+	Color  string `json:"color,omitempty"`
+}
+
+// Taxonomies are the severities and statuses incidents may take, with the
+// defaults for incidents created without one.
+type Taxonomies struct {
+	Severities      []SeverityLevel    `json:"severities"`
+	Statuses        []StatusDefinition `json:"statuses"`
+	DefaultSeverity string             `json:"defaultSeverity"`
+	DefaultStatus   string             `json:"defaultStatus"`
+	UpdatedAt       *time.Time         `json:"updatedAt,omitempty"`
+	UpdatedBy       string             `json:"updatedBy,omitempty"`
+}
+
+var defaultTaxonomies = Taxonomies{
+	Severities: []SeverityLevel{
+		{Name: "Low", Rank: 1, Color: "#2e7d32"},
+		{Name: "Medium", Rank: 2, Color: "#f9a825"},
+		{Name: "High", Rank: 3, Color: "#ef6c00"},
+		{Name: "Critical", Rank: 4, Color: "#c62828"},
+	},
+	Statuses: []StatusDefinition{
+		{Name: "New", Color: "#1565c0"},
+		{Name: "Investigating", Color: "#6a1b9a"},
+		{Name: "Contained", Color: "#00838f"},
+		{Name: "Resolved", Closed: true, Color: "#2e7d32"},
+		{Name: "Closed", Closed: true, Color: "#616161"},
+	},
+	DefaultSeverity: "Medium",
+	DefaultStatus:   "New",
+}
+
+var taxonomyColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// The active taxonomies are read by helpers all over the server (severity
+// ranking, closed checks, alert normalization) that have no store to hand,
+// so they live here rather than on a store passed around.
+var activeTaxonomies atomic.Pointer[Taxonomies]
+
+func init() {
+	taxonomies := defaultTaxonomies
+	activeTaxonomies.Store(&taxonomies)
+}
+
+func currentTaxonomies() *Taxonomies {
+	return activeTaxonomies.Load()
+}
+
+// severity finds a level by name, ignoring case.
+func (t *Taxonomies) severity(name string) (SeverityLevel, bool) {
+	name = strings.TrimSpace(name)
+	for _, level := range t.Severities {
+		if strings.EqualFold(level.Name, name) {
+			return level, true
+		}
+	}
+	return SeverityLevel{}, false
+}
+
+// status finds a status by name, ignoring case.
+func (t *Taxonomies) status(name string) (StatusDefinition, bool) {
+	name = strings.TrimSpace(name)
+	for _, status := range t.Statuses {
+		if strings.EqualFold(status.Name, name) {
+			return status, true
+		}
+	}
+	return StatusDefinition{}, false
+}
+
+func (t *Taxonomies) severityNames() []string {
+	names := make([]string, 0, len(t.Severities))
+	for _, level := range t.Severities {
+		names = append(names, level.Name)
+	}
+	return names
+}
+
+func (t *Taxonomies) statusNames() []string {
+	names := make([]string, 0, len(t.Statuses))
+	for _, status := range t.Statuses {
+		names = append(names, status.Name)
+	}
+	return names
+}
+
+// canonicalSeverity returns the configured spelling of severity, or an
+// error listing the allowed values.
+func (t *Taxonomies) canonicalSeverity(severity string) (string, error) {
+	level, ok := t.severity(severity)
+	if !ok {
+		return "", errors.New("severity must be one of " + strings.Join(t.severityNames(), ", "))
+	}
+	return level.Name, nil
+}
+
+func (t *Taxonomies) canonicalStatus(status string) (string, error) {
+	definition, ok := t.status(status)
+	if !ok {
+		return "", errors.New("status must be one of " + strings.Join(t.statusNames(), ", "))
+	}
+	return definition.Name, nil
+}
+
+// validate cleans up t in place. Severities are kept sorted by rank.
+func (t *Taxonomies) validate() error {
+	if len(t.Severities) == 0 || len(t.Statuses) == 0 {
+		return errors.New("define at least one severity and one status")
+	}
+	names, ranks := map[string]bool{}, map[int]bool{}
+	for i := range t.Severities {
+		level := &t.Severities[i]
+		level.Name = strings.TrimSpace(level.Name)
+		switch {
+		case level.Name == "":
+			return errors.New("severities need a name")
+		case names[strings.ToLower(level.Name)]:
+			return errors.New("duplicate severity " + level.Name)
+		case level.Rank < 1:
+			return errors.New(level.Name + ": rank must be at least 1")
+		case ranks[level.Rank]:
+			return errors.New(level.Name + ": another severity already has rank " + itoa(level.Rank))
+		case level.Color != "" && !taxonomyColor.MatchString(level.Color):
+			return errors.New(level.Name + ": color must look like #c62828")
+		}
+		names[strings.ToLower(level.Name)], ranks[level.Rank] = true, true
+	}
+	sort.SliceStable(t.Severities, func(i, j int) bool { return t.Severities[i].Rank < t.Severities[j].Rank })
+
+	names = map[string]bool{}
+	open, closed := false, false
+	for i := range t.Statuses {
+		status := &t.Statuses[i]
+		status.Name = strings.TrimSpace(status.Name)
+		switch {
+		case status.Name == "":
+			return errors.New("statuses need a name")
+		case names[strings.ToLower(status.Name)]:
+			return errors.New("duplicate status " + status.Name)
+		case status.Color != "" && !taxonomyColor.MatchString(status.Color):
+			return errors.New(status.Name + ": color must look like #2e7d32")
+		}
+		names[strings.ToLower(status.Name)] = true
+		open, closed = open || !status.Closed, closed || status.Closed
+	}
+	if !open || !closed {
+		return errors.New("define at least one open and one closed status")
+	}
+
+	var err error
+	if t.DefaultSeverity, err = t.canonicalSeverity(fallback(t.DefaultSeverity, t.Severities[0].Name)); err != nil {
+		return errors.New("defaultSeverity: " + err.Error())
+	}
+	if t.DefaultStatus, err = t.canonicalStatus(fallback(t.DefaultStatus, t.Statuses[0].Name)); err != nil {
+		return errors.New("defaultStatus: " + err.Error())
+	}
+	if t.statusClosed(t.DefaultStatus) {
+		return errors.New("defaultStatus can't be a closed status")
+	}
+	return nil
+}
+
+// statusClosed reports whether status is one of t's closed statuses.
+// Statuses t doesn't define count as closed when they are the built-in
+// Resolved or Closed, so incidents from before a change keep behaving.
+func (t *Taxonomies) statusClosed(status string) bool {
+	if definition, ok := t.status(status); ok {
+		return definition.Closed
+	}
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "resolved", "closed":
+		return true
+	}
+	return false
+}
+
+// closedStatus is the status to close incidents with when the server does
+// it: Closed if that is a closed status, otherwise the first closed one.
+func (t *Taxonomies) closedStatus() string {
+	if status, ok := t.status("Closed"); ok && status.Closed {
+		return status.Name
+	}
+	for _, status := range t.Statuses {
+		if status.Closed {
+			return status.Name
+		}
+	}
+	return "Closed"
+}
+
+// nextSeverityUp returns the next more severe level, or severity itself at
+// the top.
+func (t *Taxonomies) nextSeverityUp(severity string) string {
+	rank := severityRank(severity)
+	for _, level := range t.Severities {
+		if level.Rank > rank {
+			return level.Name
+		}
+	}
+	return normalizeSeverity(severity)
+}
+
+// replaceTaxonomies validates and activates new taxonomies. Incidents that
+// already use a removed value keep it; the hygiene report lists them.
+func replaceTaxonomies(taxonomies Taxonomies, by string) (Taxonomies, error) {
+	if err := taxonomies.validate(); err != nil {
+		return Taxonomies{}, err
+	}
+	now := time.Now().UTC()
+	taxonomies.UpdatedAt, taxonomies.UpdatedBy = &now, by
+	activeTaxonomies.Store(&taxonomies)
+	return taxonomies, nil
+}
+
+// taxonomiesHandler serves GET /api/config/taxonomies to everyone, since
+// the UI needs the colors, and PUT to admins.
+func taxonomiesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReadRequest(r) && !requireSharedConfig(w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, currentTaxonomies())
+		case http.MethodPut:
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			var input Taxonomies
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			input.UpdatedAt, input.UpdatedBy = nil, ""
+			name, _ := actor(r.Context())
+			updated, err := replaceTaxonomies(input, name)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, updated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// canonicalizeTaxonomy rewrites a request's severity and status, when set,
+// to their configured spelling, answering 400 for values that aren't
+// configured.
+func canonicalizeTaxonomy(w http.ResponseWriter, severity, status *string) bool {
+	taxonomies := currentTaxonomies()
+	var err error
+	if *severity != "" {
+		*severity, err = taxonomies.canonicalSeverity(*severity)
+	}
+	if err == nil && *status != "" {
+		*status, err = taxonomies.canonicalStatus(*status)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
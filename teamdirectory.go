@@ -0,0 +1,354 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Team is a group of users that can own incidents as a whole, such as a
+// shift's queue. Members are the users whose Team is the team's ID.
+type Team struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type TeamInput struct {
+	// ID is how incidents and users refer to the team, e.g. "soc-tier2". It
+	// can't change.
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+}
+
+type TeamMemberInput struct {
+	Lead bool `json:"lead"`
+}
+
+// TeamView is a team with its members and the open incidents the team
+// itself owns.
+type TeamView struct {
+	Team
+	Members       []UserView `json:"members"`
+	OpenIncidents int        `json:"openIncidents"`
+}
+
+var (
+	errTeamNotFound = errors.New("team not found")
+	errTeamExists   = errors.New("team already exists")
+	teamIDPattern   = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+)
+
+type TeamStore struct {
+	mu    sync.RWMutex
+	teams map[string]*Team
+	order []string
+}
+
+func newTeamStore() *TeamStore {
+	return &TeamStore{teams: make(map[string]*Team), order: []string{}}
+}
+
+func (t *TeamStore) list() []Team {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	items := make([]Team, 0, len(t.order))
+	for _, id := range t.order {
+		items = append(items, *t.teams[id])
+	}
+	return items
+}
+
+// find looks a team up by ID or name, ignoring case.
+func (t *TeamStore) find(value string) (Team, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	value = strings.TrimSpace(value)
+	if team, ok := t.teams[strings.ToLower(value)]; ok {
+		return *team, true
+	}
+	for _, id := range t.order {
+		if team := t.teams[id]; strings.EqualFold(team.Name, value) {
+			return *team, true
+		}
+	}
+	return Team{}, false
+}
+
+func (t *TeamStore) create(input TeamInput) (Team, error) {
+	id := strings.ToLower(strings.TrimSpace(input.ID))
+	if !teamIDPattern.MatchString(id) {
+		return Team{}, errors.New("id must be lowercase letters, digits, dashes, or underscores")
+	}
+	now := time.Now().UTC()
+	team := &Team{ID: id, Name: fallback(strings.TrimSpace(input.Name), id), CreatedAt: now, UpdatedAt: now}
+	if input.Description != nil {
+		team.Description = strings.TrimSpace(*input.Description)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.teams[id]; ok {
+		return Team{}, errTeamExists
+	}
+	t.teams[id] = team
+	t.order = append(t.order, id)
+	return *team, nil
+}
+
+func (t *TeamStore) update(id string, input TeamInput) (Team, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	team, ok := t.teams[strings.ToLower(id)]
+	if !ok {
+		return Team{}, errTeamNotFound
+	}
+	if input.ID != "" && !strings.EqualFold(strings.TrimSpace(input.ID), team.ID) {
+		return Team{}, errors.New("id can't be changed")
+	}
+	if name := strings.TrimSpace(input.Name); name != "" {
+		team.Name = name
+	}
+	if input.Description != nil {
+		team.Description = strings.TrimSpace(*input.Description)
+	}
+	team.UpdatedAt = time.Now().UTC()
+	return *team, nil
+}
+
+func (t *TeamStore) delete(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id = strings.ToLower(id)
+	if _, ok := t.teams[id]; !ok {
+		return errTeamNotFound
+	}
+	delete(t.teams, id)
+	for i, candidate := range t.order {
+		if candidate == id {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// inTeam reports whether a user's Team names the team, by ID or by a name
+// set before the team was defined.
+func inTeam(user User, team Team) bool {
+	return user.Team != "" && (strings.EqualFold(user.Team, team.ID) || strings.EqualFold(user.Team, team.Name))
+}
+
+func teamMembers(team Team, users *UserStore) []User {
+	members := []User{}
+	for _, user := range users.list() {
+		if inTeam(user, team) {
+			members = append(members, user)
+		}
+	}
+	return members
+}
+
+// teamOwners is every owner value that puts an incident in the team's
+// queue: the team itself and each active member.
+func teamOwners(team Team, users *UserStore) map[string]bool {
+	owners := map[string]bool{strings.ToLower(team.ID): true, strings.ToLower(team.Name): true}
+	for _, member := range teamMembers(team, users) {
+		if member.Active {
+			owners[userKey(member.ID)], owners[strings.ToLower(member.Name)] = true, true
+		}
+	}
+	return owners
+}
+
+// lookupTeam finds a team in the store or, for directories set up before
+// teams existed, one only named in users' Team fields.
+func lookupTeam(value string, teams *TeamStore, users *UserStore) (Team, bool) {
+	if team, ok := teams.find(value); ok {
+		return team, true
+	}
+	for _, name := range users.teams() {
+		if strings.EqualFold(name, strings.TrimSpace(value)) {
+			return Team{ID: name, Name: name}, true
+		}
+	}
+	return Team{}, false
+}
+
+// filterByTeam keeps incidents owned by the team or one of its members for
+// GET /api/incidents?team=.
+func filterByTeam(items []Incident, value string, teams *TeamStore, users *UserStore) ([]Incident, bool) {
+	if strings.TrimSpace(value) == "" {
+		return items, true
+	}
+	team, ok := lookupTeam(value, teams, users)
+	if !ok {
+		return nil, false
+	}
+	owners := teamOwners(team, users)
+	filtered := make([]Incident, 0, len(items))
+	for _, incident := range items {
+		if owners[strings.ToLower(strings.TrimSpace(incident.Owner))] {
+			filtered = append(filtered, incident)
+		}
+	}
+	return filtered, true
+}
+
+func teamView(r *http.Request, team Team, users *UserStore, store *IncidentStore) TeamView {
+	counts := openIncidentCounts(visibleTo(r, store.list()))
+	view := TeamView{Team: team, Members: []UserView{}, OpenIncidents: counts[strings.ToLower(team.ID)]}
+	if !strings.EqualFold(team.Name, team.ID) {
+		view.OpenIncidents += counts[strings.ToLower(team.Name)]
+	}
+	for _, member := range teamMembers(team, users) {
+		view.Members = append(view.Members, userView(member, counts))
+	}
+	return view
+}
+
+// teamsHandler serves GET and, for admins, POST /api/teams.
+func teamsHandler(teams *TeamStore, users *UserStore, store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReadRequest(r) && !requireSharedConfig(w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			items := []TeamView{}
+			for _, team := range teams.list() {
+				items = append(items, teamView(r, team, users, store))
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+		case http.MethodPost:
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			var input TeamInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			team, err := teams.create(input)
+			if errors.Is(err, errTeamExists) {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, teamView(r, team, users, store))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// teamHandler serves GET /api/teams/{id} and, for admins, PUT and DELETE,
+// plus PUT and DELETE /api/teams/{id}/members/{userId} to manage
+// membership. A user is in one team at a time, so adding them moves them.
+func teamHandler(teams *TeamStore, users *UserStore, store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/teams/"), "/")
+		team, ok := teams.find(parts[0])
+		if !ok || len(parts) == 2 || len(parts) > 3 || (len(parts) == 3 && parts[1] != "members") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !isReadRequest(r) && !requireSharedConfig(w, r) {
+			return
+		}
+
+		if len(parts) == 3 {
+			if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			user, ok := users.get(parts[2])
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			input := UserInput{Team: &team.ID}
+			if r.Method == http.MethodPut {
+				var member TeamMemberInput
+				if err := readJSON(r, &member); err != nil && !errors.Is(err, io.EOF) {
+					writeBodyError(w, err)
+					return
+				}
+				input.TeamLead = &member.Lead
+			} else {
+				if !inTeam(user, team) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				none, lead := "", false
+				input.Team, input.TeamLead = &none, &lead
+			}
+			if _, err := users.update(user.ID, input); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, teamView(r, team, users, store))
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, teamView(r, team, users, store))
+		case http.MethodPut:
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			var input TeamInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			updated, err := teams.update(team.ID, input)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, teamView(r, updated, users, store))
+		case http.MethodDelete:
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			counts := openIncidentCounts(store.list())
+			if open := counts[strings.ToLower(team.ID)] + counts[strings.ToLower(team.Name)]; open > 0 {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": "reassign the team's " + itoa(open) + " open incidents first"})
+				return
+			}
+			if err := teams.delete(team.ID); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			none, lead := "", false
+			for _, member := range teamMembers(team, users) {
+				if _, err := users.update(member.ID, UserInput{Team: &none, TeamLead: &lead}); err != nil {
+					log.Printf("removing %s from deleted team %s: %v", member.ID, team.ID, err)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// teamsDefaultRoute is the route key for severities without their own
+// channel.
+const teamsDefaultRoute = "default"
+
+// teamsTarget posts Adaptive Cards to Teams incoming webhooks when an
+// incident is created or its severity changes. Each severity can go to its
+// own channel; routes are managed through /api/integrations/teams.
+type teamsTarget struct {
+	client *http.Client
+
+	mu sync.RWMutex
+	// routes maps a lower-case severity, or teamsDefaultRoute, to a webhook.
+	routes map[string]string
+}
+
+type TeamsRoutes struct {
+	Routes map[string]string `json:"routes"`
+}
+
+func newTeamsTarget() *teamsTarget {
+	target := &teamsTarget{client: newOutboundClient(), routes: map[string]string{}}
+	if endpoint := envString("TEAMS_WEBHOOK_URL", ""); endpoint != "" {
+		target.routes[teamsDefaultRoute] = endpoint
+	}
+	return target
+}
+
+func (t *teamsTarget) name() string { return "teams" }
+
+func (t *teamsTarget) route(severity string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return fallback(t.routes[strings.ToLower(normalizeSeverity(severity))], t.routes[teamsDefaultRoute])
+}
+
+// setRoutes replaces every route after checking each key is a severity or
+// "default" and each webhook is an https URL.
+func (t *teamsTarget) setRoutes(routes map[string]string) error {
+	cleaned := map[string]string{}
+	for key, endpoint := range routes {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key != teamsDefaultRoute && !strings.EqualFold(normalizeSeverity(key), key) {
+			return errors.New("route keys must be low, medium, high, critical, or default")
+		}
+		parsed, err := url.Parse(strings.TrimSpace(endpoint))
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return errors.New("route " + key + " must be an https webhook URL")
+		}
+		cleaned[key] = parsed.String()
+	}
+	t.mu.Lock()
+	t.routes = cleaned
+	t.mu.Unlock()
+	return nil
+}
+
+// redactedRoutes hides webhook paths, which carry the webhook's secret.
+func (t *teamsTarget) redactedRoutes() TeamsRoutes {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	routes := map[string]string{}
+	for key, endpoint := range t.routes {
+		if parsed, err := url.Parse(endpoint); err == nil {
+			endpoint = parsed.Scheme + "://" + parsed.Host + "/…"
+		}
+		routes[key] = endpoint
+	}
+	return TeamsRoutes{Routes: routes}
+}
+
+func (t *teamsTarget) send(ctx context.Context, notification Notification) error {
+	created := notification.Event == eventIncidentCreated
+	severityChanged := notification.Event == eventIncidentUpdated && slices.Contains(notification.Changed, "severity")
+	if !created && !severityChanged {
+		return nil
+	}
+	endpoint := t.route(notification.Incident.Severity)
+	if endpoint == "" {
+		return nil
+	}
+	return doJSON(ctx, t.client, http.MethodPost, endpoint, nil, teamsCard(notification), nil)
+}
+
+// teamsCard wraps an Adaptive Card in the message envelope incoming
+// webhooks expect.
+func teamsCard(notification Notification) map[string]any {
+	incident := notification.Incident
+	color := "Default"
+	switch normalizeSeverity(incident.Severity) {
+	case "Critical", "High":
+		color = "Attention"
+	case "Medium":
+		color = "Warning"
+	}
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []map[string]any{
+			{"type": "TextBlock", "text": incident.ID + " " + fallback(incident.Title, "Restricted case"), "weight": "Bolder", "size": "Medium", "wrap": true},
+			{"type": "TextBlock", "text": notification.Message, "wrap": true, "color": color},
+			{"type": "FactSet", "facts": []map[string]string{
+				{"title": "Severity", "value": incident.Severity},
+				{"title": "Status", "value": incident.Status},
+				{"title": "Owner", "value": fallback(incident.Owner, "Unassigned")},
+			}},
+		},
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	}
+}
+
+// teamsIntegrationHandler serves GET and PUT /api/integrations/teams, admin
+// only. PUT replaces every route.
+func teamsIntegrationHandler(teams *teamsTarget) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, teams.redactedRoutes())
+		case http.MethodPut:
+			var input TeamsRoutes
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			if err := teams.setRoutes(input.Routes); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, teams.redactedRoutes())
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IncidentTemplate pre-fills new incidents of a common kind. TitlePattern
+// may use {title} for the title the caller passes and {date} for today's
+// date (UTC).
+type IncidentTemplate struct {
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	Description  string      `json:"description,omitempty"`
+	TitlePattern string      `json:"titlePattern"`
+	Severity     string      `json:"severity,omitempty"`
+	Tags         []string    `json:"tags"`
+	Tasks        []TaskInput `json:"tasks"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	UpdatedAt    time.Time   `json:"updatedAt"`
+}
+
+type IncidentTemplateInput struct {
+	// ID is the name used in ?template=, e.g. "phishing". It can't change.
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	Description  *string      `json:"description"`
+	TitlePattern *string      `json:"titlePattern"`
+	Severity     *string      `json:"severity"`
+	Tags         *[]string    `json:"tags"`
+	Tasks        *[]TaskInput `json:"tasks"`
+}
+
+var (
+	errTemplateNotFound = errors.New("template not found")
+	errTemplateExists   = errors.New("template already exists")
+	templateID          = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+)
+
+type TemplateStore struct {
+	mu        sync.RWMutex
+	templates map[string]*IncidentTemplate
+	order     []string
+}
+
+func newTemplateStore() *TemplateStore {
+	return &TemplateStore{templates: make(map[string]*IncidentTemplate), order: []string{}}
+}
+
+func (s *TemplateStore) list() []IncidentTemplate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]IncidentTemplate, 0, len(s.order))
+	for _, id := range s.order {
+		items = append(items, *s.templates[id])
+	}
+	return items
+}
+
+func (s *TemplateStore) get(id string) (IncidentTemplate, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	template, ok := s.templates[strings.ToLower(strings.TrimSpace(id))]
+	if !ok {
+		return IncidentTemplate{}, false
+	}
+	return *template, true
+}
+
+// apply copies the fields input sets onto template and checks the result.
+func (input IncidentTemplateInput) apply(template *IncidentTemplate) error {
+	if name := strings.TrimSpace(input.Name); name != "" {
+		template.Name = name
+	}
+	if input.Description != nil {
+		template.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.TitlePattern != nil {
+		template.TitlePattern = strings.TrimSpace(*input.TitlePattern)
+	}
+	if input.Severity != nil {
+		template.Severity = strings.TrimSpace(*input.Severity)
+	}
+	if input.Tags != nil {
+		template.Tags = dedupeStrings(sanitizeSlice(*input.Tags))
+	}
+	if input.Tasks != nil {
+		tasks := []TaskInput{}
+		for _, task := range *input.Tasks {
+			task.Title, task.Assignee = strings.TrimSpace(task.Title), strings.TrimSpace(task.Assignee)
+			if task.Title == "" {
+				return errors.New("tasks need a title")
+			}
+			tasks = append(tasks, task)
+		}
+		template.Tasks = tasks
+	}
+	if template.TitlePattern == "" {
+		return errors.New("titlePattern is required")
+	}
+	if template.Severity != "" {
+		severity, err := currentTaxonomies().canonicalSeverity(template.Severity)
+		if err != nil {
+			return err
+		}
+		template.Severity = severity
+	}
+	return nil
+}
+
+func (s *TemplateStore) create(input IncidentTemplateInput) (IncidentTemplate, error) {
+	id := strings.ToLower(strings.TrimSpace(input.ID))
+	if !templateID.MatchString(id) {
+		return IncidentTemplate{}, errors.New("id must be lowercase letters, digits, dashes, or underscores")
+	}
+	now := time.Now().UTC()
+	template := &IncidentTemplate{ID: id, Name: id, Tags: []string{}, Tasks: []TaskInput{}, CreatedAt: now, UpdatedAt: now}
+	if err := input.apply(template); err != nil {
+		return IncidentTemplate{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.templates[id]; ok {
+		return IncidentTemplate{}, errTemplateExists
+	}
+	s.templates[id] = template
+	s.order = append(s.order, id)
+	return *template, nil
+}
+
+func (s *TemplateStore) update(id string, input IncidentTemplateInput) (IncidentTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template, ok := s.templates[strings.ToLower(strings.TrimSpace(id))]
+	if !ok {
+		return IncidentTemplate{}, errTemplateNotFound
+	}
+	if input.ID != "" && !strings.EqualFold(strings.TrimSpace(input.ID), template.ID) {
+		return IncidentTemplate{}, errors.New("id can't be changed")
+	}
+	updated := *template
+	if err := input.apply(&updated); err != nil {
+		return IncidentTemplate{}, err
+	}
+	updated.UpdatedAt = time.Now().UTC()
+	*template = updated
+	return updated, nil
+}
+
+func (s *TemplateStore) delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id = strings.ToLower(strings.TrimSpace(id))
+	if _, ok := s.templates[id]; !ok {
+		return errTemplateNotFound
+	}
+	delete(s.templates, id)
+	for i, candidate := range s.order {
+		if candidate == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// instantiate fills input in from the template. Whatever the caller set
+// wins, except that tags from both are kept.
+func (template IncidentTemplate) instantiate(input *IncidentInput, now time.Time) {
+	input.Title = strings.TrimSpace(strings.NewReplacer(
+		"{title}", strings.TrimSpace(input.Title),
+		"{date}", now.Format("2006-01-02"),
+	).Replace(template.TitlePattern))
+	input.Severity = fallback(input.Severity, template.Severity)
+	input.Tags = dedupeStrings(append(append([]string{}, template.Tags...), input.Tags...))
+	input.Tasks = append(append([]TaskInput{}, template.Tasks...), input.Tasks...)
+	input.Template = template.ID
+}
+
+// templatesHandler serves GET and, for admins, POST /api/templates.
+func templatesHandler(templates *TemplateStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReadRequest(r) && !requireSharedConfig(w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"items": templates.list()})
+		case http.MethodPost:
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			var input IncidentTemplateInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			template, err := templates.create(input)
+			if errors.Is(err, errTemplateExists) {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, template)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// templateHandler serves GET and, for admins, PUT and DELETE
+// /api/templates/{id}.
+func templateHandler(templates *TemplateStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/templates/")
+		if id == "" || strings.Contains(id, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !isReadRequest(r) && !requireSharedConfig(w, r) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			template, ok := templates.get(id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, template)
+		case http.MethodPut:
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			var input IncidentTemplateInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			template, err := templates.update(id, input)
+			if errors.Is(err, errTemplateNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, template)
+		case http.MethodDelete:
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			if err := templates.delete(id); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// asTenant sends r as the named user, bound to tenant the way a tenant's
+// API key or JWT is.
+func asTenant(r *http.Request, tenant, user string, roles ...string) *http.Request {
+	ctx := withPrincipal(r.Context(), Principal{ID: user, Name: user, Kind: principalUser, Roles: roles, Tenant: tenant})
+	return r.WithContext(withTenantValue(ctx, tenant))
+}
+
+// serveAs runs one request against handler and returns the response.
+func serveAs(t *testing.T, handler http.Handler, method, path, tenant string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	r := asTenant(httptest.NewRequest(method, path, reader), tenant, tenant+"-admin", roleAdmin)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, r)
+	return recorder
+}
+
+func TestTenantIsolation(t *testing.T) {
+	t.Setenv("RETENTION_PERIOD", "0s")
+	tenants := []string{"acme", "globex"}
+
+	store := newIncidentStore()
+	changes := newChangeFeed(store)
+	audit := newAuditLog()
+	auditStore := newAuditStore(audit)
+	for _, tenant := range tenants {
+		store.create(IncidentInput{
+			Title:    tenant + " credential stuffing",
+			Severity: "High",
+			Owner:    tenant + "-oncall",
+			Tags:     []string{tenant + "-tag", "shared"},
+			IOCs:     []string{"203.0.113.10", tenant + ".example.com"},
+			Tenant:   tenant,
+		})
+		store.create(IncidentInput{Title: tenant + " lost laptop", Status: "Closed", Tenant: tenant})
+		store.create(IncidentInput{Title: tenant + " unassigned phishing", Status: "New", Tenant: tenant})
+		audit.record(AuditEvent{Actor: tenant + "-admin", ActorType: principalUser, Action: "incident.viewed", Tenant: tenant, Resource: "/api/incidents/" + tenant})
+	}
+	reads := newReadSources(store)
+	access := newAccessLog(audit)
+	settings := newSettingsStore()
+	users := newUserStore()
+	cases := newCaseStore()
+	campaigns := newCampaignStore()
+	webhooks := newWebhookStore()
+	apiKeys := newAPIKeyStore()
+	purges := newPurgeStore()
+
+	incidents := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if items, ok := listIncidents(w, r, reads.List); ok {
+			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+		}
+	})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		path    string
+		query   map[string]any
+		// create, when set, is posted to path by each tenant first.
+		create func(tenant string) any
+	}{
+		{name: "incidents", handler: incidents, path: "/api/incidents"},
+		{name: "incident search", handler: incidents, path: "/api/incidents?q=credential"},
+		{name: "queue", handler: queueHandler(store), path: "/api/queue"},
+		{name: "tags", handler: tagsHandler(store), path: "/api/tags"},
+		{name: "tag suggestions", handler: suggestHandler(newSuggestIndex(store)), path: "/api/suggest?field=tags&prefix="},
+		{name: "owner suggestions", handler: suggestHandler(newSuggestIndex(store)), path: "/api/suggest?field=owner&prefix="},
+		{name: "ioc pivot", handler: iocPivotHandler(store), path: "/api/iocs/203.0.113.10/incidents"},
+		{name: "export", handler: incidentExportHandler(reads.Export, access, settings), path: "/api/incidents/export?format=csv"},
+		{name: "change feed", handler: changesHandler(changes), path: "/api/incidents/changes?wait=0&since=" + changes.cursor(0)},
+		{name: "graphql", handler: graphQLHandler(newGraphQLAPI(store, reads, access, settings, newTeamStore(), users)), method: http.MethodPost, path: graphQLPath, query: map[string]any{"query": "{ incidents(includeClosed: true) { items { id title owner } } }"}},
+		{name: "audit trail", handler: auditHandler(auditStore), path: "/api/audit"},
+		{
+			name: "cases", handler: casesHandler(cases, store), path: "/api/cases",
+			create: func(tenant string) any { return CaseInput{Title: tenant + " investigation"} },
+		},
+		{
+			name: "campaigns", handler: campaignsHandler(campaigns, store), path: "/api/campaigns",
+			create: func(tenant string) any { return CampaignInput{Name: tenant + " campaign"} },
+		},
+		{
+			name: "webhooks", handler: webhooksHandler(webhooks), path: "/api/webhooks",
+			create: func(tenant string) any {
+				return WebhookInput{URL: "https://hooks." + tenant + ".example.com/soc", Events: []string{"incident.created"}}
+			},
+		},
+		{
+			name: "api keys", handler: apiKeysHandler(apiKeys, users), path: "/api/admin/apikeys",
+			create: func(tenant string) any { return APIKeyInput{Name: tenant + " siem", Scopes: []string{"*:read"}} },
+		},
+		{
+			name: "purge requests", handler: purgesHandler(purges, store, audit), path: "/api/admin/purges",
+			create: func(tenant string) any {
+				return PurgeInput{IncidentIDs: []string{tenantIncidentID(tenant, "INC-1002")}, Reason: tenant + " offboarding"}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.create != nil {
+				for _, tenant := range tenants {
+					if response := serveAs(t, tt.handler, http.MethodPost, tt.path, tenant, tt.create(tenant)); response.Code >= 300 {
+						t.Fatalf("creating as %s: %d %s", tenant, response.Code, response.Body)
+					}
+				}
+			}
+			for i, tenant := range tenants {
+				other := tenants[1-i]
+				response := serveAs(t, tt.handler, fallback(tt.method, http.MethodGet), tt.path, tenant, tt.query)
+				if response.Code != http.StatusOK {
+					t.Fatalf("listing as %s: %d %s", tenant, response.Code, response.Body)
+				}
+				body := strings.ToLower(response.Body.String())
+				if !strings.Contains(body, tenant) {
+					t.Errorf("%s doesn't see its own records: %s", tenant, body)
+				}
+				if strings.Contains(body, other) {
+					t.Errorf("%s sees %s's records: %s", tenant, other, body)
+				}
+			}
+		})
+	}
+}
+
+func TestTenantIsolationOfRecords(t *testing.T) {
+	t.Setenv("RETENTION_PERIOD", "0s")
+	store := newIncidentStore()
+	audit := newAuditLog()
+	cases := newCaseStore()
+	purges := newPurgeStore()
+	apiKeys := newAPIKeyStore()
+	users := newUserStore()
+	for _, tenant := range []string{"acme", "globex"} {
+		store.create(IncidentInput{Title: tenant + " phishing", Status: "Closed", Tenant: tenant})
+	}
+	globexCase := serveAs(t, casesHandler(cases, store), http.MethodPost, "/api/cases", "globex", CaseInput{Title: "globex investigation"})
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(globexCase.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	globexPurge := serveAs(t, purgesHandler(purges, store, audit), http.MethodPost, "/api/admin/purges", "globex", PurgeInput{IncidentIDs: []string{"GLOBEX-INC-1001"}, Reason: "offboarding"})
+	var purge PurgeRequest
+	if err := json.NewDecoder(globexPurge.Body).Decode(&purge); err != nil {
+		t.Fatal(err)
+	}
+	globexKey := serveAs(t, apiKeysHandler(apiKeys, users), http.MethodPost, "/api/admin/apikeys", "globex", APIKeyInput{Name: "globex siem", Scopes: []string{"*:read"}})
+	var key APIKeyWithSecret
+	if err := json.NewDecoder(globexKey.Body).Decode(&key); err != nil {
+		t.Fatal(err)
+	}
+
+	// acme's admin can't reach globex's records by ID either.
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		path    string
+		body    any
+	}{
+		{"read another tenant's case", caseHandler(cases, store, users, newEvidenceStore()), http.MethodGet, "/api/cases/" + created.ID, nil},
+		{"read another tenant's purge", purgeHandler(purges, store, newAccessLog(audit), audit), http.MethodGet, "/api/admin/purges/" + purge.ID, nil},
+		{"confirm another tenant's purge", purgeHandler(purges, store, newAccessLog(audit), audit), http.MethodPost, "/api/admin/purges/" + purge.ID + "/confirm", nil},
+		{"cancel another tenant's purge", purgeHandler(purges, store, newAccessLog(audit), audit), http.MethodDelete, "/api/admin/purges/" + purge.ID, nil},
+		{"revoke another tenant's api key", apiKeyHandler(apiKeys), http.MethodDelete, "/api/admin/apikeys/" + key.ID, nil},
+		{"purge another tenant's incident", purgesHandler(purges, store, audit), http.MethodPost, "/api/admin/purges", PurgeInput{IncidentIDs: []string{"GLOBEX-INC-1001"}, Reason: "mistake"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := serveAs(t, tt.handler, tt.method, tt.path, "acme", tt.body)
+			if response.Code != http.StatusNotFound && response.Code != http.StatusUnprocessableEntity {
+				t.Errorf("status = %d, want 404 or 422: %s", response.Code, response.Body)
+			}
+			if strings.Contains(strings.ToLower(response.Body.String()), "globex") && tt.body == nil {
+				t.Errorf("response names globex's records: %s", response.Body)
+			}
+		})
+	}
+	if _, ok := store.get("GLOBEX-INC-1001"); !ok {
+		t.Error("GLOBEX-INC-1001 was purged by another tenant")
+	}
+	if _, ok := apiKeys.authenticate(key.Key, key.CreatedAt); !ok {
+		t.Error("globex's api key was revoked by another tenant")
+	}
+}
+
+func TestSharedConfigWrites(t *testing.T) {
+	store := newIncidentStore()
+	handlers := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		path    string
+		body    string
+	}{
+		{"watchlists", watchlistsHandler(newWatchlistStore(), store), http.MethodPost, "/api/watchlists", `{"name": "C2", "indicators": ["198.51.100.7"]}`},
+		{"auto-tag rules", autoTagRulesHandler(newAutoTagStore()), http.MethodPost, "/api/auto-tag-rules", `{"name": "Okta", "pattern": "okta", "tags": ["identity"]}`},
+		{"escalations", escalationsHandler(newEscalationStore()), http.MethodPost, "/api/escalations", `{"name": "Stale criticals", "after": "15m", "severities": ["Critical"], "bumpSeverity": true}`},
+		{"alert mappings", alertMappingHandler(newAlertMappingStore()), http.MethodPut, "/api/alerts/mappings/edr", `{"titleTemplate": "{detect.name}"}`},
+		{"routing", routingHandler(newRoutingStore()), http.MethodPut, "/api/routing", `{"rules": []}`},
+	}
+	callers := []struct {
+		name       string
+		principal  *Principal
+		tenant     string
+		wantStatus int
+	}{
+		{"anonymous", nil, "", http.StatusUnauthorized},
+		{"analyst", &Principal{ID: "carol", Kind: principalUser, Roles: []string{"analyst"}}, "", http.StatusForbidden},
+		{"admin", &Principal{ID: "alice", Kind: principalUser, Roles: []string{roleAdmin}}, "", 0},
+		{"tenant admin", &Principal{ID: "acme-admin", Kind: principalUser, Roles: []string{roleAdmin}, Tenant: "acme"}, "acme", http.StatusForbidden},
+		{"cross-tenant admin", &Principal{ID: "erin", Kind: principalUser, Roles: []string{roleAdmin, roleCrossTenant}}, "acme", 0},
+	}
+	for _, h := range handlers {
+		for _, caller := range callers {
+			t.Run(h.name+"/"+caller.name, func(t *testing.T) {
+				r := httptest.NewRequest(h.method, h.path, strings.NewReader(h.body))
+				ctx := r.Context()
+				if caller.principal != nil {
+					ctx = withPrincipal(ctx, *caller.principal)
+				}
+				r = r.WithContext(withTenantValue(ctx, caller.tenant))
+				recorder := httptest.NewRecorder()
+				h.handler.ServeHTTP(recorder, r)
+				if caller.wantStatus == 0 {
+					if recorder.Code >= 300 {
+						t.Errorf("status = %d, want success: %s", recorder.Code, recorder.Body)
+					}
+				} else if recorder.Code != caller.wantStatus {
+					t.Errorf("status = %d, want %d: %s", recorder.Code, caller.wantStatus, recorder.Body)
+				}
+			})
+		}
+	}
+}
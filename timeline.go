@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TimelineEvent is one entry in an incident's activity feed. From and To
+// are set for field changes; RefID names the note, task, alert, or
+// enrichment source an entry is about.
+type TimelineEvent struct {
+	At      time.Time `json:"at"`
+	Type    string    `json:"type"`
+	Summary string    `json:"summary"`
+	Actor   string    `json:"actor,omitempty"`
+	ActorID string    `json:"actorId,omitempty"`
+	Field   string    `json:"field,omitempty"`
+	From    string    `json:"from,omitempty"`
+	To      string    `json:"to,omitempty"`
+	RefID   string    `json:"refId,omitempty"`
+}
+
+// incidentTimeline merges the incident's field history, notes, tasks,
+// enrichments, and correlated alerts into one feed, oldest first. The store
+// records every tracked field when an incident is created; those first
+// values describe the creation entry rather than appearing as changes.
+func incidentTimeline(incident Incident) []TimelineEvent {
+	created := TimelineEvent{At: incident.CreatedAt, Type: "incident.created", Summary: "Opened: " + incident.Title}
+	events := []TimelineEvent{}
+
+	current := map[string]string{}
+	for _, change := range incident.history {
+		previous, seen := current[change.Field]
+		current[change.Field] = change.Value
+		if !seen {
+			if change.Value != "" {
+				created.Summary += ", " + change.Field + " " + change.Value
+			}
+			created.Actor, created.ActorID = change.By, change.ByID
+			continue
+		}
+		events = append(events, TimelineEvent{
+			At:      change.At,
+			Type:    change.Field + ".changed",
+			Summary: change.Field + " " + fallback(previous, "(none)") + " -> " + fallback(change.Value, "(none)"),
+			Actor:   change.By,
+			ActorID: change.ByID,
+			Field:   change.Field,
+			From:    previous,
+			To:      change.Value,
+		})
+	}
+
+	for _, note := range incident.Notes {
+		events = append(events, TimelineEvent{
+			At:      note.CreatedAt,
+			Type:    "note.added",
+			Summary: note.Body,
+			Actor:   note.Author,
+			ActorID: note.AuthorID,
+			RefID:   note.ID,
+		})
+	}
+	for _, task := range incident.Tasks {
+		events = append(events, TimelineEvent{At: task.CreatedAt, Type: "task.added", Summary: task.Title, RefID: task.ID})
+		if task.CompletedAt != nil {
+			events = append(events, TimelineEvent{At: *task.CompletedAt, Type: "task.completed", Summary: task.Title, Actor: task.Assignee, RefID: task.ID})
+		}
+	}
+	for _, enrichment := range incident.Enrichments {
+		summary := enrichment.Source + " looked up " + enrichment.IOC
+		if enrichment.Error != "" {
+			summary += " (failed: " + enrichment.Error + ")"
+		}
+		events = append(events, TimelineEvent{At: enrichment.FetchedAt, Type: "enrichment.added", Summary: summary, RefID: enrichment.Source})
+	}
+	for _, alert := range incident.Alerts {
+		summary := alert.Source + " alert attached: " + alert.Title
+		if alert.Count > 1 {
+			summary += " (seen " + strconv.Itoa(alert.Count) + " times, last " + alert.LastSeen.Format(time.RFC3339) + ")"
+		}
+		events = append(events, TimelineEvent{At: alert.FirstSeen, Type: "alert.attached", Summary: summary, RefID: alert.ID})
+	}
+
+	events = append([]TimelineEvent{created}, events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].At.Before(events[j].At)
+	})
+	return events
+}
+
+// handleIncidentTimeline serves GET /api/incidents/{id}/timeline. Pass
+// ?order=desc for newest first.
+func handleIncidentTimeline(w http.ResponseWriter, r *http.Request, id string, store *IncidentStore, access *AccessLog) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	incident, ok := store.get(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	access.record(r, id, accessView)
+	events := incidentTimeline(*incident)
+	if r.URL.Query().Get("order") == "desc" {
+		for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+			events[i], events[j] = events[j], events[i]
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"incidentId": id, "items": events})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Client certificate policies for TLS_CLIENT_AUTH.
+const (
+	clientAuthRequire  = "require"
+	clientAuthOptional = "optional"
+)
+
+// newTLSConfig serves the certificate from TLS_CERT_FILE and TLS_KEY_FILE,
+// or the one acme manages, returning nil when there is neither and the
+// server should speak plain HTTP, as it does behind a terminating proxy.
+// With TLS_CLIENT_CA_FILE, clients must also present a certificate signed
+// by one of its CAs, unless TLS_CLIENT_AUTH is optional, in which case
+// certificates are verified only when sent.
+func newTLSConfig(acme *ACMEManager) (*tls.Config, error) {
+	certFile, keyFile := envString("TLS_CERT_FILE", ""), envString("TLS_KEY_FILE", "")
+	var config *tls.Config
+	switch {
+	case acme != nil && (certFile != "" || keyFile != ""):
+		return nil, errors.New("set either ACME_DOMAINS or TLS_CERT_FILE and TLS_KEY_FILE, not both")
+	case acme != nil:
+		config = acme.tlsConfig()
+	case certFile == "" && keyFile == "":
+		return nil, nil
+	case certFile == "" || keyFile == "":
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	default:
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS certificate: %w", err)
+		}
+		config = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
+	if caFile := envString("TLS_CLIENT_CA_FILE", ""); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading TLS_CLIENT_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS_CLIENT_CA_FILE %s holds no PEM certificates", caFile)
+		}
+		config.ClientCAs = pool
+		switch mode := envString("TLS_CLIENT_AUTH", clientAuthRequire); mode {
+		case clientAuthRequire:
+			if acme != nil && acme.challenge == acmeTLSALPN01 {
+				// The CA's validation handshake has no client certificate.
+				return nil, errors.New("TLS_CLIENT_AUTH=require rules out the tls-alpn-01 challenge; set TLS_REDIRECT_ADDR to use http-01, or TLS_CLIENT_AUTH=optional")
+			}
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		case clientAuthOptional:
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("TLS_CLIENT_AUTH must be %s or %s, not %q", clientAuthRequire, clientAuthOptional, mode)
+		}
+	}
+	return config, nil
+}
+
+// httpsRedirect sends plain HTTP requests to the same path over HTTPS on
+// httpsPort, leaving the port out when it's the default.
+func httpsRedirect(httpsPort string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	}
+}
+
+// startRedirectServer answers plain HTTP on addr with redirects to HTTPS
+// until ctx is done.
+func startRedirectServer(ctx context.Context, addr string, handler http.Handler) {
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		log.Printf("redirecting http on %s to https", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("https redirect: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML decodes the TOML subset config files need: [table] headers,
+// dotted and quoted keys, basic and literal strings, numbers, booleans,
+// dates, arrays (which may span lines), and inline tables. Like parseYAML,
+// scalars decode to their text. Multi-line strings and arrays of tables
+// are not supported.
+func parseTOML(src string) (any, error) {
+	root := map[string]any{}
+	table := root
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		num := i + 1
+		text := strings.TrimSpace(stripTOMLComment(lines[i]))
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "[[") {
+			return nil, fmt.Errorf("line %d: arrays of tables are not supported", num)
+		}
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: unterminated table header", num)
+			}
+			keys, err := parseTOMLKey(text[1 : len(text)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", num, err)
+			}
+			if table, err = tomlTable(root, keys); err != nil {
+				return nil, fmt.Errorf("line %d: %w", num, err)
+			}
+			continue
+		}
+
+		rawKey, rawValue, ok := splitTOMLEntry(text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: want key = value", num)
+		}
+		// Arrays may continue over the following lines until they close.
+		for tomlOpenBrackets(rawValue) > 0 && i+1 < len(lines) {
+			i++
+			rawValue += " " + strings.TrimSpace(stripTOMLComment(lines[i]))
+		}
+		keys, err := parseTOMLKey(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", num, err)
+		}
+		flow := &tomlFlow{text: rawValue}
+		value, err := flow.value()
+		if err == nil {
+			flow.space()
+			if flow.pos < len(flow.text) {
+				err = fmt.Errorf("unexpected %q", flow.text[flow.pos:])
+			}
+		}
+		if err == nil {
+			err = tomlSet(table, keys, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", num, err)
+		}
+	}
+	return root, nil
+}
+
+// tomlTable finds or creates the table a header names.
+func tomlTable(root map[string]any, keys []string) (map[string]any, error) {
+	table := root
+	for _, key := range keys {
+		switch existing := table[key].(type) {
+		case nil:
+			next := map[string]any{}
+			table[key] = next
+			table = next
+		case map[string]any:
+			table = existing
+		default:
+			return nil, fmt.Errorf("%s is already a value, not a table", strings.Join(keys, "."))
+		}
+	}
+	return table, nil
+}
+
+func tomlSet(table map[string]any, keys []string, value any) error {
+	parent, err := tomlTable(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := parent[last]; ok {
+		return fmt.Errorf("duplicate key %s", strings.Join(keys, "."))
+	}
+	parent[last] = value
+	return nil
+}
+
+// stripTOMLComment removes a # comment outside of strings.
+func stripTOMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// tomlOpenBrackets counts the arrays and inline tables left open outside
+// of strings.
+func tomlOpenBrackets(text string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// splitTOMLEntry splits "key = value" at the first = outside quotes.
+func splitTOMLEntry(text string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// parseTOMLKey splits a dotted key into its parts, unquoting quoted ones.
+func parseTOMLKey(text string) ([]string, error) {
+	flow := &tomlFlow{text: text}
+	var keys []string
+	for {
+		flow.space()
+		if flow.pos >= len(flow.text) {
+			return nil, errors.New("missing key")
+		}
+		var key string
+		if c := flow.text[flow.pos]; c == '"' || c == '\'' {
+			quoted, err := flow.quoted()
+			if err != nil {
+				return nil, err
+			}
+			key = quoted
+		} else {
+			start := flow.pos
+			for flow.pos < len(flow.text) && isTOMLBareKeyChar(flow.text[flow.pos]) {
+				flow.pos++
+			}
+			if flow.pos == start {
+				return nil, fmt.Errorf("invalid key %q", text)
+			}
+			key = flow.text[start:flow.pos]
+		}
+		keys = append(keys, key)
+		flow.space()
+		if flow.pos >= len(flow.text) {
+			return keys, nil
+		}
+		if flow.text[flow.pos] != '.' {
+			return nil, fmt.Errorf("invalid key %q", text)
+		}
+		flow.pos++
+	}
+}
+
+func isTOMLBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// tomlFlow parses one value: a string, array, inline table, or bare word.
+type tomlFlow struct {
+	text string
+	pos  int
+}
+
+func (f *tomlFlow) space() {
+	for f.pos < len(f.text) && (f.text[f.pos] == ' ' || f.text[f.pos] == '\t') {
+		f.pos++
+	}
+}
+
+func (f *tomlFlow) value() (any, error) {
+	f.space()
+	if f.pos >= len(f.text) {
+		return nil, errors.New("missing value")
+	}
+	switch f.text[f.pos] {
+	case '"', '\'':
+		return f.quoted()
+	case '[':
+		f.pos++
+		items := []any{}
+		for {
+			f.space()
+			if f.pos < len(f.text) && f.text[f.pos] == ']' {
+				f.pos++
+				return items, nil
+			}
+			item, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			f.space()
+			if f.pos >= len(f.text) {
+				return nil, errors.New("unterminated array")
+			}
+			if f.text[f.pos] == ',' {
+				f.pos++
+			} else if f.text[f.pos] != ']' {
+				return nil, fmt.Errorf("expected , or ] in array, got %q", f.text[f.pos:])
+			}
+		}
+	case '{':
+		f.pos++
+		table := map[string]any{}
+		for {
+			f.space()
+			if f.pos < len(f.text) && f.text[f.pos] == '}' {
+				f.pos++
+				return table, nil
+			}
+			end := strings.IndexAny(f.text[f.pos:], "=")
+			if end < 0 {
+				return nil, errors.New("want key = value in inline table")
+			}
+			keys, err := parseTOMLKey(f.text[f.pos : f.pos+end])
+			if err != nil {
+				return nil, err
+			}
+			f.pos += end + 1
+			value, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			if err := tomlSet(table, keys, value); err != nil {
+				return nil, err
+			}
+			f.space()
+			if f.pos >= len(f.text) {
+				return nil, errors.New("unterminated inline table")
+			}
+			if f.text[f.pos] == ',' {
+				f.pos++
+			} else if f.text[f.pos] != '}' {
+				return nil, fmt.Errorf("expected , or } in inline table, got %q", f.text[f.pos:])
+			}
+		}
+	}
+	start := f.pos
+	for f.pos < len(f.text) && !strings.ContainsRune(",]}", rune(f.text[f.pos])) {
+		f.pos++
+	}
+	word := strings.TrimSpace(f.text[start:f.pos])
+	switch {
+	case word == "":
+		return nil, errors.New("missing value")
+	case word == "true" || word == "false":
+		return word, nil
+	case strings.ContainsAny(word[:1], "+-0123456789") || word == "inf" || word == "nan":
+		// Numbers, dates, and times; underscores only separate digits.
+		return strings.ReplaceAll(word, "_", ""), nil
+	}
+	return nil, fmt.Errorf("invalid value %q; quote strings", word)
+}
+
+// quoted reads a basic ("...", with escapes) or literal ('...') string.
+func (f *tomlFlow) quoted() (string, error) {
+	quote := f.text[f.pos]
+	if strings.HasPrefix(f.text[f.pos:], strings.Repeat(string(quote), 3)) {
+		return "", errors.New("multi-line strings are not supported")
+	}
+	for i := f.pos + 1; i < len(f.text); i++ {
+		switch c := f.text[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote:
+			raw := f.text[f.pos : i+1]
+			f.pos = i + 1
+			if quote == '\'' {
+				return raw[1 : len(raw)-1], nil
+			}
+			value, err := strconv.Unquote(raw)
+			if err != nil {
+				return "", fmt.Errorf("invalid string %s", raw)
+			}
+			return value, nil
+		}
+	}
+	return "", errors.New("unterminated string")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern is what an incoming X-Request-ID must look like to be
+// kept, which covers UUIDs and the IDs load balancers generate without
+// letting arbitrary text into logs and outbound headers.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// traceparentPattern is a W3C Trace Context traceparent header. Only
+// version 00 is understood; later versions share its first four fields.
+var traceparentPattern = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})`)
+
+// traceContext is the trace and request ID a request arrived with, carried
+// onto the outbound calls it causes so they can be stitched together
+// downstream. The zero value means no trace.
+type traceContext struct {
+	traceID string
+	// spanID is the current span: the caller's when the request came in,
+	// then the innermost span recorded here, if tracing is on.
+	spanID    string
+	flags     string
+	state     string
+	requestID string
+}
+
+type traceKey struct{}
+
+// parseTraceparent reads the traceparent and tracestate headers. All-zero
+// IDs and version ff are invalid and ignored.
+func parseTraceparent(header http.Header) (traceContext, bool) {
+	match := traceparentPattern.FindStringSubmatch(strings.TrimSpace(header.Get("traceparent")))
+	if match == nil || match[1] == "ff" || match[2] == strings.Repeat("0", 32) || match[3] == strings.Repeat("0", 16) {
+		return traceContext{}, false
+	}
+	return traceContext{traceID: match[2], spanID: match[3], flags: match[4], state: header.Get("tracestate")}, true
+}
+
+// traceparent renders a header for one outbound call made as span. Without
+// a recorded span each call gets a random parent ID, since it's a new hop
+// in the trace.
+func (t traceContext) traceparent(span *Span) string {
+	if span != nil {
+		return "00-" + t.traceID + "-" + span.spanID + "-" + t.flags
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	return "00-" + t.traceID + "-" + hex.EncodeToString(id) + "-" + t.flags
+}
+
+func contextWithTrace(ctx context.Context, trace traceContext) context.Context {
+	if trace == (traceContext{}) {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+func traceFrom(ctx context.Context) traceContext {
+	trace, _ := ctx.Value(traceKey{}).(traceContext)
+	return trace
+}
+
+// adoptTrace puts trace on ctx unless ctx already carries one, for
+// background work done on behalf of an earlier request.
+func adoptTrace(ctx context.Context, trace traceContext) context.Context {
+	if traceFrom(ctx) != (traceContext{}) {
+		return ctx
+	}
+	return contextWithTrace(ctx, trace)
+}
+
+// newRequestID returns a random 128-bit ID in hex.
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// withTracing picks up incoming trace context for the request's outbound
+// calls and echoes the trace ID back as X-Trace-Id. Every request also gets
+// a request ID, the caller's X-Request-ID when it is usable and a new one
+// otherwise, which is echoed back, logged, and passed on with the trace.
+// When spans are exported the request is recorded as a server span, which
+// starts a trace if the caller didn't send one.
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace, _ := parseTraceparent(r.Header)
+		trace.requestID = strings.TrimSpace(r.Header.Get(requestIDHeader))
+		if !requestIDPattern.MatchString(trace.requestID) {
+			trace.requestID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, trace.requestID)
+		ctx, span := startSpan(contextWithTrace(r.Context(), trace), "HTTP "+r.Method, spanServer)
+		if trace := traceFrom(ctx); trace.traceID != "" {
+			w.Header().Set("X-Trace-Id", trace.traceID)
+		}
+		if span == nil {
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		span.set("http.request.method", r.Method)
+		span.set("url.path", r.URL.Path)
+		span.set("client.address", r.RemoteAddr)
+		span.set("user_agent.original", r.UserAgent())
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			status := max(recorder.status, http.StatusOK)
+			span.set("http.response.status_code", status)
+			if status >= 500 {
+				span.fail(http.StatusText(status))
+			}
+			span.end()
+		}()
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+	})
+}
+
+// tracingTransport adds traceparent, tracestate, and X-Request-ID to
+// outbound requests whose context carries them.
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := startSpan(req.Context(), "HTTP "+req.Method, spanClient)
+	trace := traceFrom(ctx)
+	traced := trace.traceID != "" && req.Header.Get("traceparent") == ""
+	identified := trace.requestID != "" && req.Header.Get(requestIDHeader) == ""
+	if !traced && !identified {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(ctx)
+	if traced {
+		req.Header.Set("traceparent", trace.traceparent(span))
+		if trace.state != "" {
+			req.Header.Set("tracestate", trace.state)
+		}
+	}
+	if identified {
+		req.Header.Set(requestIDHeader, trace.requestID)
+	}
+	if span == nil {
+		return t.base.RoundTrip(req)
+	}
+	defer span.end()
+	// The URL without its query, which may hold credentials.
+	span.set("url.full", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	span.set("server.address", req.URL.Hostname())
+	span.set("http.request.method", req.Method)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.fail(err.Error())
+		return nil, err
+	}
+	span.set("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		span.fail(resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	errNothingToUndo = errors.New("no change to undo")
+	errUndoExpired   = errors.New("most recent change is outside the undo window")
+	errUndoForbidden = errors.New("only the author of a change or an admin can undo it")
+)
+
+// UndoResult reports which change set was reverted.
+type UndoResult struct {
+	Incident Incident      `json:"incident"`
+	Reverted []FieldChange `json:"reverted"`
+}
+
+// lastChangeSet returns the entries of the most recent update (entries
+// sharing a timestamp) and the values the fields held before it. The
+// initial values recorded at creation are never a change set.
+func lastChangeSet(incident *Incident) ([]FieldChange, IncidentUpdate) {
+	history := incident.history
+	if len(history) == 0 {
+		return nil, IncidentUpdate{}
+	}
+	at := history[len(history)-1].At
+	if at.Equal(incident.CreatedAt) {
+		return nil, IncidentUpdate{}
+	}
+	start := len(history)
+	for start > 0 && history[start-1].At.Equal(at) {
+		start--
+	}
+
+	changes := history[start:]
+	var revert IncidentUpdate
+	for _, change := range changes {
+		value := ""
+		for i := start - 1; i >= 0; i-- {
+			if history[i].Field == change.Field {
+				value = history[i].Value
+				break
+			}
+		}
+		switch change.Field {
+		case "severity":
+			revert.Severity = value
+		case "status":
+			revert.Status = value
+		case "owner":
+			revert.Owner = value
+		case "killChainPhase":
+			revert.KillChainPhase = fallback(value, killChainNone)
+		}
+	}
+	return changes, revert
+}
+
+// undo reverts the most recent change set if it is younger than window and
+// was made by the caller, unless the caller is an admin. The revert is
+// itself a change set, so undoing twice restores the change.
+func (s *IncidentStore) undo(id string, caller Principal, window time.Duration) (UndoResult, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return UndoResult{}, errIncidentNotFound
+	}
+	changes, revert := lastChangeSet(incident)
+	if len(changes) == 0 {
+		return UndoResult{}, errNothingToUndo
+	}
+	now := time.Now().UTC()
+	if now.Sub(changes[0].At) > window {
+		return UndoResult{}, errUndoExpired
+	}
+	if changes[0].ByID != caller.ID && !caller.hasRole(roleAdmin) {
+		return UndoResult{}, errUndoForbidden
+	}
+
+	revert.Actor, revert.ActorID = caller.displayName(), caller.ID
+	if err := s.applyUpdate(incident, revert, now); err != nil {
+		return UndoResult{}, err
+	}
+	return UndoResult{Incident: *incident, Reverted: append([]FieldChange{}, changes...)}, nil
+}
+
+func handleIncidentUndo(w http.ResponseWriter, r *http.Request, id string, store *IncidentStore, window time.Duration) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	caller, _ := principalFrom(r.Context())
+	result, err := store.undo(id, caller, window)
+	switch {
+	case errors.Is(err, errIncidentNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, errUndoForbidden):
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, errNothingToUndo), errors.Is(err, errUndoExpired):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// User is a person in the directory. Team is the queue their work falls
+// back to, and TeamLead marks who hears about it.
+type User struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email,omitempty"`
+	Team          string     `json:"team,omitempty"`
+	TeamLead      bool       `json:"teamLead"`
+	Active        bool       `json:"active"`
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+type UserInput struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	Email    *string `json:"email"`
+	Team     *string `json:"team"`
+	TeamLead *bool   `json:"teamLead"`
+}
+
+// UserView is a user with the open incidents they own, for load-aware
+// assignment.
+type UserView struct {
+	User
+	OpenIncidents int `json:"openIncidents"`
+}
+
+// Owner validation modes, from OWNER_VALIDATION.
+const (
+	ownerValidationReject = "reject"
+	ownerValidationOff    = "off"
+)
+
+// DeactivationResult is what deactivating a user did with their work.
+type DeactivationResult struct {
+	User       User     `json:"user"`
+	AssignedTo string   `json:"assignedTo"`
+	Reassigned []string `json:"reassigned"`
+	Notified   []string `json:"notified"`
+}
+
+var (
+	errUserNotFound    = errors.New("user not found")
+	errUserExists      = errors.New("user already exists")
+	errUserDeactivated = errors.New("user is already deactivated")
+	errUnknownOwner    = errors.New("owner must be Unassigned, an active user's ID, or a team in the directory")
+)
+
+// UserStore is the user directory. IDs are the usernames callers
+// authenticate as.
+type UserStore struct {
+	mu    sync.RWMutex
+	users map[string]*User
+	order []string
+}
+
+func newUserStore() *UserStore {
+	return &UserStore{users: make(map[string]*User), order: []string{}}
+}
+
+func userKey(id string) string {
+	return strings.ToLower(strings.TrimSpace(id))
+}
+
+func (u *UserStore) list() []User {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	items := make([]User, 0, len(u.order))
+	for _, key := range u.order {
+		items = append(items, *u.users[key])
+	}
+	return items
+}
+
+func (u *UserStore) get(id string) (User, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	user, ok := u.users[userKey(id)]
+	if !ok {
+		return User{}, false
+	}
+	return *user, true
+}
+
+// inactive reports whether id is a known, deactivated user.
+func (u *UserStore) inactive(id string) bool {
+	user, ok := u.get(id)
+	return ok && !user.Active
+}
+
+func (input UserInput) apply(user *User) {
+	if name := strings.TrimSpace(input.Name); name != "" {
+		user.Name = name
+	}
+	if input.Email != nil {
+		user.Email = strings.TrimSpace(*input.Email)
+	}
+	if input.Team != nil {
+		user.Team = strings.TrimSpace(*input.Team)
+	}
+	if input.TeamLead != nil {
+		user.TeamLead = *input.TeamLead
+	}
+}
+
+func (u *UserStore) create(input UserInput) (User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := userKey(input.ID)
+	if _, ok := u.users[key]; ok {
+		return User{}, errUserExists
+	}
+	now := time.Now().UTC()
+	user := &User{ID: strings.TrimSpace(input.ID), Name: strings.TrimSpace(input.ID), Active: true, CreatedAt: now, UpdatedAt: now}
+	input.apply(user)
+	u.users[key] = user
+	u.order = append(u.order, key)
+	return *user, nil
+}
+
+func (u *UserStore) update(id string, input UserInput) (User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user, ok := u.users[userKey(id)]
+	if !ok {
+		return User{}, errUserNotFound
+	}
+	input.apply(user)
+	user.UpdatedAt = time.Now().UTC()
+	return *user, nil
+}
+
+func (u *UserStore) deactivate(id string, now time.Time) (User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user, ok := u.users[userKey(id)]
+	if !ok {
+		return User{}, errUserNotFound
+	}
+	if !user.Active {
+		return *user, errUserDeactivated
+	}
+	user.Active = false
+	user.DeactivatedAt = &now
+	user.UpdatedAt = now
+	return *user, nil
+}
+
+// teamLeads returns the active leads of a team.
+func (u *UserStore) teamLeads(team string) []User {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	leads := []User{}
+	for _, key := range u.order {
+		if user := u.users[key]; user.Active && user.TeamLead && team != "" && strings.EqualFold(user.Team, team) {
+			leads = append(leads, *user)
+		}
+	}
+	return leads
+}
+
+// teams lists the teams active users belong to, whether or not they are
+// defined in the team store.
+func (u *UserStore) teams() []string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	teams := []string{}
+	for _, key := range u.order {
+		if user := u.users[key]; user.Active && user.Team != "" {
+			teams = append(teams, user.Team)
+		}
+	}
+	return dedupeStrings(teams)
+}
+
+// resolveOwner returns the spelling to store for an owner written through
+// the API: an active user's ID, a team's ID, or Unassigned.
+func (u *UserStore) resolveOwner(owner string, teams *TeamStore) (string, error) {
+	owner = strings.TrimSpace(owner)
+	if strings.EqualFold(owner, "Unassigned") {
+		return "Unassigned", nil
+	}
+	if user, ok := u.get(owner); ok {
+		if !user.Active {
+			return "", errors.New(user.ID + " is deactivated")
+		}
+		return user.ID, nil
+	}
+	if team, ok := lookupTeam(owner, teams, u); ok {
+		return team.ID, nil
+	}
+	return "", errUnknownOwner
+}
+
+// ownerValidationMode reads OWNER_VALIDATION: reject (the default) refuses
+// owners resolveOwner doesn't know, and off accepts any name.
+func ownerValidationMode() string {
+	if strings.EqualFold(envString("OWNER_VALIDATION", ownerValidationReject), ownerValidationOff) {
+		return ownerValidationOff
+	}
+	return ownerValidationReject
+}
+
+// canonicalizeOwner rewrites a request's owner, when set, to what
+// resolveOwner stores, answering 422 for unknown owners.
+func canonicalizeOwner(w http.ResponseWriter, users *UserStore, teams *TeamStore, mode string, owner *string) bool {
+	if mode == ownerValidationOff || strings.TrimSpace(*owner) == "" {
+		return true
+	}
+	resolved, err := users.resolveOwner(*owner, teams)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return false
+	}
+	*owner = resolved
+	return true
+}
+
+// openIncidentCounts counts the open incidents each owner has, keyed by
+// lower-case owner.
+func openIncidentCounts(incidents []Incident) map[string]int {
+	counts := map[string]int{}
+	for _, incident := range incidents {
+		if !isClosedStatus(incident.Status) {
+			counts[strings.ToLower(strings.TrimSpace(incident.Owner))]++
+		}
+	}
+	return counts
+}
+
+func userView(user User, counts map[string]int) UserView {
+	open := counts[userKey(user.ID)]
+	if !strings.EqualFold(user.Name, user.ID) {
+		open += counts[strings.ToLower(user.Name)]
+	}
+	return UserView{User: user, OpenIncidents: open}
+}
+
+// ownedBy reports whether an incident's owner names the user.
+func ownedBy(incident Incident, user User) bool {
+	return strings.EqualFold(incident.Owner, user.ID) || strings.EqualFold(incident.Owner, user.Name)
+}
+
+// transferOwnership moves a deactivated user's open incidents to their team
+// queue, or the fallback owner when they have no team, noting why on each
+// and telling the team leads.
+func transferOwnership(user User, store *IncidentStore, users *UserStore, notifier *Notifier, fallbackOwner string) DeactivationResult {
+	result := DeactivationResult{User: user, AssignedTo: fallback(user.Team, fallbackOwner), Reassigned: []string{}, Notified: []string{}}
+	for _, lead := range users.teamLeads(user.Team) {
+		result.Notified = append(result.Notified, lead.ID)
+	}
+
+	for _, incident := range store.list() {
+		if isClosedStatus(incident.Status) || !ownedBy(incident, user) {
+			continue
+		}
+		update := IncidentUpdate{Owner: result.AssignedTo, Actor: "User deactivation"}
+		updated, err := store.update(incident.ID, update)
+		if err != nil {
+			log.Printf("reassigning %s from deactivated user %s: %v", incident.ID, user.ID, err)
+			continue
+		}
+		note := NoteInput{
+			Body:       "Reassigned from " + user.Name + " to " + result.AssignedTo + " because their account was deactivated.",
+			Author:     "System",
+			AuthorType: authorTypeAutomation,
+		}
+		if _, err := store.addNote(incident.ID, note); err != nil {
+			log.Printf("noting reassignment of %s: %v", incident.ID, err)
+		}
+		result.Reassigned = append(result.Reassigned, updated.ID)
+		notifier.notify(Notification{
+			Event:      "incident.reassigned",
+			Message:    updated.ID + " reassigned from deactivated user " + user.Name + " to " + result.AssignedTo + ": " + updated.Title,
+			Incident:   updated,
+			Recipients: result.Notified,
+		})
+	}
+	return result
+}
+
+// usersHandler serves GET /api/users, where ?team= and ?active=true filter
+// and ?sort=load puts the users with the fewest open incidents first, and
+// POST for admins.
+func usersHandler(users *UserStore, store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReadRequest(r) && !requireSharedConfig(w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query()
+			counts := openIncidentCounts(visibleTo(r, store.list()))
+			items := []UserView{}
+			for _, user := range users.list() {
+				if team := query.Get("team"); team != "" && !strings.EqualFold(team, user.Team) {
+					continue
+				}
+				if query.Get("active") == "true" && !user.Active {
+					continue
+				}
+				items = append(items, userView(user, counts))
+			}
+			if query.Get("sort") == "load" {
+				sort.SliceStable(items, func(i, j int) bool { return items[i].OpenIncidents < items[j].OpenIncidents })
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+		case http.MethodPost:
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			var input UserInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			if strings.TrimSpace(input.ID) == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id is required"})
+				return
+			}
+			user, err := users.create(input)
+			if err != nil {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, user)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// userHandler serves GET and PUT /api/users/{id} and, for admins,
+// POST /api/users/{id}/deactivate.
+func userHandler(users *UserStore, store *IncidentStore, notifier *Notifier) http.HandlerFunc {
+	fallbackOwner := envString("DEACTIVATION_FALLBACK_OWNER", "Unassigned")
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/")
+		id := parts[0]
+		if id == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "deactivate") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !isReadRequest(r) && !requireSharedConfig(w, r) {
+			return
+		}
+
+		if len(parts) == 2 {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			user, err := users.deactivate(id, time.Now().UTC())
+			switch {
+			case errors.Is(err, errUserNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case err != nil:
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			default:
+				writeJSON(w, http.StatusOK, transferOwnership(user, store, users, notifier, fallbackOwner))
+			}
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			user, ok := users.get(id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, userView(user, openIncidentCounts(visibleTo(r, store.list()))))
+		case http.MethodPut:
+			if !requireRole(w, r, roleAdmin) {
+				return
+			}
+			var input UserInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			user, err := users.update(id, input)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, user)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
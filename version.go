@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// version and commit can be set at build time with
+// -ldflags "-X main.version=1.4.0 -X main.commit=abc123".
+var (
+	version = "dev"
+	commit  = ""
+)
+
+var startedAt = time.Now().UTC()
+
+type VersionInfo struct {
+	Version       string     `json:"version"`
+	Commit        string     `json:"commit"`
+	CommitTime    *time.Time `json:"commitTime,omitempty"`
+	Modified      bool       `json:"modified,omitempty"`
+	GoVersion     string     `json:"goVersion"`
+	StartedAt     time.Time  `json:"startedAt"`
+	UptimeSeconds int64      `json:"uptimeSeconds"`
+	// Assets fingerprints the static files being served, and Build the
+	// whole release; the frontend reloads when Build changes.
+	Assets string `json:"assets"`
+	Build  string `json:"build"`
+}
+
+// buildInfo fills the commit from the VCS stamp Go embeds at build time
+// unless it was set with -ldflags.
+func buildInfo() VersionInfo {
+	info := VersionInfo{Version: version, Commit: commit, GoVersion: runtime.Version(), StartedAt: startedAt}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = fallback(info.Commit, setting.Value)
+			case "vcs.time":
+				if at, err := time.Parse(time.RFC3339, setting.Value); err == nil {
+					info.CommitTime = &at
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	info.Commit = fallback(info.Commit, "unknown")
+	return info
+}
+
+func versionHandler(assets *StaticAssets) http.HandlerFunc {
+	info := buildInfo()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		current := info
+		current.UptimeSeconds = int64(time.Since(startedAt) / time.Second)
+		current.Assets = assets.fingerprint()
+		sum := sha256.Sum256([]byte(current.Version + "|" + current.Commit + "|" + current.Assets))
+		current.Build = hex.EncodeToString(sum[:8])
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, current)
+	}
+}
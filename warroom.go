@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type WarRoom struct {
+	Provider  string    `json:"provider"`
+	ChannelID string    `json:"channelId"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type WarRoomInput struct {
+	Provider string `json:"provider"`
+}
+
+// WarRoomProvider opens a collaboration space (chat channel or call bridge)
+// for an incident and can post follow-up messages into it.
+type WarRoomProvider interface {
+	name() string
+	open(ctx context.Context, incident Incident) (WarRoom, error)
+	post(ctx context.Context, room WarRoom, text string) error
+}
+
+type WarRoomService struct {
+	providers   map[string]WarRoomProvider
+	defaultName string
+}
+
+func newWarRoomService() *WarRoomService {
+	service := &WarRoomService{providers: make(map[string]WarRoomProvider)}
+	client := newOutboundClient()
+
+	if token := envString("SLACK_BOT_TOKEN", ""); token != "" {
+		service.register(&slackWarRooms{
+			client:  client,
+			token:   token,
+			baseURL: envString("SLACK_API_URL", "https://slack.com/api"),
+			private: envBool("SLACK_WARROOM_PRIVATE", false),
+		})
+	}
+	if token := envString("TEAMS_GRAPH_TOKEN", ""); token != "" {
+		service.register(&teamsWarRooms{
+			client:  client,
+			token:   token,
+			teamID:  envString("TEAMS_TEAM_ID", ""),
+			baseURL: envString("TEAMS_GRAPH_URL", "https://graph.microsoft.com/v1.0"),
+		})
+	}
+	if token := envString("ZOOM_API_TOKEN", ""); token != "" {
+		service.register(&zoomWarRooms{
+			client:  client,
+			token:   token,
+			baseURL: envString("ZOOM_API_URL", "https://api.zoom.us/v2"),
+		})
+	}
+
+	service.defaultName = envString("WARROOM_PROVIDER", "")
+	if service.defaultName == "" {
+		names := service.names()
+		if len(names) > 0 {
+			service.defaultName = names[0]
+		}
+	}
+	return service
+}
+
+func (w *WarRoomService) register(provider WarRoomProvider) {
+	w.providers[provider.name()] = provider
+}
+
+func (w *WarRoomService) names() []string {
+	names := make([]string, 0, len(w.providers))
+	for name := range w.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (w *WarRoomService) provider(name string) (WarRoomProvider, error) {
+	name = strings.ToLower(strings.TrimSpace(fallback(name, w.defaultName)))
+	if name == "" {
+		return nil, errors.New("no war room provider configured")
+	}
+	provider, ok := w.providers[name]
+	if !ok {
+		return nil, errors.New("war room provider not configured: " + name)
+	}
+	return provider, nil
+}
+
+// open creates the room and posts the incident summary into it. A failure to
+// post is not fatal: the room exists and responders can still join it.
+func (w *WarRoomService) open(ctx context.Context, providerName string, incident Incident) (WarRoom, error) {
+	provider, err := w.provider(providerName)
+	if err != nil {
+		return WarRoom{}, err
+	}
+	room, err := provider.open(ctx, incident)
+	if err != nil {
+		return WarRoom{}, err
+	}
+	room.Provider = provider.name()
+	room.CreatedAt = time.Now().UTC()
+	_ = provider.post(ctx, room, incidentSummary(incident))
+	return room, nil
+}
+
+func (w *WarRoomService) post(ctx context.Context, room WarRoom, text string) error {
+	provider, err := w.provider(room.Provider)
+	if err != nil {
+		return err
+	}
+	return provider.post(ctx, room, text)
+}
+
+func (s *IncidentStore) setWarRoom(id string, room WarRoom) (Incident, error) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	incident, ok := s.incidents[id]
+	if !ok {
+		return Incident{}, errIncidentNotFound
+	}
+	if incident.WarRoom != nil {
+		return Incident{}, errors.New("war room already open")
+	}
+	previous := *incident
+	incident.WarRoom = &room
+	incident.UpdatedAt = time.Now().UTC()
+	s.emit(eventIncidentUpdated, *incident, &previous)
+
+	return *incident, nil
+}
+
+func incidentSummary(incident Incident) string {
+	var b strings.Builder
+	b.WriteString(incident.ID + ": " + incident.Title + "\n")
+	b.WriteString("Severity: " + incident.Severity + " | Status: " + incident.Status + " | Owner: " + incident.Owner + "\n")
+	if len(incident.IOCs) > 0 {
+		b.WriteString("IOCs: " + strings.Join(incident.IOCs, ", ") + "\n")
+	}
+	if len(incident.Tags) > 0 {
+		b.WriteString("Tags: " + strings.Join(incident.Tags, ", ") + "\n")
+	}
+	if len(incident.Notes) > 0 {
+		b.WriteString("Latest note: " + incident.Notes[0].Body + "\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+var channelNameUnsafe = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// warRoomChannelName builds a Slack-safe channel name such as
+// "inc-1001-suspicious-oauth-consent-grant".
+func warRoomChannelName(incident Incident) string {
+	name := strings.ToLower(incident.ID + "-" + incident.Title)
+	name = channelNameUnsafe.ReplaceAllString(name, "-")
+	name = strings.Trim(name, "-")
+	if len(name) > 80 {
+		name = strings.TrimRight(name[:80], "-")
+	}
+	return name
+}
+
+func handleIncidentWarRoom(w http.ResponseWriter, r *http.Request, id string, store *IncidentStore, warRooms *WarRoomService) {
+	incident, ok := store.get(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if incident.WarRoom == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no war room for incident"})
+			return
+		}
+		writeJSON(w, http.StatusOK, incident.WarRoom)
+	case http.MethodPost:
+		var input WarRoomInput
+		if err := readJSON(r, &input); err != nil && !errors.Is(err, io.EOF) {
+			writeBodyError(w, err)
+			return
+		}
+		if incident.WarRoom != nil {
+			writeJSON(w, http.StatusConflict, incident.WarRoom)
+			return
+		}
+		room, err := warRooms.open(r.Context(), input.Provider, *incident)
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+			return
+		}
+		updated, err := store.setWarRoom(id, room)
+		if err != nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusCreated, updated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+type slackWarRooms struct {
+	client  *http.Client
+	token   string
+	baseURL string
+	private bool
+}
+
+type slackResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"channel"`
+}
+
+func (s *slackWarRooms) name() string { return "slack" }
+
+func (s *slackWarRooms) open(ctx context.Context, incident Incident) (WarRoom, error) {
+	var resp slackResponse
+	payload := map[string]any{"name": warRoomChannelName(incident), "is_private": s.private}
+	if err := doJSON(ctx, s.client, http.MethodPost, s.baseURL+"/conversations.create", bearer(s.token), payload, &resp); err != nil {
+		return WarRoom{}, err
+	}
+	if !resp.OK {
+		return WarRoom{}, errors.New("slack: " + resp.Error)
+	}
+	return WarRoom{
+		ChannelID: resp.Channel.ID,
+		Name:      "#" + resp.Channel.Name,
+		URL:       "https://slack.com/app_redirect?channel=" + url.QueryEscape(resp.Channel.ID),
+	}, nil
+}
+
+func (s *slackWarRooms) post(ctx context.Context, room WarRoom, text string) error {
+	var resp slackResponse
+	payload := map[string]any{"channel": room.ChannelID, "text": text}
+	if err := doJSON(ctx, s.client, http.MethodPost, s.baseURL+"/chat.postMessage", bearer(s.token), payload, &resp); err != nil {
+		return err
+	}
+	if !resp.OK {
+		return errors.New("slack: " + resp.Error)
+	}
+	return nil
+}
+
+type teamsWarRooms struct {
+	client  *http.Client
+	token   string
+	teamID  string
+	baseURL string
+}
+
+func (t *teamsWarRooms) name() string { return "teams" }
+
+func (t *teamsWarRooms) open(ctx context.Context, incident Incident) (WarRoom, error) {
+	if t.teamID == "" {
+		return WarRoom{}, errors.New("teams: TEAMS_TEAM_ID is not set")
+	}
+	var resp struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"displayName"`
+		WebURL      string `json:"webUrl"`
+	}
+	// Teams caps channel names at 50 characters.
+	displayName := []rune(incident.ID + " " + incident.Title)
+	if len(displayName) > 50 {
+		displayName = displayName[:50]
+	}
+	payload := map[string]any{
+		"displayName":    strings.TrimSpace(string(displayName)),
+		"description":    "War room for " + incident.ID,
+		"membershipType": "standard",
+	}
+	endpoint := t.baseURL + "/teams/" + url.PathEscape(t.teamID) + "/channels"
+	if err := doJSON(ctx, t.client, http.MethodPost, endpoint, bearer(t.token), payload, &resp); err != nil {
+		return WarRoom{}, err
+	}
+	return WarRoom{ChannelID: resp.ID, Name: resp.DisplayName, URL: resp.WebURL}, nil
+}
+
+func (t *teamsWarRooms) post(ctx context.Context, room WarRoom, text string) error {
+	payload := map[string]any{"body": map[string]string{"contentType": "text", "content": text}}
+	endpoint := t.baseURL + "/teams/" + url.PathEscape(t.teamID) + "/channels/" + url.PathEscape(room.ChannelID) + "/messages"
+	return doJSON(ctx, t.client, http.MethodPost, endpoint, bearer(t.token), payload, nil)
+}
+
+type zoomWarRooms struct {
+	client  *http.Client
+	token   string
+	baseURL string
+}
+
+func (z *zoomWarRooms) name() string { return "zoom" }
+
+func (z *zoomWarRooms) open(ctx context.Context, incident Incident) (WarRoom, error) {
+	var resp struct {
+		ID      int64  `json:"id"`
+		Topic   string `json:"topic"`
+		JoinURL string `json:"join_url"`
+	}
+	payload := map[string]any{
+		"topic":  incident.ID + " bridge",
+		"type":   1,
+		"agenda": incidentSummary(incident),
+	}
+	if err := doJSON(ctx, z.client, http.MethodPost, z.baseURL+"/users/me/meetings", bearer(z.token), payload, &resp); err != nil {
+		return WarRoom{}, err
+	}
+	return WarRoom{ChannelID: strconv.FormatInt(resp.ID, 10), Name: resp.Topic, URL: resp.JoinURL}, nil
+}
+
+// post is a no-op for Zoom: bridges carry the summary in the meeting agenda.
+func (z *zoomWarRooms) post(ctx context.Context, room WarRoom, text string) error {
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Watchlist struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Indicators  []string  `json:"indicators"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type WatchlistInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Indicators  []string `json:"indicators"`
+}
+
+type WatchlistHit struct {
+	WatchlistID   string `json:"watchlistId"`
+	WatchlistName string `json:"watchlistName"`
+	Indicator     string `json:"indicator"`
+}
+
+var errWatchlistNotFound = errors.New("watchlist not found")
+
+type WatchlistStore struct {
+	mu         sync.RWMutex
+	watchlists map[string]*Watchlist
+	order      []string
+	counter    int
+	// index maps a normalized indicator to the watchlists containing it.
+	index map[string][]string
+}
+
+func newWatchlistStore() *WatchlistStore {
+	return &WatchlistStore{
+		watchlists: make(map[string]*Watchlist),
+		order:      []string{},
+		index:      make(map[string][]string),
+	}
+}
+
+func (w *WatchlistStore) list() []Watchlist {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	items := make([]Watchlist, 0, len(w.order))
+	for _, id := range w.order {
+		if watchlist := w.watchlists[id]; watchlist != nil {
+			items = append(items, *watchlist)
+		}
+	}
+	return items
+}
+
+func (w *WatchlistStore) get(id string) (Watchlist, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	watchlist, ok := w.watchlists[id]
+	if !ok {
+		return Watchlist{}, false
+	}
+	return *watchlist, true
+}
+
+func (w *WatchlistStore) create(input WatchlistInput) Watchlist {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.counter++
+	now := time.Now().UTC()
+	watchlist := &Watchlist{
+		ID:          "WL-" + padInt(w.counter),
+		Name:        strings.TrimSpace(input.Name),
+		Description: input.Description,
+		Indicators:  sanitizeSlice(input.Indicators),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	w.watchlists[watchlist.ID] = watchlist
+	w.order = append(w.order, watchlist.ID)
+	w.reindex()
+
+	return *watchlist
+}
+
+func (w *WatchlistStore) update(id string, input WatchlistInput) (Watchlist, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	watchlist, ok := w.watchlists[id]
+	if !ok {
+		return Watchlist{}, errWatchlistNotFound
+	}
+	if strings.TrimSpace(input.Name) != "" {
+		watchlist.Name = strings.TrimSpace(input.Name)
+	}
+	if input.Description != "" {
+		watchlist.Description = input.Description
+	}
+	if input.Indicators != nil {
+		watchlist.Indicators = sanitizeSlice(input.Indicators)
+	}
+	watchlist.UpdatedAt = time.Now().UTC()
+	w.reindex()
+
+	return *watchlist, nil
+}
+
+func (w *WatchlistStore) delete(id string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.watchlists[id]; !ok {
+		return errWatchlistNotFound
+	}
+	delete(w.watchlists, id)
+	for i, existing := range w.order {
+		if existing == id {
+			w.order = append(w.order[:i], w.order[i+1:]...)
+			break
+		}
+	}
+	w.reindex()
+	return nil
+}
+
+// reindex rebuilds the indicator index. Callers must hold w.mu.
+func (w *WatchlistStore) reindex() {
+	w.index = make(map[string][]string)
+	for _, id := range w.order {
+		for _, indicator := range w.watchlists[id].Indicators {
+			key := normalizeIOC(indicator)
+			w.index[key] = append(w.index[key], id)
+		}
+	}
+}
+
+func (w *WatchlistStore) hits(iocs []string) []WatchlistHit {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	hits := []WatchlistHit{}
+	for _, ioc := range iocs {
+		for _, id := range w.index[normalizeIOC(ioc)] {
+			hits = append(hits, WatchlistHit{
+				WatchlistID:   id,
+				WatchlistName: w.watchlists[id].Name,
+				Indicator:     ioc,
+			})
+		}
+	}
+	return hits
+}
+
+// annotateIncident is registered as a store annotator so every write keeps
+// incident.WatchlistHits current.
+func (w *WatchlistStore) annotateIncident(incident *Incident) {
+	incident.WatchlistHits = w.hits(incident.IOCs)
+}
+
+// newWatchlistHits returns hits on incident that previous did not have.
+func newWatchlistHits(incident Incident, previous *Incident) []WatchlistHit {
+	seen := map[string]bool{}
+	if previous != nil {
+		for _, hit := range previous.WatchlistHits {
+			seen[hit.WatchlistID+"|"+normalizeIOC(hit.Indicator)] = true
+		}
+	}
+	fresh := []WatchlistHit{}
+	for _, hit := range incident.WatchlistHits {
+		if !seen[hit.WatchlistID+"|"+normalizeIOC(hit.Indicator)] {
+			fresh = append(fresh, hit)
+		}
+	}
+	return fresh
+}
+
+func watchlistsHandler(watchlists *WatchlistStore, store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isReadRequest(r) && (!requireRole(w, r, roleAdmin) || !requireSharedConfig(w, r)) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"items": watchlists.list()})
+		case http.MethodPost:
+			var input WatchlistInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			if strings.TrimSpace(input.Name) == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required"})
+				return
+			}
+			watchlist := watchlists.create(input)
+			store.reannotate()
+			writeJSON(w, http.StatusCreated, watchlist)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func watchlistHandler(watchlists *WatchlistStore, store *IncidentStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/watchlists/")
+		if id == "" || strings.Contains(id, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !isReadRequest(r) && (!requireRole(w, r, roleAdmin) || !requireSharedConfig(w, r)) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			watchlist, ok := watchlists.get(id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, watchlist)
+		case http.MethodPut:
+			var input WatchlistInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			watchlist, err := watchlists.update(id, input)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			store.reannotate()
+			writeJSON(w, http.StatusOK, watchlist)
+		case http.MethodDelete:
+			if err := watchlists.delete(id); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			store.reannotate()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webhookEvents are the store events subscribers can ask for.
+var webhookEvents = []string{eventIncidentCreated, eventIncidentUpdated, eventNoteAdded}
+
+// Delivery states.
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryRetrying  = "retrying"
+	deliveryFailed    = "failed"
+)
+
+// Webhook is a subscriber URL that receives store events as signed JSON.
+// Its secret is only returned when it is set: at creation, or on a PUT that
+// changes it. It belongs to the tenant it was created in and only receives
+// that tenant's events.
+type Webhook struct {
+	ID          string    `json:"id"`
+	Tenant      string    `json:"tenant,omitempty"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+
+	secret string
+}
+
+type WebhookInput struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description *string  `json:"description"`
+	Enabled     *bool    `json:"enabled"`
+	// Secret is generated when left out at creation.
+	Secret *string `json:"secret"`
+}
+
+type WebhookWithSecret struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookDelivery is one event's delivery to one webhook, across attempts.
+type WebhookDelivery struct {
+	ID             string     `json:"id"`
+	WebhookID      string     `json:"webhookId"`
+	Event          string     `json:"event"`
+	IncidentID     string     `json:"incidentId"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"responseStatus,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt,omitempty"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+
+	body  []byte
+	trace traceContext
+}
+
+// WebhookPayload is the JSON body POSTed to subscribers. Version is the
+// event's payload version and Schema where its JSON Schema is published.
+type WebhookPayload struct {
+	ID      string    `json:"id"`
+	Event   string    `json:"event"`
+	Version int       `json:"version"`
+	Schema  string    `json:"schema"`
+	At      time.Time `json:"at"`
+	// TraceID is the W3C trace ID of the request behind the event, if it
+	// came with one.
+	TraceID string `json:"traceId,omitempty"`
+	// RequestID is the X-Request-ID of the request behind the event.
+	RequestID string   `json:"requestId,omitempty"`
+	Incident  Incident `json:"incident"`
+}
+
+var errWebhookNotFound = errors.New("webhook not found")
+
+type WebhookStore struct {
+	client      *http.Client
+	maxAttempts int
+	retryBase   time.Duration
+	logSize     int
+	queue       chan string
+	pending     pendingWork
+
+	mu              sync.RWMutex
+	webhooks        map[string]*Webhook
+	order           []string
+	counter         int
+	deliveries      map[string]*WebhookDelivery
+	deliveryLog     map[string][]string
+	deliveryCounter int
+	// failedAttempts counts every delivery attempt that didn't get a 2xx,
+	// including those later retried successfully.
+	failedAttempts uint64
+}
+
+func newWebhookStore() *WebhookStore {
+	return &WebhookStore{
+		client:      newOutboundClient(),
+		maxAttempts: envInt("WEBHOOK_MAX_ATTEMPTS", 6),
+		retryBase:   envDuration("WEBHOOK_RETRY_BASE", 10*time.Second),
+		logSize:     envInt("WEBHOOK_DELIVERY_LOG_SIZE", 100),
+		queue:       make(chan string, envInt("WEBHOOK_QUEUE_SIZE", 1024)),
+		webhooks:    make(map[string]*Webhook),
+		order:       []string{},
+		deliveries:  make(map[string]*WebhookDelivery),
+		deliveryLog: make(map[string][]string),
+	}
+}
+
+func (s *WebhookStore) start(store *IncidentStore) {
+	store.subscribe(s.handleEvent)
+	go func() {
+		for id := range s.queue {
+			s.attempt(id)
+			s.pending.done()
+		}
+	}()
+}
+
+func generateWebhookSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(raw), nil
+}
+
+// signWebhook is the X-Signature value: the hex HMAC-SHA256 of the body
+// keyed by the webhook's secret.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *WebhookStore) list(tenant string) []Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]Webhook, 0, len(s.order))
+	for _, id := range s.order {
+		if webhook := s.webhooks[id]; webhook.Tenant == tenant {
+			items = append(items, *webhook)
+		}
+	}
+	return items
+}
+
+func (s *WebhookStore) get(id string) (Webhook, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return Webhook{}, false
+	}
+	return *webhook, true
+}
+
+// apply validates input onto webhook.
+func (input WebhookInput) apply(webhook *Webhook) error {
+	if input.URL != "" {
+		parsed, err := url.Parse(strings.TrimSpace(input.URL))
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return errors.New("url must be an http or https URL")
+		}
+		webhook.URL = parsed.String()
+	}
+	if input.Events != nil {
+		events := []string{}
+		for _, event := range sanitizeSlice(input.Events) {
+			event = strings.ToLower(event)
+			if !slices.Contains(webhookEvents, event) {
+				return errors.New("events must be any of " + strings.Join(webhookEvents, ", "))
+			}
+			if !slices.Contains(events, event) {
+				events = append(events, event)
+			}
+		}
+		webhook.Events = events
+	}
+	if input.Description != nil {
+		webhook.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.Enabled != nil {
+		webhook.Enabled = *input.Enabled
+	}
+	if input.Secret != nil {
+		secret := strings.TrimSpace(*input.Secret)
+		if len(secret) < 16 {
+			return errors.New("secret must be at least 16 characters")
+		}
+		webhook.secret = secret
+	}
+	if webhook.URL == "" {
+		return errors.New("url is required")
+	}
+	return nil
+}
+
+func (s *WebhookStore) create(input WebhookInput, tenant string) (WebhookWithSecret, error) {
+	now := time.Now().UTC()
+	webhook := &Webhook{Tenant: tenant, Events: append([]string{}, webhookEvents...), Enabled: true, CreatedAt: now, UpdatedAt: now}
+	if input.Secret == nil {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return WebhookWithSecret{}, err
+		}
+		webhook.secret = secret
+	}
+	if err := input.apply(webhook); err != nil {
+		return WebhookWithSecret{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counter++
+	webhook.ID = "WHK-" + padInt(s.counter)
+	s.webhooks[webhook.ID] = webhook
+	s.order = append(s.order, webhook.ID)
+	return WebhookWithSecret{Webhook: *webhook, Secret: webhook.secret}, nil
+}
+
+// update returns the secret only when input changed it.
+func (s *WebhookStore) update(id string, input WebhookInput) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.webhooks[id]
+	if !ok {
+		return nil, errWebhookNotFound
+	}
+	webhook := *existing
+	if err := input.apply(&webhook); err != nil {
+		return nil, err
+	}
+	webhook.UpdatedAt = time.Now().UTC()
+	*existing = webhook
+	if input.Secret != nil {
+		return WebhookWithSecret{Webhook: webhook, Secret: webhook.secret}, nil
+	}
+	return webhook, nil
+}
+
+// delete removes the webhook and its delivery log; pending retries are
+// dropped.
+func (s *WebhookStore) delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return errWebhookNotFound
+	}
+	delete(s.webhooks, id)
+	for _, deliveryID := range s.deliveryLog[id] {
+		delete(s.deliveries, deliveryID)
+	}
+	delete(s.deliveryLog, id)
+	for i, existing := range s.order {
+		if existing == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// deliveriesFor returns a webhook's delivery log, newest first.
+func (s *WebhookStore) deliveriesFor(id string) ([]WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return nil, errWebhookNotFound
+	}
+	ids := s.deliveryLog[id]
+	items := make([]WebhookDelivery, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		items = append(items, *s.deliveries[ids[i]])
+	}
+	return items, nil
+}
+
+// handleEvent queues a delivery to every enabled webhook of the incident's
+// tenant subscribed to the event. Restricted cases are redacted:
+// subscribers aren't necessarily cleared for them.
+func (s *WebhookStore) handleEvent(event IncidentEvent) {
+	if !slices.Contains(webhookEvents, event.Type) {
+		return
+	}
+	incident := event.Incident
+	if incident.Restricted {
+		incident = redactIncident(incident)
+	}
+
+	s.mu.Lock()
+	queued := []string{}
+	for _, webhookID := range s.order {
+		webhook := s.webhooks[webhookID]
+		if !webhook.Enabled || webhook.Tenant != incident.Tenant || !slices.Contains(webhook.Events, event.Type) {
+			continue
+		}
+		s.deliveryCounter++
+		delivery := &WebhookDelivery{
+			ID:         "DLV-" + padInt(s.deliveryCounter),
+			WebhookID:  webhookID,
+			Event:      event.Type,
+			IncidentID: incident.ID,
+			Status:     deliveryPending,
+			CreatedAt:  event.At,
+			trace:      incident.trace,
+		}
+		body, err := json.Marshal(WebhookPayload{
+			ID:        delivery.ID,
+			Event:     event.Type,
+			Version:   webhookEventVersions[event.Type],
+			Schema:    webhookSchemaID(event.Type),
+			At:        event.At,
+			TraceID:   incident.trace.traceID,
+			RequestID: incident.trace.requestID,
+			Incident:  incident,
+		})
+		if err != nil {
+			log.Printf("webhook %s: encoding %s: %v", webhookID, event.Type, err)
+			continue
+		}
+		delivery.body = body
+		s.deliveries[delivery.ID] = delivery
+		s.deliveryLog[webhookID] = append(s.deliveryLog[webhookID], delivery.ID)
+		if overflow := len(s.deliveryLog[webhookID]) - s.logSize; overflow > 0 {
+			for _, old := range s.deliveryLog[webhookID][:overflow] {
+				delete(s.deliveries, old)
+			}
+			s.deliveryLog[webhookID] = s.deliveryLog[webhookID][overflow:]
+		}
+		queued = append(queued, delivery.ID)
+	}
+	s.mu.Unlock()
+
+	for _, id := range queued {
+		s.enqueue(id)
+	}
+}
+
+func (s *WebhookStore) enqueue(deliveryID string) {
+	s.pending.add()
+	select {
+	case s.queue <- deliveryID:
+	default:
+		s.pending.done()
+		log.Printf("webhook queue full, dropping delivery %s", deliveryID)
+		s.finish(deliveryID, 0, errors.New("delivery queue full"))
+	}
+}
+
+// attempt sends a delivery once and schedules a retry, with exponential
+// backoff, if it failed and attempts remain.
+func (s *WebhookStore) attempt(deliveryID string) {
+	s.mu.RLock()
+	delivery, ok := s.deliveries[deliveryID]
+	var webhook *Webhook
+	if ok {
+		webhook = s.webhooks[delivery.WebhookID]
+	}
+	var target, secret, event string
+	var body []byte
+	var trace traceContext
+	if webhook != nil {
+		target, secret, event, body, trace = webhook.URL, webhook.secret, delivery.Event, delivery.body, delivery.trace
+	}
+	s.mu.RUnlock()
+	if webhook == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(contextWithTrace(context.Background(), trace), 15*time.Second)
+	defer cancel()
+	status, err := s.post(ctx, target, secret, event, deliveryID, body)
+	s.finish(deliveryID, status, err)
+}
+
+func (s *WebhookStore) post(ctx context.Context, target, secret, event, deliveryID string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", signWebhook(secret, body))
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-Version", itoa(webhookEventVersions[event]))
+	req.Header.Set("X-Webhook-Delivery", deliveryID)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(snippet))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+func (s *WebhookStore) finish(deliveryID string, status int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[deliveryID]
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = status
+	delivery.NextAttemptAt = nil
+	if err == nil {
+		delivery.Status, delivery.Error = deliveryDelivered, ""
+		return
+	}
+	delivery.Error = err.Error()
+	s.failedAttempts++
+	if delivery.Attempts >= s.maxAttempts {
+		delivery.Status = deliveryFailed
+		log.Printf("webhook %s: giving up on %s after %d attempts: %v", delivery.WebhookID, deliveryID, delivery.Attempts, err)
+		return
+	}
+	wait := min(s.retryBase<<(delivery.Attempts-1), time.Hour)
+	next := now.Add(wait)
+	delivery.Status, delivery.NextAttemptAt = deliveryRetrying, &next
+	time.AfterFunc(wait, func() { s.enqueue(deliveryID) })
+}
+
+func webhooksHandler(webhooks *WebhookStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"items": webhooks.list(tenantFrom(r.Context()))})
+		case http.MethodPost:
+			var input WebhookInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			created, err := webhooks.create(input, tenantFrom(r.Context()))
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusCreated, created)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// webhookHandler serves GET, PUT, and DELETE /api/webhooks/{id} and GET
+// /api/webhooks/{id}/deliveries, admin only.
+func webhookHandler(webhooks *WebhookStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireRole(w, r, roleAdmin) {
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/webhooks/"), "/")
+		id := parts[0]
+		if id == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "deliveries") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if webhook, ok := webhooks.get(id); !ok || !inTenant(r, webhook.Tenant) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if len(parts) == 2 {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			deliveries, err := webhooks.deliveriesFor(id)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": deliveries})
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			webhook, ok := webhooks.get(id)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, webhook)
+		case http.MethodPut:
+			var input WebhookInput
+			if err := readJSON(r, &input); err != nil {
+				writeBodyError(w, err)
+				return
+			}
+			updated, err := webhooks.update(id, input)
+			if errors.Is(err, errWebhookNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, updated)
+		case http.MethodDelete:
+			if err := webhooks.delete(id); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// webhookEventVersions is the current payload version of each webhook
+// event. Bump an event's version whenever its payload changes in a way
+// existing consumers could trip over: a field removed, renamed, or retyped.
+// New optional fields don't need a bump.
+var webhookEventVersions = map[string]int{
+	eventIncidentCreated: 1,
+	eventIncidentUpdated: 1,
+	eventNoteAdded:       1,
+}
+
+// WebhookSchema is the JSON Schema of one event's payload at its current
+// version.
+type WebhookSchema struct {
+	Event   string         `json:"event"`
+	Version int            `json:"version"`
+	Schema  map[string]any `json:"schema"`
+}
+
+func webhookSchemaID(event string) string {
+	return "/api/webhooks/schemas/" + event
+}
+
+// webhookSchema describes WebhookPayload for event. It is generated from the
+// Go types so it can't drift from what is actually sent.
+func webhookSchema(event string) WebhookSchema {
+	version := webhookEventVersions[event]
+	defs := map[string]any{}
+	schema := structSchema(reflect.TypeOf(WebhookPayload{}), defs)
+	properties := schema["properties"].(map[string]any)
+	properties["event"] = map[string]any{"const": event}
+	properties["version"] = map[string]any{"const": version}
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = webhookSchemaID(event)
+	schema["title"] = event + " v" + itoa(version)
+	schema["$defs"] = defs
+	return WebhookSchema{Event: event, Version: version, Schema: schema}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonSchemaFor describes how encoding/json renders t. Named structs go in
+// defs and are referenced, which keeps recursive types finite. Fields
+// without omitempty are required; nil slices, maps, and pointers encode as
+// null, so those allow it.
+func jsonSchemaFor(t reflect.Type, defs map[string]any) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return nullable(jsonSchemaFor(t.Elem(), defs))
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return nullable(map[string]any{"type": "array", "items": jsonSchemaFor(t.Elem(), defs)})
+	case reflect.Map:
+		return nullable(map[string]any{"type": "object", "additionalProperties": jsonSchemaFor(t.Elem(), defs)})
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, defs)
+		}
+		if _, ok := defs[t.Name()]; !ok {
+			// Reserve the name before walking the fields in case they
+			// refer back to this type.
+			defs[t.Name()] = nil
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+func nullable(schema map[string]any) map[string]any {
+	return map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+}
+
+func structSchema(t reflect.Type, defs map[string]any) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	var walk func(reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				walk(field.Type)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = jsonSchemaFor(field.Type, defs)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	walk(t)
+	sort.Strings(required)
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
+
+// webhookSchemasHandler serves GET /api/webhooks/schemas, every event's
+// current schema, and GET /api/webhooks/schemas/{event}, one schema as a
+// JSON Schema document.
+func webhookSchemasHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		event := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/webhooks/schemas"), "/")
+		if event == "" {
+			items := []WebhookSchema{}
+			for _, event := range webhookEvents {
+				items = append(items, webhookSchema(event))
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+			return
+		}
+		if _, ok := webhookEventVersions[event]; !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "no schema for event " + event})
+			return
+		}
+		writeJSON(w, http.StatusOK, webhookSchema(event).Schema)
+	}
+}
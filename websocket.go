@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes (RFC 6455 section 5.2).
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xA
+)
+
+// wsGUID is appended to the client key to prove the server speaks
+// WebSocket.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxClientFrame bounds frames from clients, which only ever send control
+// frames here.
+const wsMaxClientFrame = 4096
+
+// wsConn is a server side WebSocket connection. Writes are serialized since
+// pongs are sent from the read loop.
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	mu sync.Mutex
+}
+
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket completes the opening handshake and takes over the
+// connection. On failure the response has already been written.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "websocket upgrade required"})
+		return nil, errors.New("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeJSON(w, http.StatusUpgradeRequired, map[string]string{"error": "unsupported websocket version"})
+		return nil, errors.New("unsupported websocket version")
+	}
+	conn, buffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "websocket unsupported"})
+		return nil, err
+	}
+	// The server's timeouts don't apply once the connection is hijacked.
+	conn.SetDeadline(time.Time{})
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n"
+	if _, err := buffered.WriteString(response); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := buffered.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: buffered.Reader}, nil
+}
+
+// write sends one unfragmented, unmasked frame.
+func (c *wsConn) write(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch size := len(payload); {
+	case size < 126:
+		header = append(header, byte(size))
+	case size <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(size))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(size))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *wsConn) writeJSON(value any) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.write(wsText, payload)
+}
+
+// read returns the next frame from the client, unmasked. Client frames must
+// be masked.
+func (c *wsConn) read() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		return 0, nil, errors.New("unmasked client frame")
+	}
+	size := uint64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(extended[:])
+	}
+	if size > wsMaxClientFrame {
+		return 0, nil, errors.New("client frame too large")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// readLoop answers pings and the closing handshake, ignoring anything else
+// the client sends, and closes done when the client goes away.
+func (c *wsConn) readLoop(done chan<- struct{}) {
+	defer close(done)
+	for {
+		opcode, payload, err := c.read()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case wsPing:
+			if c.write(wsPong, payload) != nil {
+				return
+			}
+		case wsClose:
+			c.write(wsClose, payload)
+			return
+		}
+	}
+}
+
+// wsHandler serves GET /api/ws, pushing each change feed entry the caller
+// may see as a JSON text message, in the shape of the long-polling feed's
+// items. A client that falls behind the feed's buffer gets
+// {"type": "resync", "cursor": ...} and should reload the list.
+func wsHandler(feed *ChangeFeed) http.HandlerFunc {
+	pingInterval := envDuration("WS_PING_INTERVAL", 30*time.Second)
+	if pingInterval <= 0 {
+		pingInterval = 30 * time.Second
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWebSocket(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.conn.Close()
+
+		done := make(chan struct{})
+		go conn.readLoop(done)
+		pings := time.NewTicker(pingInterval)
+		defer pings.Stop()
+
+		seq, _ := feed.parseCursor("")
+		for {
+			changes, changed, _, err := feed.since(seq)
+			if err != nil {
+				cursor := feed.current()
+				seq, _ = feed.parseCursor(cursor)
+				if conn.writeJSON(map[string]string{"type": "resync", "cursor": cursor}) != nil {
+					return
+				}
+				continue
+			}
+			for _, change := range changes {
+				seq = change.seq
+				if !canView(r, change.Incident) {
+					continue
+				}
+				if conn.writeJSON(change) != nil {
+					return
+				}
+			}
+			select {
+			case <-changed:
+			case <-pings.C:
+				if conn.write(wsPing, nil) != nil {
+					return
+				}
+			case <-done:
+				return
+			case <-feed.closing:
+				// 1001, going away.
+				conn.write(wsClose, []byte{0x03, 0xe9})
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// parseYAML decodes the block-style YAML subset used by Sigma rules and
+// config files: nested mappings and sequences, flow collections on one line,
+// quoted and plain scalars, literal and folded block scalars, and comments.
+// Scalars decode to strings (null and ~ to nil); anchors, tags, and multiple
+// documents are not supported.
+func parseYAML(src string) (any, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(raw) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+
+	line, ok := p.peek()
+	if ok && line.text == "---" {
+		p.pos++
+		line, ok = p.peek()
+	}
+	if !ok {
+		return nil, nil
+	}
+	value, err := p.parseNode(line.indent)
+	if err != nil {
+		return nil, err
+	}
+	if line, ok := p.peek(); ok {
+		if line.text == "---" {
+			return nil, fmt.Errorf("line %d: multiple documents are not supported", line.num)
+		}
+		return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+	}
+	return value, nil
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// peek returns the next line with content, skipping blanks and comments.
+func (p *yamlParser) peek() (yamlLine, bool) {
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.text != "" && !strings.HasPrefix(line.text, "#") {
+			return line, true
+		}
+		p.pos++
+	}
+	return yamlLine{}, false
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseNode(indent int) (any, error) {
+	line, ok := p.peek()
+	if !ok || line.indent < indent {
+		return nil, nil
+	}
+	if isSeqItem(line.text) {
+		return p.parseSeq(line.indent)
+	}
+	if _, _, ok := splitYAMLEntry(line.text); ok {
+		return p.parseMap(line.indent)
+	}
+	p.pos++
+	return parseYAMLInline(stripYAMLComment(line.text), line.num)
+}
+
+func (p *yamlParser) parseSeq(indent int) ([]any, error) {
+	items := []any{}
+	for {
+		line, ok := p.peek()
+		if !ok || line.indent != indent || !isSeqItem(line.text) {
+			return items, nil
+		}
+		content := strings.TrimLeft(line.text[1:], " ")
+		if content == "" {
+			p.pos++
+			item, err := p.parseNode(indent + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		// "- key: value" and "- - item" open a nested collection whose
+		// column is where the content starts; reparse the line from there.
+		_, _, entry := splitYAMLEntry(content)
+		if entry || isSeqItem(content) {
+			p.lines[p.pos] = yamlLine{num: line.num, indent: indent + len(line.text) - len(content), text: content}
+			item, err := p.parseNode(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		p.pos++
+		item, err := parseYAMLInline(stripYAMLComment(content), line.num)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+func (p *yamlParser) parseMap(indent int) (map[string]any, error) {
+	values := map[string]any{}
+	for {
+		line, ok := p.peek()
+		if !ok || line.indent != indent || isSeqItem(line.text) {
+			return values, nil
+		}
+		key, rest, ok := splitYAMLEntry(line.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line.num)
+		}
+		if _, exists := values[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		p.pos++
+
+		rest = stripYAMLComment(rest)
+		switch {
+		case rest == "":
+			next, ok := p.peek()
+			switch {
+			case ok && next.indent > indent:
+				value, err := p.parseNode(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				values[key] = value
+			case ok && next.indent == indent && isSeqItem(next.text):
+				value, err := p.parseSeq(indent)
+				if err != nil {
+					return nil, err
+				}
+				values[key] = value
+			default:
+				values[key] = nil
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			values[key] = p.blockScalar(indent, rest)
+		default:
+			value, err := parseYAMLInline(rest, line.num)
+			if err != nil {
+				return nil, err
+			}
+			if text, ok := value.(string); ok && rest[0] != '\'' && rest[0] != '"' {
+				value = p.plainContinuation(indent, text)
+			}
+			values[key] = value
+		}
+	}
+}
+
+// plainContinuation folds more-indented lines that continue a plain scalar.
+func (p *yamlParser) plainContinuation(indent int, text string) string {
+	for {
+		line, ok := p.peek()
+		if !ok || line.indent <= indent {
+			return text
+		}
+		if _, _, entry := splitYAMLEntry(line.text); entry || isSeqItem(line.text) {
+			return text
+		}
+		text += " " + stripYAMLComment(line.text)
+		p.pos++
+	}
+}
+
+// blockScalar reads a | or > scalar. Comments inside are content, so it
+// consumes raw lines rather than using peek.
+func (p *yamlParser) blockScalar(indent int, header string) string {
+	folded := header[0] == '>'
+	chomp := ""
+	if strings.ContainsAny(header, "-+") {
+		chomp = string(header[strings.IndexAny(header, "-+")])
+	}
+
+	var lines []string
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.text == "" {
+			lines = append(lines, "")
+			p.pos++
+			continue
+		}
+		if line.indent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		lines = append(lines, strings.Repeat(" ", max(line.indent-blockIndent, 0))+line.text)
+		p.pos++
+	}
+
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	separator := "\n"
+	if folded {
+		separator = " "
+	}
+	text := strings.Join(lines, separator)
+	switch chomp {
+	case "-":
+		return text
+	case "+":
+		return text + strings.Repeat("\n", trailing+1)
+	}
+	return text + "\n"
+}
+
+// splitYAMLEntry splits "key: value" (or "key:"), honouring quoted keys.
+func splitYAMLEntry(text string) (string, string, bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' || isSeqItem(text) {
+		return "", "", false
+	}
+	if text[0] == '\'' || text[0] == '"' {
+		key, end, err := parseYAMLQuoted(text, 0)
+		if err != nil || end >= len(text) || text[end] != ':' {
+			return "", "", false
+		}
+		if end+1 < len(text) && text[end+1] != ' ' {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(text[end+1:]), true
+	}
+	if strings.HasPrefix(text, "#") {
+		return "", "", false
+	}
+	if index := strings.Index(text, ": "); index >= 0 {
+		key := strings.TrimSpace(text[:index])
+		if strings.Contains(key, " #") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(text[index+2:]), true
+	}
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSpace(text[:len(text)-1]), "", true
+	}
+	return "", "", false
+}
+
+// stripYAMLComment removes a trailing " # comment" outside of quotes.
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				if i+1 < len(text) && text[i+1] == '\'' {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+		case quote == '"':
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quote = 0
+			}
+		case (c == '\'' || c == '"') && (i == 0 || strings.ContainsRune(" [{,:", rune(text[i-1]))):
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimSpace(text[:i])
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+func parseYAMLInline(text string, num int) (any, error) {
+	flow := &yamlFlow{text: text}
+	value, err := flow.value(false)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", num, err)
+	}
+	flow.space()
+	if flow.pos < len(flow.text) {
+		return nil, fmt.Errorf("line %d: unexpected %q", num, flow.text[flow.pos:])
+	}
+	return value, nil
+}
+
+// yamlFlow parses flow collections ([a, b], {k: v}) and scalars.
+type yamlFlow struct {
+	text string
+	pos  int
+}
+
+func (f *yamlFlow) space() {
+	for f.pos < len(f.text) && f.text[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+func (f *yamlFlow) value(inFlow bool) (any, error) {
+	f.space()
+	if f.pos >= len(f.text) {
+		return nil, nil
+	}
+	switch f.text[f.pos] {
+	case '[':
+		f.pos++
+		items := []any{}
+		for {
+			f.space()
+			if f.pos < len(f.text) && f.text[f.pos] == ']' {
+				f.pos++
+				return items, nil
+			}
+			item, err := f.value(true)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			f.space()
+			if f.pos >= len(f.text) {
+				return nil, errors.New("unterminated flow sequence")
+			}
+			if f.text[f.pos] == ',' {
+				f.pos++
+			} else if f.text[f.pos] != ']' {
+				return nil, fmt.Errorf("expected , or ] at %q", f.text[f.pos:])
+			}
+		}
+	case '{':
+		f.pos++
+		values := map[string]any{}
+		for {
+			f.space()
+			if f.pos < len(f.text) && f.text[f.pos] == '}' {
+				f.pos++
+				return values, nil
+			}
+			key, err := f.value(true)
+			if err != nil {
+				return nil, err
+			}
+			f.space()
+			if f.pos >= len(f.text) || f.text[f.pos] != ':' {
+				return nil, errors.New("expected : in flow mapping")
+			}
+			f.pos++
+			value, err := f.value(true)
+			if err != nil {
+				return nil, err
+			}
+			values[fmt.Sprint(key)] = value
+			f.space()
+			if f.pos >= len(f.text) {
+				return nil, errors.New("unterminated flow mapping")
+			}
+			if f.text[f.pos] == ',' {
+				f.pos++
+			} else if f.text[f.pos] != '}' {
+				return nil, fmt.Errorf("expected , or } at %q", f.text[f.pos:])
+			}
+		}
+	case '\'', '"':
+		value, end, err := parseYAMLQuoted(f.text, f.pos)
+		if err != nil {
+			return nil, err
+		}
+		f.pos = end
+		return value, nil
+	}
+
+	start := f.pos
+	for f.pos < len(f.text) {
+		c := f.text[f.pos]
+		if inFlow && (c == ',' || c == ']' || c == '}' || (c == ':' && (f.pos+1 == len(f.text) || f.text[f.pos+1] == ' '))) {
+			break
+		}
+		f.pos++
+	}
+	plain := strings.TrimSpace(f.text[start:f.pos])
+	if plain == "null" || plain == "~" || plain == "Null" || plain == "NULL" {
+		return nil, nil
+	}
+	return plain, nil
+}
+
+// parseYAMLQuoted reads a quoted scalar starting at start and returns it with
+// the index just past the closing quote.
+func parseYAMLQuoted(text string, start int) (string, int, error) {
+	quote := text[start]
+	var out strings.Builder
+	for i := start + 1; i < len(text); i++ {
+		c := text[i]
+		if quote == '\'' {
+			if c == '\'' {
+				if i+1 < len(text) && text[i+1] == '\'' {
+					out.WriteByte('\'')
+					i++
+					continue
+				}
+				return out.String(), i + 1, nil
+			}
+			out.WriteByte(c)
+			continue
+		}
+		switch c {
+		case '"':
+			return out.String(), i + 1, nil
+		case '\\':
+			if i+1 >= len(text) {
+				return "", 0, errors.New("unterminated escape")
+			}
+			i++
+			switch text[i] {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case 'r':
+				out.WriteByte('\r')
+			case '0':
+				out.WriteByte(0)
+			default:
+				out.WriteByte(text[i])
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated quoted string")
+}